@@ -0,0 +1,68 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/coding-hui/iam/internal/identity"
+)
+
+func runHasher(args []string) int {
+	if len(args) < 1 || args[0] != "calibrate" {
+		fmt.Fprintf(os.Stderr, "Usage: iamctl hasher calibrate [-memory KiB] [-parallelism N] [-runs N] <latency>\n")
+		return exitError
+	}
+	return runHasherCalibrate(args[1:])
+}
+
+// runHasherCalibrate prints the hashers config section with the Argon2id
+// parameters that hash within the given latency on this machine.
+func runHasherCalibrate(args []string) int {
+	defaults := identity.DefaultArgon2Params()
+	fs := flag.NewFlagSet("hasher calibrate", flag.ContinueOnError)
+	memory := fs.Uint("memory", uint(defaults.Memory), "memory cost in KiB")
+	parallelism := fs.Uint("parallelism", uint(defaults.Parallelism), "degree of parallelism")
+	runs := fs.Int("runs", 3, "hashes averaged per measurement")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Error: expected a target latency such as 500ms\n")
+		return exitError
+	}
+	target, err := time.ParseDuration(fs.Arg(0))
+	if err != nil || target <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid latency %q\n", fs.Arg(0))
+		return exitError
+	}
+	if *parallelism > 255 {
+		fmt.Fprintf(os.Stderr, "Error: parallelism must be at most 255\n")
+		return exitError
+	}
+
+	base := defaults
+	base.Memory, base.Parallelism = uint32(*memory), uint8(*parallelism)
+	params, took, err := identity.CalibrateArgon2(base, target, *runs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if took > target {
+		fmt.Fprintf(os.Stderr, "Warning: the cheapest parameters take %s, more than %s\n", took.Round(time.Millisecond), target)
+	}
+
+	fmt.Fprintf(os.Stdout, "# Hashing takes %s on this machine.\n", took.Round(time.Millisecond))
+	fmt.Fprintf(os.Stdout, "hashers:\n  argon2:\n")
+	fmt.Fprintf(os.Stdout, "    memory: %d # KiB\n", params.Memory)
+	fmt.Fprintf(os.Stdout, "    iterations: %d\n", params.Iterations)
+	fmt.Fprintf(os.Stdout, "    parallelism: %d\n", params.Parallelism)
+	fmt.Fprintf(os.Stdout, "    salt_length: %d\n", params.SaltLength)
+	fmt.Fprintf(os.Stdout, "    key_length: %d\n", params.KeyLength)
+	return exitOK
+}
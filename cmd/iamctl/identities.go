@@ -0,0 +1,294 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/coding-hui/iam/internal/identity/bulk"
+	"github.com/coding-hui/iam/internal/identity/privacy"
+)
+
+// defaultServer is the API server used unless -server or IAM_SERVER is set.
+const defaultServer = "http://127.0.0.1:8080"
+
+func runIdentities(args []string) int {
+	if len(args) >= 1 {
+		switch args[0] {
+		case "import":
+			return runIdentitiesImport(args[1:])
+		case "export":
+			return runIdentitiesExport(args[1:])
+		case "data-export":
+			return runIdentitiesDataExport(args[1:])
+		case "erase":
+			return runIdentitiesErase(args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Usage: iamctl identities import [-server URL] [-format jsonl|csv] [-batch-size N] <file>\n")
+	fmt.Fprintf(os.Stderr, "       iamctl identities export [-server URL] [-format jsonl|csv] [-filter EXPR] [-o file]\n")
+	fmt.Fprintf(os.Stderr, "       iamctl identities data-export [-server URL] [-o file] <id>\n")
+	fmt.Fprintf(os.Stderr, "       iamctl identities erase [-server URL] -yes <id>\n")
+	return exitError
+}
+
+func serverFlag(fs *flag.FlagSet) *string {
+	server := os.Getenv("IAM_SERVER")
+	if server == "" {
+		server = defaultServer
+	}
+	return fs.String("server", server, "API server URL, defaults to $IAM_SERVER")
+}
+
+// runIdentitiesImport uploads a file of identities and prints the import
+// report. It exits with exitFailure if any record fails; - reads stdin.
+func runIdentitiesImport(args []string) int {
+	fs := flag.NewFlagSet("identities import", flag.ContinueOnError)
+	server := serverFlag(fs)
+	format := fs.String("format", "", "input format, jsonl or csv; defaults to the file extension")
+	batchSize := fs.Int("batch-size", 0, "records per transaction")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Error: expected one file to import\n")
+		return exitError
+	}
+
+	path := fs.Arg(0)
+	in := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		in = f
+		if *format == "" && strings.EqualFold(filepath.Ext(path), ".csv") {
+			*format = string(bulk.FormatCSV)
+		}
+	}
+	f, err := bulk.ParseFormat(*format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	query := url.Values{"format": {string(f)}}
+	if *batchSize > 0 {
+		query.Set("batch_size", strconv.Itoa(*batchSize))
+	}
+	resp, err := http.Post(strings.TrimRight(*server, "/")+"/api/v1/identities/import?"+query.Encode(), f.ContentType(), in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	defer resp.Body.Close()
+
+	var report bulk.ImportReport
+	if err := decodeResponse(resp, &report); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	fmt.Fprintf(os.Stdout, "%d records, %d imported, %d failed\n", report.Total, report.Imported, report.Failed)
+	for _, e := range report.Errors {
+		fmt.Fprintf(os.Stdout, "  row %d: %s\n", e.Row, e.Message)
+		for _, fe := range e.Errors {
+			fmt.Fprintf(os.Stdout, "    %s: %s\n", fe.Pointer, fe.Message)
+		}
+		for _, v := range e.Violations {
+			fmt.Fprintf(os.Stdout, "    %s: %s\n", v.Rule, v.Message)
+		}
+	}
+	if len(report.Errors) < report.Failed {
+		fmt.Fprintf(os.Stdout, "  ... %d more\n", report.Failed-len(report.Errors))
+	}
+	if report.Failed > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// runIdentitiesExport downloads identities to a file or stdout.
+func runIdentitiesExport(args []string) int {
+	fs := flag.NewFlagSet("identities export", flag.ContinueOnError)
+	server := serverFlag(fs)
+	format := fs.String("format", "", "output format, jsonl or csv; defaults to the file extension")
+	filterExpr := fs.String("filter", "", "filter expression selecting identities")
+	out := fs.String("o", "-", "output file, - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if fs.NArg() != 0 {
+		fmt.Fprintf(os.Stderr, "Error: unexpected arguments %q\n", fs.Args())
+		return exitError
+	}
+	if *format == "" && strings.EqualFold(filepath.Ext(*out), ".csv") {
+		*format = string(bulk.FormatCSV)
+	}
+	f, err := bulk.ParseFormat(*format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	query := url.Values{"format": {string(f)}}
+	if *filterExpr != "" {
+		query.Set("filter", *filterExpr)
+	}
+	resp, err := http.Get(strings.TrimRight(*server, "/") + "/api/v1/identities/export?" + query.Encode())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	defer resp.Body.Close()
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		if err := decodeResponse(resp, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return exitError
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		defer file.Close()
+		w = file
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if msg := resp.Trailer.Get(bulk.ExportErrorTrailer); msg != "" {
+		fmt.Fprintf(os.Stderr, "Error: export is incomplete: %s\n", msg)
+		return exitError
+	}
+	return exitOK
+}
+
+// runIdentitiesDataExport downloads the archive of everything known about
+// an identity, as needed to answer a data subject access request.
+func runIdentitiesDataExport(args []string) int {
+	fs := flag.NewFlagSet("identities data-export", flag.ContinueOnError)
+	server := serverFlag(fs)
+	out := fs.String("o", "", "output file, - for stdout; defaults to identity-<id>.tar.gz")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Error: expected one identity ID\n")
+		return exitError
+	}
+	id := fs.Arg(0)
+	if *out == "" {
+		*out = "identity-" + id + ".tar.gz"
+	}
+
+	resp, err := http.Get(strings.TrimRight(*server, "/") + "/api/v1/identities/" + url.PathEscape(id) + "/data-export")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != privacy.ArchiveContentType {
+		if err := decodeResponse(resp, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return exitError
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		defer file.Close()
+		w = file
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if *out != "-" {
+		fmt.Fprintf(os.Stdout, "wrote %s\n", *out)
+	}
+	return exitOK
+}
+
+// runIdentitiesErase erases an identity, as needed to answer a data
+// subject erasure request. It cannot be undone and requires -yes.
+func runIdentitiesErase(args []string) int {
+	fs := flag.NewFlagSet("identities erase", flag.ContinueOnError)
+	server := serverFlag(fs)
+	yes := fs.Bool("yes", false, "confirm that the identity is erased for good")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Error: expected one identity ID\n")
+		return exitError
+	}
+	if !*yes {
+		fmt.Fprintf(os.Stderr, "Error: erasure cannot be undone, pass -yes to confirm\n")
+		return exitError
+	}
+
+	resp, err := http.Post(strings.TrimRight(*server, "/")+"/api/v1/identities/"+url.PathEscape(fs.Arg(0))+"/erase", "application/json", nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	defer resp.Body.Close()
+
+	var report privacy.ErasureReport
+	if err := decodeResponse(resp, &report); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	fmt.Fprintf(os.Stdout, "erased %s, %d audit events pseudonymized as %s\n", report.IdentityID, report.AuditEvents, report.Pseudonym)
+	return exitOK
+}
+
+// decodeResponse decodes the data of an API response into data, or
+// returns the error the response reports.
+func decodeResponse(resp *http.Response, data any) error {
+	var body struct {
+		Success bool            `json:"success"`
+		Code    int             `json:"code"`
+		Msg     string          `json:"msg"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("%s: %v", resp.Status, err)
+	}
+	if !body.Success {
+		var detail string
+		if json.Unmarshal(body.Data, &detail) == nil && detail != "" {
+			return fmt.Errorf("%s (%d): %s", body.Msg, body.Code, detail)
+		}
+		return fmt.Errorf("%s (%d)", body.Msg, body.Code)
+	}
+	if data == nil {
+		return nil
+	}
+	return json.Unmarshal(body.Data, data)
+}
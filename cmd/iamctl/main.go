@@ -0,0 +1,55 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Command iamctl is the command line tool for IAM administration tasks.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Exit codes.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitError   = 2
+)
+
+const usage = `Usage: iamctl <command> [arguments]
+
+Commands:
+  policy test             Run policy unit tests from YAML files
+  hasher calibrate        Pick password hashing parameters for a target latency
+  identities import       Import identities from a JSON Lines or CSV file
+  identities export       Export identities to a JSON Lines or CSV file
+  identities data-export  Download everything known about an identity
+  identities erase        Erase an identity and pseudonymize its audit trail
+`
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitError
+	}
+
+	switch args[0] {
+	case "policy":
+		return runPolicy(args[1:])
+	case "hasher":
+		return runHasher(args[1:])
+	case "identities":
+		return runIdentities(args[1:])
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown command %q\n\n%s", args[0], usage)
+		return exitError
+	}
+}
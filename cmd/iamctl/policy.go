@@ -0,0 +1,57 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/coding-hui/iam/internal/authz/policytest"
+)
+
+func runPolicy(args []string) int {
+	if len(args) < 1 || args[0] != "test" {
+		fmt.Fprintf(os.Stderr, "Usage: iamctl policy test [-v] <file>...\n")
+		return exitError
+	}
+	return runPolicyTest(args[1:])
+}
+
+// runPolicyTest runs every suite and exits with exitFailure if any case
+// fails, or exitError if a suite cannot be loaded.
+func runPolicyTest(args []string) int {
+	fs := flag.NewFlagSet("policy test", flag.ContinueOnError)
+	verbose := fs.Bool("v", false, "list passed cases")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no policy test files given\n")
+		return exitError
+	}
+
+	code := exitOK
+	for _, path := range fs.Args() {
+		suite, err := policytest.Load(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+
+		report, err := policytest.Run(context.Background(), suite)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+			return exitError
+		}
+
+		report.Write(os.Stdout, *verbose)
+		if report.Failed() > 0 {
+			code = exitFailure
+		}
+	}
+	return code
+}
@@ -12,13 +12,21 @@ import (
 	"github.com/coding-hui/iam/internal/api/middleware"
 	"github.com/coding-hui/iam/internal/audit"
 	"github.com/coding-hui/iam/internal/authz"
+	"github.com/coding-hui/iam/internal/authz/bundle"
 	"github.com/coding-hui/iam/internal/authz/policy"
 	"github.com/coding-hui/iam/internal/authz/role"
 	"github.com/coding-hui/iam/internal/driver"
 	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/bulk"
 	"github.com/coding-hui/iam/internal/identity/lockout"
+	"github.com/coding-hui/iam/internal/identity/privacy"
+	"github.com/coding-hui/iam/internal/identity/schema"
+	"github.com/coding-hui/iam/internal/identity/serviceaccount"
 	"github.com/coding-hui/iam/internal/identity/session"
 	"github.com/coding-hui/iam/internal/identity/token"
+	"github.com/coding-hui/iam/internal/identity/verification"
+	"github.com/coding-hui/iam/internal/scim"
+	"github.com/coding-hui/iam/internal/scim/connector"
 	"github.com/coding-hui/iam/internal/selfservice/courier"
 )
 
@@ -55,9 +63,35 @@ func registerRoutes(r *gin.Engine, reg driver.Registry) {
 		v1.GET("/identities/:id", identityHandler.Get)
 		v1.PATCH("/identities/:id", identityHandler.Update)
 		v1.DELETE("/identities/:id", identityHandler.Delete)
+		v1.POST("/identities/:id/restore", identityHandler.Restore)
+		v1.PUT("/identities/:id/state", identityHandler.TransitionState)
+		v1.GET("/identities/:id/history", identityHandler.History)
 		v1.POST("/identities/:id/credentials", identityHandler.AddCredentials)
+		v1.POST("/identities/:id/credentials/password/require-change", identityHandler.RequirePasswordChange)
 		v1.DELETE("/identities/:id/credentials/:type", identityHandler.DeleteCredentials)
 
+		bulkHandler := bulk.NewHandler(reg.IdentityBulkManager())
+		v1.POST("/identities/import", bulkHandler.Import)
+		v1.GET("/identities/export", bulkHandler.Export)
+
+		privacyHandler := privacy.NewHandler(reg.IdentityPrivacyManager())
+		v1.GET("/identities/:id/data-export", privacyHandler.Export)
+		v1.POST("/identities/:id/erase", privacyHandler.Erase)
+
+		verificationHandler := verification.NewHandler(reg.VerificationManager())
+		v1.POST("/verification", verificationHandler.Send)
+		v1.POST("/verification/verify", verificationHandler.Verify)
+		v1.GET("/verification/verify", verificationHandler.VerifyLink)
+
+		schemaHandler := schema.NewHandler(reg.IdentitySchemaManager())
+		v1.POST("/schemas", schemaHandler.Create)
+		v1.GET("/schemas", schemaHandler.List)
+		v1.GET("/schemas/:id", schemaHandler.Get)
+		v1.PUT("/schemas/:id", schemaHandler.Update)
+		v1.DELETE("/schemas/:id", schemaHandler.Delete)
+		v1.GET("/schemas/:id/versions", schemaHandler.Versions)
+		v1.POST("/schemas/:id/migrate", identityHandler.MigrateSchema)
+
 		sessionHandler := session.NewHandler(reg.SessionManager())
 		v1.POST("/sessions", sessionHandler.Create)
 		v1.GET("/sessions", sessionHandler.List)
@@ -67,7 +101,14 @@ func registerRoutes(r *gin.Engine, reg driver.Registry) {
 		v1.PATCH("/sessions/:id", sessionHandler.Extend)
 
 		selfserviceHandler := reg.SelfserviceHandler()
+		v1.GET("/whoami", selfserviceHandler.Whoami)
 		v1.POST("/login", selfserviceHandler.Login)
+		v1.POST("/login/password", selfserviceHandler.ChangePassword)
+		v1.GET("/oauth/:provider/login", selfserviceHandler.OAuthLogin)
+		v1.GET("/oauth/:provider/callback", selfserviceHandler.OAuthCallback)
+		v1.GET("/oauth/links", selfserviceHandler.ListLinks)
+		v1.POST("/oauth/links/:provider", selfserviceHandler.Link)
+		v1.DELETE("/oauth/links/:provider", selfserviceHandler.Unlink)
 		v1.POST("/mfa/totp/setup", selfserviceHandler.SetupTOTP)
 		v1.POST("/mfa/totp/verify", selfserviceHandler.VerifyTOTP)
 		v1.POST("/mfa/totp/disable", selfserviceHandler.DisableTOTP)
@@ -78,6 +119,9 @@ func registerRoutes(r *gin.Engine, reg driver.Registry) {
 		v1.GET("/roles/:id", roleHandler.Get)
 		v1.PATCH("/roles/:id", roleHandler.Update)
 		v1.DELETE("/roles/:id", roleHandler.Delete)
+		v1.GET("/roles/:id/bindings", roleHandler.Bindings)
+		v1.POST("/roles/:id/bindings", roleHandler.Bind)
+		v1.DELETE("/roles/:id/bindings/:subject", roleHandler.Unbind)
 
 		policyHandler := policy.NewHandler(reg.PolicyManager())
 		v1.POST("/policies", policyHandler.Create)
@@ -85,15 +129,33 @@ func registerRoutes(r *gin.Engine, reg driver.Registry) {
 		v1.GET("/policies/:id", policyHandler.Get)
 		v1.PATCH("/policies/:id", policyHandler.Update)
 		v1.DELETE("/policies/:id", policyHandler.Delete)
+		v1.GET("/policies/:id/versions", policyHandler.Versions)
+		v1.POST("/policies/:id/rollback", policyHandler.Rollback)
 
 		authzHandler := authz.NewHandler(reg.AuthzEngine())
 		v1.POST("/authz/check", authzHandler.Check)
+		v1.POST("/authz/reload", authzHandler.Reload)
+		v1.GET("/authz/stats", authzHandler.Stats)
+
+		if reg.Config().Authz.ServeBundles {
+			bundleHandler := bundle.NewHandler(reg.AuthzBundleBuilder(), reg.AuthzBundleSigningKey())
+			v1.GET("/authz/bundle", bundleHandler.Get)
+			v1.GET("/authz/bundle/key", bundleHandler.Key)
+		}
 
 		tokenHandler := token.NewHandler(reg.TokenManager())
 		v1.POST("/tokens", tokenHandler.Create)
 		v1.POST("/tokens/introspect", tokenHandler.Introspect)
 		v1.DELETE("/tokens/:id", tokenHandler.Revoke)
 
+		serviceAccountHandler := serviceaccount.NewHandler(reg.ServiceAccountManager())
+		v1.POST("/service-accounts/token", serviceAccountHandler.Token)
+		v1.GET("/identities/:id/keys", serviceAccountHandler.ListKeys)
+		v1.POST("/identities/:id/keys", serviceAccountHandler.CreateKey)
+		v1.GET("/identities/:id/keys/:key_id", serviceAccountHandler.GetKey)
+		v1.DELETE("/identities/:id/keys/:key_id", serviceAccountHandler.DeleteKey)
+		v1.POST("/identities/:id/keys/:key_id/rotate", serviceAccountHandler.RotateKey)
+
 		auditHandler := audit.NewHandler(reg.AuditManager())
 		v1.GET("/audit/events", auditHandler.List)
 
@@ -105,6 +167,44 @@ func registerRoutes(r *gin.Engine, reg driver.Registry) {
 		v1.POST("/webhooks", courierHandler.Register)
 		v1.DELETE("/webhooks", courierHandler.Unregister)
 		v1.POST("/webhooks/events", courierHandler.SendEvent)
+
+		scimHandler := scim.NewHandler(reg.SCIMManager())
+		v1.POST("/scim/tokens", scimHandler.CreateToken)
+		v1.GET("/scim/tokens", scimHandler.ListTokens)
+		v1.DELETE("/scim/tokens/:id", scimHandler.RevokeToken)
+
+		connectorHandler := connector.NewHandler(reg.SCIMConnectorManager())
+		v1.POST("/scim/connectors", connectorHandler.Create)
+		v1.GET("/scim/connectors", connectorHandler.List)
+		v1.GET("/scim/connectors/:id", connectorHandler.Get)
+		v1.PATCH("/scim/connectors/:id", connectorHandler.Update)
+		v1.DELETE("/scim/connectors/:id", connectorHandler.Delete)
+		v1.POST("/scim/connectors/:id/sync", connectorHandler.Sync)
+		v1.GET("/scim/connectors/:id/status", connectorHandler.Status)
+		v1.GET("/scim/connectors/:id/resources", connectorHandler.Resources)
+	}
+
+	// SCIM 2.0 service provider, authenticated with SCIM tokens
+	scimV2 := r.Group("/scim/v2", scim.Authenticate(reg.SCIMManager()))
+	{
+		scimHandler := scim.NewHandler(reg.SCIMManager())
+		scimV2.GET("/Users", scimHandler.ListUsers)
+		scimV2.POST("/Users", scimHandler.CreateUser)
+		scimV2.GET("/Users/:id", scimHandler.GetUser)
+		scimV2.PUT("/Users/:id", scimHandler.ReplaceUser)
+		scimV2.PATCH("/Users/:id", scimHandler.PatchUser)
+		scimV2.DELETE("/Users/:id", scimHandler.DeleteUser)
+		scimV2.GET("/Groups", scimHandler.ListGroups)
+		scimV2.POST("/Groups", scimHandler.CreateGroup)
+		scimV2.GET("/Groups/:id", scimHandler.GetGroup)
+		scimV2.PUT("/Groups/:id", scimHandler.ReplaceGroup)
+		scimV2.PATCH("/Groups/:id", scimHandler.PatchGroup)
+		scimV2.DELETE("/Groups/:id", scimHandler.DeleteGroup)
+		scimV2.GET("/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+		scimV2.GET("/ResourceTypes", scimHandler.ResourceTypes)
+		scimV2.GET("/ResourceTypes/:id", scimHandler.ResourceTypes)
+		scimV2.GET("/Schemas", scimHandler.Schemas)
+		scimV2.GET("/Schemas/:id", scimHandler.Schemas)
 	}
 }
 
@@ -17,6 +17,8 @@ import (
 	"github.com/coding-hui/iam/internal/api"
 	"github.com/coding-hui/iam/internal/config"
 	"github.com/coding-hui/iam/internal/driver"
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/scim/connector"
 	"github.com/coding-hui/iam/pkg/shutdown"
 	"github.com/coding-hui/iam/pkg/shutdown/shutdownmanagers/posixsignal"
 )
@@ -41,6 +43,12 @@ func Run(basename string, cfg *config.Config) error {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	// Purge deleted identities in background
+	go purgeIdentities(ctx, reg, cfg.Identities.PurgeInterval)
+
+	// Provision downstream SCIM applications in background
+	go syncConnectors(ctx, reg, cfg.SCIM.SyncInterval)
+
 	// Create Gin router
 	router := api.NewRouter(reg)
 
@@ -98,3 +106,51 @@ func Run(basename string, cfg *config.Config) error {
 
 	return nil
 }
+
+// purgeIdentities purges deleted identities whose grace period has passed
+// every interval until ctx is done.
+func purgeIdentities(ctx context.Context, reg driver.Registry, interval time.Duration) {
+	if interval <= 0 {
+		interval = identity.DefaultPurgeInterval
+	}
+	logger := reg.Logger()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := reg.IdentityManager().PurgeDeletedIdentities(ctx)
+			if err != nil {
+				logger.Errorf("failed to purge deleted identities: %v", err)
+			}
+			if n > 0 {
+				logger.Infof("purged %d deleted identities", n)
+			}
+		}
+	}
+}
+
+// syncConnectors reconciles the enabled SCIM connectors every interval
+// until ctx is done.
+func syncConnectors(ctx context.Context, reg driver.Registry, interval time.Duration) {
+	if interval <= 0 {
+		interval = connector.DefaultSyncInterval
+	}
+	logger := reg.Logger()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := reg.SCIMConnectorManager().SyncAll(ctx); err != nil && ctx.Err() == nil {
+				logger.Errorf("failed to sync SCIM connectors: %v", err)
+			}
+		}
+	}
+}
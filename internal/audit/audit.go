@@ -32,17 +32,21 @@ type AuditEvent struct {
 // Pool defines the interface for reading audit data.
 type Pool interface {
 	ListEvents(ctx context.Context, networkID uuid.UUID, limit, offset int) ([]*AuditEvent, int, error)
+	ListEventsBySubject(ctx context.Context, subject uuid.UUID, limit, offset int) ([]*AuditEvent, int, error)
 }
 
 // Recorder defines the interface for writing audit events.
 type Recorder interface {
 	Record(ctx context.Context, event *AuditEvent) error
+	Pseudonymize(ctx context.Context, subject, pseudonym uuid.UUID) (int, error)
 }
 
 // Manager defines the interface for audit business logic.
 type Manager interface {
 	RecordEvent(ctx context.Context, req *RecordEventRequest) error
 	ListEvents(ctx context.Context, networkID uuid.UUID, limit, offset int) ([]*AuditEvent, int, error)
+	ListEventsBySubject(ctx context.Context, subject uuid.UUID, limit, offset int) ([]*AuditEvent, int, error)
+	PseudonymizeSubject(ctx context.Context, subject, pseudonym uuid.UUID) (int, error)
 }
 
 // RecordEventRequest holds data for recording an audit event.
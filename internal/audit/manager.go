@@ -50,5 +50,17 @@ func (m *ManagerImpl) ListEvents(ctx context.Context, networkID uuid.UUID, limit
 	return m.pool.ListEvents(ctx, networkID, limit, offset)
 }
 
+// ListEventsBySubject lists the events whose actor or target is subject.
+func (m *ManagerImpl) ListEventsBySubject(ctx context.Context, subject uuid.UUID, limit, offset int) ([]*AuditEvent, int, error) {
+	return m.pool.ListEventsBySubject(ctx, subject, limit, offset)
+}
+
+// PseudonymizeSubject replaces subject with pseudonym in the events it took
+// part in, see Recorder.Pseudonymize. It returns the number of events
+// changed.
+func (m *ManagerImpl) PseudonymizeSubject(ctx context.Context, subject, pseudonym uuid.UUID) (int, error) {
+	return m.recorder.Pseudonymize(ctx, subject, pseudonym)
+}
+
 // Ensure ManagerImpl implements Manager.
 var _ Manager = (*ManagerImpl)(nil)
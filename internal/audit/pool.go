@@ -21,6 +21,7 @@ type auditPool struct {
 type auditPersister interface {
 	CreateAuditEvent(ctx context.Context, event *persistence.AuditEvent) error
 	ListAuditEvents(ctx context.Context, networkID string, limit, offset int, filter *persistence.AuditFilter) ([]*persistence.AuditEvent, int, error)
+	PseudonymizeAuditEvents(ctx context.Context, subject, pseudonym string) (int, error)
 }
 
 // NewPool creates a new audit pool.
@@ -41,6 +42,20 @@ func (p *auditPool) ListEvents(ctx context.Context, networkID uuid.UUID, limit,
 	return events, total, nil
 }
 
+// ListEventsBySubject lists the audit events of all networks whose actor
+// or target is subject, newest first.
+func (p *auditPool) ListEventsBySubject(ctx context.Context, subject uuid.UUID, limit, offset int) ([]*AuditEvent, int, error) {
+	ms, total, err := p.persister.ListAuditEvents(ctx, "", limit, offset, &persistence.AuditFilter{Subject: subject.String()})
+	if err != nil {
+		return nil, 0, err
+	}
+	events := make([]*AuditEvent, len(ms))
+	for i := range ms {
+		events[i] = p.modelToDomain(ms[i])
+	}
+	return events, total, nil
+}
+
 func (p *auditPool) modelToDomain(m *persistence.AuditEvent) *AuditEvent {
 	if m == nil {
 		return nil
@@ -92,6 +107,13 @@ func (r *recorder) Record(ctx context.Context, event *AuditEvent) error {
 	return r.persister.CreateAuditEvent(ctx, m)
 }
 
+// Pseudonymize replaces subject with pseudonym in the events it took part
+// in and drops the client details of the events it is the actor of. The
+// events themselves are kept.
+func (r *recorder) Pseudonymize(ctx context.Context, subject, pseudonym uuid.UUID) (int, error) {
+	return r.persister.PseudonymizeAuditEvents(ctx, subject.String(), pseudonym.String())
+}
+
 func (r *recorder) domainToModel(e *AuditEvent) *persistence.AuditEvent {
 	return &persistence.AuditEvent{
 		ID:         e.ID.String(),
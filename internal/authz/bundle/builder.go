@@ -0,0 +1,115 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package bundle builds and serves signed authorization bundles.
+package bundle
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/authz"
+	"github.com/coding-hui/iam/internal/authz/policy"
+	"github.com/coding-hui/iam/internal/authz/role"
+	"github.com/coding-hui/iam/pkg/authzbundle"
+)
+
+// pageSize is the number of rows read per query while building a bundle.
+const pageSize = 100
+
+// Builder snapshots the authorization data of a network into a bundle.
+type Builder struct {
+	policies policy.Pool
+	roles    role.Pool
+}
+
+// NewBuilder creates a new bundle builder.
+func NewBuilder(policies policy.Pool, roles role.Pool) *Builder {
+	return &Builder{policies: policies, roles: roles}
+}
+
+// Build returns a sealed bundle of the policies, roles and role bindings
+// of a network.
+func (b *Builder) Build(ctx context.Context, networkID uuid.UUID) (*authzbundle.Bundle, error) {
+	bundle := &authzbundle.Bundle{
+		NetworkID:    networkID.String(),
+		CreatedAt:    time.Now().UTC(),
+		Policies:     []*authzbundle.Policy{},
+		Roles:        []*authzbundle.Role{},
+		RoleBindings: []*authzbundle.RoleBinding{},
+	}
+
+	for offset := 0; ; offset += pageSize {
+		policies, total, err := b.policies.ListPolicies(ctx, networkID, pageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range policies {
+			bundle.Policies = append(bundle.Policies, &authzbundle.Policy{
+				ID:         p.ID.String(),
+				Subjects:   p.Subjects,
+				Effect:     string(p.Effect),
+				Actions:    p.Actions,
+				Resources:  p.Resources,
+				Conditions: p.Conditions,
+			})
+		}
+		if len(policies) == 0 || offset+len(policies) >= total {
+			break
+		}
+	}
+
+	for offset := 0; ; offset += pageSize {
+		roles, total, err := b.roles.ListRoles(ctx, networkID, pageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range roles {
+			inheritFrom := make([]string, len(r.InheritFrom))
+			for i, id := range r.InheritFrom {
+				inheritFrom[i] = id.String()
+			}
+			bundle.Roles = append(bundle.Roles, &authzbundle.Role{
+				ID:          r.ID.String(),
+				Name:        r.Name,
+				InheritFrom: inheritFrom,
+			})
+		}
+		if len(roles) == 0 || offset+len(roles) >= total {
+			break
+		}
+	}
+
+	bindings, err := b.roles.ListRoleBindings(ctx, networkID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rb := range bindings {
+		bundle.RoleBindings = append(bundle.RoleBindings, &authzbundle.RoleBinding{
+			Subject: rb.Subject,
+			Role:    rb.RoleID.String(),
+		})
+	}
+
+	bundle.Seal()
+	return bundle, nil
+}
+
+// Load implements authz.Loader by building the bundle of a network.
+func (b *Builder) Load(ctx context.Context, networkID string) (*authz.Snapshot, error) {
+	id, err := uuid.Parse(networkID)
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := b.Build(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return bundle.Snapshot(), nil
+}
+
+// Ensure Builder implements authz.Loader.
+var _ authz.Loader = (*Builder)(nil)
@@ -0,0 +1,92 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/pkg/api"
+	"github.com/coding-hui/iam/pkg/authzbundle"
+)
+
+// Handler handles HTTP requests for authorization bundles.
+type Handler struct {
+	builder *Builder
+	key     ed25519.PrivateKey
+}
+
+// NewHandler creates a new bundle handler that signs bundles with key.
+func NewHandler(builder *Builder, key ed25519.PrivateKey) *Handler {
+	return &Handler{builder: builder, key: key}
+}
+
+// Get handles GET /api/v1/authz/bundle.
+// It responds with 304 Not Modified when If-None-Match names the current
+// revision.
+func (h *Handler) Get(c *gin.Context) {
+	networkIDStr := c.GetString("network_id")
+	if networkIDStr == "" {
+		networkIDStr = "00000000-0000-0000-0000-000000000000"
+	}
+	networkID, err := uuid.Parse(networkIDStr)
+	if err != nil {
+		api.FailWithMessage("invalid network_id", c)
+		return
+	}
+
+	b, err := h.builder.Build(c.Request.Context(), networkID)
+	if err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	etag := b.ETag()
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	if matchETag(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := authzbundle.Encode(&buf, b, h.key); err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	c.Data(http.StatusOK, authzbundle.ContentType, buf.Bytes())
+}
+
+// Key handles GET /api/v1/authz/bundle/key.
+func (h *Handler) Key(c *gin.Context) {
+	pub := h.key.Public().(ed25519.PublicKey)
+	api.OkWithData(gin.H{
+		"alg":        "EdDSA",
+		"key_id":     authzbundle.KeyID(pub),
+		"public_key": base64.StdEncoding.EncodeToString(pub),
+	}, c)
+}
+
+// matchETag reports whether an If-None-Match header matches etag using
+// weak comparison.
+func matchETag(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
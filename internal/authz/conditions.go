@@ -0,0 +1,173 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// matchConditions checks policy conditions against the request context.
+//
+// Conditions are a JSON object mapping context keys to expected values.
+// A key that is not in the context is looked up as a dotted path into
+// nested objects, such as subject.metadata_public.department. A scalar
+// must equal the context value, except that a string in CIDR notation,
+// such as 10.0.0.0/8, matches the IP addresses of the prefix; an array
+// matches if any element does. All keys must match. It returns an empty
+// string if the conditions hold, or the reason they do not.
+func matchConditions(raw json.RawMessage, ctx map[string]any) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+
+	var conditions map[string]any
+	if err := json.Unmarshal(raw, &conditions); err != nil {
+		return "invalid conditions"
+	}
+
+	keys := make([]string, 0, len(conditions))
+	for key := range conditions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		expected := conditions[key]
+		actual, ok := lookup(ctx, key)
+		if !ok {
+			return fmt.Sprintf("condition %q not met: missing from context", key)
+		}
+		if !conditionMatches(expected, normalize(actual)) {
+			return fmt.Sprintf("condition %q not met", key)
+		}
+	}
+	return ""
+}
+
+// lookup returns the context value of key, following dots into nested
+// objects when the key itself is missing.
+func lookup(ctx map[string]any, key string) (any, bool) {
+	if v, ok := ctx[key]; ok {
+		return v, true
+	}
+	var cur any = ctx
+	for _, part := range strings.Split(key, ".") {
+		m, ok := normalize(cur).(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func conditionMatches(expected, actual any) bool {
+	if values, ok := expected.([]any); ok {
+		for _, v := range values {
+			if valueMatches(v, actual) {
+				return true
+			}
+		}
+		return false
+	}
+	return valueMatches(expected, actual)
+}
+
+// valueMatches reports whether actual equals expected, or is an IP address
+// of the prefix expected is in CIDR notation.
+func valueMatches(expected, actual any) bool {
+	if reflect.DeepEqual(expected, actual) {
+		return true
+	}
+	cidr, ok := expected.(string)
+	if !ok || !strings.Contains(cidr, "/") {
+		return false
+	}
+	ip, ok := actual.(string)
+	if !ok {
+		return false
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && prefix.Contains(addr.Unmap())
+}
+
+// ValidateConditions checks that raw holds conditions matchConditions can
+// evaluate: a JSON object whose values are scalars or arrays of scalars.
+// Policies are checked when they are written, so that conditions with
+// unsupported operators are rejected instead of never matching.
+func ValidateConditions(raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	var conditions map[string]any
+	if err := json.Unmarshal(raw, &conditions); err != nil || conditions == nil {
+		return errors.New("conditions must be a JSON object")
+	}
+	for key, expected := range conditions {
+		values, ok := expected.([]any)
+		if !ok {
+			values = []any{expected}
+		}
+		for _, v := range values {
+			switch v.(type) {
+			case map[string]any, []any:
+				return fmt.Errorf("condition %q: values must be strings, numbers, booleans or arrays of them", key)
+			}
+		}
+	}
+	return nil
+}
+
+// subjectConditions splits the conditions on subject attributes from the
+// other conditions of raw. It returns the other conditions and the sorted
+// keys of the conditions on subject attributes. Invalid conditions are
+// returned as they are.
+func subjectConditions(raw json.RawMessage) (json.RawMessage, []string) {
+	var conditions map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &conditions); err != nil || conditions == nil {
+		return raw, nil
+	}
+
+	var keys []string
+	for key := range conditions {
+		if key == SubjectContextKey || strings.HasPrefix(key, SubjectContextKey+".") {
+			keys = append(keys, key)
+			delete(conditions, key)
+		}
+	}
+	if len(keys) == 0 {
+		return raw, nil
+	}
+	sort.Strings(keys)
+	rest, _ := json.Marshal(conditions)
+	return rest, keys
+}
+
+// normalize converts v to the types produced by encoding/json so that
+// context values compare equal to decoded condition values.
+func normalize(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
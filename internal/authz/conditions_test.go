@@ -0,0 +1,73 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// TestStoredConditions evaluates conditions of the shapes stored policies
+// already have.
+func TestStoredConditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions string
+		context    map[string]any
+		want       string
+	}{
+		{"cidr", `{"ip":"10.0.0.0/8"}`, map[string]any{"ip": "10.1.2.3"}, DecisionAllow},
+		{"cidr outside", `{"ip":"10.0.0.0/8"}`, map[string]any{"ip": "192.168.0.1"}, DecisionDeny},
+		{"cidr of an invalid address", `{"ip":"10.0.0.0/8"}`, map[string]any{"ip": "10.x"}, DecisionDeny},
+		{"cidr of a mapped address", `{"ip":"10.0.0.0/8"}`, map[string]any{"ip": "::ffff:10.1.2.3"}, DecisionAllow},
+		{"ipv6 cidr", `{"ip":"2001:db8::/32"}`, map[string]any{"ip": "2001:db8::1"}, DecisionAllow},
+		{"cidr list", `{"ip":["10.0.0.0/8","192.168.0.0/16"]}`, map[string]any{"ip": "192.168.1.1"}, DecisionAllow},
+		{"exact address", `{"ip":"10.0.0.1"}`, map[string]any{"ip": "10.0.0.1"}, DecisionAllow},
+		{"string with a slash", `{"path":"a/b"}`, map[string]any{"path": "a/b"}, DecisionAllow},
+		{"list", `{"env":["prod","staging"]}`, map[string]any{"env": "staging"}, DecisionAllow},
+		{"number", `{"level":3}`, map[string]any{"level": 3}, DecisionAllow},
+		{"boolean", `{"mfa":true}`, map[string]any{"mfa": false}, DecisionDeny},
+		{"missing", `{"ip":"10.0.0.0/8"}`, nil, DecisionDeny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateConditions(json.RawMessage(tt.conditions)); err != nil {
+				t.Fatalf("ValidateConditions() error = %v", err)
+			}
+			p := allow("", "p1", "alice")
+			p.Conditions = json.RawMessage(tt.conditions)
+			e := NewEngine()
+			e.Reload("", &Snapshot{Policies: []*Policy{p}})
+
+			resp, err := e.Authorize(context.Background(), &AuthzRequest{Subject: "alice", Action: "read", Resource: "doc", Context: tt.context})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Decision != tt.want {
+				t.Errorf("Authorize() = %s (%s), want %s", resp.Decision, resp.Reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConditions(t *testing.T) {
+	for _, raw := range []string{``, `null`, `{}`, `{"ip":"10.0.0.0/8","env":["prod",null]}`} {
+		if err := ValidateConditions(json.RawMessage(raw)); err != nil {
+			t.Errorf("ValidateConditions(%s) error = %v", raw, err)
+		}
+	}
+	for _, raw := range []string{
+		`[]`,
+		`"ip"`,
+		`{"ip":{"type":"CIDRCondition","options":{"cidr":"10.0.0.0/8"}}}`,
+		`{"env":[["prod"]]}`,
+		`{"subject":{"metadata_public":{"department":"eng"}}}`,
+	} {
+		if err := ValidateConditions(json.RawMessage(raw)); err == nil {
+			t.Errorf("ValidateConditions(%s) succeeded, want an error", raw)
+		}
+	}
+}
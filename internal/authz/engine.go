@@ -8,20 +8,84 @@ import (
 	"context"
 	"encoding/json"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Decisions returned by the engine.
+const (
+	DecisionAllow = "allow"
+	DecisionDeny  = "deny"
+)
+
+// DefaultNetworkID is the network used when none is given.
+const DefaultNetworkID = "00000000-0000-0000-0000-000000000000"
+
+// SubjectContextKey is the context key holding the attributes of the
+// request subject, see SetSubjectAttributes.
+const SubjectContextKey = "subject"
+
 // Engine is the authorization engine with zero external dependencies.
+//
+// Policies, roles, bindings and cached decisions are partitioned by network;
+// a request is only ever evaluated against the data of its own network.
+// Policies name their subjects directly or through roles. A request subject
+// holds every role bound to it and every role those roles inherit from.
+// Deny overrides allow: a request is allowed only if an allow policy matches
+// and no deny policy does.
 type Engine struct {
-	mu       sync.RWMutex
+	mu         sync.RWMutex
+	tenants    map[string]*tenant
+	loads      map[string]*load
+	loader     Loader
+	attributes SubjectAttributes
+	cacheTTL   time.Duration
+
+	// noAttributes makes conditions on subject attributes fail closed,
+	// see DisableSubjectAttributes.
+	noAttributes bool
+}
+
+// tenant holds the engine state of a single network.
+type tenant struct {
 	policies map[string]*Policy
+	roles    map[string]*Role
+	bindings map[string][]string
 	cache    map[string]*CachedDecision
-	cacheTTL time.Duration
+	loadedAt time.Time
+	counters *counters
+
+	// generation is bumped whenever cached decisions are dropped, so that
+	// decisions evaluated against older data are not cached.
+	generation uint64
+}
+
+// counters survive reloads of a network. mutations counts the changes
+// made to the network in place, so that loads racing with them can be
+// detected.
+type counters struct {
+	decisions   atomic.Uint64
+	allowed     atomic.Uint64
+	cacheHits   atomic.Uint64
+	cacheMisses atomic.Uint64
+	mutations   atomic.Uint64
+}
+
+// load is the first load of a network, shared by the requests waiting
+// for it.
+type load struct {
+	done chan struct{}
+	err  error
 }
 
+// maxLoadAttempts bounds how often a load is repeated because the network
+// changed while it was loaded.
+const maxLoadAttempts = 3
+
 // Policy represents a cached policy for authorization.
 type Policy struct {
 	ID         string
+	NetworkID  string
 	Subjects   []string
 	Effect     string
 	Actions    []string
@@ -29,145 +93,587 @@ type Policy struct {
 	Conditions json.RawMessage
 }
 
+// Role represents a role known to the engine.
+type Role struct {
+	ID          string
+	NetworkID   string
+	InheritFrom []string
+}
+
+// RoleBinding grants a role to a subject.
+type RoleBinding struct {
+	NetworkID string
+	Subject   string
+	Role      string
+}
+
+// Snapshot is the complete authorization data of a network.
+type Snapshot struct {
+	Policies     []*Policy
+	Roles        []*Role
+	RoleBindings []*RoleBinding
+}
+
+// Loader loads the authorization data of a network.
+type Loader interface {
+	Load(ctx context.Context, networkID string) (*Snapshot, error)
+}
+
+// LoaderFunc adapts a function to a Loader.
+type LoaderFunc func(ctx context.Context, networkID string) (*Snapshot, error)
+
+// Load calls f(ctx, networkID).
+func (f LoaderFunc) Load(ctx context.Context, networkID string) (*Snapshot, error) {
+	return f(ctx, networkID)
+}
+
+// SubjectAttributes resolves the attributes of request subjects. It
+// returns nil for subjects it does not know.
+type SubjectAttributes interface {
+	Attributes(ctx context.Context, networkID, subject string) (map[string]any, error)
+}
+
+// SubjectAttributesFunc adapts a function to SubjectAttributes.
+type SubjectAttributesFunc func(ctx context.Context, networkID, subject string) (map[string]any, error)
+
+// Attributes calls f(ctx, networkID, subject).
+func (f SubjectAttributesFunc) Attributes(ctx context.Context, networkID, subject string) (map[string]any, error) {
+	return f(ctx, networkID, subject)
+}
+
 // CachedDecision represents a cached authorization decision.
 type CachedDecision struct {
 	Decision string
 	Reason   string
+	Policy   string
 	CachedAt time.Time
 }
 
 // AuthzRequest represents an authorization request.
 type AuthzRequest struct {
-	Subject  string
-	Action   string
-	Resource string
-	Context  map[string]any
+	NetworkID string
+	Subject   string
+	Action    string
+	Resource  string
+	Context   map[string]any
 }
 
 // AuthzResponse represents an authorization response.
 type AuthzResponse struct {
 	Decision string
 	Reason   string
+	Policy   string
+}
+
+// Stats describes the engine state of a network.
+type Stats struct {
+	NetworkID       string    `json:"network_id"`
+	Loaded          bool      `json:"loaded"`
+	LoadedAt        time.Time `json:"loaded_at,omitempty"`
+	Policies        int       `json:"policies"`
+	Roles           int       `json:"roles"`
+	RoleBindings    int       `json:"role_bindings"`
+	CachedDecisions int       `json:"cached_decisions"`
+	Decisions       uint64    `json:"decisions"`
+	Allowed         uint64    `json:"allowed"`
+	Denied          uint64    `json:"denied"`
+	CacheHits       uint64    `json:"cache_hits"`
+	CacheMisses     uint64    `json:"cache_misses"`
 }
 
 // NewEngine creates a new authorization engine.
 func NewEngine() *Engine {
 	return &Engine{
+		tenants:  make(map[string]*tenant),
+		loads:    make(map[string]*load),
+		cacheTTL: 5 * time.Minute,
+	}
+}
+
+func newTenant() *tenant {
+	return &tenant{
 		policies: make(map[string]*Policy),
+		roles:    make(map[string]*Role),
+		bindings: make(map[string][]string),
 		cache:    make(map[string]*CachedDecision),
-		cacheTTL: 5 * time.Minute,
+		counters: &counters{},
 	}
 }
 
-// Authorize makes an authorization decision.
+// SetLoader sets the loader used to populate a network on its first
+// request. Networks that were never loaded are evaluated as they are.
+func (e *Engine) SetLoader(l Loader) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.loader = l
+}
+
+// SetSubjectAttributes sets the source of the attributes of request
+// subjects. Their attributes are added to the request context under
+// SubjectContextKey, replacing what the caller put there, so conditions
+// can refer to them as subject.<attribute>.
+func (e *Engine) SetSubjectAttributes(a SubjectAttributes) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.attributes = a
+	e.noAttributes = false
+}
+
+// DisableSubjectAttributes declares that the attributes of request
+// subjects are unavailable, e.g. when evaluating away from the server.
+// Conditions on them then fail closed: allow policies with such conditions
+// never match, and deny policies match regardless of them. Attributes in
+// the request context are ignored.
+func (e *Engine) DisableSubjectAttributes() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.attributes = nil
+	e.noAttributes = true
+}
+
+// Authorize makes an authorization decision. Requests without context are
+// cached, unless a policy that applies to them has conditions on subject
+// attributes.
 func (e *Engine) Authorize(ctx context.Context, req *AuthzRequest) (*AuthzResponse, error) {
+	t, err := e.tenantFor(ctx, req.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The generation is read before the policies are inspected for
+	// conditions on subject attributes, so that a decision is not cached
+	// when they change in between.
 	cacheKey := e.cacheKey(req)
-	if decision, ok := e.getCachedDecision(cacheKey); ok {
-		return decision, nil
+	cached, generation, hit := e.getCachedDecision(t, cacheKey)
+	req, attributed, err := e.withSubjectAttributes(ctx, t, req)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheable := len(req.Context) == 0 && !attributed
+	if cacheable {
+		if hit {
+			t.counters.cacheHits.Add(1)
+			t.record(cached)
+			return cached, nil
+		}
+		t.counters.cacheMisses.Add(1)
+	}
+
+	decision := e.evaluate(t, req, nil).response()
+	if cacheable {
+		e.setCachedDecision(t, cacheKey, generation, decision)
 	}
+	t.record(decision)
+	return decision, nil
+}
 
+// withSubjectAttributes returns req with the attributes of its subject in
+// its context, replacing what the caller put there. The attributes are
+// only resolved when a policy that applies to req has conditions on them;
+// it reports whether they were.
+func (e *Engine) withSubjectAttributes(ctx context.Context, t *tenant, req *AuthzRequest) (*AuthzRequest, bool, error) {
+	e.mu.RLock()
+	source := e.attributes
+	e.mu.RUnlock()
+	if source == nil {
+		return req, false, nil
+	}
+
+	out := *req
+	if _, spoofed := req.Context[SubjectContextKey]; spoofed {
+		out.Context = make(map[string]any, len(req.Context))
+		for k, v := range req.Context {
+			out.Context[k] = v
+		}
+		delete(out.Context, SubjectContextKey)
+	}
+	if !e.usesSubjectAttributes(t, req) {
+		return &out, false, nil
+	}
+
+	attrs, err := source.Attributes(ctx, normalizeNetworkID(req.NetworkID), req.Subject)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(attrs) > 0 {
+		withAttrs := make(map[string]any, len(out.Context)+1)
+		for k, v := range out.Context {
+			withAttrs[k] = v
+		}
+		withAttrs[SubjectContextKey] = attrs
+		out.Context = withAttrs
+	}
+	return &out, true, nil
+}
+
+// usesSubjectAttributes reports whether a policy that applies to the
+// subject, action and resource of req has conditions on subject
+// attributes.
+func (e *Engine) usesSubjectAttributes(t *tenant, req *AuthzRequest) bool {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	for _, p := range e.policies {
-		if e.matchesPolicy(req, p) {
-			decision := &AuthzResponse{
-				Decision: p.Effect,
-				Reason:   "matched policy",
-			}
-			e.setCachedDecision(cacheKey, decision)
-			return decision, nil
+	subjects := t.subjects(req.Subject)
+	for _, p := range t.policies {
+		if !matchAny(p.Subjects, subjects...) || !matchAny(p.Actions, req.Action) || !matchAny(p.Resources, req.Resource) {
+			continue
+		}
+		if _, keys := subjectConditions(p.Conditions); len(keys) > 0 {
+			return true
 		}
 	}
+	return false
+}
 
-	return &AuthzResponse{
-		Decision: "deny",
-		Reason:   "no matching policy",
-	}, nil
+func (t *tenant) record(decision *AuthzResponse) {
+	t.counters.decisions.Add(1)
+	if decision.Decision == DecisionAllow {
+		t.counters.allowed.Add(1)
+	}
+}
+
+// Reload replaces the data of a network and drops its cached decisions.
+func (e *Engine) Reload(networkID string, s *Snapshot) {
+	t := snapshotTenant(s)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.install(normalizeNetworkID(networkID), t)
+}
+
+// ReloadFrom loads a network with the configured loader and replaces its
+// data. A load that raced with changes to the network is repeated, so
+// that the changes are not lost.
+func (e *Engine) ReloadFrom(ctx context.Context, networkID string) error {
+	e.mu.RLock()
+	loader := e.loader
+	e.mu.RUnlock()
+	if loader == nil {
+		return ErrNoLoader
+	}
+
+	networkID = normalizeNetworkID(networkID)
+	for range maxLoadAttempts {
+		e.mu.RLock()
+		prev := e.tenants[networkID]
+		var mutations uint64
+		if prev != nil {
+			mutations = prev.counters.mutations.Load()
+		}
+		e.mu.RUnlock()
+
+		s, err := loader.Load(ctx, networkID)
+		if err != nil {
+			return err
+		}
+		t := snapshotTenant(s)
+
+		e.mu.Lock()
+		if cur := e.tenants[networkID]; cur == prev && (cur == nil || cur.counters.mutations.Load() == mutations) {
+			e.install(networkID, t)
+			e.mu.Unlock()
+			return nil
+		}
+		e.mu.Unlock()
+	}
+	return ErrReloadConflict
+}
+
+// snapshotTenant returns the state of a network holding s.
+func snapshotTenant(s *Snapshot) *tenant {
+	t := newTenant()
+	for _, p := range s.Policies {
+		t.policies[p.ID] = p
+	}
+	for _, r := range s.Roles {
+		t.roles[r.ID] = r
+	}
+	for _, b := range s.RoleBindings {
+		t.bindings[b.Subject] = append(t.bindings[b.Subject], b.Role)
+	}
+	t.loadedAt = time.Now()
+	return t
+}
+
+// install replaces the state of a network, keeping its counters. Callers
+// must hold e.mu for writing.
+func (e *Engine) install(networkID string, t *tenant) {
+	if old, ok := e.tenants[networkID]; ok {
+		t.counters = old.counters
+	}
+	e.tenants[networkID] = t
 }
 
-// LoadPolicies loads policies into the engine.
+// LoadPolicies replaces all policies in the engine.
 func (e *Engine) LoadPolicies(policies []*Policy) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	e.policies = make(map[string]*Policy)
+	for _, t := range e.tenants {
+		t.policies = make(map[string]*Policy)
+		t.reset()
+	}
 	for _, p := range policies {
-		for _, subject := range p.Subjects {
-			for _, resource := range p.Resources {
-				key := subject + ":" + resource
-				e.policies[key] = p
-			}
-		}
+		e.tenant(p.NetworkID).policies[p.ID] = p
+	}
+}
+
+// LoadRoles replaces all roles in the engine.
+func (e *Engine) LoadRoles(roles []*Role) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, t := range e.tenants {
+		t.roles = make(map[string]*Role)
+		t.reset()
+	}
+	for _, r := range roles {
+		e.tenant(r.NetworkID).roles[r.ID] = r
 	}
 }
 
-func (e *Engine) matchesPolicy(req *AuthzRequest, p *Policy) bool {
-	// Check subject
-	matchedSubject := false
-	for _, s := range p.Subjects {
-		if s == req.Subject || s == "*" {
-			matchedSubject = true
-			break
+// LoadRoleBindings replaces all role bindings in the engine.
+func (e *Engine) LoadRoleBindings(bindings []*RoleBinding) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, t := range e.tenants {
+		t.bindings = make(map[string][]string)
+		t.reset()
+	}
+	for _, b := range bindings {
+		t := e.tenant(b.NetworkID)
+		t.bindings[b.Subject] = append(t.bindings[b.Subject], b.Role)
+	}
+}
+
+// UpsertRole adds or replaces a single role and drops cached decisions.
+func (e *Engine) UpsertRole(r *Role) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t := e.tenant(r.NetworkID)
+	t.roles[r.ID] = r
+	t.reset()
+}
+
+// RemoveRole removes a role and its bindings and drops cached decisions.
+func (e *Engine) RemoveRole(networkID, id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t := e.tenant(networkID)
+	delete(t.roles, id)
+	for subject := range t.bindings {
+		t.removeBinding(subject, id)
+	}
+	t.reset()
+}
+
+// AddRoleBinding grants a role to a subject and drops cached decisions.
+func (e *Engine) AddRoleBinding(b *RoleBinding) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t := e.tenant(b.NetworkID)
+	t.removeBinding(b.Subject, b.Role)
+	t.bindings[b.Subject] = append(t.bindings[b.Subject], b.Role)
+	t.reset()
+}
+
+// RemoveRoleBinding revokes a role from a subject and drops cached decisions.
+func (e *Engine) RemoveRoleBinding(b *RoleBinding) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t := e.tenant(b.NetworkID)
+	t.removeBinding(b.Subject, b.Role)
+	t.reset()
+}
+
+// removeBinding removes role from the bindings of subject. Callers must
+// hold e.mu.
+func (t *tenant) removeBinding(subject, role string) {
+	roles := t.bindings[subject][:0]
+	for _, r := range t.bindings[subject] {
+		if r != role {
+			roles = append(roles, r)
 		}
 	}
-	if !matchedSubject {
-		return false
+	if len(roles) == 0 {
+		delete(t.bindings, subject)
+		return
 	}
+	t.bindings[subject] = roles
+}
+
+// UpsertPolicy adds or replaces a single policy and drops cached decisions.
+func (e *Engine) UpsertPolicy(p *Policy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t := e.tenant(p.NetworkID)
+	t.policies[p.ID] = p
+	t.reset()
+}
+
+// RemovePolicy removes a policy and drops cached decisions.
+func (e *Engine) RemovePolicy(networkID, id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	t := e.tenant(networkID)
+	delete(t.policies, id)
+	t.reset()
+}
 
-	// Check action
-	matchedAction := false
-	for _, a := range p.Actions {
-		if a == req.Action || a == "*" {
-			matchedAction = true
-			break
+// Stats returns the engine state of a network.
+func (e *Engine) Stats(networkID string) *Stats {
+	networkID = normalizeNetworkID(networkID)
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	s := &Stats{NetworkID: networkID}
+	t, ok := e.tenants[networkID]
+	if !ok {
+		return s
+	}
+
+	bindings := 0
+	for _, roles := range t.bindings {
+		bindings += len(roles)
+	}
+	s.Loaded = !t.loadedAt.IsZero()
+	s.LoadedAt = t.loadedAt
+	s.Policies = len(t.policies)
+	s.Roles = len(t.roles)
+	s.RoleBindings = bindings
+	s.CachedDecisions = len(t.cache)
+	s.Decisions = t.counters.decisions.Load()
+	s.Allowed = t.counters.allowed.Load()
+	s.Denied = s.Decisions - s.Allowed
+	s.CacheHits = t.counters.cacheHits.Load()
+	s.CacheMisses = t.counters.cacheMisses.Load()
+	return s
+}
+
+// tenant returns the state of a network, creating it if needed. Callers
+// must hold e.mu for writing.
+func (e *Engine) tenant(networkID string) *tenant {
+	networkID = normalizeNetworkID(networkID)
+	t, ok := e.tenants[networkID]
+	if !ok {
+		t = newTenant()
+		e.tenants[networkID] = t
+	}
+	return t
+}
+
+// tenantFor returns the state of a network for evaluation, loading it
+// first if a loader is set and the network was never loaded. Concurrent
+// requests share the first load.
+func (e *Engine) tenantFor(ctx context.Context, networkID string) (*tenant, error) {
+	networkID = normalizeNetworkID(networkID)
+
+	e.mu.Lock()
+	t, ok := e.tenants[networkID]
+	if e.loader == nil || (ok && !t.loadedAt.IsZero()) {
+		if !ok {
+			t = e.tenant(networkID)
 		}
+		e.mu.Unlock()
+		return t, nil
 	}
-	if !matchedAction {
-		return false
+	l, loading := e.loads[networkID]
+	if !loading {
+		l = &load{done: make(chan struct{})}
+		e.loads[networkID] = l
 	}
+	e.mu.Unlock()
 
-	// Check resource
-	matchedResource := false
-	for _, r := range p.Resources {
-		if r == req.Resource || r == "*" {
-			matchedResource = true
-			break
+	if loading {
+		select {
+		case <-l.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
+	} else {
+		l.err = e.ReloadFrom(ctx, networkID)
+		e.mu.Lock()
+		delete(e.loads, networkID)
+		e.mu.Unlock()
+		close(l.done)
 	}
-	return matchedResource
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.tenant(networkID), nil
+}
+
+// reset drops cached decisions after a change to the network. Callers
+// must hold e.mu for writing.
+func (t *tenant) reset() {
+	t.cache = make(map[string]*CachedDecision)
+	t.generation++
+	t.counters.mutations.Add(1)
+}
+
+func normalizeNetworkID(networkID string) string {
+	if networkID == "" {
+		return DefaultNetworkID
+	}
+	return networkID
 }
 
 func (e *Engine) cacheKey(req *AuthzRequest) string {
 	return req.Subject + ":" + req.Action + ":" + req.Resource
 }
 
-func (e *Engine) getCachedDecision(key string) (*AuthzResponse, bool) {
+// getCachedDecision returns the cached decision for key and the generation
+// of the cache, which a decision evaluated on a miss must be cached with.
+func (e *Engine) getCachedDecision(t *tenant, key string) (*AuthzResponse, uint64, bool) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	decision, ok := e.cache[key]
+	decision, ok := t.cache[key]
 	if !ok {
-		return nil, false
+		return nil, t.generation, false
 	}
 
 	if time.Since(decision.CachedAt) > e.cacheTTL {
-		return nil, false
+		return nil, t.generation, false
 	}
 
 	return &AuthzResponse{
 		Decision: decision.Decision,
 		Reason:   decision.Reason,
-	}, true
+		Policy:   decision.Policy,
+	}, t.generation, true
 }
 
-func (e *Engine) setCachedDecision(key string, decision *AuthzResponse) {
+// setCachedDecision caches decision unless the cached decisions were
+// dropped since generation, i.e. it may have been evaluated against stale
+// data.
+func (e *Engine) setCachedDecision(t *tenant, key string, generation uint64, decision *AuthzResponse) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	e.cache[key] = &CachedDecision{
+	if t.generation != generation {
+		return
+	}
+	t.cache[key] = &CachedDecision{
 		Decision: decision.Decision,
 		Reason:   decision.Reason,
+		Policy:   decision.Policy,
 		CachedAt: time.Now(),
 	}
 }
@@ -0,0 +1,199 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const otherNetworkID = "11111111-1111-1111-1111-111111111111"
+
+func allow(networkID, id, subject string) *Policy {
+	return &Policy{ID: id, NetworkID: networkID, Subjects: []string{subject}, Effect: DecisionAllow, Actions: []string{"read"}, Resources: []string{"doc"}}
+}
+
+func decide(t *testing.T, e *Engine, networkID, subject string) string {
+	t.Helper()
+	resp, err := e.Authorize(context.Background(), &AuthzRequest{NetworkID: networkID, Subject: subject, Action: "read", Resource: "doc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Decision
+}
+
+func TestEnginePartitionsNetworks(t *testing.T) {
+	e := NewEngine()
+	e.UpsertPolicy(allow("", "p1", "editor"))
+	e.UpsertRole(&Role{ID: "editor"})
+	e.AddRoleBinding(&RoleBinding{Subject: "alice", Role: "editor"})
+	e.Reload(otherNetworkID, &Snapshot{Policies: []*Policy{allow(otherNetworkID, "p1", "bob")}})
+
+	for _, tc := range []struct {
+		networkID, subject, want string
+	}{
+		{"", "alice", DecisionAllow},
+		{DefaultNetworkID, "alice", DecisionAllow},
+		{"", "bob", DecisionDeny},
+		{otherNetworkID, "alice", DecisionDeny},
+		{otherNetworkID, "bob", DecisionAllow},
+	} {
+		if got := decide(t, e, tc.networkID, tc.subject); got != tc.want {
+			t.Errorf("Authorize(%q, %s) = %s, want %s", tc.networkID, tc.subject, got, tc.want)
+		}
+	}
+
+	e.RemoveRoleBinding(&RoleBinding{Subject: "alice", Role: "editor"})
+	if got := decide(t, e, "", "alice"); got != DecisionDeny {
+		t.Errorf("Authorize() after unbinding = %s, want deny", got)
+	}
+}
+
+func TestEngineStats(t *testing.T) {
+	e := NewEngine()
+	e.Reload("", &Snapshot{
+		Policies:     []*Policy{allow("", "p1", "editor")},
+		Roles:        []*Role{{ID: "editor"}},
+		RoleBindings: []*RoleBinding{{Subject: "alice", Role: "editor"}},
+	})
+	decide(t, e, "", "alice")
+	decide(t, e, "", "alice")
+	decide(t, e, "", "bob")
+
+	s := e.Stats("")
+	if !s.Loaded || s.Policies != 1 || s.Roles != 1 || s.RoleBindings != 1 {
+		t.Errorf("Stats() data = %+v", s)
+	}
+	if s.Decisions != 3 || s.Allowed != 2 || s.Denied != 1 || s.CacheHits != 1 || s.CacheMisses != 2 || s.CachedDecisions != 2 {
+		t.Errorf("Stats() counters = %+v", s)
+	}
+
+	e.Reload("", &Snapshot{})
+	if s := e.Stats(""); s.Policies != 0 || s.Decisions != 3 || s.CachedDecisions != 0 {
+		t.Errorf("Stats() after reload = %+v", s)
+	}
+	if s := e.Stats(otherNetworkID); s.Loaded || s.Decisions != 0 {
+		t.Errorf("Stats() of another network = %+v", s)
+	}
+}
+
+func TestEngineLoadsOnFirstRequest(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	e := NewEngine()
+	e.SetLoader(LoaderFunc(func(_ context.Context, networkID string) (*Snapshot, error) {
+		loads.Add(1)
+		<-release
+		return &Snapshot{Policies: []*Policy{allow(networkID, "p1", "alice")}}, nil
+	}))
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := decide(t, e, otherNetworkID, "alice"); got != DecisionAllow {
+				t.Errorf("Authorize() = %s, want allow", got)
+			}
+		}()
+	}
+	for loads.Load() == 0 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+	if n := loads.Load(); n != 1 {
+		t.Errorf("loaded the network %d times, want 1", n)
+	}
+}
+
+func TestEngineReloadKeepsConcurrentChanges(t *testing.T) {
+	stored := []*Policy{allow("", "p1", "alice")}
+	var loads int
+	e := NewEngine()
+	e.Reload("", &Snapshot{Policies: stored})
+	e.SetLoader(LoaderFunc(func(context.Context, string) (*Snapshot, error) {
+		snapshot := &Snapshot{Policies: stored}
+		loads++
+		if loads == 1 {
+			// The policy is deleted after the snapshot was read.
+			stored = nil
+			e.RemovePolicy("", "p1")
+		}
+		return snapshot, nil
+	}))
+
+	if err := e.ReloadFrom(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if loads != 2 {
+		t.Errorf("loaded %d times, want 2", loads)
+	}
+	if got := decide(t, e, "", "alice"); got != DecisionDeny {
+		t.Errorf("Authorize() after a racing delete = %s, want deny", got)
+	}
+
+	e.SetLoader(LoaderFunc(func(context.Context, string) (*Snapshot, error) {
+		e.UpsertPolicy(allow("", "p2", "bob"))
+		return &Snapshot{}, nil
+	}))
+	if err := e.ReloadFrom(context.Background(), ""); err != ErrReloadConflict {
+		t.Errorf("ReloadFrom() while changing error = %v, want ErrReloadConflict", err)
+	}
+}
+
+func TestEngineSkipsStaleCacheWrites(t *testing.T) {
+	e := NewEngine()
+	req := &AuthzRequest{Subject: "alice", Action: "read", Resource: "doc"}
+	tn := e.tenant("")
+	_, generation, _ := e.getCachedDecision(tn, e.cacheKey(req))
+	stale := e.evaluate(tn, req, nil).response()
+
+	e.UpsertPolicy(allow("", "p1", "alice"))
+	e.setCachedDecision(tn, e.cacheKey(req), generation, stale)
+	if got := decide(t, e, "", "alice"); got != DecisionAllow {
+		t.Errorf("Authorize() after a stale cache write = %s, want allow", got)
+	}
+}
+
+func TestEngineResolvesSubjectAttributesLazily(t *testing.T) {
+	var resolved int
+	e := NewEngine()
+	e.SetSubjectAttributes(SubjectAttributesFunc(func(context.Context, string, string) (map[string]any, error) {
+		resolved++
+		return map[string]any{"metadata_public": map[string]any{"department": "eng"}}, nil
+	}))
+	write := allow("", "p2", "alice")
+	write.Actions = []string{"write"}
+	write.Conditions = json.RawMessage(`{"subject.metadata_public.department":"eng"}`)
+	e.Reload("", &Snapshot{Policies: []*Policy{allow("", "p1", "alice"), write}})
+
+	spoofed := map[string]any{SubjectContextKey: map[string]any{"metadata_public": map[string]any{"department": "eng"}}}
+	for range 2 {
+		if _, err := e.Authorize(context.Background(), &AuthzRequest{Subject: "alice", Action: "read", Resource: "doc", Context: spoofed}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := e.Stats(""); resolved != 0 || s.CacheHits != 1 {
+		t.Errorf("reads resolved attributes %d times with %d cache hits, want 0 and 1", resolved, s.CacheHits)
+	}
+
+	for range 2 {
+		resp, err := e.Authorize(context.Background(), &AuthzRequest{Subject: "alice", Action: "write", Resource: "doc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Decision != DecisionAllow {
+			t.Errorf("Authorize(write) = %s, want allow", resp.Decision)
+		}
+	}
+	if s := e.Stats(""); resolved != 2 || s.CacheHits != 1 {
+		t.Errorf("writes resolved attributes %d times with %d cache hits, want 2 and 1", resolved, s.CacheHits)
+	}
+}
@@ -9,4 +9,11 @@ import "errors"
 var (
 	// ErrNoMatchingPolicy is returned when no matching policy is found.
 	ErrNoMatchingPolicy = errors.New("no matching policy")
+
+	// ErrNoLoader is returned when reloading an engine without a loader.
+	ErrNoLoader = errors.New("no authz loader configured")
+
+	// ErrReloadConflict is returned when a network kept changing while it
+	// was being loaded.
+	ErrReloadConflict = errors.New("authz data changed while it was loaded")
 )
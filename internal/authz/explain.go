@@ -0,0 +1,156 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package authz
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Explanation describes how the engine reached a decision.
+type Explanation struct {
+	Decision string   `json:"decision"`
+	Reason   string   `json:"reason"`
+	Policy   string   `json:"policy,omitempty"`
+	Subjects []string `json:"subjects"`
+	Trace    []*Trace `json:"trace"`
+}
+
+// Trace records the evaluation of a single policy.
+type Trace struct {
+	Policy  string `json:"policy"`
+	Effect  string `json:"effect"`
+	Matched bool   `json:"matched"`
+	Reason  string `json:"reason"`
+}
+
+// Explain evaluates req like Authorize, bypassing the decision cache, and
+// returns the evaluation of every policy.
+func (e *Engine) Explain(ctx context.Context, req *AuthzRequest) (*Explanation, error) {
+	t, err := e.tenantFor(ctx, req.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+	if req, _, err = e.withSubjectAttributes(ctx, t, req); err != nil {
+		return nil, err
+	}
+
+	var trace []*Trace
+	ex := e.evaluate(t, req, &trace)
+	ex.Trace = trace
+	return ex, nil
+}
+
+// evaluate applies deny-overrides to all policies of a network in ID
+// order. When trace is not nil, every evaluated policy is appended to it.
+func (e *Engine) evaluate(t *tenant, req *AuthzRequest, trace *[]*Trace) *Explanation {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	subjects := t.subjects(req.Subject)
+	ids := make([]string, 0, len(t.policies))
+	for id := range t.policies {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var allowed, denied *Policy
+	for _, id := range ids {
+		p := t.policies[id]
+		reason := match(req, subjects, p, e.noAttributes)
+		if trace != nil {
+			*trace = append(*trace, &Trace{Policy: p.ID, Effect: p.Effect, Matched: reason == "", Reason: reason})
+		}
+		if reason != "" {
+			continue
+		}
+		if p.Effect == DecisionDeny {
+			if denied == nil {
+				denied = p
+			}
+			if trace == nil {
+				break
+			}
+		} else if allowed == nil {
+			allowed = p
+		}
+	}
+
+	ex := &Explanation{Subjects: subjects}
+	switch {
+	case denied != nil:
+		ex.Decision, ex.Reason, ex.Policy = DecisionDeny, "matched policy", denied.ID
+	case allowed != nil:
+		ex.Decision, ex.Reason, ex.Policy = DecisionAllow, "matched policy", allowed.ID
+	default:
+		ex.Decision, ex.Reason = DecisionDeny, "no matching policy"
+	}
+	return ex
+}
+
+func (ex *Explanation) response() *AuthzResponse {
+	return &AuthzResponse{Decision: ex.Decision, Reason: ex.Reason, Policy: ex.Policy}
+}
+
+// subjects returns subject followed by all roles it holds, directly or
+// through inheritance. Callers must hold e.mu.
+func (t *tenant) subjects(subject string) []string {
+	subjects := []string{subject}
+	seen := map[string]bool{subject: true}
+	queue := append([]string(nil), t.bindings[subject]...)
+	for len(queue) > 0 {
+		role := queue[0]
+		queue = queue[1:]
+		if seen[role] {
+			continue
+		}
+		seen[role] = true
+		subjects = append(subjects, role)
+		if r, ok := t.roles[role]; ok {
+			queue = append(queue, r.InheritFrom...)
+		}
+	}
+	return subjects
+}
+
+// match returns an empty string if p applies to req, or the reason it
+// does not. Without subject attributes, conditions on them fail closed.
+func match(req *AuthzRequest, subjects []string, p *Policy, noAttributes bool) string {
+	if !matchAny(p.Subjects, subjects...) {
+		return "subject not matched"
+	}
+	if !matchAny(p.Actions, req.Action) {
+		return "action not matched"
+	}
+	if !matchAny(p.Resources, req.Resource) {
+		return "resource not matched"
+	}
+	conditions := p.Conditions
+	if noAttributes {
+		var keys []string
+		if conditions, keys = subjectConditions(conditions); len(keys) > 0 && p.Effect != DecisionDeny {
+			return fmt.Sprintf("condition %q not met: subject attributes are unavailable", keys[0])
+		}
+	}
+	if reason := matchConditions(conditions, req.Context); reason != "" {
+		return reason
+	}
+	return ""
+}
+
+func matchAny(patterns []string, values ...string) bool {
+	for _, p := range patterns {
+		if p == "*" {
+			return true
+		}
+		for _, v := range values {
+			if p == v {
+				return true
+			}
+		}
+	}
+	return false
+}
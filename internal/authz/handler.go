@@ -27,6 +27,8 @@ func (h *Handler) Check(c *gin.Context) {
 		api.FailWithMessage("invalid request: "+err.Error(), c)
 		return
 	}
+	// Requests are always scoped to the caller's network.
+	req.NetworkID = networkID(c)
 
 	resp, err := h.engine.Authorize(c.Request.Context(), &req)
 	if err != nil {
@@ -36,3 +38,27 @@ func (h *Handler) Check(c *gin.Context) {
 
 	api.OkWithData(resp, c)
 }
+
+// Reload handles POST /api/v1/authz/reload.
+// It reloads the caller's network from the database.
+func (h *Handler) Reload(c *gin.Context) {
+	networkID := networkID(c)
+	if err := h.engine.ReloadFrom(c.Request.Context(), networkID); err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(h.engine.Stats(networkID), c)
+}
+
+// Stats handles GET /api/v1/authz/stats.
+func (h *Handler) Stats(c *gin.Context) {
+	api.OkWithData(h.engine.Stats(networkID(c)), c)
+}
+
+func networkID(c *gin.Context) string {
+	if id := c.GetString("network_id"); id != "" {
+		return id
+	}
+	return DefaultNetworkID
+}
@@ -9,4 +9,11 @@ import "errors"
 var (
 	// ErrPolicyNotFound is returned when a policy is not found.
 	ErrPolicyNotFound = errors.New("policy not found")
+
+	// ErrPolicyVersionNotFound is returned when a policy version is not found.
+	ErrPolicyVersionNotFound = errors.New("policy version not found")
+
+	// ErrVersionConflict is returned when a version number was taken by a
+	// concurrent change of the policy.
+	ErrVersionConflict = errors.New("policy version conflict")
 )
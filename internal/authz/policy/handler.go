@@ -30,6 +30,7 @@ func (h *Handler) Create(c *gin.Context) {
 		api.FailWithMessage("invalid request: "+err.Error(), c)
 		return
 	}
+	req.Author = author(c)
 
 	p, err := h.manager.CreatePolicy(c.Request.Context(), &req)
 	if err != nil {
@@ -62,6 +63,8 @@ func (h *Handler) Get(c *gin.Context) {
 }
 
 // List handles GET /api/v1/policies.
+// The optional subject query parameter restricts the result to policies
+// mentioning that subject.
 func (h *Handler) List(c *gin.Context) {
 	networkIDStr := c.GetString("network_id")
 	if networkIDStr == "" {
@@ -73,7 +76,12 @@ func (h *Handler) List(c *gin.Context) {
 		return
 	}
 
-	policies, err := h.manager.ListPolicies(c.Request.Context(), networkID)
+	var policies []*Policy
+	if subject := c.Query("subject"); subject != "" {
+		policies, err = h.manager.ListPoliciesBySubject(c.Request.Context(), networkID, subject)
+	} else {
+		policies, err = h.manager.ListPolicies(c.Request.Context(), networkID)
+	}
 	if err != nil {
 		api.FailWithErrCode(err, c)
 		return
@@ -95,6 +103,7 @@ func (h *Handler) Update(c *gin.Context) {
 		api.FailWithMessage("invalid request: "+err.Error(), c)
 		return
 	}
+	req.Author = author(c)
 
 	p, err := h.manager.UpdatePolicy(c.Request.Context(), id, &req)
 	if err != nil {
@@ -120,3 +129,65 @@ func (h *Handler) Delete(c *gin.Context) {
 
 	api.Ok(c)
 }
+
+// Versions handles GET /api/v1/policies/:id/versions.
+func (h *Handler) Versions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return
+	}
+
+	versions, err := h.manager.ListVersions(c.Request.Context(), id)
+	if err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithPage(versions, int64(len(versions)), c)
+}
+
+// Rollback handles POST /api/v1/policies/:id/rollback.
+func (h *Handler) Rollback(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return
+	}
+
+	var req RollbackPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+	if req.Version < 1 {
+		api.FailWithMessage("invalid version", c)
+		return
+	}
+	req.Author = author(c)
+
+	p, err := h.manager.RollbackPolicy(c.Request.Context(), id, &req)
+	if err != nil {
+		if errors.Is(err, ErrPolicyVersionNotFound) {
+			api.FailWithMessage(err.Error(), c)
+			return
+		}
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(p, c)
+}
+
+// author returns who makes a change: the ID of the authenticated identity
+// or, for requests without one, the request ID prefixed with "request:",
+// which ties the version to the request log.
+func author(c *gin.Context) string {
+	if id := c.GetString("identity_id"); id != "" {
+		return id
+	}
+	if rid := c.GetHeader("X-Request-ID"); rid != "" {
+		return "request:" + rid
+	}
+	return ""
+}
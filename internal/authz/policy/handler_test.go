@@ -0,0 +1,81 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package policy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/api/middleware"
+)
+
+// authors records the authors of the requests it receives.
+type authors struct {
+	Manager
+	got []string
+}
+
+func (m *authors) CreatePolicy(_ context.Context, req *CreatePolicyRequest) (*Policy, error) {
+	m.got = append(m.got, req.Author)
+	return &Policy{}, nil
+}
+
+func (m *authors) UpdatePolicy(_ context.Context, _ uuid.UUID, req *UpdatePolicyRequest) (*Policy, error) {
+	m.got = append(m.got, req.Author)
+	return &Policy{}, nil
+}
+
+func (m *authors) RollbackPolicy(_ context.Context, _ uuid.UUID, req *RollbackPolicyRequest) (*Policy, error) {
+	m.got = append(m.got, req.Author)
+	return &Policy{}, nil
+}
+
+func TestHandlerAuthor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	actorID := uuid.NewString()
+	id := uuid.NewString()
+
+	for _, authenticated := range []bool{true, false} {
+		m := &authors{}
+		h := NewHandler(m)
+		r := gin.New()
+		r.Use(middleware.RequestID())
+		if authenticated {
+			r.Use(func(c *gin.Context) { c.Set("identity_id", actorID) })
+		}
+		r.POST("/policies", h.Create)
+		r.PATCH("/policies/:id", h.Update)
+		r.POST("/policies/:id/rollback", h.Rollback)
+
+		for _, req := range []*http.Request{
+			httptest.NewRequest(http.MethodPost, "/policies", strings.NewReader(`{"name":"p"}`)),
+			httptest.NewRequest(http.MethodPatch, "/policies/"+id, strings.NewReader(`{"name":"q"}`)),
+			httptest.NewRequest(http.MethodPost, "/policies/"+id+"/rollback", strings.NewReader(`{"version":1}`)),
+		} {
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Request-ID", "req-1")
+			r.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		want := "request:req-1"
+		if authenticated {
+			want = actorID
+		}
+		if len(m.got) != 3 {
+			t.Fatalf("authenticated %v: %d requests reached the manager, want 3", authenticated, len(m.got))
+		}
+		for i, got := range m.got {
+			if got != want {
+				t.Errorf("authenticated %v: request %d author = %q, want %q", authenticated, i, got, want)
+			}
+		}
+	}
+}
@@ -6,47 +6,70 @@ package policy
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/authz"
+	"github.com/coding-hui/iam/internal/persistence"
+	"github.com/coding-hui/iam/pkg/code"
+
+	"github.com/coding-hui/common/errors"
 )
 
+// maxWriteAttempts bounds how often a change is retried after a concurrent
+// change of the policy took its version number.
+const maxWriteAttempts = 3
+
 // ManagerImpl implements policy.Manager.
 type ManagerImpl struct {
-	pool     Pool
-	privPool PrivilegedPool
+	persister persistence.Persister
+	pool      Pool
+	privPool  PrivilegedPool
+	engine    *authz.Engine
 }
 
 // NewManagerImpl creates a new policy manager.
-func NewManagerImpl(pool Pool, privPool PrivilegedPool) *ManagerImpl {
+// Every write is mirrored into engine so decisions reflect the stored policies.
+func NewManagerImpl(persister persistence.Persister, pool Pool, privPool PrivilegedPool, engine *authz.Engine) *ManagerImpl {
 	return &ManagerImpl{
-		pool:     pool,
-		privPool: privPool,
+		persister: persister,
+		pool:      pool,
+		privPool:  privPool,
+		engine:    engine,
 	}
 }
 
 // CreatePolicy creates a new policy.
 func (m *ManagerImpl) CreatePolicy(ctx context.Context, req *CreatePolicyRequest) (*Policy, error) {
-	now := time.Now()
-	r := &Policy{
-		ID:         uuid.New(),
-		NetworkID:  req.NetworkID,
-		Name:       req.Name,
-		Type:       req.Type,
-		Subjects:   req.Subjects,
-		Effect:     req.Effect,
-		Actions:    req.Actions,
-		Resources:  req.Resources,
-		Conditions: req.Conditions,
-		CreatedAt:  now,
-		UpdatedAt:  now,
-	}
-
-	if err := m.privPool.CreatePolicy(ctx, r); err != nil {
+	if err := validateConditions(req.Conditions); err != nil {
 		return nil, err
 	}
+	return m.write(ctx, func(ctx context.Context) (*Policy, error) {
+		now := time.Now()
+		r := &Policy{
+			ID:         uuid.New(),
+			NetworkID:  req.NetworkID,
+			Name:       req.Name,
+			Type:       req.Type,
+			Subjects:   req.Subjects,
+			Effect:     req.Effect,
+			Actions:    req.Actions,
+			Resources:  req.Resources,
+			Conditions: req.Conditions,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
 
-	return r, nil
+		if err := m.privPool.CreatePolicy(ctx, r); err != nil {
+			return nil, err
+		}
+		if err := m.recordVersion(ctx, nil, r, VersionActionCreated, req.Author, 0); err != nil {
+			return nil, err
+		}
+		return r, nil
+	})
 }
 
 // GetPolicy retrieves a policy by ID.
@@ -60,45 +83,209 @@ func (m *ManagerImpl) ListPolicies(ctx context.Context, networkID uuid.UUID) ([]
 	return policies, err
 }
 
+// ListPoliciesBySubject lists the policies of a network that mention subject.
+func (m *ManagerImpl) ListPoliciesBySubject(ctx context.Context, networkID uuid.UUID, subject string) ([]*Policy, error) {
+	return m.pool.ListPoliciesBySubject(ctx, networkID, subject)
+}
+
 // UpdatePolicy updates a policy.
 func (m *ManagerImpl) UpdatePolicy(ctx context.Context, id uuid.UUID, req *UpdatePolicyRequest) (*Policy, error) {
-	r, err := m.pool.GetPolicy(ctx, id)
-	if err != nil {
+	if err := validateConditions(req.Conditions); err != nil {
 		return nil, err
 	}
+	return m.write(ctx, func(ctx context.Context) (*Policy, error) {
+		r, err := m.pool.GetPolicy(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		prev, err := m.baseline(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+
+		if req.Name != "" {
+			r.Name = req.Name
+		}
+		if req.Subjects != nil {
+			r.Subjects = req.Subjects
+		}
+		if req.Effect != "" {
+			r.Effect = req.Effect
+		}
+		if req.Actions != nil {
+			r.Actions = req.Actions
+		}
+		if req.Resources != nil {
+			r.Resources = req.Resources
+		}
+		if req.Conditions != nil {
+			r.Conditions = req.Conditions
+		}
+		r.UpdatedAt = time.Now()
+
+		if err := m.privPool.UpdatePolicy(ctx, r); err != nil {
+			return nil, err
+		}
+		if err := m.recordVersion(ctx, prev, r, VersionActionUpdated, req.Author, 0); err != nil {
+			return nil, err
+		}
+		return r, nil
+	})
+}
 
-	if req.Name != "" {
-		r.Name = req.Name
+// DeletePolicy deletes a policy.
+// Its versions are kept so the history remains available after deletion.
+func (m *ManagerImpl) DeletePolicy(ctx context.Context, id uuid.UUID) error {
+	r, err := m.pool.GetPolicy(ctx, id)
+	if err != nil {
+		return err
 	}
-	if req.Subjects != nil {
-		r.Subjects = req.Subjects
+	if err := m.privPool.DeletePolicy(ctx, r.NetworkID, id); err != nil {
+		return err
 	}
-	if req.Effect != "" {
-		r.Effect = req.Effect
+	if m.engine != nil {
+		m.engine.RemovePolicy(r.NetworkID.String(), id.String())
 	}
-	if req.Actions != nil {
-		r.Actions = req.Actions
+	return nil
+}
+
+// ListVersions lists all versions of a policy, newest first.
+func (m *ManagerImpl) ListVersions(ctx context.Context, id uuid.UUID) ([]*Version, error) {
+	return m.pool.ListVersions(ctx, id)
+}
+
+// RollbackPolicy restores a previous version of a policy.
+// The restored state is stored as a new version; history is never rewritten.
+func (m *ManagerImpl) RollbackPolicy(ctx context.Context, id uuid.UUID, req *RollbackPolicyRequest) (*Policy, error) {
+	target, err := m.pool.GetVersion(ctx, id, req.Version)
+	if err != nil {
+		return nil, err
 	}
-	if req.Resources != nil {
-		r.Resources = req.Resources
+
+	return m.write(ctx, func(ctx context.Context) (*Policy, error) {
+		r, err := m.pool.GetPolicy(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		prev, err := m.baseline(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+
+		r.restore(target.Policy)
+		r.UpdatedAt = time.Now()
+
+		if err := m.privPool.UpdatePolicy(ctx, r); err != nil {
+			return nil, err
+		}
+		if err := m.recordVersion(ctx, prev, r, VersionActionRollback, req.Author, target.Version); err != nil {
+			return nil, err
+		}
+		return r, nil
+	})
+}
+
+// write runs fn, which writes a policy together with its version, in a
+// transaction and mirrors the policy into the engine once committed. The
+// unique version numbers of a policy make the later of two concurrent
+// changes fail with ErrVersionConflict; it is then run again on top of the
+// earlier one.
+func (m *ManagerImpl) write(ctx context.Context, fn func(ctx context.Context) (*Policy, error)) (*Policy, error) {
+	var r *Policy
+	var err error
+	for attempt := 0; attempt < maxWriteAttempts; attempt++ {
+		err = m.persister.Transaction(ctx, func(ctx context.Context) error {
+			var err error
+			r, err = fn(ctx)
+			return err
+		})
+		if !errors.Is(err, ErrVersionConflict) {
+			break
+		}
 	}
-	if req.Conditions != nil {
-		r.Conditions = req.Conditions
+	if err != nil {
+		return nil, err
 	}
-	r.UpdatedAt = time.Now()
+	m.refresh(r)
+	return r, nil
+}
 
-	if err := m.privPool.UpdatePolicy(ctx, r); err != nil {
+// baseline returns a snapshot of r before it is modified. Policies created
+// before versioning existed get their current state recorded as version 1,
+// so the first tracked change can still be rolled back.
+func (m *ManagerImpl) baseline(ctx context.Context, r *Policy) (*Policy, error) {
+	prev, err := r.clone()
+	if err != nil {
 		return nil, err
 	}
 
-	return r, nil
+	versions, err := m.pool.ListVersions(ctx, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		if err := m.recordVersion(ctx, nil, prev, VersionActionBaseline, "", 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return prev, nil
 }
 
-// DeletePolicy deletes a policy.
-func (m *ManagerImpl) DeletePolicy(ctx context.Context, id uuid.UUID) error {
-	networkID := uuid.Nil
-	return m.privPool.DeletePolicy(ctx, networkID, id)
+// recordVersion stores next as the newest version of the policy. It runs
+// in the transaction writing next, see write.
+func (m *ManagerImpl) recordVersion(ctx context.Context, prev, next *Policy, action VersionAction, author string, restoredFrom int) error {
+	versions, err := m.pool.ListVersions(ctx, next.ID)
+	if err != nil {
+		return err
+	}
+	number := 1
+	if len(versions) > 0 {
+		number = versions[0].Version + 1
+	}
+	snapshot, err := next.clone()
+	if err != nil {
+		return err
+	}
+
+	return m.privPool.CreateVersion(ctx, &Version{
+		ID:           uuid.New(),
+		PolicyID:     next.ID,
+		NetworkID:    next.NetworkID,
+		Version:      number,
+		Action:       action,
+		Author:       author,
+		RestoredFrom: restoredFrom,
+		Policy:       snapshot,
+		Diff:         Diff(prev, next),
+		CreatedAt:    time.Now(),
+	})
+}
+
+// refresh mirrors the stored policy into the authorization engine.
+func (m *ManagerImpl) refresh(r *Policy) {
+	if m.engine == nil {
+		return
+	}
+	m.engine.UpsertPolicy(&authz.Policy{
+		ID:         r.ID.String(),
+		NetworkID:  r.NetworkID.String(),
+		Subjects:   r.Subjects,
+		Effect:     string(r.Effect),
+		Actions:    r.Actions,
+		Resources:  r.Resources,
+		Conditions: r.Conditions,
+	})
 }
 
 // Ensure ManagerImpl implements Manager.
 var _ Manager = (*ManagerImpl)(nil)
+
+// validateConditions rejects conditions the engine cannot evaluate, see
+// authz.ValidateConditions.
+func validateConditions(raw json.RawMessage) error {
+	if err := authz.ValidateConditions(raw); err != nil {
+		return errors.WithCode(code.ErrValidation, "%s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/coding-hui/iam/pkg/code"
+
+	"github.com/coding-hui/common/errors"
+)
+
+func TestWritePolicyValidatesConditions(t *testing.T) {
+	ctx := context.Background()
+	pool := newMemoryPool()
+	m := NewManagerImpl(persister{}, pool, pool, nil)
+	operator := json.RawMessage(`{"ip":{"type":"CIDRCondition","options":{"cidr":"10.0.0.0/8"}}}`)
+
+	_, err := m.CreatePolicy(ctx, &CreatePolicyRequest{Name: "office", Effect: EffectAllow, Conditions: operator})
+	if !errors.IsCode(err, code.ErrValidation) {
+		t.Errorf("CreatePolicy() error = %v, want ErrValidation", err)
+	}
+
+	r, err := m.CreatePolicy(ctx, &CreatePolicyRequest{Name: "office", Effect: EffectAllow, Conditions: json.RawMessage(`{"ip":"10.0.0.0/8"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.UpdatePolicy(ctx, r.ID, &UpdatePolicyRequest{Conditions: operator}); !errors.IsCode(err, code.ErrValidation) {
+		t.Errorf("UpdatePolicy() error = %v, want ErrValidation", err)
+	}
+}
@@ -47,6 +47,9 @@ type Policy struct {
 type Pool interface {
 	GetPolicy(ctx context.Context, id uuid.UUID) (*Policy, error)
 	ListPolicies(ctx context.Context, networkID uuid.UUID, limit, offset int) ([]*Policy, int, error)
+	ListPoliciesBySubject(ctx context.Context, networkID uuid.UUID, subject string) ([]*Policy, error)
+	GetVersion(ctx context.Context, policyID uuid.UUID, version int) (*Version, error)
+	ListVersions(ctx context.Context, policyID uuid.UUID) ([]*Version, error)
 }
 
 // PrivilegedPool defines the interface for writing policy data.
@@ -56,6 +59,8 @@ type PrivilegedPool interface {
 	CreatePolicy(ctx context.Context, p *Policy) error
 	UpdatePolicy(ctx context.Context, p *Policy) error
 	DeletePolicy(ctx context.Context, networkID, id uuid.UUID) error
+
+	CreateVersion(ctx context.Context, v *Version) error
 }
 
 // Manager defines the interface for policy business logic.
@@ -63,8 +68,12 @@ type Manager interface {
 	CreatePolicy(ctx context.Context, req *CreatePolicyRequest) (*Policy, error)
 	GetPolicy(ctx context.Context, id uuid.UUID) (*Policy, error)
 	ListPolicies(ctx context.Context, networkID uuid.UUID) ([]*Policy, error)
+	ListPoliciesBySubject(ctx context.Context, networkID uuid.UUID, subject string) ([]*Policy, error)
 	UpdatePolicy(ctx context.Context, id uuid.UUID, req *UpdatePolicyRequest) (*Policy, error)
 	DeletePolicy(ctx context.Context, id uuid.UUID) error
+
+	ListVersions(ctx context.Context, id uuid.UUID) ([]*Version, error)
+	RollbackPolicy(ctx context.Context, id uuid.UUID, req *RollbackPolicyRequest) (*Policy, error)
 }
 
 // CreatePolicyRequest holds data for creating a new policy.
@@ -77,6 +86,7 @@ type CreatePolicyRequest struct {
 	Actions    []string        `json:"actions"`
 	Resources  []string        `json:"resources"`
 	Conditions json.RawMessage `json:"conditions,omitempty"`
+	Author     string          `json:"-"`
 }
 
 // UpdatePolicyRequest holds data for updating a policy.
@@ -87,4 +97,11 @@ type UpdatePolicyRequest struct {
 	Actions    []string        `json:"actions,omitempty"`
 	Resources  []string        `json:"resources,omitempty"`
 	Conditions json.RawMessage `json:"conditions,omitempty"`
+	Author     string          `json:"-"`
+}
+
+// RollbackPolicyRequest holds data for restoring a previous policy version.
+type RollbackPolicyRequest struct {
+	Version int    `json:"version"`
+	Author  string `json:"-"`
 }
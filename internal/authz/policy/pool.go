@@ -6,8 +6,11 @@ package policy
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 
 	"github.com/coding-hui/iam/internal/persistence"
 )
@@ -21,9 +24,14 @@ type policyPool struct {
 type policyPersister interface {
 	GetPolicy(ctx context.Context, id string) (*persistence.Policy, error)
 	ListPolicies(ctx context.Context, networkID string, limit, offset int) ([]*persistence.Policy, int, error)
+	ListPoliciesBySubject(ctx context.Context, networkID, subject string) ([]*persistence.Policy, error)
 	CreatePolicy(ctx context.Context, policy *persistence.Policy) error
 	UpdatePolicy(ctx context.Context, policy *persistence.Policy) error
 	DeletePolicy(ctx context.Context, id string) error
+
+	CreatePolicyVersion(ctx context.Context, version *persistence.PolicyVersion) error
+	GetPolicyVersion(ctx context.Context, policyID string, version int) (*persistence.PolicyVersion, error)
+	ListPolicyVersions(ctx context.Context, policyID string) ([]*persistence.PolicyVersion, error)
 }
 
 // NewPool creates a new policy pool.
@@ -53,6 +61,68 @@ func (p *policyPool) ListPolicies(ctx context.Context, networkID uuid.UUID, limi
 	return policies, total, nil
 }
 
+// ListPoliciesBySubject lists policies that mention subject.
+func (p *policyPool) ListPoliciesBySubject(ctx context.Context, networkID uuid.UUID, subject string) ([]*Policy, error) {
+	ms, err := p.persister.ListPoliciesBySubject(ctx, networkID.String(), subject)
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]*Policy, len(ms))
+	for i := range ms {
+		policies[i] = p.modelToDomain(ms[i])
+	}
+	return policies, nil
+}
+
+// GetVersion retrieves a single version of a policy.
+func (p *policyPool) GetVersion(ctx context.Context, policyID uuid.UUID, version int) (*Version, error) {
+	m, err := p.persister.GetPolicyVersion(ctx, policyID.String(), version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPolicyVersionNotFound
+		}
+		return nil, err
+	}
+	return p.versionModelToDomain(m)
+}
+
+// ListVersions lists all versions of a policy, newest first.
+func (p *policyPool) ListVersions(ctx context.Context, policyID uuid.UUID) ([]*Version, error) {
+	ms, err := p.persister.ListPolicyVersions(ctx, policyID.String())
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]*Version, len(ms))
+	for i := range ms {
+		if versions[i], err = p.versionModelToDomain(ms[i]); err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+func (p *policyPool) versionModelToDomain(m *persistence.PolicyVersion) (*Version, error) {
+	v := &Version{
+		ID:           parseUUID(m.ID),
+		PolicyID:     parseUUID(m.PolicyID),
+		NetworkID:    parseUUID(m.NetworkID),
+		Version:      m.Version,
+		Action:       VersionAction(m.Action),
+		Author:       m.Author,
+		RestoredFrom: m.RestoredFrom,
+		CreatedAt:    m.CreatedAt,
+	}
+	if err := json.Unmarshal(m.Snapshot, &v.Policy); err != nil {
+		return nil, err
+	}
+	if len(m.Diff) > 0 {
+		if err := json.Unmarshal(m.Diff, &v.Diff); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
 func (p *policyPool) modelToDomain(m *persistence.Policy) *Policy {
 	if m == nil {
 		return nil
@@ -62,23 +132,16 @@ func (p *policyPool) modelToDomain(m *persistence.Policy) *Policy {
 		NetworkID:  parseUUID(m.NetworkID),
 		Name:       m.Name,
 		Type:       PolicyType(m.Type),
-		Subjects:   split(m.Subjects),
+		Subjects:   m.Subjects,
 		Effect:     Effect(m.Effect),
-		Actions:    split(m.Actions),
-		Resources:  split(m.Resources),
+		Actions:    m.Actions,
+		Resources:  m.Resources,
 		Conditions: m.Conditions,
 		CreatedAt:  m.CreatedAt,
 		UpdatedAt:  m.UpdatedAt,
 	}
 }
 
-func split(s string) []string {
-	if s == "" {
-		return nil
-	}
-	return []string{s}
-}
-
 func parseUUID(s string) uuid.UUID {
 	if s == "" {
 		return uuid.Nil
@@ -122,35 +185,49 @@ func (p *privilegedPool) DeletePolicy(ctx context.Context, networkID, id uuid.UU
 	return p.persister.DeletePolicy(ctx, id.String())
 }
 
+// CreateVersion stores a new immutable policy version.
+func (p *privilegedPool) CreateVersion(ctx context.Context, v *Version) error {
+	snapshot, err := json.Marshal(v.Policy)
+	if err != nil {
+		return err
+	}
+	diff, err := json.Marshal(v.Diff)
+	if err != nil {
+		return err
+	}
+	err = p.persister.CreatePolicyVersion(ctx, &persistence.PolicyVersion{
+		ID:           v.ID.String(),
+		PolicyID:     v.PolicyID.String(),
+		NetworkID:    v.NetworkID.String(),
+		Version:      v.Version,
+		Action:       string(v.Action),
+		Author:       v.Author,
+		RestoredFrom: v.RestoredFrom,
+		Snapshot:     snapshot,
+		Diff:         diff,
+		CreatedAt:    v.CreatedAt,
+	})
+	if errors.Is(err, persistence.ErrPolicyVersionExists) {
+		return ErrVersionConflict
+	}
+	return err
+}
+
 func (p *privilegedPool) domainToModel(r *Policy) *persistence.Policy {
 	return &persistence.Policy{
 		ID:         r.ID.String(),
 		NetworkID:  r.NetworkID.String(),
 		Name:       r.Name,
 		Type:       string(r.Type),
-		Subjects:   join(r.Subjects),
+		Subjects:   r.Subjects,
 		Effect:     string(r.Effect),
-		Actions:    join(r.Actions),
-		Resources:  join(r.Resources),
+		Actions:    r.Actions,
+		Resources:  r.Resources,
 		Conditions: r.Conditions,
 		CreatedAt:  r.CreatedAt,
 		UpdatedAt:  r.UpdatedAt,
 	}
 }
 
-func join(ss []string) string {
-	if ss == nil {
-		return ""
-	}
-	result := ""
-	for i, s := range ss {
-		if i > 0 {
-			result += ","
-		}
-		result += s
-	}
-	return result
-}
-
 // Ensure privilegedPool implements PrivilegedPool.
 var _ PrivilegedPool = (*privilegedPool)(nil)
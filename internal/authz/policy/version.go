@@ -0,0 +1,105 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VersionAction describes the change that produced a policy version.
+type VersionAction string
+
+const (
+	// VersionActionBaseline records the state of a policy that existed
+	// before versioning was introduced.
+	VersionActionBaseline VersionAction = "baseline"
+	VersionActionCreated  VersionAction = "created"
+	VersionActionUpdated  VersionAction = "updated"
+	VersionActionRollback VersionAction = "rollback"
+)
+
+// Version is an immutable snapshot of a policy taken on every change.
+// Author is the ID of the identity that made the change, or
+// request:<request ID> for requests without an authenticated identity.
+type Version struct {
+	ID           uuid.UUID     `json:"id"`
+	PolicyID     uuid.UUID     `json:"policy_id"`
+	NetworkID    uuid.UUID     `json:"network_id"`
+	Version      int           `json:"version"`
+	Action       VersionAction `json:"action"`
+	Author       string        `json:"author"`
+	RestoredFrom int           `json:"restored_from,omitempty"`
+	Policy       *Policy       `json:"policy"`
+	Diff         []Change      `json:"diff"`
+	CreatedAt    time.Time     `json:"created_at"`
+}
+
+// Change describes a single field that differs between two policy versions.
+type Change struct {
+	Field string `json:"field"`
+	From  any    `json:"from,omitempty"`
+	To    any    `json:"to,omitempty"`
+}
+
+// Diff returns the fields that differ between prev and next.
+// A nil prev is treated as an empty policy.
+func Diff(prev, next *Policy) []Change {
+	if prev == nil {
+		prev = &Policy{}
+	}
+
+	var changes []Change
+	if prev.Name != next.Name {
+		changes = append(changes, Change{Field: "name", From: prev.Name, To: next.Name})
+	}
+	if prev.Type != next.Type {
+		changes = append(changes, Change{Field: "type", From: prev.Type, To: next.Type})
+	}
+	if !slices.Equal(prev.Subjects, next.Subjects) {
+		changes = append(changes, Change{Field: "subjects", From: prev.Subjects, To: next.Subjects})
+	}
+	if prev.Effect != next.Effect {
+		changes = append(changes, Change{Field: "effect", From: prev.Effect, To: next.Effect})
+	}
+	if !slices.Equal(prev.Actions, next.Actions) {
+		changes = append(changes, Change{Field: "actions", From: prev.Actions, To: next.Actions})
+	}
+	if !slices.Equal(prev.Resources, next.Resources) {
+		changes = append(changes, Change{Field: "resources", From: prev.Resources, To: next.Resources})
+	}
+	if !bytes.Equal(prev.Conditions, next.Conditions) {
+		changes = append(changes, Change{Field: "conditions", From: prev.Conditions, To: next.Conditions})
+	}
+	return changes
+}
+
+// restore copies the versioned fields of snapshot onto p.
+func (p *Policy) restore(snapshot *Policy) {
+	p.Name = snapshot.Name
+	p.Type = snapshot.Type
+	p.Subjects = snapshot.Subjects
+	p.Effect = snapshot.Effect
+	p.Actions = snapshot.Actions
+	p.Resources = snapshot.Resources
+	p.Conditions = snapshot.Conditions
+}
+
+// clone returns a deep copy of p suitable for use as a snapshot.
+func (p *Policy) clone() (*Policy, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	var c Policy
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
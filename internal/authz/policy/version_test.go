@@ -0,0 +1,234 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// persister runs transactions without a database.
+type persister struct {
+	persistence.Persister
+}
+
+func (persister) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// memoryPool keeps policies and versions in memory. Version numbers are
+// unique per policy, as in the database.
+type memoryPool struct {
+	policies map[uuid.UUID]*Policy
+	versions []*Version
+	// race is called before a version is stored, e.g. to store a
+	// concurrent version first.
+	race func(v *Version)
+}
+
+func newMemoryPool() *memoryPool {
+	return &memoryPool{policies: map[uuid.UUID]*Policy{}}
+}
+
+func (p *memoryPool) GetPolicy(_ context.Context, id uuid.UUID) (*Policy, error) {
+	r, ok := p.policies[id]
+	if !ok {
+		return nil, ErrPolicyNotFound
+	}
+	return r.clone()
+}
+
+func (p *memoryPool) ListPolicies(context.Context, uuid.UUID, int, int) ([]*Policy, int, error) {
+	return nil, 0, nil
+}
+
+func (p *memoryPool) ListPoliciesBySubject(context.Context, uuid.UUID, string) ([]*Policy, error) {
+	return nil, nil
+}
+
+func (p *memoryPool) GetVersion(_ context.Context, policyID uuid.UUID, version int) (*Version, error) {
+	for _, v := range p.versions {
+		if v.PolicyID == policyID && v.Version == version {
+			return v, nil
+		}
+	}
+	return nil, ErrPolicyVersionNotFound
+}
+
+func (p *memoryPool) ListVersions(_ context.Context, policyID uuid.UUID) ([]*Version, error) {
+	var versions []*Version
+	for _, v := range p.versions {
+		if v.PolicyID == policyID {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions, nil
+}
+
+func (p *memoryPool) CreatePolicy(_ context.Context, r *Policy) error {
+	p.policies[r.ID], _ = r.clone()
+	return nil
+}
+
+func (p *memoryPool) UpdatePolicy(ctx context.Context, r *Policy) error {
+	return p.CreatePolicy(ctx, r)
+}
+
+func (p *memoryPool) DeletePolicy(_ context.Context, _, id uuid.UUID) error {
+	delete(p.policies, id)
+	return nil
+}
+
+func (p *memoryPool) CreateVersion(ctx context.Context, v *Version) error {
+	if race := p.race; race != nil {
+		p.race = nil
+		race(v)
+	}
+	if _, err := p.GetVersion(ctx, v.PolicyID, v.Version); err == nil {
+		return ErrVersionConflict
+	}
+	p.versions = append(p.versions, v)
+	return nil
+}
+
+func TestDiff(t *testing.T) {
+	base := &Policy{
+		Name:       "read",
+		Type:       PolicyTypeRole,
+		Subjects:   []string{"role:viewer"},
+		Effect:     EffectAllow,
+		Actions:    []string{"read"},
+		Resources:  []string{"doc:*"},
+		Conditions: json.RawMessage(`{"ip":"10.0.0.0/8"}`),
+	}
+	tests := []struct {
+		name   string
+		prev   *Policy
+		modify func(p *Policy)
+		want   []string
+	}{
+		{"unchanged", base, func(*Policy) {}, nil},
+		{"name", base, func(p *Policy) { p.Name = "write" }, []string{"name"}},
+		{"effect and actions", base, func(p *Policy) {
+			p.Effect = EffectDeny
+			p.Actions = []string{"read", "write"}
+		}, []string{"effect", "actions"}},
+		{"subjects added", base, func(p *Policy) { p.Subjects = []string{"role:viewer", "role:admin"} }, []string{"subjects"}},
+		{"resources and conditions", base, func(p *Policy) {
+			p.Resources = nil
+			p.Conditions = nil
+		}, []string{"resources", "conditions"}},
+		{"created", nil, func(*Policy) {}, []string{"name", "type", "subjects", "effect", "actions", "resources", "conditions"}},
+	}
+	for _, tt := range tests {
+		next, err := base.clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.modify(next)
+		var got []string
+		for _, c := range Diff(tt.prev, next) {
+			got = append(got, c.Field)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Diff() fields = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRollbackPolicy(t *testing.T) {
+	ctx := context.Background()
+	pool := newMemoryPool()
+	m := NewManagerImpl(persister{}, pool, pool, nil)
+
+	r, err := m.CreatePolicy(ctx, &CreatePolicyRequest{
+		Name:    "docs",
+		Effect:  EffectAllow,
+		Actions: []string{"read"},
+		Author:  "ann",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.UpdatePolicy(ctx, r.ID, &UpdatePolicyRequest{Actions: []string{"read", "write"}, Author: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.UpdatePolicy(ctx, r.ID, &UpdatePolicyRequest{Effect: EffectDeny, Author: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		version     int
+		wantEffect  Effect
+		wantActions []string
+		wantDiff    []string
+	}{
+		{1, EffectAllow, []string{"read"}, []string{"effect", "actions"}},
+		{2, EffectAllow, []string{"read", "write"}, []string{"actions"}},
+		{3, EffectDeny, []string{"read", "write"}, []string{"effect"}},
+		{4, EffectAllow, []string{"read"}, []string{"effect", "actions"}},
+	}
+	for _, tt := range tests {
+		got, err := m.RollbackPolicy(ctx, r.ID, &RollbackPolicyRequest{Version: tt.version, Author: "carl"})
+		if err != nil {
+			t.Fatalf("RollbackPolicy(%d) error = %v", tt.version, err)
+		}
+		if got.Effect != tt.wantEffect || !reflect.DeepEqual(got.Actions, tt.wantActions) || got.Name != "docs" {
+			t.Errorf("RollbackPolicy(%d) = %s %v, want %s %v", tt.version, got.Effect, got.Actions, tt.wantEffect, tt.wantActions)
+		}
+
+		versions, _ := m.ListVersions(ctx, r.ID)
+		v := versions[0]
+		var diff []string
+		for _, c := range v.Diff {
+			diff = append(diff, c.Field)
+		}
+		if v.Action != VersionActionRollback || v.RestoredFrom != tt.version || v.Author != "carl" || !reflect.DeepEqual(diff, tt.wantDiff) {
+			t.Errorf("RollbackPolicy(%d) recorded version %d %s from %d by %q with diff %v", tt.version, v.Version, v.Action, v.RestoredFrom, v.Author, diff)
+		}
+	}
+
+	if _, err := m.RollbackPolicy(ctx, r.ID, &RollbackPolicyRequest{Version: 99}); !errors.Is(err, ErrPolicyVersionNotFound) {
+		t.Errorf("RollbackPolicy(99) error = %v, want ErrPolicyVersionNotFound", err)
+	}
+}
+
+func TestUpdatePolicyVersionConflict(t *testing.T) {
+	ctx := context.Background()
+	pool := newMemoryPool()
+	m := NewManagerImpl(persister{}, pool, pool, nil)
+	r, err := m.CreatePolicy(ctx, &CreatePolicyRequest{Name: "docs", Effect: EffectAllow})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A concurrent update takes the version number first.
+	pool.race = func(v *Version) {
+		c := *v
+		c.ID, c.Author = uuid.New(), "concurrent"
+		pool.versions = append(pool.versions, &c)
+	}
+	if _, err := m.UpdatePolicy(ctx, r.ID, &UpdatePolicyRequest{Name: "files", Author: "ann"}); err != nil {
+		t.Fatalf("UpdatePolicy() error = %v", err)
+	}
+
+	versions, _ := m.ListVersions(ctx, r.ID)
+	var got []string
+	for _, v := range versions {
+		got = append(got, v.Author)
+	}
+	if want := []string{"ann", "concurrent", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("version authors = %v, want %v", got, want)
+	}
+}
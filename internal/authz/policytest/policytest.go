@@ -0,0 +1,288 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package policytest runs policy unit tests described in YAML files.
+//
+// A suite lists policies, roles and role bindings together with the
+// expected decision for a set of requests:
+//
+//	policies:
+//	  - id: editors-write
+//	    subjects: [editor]
+//	    effect: allow
+//	    actions: [write]
+//	    resources: ["doc:*"]
+//	roles:
+//	  - id: editor
+//	    inherit_from: [viewer]
+//	role_bindings:
+//	  - subject: alice
+//	    role: editor
+//	cases:
+//	  - name: editors can write
+//	    subject: alice
+//	    action: write
+//	    resource: "doc:*"
+//	    expect: allow
+package policytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/coding-hui/iam/internal/authz"
+)
+
+// Suite is a set of policy fixtures and the cases evaluated against them.
+type Suite struct {
+	Name         string        `yaml:"name"`
+	Policies     []Policy      `yaml:"policies"`
+	Roles        []Role        `yaml:"roles"`
+	RoleBindings []RoleBinding `yaml:"role_bindings"`
+	Cases        []Case        `yaml:"cases"`
+	Source       string        `yaml:"-"`
+}
+
+// Policy is a policy fixture.
+type Policy struct {
+	ID         string         `yaml:"id"`
+	Subjects   []string       `yaml:"subjects"`
+	Effect     string         `yaml:"effect"`
+	Actions    []string       `yaml:"actions"`
+	Resources  []string       `yaml:"resources"`
+	Conditions map[string]any `yaml:"conditions"`
+}
+
+// Role is a role fixture.
+type Role struct {
+	ID          string   `yaml:"id"`
+	InheritFrom []string `yaml:"inherit_from"`
+}
+
+// RoleBinding is a role binding fixture.
+type RoleBinding struct {
+	Subject string `yaml:"subject"`
+	Role    string `yaml:"role"`
+}
+
+// Case is a request and its expected decision.
+type Case struct {
+	Name     string         `yaml:"name"`
+	Subject  string         `yaml:"subject"`
+	Action   string         `yaml:"action"`
+	Resource string         `yaml:"resource"`
+	Context  map[string]any `yaml:"context"`
+	Expect   string         `yaml:"expect"`
+}
+
+// Result is the outcome of a single case.
+type Result struct {
+	Case        *Case
+	Passed      bool
+	Explanation *authz.Explanation
+}
+
+// Report is the outcome of a suite.
+type Report struct {
+	Suite   *Suite
+	Results []*Result
+}
+
+// Load reads a suite from a YAML file.
+func Load(path string) (*Suite, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s.Source = path
+	return s, nil
+}
+
+// Parse decodes and validates a suite.
+func Parse(r io.Reader) (*Suite, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+
+	var s Suite
+	if err := dec.Decode(&s); err != nil {
+		return nil, err
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Suite) validate() error {
+	ids := make(map[string]bool, len(s.Policies))
+	for i, p := range s.Policies {
+		if p.ID == "" {
+			return fmt.Errorf("policies[%d]: id is required", i)
+		}
+		if ids[p.ID] {
+			return fmt.Errorf("policies[%d]: duplicate id %q", i, p.ID)
+		}
+		ids[p.ID] = true
+		if !isDecision(p.Effect) {
+			return fmt.Errorf("policies[%d]: effect must be allow or deny", i)
+		}
+	}
+	for i, c := range s.Cases {
+		if c.Subject == "" || c.Action == "" || c.Resource == "" {
+			return fmt.Errorf("cases[%d]: subject, action and resource are required", i)
+		}
+		if !isDecision(c.Expect) {
+			return fmt.Errorf("cases[%d]: expect must be allow or deny", i)
+		}
+	}
+	return nil
+}
+
+func isDecision(s string) bool {
+	return s == authz.DecisionAllow || s == authz.DecisionDeny
+}
+
+// NewEngine returns a fresh engine loaded with the suite fixtures.
+func (s *Suite) NewEngine() (*authz.Engine, error) {
+	policies := make([]*authz.Policy, len(s.Policies))
+	for i, p := range s.Policies {
+		var conditions json.RawMessage
+		if len(p.Conditions) > 0 {
+			b, err := json.Marshal(p.Conditions)
+			if err != nil {
+				return nil, fmt.Errorf("policies[%d]: %w", i, err)
+			}
+			if err := authz.ValidateConditions(b); err != nil {
+				return nil, fmt.Errorf("policies[%d]: %w", i, err)
+			}
+			conditions = b
+		}
+		policies[i] = &authz.Policy{
+			ID:         p.ID,
+			Subjects:   p.Subjects,
+			Effect:     p.Effect,
+			Actions:    p.Actions,
+			Resources:  p.Resources,
+			Conditions: conditions,
+		}
+	}
+
+	roles := make([]*authz.Role, len(s.Roles))
+	for i, r := range s.Roles {
+		roles[i] = &authz.Role{ID: r.ID, InheritFrom: r.InheritFrom}
+	}
+
+	bindings := make([]*authz.RoleBinding, len(s.RoleBindings))
+	for i, b := range s.RoleBindings {
+		bindings[i] = &authz.RoleBinding{Subject: b.Subject, Role: b.Role}
+	}
+
+	e := authz.NewEngine()
+	e.LoadPolicies(policies)
+	e.LoadRoles(roles)
+	e.LoadRoleBindings(bindings)
+	return e, nil
+}
+
+// Run evaluates every case of the suite against a fresh engine.
+func Run(ctx context.Context, s *Suite) (*Report, error) {
+	e, err := s.NewEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Suite: s, Results: make([]*Result, len(s.Cases))}
+	for i := range s.Cases {
+		c := &s.Cases[i]
+		ex, err := e.Explain(ctx, &authz.AuthzRequest{
+			Subject:  c.Subject,
+			Action:   c.Action,
+			Resource: c.Resource,
+			Context:  c.Context,
+		})
+		if err != nil {
+			return nil, err
+		}
+		report.Results[i] = &Result{Case: c, Passed: ex.Decision == c.Expect, Explanation: ex}
+	}
+	return report, nil
+}
+
+// Failed returns the number of failed cases.
+func (r *Report) Failed() int {
+	n := 0
+	for _, res := range r.Results {
+		if !res.Passed {
+			n++
+		}
+	}
+	return n
+}
+
+// Write prints a summary of the report to w. Failed cases include the
+// explain trace; verbose also lists passed cases.
+func (r *Report) Write(w io.Writer, verbose bool) {
+	name := r.Suite.Name
+	if name == "" {
+		name = r.Suite.Source
+	}
+
+	for i, res := range r.Results {
+		if res.Passed && !verbose {
+			continue
+		}
+		status := "PASS"
+		if !res.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "--- %s: %s\n", status, res.Case.title(i))
+		if res.Passed {
+			continue
+		}
+
+		ex := res.Explanation
+		fmt.Fprintf(w, "    expected %s, got %s (%s", res.Case.Expect, ex.Decision, ex.Reason)
+		if ex.Policy != "" {
+			fmt.Fprintf(w, ": %s", ex.Policy)
+		}
+		fmt.Fprintf(w, ")\n")
+		fmt.Fprintf(w, "    subjects: %s\n", strings.Join(ex.Subjects, ", "))
+		for _, t := range ex.Trace {
+			mark := " "
+			if t.Matched {
+				mark = "*"
+			}
+			fmt.Fprintf(w, "    %s %s [%s]", mark, t.Policy, t.Effect)
+			if t.Reason != "" {
+				fmt.Fprintf(w, ": %s", t.Reason)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	status := "ok"
+	if r.Failed() > 0 {
+		status = "FAIL"
+	}
+	fmt.Fprintf(w, "%s\t%s\t%d passed, %d failed\n", status, name, len(r.Results)-r.Failed(), r.Failed())
+}
+
+func (c *Case) title(i int) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return fmt.Sprintf("case %d (%s %s %s)", i, c.Subject, c.Action, c.Resource)
+}
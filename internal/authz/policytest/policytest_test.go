@@ -0,0 +1,71 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package policytest
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicies(t *testing.T) {
+	files, err := filepath.Glob("../../../test/policies/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no policy test files found")
+	}
+
+	for _, file := range files {
+		suite, err := Load(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, err := Run(context.Background(), suite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Failed() > 0 {
+			var b strings.Builder
+			report.Write(&b, false)
+			t.Errorf("%s:\n%s", file, b.String())
+		}
+	}
+}
+
+func TestFailureIsReported(t *testing.T) {
+	suite, err := Parse(strings.NewReader(`
+policies:
+  - id: allow-read
+    subjects: [alice]
+    effect: allow
+    actions: [read]
+    resources: [doc]
+cases:
+  - subject: alice
+    action: write
+    resource: doc
+    expect: allow
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(context.Background(), suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Failed() != 1 {
+		t.Fatalf("Failed() = %d, want 1", report.Failed())
+	}
+
+	var b strings.Builder
+	report.Write(&b, false)
+	if !strings.Contains(b.String(), "allow-read [allow]: action not matched") {
+		t.Errorf("report does not contain trace:\n%s", b.String())
+	}
+}
@@ -120,3 +120,63 @@ func (h *Handler) Delete(c *gin.Context) {
 
 	api.Ok(c)
 }
+
+// Bindings handles GET /api/v1/roles/:id/bindings.
+func (h *Handler) Bindings(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return
+	}
+
+	bindings, err := h.manager.ListRoleBindings(c.Request.Context(), id)
+	if err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithPage(bindings, int64(len(bindings)), c)
+}
+
+// Bind handles POST /api/v1/roles/:id/bindings.
+func (h *Handler) Bind(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return
+	}
+
+	var req BindRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+	if req.Subject == "" {
+		api.FailWithMessage("subject is required", c)
+		return
+	}
+
+	b, err := h.manager.BindRole(c.Request.Context(), id, &req)
+	if err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(b, c)
+}
+
+// Unbind handles DELETE /api/v1/roles/:id/bindings/:subject.
+func (h *Handler) Unbind(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return
+	}
+
+	if err := h.manager.UnbindRole(c.Request.Context(), id, c.Param("subject")); err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.Ok(c)
+}
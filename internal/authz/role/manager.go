@@ -9,19 +9,24 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/authz"
 )
 
 // ManagerImpl implements role.Manager.
 type ManagerImpl struct {
 	pool     Pool
 	privPool PrivilegedPool
+	engine   *authz.Engine
 }
 
 // NewManagerImpl creates a new role manager.
-func NewManagerImpl(pool Pool, privPool PrivilegedPool) *ManagerImpl {
+// Changes to roles and bindings are applied to engine when it is not nil.
+func NewManagerImpl(pool Pool, privPool PrivilegedPool, engine *authz.Engine) *ManagerImpl {
 	return &ManagerImpl{
 		pool:     pool,
 		privPool: privPool,
+		engine:   engine,
 	}
 }
 
@@ -42,6 +47,7 @@ func (m *ManagerImpl) CreateRole(ctx context.Context, req *CreateRoleRequest) (*
 	if err := m.privPool.CreateRole(ctx, r); err != nil {
 		return nil, err
 	}
+	m.refresh(r)
 
 	return r, nil
 }
@@ -81,14 +87,104 @@ func (m *ManagerImpl) UpdateRole(ctx context.Context, id uuid.UUID, req *UpdateR
 	if err := m.privPool.UpdateRole(ctx, r); err != nil {
 		return nil, err
 	}
+	m.refresh(r)
 
 	return r, nil
 }
 
-// DeleteRole deletes a role.
+// DeleteRole deletes a role together with its bindings.
 func (m *ManagerImpl) DeleteRole(ctx context.Context, id uuid.UUID) error {
-	networkID := uuid.Nil
-	return m.privPool.DeleteRole(ctx, networkID, id)
+	r, err := m.pool.GetRole(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := m.privPool.DeleteRole(ctx, r.NetworkID, id); err != nil {
+		return err
+	}
+	if m.engine != nil {
+		m.engine.RemoveRole(r.NetworkID.String(), id.String())
+	}
+	return nil
+}
+
+// BindRole grants a role to a subject. Binding an already bound subject
+// returns the existing binding.
+func (m *ManagerImpl) BindRole(ctx context.Context, id uuid.UUID, req *BindRoleRequest) (*RoleBinding, error) {
+	r, err := m.pool.GetRole(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	bindings, err := m.pool.ListRoleBindingsByRole(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range bindings {
+		if b.Subject == req.Subject {
+			return b, nil
+		}
+	}
+
+	b := &RoleBinding{
+		ID:        uuid.New(),
+		NetworkID: r.NetworkID,
+		RoleID:    r.ID,
+		Subject:   req.Subject,
+		CreatedAt: time.Now(),
+	}
+	if err := m.privPool.CreateRoleBinding(ctx, b); err != nil {
+		return nil, err
+	}
+	if m.engine != nil {
+		m.engine.AddRoleBinding(&authz.RoleBinding{
+			NetworkID: b.NetworkID.String(),
+			Subject:   b.Subject,
+			Role:      b.RoleID.String(),
+		})
+	}
+
+	return b, nil
+}
+
+// UnbindRole revokes a role from a subject.
+func (m *ManagerImpl) UnbindRole(ctx context.Context, id uuid.UUID, subject string) error {
+	r, err := m.pool.GetRole(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := m.privPool.DeleteRoleBinding(ctx, id, subject); err != nil {
+		return err
+	}
+	if m.engine != nil {
+		m.engine.RemoveRoleBinding(&authz.RoleBinding{
+			NetworkID: r.NetworkID.String(),
+			Subject:   subject,
+			Role:      id.String(),
+		})
+	}
+	return nil
+}
+
+// ListRoleBindings lists the bindings of a role.
+func (m *ManagerImpl) ListRoleBindings(ctx context.Context, id uuid.UUID) ([]*RoleBinding, error) {
+	return m.pool.ListRoleBindingsByRole(ctx, id)
+}
+
+// refresh applies r to the authorization engine.
+func (m *ManagerImpl) refresh(r *Role) {
+	if m.engine == nil {
+		return
+	}
+	m.engine.UpsertRole(engineRole(r))
+}
+
+// engineRole converts r to its authorization engine representation.
+func engineRole(r *Role) *authz.Role {
+	inheritFrom := make([]string, len(r.InheritFrom))
+	for i, id := range r.InheritFrom {
+		inheritFrom[i] = id.String()
+	}
+	return &authz.Role{ID: r.ID.String(), NetworkID: r.NetworkID.String(), InheritFrom: inheritFrom}
 }
 
 // Ensure ManagerImpl implements Manager.
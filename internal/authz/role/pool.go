@@ -24,6 +24,12 @@ type rolePersister interface {
 	CreateRole(ctx context.Context, role *persistence.Role) error
 	UpdateRole(ctx context.Context, role *persistence.Role) error
 	DeleteRole(ctx context.Context, id string) error
+
+	CreateRoleBinding(ctx context.Context, binding *persistence.RoleBinding) error
+	DeleteRoleBinding(ctx context.Context, roleID, subject string) error
+	ListRoleBindings(ctx context.Context, networkID string) ([]*persistence.RoleBinding, error)
+	ListRoleBindingsByRole(ctx context.Context, roleID string) ([]*persistence.RoleBinding, error)
+	ListRoleBindingsBySubject(ctx context.Context, networkID, subject string) ([]*persistence.RoleBinding, error)
 }
 
 // NewPool creates a new role pool.
@@ -65,15 +71,62 @@ func (p *rolePool) ListRoles(ctx context.Context, networkID uuid.UUID, limit, of
 	return roles, total, nil
 }
 
+// ListRoleBindings lists all role bindings of a network.
+func (p *rolePool) ListRoleBindings(ctx context.Context, networkID uuid.UUID) ([]*RoleBinding, error) {
+	ms, err := p.persister.ListRoleBindings(ctx, networkID.String())
+	if err != nil {
+		return nil, err
+	}
+	return p.bindingsToDomain(ms), nil
+}
+
+// ListRoleBindingsByRole lists the bindings of a role.
+func (p *rolePool) ListRoleBindingsByRole(ctx context.Context, roleID uuid.UUID) ([]*RoleBinding, error) {
+	ms, err := p.persister.ListRoleBindingsByRole(ctx, roleID.String())
+	if err != nil {
+		return nil, err
+	}
+	return p.bindingsToDomain(ms), nil
+}
+
+// ListRoleBindingsBySubject lists the bindings of a subject in a network.
+func (p *rolePool) ListRoleBindingsBySubject(ctx context.Context, networkID uuid.UUID, subject string) ([]*RoleBinding, error) {
+	ms, err := p.persister.ListRoleBindingsBySubject(ctx, networkID.String(), subject)
+	if err != nil {
+		return nil, err
+	}
+	return p.bindingsToDomain(ms), nil
+}
+
+func (p *rolePool) bindingsToDomain(ms []*persistence.RoleBinding) []*RoleBinding {
+	bindings := make([]*RoleBinding, len(ms))
+	for i, m := range ms {
+		bindings[i] = &RoleBinding{
+			ID:        parseUUID(m.ID),
+			NetworkID: parseUUID(m.NetworkID),
+			RoleID:    parseUUID(m.RoleID),
+			Subject:   m.Subject,
+			CreatedAt: m.CreatedAt,
+		}
+	}
+	return bindings
+}
+
 func (p *rolePool) modelToDomain(m *persistence.Role) *Role {
 	if m == nil {
 		return nil
 	}
+	var inheritFrom []uuid.UUID
+	for _, id := range m.InheritFrom {
+		inheritFrom = append(inheritFrom, parseUUID(id))
+	}
 	return &Role{
 		ID:          parseUUID(m.ID),
 		NetworkID:   parseUUID(m.NetworkID),
 		Name:        m.Name,
 		Description: m.Description,
+		InheritFrom: inheritFrom,
+		Extra:       m.Extra,
 		CreatedAt:   m.CreatedAt,
 		UpdatedAt:   m.UpdatedAt,
 	}
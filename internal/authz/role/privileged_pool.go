@@ -41,12 +41,34 @@ func (p *privilegedPool) DeleteRole(ctx context.Context, networkID, id uuid.UUID
 	return p.persister.DeleteRole(ctx, id.String())
 }
 
+// CreateRoleBinding grants a role to a subject.
+func (p *privilegedPool) CreateRoleBinding(ctx context.Context, b *RoleBinding) error {
+	return p.persister.CreateRoleBinding(ctx, &persistence.RoleBinding{
+		ID:        b.ID.String(),
+		NetworkID: b.NetworkID.String(),
+		RoleID:    b.RoleID.String(),
+		Subject:   b.Subject,
+		CreatedAt: b.CreatedAt,
+	})
+}
+
+// DeleteRoleBinding revokes a role from a subject.
+func (p *privilegedPool) DeleteRoleBinding(ctx context.Context, roleID uuid.UUID, subject string) error {
+	return p.persister.DeleteRoleBinding(ctx, roleID.String(), subject)
+}
+
 func (p *privilegedPool) domainToModel(r *Role) *persistence.Role {
+	var inheritFrom []string
+	for _, id := range r.InheritFrom {
+		inheritFrom = append(inheritFrom, id.String())
+	}
 	return &persistence.Role{
 		ID:          r.ID.String(),
 		NetworkID:   r.NetworkID.String(),
 		Name:        r.Name,
 		Description: r.Description,
+		InheritFrom: inheritFrom,
+		Extra:       r.Extra,
 		CreatedAt:   r.CreatedAt,
 		UpdatedAt:   r.UpdatedAt,
 	}
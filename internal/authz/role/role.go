@@ -24,11 +24,23 @@ type Role struct {
 	UpdatedAt   time.Time       `json:"updated_at"`
 }
 
+// RoleBinding grants a role to a subject.
+type RoleBinding struct {
+	ID        uuid.UUID `json:"id"`
+	NetworkID uuid.UUID `json:"network_id"`
+	RoleID    uuid.UUID `json:"role_id"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // Pool defines the interface for reading role data.
 type Pool interface {
 	GetRole(ctx context.Context, id uuid.UUID) (*Role, error)
 	GetRoleByNetworkID(ctx context.Context, networkID, id uuid.UUID) (*Role, error)
 	ListRoles(ctx context.Context, networkID uuid.UUID, limit, offset int) ([]*Role, int, error)
+	ListRoleBindings(ctx context.Context, networkID uuid.UUID) ([]*RoleBinding, error)
+	ListRoleBindingsByRole(ctx context.Context, roleID uuid.UUID) ([]*RoleBinding, error)
+	ListRoleBindingsBySubject(ctx context.Context, networkID uuid.UUID, subject string) ([]*RoleBinding, error)
 }
 
 // PrivilegedPool defines the interface for writing role data.
@@ -38,6 +50,9 @@ type PrivilegedPool interface {
 	CreateRole(ctx context.Context, r *Role) error
 	UpdateRole(ctx context.Context, r *Role) error
 	DeleteRole(ctx context.Context, networkID, id uuid.UUID) error
+
+	CreateRoleBinding(ctx context.Context, b *RoleBinding) error
+	DeleteRoleBinding(ctx context.Context, roleID uuid.UUID, subject string) error
 }
 
 // Manager defines the interface for role business logic.
@@ -47,6 +62,10 @@ type Manager interface {
 	ListRoles(ctx context.Context, networkID uuid.UUID) ([]*Role, error)
 	UpdateRole(ctx context.Context, id uuid.UUID, req *UpdateRoleRequest) (*Role, error)
 	DeleteRole(ctx context.Context, id uuid.UUID) error
+
+	BindRole(ctx context.Context, id uuid.UUID, req *BindRoleRequest) (*RoleBinding, error)
+	UnbindRole(ctx context.Context, id uuid.UUID, subject string) error
+	ListRoleBindings(ctx context.Context, id uuid.UUID) ([]*RoleBinding, error)
 }
 
 // CreateRoleRequest holds data for creating a new role.
@@ -65,3 +84,8 @@ type UpdateRoleRequest struct {
 	InheritFrom []uuid.UUID     `json:"inherit_from,omitempty"`
 	Extra       json.RawMessage `json:"extra,omitempty"`
 }
+
+// BindRoleRequest holds data for granting a role to a subject.
+type BindRoleRequest struct {
+	Subject string `json:"subject"`
+}
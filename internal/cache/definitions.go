@@ -19,6 +19,10 @@ type Cache interface {
 	// A TTL of 0 means no expiration.
 	Set(ctx context.Context, key string, value []byte, ttl int64) error
 
+	// SetNX stores a value with the given TTL in nanoseconds unless the
+	// key exists, atomically. It reports whether the value was stored.
+	SetNX(ctx context.Context, key string, value []byte, ttl int64) (bool, error)
+
 	// Delete removes a key.
 	Delete(ctx context.Context, key string) error
 
@@ -69,6 +69,28 @@ func (c *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl int
 	return nil
 }
 
+// SetNX stores a value in memory cache with the given TTL in nanoseconds
+// unless the key exists and has not expired.
+func (c *MemoryCache) SetNX(ctx context.Context, key string, value []byte, ttl int64) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, ok := c.items[key]; ok && (item.expireAt.IsZero() || !item.expireAt.Before(time.Now())) {
+		return false, nil
+	}
+
+	expireAt := time.Time{}
+	if ttl > 0 {
+		expireAt = time.Now().Add(time.Duration(ttl))
+	}
+
+	c.items[key] = &memItem{
+		value:    value,
+		expireAt: expireAt,
+	}
+	return true, nil
+}
+
 // Delete removes a key from memory cache.
 func (c *MemoryCache) Delete(ctx context.Context, key string) error {
 	c.mu.Lock()
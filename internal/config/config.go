@@ -4,16 +4,29 @@
 
 package config
 
+import "time"
+
 // Config holds all application configuration.
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
+	Server          ServerConfig
+	Database        DatabaseConfig
+	Authz           AuthzConfig
+	Hashers         HashersConfig
+	PasswordPolicy  PasswordPolicyConfig `mapstructure:"password_policy"`
+	Identities      IdentitiesConfig
+	Verification    VerificationConfig
+	OAuth           OAuthConfig           `mapstructure:"oauth"`
+	SCIM            SCIMConfig            `mapstructure:"scim"`
+	ServiceAccounts ServiceAccountsConfig `mapstructure:"service_accounts"`
 }
 
 // ServerConfig holds HTTP server configuration.
 type ServerConfig struct {
 	Host string `mapstructure:"host"`
 	Port int    `mapstructure:"port"`
+	// BaseURL is the URL clients reach the server at, e.g. behind a
+	// proxy; it defaults to http://host:port.
+	BaseURL string `mapstructure:"base_url"`
 }
 
 // DatabaseConfig holds database connection configuration.
@@ -21,3 +34,156 @@ type DatabaseConfig struct {
 	Driver string `mapstructure:"driver"`
 	DSN    string `mapstructure:"dsn"`
 }
+
+// AuthzConfig holds authorization configuration.
+type AuthzConfig struct {
+	// ServeBundles publishes signed authorization bundles at
+	// GET /api/v1/authz/bundle. It requires BundleSigningKey.
+	ServeBundles bool `mapstructure:"serve_bundles"`
+	// BundleSigningKey is a base64 Ed25519 seed or private key used to sign
+	// authorization bundles.
+	BundleSigningKey string `mapstructure:"bundle_signing_key"`
+}
+
+// HashersConfig holds password hashing configuration.
+type HashersConfig struct {
+	Argon2 Argon2Config `mapstructure:"argon2"`
+}
+
+// Argon2Config holds the Argon2id parameters of new password hashes. Zero
+// values select the defaults. Hashes with other parameters keep verifying
+// and are rehashed at the next login; see iamctl hasher calibrate for
+// parameters that suit a machine.
+type Argon2Config struct {
+	// Memory is the memory cost in KiB.
+	Memory      uint32 `mapstructure:"memory"`
+	Iterations  uint32 `mapstructure:"iterations"`
+	Parallelism uint8  `mapstructure:"parallelism"`
+	SaltLength  uint32 `mapstructure:"salt_length"`
+	KeyLength   uint32 `mapstructure:"key_length"`
+}
+
+// PasswordPolicyConfig holds the rules new passwords must satisfy. Zero
+// values select the defaults. Imported password hashes are not checked.
+type PasswordPolicyConfig struct {
+	// MinLength and MaxLength bound the length in characters; they default
+	// to 8 and 128. The maximum keeps hashing cheap.
+	MinLength int `mapstructure:"min_length"`
+	MaxLength int `mapstructure:"max_length"`
+	// MinCharacterClasses is the number of character classes (lower, upper,
+	// digit, symbol) a password must mix.
+	MinCharacterClasses int `mapstructure:"min_character_classes"`
+	// RequiredCharacterClasses lists the character classes every password
+	// must contain.
+	RequiredCharacterClasses []string `mapstructure:"required_character_classes"`
+	// AllowSimilarToIdentifiers accepts passwords that resemble an
+	// identifier or trait of the identity.
+	AllowSimilarToIdentifiers bool `mapstructure:"allow_similar_to_identifiers"`
+	// HistorySize is the number of recent passwords that cannot be reused.
+	HistorySize int `mapstructure:"history_size"`
+	// BreachedPasswords is a file or directory of breached passwords that
+	// are rejected, see password.LoadBreachedList.
+	BreachedPasswords string `mapstructure:"breached_passwords"`
+	// BreachedMinCount ignores breached passwords seen fewer times.
+	BreachedMinCount int `mapstructure:"breached_min_count"`
+	// Expiry defines when passwords have to be changed.
+	Expiry PasswordExpiryConfig `mapstructure:"expiry"`
+}
+
+// PasswordExpiryConfig holds the maximum password ages. An identity gets
+// the shortest age that applies to it; zero never expires. Logins with an
+// expired password have to change it before a session is issued.
+type PasswordExpiryConfig struct {
+	MaxAge time.Duration `mapstructure:"max_age"`
+	// Networks holds ages by network ID.
+	Networks map[string]time.Duration `mapstructure:"networks"`
+	// Roles holds ages by role name or ID.
+	Roles map[string]time.Duration `mapstructure:"roles"`
+}
+
+// IdentitiesConfig holds identity configuration.
+type IdentitiesConfig struct {
+	// DeletionGracePeriod is how long deleted identities can be restored
+	// before they are purged; it defaults to 720h (30 days).
+	DeletionGracePeriod time.Duration `mapstructure:"deletion_grace_period"`
+	// PurgeInterval is how often identities past their grace period are
+	// purged; it defaults to 1h.
+	PurgeInterval time.Duration `mapstructure:"purge_interval"`
+}
+
+// VerificationConfig holds address verification configuration.
+type VerificationConfig struct {
+	// CodeTTL is how long codes and links stay valid; it defaults to 15m.
+	CodeTTL time.Duration `mapstructure:"code_ttl"`
+	// MaxAttempts is the number of codes that may be entered for an
+	// address per window, across resends; it defaults to 5.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// MaxSends is the number of codes sent to an address per window; it
+	// defaults to 5.
+	MaxSends int `mapstructure:"max_sends"`
+	// ResendInterval is the time between two codes sent to an address; it
+	// defaults to 1m.
+	ResendInterval time.Duration `mapstructure:"resend_interval"`
+	// Window is the period max_attempts and max_sends apply to, from the
+	// first code sent to an address; it defaults to 24h.
+	Window time.Duration `mapstructure:"window"`
+	// LinkURL is the URL verification links point to. Only codes are sent
+	// when it is empty.
+	LinkURL string `mapstructure:"link_url"`
+	// Require maps actions, such as login, to the channels an identity
+	// needs a verified address of; an empty list accepts any channel.
+	Require map[string][]string `mapstructure:"require"`
+}
+
+// OAuthConfig holds the configuration of logins with OAuth providers.
+type OAuthConfig struct {
+	// AutoLink links a provider account that logs in for the first time to
+	// the identity owning its email address, when both the provider and
+	// the identity have verified the address. A new identity is created
+	// otherwise.
+	AutoLink bool `mapstructure:"auto_link"`
+	// Providers holds the clients of the supported providers, github and
+	// google, by name.
+	Providers map[string]OAuthProviderConfig `mapstructure:"providers"`
+}
+
+// OAuthProviderConfig holds the OAuth client of a provider.
+type OAuthProviderConfig struct {
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	// RedirectURL is the callback URL registered with the provider.
+	RedirectURL string `mapstructure:"redirect_url"`
+	// Scopes default to those needed to read the profile and verified
+	// email address.
+	Scopes []string `mapstructure:"scopes"`
+}
+
+// SCIMConfig holds the configuration of the SCIM provisioning server.
+type SCIMConfig struct {
+	// SchemaID is the identity schema of provisioned users; it defaults to
+	// default.
+	SchemaID string `mapstructure:"schema_id"`
+	// Attributes maps SCIM user attributes, such as userName or emails, to
+	// the dot separated paths of the traits holding them. Attributes left
+	// out keep their default mapping and an empty path drops them.
+	Attributes map[string]string `mapstructure:"attributes"`
+	// SyncInterval is how often connectors provisioning downstream
+	// applications are reconciled; it defaults to 5m.
+	SyncInterval time.Duration `mapstructure:"sync_interval"`
+	// SyncTimeout bounds requests to downstream applications; it defaults
+	// to 30s.
+	SyncTimeout time.Duration `mapstructure:"sync_timeout"`
+}
+
+// ServiceAccountsConfig holds the configuration of service accounts.
+type ServiceAccountsConfig struct {
+	// TokenTTL is how long access tokens issued to service accounts stay
+	// valid; it defaults to 1h.
+	TokenTTL time.Duration `mapstructure:"token_ttl"`
+	// RotationOverlap is how long a rotated key stays valid next to its
+	// replacement; it defaults to 24h.
+	RotationOverlap time.Duration `mapstructure:"rotation_overlap"`
+	// Audience lists the audiences client assertions are accepted for. It
+	// defaults to the URL of the token endpoint below server.base_url.
+	Audience []string `mapstructure:"audience"`
+}
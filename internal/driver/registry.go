@@ -6,6 +6,7 @@ package driver
 
 import (
 	"context"
+	"crypto/ed25519"
 
 	"github.com/sirupsen/logrus"
 
@@ -16,12 +17,20 @@ import (
 
 	"github.com/coding-hui/iam/internal/audit"
 	"github.com/coding-hui/iam/internal/authz"
+	"github.com/coding-hui/iam/internal/authz/bundle"
 	"github.com/coding-hui/iam/internal/authz/policy"
 	"github.com/coding-hui/iam/internal/authz/role"
 	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/bulk"
 	"github.com/coding-hui/iam/internal/identity/lockout"
+	"github.com/coding-hui/iam/internal/identity/privacy"
+	"github.com/coding-hui/iam/internal/identity/schema"
+	"github.com/coding-hui/iam/internal/identity/serviceaccount"
 	"github.com/coding-hui/iam/internal/identity/session"
 	"github.com/coding-hui/iam/internal/identity/token"
+	"github.com/coding-hui/iam/internal/identity/verification"
+	"github.com/coding-hui/iam/internal/scim"
+	"github.com/coding-hui/iam/internal/scim/connector"
 	"github.com/coding-hui/iam/internal/selfservice/courier"
 	"github.com/coding-hui/iam/internal/selfservice/strategies"
 )
@@ -40,6 +49,11 @@ type Registry interface {
 	PrivilegedIdentityPool() identity.PrivilegedPool
 	IdentityManager() identity.Manager
 	IdentityHasher() identity.Hasher
+	IdentitySchemaValidator() *schema.Validator
+	IdentitySchemaManager() schema.Manager
+	IdentityBulkManager() bulk.Manager
+	IdentityPrivacyManager() privacy.Manager
+	VerificationManager() verification.Manager
 
 	// Session (L1)
 	SessionPool() session.Pool
@@ -50,11 +64,16 @@ type Registry interface {
 	TokenPool() token.Pool
 	TokenManager() token.Manager
 
+	// Service accounts (L3)
+	ServiceAccountManager() serviceaccount.Manager
+
 	// Lockout (L3)
 	LockoutManager() lockout.Manager
 
 	// Authz (L2)
 	AuthzEngine() *authz.Engine
+	AuthzBundleBuilder() *bundle.Builder
+	AuthzBundleSigningKey() ed25519.PrivateKey
 	RolePool() role.Pool
 	PrivilegedRolePool() role.PrivilegedPool
 	RoleManager() role.Manager
@@ -64,6 +83,7 @@ type Registry interface {
 
 	// Selfservice (L1)
 	PasswordAuthenticator() *strategies.PasswordAuthenticator
+	OAuthAuthenticator() *strategies.OAuthAuthenticator
 	MFAManager() *strategies.ManagerImpl
 	SelfserviceHandler() *selfservice.Handler
 
@@ -75,6 +95,10 @@ type Registry interface {
 	AuditRecorder() audit.Recorder
 	AuditManager() audit.Manager
 
+	// SCIM (L1)
+	SCIMManager() scim.Manager
+	SCIMConnectorManager() connector.Manager
+
 	// Persistence
 	Persister() Persister
 	MigrateUp(ctx context.Context) error
@@ -124,6 +148,7 @@ type Persister interface {
 type Cache interface {
 	Get(ctx context.Context, key string) ([]byte, error)
 	Set(ctx context.Context, key string, value []byte, ttl int64) error
+	SetNX(ctx context.Context, key string, value []byte, ttl int64) (bool, error)
 	Delete(ctx context.Context, key string) error
 	Keys(ctx context.Context, pattern string) ([]string, error)
 	Ping(ctx context.Context) error
@@ -6,25 +6,44 @@ package driver
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
 
 	"github.com/coding-hui/iam/internal/audit"
 	"github.com/coding-hui/iam/internal/authz"
+	"github.com/coding-hui/iam/internal/authz/bundle"
 	"github.com/coding-hui/iam/internal/authz/policy"
 	"github.com/coding-hui/iam/internal/authz/role"
 	"github.com/coding-hui/iam/internal/cache"
 	"github.com/coding-hui/iam/internal/config"
 	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/bulk"
 	"github.com/coding-hui/iam/internal/identity/lockout"
+	"github.com/coding-hui/iam/internal/identity/password"
+	"github.com/coding-hui/iam/internal/identity/privacy"
+	"github.com/coding-hui/iam/internal/identity/schema"
+	"github.com/coding-hui/iam/internal/identity/serviceaccount"
 	"github.com/coding-hui/iam/internal/identity/session"
 	"github.com/coding-hui/iam/internal/identity/token"
+	"github.com/coding-hui/iam/internal/identity/verification"
 	"github.com/coding-hui/iam/internal/persistence/sql"
+	"github.com/coding-hui/iam/internal/scim"
+	"github.com/coding-hui/iam/internal/scim/connector"
 	"github.com/coding-hui/iam/internal/selfservice"
 	"github.com/coding-hui/iam/internal/selfservice/courier"
 	"github.com/coding-hui/iam/internal/selfservice/strategies"
+	"github.com/coding-hui/iam/pkg/authzbundle"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace"
@@ -60,10 +79,18 @@ type RegistryDefault struct {
 	init    sync.Once
 	initErr error
 
-	identityPool           initOnce[identity.Pool]
-	identityPrivilegedPool initOnce[identity.PrivilegedPool]
-	identityManager        initOnce[identity.Manager]
-	identityHasher         identity.Hasher
+	identityPool            initOnce[identity.Pool]
+	identityPrivilegedPool  initOnce[identity.PrivilegedPool]
+	identityManager         initOnce[identity.Manager]
+	identityHasher          identity.Hasher
+	identitySchemaPool      initOnce[schema.PrivilegedPool]
+	identitySchemaRegistry  initOnce[*schema.SchemaRegistry]
+	identitySchemaValidator initOnce[*schema.Validator]
+	identitySchemaManager   initOnce[schema.Manager]
+	identityBulkManager     initOnce[bulk.Manager]
+	identityPrivacyManager  initOnce[privacy.Manager]
+
+	verificationManager initOnce[verification.Manager]
 
 	sessionPool           initOnce[session.Pool]
 	sessionPrivilegedPool initOnce[session.PrivilegedPool]
@@ -73,6 +100,8 @@ type RegistryDefault struct {
 	tokenPrivilegedPool initOnce[token.PrivilegedPool]
 	tokenManager        initOnce[token.Manager]
 
+	serviceAccountManager initOnce[serviceaccount.Manager]
+
 	lockoutManager initOnce[lockout.Manager]
 
 	rolePool           initOnce[role.Pool]
@@ -83,9 +112,12 @@ type RegistryDefault struct {
 	policyPrivilegedPool initOnce[policy.PrivilegedPool]
 	policyManager        initOnce[policy.Manager]
 
-	authzEngine *authz.Engine
+	authzEngine           *authz.Engine
+	authzBundleBuilder    initOnce[*bundle.Builder]
+	authzBundleSigningKey initOnce[ed25519.PrivateKey]
 
-	passwordAuthenticator *strategies.PasswordAuthenticator
+	passwordAuthenticator initOnce[*strategies.PasswordAuthenticator]
+	oauthAuthenticator    initOnce[*strategies.OAuthAuthenticator]
 	mfaManager            *strategies.ManagerImpl
 
 	selfserviceHandler initOnce[*selfservice.Handler]
@@ -94,6 +126,9 @@ type RegistryDefault struct {
 	auditPool     initOnce[audit.Pool]
 	auditRecorder initOnce[audit.Recorder]
 	auditManager  initOnce[audit.Manager]
+
+	scimManager          initOnce[scim.Manager]
+	scimConnectorManager initOnce[connector.Manager]
 }
 
 // NewRegistry creates a new Registry instance with the given configuration.
@@ -146,7 +181,32 @@ func (r *RegistryDefault) initialize(ctx context.Context) error {
 		},
 	}
 
-	r.identityHasher = identity.NewArgon2idHasher()
+	r.identityHasher = r.newIdentityHasher()
+
+	r.identitySchemaPool = initOnce[schema.PrivilegedPool]{
+		fn: func() schema.PrivilegedPool {
+			p := r.persister.Get()
+			return schema.NewPrivilegedPool(sql.NewIdentitySchemaPool(p))
+		},
+	}
+
+	r.identitySchemaRegistry = initOnce[*schema.SchemaRegistry]{
+		fn: func() *schema.SchemaRegistry {
+			return schema.NewSchemaRegistry(r.identitySchemaPool.Get())
+		},
+	}
+
+	r.identitySchemaValidator = initOnce[*schema.Validator]{
+		fn: func() *schema.Validator {
+			return schema.NewValidator(r.identitySchemaRegistry.Get())
+		},
+	}
+
+	r.identitySchemaManager = initOnce[schema.Manager]{
+		fn: func() schema.Manager {
+			return schema.NewManagerImpl(r.identitySchemaRegistry.Get(), r.identitySchemaPool.Get())
+		},
+	}
 
 	r.identityPool = initOnce[identity.Pool]{
 		fn: func() identity.Pool {
@@ -164,11 +224,71 @@ func (r *RegistryDefault) initialize(ctx context.Context) error {
 
 	r.identityManager = initOnce[identity.Manager]{
 		fn: func() identity.Manager {
-			return identity.NewManagerImpl(
+			m := identity.NewManagerImpl(
+				r.persister.Get(),
 				r.identityPool.Get(),
 				r.identityPrivilegedPool.Get(),
 				r.identityHasher,
+				r.identitySchemaValidator.Get(),
 			)
+			m.SetLifecycleHooks(identity.LifecycleHooks{
+				Revokers: []identity.RevokeFunc{
+					r.sessionManager.Get().RevokeAllSessions,
+					r.tokenManager.Get().RevokeAllTokens,
+				},
+				Purgers: []identity.PurgeFunc{
+					func(ctx context.Context, networkID uuid.UUID) error {
+						return r.authzEngine.ReloadFrom(ctx, networkID.String())
+					},
+				},
+				Events: r.courierInstance.Get(),
+				Audit:  r.auditManager.Get(),
+			})
+			m.SetPasswordPolicy(r.newPasswordPolicy())
+			m.SetDeletionGracePeriod(r.newDeletionGracePeriod())
+			return m
+		},
+	}
+
+	r.identityBulkManager = initOnce[bulk.Manager]{
+		fn: func() bulk.Manager {
+			return bulk.NewManagerImpl(
+				r.persister.Get(),
+				r.identityManager.Get(),
+				r.identityPool.Get(),
+				r.rolePrivilegedPool.Get(),
+				r.authzEngine,
+			)
+		},
+	}
+
+	r.identityPrivacyManager = initOnce[privacy.Manager]{
+		fn: func() privacy.Manager {
+			return privacy.NewManagerImpl(
+				r.persister.Get(),
+				r.identityManager.Get(),
+				r.identityPool.Get(),
+				r.sessionPool.Get(),
+				r.tokenPool.Get(),
+				r.rolePool.Get(),
+				r.auditManager.Get(),
+			)
+		},
+	}
+
+	r.verificationManager = initOnce[verification.Manager]{
+		fn: func() verification.Manager {
+			p := r.persister.Get()
+			m := verification.NewManagerImpl(
+				p,
+				verification.NewPrivilegedPool(sql.NewVerificationCodePool(p)),
+				r.identityPrivilegedPool.Get(),
+				r.courierInstance.Get(),
+				r.auditManager.Get(),
+			)
+			m.SetConfig(r.newVerificationConfig())
+			m.SetPolicy(r.newVerificationPolicy())
+			return m
 		},
 	}
 
@@ -214,10 +334,25 @@ func (r *RegistryDefault) initialize(ctx context.Context) error {
 			return token.NewManagerImpl(
 				r.tokenPool.Get(),
 				r.tokenPrivilegedPool.Get(),
+				r.identityPool.Get(),
 			)
 		},
 	}
 
+	r.serviceAccountManager = initOnce[serviceaccount.Manager]{
+		fn: func() serviceaccount.Manager {
+			p := r.persister.Get()
+			m := serviceaccount.NewManagerImpl(
+				serviceaccount.NewPrivilegedPool(sql.NewSecretKeyPool(p), sql.NewPublicKeyPool(p)),
+				r.identityPool.Get(),
+				r.tokenManager.Get(),
+			)
+			m.SetConfig(r.newServiceAccountConfig())
+			m.SetReplayCache(r.Cache())
+			return m
+		},
+	}
+
 	r.lockoutManager = initOnce[lockout.Manager]{
 		fn: func() lockout.Manager {
 			return lockout.NewManager(5, 15*60*1000*1000*1000)
@@ -243,6 +378,7 @@ func (r *RegistryDefault) initialize(ctx context.Context) error {
 			return role.NewManagerImpl(
 				r.rolePool.Get(),
 				r.rolePrivilegedPool.Get(),
+				r.authzEngine,
 			)
 		},
 	}
@@ -264,20 +400,67 @@ func (r *RegistryDefault) initialize(ctx context.Context) error {
 	r.policyManager = initOnce[policy.Manager]{
 		fn: func() policy.Manager {
 			return policy.NewManagerImpl(
+				r.persister.Get(),
 				r.policyPool.Get(),
 				r.policyPrivilegedPool.Get(),
+				r.authzEngine,
 			)
 		},
 	}
 
 	r.authzEngine = authz.NewEngine()
+	r.authzEngine.SetLoader(authz.LoaderFunc(func(ctx context.Context, networkID string) (*authz.Snapshot, error) {
+		return r.authzBundleBuilder.Get().Load(ctx, networkID)
+	}))
+	r.authzEngine.SetSubjectAttributes(authz.SubjectAttributesFunc(func(ctx context.Context, networkID, subject string) (map[string]any, error) {
+		return identity.SubjectAttributes(ctx, r.identityPool.Get(), networkID, subject)
+	}))
+
+	r.authzBundleBuilder = initOnce[*bundle.Builder]{
+		fn: func() *bundle.Builder {
+			return bundle.NewBuilder(r.policyPool.Get(), r.rolePool.Get())
+		},
+	}
+
+	r.authzBundleSigningKey = initOnce[ed25519.PrivateKey]{
+		fn: func() ed25519.PrivateKey {
+			return r.newBundleSigningKey()
+		},
+	}
 
 	// Selfservice (L1) - Strategies
-	r.passwordAuthenticator = strategies.NewPasswordAuthenticator(
-		r.identityPrivilegedPool.Get(),
-		r.sessionPrivilegedPool.Get(),
-		r.identityHasher,
-	)
+	r.passwordAuthenticator = initOnce[*strategies.PasswordAuthenticator]{
+		fn: func() *strategies.PasswordAuthenticator {
+			a := strategies.NewPasswordAuthenticator(
+				r.identityPrivilegedPool.Get(),
+				r.sessionPrivilegedPool.Get(),
+				r.identityHasher,
+			)
+			a.SetPasswordRotation(&strategies.PasswordRotation{
+				Expiry:     r.newPasswordExpiry(),
+				Roles:      r.rolePool.Get(),
+				Tokens:     r.tokenManager.Get(),
+				Identities: r.identityManager.Get(),
+			})
+			a.SetAddressVerifier(r.verificationManager.Get())
+			return a
+		},
+	}
+
+	r.oauthAuthenticator = initOnce[*strategies.OAuthAuthenticator]{
+		fn: func() *strategies.OAuthAuthenticator {
+			a := strategies.NewOAuthAuthenticator(
+				r.identityPrivilegedPool.Get(),
+				r.sessionPrivilegedPool.Get(),
+				r.identityHasher,
+			)
+			for provider, cfg := range r.newOAuthProviders() {
+				a.RegisterProvider(provider, cfg)
+			}
+			a.SetAutoLink(r.config.OAuth.AutoLink)
+			return a
+		},
+	}
 
 	r.mfaManager = strategies.NewManagerImpl()
 
@@ -285,7 +468,9 @@ func (r *RegistryDefault) initialize(ctx context.Context) error {
 	r.selfserviceHandler = initOnce[*selfservice.Handler]{
 		fn: func() *selfservice.Handler {
 			return selfservice.NewHandler(
-				r.passwordAuthenticator,
+				r.identityManager.Get(),
+				r.passwordAuthenticator.Get(),
+				r.oauthAuthenticator.Get(),
 				r.mfaManager,
 			)
 		},
@@ -322,6 +507,35 @@ func (r *RegistryDefault) initialize(ctx context.Context) error {
 		},
 	}
 
+	// SCIM (L1)
+	r.scimManager = initOnce[scim.Manager]{
+		fn: func() scim.Manager {
+			p := r.persister.Get()
+			m := scim.NewManagerImpl(
+				scim.NewPrivilegedPool(sql.NewSCIMTokenPool(p)),
+				r.identityManager.Get(),
+				r.identityPool.Get(),
+				r.roleManager.Get(),
+				r.rolePool.Get(),
+			)
+			m.SetConfig(r.newSCIMConfig())
+			return m
+		},
+	}
+
+	r.scimConnectorManager = initOnce[connector.Manager]{
+		fn: func() connector.Manager {
+			p := r.persister.Get()
+			m := connector.NewManagerImpl(
+				connector.NewPrivilegedPool(sql.NewSCIMConnectorPool(p)),
+				r.identityPool.Get(),
+				r.rolePool.Get(),
+			)
+			m.SetTimeout(r.newSCIMSyncTimeout())
+			return m
+		},
+	}
+
 	return nil
 }
 
@@ -347,6 +561,213 @@ func (r *RegistryDefault) newPersister() *sql.Persister {
 	return p
 }
 
+func (r *RegistryDefault) newBundleSigningKey() ed25519.PrivateKey {
+	encoded := r.config.Authz.BundleSigningKey
+	if encoded == "" {
+		panic("authz.bundle_signing_key is required to serve authz bundles")
+	}
+	key, err := authzbundle.ParsePrivateKey(encoded)
+	if err != nil {
+		panic("failed to parse authz bundle signing key: " + err.Error())
+	}
+	return key
+}
+
+func (r *RegistryDefault) newIdentityHasher() identity.Hasher {
+	cfg, params := r.config.Hashers.Argon2, identity.DefaultArgon2Params()
+	if cfg.Memory != 0 {
+		params.Memory = cfg.Memory
+	}
+	if cfg.Iterations != 0 {
+		params.Iterations = cfg.Iterations
+	}
+	if cfg.Parallelism != 0 {
+		params.Parallelism = cfg.Parallelism
+	}
+	if cfg.SaltLength != 0 {
+		params.SaltLength = cfg.SaltLength
+	}
+	if cfg.KeyLength != 0 {
+		params.KeyLength = cfg.KeyLength
+	}
+
+	hasher, err := identity.NewArgon2idHasherWithParams(params)
+	if err != nil {
+		panic("invalid hashers.argon2 config: " + err.Error())
+	}
+	return hasher
+}
+
+func (r *RegistryDefault) newPasswordPolicy() *password.Policy {
+	cfg, policy := r.config.PasswordPolicy, password.DefaultPolicy()
+	if cfg.MinLength != 0 {
+		policy.MinLength = cfg.MinLength
+	}
+	if cfg.MaxLength != 0 {
+		policy.MaxLength = cfg.MaxLength
+	}
+	policy.MinClasses = cfg.MinCharacterClasses
+	for _, name := range cfg.RequiredCharacterClasses {
+		class, err := password.ParseClass(name)
+		if err != nil {
+			panic("invalid password_policy config: " + err.Error())
+		}
+		policy.RequiredClasses = append(policy.RequiredClasses, class)
+	}
+	policy.CheckSimilarity = !cfg.AllowSimilarToIdentifiers
+	policy.HistorySize = cfg.HistorySize
+	if err := policy.Validate(); err != nil {
+		panic("invalid password_policy config: " + err.Error())
+	}
+
+	if cfg.BreachedPasswords != "" {
+		list, err := password.LoadBreachedList(cfg.BreachedPasswords, cfg.BreachedMinCount)
+		if err != nil {
+			panic("cannot load breached passwords: " + err.Error())
+		}
+		policy.Breached = list
+	}
+	return policy
+}
+
+func (r *RegistryDefault) newPasswordExpiry() *password.ExpiryPolicy {
+	cfg := r.config.PasswordPolicy.Expiry
+	policy := &password.ExpiryPolicy{
+		MaxAge:        cfg.MaxAge,
+		NetworkMaxAge: cfg.Networks,
+		RoleMaxAge:    cfg.Roles,
+	}
+	if err := policy.Validate(); err != nil {
+		panic("invalid password_policy.expiry config: " + err.Error())
+	}
+	return policy
+}
+
+func (r *RegistryDefault) newDeletionGracePeriod() time.Duration {
+	d := r.config.Identities.DeletionGracePeriod
+	if d < 0 {
+		panic("invalid identities.deletion_grace_period config: must not be negative")
+	}
+	if d == 0 {
+		return identity.DefaultDeletionGracePeriod
+	}
+	return d
+}
+
+func (r *RegistryDefault) newVerificationConfig() verification.Config {
+	cfg := r.config.Verification
+	if cfg.CodeTTL < 0 || cfg.MaxAttempts < 0 || cfg.MaxSends < 0 || cfg.ResendInterval < 0 || cfg.Window < 0 {
+		panic("invalid verification config: code_ttl, max_attempts, max_sends, resend_interval and window must not be negative")
+	}
+	if cfg.LinkURL != "" {
+		if u, err := url.Parse(cfg.LinkURL); err != nil || !u.IsAbs() {
+			panic("invalid verification.link_url config: must be an absolute URL")
+		}
+	}
+	return verification.Config{
+		CodeTTL:        cfg.CodeTTL,
+		MaxAttempts:    cfg.MaxAttempts,
+		MaxSends:       cfg.MaxSends,
+		ResendInterval: cfg.ResendInterval,
+		Window:         cfg.Window,
+		LinkURL:        cfg.LinkURL,
+	}
+}
+
+func (r *RegistryDefault) newVerificationPolicy() *verification.Policy {
+	policy := &verification.Policy{Actions: r.config.Verification.Require}
+	if err := policy.Validate(); err != nil {
+		panic("invalid verification.require config: " + err.Error())
+	}
+	return policy
+}
+
+func (r *RegistryDefault) newSCIMConfig() scim.Config {
+	cfg := scim.Config{
+		SchemaID:   r.config.SCIM.SchemaID,
+		Attributes: r.config.SCIM.Attributes,
+	}
+	if err := cfg.Validate(); err != nil {
+		panic("invalid scim config: " + err.Error())
+	}
+	return cfg
+}
+
+func (r *RegistryDefault) newSCIMSyncTimeout() time.Duration {
+	d := r.config.SCIM.SyncTimeout
+	if d < 0 {
+		panic("invalid scim.sync_timeout config: must not be negative")
+	}
+	if d == 0 {
+		return connector.DefaultTimeout
+	}
+	return d
+}
+
+func (r *RegistryDefault) newServiceAccountConfig() serviceaccount.Config {
+	c := r.config.ServiceAccounts
+	if c.TokenTTL < 0 {
+		panic("invalid service_accounts.token_ttl config: must not be negative")
+	}
+	if c.RotationOverlap < 0 {
+		panic("invalid service_accounts.rotation_overlap config: must not be negative")
+	}
+	audience := c.Audience
+	if len(audience) == 0 {
+		audience = []string{r.baseURL() + "/api/v1/service-accounts/token"}
+	}
+	return serviceaccount.Config{
+		TokenTTL:        c.TokenTTL,
+		RotationOverlap: c.RotationOverlap,
+		Audience:        audience,
+	}
+}
+
+// baseURL returns the configured URL clients reach the server at, without
+// a trailing slash.
+func (r *RegistryDefault) baseURL() string {
+	if u := strings.TrimRight(r.config.Server.BaseURL, "/"); u != "" {
+		return u
+	}
+	return "http://" + net.JoinHostPort(r.config.Server.Host, strconv.Itoa(r.config.Server.Port))
+}
+
+// oauthEndpoints holds the endpoints and default scopes of the supported
+// OAuth providers.
+var oauthEndpoints = map[strategies.OAuthProvider]struct {
+	endpoint oauth2.Endpoint
+	scopes   []string
+}{
+	strategies.OAuthProviderGitHub: {endpoints.GitHub, []string{"read:user", "user:email"}},
+	strategies.OAuthProviderGoogle: {endpoints.Google, []string{"openid", "email", "profile"}},
+}
+
+func (r *RegistryDefault) newOAuthProviders() map[strategies.OAuthProvider]*oauth2.Config {
+	providers := make(map[strategies.OAuthProvider]*oauth2.Config, len(r.config.OAuth.Providers))
+	for name, cfg := range r.config.OAuth.Providers {
+		provider := strategies.OAuthProvider(name)
+		known, ok := oauthEndpoints[provider]
+		if !ok {
+			panic(fmt.Sprintf("invalid oauth.providers config: unsupported provider %q", name))
+		}
+		if cfg.ClientID == "" || cfg.RedirectURL == "" {
+			panic(fmt.Sprintf("invalid oauth.providers.%s config: client_id and redirect_url are required", name))
+		}
+		scopes := cfg.Scopes
+		if len(scopes) == 0 {
+			scopes = known.scopes
+		}
+		providers[provider] = &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       scopes,
+			Endpoint:     known.endpoint,
+		}
+	}
+	return providers
+}
+
 func (r *RegistryDefault) newCache() Cache {
 	// Use in-memory cache for simplified setup
 	return cache.NewMemoryCache()
@@ -395,11 +816,31 @@ func (r *RegistryDefault) IdentityManager() identity.Manager {
 	return r.identityManager.Get()
 }
 
+// IdentityBulkManager returns the identity bulk import and export manager.
+func (r *RegistryDefault) IdentityBulkManager() bulk.Manager {
+	return r.identityBulkManager.Get()
+}
+
+// IdentityPrivacyManager returns the manager of data subject requests.
+func (r *RegistryDefault) IdentityPrivacyManager() privacy.Manager {
+	return r.identityPrivacyManager.Get()
+}
+
 // IdentityHasher returns the identity hasher.
 func (r *RegistryDefault) IdentityHasher() identity.Hasher {
 	return r.identityHasher
 }
 
+// IdentitySchemaValidator returns the identity traits validator.
+func (r *RegistryDefault) IdentitySchemaValidator() *schema.Validator {
+	return r.identitySchemaValidator.Get()
+}
+
+// IdentitySchemaManager returns the identity schema manager.
+func (r *RegistryDefault) IdentitySchemaManager() schema.Manager {
+	return r.identitySchemaManager.Get()
+}
+
 // SessionPool returns the session pool.
 func (r *RegistryDefault) SessionPool() session.Pool {
 	return r.sessionPool.Get()
@@ -425,6 +866,11 @@ func (r *RegistryDefault) TokenManager() token.Manager {
 	return r.tokenManager.Get()
 }
 
+// ServiceAccountManager returns the service account manager.
+func (r *RegistryDefault) ServiceAccountManager() serviceaccount.Manager {
+	return r.serviceAccountManager.Get()
+}
+
 // LockoutManager returns the lockout manager.
 func (r *RegistryDefault) LockoutManager() lockout.Manager {
 	return r.lockoutManager.Get()
@@ -465,9 +911,24 @@ func (r *RegistryDefault) AuthzEngine() *authz.Engine {
 	return r.authzEngine
 }
 
+// AuthzBundleBuilder returns the authz bundle builder.
+func (r *RegistryDefault) AuthzBundleBuilder() *bundle.Builder {
+	return r.authzBundleBuilder.Get()
+}
+
+// AuthzBundleSigningKey returns the key used to sign authz bundles.
+func (r *RegistryDefault) AuthzBundleSigningKey() ed25519.PrivateKey {
+	return r.authzBundleSigningKey.Get()
+}
+
 // PasswordAuthenticator returns the password authenticator.
 func (r *RegistryDefault) PasswordAuthenticator() *strategies.PasswordAuthenticator {
-	return r.passwordAuthenticator
+	return r.passwordAuthenticator.Get()
+}
+
+// OAuthAuthenticator returns the OAuth authenticator.
+func (r *RegistryDefault) OAuthAuthenticator() *strategies.OAuthAuthenticator {
+	return r.oauthAuthenticator.Get()
 }
 
 // MFAManager returns the MFA manager.
@@ -480,6 +941,11 @@ func (r *RegistryDefault) SelfserviceHandler() *selfservice.Handler {
 	return r.selfserviceHandler.Get()
 }
 
+// VerificationManager returns the address verification manager.
+func (r *RegistryDefault) VerificationManager() verification.Manager {
+	return r.verificationManager.Get()
+}
+
 // Courier returns the courier.
 func (r *RegistryDefault) Courier() courier.Courier {
 	return r.courierInstance.Get()
@@ -500,6 +966,17 @@ func (r *RegistryDefault) AuditManager() audit.Manager {
 	return r.auditManager.Get()
 }
 
+// SCIMManager returns the SCIM service provider.
+func (r *RegistryDefault) SCIMManager() scim.Manager {
+	return r.scimManager.Get()
+}
+
+// SCIMConnectorManager returns the manager of connectors provisioning
+// downstream applications.
+func (r *RegistryDefault) SCIMConnectorManager() connector.Manager {
+	return r.scimConnectorManager.Get()
+}
+
 // NotificationSender returns nil - not yet implemented.
 func (r *RegistryDefault) NotificationSender() any { return nil }
 
@@ -0,0 +1,88 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/identity/schema"
+	"github.com/coding-hui/iam/pkg/identifier"
+)
+
+// VerifiableAddressStatus is the progress of the verification of an
+// address.
+type VerifiableAddressStatus string
+
+const (
+	// VerifiableAddressStatusPending means no code has been sent yet.
+	VerifiableAddressStatusPending VerifiableAddressStatus = "pending"
+	// VerifiableAddressStatusSent means a code has been sent.
+	VerifiableAddressStatusSent VerifiableAddressStatus = "sent"
+	// VerifiableAddressStatusCompleted means the address is verified.
+	VerifiableAddressStatusCompleted VerifiableAddressStatus = "completed"
+)
+
+// VerifiableAddress is an email address or phone number of an identity
+// whose ownership can be verified. Addresses are the trait values the
+// identity schema annotates for verification, stored in the form of
+// NormalizeAddress.
+type VerifiableAddress struct {
+	ID         uuid.UUID `json:"id"`
+	IdentityID uuid.UUID `json:"identity_id"`
+	Value      string    `json:"value"`
+	// Via is the channel reaching the address: schema.ViaEmail or
+	// schema.ViaSMS.
+	Via        string                  `json:"via"`
+	Status     VerifiableAddressStatus `json:"status"`
+	Verified   bool                    `json:"verified"`
+	VerifiedAt *time.Time              `json:"verified_at,omitempty"`
+	CreatedAt  time.Time               `json:"created_at"`
+	UpdatedAt  time.Time               `json:"updated_at"`
+}
+
+// syncAddresses sets the addresses of an identity to those found in its
+// traits. Addresses that stay keep their verification state; changed
+// values have to be verified again.
+func syncAddresses(identity *Identity, existing []*VerifiableAddress, exts *schema.Extensions) {
+	addrs := make([]*VerifiableAddress, 0, len(exts.VerifiableAddresses))
+	for _, a := range exts.VerifiableAddresses {
+		value := NormalizeAddress(a.Value)
+		addr := findAddress(existing, a.Via, value)
+		if addr == nil {
+			addr = &VerifiableAddress{
+				ID:         uuid.New(),
+				IdentityID: identity.ID,
+				Value:      value,
+				Via:        a.Via,
+				Status:     VerifiableAddressStatusPending,
+				CreatedAt:  identity.UpdatedAt,
+				UpdatedAt:  identity.UpdatedAt,
+			}
+		}
+		addrs = append(addrs, addr)
+	}
+	identity.VerifiableAddresses = addrs
+}
+
+// NormalizeAddress returns an address in the form it is stored and looked
+// up in: normalized with identifier.Normalize like password identifiers,
+// or verbatim when it cannot be normalized.
+func NormalizeAddress(value string) string {
+	if n, err := identifier.Normalize(value); err == nil {
+		return n
+	}
+	return value
+}
+
+func findAddress(addrs []*VerifiableAddress, via, value string) *VerifiableAddress {
+	for _, a := range addrs {
+		if a.Via == via && a.Value == value {
+			return a
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/coding-hui/iam/internal/identity/schema"
+)
+
+func TestVerifiableAddressesAreNormalized(t *testing.T) {
+	ctx := context.Background()
+	m, schemas, _ := newTestManager(t)
+	if _, err := schemas.CreateSchema(ctx, &schema.CreateSchemaRequest{ID: "staff", JSONSchema: json.RawMessage(`{"type":"object","properties":{` +
+		`"email":{"type":"string","format":"email","iam":{"credentials":{"password":{"identifier":true}},"verification":{"via":"email"}}},` +
+		`"phone":{"type":"string","iam":{"verification":{"via":"sms"}}}}}`)}); err != nil {
+		t.Fatal(err)
+	}
+	ann, err := m.CreateIdentity(ctx, &CreateIdentityRequest{SchemaID: "staff", Traits: json.RawMessage(`{"email":"Ann@Example.com","phone":"+49 (30) 1234-56"}`), Password: "correct-horse-battery-9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, err := m.pool.ListVerifiableAddresses(ctx, ann.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := map[string]string{}
+	for _, a := range addrs {
+		stored[a.Via] = a.Value
+	}
+	if stored[schema.ViaEmail] != "ann@example.com" || stored[schema.ViaSMS] != "+4930123456" {
+		t.Errorf("stored addresses = %v, want normalized values", stored)
+	}
+
+	for via, value := range map[string]string{schema.ViaEmail: " ANN@example.COM", schema.ViaSMS: "+49 30 123456"} {
+		addr, err := m.pool.FindVerifiableAddress(ctx, ann.NetworkID, via, value)
+		if err != nil {
+			t.Errorf("FindVerifiableAddress(%s, %q) error = %v", via, value, err)
+			continue
+		}
+		if addr.IdentityID != ann.ID {
+			t.Errorf("FindVerifiableAddress(%s, %q) found an address of %s", via, value, addr.IdentityID)
+		}
+	}
+
+	// Another spelling of the same address keeps it.
+	updated, err := m.UpdateIdentity(ctx, ann.ID, &UpdateIdentityRequest{Traits: json.RawMessage(`{"email":"ann@EXAMPLE.com","phone":"+4930123456"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated.VerifiableAddresses) != len(addrs) {
+		t.Fatalf("updated identity has %d addresses, want %d", len(updated.VerifiableAddresses), len(addrs))
+	}
+	ids := map[string]bool{}
+	for _, a := range addrs {
+		ids[a.ID.String()] = true
+	}
+	for _, a := range updated.VerifiableAddresses {
+		if !ids[a.ID.String()] {
+			t.Errorf("updating traits replaced the %s address %s", a.Via, a.Value)
+		}
+	}
+}
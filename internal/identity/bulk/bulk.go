@@ -0,0 +1,138 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package bulk imports and exports identities in JSON Lines and CSV.
+package bulk
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/password"
+	"github.com/coding-hui/iam/internal/identity/schema"
+)
+
+// Format is the encoding of imported and exported identities.
+type Format string
+
+const (
+	// FormatJSONL encodes one Record as a JSON object per line.
+	FormatJSONL Format = "jsonl"
+	// FormatCSV encodes one Record per row, see the package constants
+	// for the columns.
+	FormatCSV Format = "csv"
+)
+
+// CSV columns. An import needs at least one of ColumnTraits and columns
+// named traits.<path>; the latter set the string trait at a dot separated
+// path and take precedence over ColumnTraits. Roles are separated by
+// RoleSeparator and metadata columns hold JSON objects. CSV carries
+// password credentials only.
+const (
+	ColumnID             = "id"
+	ColumnSchemaID       = "schema_id"
+	ColumnState          = "state"
+	ColumnTraits         = "traits"
+	ColumnMetadataPublic = "metadata_public"
+	ColumnMetadataAdmin  = "metadata_admin"
+	ColumnPassword       = "password"
+	ColumnHashedPassword = "hashed_password"
+	ColumnRoles          = "roles"
+
+	RoleSeparator = ";"
+)
+
+// MaxReportedErrors bounds the errors listed in an ImportReport.
+const MaxReportedErrors = 1000
+
+// Batch sizes of imports.
+const (
+	DefaultBatchSize = 100
+	MaxBatchSize     = 1000
+)
+
+// Record is an imported or exported identity.
+type Record struct {
+	// ID keeps the ID of the identity; a new ID is generated when empty.
+	ID uuid.UUID `json:"id"`
+	// Type defaults to identity.TypeUser; CSV only carries users.
+	Type     identity.Type   `json:"type,omitempty"`
+	SchemaID string          `json:"schema_id,omitempty"`
+	State    identity.State  `json:"state,omitempty"`
+	Traits   json.RawMessage `json:"traits"`
+
+	MetadataPublic json.RawMessage `json:"metadata_public,omitempty"`
+	MetadataAdmin  json.RawMessage `json:"metadata_admin,omitempty"`
+	// Credentials are keyed by credentials type.
+	Credentials map[identity.CredentialsType]*CredentialsRecord `json:"credentials,omitempty"`
+	// Roles are the IDs or names of roles granted to the identity.
+	Roles []string `json:"roles,omitempty"`
+}
+
+// CredentialsRecord holds the credentials of a Record. Password
+// credentials take Password or HashedPassword and derive their
+// identifiers from the traits; other types take Identifiers and Config.
+// Exports carry password hashes in HashedPassword, and secrets in general,
+// only when ExportOptions.Secrets is set.
+type CredentialsRecord struct {
+	Password       string          `json:"password,omitempty"`
+	HashedPassword string          `json:"hashed_password,omitempty"`
+	Identifiers    []string        `json:"identifiers,omitempty"`
+	Config         json.RawMessage `json:"config,omitempty"`
+}
+
+// Manager defines the interface for bulk identity operations.
+type Manager interface {
+	Import(ctx context.Context, r io.Reader, opts *ImportOptions) (*ImportReport, error)
+	Export(ctx context.Context, w io.Writer, opts *ExportOptions) error
+}
+
+// ImportOptions holds the options of an import.
+type ImportOptions struct {
+	Format Format
+	// NetworkID is the network identities are created in and whose roles
+	// are granted.
+	NetworkID uuid.UUID
+	// BatchSize is the number of records written per transaction; it
+	// defaults to DefaultBatchSize and is capped at MaxBatchSize.
+	BatchSize int
+}
+
+// ExportOptions holds the options of an export.
+type ExportOptions struct {
+	Format    Format
+	NetworkID uuid.UUID
+	// Params selects and orders the exported identities; paging is
+	// ignored.
+	Params identity.ListIdentitiesParams
+	// Secrets exports password hashes and the configs of api_key and totp
+	// credentials; these credentials are left out otherwise.
+	Secrets bool
+}
+
+// ImportReport summarizes an import.
+type ImportReport struct {
+	// Total is the number of records read.
+	Total    int `json:"total"`
+	Imported int `json:"imported"`
+	Failed   int `json:"failed"`
+	// Errors describes failed records; the list is truncated after
+	// MaxReportedErrors entries.
+	Errors []*RowError `json:"errors"`
+}
+
+// RowError describes a record that cannot be imported.
+type RowError struct {
+	// Row is the 1-based position of the record in the input, not
+	// counting the CSV header.
+	Row     int                 `json:"row"`
+	Message string              `json:"message"`
+	Errors  []schema.FieldError `json:"errors,omitempty"`
+	// Violations lists the password policy rules the record violates.
+	Violations []password.Violation `json:"violations,omitempty"`
+}
@@ -0,0 +1,347 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/identity"
+)
+
+// maxRecordSize bounds the size of a JSON Lines record.
+const maxRecordSize = 1 << 20 // 1MB
+
+// ParseFormat returns the format named s; an empty name selects
+// FormatJSONL.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case "":
+		return FormatJSONL, nil
+	case FormatJSONL, FormatCSV:
+		return f, nil
+	}
+	return "", fmt.Errorf("%w: unknown format %q", ErrInvalidFormat, s)
+}
+
+// ContentType returns the media type of f.
+func (f Format) ContentType() string {
+	if f == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// row is a decoded record, or the error that prevented decoding it.
+type row struct {
+	n      int
+	record *Record
+	err    error
+}
+
+// decoder reads records. next returns io.EOF after the last record and
+// an error wrapping ErrInvalidFormat when the input cannot be read on.
+type decoder interface {
+	next() (*row, error)
+}
+
+func newDecoder(r io.Reader, f Format) (decoder, error) {
+	switch f {
+	case FormatJSONL:
+		s := bufio.NewScanner(r)
+		s.Buffer(make([]byte, 64*1024), maxRecordSize)
+		return &jsonlDecoder{scanner: s}, nil
+	case FormatCSV:
+		return newCSVDecoder(r)
+	}
+	return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidFormat, f)
+}
+
+type jsonlDecoder struct {
+	scanner *bufio.Scanner
+	n       int
+}
+
+func (d *jsonlDecoder) next() (*row, error) {
+	for d.scanner.Scan() {
+		line := bytes.TrimSpace(d.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		d.n++
+		rec := &Record{}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(rec); err != nil {
+			return &row{n: d.n, err: fmt.Errorf("malformed record: %v", err)}, nil
+		}
+		return &row{n: d.n, record: rec}, nil
+	}
+	if err := d.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("%w: record %d exceeds %d bytes", ErrInvalidFormat, d.n+1, maxRecordSize)
+		}
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+type csvDecoder struct {
+	reader *csv.Reader
+	header []string
+	n      int
+}
+
+func newCSVDecoder(r io.Reader) (*csvDecoder, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: missing CSV header", ErrInvalidFormat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+	}
+
+	d := &csvDecoder{reader: reader, header: make([]string, len(header))}
+	hasTraits := false
+	seen := make(map[string]bool, len(header))
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if i == 0 {
+			column = strings.TrimPrefix(column, "\ufeff") // byte order mark
+		}
+		switch {
+		case column == ColumnTraits || strings.HasPrefix(column, ColumnTraits+".") && len(column) > len(ColumnTraits)+1:
+			hasTraits = true
+		case column == ColumnID, column == ColumnSchemaID, column == ColumnState,
+			column == ColumnMetadataPublic, column == ColumnMetadataAdmin, column == ColumnPassword, column == ColumnHashedPassword, column == ColumnRoles:
+		default:
+			return nil, fmt.Errorf("%w: unknown CSV column %q", ErrInvalidFormat, column)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("%w: duplicate CSV column %q", ErrInvalidFormat, column)
+		}
+		seen[column] = true
+		d.header[i] = column
+	}
+	if !hasTraits {
+		return nil, fmt.Errorf("%w: CSV header has no traits column", ErrInvalidFormat)
+	}
+	return d, nil
+}
+
+func (d *csvDecoder) next() (*row, error) {
+	fields, err := d.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	d.n++
+	if err != nil {
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			return &row{n: d.n, err: fmt.Errorf("malformed record: %v", perr.Err)}, nil
+		}
+		return nil, err
+	}
+
+	rec, err := d.record(fields)
+	if err != nil {
+		return &row{n: d.n, err: err}, nil
+	}
+	return &row{n: d.n, record: rec}, nil
+}
+
+// record converts the fields of a CSV row.
+func (d *csvDecoder) record(fields []string) (*Record, error) {
+	rec := &Record{}
+	traits := map[string]any{}
+	var paths []int
+	for i, column := range d.header {
+		value := fields[i]
+		switch column {
+		case ColumnID:
+			if value == "" {
+				continue
+			}
+			id, err := uuid.Parse(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid id %q", value)
+			}
+			rec.ID = id
+		case ColumnSchemaID:
+			rec.SchemaID = value
+		case ColumnState:
+			rec.State = identity.State(value)
+		case ColumnTraits:
+			if value == "" {
+				continue
+			}
+			if err := json.Unmarshal([]byte(value), &traits); err != nil || traits == nil {
+				return nil, errors.New("traits must be a JSON object")
+			}
+		case ColumnMetadataPublic, ColumnMetadataAdmin:
+			if value == "" {
+				continue
+			}
+			var metadata map[string]any
+			if err := json.Unmarshal([]byte(value), &metadata); err != nil || metadata == nil {
+				return nil, fmt.Errorf("%s must be a JSON object", column)
+			}
+			if column == ColumnMetadataPublic {
+				rec.MetadataPublic = json.RawMessage(value)
+			} else {
+				rec.MetadataAdmin = json.RawMessage(value)
+			}
+		case ColumnPassword, ColumnHashedPassword:
+			if value == "" {
+				continue
+			}
+			if rec.Credentials == nil {
+				rec.Credentials = map[identity.CredentialsType]*CredentialsRecord{identity.CredentialsTypePassword: {}}
+			}
+			cred := rec.Credentials[identity.CredentialsTypePassword]
+			if column == ColumnPassword {
+				cred.Password = value
+			} else {
+				cred.HashedPassword = value
+			}
+		case ColumnRoles:
+			for _, role := range strings.Split(value, RoleSeparator) {
+				if role = strings.TrimSpace(role); role != "" {
+					rec.Roles = append(rec.Roles, role)
+				}
+			}
+		default:
+			paths = append(paths, i)
+		}
+	}
+
+	// Trait columns are applied after the traits column they override.
+	for _, i := range paths {
+		if fields[i] == "" {
+			continue
+		}
+		path := strings.Split(strings.TrimPrefix(d.header[i], ColumnTraits+"."), ".")
+		if err := setTrait(traits, path, fields[i]); err != nil {
+			return nil, fmt.Errorf("%s: %v", d.header[i], err)
+		}
+	}
+
+	raw, err := json.Marshal(traits)
+	if err != nil {
+		return nil, err
+	}
+	rec.Traits = raw
+	return rec, nil
+}
+
+// setTrait sets the value at path in traits, creating objects on the way.
+func setTrait(traits map[string]any, path []string, value string) error {
+	for _, key := range path[:len(path)-1] {
+		if key == "" {
+			return errors.New("empty path segment")
+		}
+		child, ok := traits[key]
+		if !ok {
+			child = map[string]any{}
+			traits[key] = child
+		}
+		obj, ok := child.(map[string]any)
+		if !ok {
+			return fmt.Errorf("trait %q is not an object", key)
+		}
+		traits = obj
+	}
+	if path[len(path)-1] == "" {
+		return errors.New("empty path segment")
+	}
+	traits[path[len(path)-1]] = value
+	return nil
+}
+
+// encoder writes records.
+type encoder interface {
+	encode(rec *Record) error
+	flush() error
+}
+
+func newEncoder(w io.Writer, f Format) (encoder, error) {
+	switch f {
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		return &jsonlEncoder{enc: enc}, nil
+	case FormatCSV:
+		return &csvEncoder{writer: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidFormat, f)
+}
+
+type jsonlEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *jsonlEncoder) encode(rec *Record) error {
+	return e.enc.Encode(rec)
+}
+
+func (e *jsonlEncoder) flush() error {
+	return nil
+}
+
+// csvColumns are the columns of CSV exports.
+var csvColumns = []string{
+	ColumnID, ColumnSchemaID, ColumnState, ColumnTraits, ColumnMetadataPublic, ColumnMetadataAdmin,
+	ColumnHashedPassword, ColumnRoles,
+}
+
+type csvEncoder struct {
+	writer *csv.Writer
+	header bool
+}
+
+func (e *csvEncoder) encode(rec *Record) error {
+	if !e.header {
+		if err := e.writer.Write(csvColumns); err != nil {
+			return err
+		}
+		e.header = true
+	}
+
+	var hash string
+	if cred, ok := rec.Credentials[identity.CredentialsTypePassword]; ok {
+		hash = cred.HashedPassword
+	}
+	return e.writer.Write([]string{
+		rec.ID.String(),
+		rec.SchemaID,
+		string(rec.State),
+		string(rec.Traits),
+		string(rec.MetadataPublic),
+		string(rec.MetadataAdmin),
+		hash,
+		strings.Join(rec.Roles, RoleSeparator),
+	})
+}
+
+func (e *csvEncoder) flush() error {
+	if !e.header {
+		if err := e.writer.Write(csvColumns); err != nil {
+			return err
+		}
+		e.header = true
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
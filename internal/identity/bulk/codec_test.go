@@ -0,0 +1,120 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package bulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/identity"
+)
+
+func decodeAll(t *testing.T, r io.Reader, f Format) []*row {
+	t.Helper()
+	dec, err := newDecoder(r, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []*row
+	for {
+		rw, err := dec.next()
+		if err == io.EOF {
+			return rows
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, rw)
+	}
+}
+
+func TestDecodeCSV(t *testing.T) {
+	input := "id,traits,traits.email,traits.address.city,hashed_password,roles\n" +
+		`,"{""email"":""old@x.io"",""age"":3}",ann@x.io,Berlin,$2a$hash,admin; ops` + "\n" +
+		"not-a-uuid,,bob@x.io,,,\n" +
+		",,carl@x.io\n"
+	rows := decodeAll(t, strings.NewReader(input), FormatCSV)
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+
+	rec := rows[0].record
+	if rows[0].err != nil {
+		t.Fatal(rows[0].err)
+	}
+	var traits map[string]any
+	if err := json.Unmarshal(rec.Traits, &traits); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"email": "ann@x.io", "age": float64(3), "address": map[string]any{"city": "Berlin"}}
+	if !reflect.DeepEqual(traits, want) {
+		t.Errorf("traits = %v, want %v", traits, want)
+	}
+	if cred := rec.Credentials[identity.CredentialsTypePassword]; cred == nil || cred.HashedPassword != "$2a$hash" {
+		t.Errorf("unexpected credentials %+v", rec.Credentials)
+	}
+	if !reflect.DeepEqual(rec.Roles, []string{"admin", "ops"}) {
+		t.Errorf("roles = %q", rec.Roles)
+	}
+
+	for i, rw := range rows[1:] {
+		if rw.err == nil || rw.n != i+2 {
+			t.Errorf("expected an error for row %d, got %+v", i+2, rw)
+		}
+	}
+}
+
+func TestDecodeCSVHeader(t *testing.T) {
+	for _, input := range []string{"", "id,password\n", "traits,nickname\n", "traits,traits\n"} {
+		if _, err := newDecoder(strings.NewReader(input), FormatCSV); !errors.Is(err, ErrInvalidFormat) {
+			t.Errorf("%q: expected ErrInvalidFormat, got %v", input, err)
+		}
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	rec := &Record{
+		ID:       uuid.New(),
+		SchemaID: "default",
+		State:    identity.StateSuspended,
+		Traits:   json.RawMessage(`{"email":"ann@x.io"}`),
+
+		MetadataPublic: json.RawMessage(`{"department":"eng"}`),
+		MetadataAdmin:  json.RawMessage(`{"clearance":"top"}`),
+		Credentials: map[identity.CredentialsType]*CredentialsRecord{
+			identity.CredentialsTypePassword: {HashedPassword: "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$a2V5"},
+		},
+		Roles: []string{"admin", "ops"},
+	}
+
+	for _, f := range []Format{FormatJSONL, FormatCSV} {
+		var buf bytes.Buffer
+		enc, err := newEncoder(&buf, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.encode(rec); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		rows := decodeAll(t, &buf, f)
+		if len(rows) != 1 || rows[0].err != nil {
+			t.Fatalf("%s: unexpected rows %+v", f, rows)
+		}
+		if got := rows[0].record; !reflect.DeepEqual(got, rec) {
+			t.Errorf("%s: got %+v, want %+v", f, got, rec)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package bulk
+
+import "errors"
+
+// ErrInvalidFormat is returned for unknown formats and for input that
+// cannot be read as records at all, such as a CSV file without a header.
+// Malformed records are reported per row instead.
+var ErrInvalidFormat = errors.New("invalid bulk format")
@@ -0,0 +1,151 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package bulk
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/pkg/api"
+	"github.com/coding-hui/iam/pkg/code"
+	"github.com/coding-hui/iam/pkg/filter"
+
+	"github.com/coding-hui/common/errors"
+)
+
+// ExportErrorTrailer is the HTTP trailer that reports an export that
+// failed after its first record was sent.
+const ExportErrorTrailer = "X-Export-Error"
+
+// Handler handles HTTP requests for bulk identity operations.
+type Handler struct {
+	manager Manager
+}
+
+// NewHandler creates a new bulk handler.
+func NewHandler(manager Manager) *Handler {
+	return &Handler{manager: manager}
+}
+
+// Import handles POST /api/v1/identities/import.
+// The body is read as the format named by the format query parameter, or
+// else by the Content-Type header, and defaults to JSON Lines. The
+// batch_size query parameter sets the records per transaction.
+func (h *Handler) Import(c *gin.Context) {
+	name := c.Query("format")
+	if name == "" {
+		if mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type")); err == nil && mediaType == "text/csv" {
+			name = string(FormatCSV)
+		}
+	}
+	format, err := ParseFormat(name)
+	if err != nil {
+		failWithFormatError(err, c)
+		return
+	}
+
+	opts := &ImportOptions{Format: format, NetworkID: networkID(c)}
+	if s := c.Query("batch_size"); s != "" {
+		if opts.BatchSize, err = strconv.Atoi(s); err != nil {
+			api.FailWithMessage("invalid batch_size", c)
+			return
+		}
+	}
+
+	report, err := h.manager.Import(c.Request.Context(), c.Request.Body, opts)
+	if err != nil {
+		failWithFormatError(err, c)
+		return
+	}
+
+	api.OkWithData(report, c)
+}
+
+// Export handles GET /api/v1/identities/export.
+// It streams the identities selected by the filter parameters of
+// GET /api/v1/identities in the format named by the format query
+// parameter, which defaults to JSON Lines. Password hashes and api_key
+// and totp credentials are only exported when the secrets query parameter
+// is true. An error after streaming has
+// started is sent in the ExportErrorTrailer trailer.
+func (h *Handler) Export(c *gin.Context) {
+	format, err := ParseFormat(c.Query("format"))
+	if err != nil {
+		failWithFormatError(err, c)
+		return
+	}
+
+	var secrets bool
+	if s := c.Query("secrets"); s != "" {
+		if secrets, err = strconv.ParseBool(s); err != nil {
+			api.FailWithMessage("invalid secrets", c)
+			return
+		}
+	}
+
+	var params identity.ListIdentitiesParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		api.FailWithMessage("invalid params: "+err.Error(), c)
+		return
+	}
+	for key, values := range c.Request.URL.Query() {
+		if key == "schema_id" || !identity.IsFilterAttribute(key) {
+			continue
+		}
+		if params.Filters == nil {
+			params.Filters = make(map[string]string)
+		}
+		params.Filters[key] = values[0]
+	}
+
+	c.Header("Trailer", ExportErrorTrailer)
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", `attachment; filename="identities.`+string(format)+`"`)
+	err = h.manager.Export(c.Request.Context(), c.Writer, &ExportOptions{
+		Format:    format,
+		NetworkID: networkID(c),
+		Params:    params,
+		Secrets:   secrets,
+	})
+	if err != nil {
+		if c.Writer.Written() {
+			c.Writer.Header().Set(ExportErrorTrailer, err.Error())
+			_ = c.Error(err)
+			return
+		}
+		for _, key := range []string{"Trailer", "Content-Type", "Content-Disposition"} {
+			c.Writer.Header().Del(key)
+		}
+		failWithFormatError(err, c)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// failWithFormatError writes err, attaching its message to format and
+// filter errors.
+func failWithFormatError(err error, c *gin.Context) {
+	switch {
+	case errors.Is(err, ErrInvalidFormat):
+		api.FailWithDetailed(err.Error(), errors.WrapC(err, code.ErrIdentityBulkFormatInvalid, "%s", err.Error()), c)
+	case errors.Is(err, filter.ErrInvalidFilter):
+		api.FailWithDetailed(err.Error(), errors.WrapC(err, code.ErrIdentityFilterInvalid, "%s", err.Error()), c)
+	default:
+		api.FailWithErrCode(err, c)
+	}
+}
+
+func networkID(c *gin.Context) uuid.UUID {
+	networkIDStr := c.GetString("network_id")
+	if networkIDStr == "" {
+		networkIDStr = "00000000-0000-0000-0000-000000000000"
+	}
+	return uuid.MustParse(networkIDStr)
+}
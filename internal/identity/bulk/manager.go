@@ -0,0 +1,430 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package bulk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/authz"
+	"github.com/coding-hui/iam/internal/authz/role"
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/password"
+	"github.com/coding-hui/iam/internal/identity/schema"
+	"github.com/coding-hui/iam/internal/persistence"
+
+	"github.com/coding-hui/common/errors"
+)
+
+// exportPageSize is the number of identities loaded at a time by Export.
+const exportPageSize = 100
+
+// ManagerImpl implements bulk.Manager.
+type ManagerImpl struct {
+	persister  persistence.Persister
+	identities identity.Manager
+	pool       identity.Pool
+	roles      role.PrivilegedPool
+	engine     *authz.Engine
+}
+
+// NewManagerImpl creates a new bulk manager. Identities are written with
+// identities, so their traits are validated and their passwords hashed as
+// for single identities. Role bindings are applied to engine when it is
+// not nil.
+func NewManagerImpl(persister persistence.Persister, identities identity.Manager, pool identity.Pool, roles role.PrivilegedPool, engine *authz.Engine) *ManagerImpl {
+	return &ManagerImpl{
+		persister:  persister,
+		identities: identities,
+		pool:       pool,
+		roles:      roles,
+		engine:     engine,
+	}
+}
+
+// Import reads records from r and creates an identity for each, together
+// with its credentials and role bindings. Records are written in
+// transactions of opts.BatchSize records. A record that fails is rolled
+// back on its own and listed in the report while the rest of its batch is
+// written; only when a batch cannot be committed do all of its records
+// fail. Errors are returned for input that cannot be read on, wrapping
+// ErrInvalidFormat when it is malformed; batches written before stay
+// imported.
+func (m *ManagerImpl) Import(ctx context.Context, r io.Reader, opts *ImportOptions) (*ImportReport, error) {
+	dec, err := newDecoder(r, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	batchSize := opts.BatchSize
+	if batchSize < 1 {
+		batchSize = DefaultBatchSize
+	}
+	batchSize = min(batchSize, MaxBatchSize)
+
+	report := &ImportReport{Errors: []*RowError{}}
+	roles := &roleResolver{pool: m.roles, networkID: opts.NetworkID}
+	for {
+		batch := make([]*row, 0, batchSize)
+		var readErr error
+		for len(batch) < batchSize {
+			rw, err := dec.next()
+			if err != nil {
+				readErr = err
+				break
+			}
+			batch = append(batch, rw)
+		}
+
+		if len(batch) > 0 {
+			report.Total += len(batch)
+			if err := m.importBatch(ctx, batch, roles, report); err != nil {
+				return nil, err
+			}
+		}
+		if readErr == io.EOF {
+			return report, nil
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+}
+
+// importBatch writes the records of batch in one transaction.
+func (m *ManagerImpl) importBatch(ctx context.Context, batch []*row, roles *roleResolver, report *ImportReport) error {
+	type failure struct {
+		row *row
+		err error
+	}
+	var failures []failure
+	var imported []*row
+	var bindings []*role.RoleBinding
+
+	err := m.persister.Transaction(ctx, func(ctx context.Context) error {
+		for _, rw := range batch {
+			if rw.err != nil {
+				failures = append(failures, failure{rw, rw.err})
+				continue
+			}
+			var rowBindings []*role.RoleBinding
+			err := m.persister.Transaction(ctx, func(ctx context.Context) error {
+				var err error
+				rowBindings, err = m.importRecord(ctx, rw.record, roles)
+				return err
+			})
+			if err != nil {
+				failures = append(failures, failure{rw, err})
+				continue
+			}
+			imported = append(imported, rw)
+			bindings = append(bindings, rowBindings...)
+		}
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		for _, rw := range imported {
+			failures = append(failures, failure{rw, err})
+		}
+		imported, bindings = nil, nil
+	}
+
+	sort.Slice(failures, func(i, j int) bool { return failures[i].row.n < failures[j].row.n })
+	for _, f := range failures {
+		report.fail(f.row.n, f.err)
+	}
+	report.Imported += len(imported)
+
+	if m.engine != nil {
+		for _, b := range bindings {
+			m.engine.AddRoleBinding(&authz.RoleBinding{
+				NetworkID: b.NetworkID.String(),
+				Subject:   b.Subject,
+				Role:      b.RoleID.String(),
+			})
+		}
+	}
+	return nil
+}
+
+// importRecord creates the identity of rec and returns its role bindings.
+func (m *ManagerImpl) importRecord(ctx context.Context, rec *Record, roles *roleResolver) ([]*role.RoleBinding, error) {
+	granted, err := roles.resolve(ctx, rec.Roles)
+	if err != nil {
+		return nil, err
+	}
+	if rec.ID != uuid.Nil {
+		if _, err := m.pool.GetIdentity(ctx, rec.ID); err == nil {
+			return nil, fmt.Errorf("identity %s already exists", rec.ID)
+		}
+	}
+
+	req := &identity.CreateIdentityRequest{
+		ID:        rec.ID,
+		Type:      rec.Type,
+		SchemaID:  rec.SchemaID,
+		Traits:    rec.Traits,
+		State:     rec.State,
+		NetworkID: roles.networkID,
+
+		MetadataPublic: rec.MetadataPublic,
+		MetadataAdmin:  rec.MetadataAdmin,
+	}
+	types := make([]identity.CredentialsType, 0, len(rec.Credentials))
+	for t, cred := range rec.Credentials {
+		switch t {
+		case identity.CredentialsTypePassword:
+			if cred == nil || cred.Password == "" && cred.HashedPassword == "" {
+				return nil, errors.New("password credentials need a password or hashed_password")
+			}
+			req.Password, req.HashedPassword = cred.Password, cred.HashedPassword
+		case identity.CredentialsTypeAPIKey, identity.CredentialsTypeTOTP:
+			if cred == nil {
+				return nil, fmt.Errorf("%s credentials are empty", t)
+			}
+			types = append(types, t)
+		default:
+			return nil, fmt.Errorf("unknown credentials type %q", t)
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	created, err := m.identities.CreateIdentity(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range types {
+		cred := rec.Credentials[t]
+		if err := m.identities.AddCredentials(ctx, created.ID, &identity.AddCredentialsRequest{
+			Type:        t,
+			Identifiers: cred.Identifiers,
+			Config:      cred.Config,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	bindings := make([]*role.RoleBinding, len(granted))
+	for i, r := range granted {
+		bindings[i] = &role.RoleBinding{
+			ID:        uuid.New(),
+			NetworkID: r.NetworkID,
+			RoleID:    r.ID,
+			Subject:   created.ID.String(),
+			CreatedAt: time.Now(),
+		}
+		if err := m.roles.CreateRoleBinding(ctx, bindings[i]); err != nil {
+			return nil, err
+		}
+	}
+	return bindings, nil
+}
+
+// Export writes the identities selected by opts.Params to w, including
+// their metadata and the roles granted to them, and their secrets when
+// opts.Secrets is set. Roles are written
+// by name unless the name is ambiguous. Nothing is written when the
+// parameters are invalid.
+func (m *ManagerImpl) Export(ctx context.Context, w io.Writer, opts *ExportOptions) error {
+	enc, err := newEncoder(w, opts.Format)
+	if err != nil {
+		return err
+	}
+
+	params := opts.Params
+	params.PageSize = exportPageSize
+	params.Page = 1
+	page, _, err := m.identities.ListIdentities(ctx, opts.NetworkID, params)
+	if err != nil {
+		return err
+	}
+
+	roles := &roleResolver{pool: m.roles, networkID: opts.NetworkID}
+	granted, err := roles.bindings(ctx)
+	if err != nil {
+		return err
+	}
+
+	for len(page) > 0 {
+		for _, ident := range page {
+			full, err := m.pool.GetIdentityWithCredentials(ctx, ident.ID)
+			if err != nil {
+				return err
+			}
+			if err := enc.encode(exportRecord(full, granted[full.ID.String()], opts.Secrets)); err != nil {
+				return err
+			}
+		}
+		if len(page) < exportPageSize {
+			break
+		}
+
+		params.Page++
+		if page, _, err = m.identities.ListIdentities(ctx, opts.NetworkID, params); err != nil {
+			return err
+		}
+	}
+	return enc.flush()
+}
+
+// exportRecord converts an identity with its credentials to a Record.
+// Password, api_key and totp credentials are only converted with secrets.
+func exportRecord(ident *identity.Identity, roles []string, secrets bool) *Record {
+	rec := &Record{
+		ID:             ident.ID,
+		Type:           ident.Type,
+		SchemaID:       ident.SchemaID,
+		State:          ident.State,
+		Traits:         ident.Traits,
+		MetadataPublic: ident.MetadataPublic,
+		MetadataAdmin:  ident.MetadataAdmin,
+		Roles:          roles,
+	}
+	for t, cred := range ident.Credentials {
+		if !secrets && isSecret(t) {
+			continue
+		}
+		if rec.Credentials == nil {
+			rec.Credentials = make(map[identity.CredentialsType]*CredentialsRecord, len(ident.Credentials))
+		}
+		if t == identity.CredentialsTypePassword {
+			rec.Credentials[t] = &CredentialsRecord{HashedPassword: string(cred.Config)}
+			continue
+		}
+		rec.Credentials[t] = &CredentialsRecord{Identifiers: cred.Identifiers, Config: cred.Config}
+	}
+	return rec
+}
+
+// isSecret reports whether credentials of type t are secrets: a password
+// hash, or the key material in the config of api_key and totp credentials.
+func isSecret(t identity.CredentialsType) bool {
+	switch t {
+	case identity.CredentialsTypePassword, identity.CredentialsTypeAPIKey, identity.CredentialsTypeTOTP:
+		return true
+	}
+	return false
+}
+
+// fail records a failed row.
+func (r *ImportReport) fail(n int, err error) {
+	r.Failed++
+	if len(r.Errors) >= MaxReportedErrors {
+		return
+	}
+	e := &RowError{Row: n, Message: err.Error()}
+	var verr *schema.ValidationError
+	if errors.As(err, &verr) {
+		e.Errors = verr.Errors
+	}
+	var perr *password.PolicyError
+	if errors.As(err, &perr) {
+		e.Violations = perr.Violations
+	}
+	r.Errors = append(r.Errors, e)
+}
+
+// roleResolver looks up the roles of a network by ID or name.
+type roleResolver struct {
+	pool      role.Pool
+	networkID uuid.UUID
+	roles     []*role.Role
+	loaded    bool
+}
+
+func (r *roleResolver) load(ctx context.Context) error {
+	if r.loaded {
+		return nil
+	}
+	roles, _, err := r.pool.ListRoles(ctx, r.networkID, -1, 0)
+	if err != nil {
+		return err
+	}
+	r.roles, r.loaded = roles, true
+	return nil
+}
+
+// resolve returns the roles named by refs, which are role IDs or names,
+// without duplicates.
+func (r *roleResolver) resolve(ctx context.Context, refs []string) ([]*role.Role, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	if err := r.load(ctx); err != nil {
+		return nil, err
+	}
+
+	resolved := make([]*role.Role, 0, len(refs))
+	for _, ref := range refs {
+		var byID, byName []*role.Role
+		for _, candidate := range r.roles {
+			if candidate.ID.String() == ref {
+				byID = append(byID, candidate)
+			} else if candidate.Name == ref {
+				byName = append(byName, candidate)
+			}
+		}
+		var found *role.Role
+		switch {
+		case len(byID) == 1:
+			found = byID[0]
+		case len(byName) == 1:
+			found = byName[0]
+		case len(byName) > 1:
+			return nil, fmt.Errorf("role name %q is ambiguous", ref)
+		default:
+			return nil, fmt.Errorf("unknown role %q", ref)
+		}
+		if !slices.Contains(resolved, found) {
+			resolved = append(resolved, found)
+		}
+	}
+	return resolved, nil
+}
+
+// bindings returns the roles granted per subject, by name unless the name
+// is ambiguous.
+func (r *roleResolver) bindings(ctx context.Context) (map[string][]string, error) {
+	if err := r.load(ctx); err != nil {
+		return nil, err
+	}
+	bindings, err := r.pool.ListRoleBindings(ctx, r.networkID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]int, len(r.roles))
+	for _, ro := range r.roles {
+		names[ro.Name]++
+	}
+	refs := make(map[uuid.UUID]string, len(r.roles))
+	for _, ro := range r.roles {
+		refs[ro.ID] = ro.ID.String()
+		if ro.Name != "" && names[ro.Name] == 1 {
+			refs[ro.ID] = ro.Name
+		}
+	}
+
+	granted := make(map[string][]string)
+	for _, b := range bindings {
+		if ref, ok := refs[b.RoleID]; ok {
+			granted[b.Subject] = append(granted[b.Subject], ref)
+		}
+	}
+	for _, roles := range granted {
+		sort.Strings(roles)
+	}
+	return granted, nil
+}
+
+var _ Manager = (*ManagerImpl)(nil)
@@ -0,0 +1,165 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/authz/role"
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// persister runs transactions without a database.
+type persister struct {
+	persistence.Persister
+}
+
+func (persister) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// identities keeps created identities in memory.
+type identities struct {
+	identity.Manager
+	created []*identity.Identity
+}
+
+func (m *identities) CreateIdentity(_ context.Context, req *identity.CreateIdentityRequest) (*identity.Identity, error) {
+	i := &identity.Identity{
+		ID:        uuid.New(),
+		NetworkID: req.NetworkID,
+		Type:      req.Type,
+		SchemaID:  req.SchemaID,
+		Traits:    req.Traits,
+		State:     req.State,
+
+		MetadataPublic: req.MetadataPublic,
+		MetadataAdmin:  req.MetadataAdmin,
+	}
+	m.created = append(m.created, i)
+	return i, nil
+}
+
+func (m *identities) ListIdentities(_ context.Context, networkID uuid.UUID, _ identity.ListIdentitiesParams) ([]*identity.Identity, int, error) {
+	var list []*identity.Identity
+	for _, i := range m.created {
+		if i.NetworkID == networkID {
+			list = append(list, i)
+		}
+	}
+	return list, len(list), nil
+}
+
+func TestImportNetwork(t *testing.T) {
+	ctx := context.Background()
+	networkID := uuid.New()
+	idents := &identities{}
+	m := NewManagerImpl(persister{}, idents, nil, nil, nil)
+
+	input := `{"schema_id":"default","traits":{"email":"ann@x.io"}}` + "\n"
+	report, err := m.Import(ctx, strings.NewReader(input), &ImportOptions{Format: FormatJSONL, NetworkID: networkID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 1 {
+		t.Fatalf("Import() = %+v, want 1 imported", report)
+	}
+
+	list, _, err := idents.ListIdentities(ctx, networkID, identity.ListIdentitiesParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || string(list[0].Traits) != `{"email":"ann@x.io"}` {
+		t.Errorf("ListIdentities(network) = %v, want the imported identity", list)
+	}
+	if list, _, _ := idents.ListIdentities(ctx, uuid.Nil, identity.ListIdentitiesParams{}); len(list) != 0 {
+		t.Errorf("ListIdentities(nil network) = %v, want none", list)
+	}
+}
+
+// identityPool returns the identities created in identities.
+type identityPool struct {
+	identity.Pool
+	identities *identities
+}
+
+func (p identityPool) GetIdentityWithCredentials(_ context.Context, id uuid.UUID) (*identity.Identity, error) {
+	for _, i := range p.identities.created {
+		if i.ID == id {
+			return i, nil
+		}
+	}
+	return nil, identity.ErrIdentityNotFound
+}
+
+// roles holds no roles.
+type roles struct {
+	role.PrivilegedPool
+}
+
+func (roles) ListRoles(context.Context, uuid.UUID, int, int) ([]*role.Role, int, error) {
+	return nil, 0, nil
+}
+
+func (roles) ListRoleBindings(context.Context, uuid.UUID) ([]*role.RoleBinding, error) {
+	return nil, nil
+}
+
+func TestExportSecrets(t *testing.T) {
+	ctx := context.Background()
+	networkID := uuid.New()
+	idents := &identities{}
+	m := NewManagerImpl(persister{}, idents, identityPool{identities: idents}, roles{}, nil)
+
+	input := `{"schema_id":"default","traits":{"email":"ann@x.io"},"metadata_public":{"department":"eng"},"metadata_admin":{"clearance":"top"}}` + "\n"
+	if _, err := m.Import(ctx, strings.NewReader(input), &ImportOptions{Format: FormatJSONL, NetworkID: networkID}); err != nil {
+		t.Fatal(err)
+	}
+	idents.created[0].Credentials = map[identity.CredentialsType]*identity.Credentials{
+		identity.CredentialsTypePassword: {Config: json.RawMessage(`$argon2id$hash`)},
+		identity.CredentialsTypeAPIKey:   {Identifiers: []string{"key-1"}, Config: json.RawMessage(`{"hash":"secret"}`)},
+		identity.CredentialsTypeTOTP:     {Config: json.RawMessage(`{"secret":"JBSWY3DP"}`)},
+		identity.CredentialsTypeOIDC:     {Identifiers: []string{"google:ann"}},
+	}
+
+	export := func(secrets bool) *Record {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := m.Export(ctx, &buf, &ExportOptions{Format: FormatJSONL, NetworkID: networkID, Secrets: secrets}); err != nil {
+			t.Fatal(err)
+		}
+		rec := &Record{}
+		if err := json.Unmarshal(buf.Bytes(), rec); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	rec := export(false)
+	if string(rec.MetadataPublic) != `{"department":"eng"}` || string(rec.MetadataAdmin) != `{"clearance":"top"}` {
+		t.Errorf("exported metadata %s and %s, want the imported metadata", rec.MetadataPublic, rec.MetadataAdmin)
+	}
+	if len(rec.Credentials) != 1 || rec.Credentials[identity.CredentialsTypeOIDC] == nil {
+		t.Errorf("exported credentials %v without secrets, want only oidc", rec.Credentials)
+	}
+
+	rec = export(true)
+	if len(rec.Credentials) != 4 {
+		t.Fatalf("exported credentials %v with secrets, want all of them", rec.Credentials)
+	}
+	if got := rec.Credentials[identity.CredentialsTypePassword].HashedPassword; got != "$argon2id$hash" {
+		t.Errorf("exported password hash %q, want $argon2id$hash", got)
+	}
+	if got := string(rec.Credentials[identity.CredentialsTypeTOTP].Config); got != `{"secret":"JBSWY3DP"}` {
+		t.Errorf("exported totp config %s", got)
+	}
+}
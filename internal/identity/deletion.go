@@ -0,0 +1,170 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultDeletionGracePeriod is how long deleted identities are kept
+	// before they are purged.
+	DefaultDeletionGracePeriod = 30 * 24 * time.Hour
+	// DefaultPurgeInterval is how often deleted identities are purged.
+	DefaultPurgeInterval = time.Hour
+
+	// purgeBatchSize is the number of identities purged per query.
+	purgeBatchSize = 100
+)
+
+// SetDeletionGracePeriod sets how long deleted identities can be restored
+// before PurgeDeletedIdentities deletes them for good. The manager starts
+// with DefaultDeletionGracePeriod.
+func (m *ManagerImpl) SetDeletionGracePeriod(d time.Duration) {
+	m.deletionGracePeriod = d
+}
+
+// DeleteIdentity marks an identity of req.NetworkID as deleted and revokes
+// its sessions and tokens. The identity disappears from all reads and
+// cannot authenticate, but keeps its identifiers until it is purged.
+func (m *ManagerImpl) DeleteIdentity(ctx context.Context, id uuid.UUID, req *DeleteIdentityRequest) error {
+	identity, err := m.pool.GetIdentityByNetworkID(ctx, req.NetworkID, id)
+	if err != nil {
+		return notFoundError(err)
+	}
+
+	now := time.Now()
+	if err := m.privPool.DeleteIdentity(ctx, req.NetworkID, id, now); err != nil {
+		return err
+	}
+	identity.DeletedAt = &now
+
+	for _, revoke := range m.lifecycle.Revokers {
+		if err := revoke(ctx, identity.ID); err != nil {
+			return err
+		}
+	}
+
+	return m.recordEvent(ctx, identity, EventIdentityDeleted, req.origin(), map[string]any{
+		"purge_after": now.Add(m.deletionGracePeriod),
+	})
+}
+
+// RestoreIdentity undoes the deletion of an identity of req.NetworkID that
+// has not been purged yet. Revoked sessions and tokens stay revoked.
+func (m *ManagerImpl) RestoreIdentity(ctx context.Context, id uuid.UUID, req *DeleteIdentityRequest) (*Identity, error) {
+	if err := m.privPool.RestoreIdentity(ctx, req.NetworkID, id); err != nil {
+		return nil, err
+	}
+	identity, err := m.pool.GetIdentity(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.recordEvent(ctx, identity, EventIdentityRestored, req.origin(), nil); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// PurgeIdentity deletes an identity of req.NetworkID for good right away,
+// skipping the grace period. The identity may have been deleted before.
+func (m *ManagerImpl) PurgeIdentity(ctx context.Context, id uuid.UUID, req *DeleteIdentityRequest) error {
+	identity, err := m.pool.GetIdentity(ctx, id)
+	if errors.Is(notFoundError(err), ErrIdentityNotFound) {
+		identity, err = m.pool.GetDeletedIdentity(ctx, id)
+	}
+	if err != nil {
+		return notFoundError(err)
+	}
+	if identity.NetworkID != req.NetworkID {
+		return ErrIdentityNotFound
+	}
+	if err := m.purgeIdentity(ctx, identity, req.origin()); err != nil {
+		return err
+	}
+	return m.runPurgers(ctx, map[uuid.UUID]bool{identity.NetworkID: true})
+}
+
+// PurgeDeletedIdentities deletes identities whose grace period has passed
+// for good, together with their credentials, sessions, tokens, role
+// bindings and secret keys. Each purge leaves a tombstone in the audit
+// trail that holds no traits. Identities that cannot be purged are
+// skipped; their errors are joined in the returned error. It returns the
+// number of purged identities.
+func (m *ManagerImpl) PurgeDeletedIdentities(ctx context.Context) (int, error) {
+	before := time.Now().Add(-m.deletionGracePeriod)
+	purged := 0
+	var errs []error
+	for {
+		// Identities that failed stay deleted and are listed first.
+		skipped := len(errs)
+		batch, err := m.privPool.ListIdentitiesDeletedBefore(ctx, before, purgeBatchSize, skipped)
+		if err != nil {
+			return purged, errors.Join(append(errs, err)...)
+		}
+		networks := make(map[uuid.UUID]bool)
+		for _, identity := range batch {
+			if err := m.purgeIdentity(ctx, identity, &eventOrigin{actorType: "system"}); err != nil {
+				errs = append(errs, fmt.Errorf("purge identity %s: %w", identity.ID, err))
+				continue
+			}
+			networks[identity.NetworkID] = true
+			purged++
+		}
+		if err := m.runPurgers(ctx, networks); err != nil {
+			return purged, errors.Join(append(errs, err)...)
+		}
+		if len(batch) < purgeBatchSize {
+			return purged, errors.Join(errs...)
+		}
+	}
+}
+
+// purgeIdentity deletes an identity for good and leaves a tombstone in the
+// audit trail, in one transaction.
+func (m *ManagerImpl) purgeIdentity(ctx context.Context, identity *Identity, origin *eventOrigin) error {
+	metadata := map[string]any{
+		"schema_id":  identity.SchemaID,
+		"created_at": identity.CreatedAt,
+		"deleted_at": identity.DeletedAt,
+	}
+	if err := m.persister.Transaction(ctx, func(ctx context.Context) error {
+		if err := m.privPool.PurgeIdentity(ctx, identity.ID); err != nil {
+			return err
+		}
+		return m.recordAudit(ctx, identity, EventIdentityPurged, origin, metadata)
+	}); err != nil {
+		return err
+	}
+	return m.sendEvent(ctx, identity, EventIdentityPurged, origin, metadata)
+}
+
+// runPurgers runs the purgers for every network in networks.
+func (m *ManagerImpl) runPurgers(ctx context.Context, networks map[uuid.UUID]bool) error {
+	for networkID := range networks {
+		for _, purge := range m.lifecycle.Purgers {
+			if err := purge(ctx, networkID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *DeleteIdentityRequest) origin() *eventOrigin {
+	return &eventOrigin{
+		actorID:   r.ActorID,
+		actorType: "admin",
+		clientIP:  r.ClientIP,
+		userAgent: r.UserAgent,
+		requestID: r.RequestID,
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/audit"
+	"github.com/coding-hui/iam/internal/identity/schema"
+	"github.com/coding-hui/iam/internal/persistence/sql"
+)
+
+// failingAudit records events, failing the purge of one identity.
+type failingAudit struct {
+	audit.Manager
+	failPurgeOf uuid.UUID
+}
+
+func (a *failingAudit) RecordEvent(ctx context.Context, req *audit.RecordEventRequest) error {
+	if req.Type == EventIdentityPurged && req.TargetID == a.failPurgeOf {
+		return errors.New("audit trail unavailable")
+	}
+	return a.Manager.RecordEvent(ctx, req)
+}
+
+func createStaff(t *testing.T, m *ManagerImpl, schemas schema.Manager, emails ...string) []*Identity {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := schemas.CreateSchema(ctx, &schema.CreateSchemaRequest{ID: "staff", JSONSchema: emailSchema("email")}); err != nil {
+		t.Fatal(err)
+	}
+	identities := make([]*Identity, len(emails))
+	for i, email := range emails {
+		identity, err := m.CreateIdentity(ctx, &CreateIdentityRequest{SchemaID: "staff", Traits: json.RawMessage(`{"email":"` + email + `"}`), Password: "correct-horse-battery-9"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		identities[i] = identity
+	}
+	return identities
+}
+
+func TestDeleteAndRestoreIdentity(t *testing.T) {
+	ctx := context.Background()
+	m, schemas, _ := newTestManager(t)
+	ann := createStaff(t, m, schemas, "ann@example.com")[0]
+	req := &DeleteIdentityRequest{NetworkID: ann.NetworkID}
+
+	if err := m.DeleteIdentity(ctx, ann.ID, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetIdentity(ctx, ann.ID); !errors.Is(notFoundError(err), ErrIdentityNotFound) {
+		t.Errorf("GetIdentity() of a deleted identity error = %v, want ErrIdentityNotFound", err)
+	}
+	if _, err := m.CreateIdentity(ctx, &CreateIdentityRequest{SchemaID: "staff", Traits: json.RawMessage(`{"email":"ann@example.com"}`), Password: "correct-horse-battery-9"}); !errors.Is(err, ErrIdentifierInUse) {
+		t.Errorf("CreateIdentity() with the identifier of a deleted identity error = %v, want ErrIdentifierInUse", err)
+	}
+
+	restored, err := m.RestoreIdentity(ctx, ann.ID, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.DeletedAt != nil {
+		t.Errorf("restored identity deleted at %v", restored.DeletedAt)
+	}
+	if _, err := m.GetIdentity(ctx, ann.ID); err != nil {
+		t.Errorf("GetIdentity() of a restored identity error = %v", err)
+	}
+	if _, err := m.RestoreIdentity(ctx, ann.ID, req); err == nil {
+		t.Error("RestoreIdentity() of an identity that is not deleted succeeded")
+	}
+}
+
+func TestPurgeDeletedIdentities(t *testing.T) {
+	ctx := context.Background()
+	m, schemas, _ := newTestManager(t)
+	p := m.persister.(*sql.Persister)
+	auditPool := sql.NewAuditPool(p)
+	identities := createStaff(t, m, schemas, "ann@example.com", "bob@example.com", "carol@example.com")
+	ann, bob := identities[0], identities[1]
+
+	var reloads []uuid.UUID
+	m.SetLifecycleHooks(LifecycleHooks{
+		Purgers: []PurgeFunc{func(_ context.Context, networkID uuid.UUID) error {
+			reloads = append(reloads, networkID)
+			return nil
+		}},
+		Audit: &failingAudit{Manager: audit.NewManagerImpl(audit.NewPool(auditPool), audit.NewRecorder(auditPool)), failPurgeOf: bob.ID},
+	})
+	m.SetDeletionGracePeriod(0)
+	for _, identity := range identities {
+		if err := m.DeleteIdentity(ctx, identity.ID, &DeleteIdentityRequest{NetworkID: identity.NetworkID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purged, err := m.PurgeDeletedIdentities(ctx)
+	if purged != 2 || err == nil {
+		t.Fatalf("PurgeDeletedIdentities() = %d, %v; want 2 and the failure of bob", purged, err)
+	}
+	if len(reloads) != 1 || reloads[0] != ann.NetworkID {
+		t.Errorf("purgers ran for %v, want the network once", reloads)
+	}
+
+	if _, err := m.pool.GetDeletedIdentity(ctx, ann.ID); !errors.Is(notFoundError(err), ErrIdentityNotFound) {
+		t.Errorf("GetDeletedIdentity() of a purged identity error = %v, want ErrIdentityNotFound", err)
+	}
+	// The purge of bob is rolled back with its tombstone.
+	if _, err := m.pool.GetDeletedIdentity(ctx, bob.ID); err != nil {
+		t.Errorf("GetDeletedIdentity() of a failed purge error = %v", err)
+	}
+	events, _, err := m.lifecycle.Audit.ListEventsBySubject(ctx, ann.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 || events[0].Type != EventIdentityPurged {
+		t.Errorf("no tombstone of a purged identity in %+v", events)
+	}
+	if events, _, _ := m.lifecycle.Audit.ListEventsBySubject(ctx, bob.ID, 10, 0); len(events) > 0 && events[0].Type == EventIdentityPurged {
+		t.Error("tombstone of an identity that was not purged")
+	}
+
+	m.lifecycle.Audit.(*failingAudit).failPurgeOf = uuid.Nil
+	if purged, err := m.PurgeDeletedIdentities(ctx); purged != 1 || err != nil {
+		t.Errorf("PurgeDeletedIdentities() after the failure = %d, %v; want 1", purged, err)
+	}
+}
@@ -21,4 +21,34 @@ var (
 
 	// ErrIdentityAlreadyExists is returned when an identity already exists.
 	ErrIdentityAlreadyExists = errors.New("identity already exists")
+
+	// ErrIdentifierInUse is returned when a credentials identifier belongs
+	// to another identity.
+	ErrIdentifierInUse = errors.New("identifier is already in use")
+
+	// ErrNoIdentifiers is returned when credentials would have no identifier.
+	ErrNoIdentifiers = errors.New("credentials have no identifiers")
+
+	// ErrVersionConflict is returned when a version number of an identity
+	// was taken by a concurrent change.
+	ErrVersionConflict = errors.New("identity version conflict")
+
+	// ErrInvalidStateTransition is returned when an identity cannot move
+	// to the requested state.
+	ErrInvalidStateTransition = errors.New("invalid identity state transition")
+
+	// ErrIdentityInactive is returned when an identity that is not active
+	// tries to authenticate.
+	ErrIdentityInactive = errors.New("identity is not active")
+
+	// ErrLastCredentials is returned when removing credentials would leave
+	// an identity without a way to log in.
+	ErrLastCredentials = errors.New("cannot remove the last credentials of an identity")
+
+	// ErrAddressNotFound is returned when a verifiable address is not found.
+	ErrAddressNotFound = errors.New("verifiable address not found")
+
+	// ErrPasswordNotAllowed is returned when a password is set on a
+	// service account.
+	ErrPasswordNotAllowed = errors.New("service accounts cannot have a password")
 )
@@ -6,19 +6,22 @@ package identity
 
 // Identity events.
 const (
-	EventIdentityCreated    = "identity.created"
-	EventIdentityUpdated    = "identity.updated"
-	EventIdentityDeleted    = "identity.deleted"
-	EventCredentialsAdded   = "credentials.added"
-	EventCredentialsDeleted = "credentials.deleted"
+	EventIdentityCreated      = "identity.created"
+	EventIdentityUpdated      = "identity.updated"
+	EventIdentityDeleted      = "identity.deleted"
+	EventIdentityRestored     = "identity.restored"
+	EventIdentityPurged       = "identity.purged"
+	EventIdentityStateChanged = "identity.state_changed"
+	EventCredentialsAdded     = "credentials.added"
+	EventCredentialsDeleted   = "credentials.deleted"
 )
 
 // IdentityEvent represents an identity-related event.
 type IdentityEvent struct {
-	Type       string
-	IdentityID string
-	NetworkID  string
-	ActorID    string
-	Outcome    string
-	Metadata   map[string]any
+	Type       string         `json:"type"`
+	IdentityID string         `json:"identity_id"`
+	NetworkID  string         `json:"network_id"`
+	ActorID    string         `json:"actor_id"`
+	Outcome    string         `json:"outcome"`
+	Metadata   map[string]any `json:"metadata,omitempty"`
 }
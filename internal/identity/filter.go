@@ -0,0 +1,176 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coding-hui/iam/pkg/filter"
+)
+
+// ListFilter selects and orders identities in Pool.ListIdentities.
+type ListFilter struct {
+	SchemaID string
+	// Where is an expression over canonical attributes, see NewListFilter.
+	Where *filter.Expr
+	// SortBy is a canonical attribute; identities are ordered by
+	// descending creation time when it is empty.
+	SortBy   string
+	SortDesc bool
+	// Deleted selects deleted identities instead of live ones.
+	Deleted bool
+}
+
+// filterAliases maps shorthand attributes to traits of the default schema.
+var filterAliases = map[string]string{
+	"email":    "traits.email",
+	"name":     "traits.name",
+	"username": "traits.username",
+	"phone":    "traits.phone",
+}
+
+// Filter attribute kinds.
+const (
+	attrString = iota
+	attrNumber
+	attrTime
+	attrTraits
+)
+
+// filterAttributes maps canonical attributes other than traits to their kind.
+var filterAttributes = map[string]int{
+	"id":                     attrString,
+	"type":                   attrString,
+	"schema_id":              attrString,
+	"schema_version":         attrNumber,
+	"state":                  attrString,
+	"created_at":             attrTime,
+	"updated_at":             attrTime,
+	"credentials.type":       attrString,
+	"credentials.identifier": attrString,
+}
+
+// canonicalAttr resolves aliases and reports the kind of an attribute.
+func canonicalAttr(attr string) (string, int, bool) {
+	if alias, ok := filterAliases[attr]; ok {
+		attr = alias
+	}
+	if kind, ok := filterAttributes[attr]; ok {
+		return attr, kind, true
+	}
+	if path, ok := strings.CutPrefix(attr, "traits."); ok && path != "" {
+		return attr, attrTraits, true
+	}
+	return "", 0, false
+}
+
+// IsFilterAttribute reports whether attr can be used in identity filters.
+func IsFilterAttribute(attr string) bool {
+	_, _, ok := canonicalAttr(attr)
+	return ok
+}
+
+// NewListFilter builds the filter of a list request. params.Filter is a
+// filter expression (see package filter) over the attributes id,
+// schema_id, schema_version, state, created_at, updated_at,
+// credentials.type, credentials.identifier and traits.<path>; email, name,
+// username and phone are shorthands for the traits of the same name.
+// Timestamps are RFC 3339 strings or dates. params.Filters adds equality
+// conditions and params.Sort names an attribute to order by, prefixed
+// with - for descending order. Errors wrap filter.ErrInvalidFilter.
+func NewListFilter(params ListIdentitiesParams) (*ListFilter, error) {
+	f := &ListFilter{SchemaID: params.SchemaID, Deleted: params.Deleted}
+
+	var where *filter.Expr
+	if strings.TrimSpace(params.Filter) != "" {
+		e, err := filter.Parse(params.Filter)
+		if err != nil {
+			return nil, err
+		}
+		where = e
+	}
+	attrs := make([]string, 0, len(params.Filters))
+	for attr := range params.Filters {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+	for _, attr := range attrs {
+		where = filter.AllOf(where, &filter.Expr{Op: filter.Eq, Attr: attr, Value: params.Filters[attr]})
+	}
+	if where != nil {
+		if err := where.Walk(normalizeComparison); err != nil {
+			return nil, err
+		}
+		f.Where = where
+	}
+
+	if params.Sort != "" {
+		by, desc := strings.CutPrefix(params.Sort, "-")
+		attr, _, ok := canonicalAttr(by)
+		if !ok || strings.HasPrefix(attr, "credentials.") {
+			return nil, fmt.Errorf("%w: cannot sort by %q", filter.ErrInvalidFilter, by)
+		}
+		f.SortBy, f.SortDesc = attr, desc
+	}
+	return f, nil
+}
+
+// normalizeComparison resolves the attribute of a comparison and converts
+// its value to the attribute's type.
+func normalizeComparison(e *filter.Expr) error {
+	attr, kind, ok := canonicalAttr(e.Attr)
+	if !ok {
+		return fmt.Errorf("%w: unknown attribute %q", filter.ErrInvalidFilter, e.Attr)
+	}
+	e.Attr = attr
+	if e.Op == filter.Pr || kind == attrTraits {
+		return nil
+	}
+
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s: %s", filter.ErrInvalidFilter, attr, fmt.Sprintf(format, args...))
+	}
+	switch kind {
+	case attrString:
+		if _, ok := e.Value.(string); !ok {
+			return invalid("value must be a string")
+		}
+	case attrNumber:
+		if _, ok := e.Value.(json.Number); !ok {
+			return invalid("value must be a number")
+		}
+		if e.Op == filter.Co || e.Op == filter.Sw || e.Op == filter.Ew {
+			return invalid("%s requires a string attribute", e.Op)
+		}
+	case attrTime:
+		s, ok := e.Value.(string)
+		if !ok {
+			return invalid("value must be an RFC 3339 timestamp")
+		}
+		if e.Op == filter.Co || e.Op == filter.Sw || e.Op == filter.Ew {
+			return invalid("%s requires a string attribute", e.Op)
+		}
+		t, err := parseFilterTime(s)
+		if err != nil {
+			return invalid("value must be an RFC 3339 timestamp")
+		}
+		e.Value = t
+	}
+	return nil
+}
+
+// parseFilterTime parses an RFC 3339 timestamp or a date. Timestamps are
+// converted to the local time zone in which identities are stored.
+func parseFilterTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		t, err = time.ParseInLocation(time.DateOnly, s, time.Local)
+	}
+	return t.Local(), err
+}
@@ -5,12 +5,16 @@
 package identity
 
 import (
-	"errors"
-
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"github.com/coding-hui/iam/internal/identity/password"
+	"github.com/coding-hui/iam/internal/identity/schema"
 	"github.com/coding-hui/iam/pkg/api"
+	"github.com/coding-hui/iam/pkg/code"
+	"github.com/coding-hui/iam/pkg/filter"
+
+	"github.com/coding-hui/common/errors"
 )
 
 // Handler handles HTTP requests for identity operations.
@@ -30,16 +34,37 @@ func (h *Handler) Create(c *gin.Context) {
 		api.FailWithMessage("invalid request: "+err.Error(), c)
 		return
 	}
+	req.ActorID, req.RequestID = origin(c)
+	if networkID, err := uuid.Parse(c.GetString("network_id")); err == nil {
+		req.NetworkID = networkID
+	}
 
 	identity, err := h.manager.CreateIdentity(c.Request.Context(), &req)
 	if err != nil {
-		api.FailWithErrCode(err, c)
+		failWithViolations(err, c)
 		return
 	}
 
 	api.OkWithData(identity, c)
 }
 
+// failWithViolations writes err and, for schema violations, the list of
+// offending fields or, for password policy violations, the list of
+// violated rules.
+func failWithViolations(err error, c *gin.Context) {
+	var verr *schema.ValidationError
+	if errors.As(err, &verr) {
+		api.FailWithDetailed(verr.Errors, err, c)
+		return
+	}
+	var perr *password.PolicyError
+	if errors.As(err, &perr) {
+		api.FailWithDetailed(perr.Violations, err, c)
+		return
+	}
+	api.FailWithErrCode(err, c)
+}
+
 // Get handles GET /api/v1/identities/:id.
 func (h *Handler) Get(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
@@ -61,13 +86,25 @@ func (h *Handler) Get(c *gin.Context) {
 	api.OkWithData(identity, c)
 }
 
-// List handles GET /api/v1/identities.
+// List handles GET /api/v1/identities. Besides filter and sort, query
+// parameters named after filter attributes, such as email or
+// traits.department, select identities with equal values; deleted=true
+// lists deleted identities instead.
 func (h *Handler) List(c *gin.Context) {
 	var params ListIdentitiesParams
 	if err := c.ShouldBindQuery(&params); err != nil {
 		api.FailWithMessage("invalid params: "+err.Error(), c)
 		return
 	}
+	for key, values := range c.Request.URL.Query() {
+		if key == "schema_id" || !IsFilterAttribute(key) {
+			continue
+		}
+		if params.Filters == nil {
+			params.Filters = make(map[string]string)
+		}
+		params.Filters[key] = values[0]
+	}
 
 	networkIDStr := c.GetString("network_id")
 	if networkIDStr == "" {
@@ -77,6 +114,10 @@ func (h *Handler) List(c *gin.Context) {
 
 	identities, total, err := h.manager.ListIdentities(c.Request.Context(), networkID, params)
 	if err != nil {
+		if errors.Is(err, filter.ErrInvalidFilter) {
+			api.FailWithDetailed(err.Error(), errors.WrapC(err, code.ErrIdentityFilterInvalid, "%s", err.Error()), c)
+			return
+		}
 		api.FailWithErrCode(err, c)
 		return
 	}
@@ -97,17 +138,51 @@ func (h *Handler) Update(c *gin.Context) {
 		api.FailWithMessage("invalid request: "+err.Error(), c)
 		return
 	}
+	req.ActorID, req.RequestID = origin(c)
 
 	identity, err := h.manager.UpdateIdentity(c.Request.Context(), id, &req)
 	if err != nil {
-		api.FailWithErrCode(err, c)
+		failWithViolations(err, c)
 		return
 	}
 
 	api.OkWithData(identity, c)
 }
 
-// Delete handles DELETE /api/v1/identities/:id.
+// History handles GET /api/v1/identities/:id/history.
+// It lists the versions of an identity, newest first, each with the JSON
+// patch from the version before it.
+func (h *Handler) History(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return
+	}
+
+	versions, err := h.manager.ListHistory(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrIdentityNotFound) {
+			api.FailWithMessage(err.Error(), c)
+			return
+		}
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithPage(versions, int64(len(versions)), c)
+}
+
+// origin returns the actor and request ID of a request.
+func origin(c *gin.Context) (uuid.UUID, string) {
+	actorID, err := uuid.Parse(c.GetString("identity_id"))
+	if err != nil {
+		actorID = uuid.Nil
+	}
+	return actorID, c.GetHeader("X-Request-ID")
+}
+
+// Delete handles DELETE /api/v1/identities/:id. The identity can be
+// restored until it is purged.
 func (h *Handler) Delete(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -115,7 +190,11 @@ func (h *Handler) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.manager.DeleteIdentity(c.Request.Context(), id); err != nil {
+	if err := h.manager.DeleteIdentity(c.Request.Context(), id, deleteRequest(c)); err != nil {
+		if errors.Is(err, ErrIdentityNotFound) {
+			api.FailWithMessage(err.Error(), c)
+			return
+		}
 		api.FailWithErrCode(err, c)
 		return
 	}
@@ -123,6 +202,76 @@ func (h *Handler) Delete(c *gin.Context) {
 	api.Ok(c)
 }
 
+// Restore handles POST /api/v1/identities/:id/restore.
+func (h *Handler) Restore(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return
+	}
+
+	identity, err := h.manager.RestoreIdentity(c.Request.Context(), id, deleteRequest(c))
+	if err != nil {
+		if errors.Is(err, ErrIdentityNotFound) {
+			api.FailWithMessage(err.Error(), c)
+			return
+		}
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(identity, c)
+}
+
+// deleteRequest returns the network and origin of a deletion or restore.
+func deleteRequest(c *gin.Context) *DeleteIdentityRequest {
+	req := &DeleteIdentityRequest{
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		RequestID: c.GetHeader("X-Request-ID"),
+	}
+	if networkID, err := uuid.Parse(c.GetString("network_id")); err == nil {
+		req.NetworkID = networkID
+	}
+	if actorID, err := uuid.Parse(c.GetString("identity_id")); err == nil {
+		req.ActorID = actorID
+	}
+	return req
+}
+
+// TransitionState handles PUT /api/v1/identities/:id/state.
+func (h *Handler) TransitionState(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return
+	}
+
+	var req TransitionStateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+	if actorID, err := uuid.Parse(c.GetString("identity_id")); err == nil {
+		req.ActorID = actorID
+	}
+	req.ClientIP = c.ClientIP()
+	req.UserAgent = c.GetHeader("User-Agent")
+	req.RequestID = c.GetHeader("X-Request-ID")
+
+	identity, err := h.manager.TransitionState(c.Request.Context(), id, &req)
+	if err != nil {
+		if errors.Is(err, ErrIdentityNotFound) {
+			api.FailWithMessage(err.Error(), c)
+			return
+		}
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(identity, c)
+}
+
 // AddCredentials handles POST /api/v1/identities/:id/credentials.
 func (h *Handler) AddCredentials(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
@@ -138,6 +287,23 @@ func (h *Handler) AddCredentials(c *gin.Context) {
 	}
 
 	if err := h.manager.AddCredentials(c.Request.Context(), id, &req); err != nil {
+		failWithViolations(err, c)
+		return
+	}
+
+	api.Ok(c)
+}
+
+// RequirePasswordChange handles
+// POST /api/v1/identities/:id/credentials/password/require-change.
+func (h *Handler) RequirePasswordChange(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return
+	}
+
+	if err := h.manager.RequirePasswordChange(c.Request.Context(), id); err != nil {
 		api.FailWithErrCode(err, c)
 		return
 	}
@@ -166,3 +332,25 @@ func (h *Handler) DeleteCredentials(c *gin.Context) {
 
 	api.Ok(c)
 }
+
+// MigrateSchema handles POST /api/v1/schemas/:id/migrate.
+func (h *Handler) MigrateSchema(c *gin.Context) {
+	var req MigrateSchemaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+	if req.ToVersion < 0 {
+		api.FailWithMessage("invalid to_version", c)
+		return
+	}
+	req.SchemaID = c.Param("id")
+
+	report, err := h.manager.MigrateSchema(c.Request.Context(), &req)
+	if err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(report, c)
+}
@@ -6,7 +6,11 @@ package identity
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"strconv"
 
 	"golang.org/x/crypto/argon2"
 )
@@ -17,86 +21,189 @@ var ErrInvalidHash = errors.New("invalid hash")
 // Hasher defines the interface for password hashing.
 type Hasher interface {
 	Hash(password string) ([]byte, error)
+	// Verify checks a password against a hash from Hash or an imported
+	// hash, see ValidateImportedHash.
 	Verify(password string, hash []byte) error
+	// NeedsRehash reports whether hash should be replaced with the output
+	// of Hash once the password is known.
+	NeedsRehash(hash []byte) bool
 }
 
-// Argon2idHasher implements password hashing using Argon2id.
+// Limits on Argon2id parameters, so that a stored or imported hash cannot
+// make a login exhaust CPU or memory.
+const (
+	maxArgon2Memory     = 1 << 20 // 1GB
+	maxArgon2Iterations = 64
+)
+
+// Argon2Params are the parameters of Argon2id hashes.
+type Argon2Params struct {
+	// Memory is the memory cost in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params returns the recommended Argon2id parameters.
+func DefaultArgon2Params() Argon2Params {
+	return Argon2Params{
+		Memory:      64 * 1024, // 64MB
+		Iterations:  3,
+		Parallelism: 4,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// legacyArgon2Params are the parameters of hashes stored as the raw salt
+// followed by the key, before hashes were PHC encoded.
+var legacyArgon2Params = DefaultArgon2Params()
+
+// Validate checks that the parameters are within the supported limits.
+func (p Argon2Params) Validate() error {
+	switch {
+	case p.Memory < 8*uint32(p.Parallelism) || p.Memory > maxArgon2Memory:
+		return fmt.Errorf("argon2id: memory must be between %d and %d KiB", 8*uint32(p.Parallelism), maxArgon2Memory)
+	case p.Iterations < 1 || p.Iterations > maxArgon2Iterations:
+		return fmt.Errorf("argon2id: iterations must be between 1 and %d", maxArgon2Iterations)
+	case p.Parallelism < 1:
+		return errors.New("argon2id: parallelism must be at least 1")
+	case p.SaltLength < 8 || p.SaltLength > maxImportedKeyLen:
+		return fmt.Errorf("argon2id: salt length must be between 8 and %d bytes", maxImportedKeyLen)
+	case p.KeyLength < 16 || p.KeyLength > maxImportedKeyLen:
+		return fmt.Errorf("argon2id: key length must be between 16 and %d bytes", maxImportedKeyLen)
+	}
+	return nil
+}
+
+// Argon2idHasher implements password hashing using Argon2id. Hashes are
+// PHC strings, $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>,
+// so they stay verifiable when the parameters change.
 type Argon2idHasher struct {
-	memory      int
-	iterations  int
-	parallelism int
-	keyLen      int
-	saltLen     int
+	params Argon2Params
 }
 
 // NewArgon2idHasher creates a new Argon2id hasher with recommended parameters.
 func NewArgon2idHasher() *Argon2idHasher {
-	return &Argon2idHasher{
-		memory:      64 * 1024, // 64MB
-		iterations:  3,
-		parallelism: 4,
-		keyLen:      32,
-		saltLen:     16,
+	return &Argon2idHasher{params: DefaultArgon2Params()}
+}
+
+// NewArgon2idHasherWithParams creates a new Argon2id hasher that hashes
+// with params.
+func NewArgon2idHasherWithParams(params Argon2Params) (*Argon2idHasher, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
 	}
+	return &Argon2idHasher{params: params}, nil
+}
+
+// Params returns the parameters of new hashes.
+func (h *Argon2idHasher) Params() Argon2Params {
+	return h.params
 }
 
 // Hash generates a hash from the password using Argon2id.
 func (h *Argon2idHasher) Hash(password string) ([]byte, error) {
-	salt := make([]byte, h.saltLen)
+	salt := make([]byte, h.params.SaltLength)
 	if _, err := rand.Read(salt); err != nil {
 		return nil, err
 	}
 
-	hash := argon2.IDKey(
-		[]byte(password),
-		salt,
-		uint32(h.iterations),
-		uint32(h.memory),
-		uint8(h.parallelism),
-		uint32(h.keyLen),
-	)
-
-	// Prepend salt to hash for storage
-	result := make([]byte, h.saltLen+len(hash))
-	copy(result[:h.saltLen], salt)
-	copy(result[h.saltLen:], hash)
-
-	return result, nil
+	a := argon2Hash{params: h.params, salt: salt}
+	a.key = a.derive([]byte(password))
+	return a.encode(), nil
 }
 
 // Verify checks if the password matches the hash.
 func (h *Argon2idHasher) Verify(password string, hash []byte) error {
-	if len(hash) < h.saltLen+h.keyLen {
+	if parsed, err := parseImportedHash(hash); err == nil {
+		if !parsed.verify([]byte(password)) {
+			return ErrInvalidCredentials
+		}
+		return nil
+	}
+
+	legacy := legacyArgon2Params
+	if len(hash) != int(legacy.SaltLength+legacy.KeyLength) {
 		return ErrInvalidHash
 	}
+	a := argon2Hash{params: legacy, salt: hash[:legacy.SaltLength], key: hash[legacy.SaltLength:]}
+	if !a.verify([]byte(password)) {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
 
-	salt := hash[:h.saltLen]
-	expectedHash := hash[h.saltLen:]
+// NeedsRehash reports whether hash is not an Argon2id hash with the
+// parameters of h: it is imported from another algorithm, stored in the
+// legacy raw format or hashed with other parameters.
+func (h *Argon2idHasher) NeedsRehash(hash []byte) bool {
+	parsed, err := parseImportedHash(hash)
+	if err != nil {
+		return true
+	}
+	a, ok := parsed.(argon2Hash)
+	return !ok || a.params != h.params
+}
 
-	actualHash := argon2.IDKey(
-		[]byte(password),
-		salt,
-		uint32(h.iterations),
-		uint32(h.memory),
-		uint8(h.parallelism),
-		uint32(h.keyLen),
-	)
+// argon2Hash is a decoded Argon2id hash; its params hold the lengths of
+// salt and key.
+type argon2Hash struct {
+	params    Argon2Params
+	salt, key []byte
+}
 
-	if !constantTimeCompare(actualHash, expectedHash) {
-		return ErrInvalidCredentials
-	}
+func (a argon2Hash) derive(password []byte) []byte {
+	return argon2.IDKey(password, a.salt, a.params.Iterations, a.params.Memory, a.params.Parallelism, a.params.KeyLength)
+}
 
-	return nil
+func (a argon2Hash) verify(password []byte) bool {
+	return subtle.ConstantTimeCompare(a.derive(password), a.key) == 1
+}
+
+// encode returns the PHC string of the hash.
+func (a argon2Hash) encode() []byte {
+	return fmt.Appendf(nil, "$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.params.Memory, a.params.Iterations, a.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(a.salt), base64.RawStdEncoding.EncodeToString(a.key))
 }
 
-// constantTimeCompare compares two byte slices in constant time.
-func constantTimeCompare(a, b []byte) bool {
-	if len(a) != len(b) {
-		return false
+// parseArgon2id parses the version, parameters, salt and key fields of an
+// Argon2id PHC string.
+func parseArgon2id(fields []string) (importedHash, error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: argon2id: %s", ErrInvalidHash, reason)
+	}
+	if len(fields) != 4 {
+		return nil, invalid("expected version, parameters, salt and hash")
+	}
+	if fields[0] != "v="+strconv.Itoa(argon2.Version) {
+		return nil, invalid("unsupported version")
+	}
+	params, err := parseHashParams(fields[1], "m", "t", "p")
+	if err != nil {
+		return nil, invalid(err.Error())
+	}
+	if params["t"] < 1 || params["t"] > maxArgon2Iterations || params["p"] < 1 || params["p"] > 255 {
+		return nil, invalid("parameters out of range")
+	}
+
+	a := argon2Hash{params: Argon2Params{
+		Memory:      uint32(min(max(params["m"], 0), maxArgon2Memory+1)),
+		Iterations:  uint32(params["t"]),
+		Parallelism: uint8(params["p"]),
+	}}
+	if a.salt, err = base64.RawStdEncoding.DecodeString(fields[2]); err != nil {
+		return nil, invalid("malformed salt")
+	}
+	if a.key, err = base64.RawStdEncoding.DecodeString(fields[3]); err != nil {
+		return nil, invalid("malformed hash")
 	}
-	var result byte
-	for i := 0; i < len(a); i++ {
-		result |= a[i] ^ b[i]
+	a.params.SaltLength, a.params.KeyLength = uint32(len(a.salt)), uint32(len(a.key))
+	if err := a.params.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHash, err)
 	}
-	return result == 0
+	return a, nil
 }
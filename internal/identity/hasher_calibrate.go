@@ -0,0 +1,70 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"crypto/rand"
+	"time"
+)
+
+// minCalibrationMemory is the least memory CalibrateArgon2 falls back to.
+const minCalibrationMemory = 16 * 1024 // 16MB
+
+// CalibrateArgon2 picks Argon2id parameters whose hashes take at most
+// target on this machine. It keeps the memory and parallelism of base and
+// raises the iterations as far as target allows; when a single iteration
+// already takes longer, it halves the memory instead, down to 16MB. Every
+// measurement averages runs hashes. It returns the parameters together
+// with their measured hashing time.
+func CalibrateArgon2(base Argon2Params, target time.Duration, runs int) (Argon2Params, time.Duration, error) {
+	p := base
+	p.Iterations = 1
+	if err := p.Validate(); err != nil {
+		return p, 0, err
+	}
+	runs = max(runs, 1)
+
+	d, err := measureArgon2(p, runs)
+	for err == nil && d > target && p.Memory/2 >= max(minCalibrationMemory, 8*uint32(p.Parallelism)) {
+		p.Memory /= 2
+		d, err = measureArgon2(p, runs)
+	}
+
+	// Hashing time grows about linearly with the iterations; refine the
+	// estimate by measuring neighbours.
+	if err == nil && d < target {
+		p.Iterations = uint32(min(max(int64(target/max(d, 1)), 1), maxArgon2Iterations))
+		d, err = measureArgon2(p, runs)
+	}
+	for err == nil && d > target && p.Iterations > 1 {
+		p.Iterations--
+		d, err = measureArgon2(p, runs)
+	}
+	for err == nil && d <= target && p.Iterations < maxArgon2Iterations {
+		next := p
+		next.Iterations++
+		nd, nerr := measureArgon2(next, runs)
+		if nerr != nil || nd > target {
+			err = nerr
+			break
+		}
+		p, d = next, nd
+	}
+	return p, d, err
+}
+
+// measureArgon2 returns the average time of hashing with p.
+func measureArgon2(p Argon2Params, runs int) (time.Duration, error) {
+	a := argon2Hash{params: p, salt: make([]byte, p.SaltLength)}
+	if _, err := rand.Read(a.salt); err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	for range runs {
+		a.derive([]byte("calibration"))
+	}
+	return time.Since(start) / time.Duration(runs), nil
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// errUnknownHashFormat is returned for hashes none of the imported formats
+// recognizes.
+var errUnknownHashFormat = fmt.Errorf("%w: unknown format", ErrInvalidHash)
+
+// Limits on the cost of imported hashes, so that a crafted hash cannot
+// make a login exhaust CPU or memory.
+const (
+	maxPBKDF2Iterations = 10_000_000
+	maxScryptLogN       = 20
+	maxImportedKeyLen   = 128
+)
+
+// importedHash is a decoded password hash in one of the formats listed in
+// ValidateImportedHash.
+type importedHash interface {
+	verify(password []byte) bool
+}
+
+// ValidateImportedHash checks that hash is in one of the formats accepted
+// for import:
+//
+//	Argon2id        $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash> (PHC)
+//	bcrypt          $2a$, $2b$ or $2y$ modular crypt
+//	PBKDF2-SHA256   $pbkdf2-sha256$<rounds>$<salt>$<hash> (passlib),
+//	                $pbkdf2-sha256$i=<rounds>,l=<len>$<salt>$<hash> (PHC),
+//	                pbkdf2_sha256$<rounds>$<salt>$<hash> (Django)
+//	scrypt          $scrypt$ln=<log2 N>,r=<r>,p=<p>$<salt>$<hash> (passlib)
+//	salted SHA-1    {SSHA}<base64 of digest and salt> (LDAP)
+//
+// Errors wrap ErrInvalidHash.
+func ValidateImportedHash(hash []byte) error {
+	_, err := parseImportedHash(hash)
+	return err
+}
+
+// parseImportedHash decodes a hash in one of the formats listed in
+// ValidateImportedHash. It returns errUnknownHashFormat when no format
+// matches and an error wrapping ErrInvalidHash when a matching hash is
+// malformed.
+func parseImportedHash(hash []byte) (importedHash, error) {
+	s := string(hash)
+	switch {
+	case strings.HasPrefix(s, "$argon2id$"):
+		return parseArgon2id(strings.Split(s, "$")[2:])
+	case strings.HasPrefix(s, "$2a$"), strings.HasPrefix(s, "$2b$"), strings.HasPrefix(s, "$2y$"):
+		if _, err := bcrypt.Cost(hash); err != nil {
+			return nil, fmt.Errorf("%w: bcrypt: %v", ErrInvalidHash, err)
+		}
+		return bcryptHash(hash), nil
+	case strings.HasPrefix(s, "$pbkdf2-sha256$"):
+		return parsePBKDF2(strings.Split(s, "$")[2:], ab64Decode)
+	case strings.HasPrefix(s, "pbkdf2_sha256$"):
+		return parsePBKDF2(strings.Split(s, "$")[1:], djangoDecode)
+	case strings.HasPrefix(s, "$scrypt$"):
+		return parseScrypt(strings.Split(s, "$")[2:])
+	case len(s) > 6 && strings.EqualFold(s[:6], "{SSHA}"):
+		raw, err := base64.StdEncoding.DecodeString(s[6:])
+		if err != nil || len(raw) <= sha1.Size {
+			return nil, fmt.Errorf("%w: {SSHA}: malformed", ErrInvalidHash)
+		}
+		return sshaHash{digest: raw[:sha1.Size], salt: raw[sha1.Size:]}, nil
+	}
+	return nil, errUnknownHashFormat
+}
+
+type bcryptHash []byte
+
+func (h bcryptHash) verify(password []byte) bool {
+	return bcrypt.CompareHashAndPassword(h, password) == nil
+}
+
+type pbkdf2Hash struct {
+	iterations int
+	salt, key  []byte
+}
+
+func (h pbkdf2Hash) verify(password []byte) bool {
+	key := pbkdf2.Key(password, h.salt, h.iterations, len(h.key), sha256.New)
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// parsePBKDF2 parses the rounds, salt and hash fields of a PBKDF2-SHA256
+// hash; rounds are a number or PHC parameters.
+func parsePBKDF2(fields []string, decode func(field string, salt bool) ([]byte, error)) (importedHash, error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: pbkdf2-sha256: %s", ErrInvalidHash, reason)
+	}
+	if len(fields) != 3 {
+		return nil, invalid("expected rounds, salt and hash")
+	}
+
+	params, err := parseHashParams(fields[0], "i", "l")
+	if err != nil {
+		rounds, convErr := strconv.Atoi(fields[0])
+		if convErr != nil {
+			return nil, invalid("malformed rounds")
+		}
+		params = map[string]int{"i": rounds}
+	}
+	h := pbkdf2Hash{iterations: params["i"]}
+	if h.iterations < 1 || h.iterations > maxPBKDF2Iterations {
+		return nil, invalid("rounds out of range")
+	}
+	if h.salt, err = decode(fields[1], true); err != nil || len(h.salt) == 0 {
+		return nil, invalid("malformed salt")
+	}
+	if h.key, err = decode(fields[2], false); err != nil || len(h.key) == 0 || len(h.key) > maxImportedKeyLen {
+		return nil, invalid("malformed hash")
+	}
+	if l, ok := params["l"]; ok && l != len(h.key) {
+		return nil, invalid("hash length does not match parameters")
+	}
+	return h, nil
+}
+
+type scryptHash struct {
+	n, r, p   int
+	salt, key []byte
+}
+
+func (h scryptHash) verify(password []byte) bool {
+	key, err := scrypt.Key(password, h.salt, h.n, h.r, h.p, len(h.key))
+	return err == nil && subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+func parseScrypt(fields []string) (importedHash, error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: scrypt: %s", ErrInvalidHash, reason)
+	}
+	if len(fields) != 3 {
+		return nil, invalid("expected parameters, salt and hash")
+	}
+	params, err := parseHashParams(fields[0], "ln", "r", "p")
+	if err != nil {
+		return nil, invalid(err.Error())
+	}
+	ln, r, p := params["ln"], params["r"], params["p"]
+	if ln < 1 || ln > maxScryptLogN || r < 1 || p < 1 || r*p >= 1<<30 || 128*r*(1<<ln) > 1<<30 {
+		return nil, invalid("parameters out of range")
+	}
+	h := scryptHash{n: 1 << ln, r: r, p: p}
+	if h.salt, err = ab64Decode(fields[1], true); err != nil {
+		return nil, invalid("malformed salt")
+	}
+	if h.key, err = ab64Decode(fields[2], false); err != nil || len(h.key) == 0 || len(h.key) > maxImportedKeyLen {
+		return nil, invalid("malformed hash")
+	}
+	return h, nil
+}
+
+type sshaHash struct {
+	digest, salt []byte
+}
+
+func (h sshaHash) verify(password []byte) bool {
+	sum := sha1.Sum(append(bytes.Clone(password), h.salt...))
+	return subtle.ConstantTimeCompare(sum[:], h.digest) == 1
+}
+
+// parseHashParams parses comma separated key=value parameters. Every key
+// must be one of keys and the first of keys is required.
+func parseHashParams(s string, keys ...string) (map[string]int, error) {
+	params := make(map[string]int, len(keys))
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed parameter %q", kv)
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("malformed parameter %q", kv)
+		}
+		if !slices.Contains(keys, k) {
+			return nil, fmt.Errorf("unknown parameter %q", k)
+		}
+		params[k] = n
+	}
+	if _, ok := params[keys[0]]; !ok {
+		return nil, fmt.Errorf("missing parameter %q", keys[0])
+	}
+	return params, nil
+}
+
+// ab64Decode decodes the adapted base64 of passlib, which uses . instead
+// of + and omits padding. It also accepts standard unpadded base64 as
+// used by PHC strings.
+func ab64Decode(field string, _ bool) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.ReplaceAll(strings.TrimRight(field, "="), ".", "+"))
+}
+
+// djangoDecode decodes the fields of Django hashes: the salt is used as
+// is and the hash is padded base64.
+func djangoDecode(field string, salt bool) ([]byte, error) {
+	if salt {
+		return []byte(field), nil
+	}
+	return base64.StdEncoding.DecodeString(field)
+}
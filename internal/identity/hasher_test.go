@@ -0,0 +1,120 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestArgon2idHasherParams(t *testing.T) {
+	params := Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	h, err := NewArgon2idHasherWithParams(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(hash, []byte("$argon2id$v=19$m=1024,t=1,p=1$")) {
+		t.Fatalf("unexpected encoding %s", hash)
+	}
+	if h.NeedsRehash(hash) {
+		t.Error("expected hash with current parameters not to need a rehash")
+	}
+
+	params.Iterations = 2
+	stronger, err := NewArgon2idHasherWithParams(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stronger.Verify("correct horse", hash); err != nil {
+		t.Errorf("expected hash to verify after a parameter change, got %v", err)
+	}
+	if !stronger.NeedsRehash(hash) {
+		t.Error("expected hash with old parameters to need a rehash")
+	}
+
+	// Hashes stored before PHC encoding are the raw salt and key.
+	salt := bytes.Repeat([]byte{7}, 16)
+	legacy := append(salt, argon2.IDKey([]byte("correct horse"), salt, 3, 64*1024, 4, 32)...)
+	if err := h.Verify("correct horse", legacy); err != nil {
+		t.Errorf("expected legacy hash to verify, got %v", err)
+	}
+	if err := h.Verify("wrong horse", legacy); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials, got %v", err)
+	}
+	if !h.NeedsRehash(legacy) {
+		t.Error("expected legacy hash to need a rehash")
+	}
+
+	if _, err := NewArgon2idHasherWithParams(Argon2Params{Memory: 1 << 30, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}); err == nil {
+		t.Error("expected excessive memory to be rejected")
+	}
+}
+
+func TestVerifyImportedHashes(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := map[string]string{
+		"bcrypt":         string(bcryptHash),
+		"pbkdf2 passlib": "$pbkdf2-sha256$1000$c2FsdHNhbHRzYWx0MTIzNA$w7/Z.TtKe2706ziYqntGWEpywycBhHRgtLIN.hknDGQ",
+		"pbkdf2 phc":     "$pbkdf2-sha256$i=1000,l=32$c2FsdHNhbHRzYWx0MTIzNA$w7/Z+TtKe2706ziYqntGWEpywycBhHRgtLIN+hknDGQ",
+		"pbkdf2 django":  "pbkdf2_sha256$1000$djsalt$ytaOW2yZ4i7NEqUwaRWS8st/qFjusKWEtCj7334RPh8=",
+		"scrypt":         "$scrypt$ln=10,r=8,p=1$c2FsdHNhbHRzYWx0MTIzNA$sBRFYJxJyR9gnQuMQio24Q6ZTaugiqeT1tSTvyCASoM",
+		"ssha":           "{SSHA}DM89OO/Wr2gvk47U4rYrSiQvfzNhYjEy",
+	}
+
+	h := NewArgon2idHasher()
+	for name, hash := range hashes {
+		if err := ValidateImportedHash([]byte(hash)); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if err := h.Verify("correct horse", []byte(hash)); err != nil {
+			t.Errorf("%s: expected password to verify, got %v", name, err)
+		}
+		if err := h.Verify("wrong horse", []byte(hash)); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: expected ErrInvalidCredentials, got %v", name, err)
+		}
+		if !h.NeedsRehash([]byte(hash)) {
+			t.Errorf("%s: expected imported hash to need a rehash", name)
+		}
+	}
+
+	native, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.NeedsRehash(native) {
+		t.Error("expected native hash not to need a rehash")
+	}
+}
+
+func TestValidateImportedHashErrors(t *testing.T) {
+	for _, hash := range []string{
+		"plain text",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0MTIzNA$c2FsdHNhbHRzYWx0MTIzNA",
+		"$argon2id$v=19$m=4194304,t=1,p=1$c2FsdHNhbHRzYWx0MTIzNA$c2FsdHNhbHRzYWx0MTIzNA",
+		"$argon2id$v=19$m=1024,t=1$c2FsdHNhbHRzYWx0MTIzNA$c2FsdHNhbHRzYWx0MTIzNA",
+		"$2a$10$short",
+		"$pbkdf2-sha256$0$c2FsdA$w7/Z",
+		"$pbkdf2-sha256$i=1000,l=16$c2FsdHNhbHRzYWx0MTIzNA$w7/Z.TtKe2706ziYqntGWEpywycBhHRgtLIN.hknDGQ",
+		"$scrypt$ln=30,r=8,p=1$c2FsdA$c2FsdA",
+		"$scrypt$n=10$c2FsdA$c2FsdA",
+		"{SSHA}c2FsdA==",
+	} {
+		if err := ValidateImportedHash([]byte(hash)); !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("%q: expected ErrInvalidHash, got %v", hash, err)
+		}
+	}
+}
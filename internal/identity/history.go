@@ -0,0 +1,252 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxWriteAttempts bounds how often a change is retried after a concurrent
+// change of the identity took its version number.
+const maxWriteAttempts = 3
+
+// VersionAction describes the change that produced an identity version.
+type VersionAction string
+
+const (
+	// VersionActionBaseline records the state of an identity that existed
+	// before its history was kept.
+	VersionActionBaseline     VersionAction = "baseline"
+	VersionActionCreated      VersionAction = "created"
+	VersionActionUpdated      VersionAction = "updated"
+	VersionActionStateChanged VersionAction = "state_changed"
+	// VersionActionMigrated records traits transformed by a schema
+	// migration.
+	VersionActionMigrated VersionAction = "migrated"
+)
+
+// Version is an immutable snapshot of the traits and state of an identity
+// taken on every change to them.
+type Version struct {
+	ID         uuid.UUID     `json:"id"`
+	IdentityID uuid.UUID     `json:"identity_id"`
+	NetworkID  uuid.UUID     `json:"network_id"`
+	Version    int           `json:"version"`
+	Action     VersionAction `json:"action"`
+	// ActorID and ActorType identify who made the change; the actor of a
+	// baseline is unknown.
+	ActorID   uuid.UUID       `json:"actor_id"`
+	ActorType string          `json:"actor_type,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	Traits    json.RawMessage `json:"traits"`
+	State     State           `json:"state"`
+	// Patch is the JSON patch (RFC 6902) turning the previous version
+	// into this one. Both are documents holding traits and state; the
+	// first version is patched from an empty document.
+	Patch     []PatchOperation `json:"patch"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// PatchOperation is an operation of a JSON patch.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ListHistory lists the versions of an identity, newest first, each with
+// the patch from the version before it.
+func (m *ManagerImpl) ListHistory(ctx context.Context, id uuid.UUID) ([]*Version, error) {
+	if _, err := m.pool.GetIdentity(ctx, id); err != nil {
+		return nil, err
+	}
+	versions, err := m.pool.ListVersions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := SetPatches(versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// SetPatches sets the patch of each of the versions of an identity,
+// ordered newest first, from the version before it.
+func SetPatches(versions []*Version) error {
+	for i, v := range versions {
+		var prev *Version
+		if i+1 < len(versions) {
+			prev = versions[i+1]
+		}
+		var err error
+		if v.Patch, err = Patch(prev, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot returns the versioned fields of an identity.
+func snapshot(identity *Identity) *Version {
+	return &Version{
+		IdentityID: identity.ID,
+		NetworkID:  identity.NetworkID,
+		Traits:     identity.Traits,
+		State:      identity.State,
+	}
+}
+
+// write runs fn, which writes an identity together with its version, in a
+// transaction. The unique version numbers of an identity make the later of
+// two concurrent changes fail with ErrVersionConflict; it is then run
+// again on top of the earlier one.
+func (m *ManagerImpl) write(ctx context.Context, fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; attempt < maxWriteAttempts; attempt++ {
+		err = m.persister.Transaction(ctx, fn)
+		if !errors.Is(err, ErrVersionConflict) {
+			break
+		}
+	}
+	return err
+}
+
+// recordChange stores next as the newest version of an identity unless
+// its traits and state equal those of prev. An identity without a history
+// gets prev as its baseline first. It runs in the transaction writing
+// next, see write.
+func (m *ManagerImpl) recordChange(ctx context.Context, prev, next *Version, action VersionAction, origin *eventOrigin) error {
+	ops, err := Patch(prev, next)
+	if err != nil || len(ops) == 0 {
+		return err
+	}
+	latest, err := m.pool.LatestVersion(ctx, next.IdentityID)
+	if err != nil {
+		return err
+	}
+	if latest == 0 {
+		if err := m.createVersion(ctx, prev, 1, VersionActionBaseline, &eventOrigin{}); err != nil {
+			return err
+		}
+		latest = 1
+	}
+	return m.createVersion(ctx, next, latest+1, action, origin)
+}
+
+// recordVersion stores v as the newest version of its identity.
+func (m *ManagerImpl) recordVersion(ctx context.Context, v *Version, action VersionAction, origin *eventOrigin) error {
+	latest, err := m.pool.LatestVersion(ctx, v.IdentityID)
+	if err != nil {
+		return err
+	}
+	return m.createVersion(ctx, v, latest+1, action, origin)
+}
+
+// createVersion stores v as version number of its identity; a taken
+// number fails with ErrVersionConflict.
+func (m *ManagerImpl) createVersion(ctx context.Context, v *Version, number int, action VersionAction, origin *eventOrigin) error {
+	return m.privPool.CreateVersion(ctx, &Version{
+		ID:         uuid.New(),
+		IdentityID: v.IdentityID,
+		NetworkID:  v.NetworkID,
+		Version:    number,
+		Action:     action,
+		ActorID:    origin.actorID,
+		ActorType:  origin.actorType,
+		RequestID:  origin.requestID,
+		Traits:     v.Traits,
+		State:      v.State,
+		CreatedAt:  time.Now(),
+	})
+}
+
+// Patch returns the JSON patch turning prev into next. A nil prev is an
+// empty document.
+func Patch(prev, next *Version) ([]PatchOperation, error) {
+	from := map[string]any{}
+	if prev != nil {
+		var err error
+		if from, err = prev.document(); err != nil {
+			return nil, err
+		}
+	}
+	to, err := next.document()
+	if err != nil {
+		return nil, err
+	}
+	return diff("", from, to, []PatchOperation{}), nil
+}
+
+// document returns the traits and state of a version as a JSON document.
+func (v *Version) document() (map[string]any, error) {
+	doc := map[string]any{"state": string(v.State)}
+	if len(v.Traits) > 0 {
+		var traits any
+		d := json.NewDecoder(bytes.NewReader(v.Traits))
+		d.UseNumber()
+		if err := d.Decode(&traits); err != nil {
+			return nil, err
+		}
+		doc["traits"] = traits
+	}
+	return doc, nil
+}
+
+// diff appends the operations turning the object from into to, both at
+// path. Objects are compared member by member; any other changed value is
+// replaced as a whole.
+func diff(path string, from, to map[string]any, ops []PatchOperation) []PatchOperation {
+	keys := make([]string, 0, len(from)+len(to))
+	for k := range from {
+		keys = append(keys, k)
+	}
+	for k := range to {
+		if _, ok := from[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		p := path + "/" + escapePointer(k)
+		a, inFrom := from[k]
+		b, inTo := to[k]
+		switch {
+		case !inTo:
+			ops = append(ops, PatchOperation{Op: "remove", Path: p})
+		case !inFrom:
+			ops = append(ops, PatchOperation{Op: "add", Path: p, Value: rawValue(b)})
+		default:
+			objA, okA := a.(map[string]any)
+			objB, okB := b.(map[string]any)
+			if okA && okB {
+				ops = diff(p, objA, objB, ops)
+			} else if !reflect.DeepEqual(a, b) {
+				ops = append(ops, PatchOperation{Op: "replace", Path: p, Value: rawValue(b)})
+			}
+		}
+	}
+	return ops
+}
+
+// rawValue encodes a decoded JSON value, which cannot fail.
+func rawValue(v any) json.RawMessage {
+	raw, _ := json.Marshal(v)
+	return raw
+}
+
+// escapePointer escapes a member name for use in a JSON pointer.
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPatch(t *testing.T) {
+	v1 := &Version{
+		Traits: json.RawMessage(`{"email":"ann@example.com","name":{"first":"Ann","last":"Lee"},"tags":["a"],"a/b~c":1}`),
+		State:  StateActive,
+	}
+	v2 := &Version{
+		Traits: json.RawMessage(`{"email":"ann@example.org","name":{"first":"Ann"},"tags":["a","b"],"phone":null}`),
+		State:  StateSuspended,
+	}
+
+	ops, err := Patch(v1, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"op":"replace","path":"/state","value":"suspended"},` +
+		`{"op":"remove","path":"/traits/a~1b~0c"},` +
+		`{"op":"replace","path":"/traits/email","value":"ann@example.org"},` +
+		`{"op":"remove","path":"/traits/name/last"},` +
+		`{"op":"add","path":"/traits/phone","value":null},` +
+		`{"op":"replace","path":"/traits/tags","value":["a","b"]}]`
+	if string(got) != want {
+		t.Errorf("Patch() = %s, want %s", got, want)
+	}
+
+	if ops, _ := Patch(v2, v2); len(ops) != 0 {
+		t.Errorf("Patch() of equal versions = %v, want none", ops)
+	}
+
+	versions := []*Version{v2, v1}
+	if err := SetPatches(versions); err != nil {
+		t.Fatal(err)
+	}
+	if len(v1.Patch) != 2 || v1.Patch[0].Path != "/state" || v1.Patch[1].Path != "/traits" {
+		t.Errorf("first version patch = %+v, want adds of state and traits", v1.Patch)
+	}
+}
+
+// racingPool takes the numbers of the next conflicts versions before
+// they are stored, as a concurrent change of the identity would.
+type racingPool struct {
+	PrivilegedPool
+	conflicts int
+	attempts  int
+}
+
+func (p *racingPool) CreateVersion(ctx context.Context, v *Version) error {
+	p.attempts++
+	if p.conflicts > 0 {
+		p.conflicts--
+		racer := *v
+		racer.ID = uuid.New()
+		if err := p.PrivilegedPool.CreateVersion(ctx, &racer); err != nil {
+			return err
+		}
+	}
+	return p.PrivilegedPool.CreateVersion(ctx, v)
+}
+
+func TestRecordChangeRetriesVersionConflicts(t *testing.T) {
+	ctx := context.Background()
+	m, schemas, _ := newTestManager(t)
+	ann := createStaff(t, m, schemas, "ann@example.com")[0]
+	pool := &racingPool{PrivilegedPool: m.privPool, conflicts: 1}
+	m.privPool = pool
+
+	update := &UpdateIdentityRequest{Traits: json.RawMessage(`{"email":"ann@example.org"}`)}
+	if _, err := m.UpdateIdentity(ctx, ann.ID, update); err != nil {
+		t.Fatal(err)
+	}
+	if pool.attempts != 2 {
+		t.Errorf("stored the version %d times, want a conflict and a retry", pool.attempts)
+	}
+	versions, err := m.pool.ListVersions(ctx, ann.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Version != 2 || versions[0].Action != VersionActionUpdated {
+		t.Errorf("history = %+v, want the update as version 2", versions)
+	}
+
+	pool.conflicts, pool.attempts = maxWriteAttempts, 0
+	_, err = m.TransitionState(ctx, ann.ID, &TransitionStateRequest{State: StateSuspended})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("TransitionState() with lasting conflicts error = %v, want ErrVersionConflict", err)
+	}
+	if pool.attempts != maxWriteAttempts {
+		t.Errorf("stored the version %d times, want %d", pool.attempts, maxWriteAttempts)
+	}
+	if identity, err := m.GetIdentity(ctx, ann.ID); err != nil || identity.State != StateActive {
+		t.Errorf("GetIdentity() after a failed transition = %+v, %v, want it active", identity, err)
+	}
+	if latest, err := m.pool.LatestVersion(ctx, ann.ID); err != nil || latest != 2 {
+		t.Errorf("LatestVersion() = %d, %v, want 2", latest, err)
+	}
+}
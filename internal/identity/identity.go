@@ -10,16 +10,50 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/identity/schema"
 )
 
 // Identity represents a user identity in the system.
 type Identity struct {
-	ID        uuid.UUID       `json:"id"`
-	NetworkID uuid.UUID       `json:"network_id"`
-	SchemaID  string          `json:"schema_id"`
-	Traits    json.RawMessage `json:"traits"`
-	CreatedAt time.Time       `json:"created_at"`
-	UpdatedAt time.Time       `json:"updated_at"`
+	ID            uuid.UUID       `json:"id"`
+	NetworkID     uuid.UUID       `json:"network_id"`
+	Type          Type            `json:"type"`
+	SchemaID      string          `json:"schema_id"`
+	SchemaVersion int             `json:"schema_version"`
+	Traits        json.RawMessage `json:"traits"`
+	// MetadataPublic can be read but not written by the identity itself.
+	MetadataPublic json.RawMessage `json:"metadata_public,omitempty"`
+	// MetadataAdmin is only visible to admins, see SelfService.
+	MetadataAdmin  json.RawMessage `json:"metadata_admin,omitempty"`
+	State          State           `json:"state"`
+	StateChangedAt *time.Time      `json:"state_changed_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	// DeletedAt is set on deleted identities, which can be restored until
+	// they are purged.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Credentials is only loaded on request. When set, it is written
+	// together with the identity.
+	Credentials map[CredentialsType]*Credentials `json:"credentials,omitempty"`
+	// VerifiableAddresses is loaded by Manager.GetIdentity. When set, it
+	// replaces the stored addresses when the identity is written.
+	VerifiableAddresses []*VerifiableAddress `json:"verifiable_addresses,omitempty"`
+}
+
+// Type represents the type of an identity.
+type Type string
+
+const (
+	TypeUser Type = "user"
+	// TypeServiceAccount identities are machine clients. They have no
+	// password and authenticate with keys, see package serviceaccount.
+	TypeServiceAccount Type = "service_account"
+)
+
+// IsValid reports whether t is a known identity type.
+func (t Type) IsValid() bool {
+	return t == TypeUser || t == TypeServiceAccount
 }
 
 // Credentials represents authentication credentials for an identity.
@@ -28,9 +62,14 @@ type Credentials struct {
 	IdentityID  uuid.UUID       `json:"identity_id"`
 	Type        CredentialsType `json:"type"`
 	Identifiers []string        `json:"identifiers"`
-	Config      json.RawMessage `json:"config"`
-	CreatedAt   time.Time       `json:"created_at"`
-	UpdatedAt   time.Time       `json:"updated_at"`
+	// Config holds secrets such as password hashes and is never serialized.
+	Config json.RawMessage `json:"-"`
+	// PasswordChangedAt is when a password was last set.
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	// PasswordChangeRequired makes the next login change the password.
+	PasswordChangeRequired bool      `json:"password_change_required,omitempty"`
+	CreatedAt              time.Time `json:"created_at"`
+	UpdatedAt              time.Time `json:"updated_at"`
 }
 
 // CredentialsType represents the type of credentials.
@@ -40,15 +79,37 @@ const (
 	CredentialsTypePassword CredentialsType = "password"
 	CredentialsTypeAPIKey   CredentialsType = "api_key"
 	CredentialsTypeTOTP     CredentialsType = "totp"
+	// CredentialsTypeOIDC holds the OAuth provider accounts linked to an
+	// identity, see CredentialsOIDC.
+	CredentialsTypeOIDC CredentialsType = "oidc"
 )
 
 // Pool defines the interface for reading identity data.
 type Pool interface {
 	GetIdentity(ctx context.Context, id uuid.UUID) (*Identity, error)
 	GetIdentityByNetworkID(ctx context.Context, networkID, id uuid.UUID) (*Identity, error)
-	GetIdentityByIdentifier(ctx context.Context, identifier string) (*Identity, error)
-	ListIdentities(ctx context.Context, networkID uuid.UUID, limit, offset int) ([]*Identity, int, error)
-	FindCredentialsByIdentifier(ctx context.Context, credType CredentialsType, identifier string) (*Identity, *Credentials, error)
+	GetDeletedIdentity(ctx context.Context, id uuid.UUID) (*Identity, error)
+	GetIdentityWithCredentials(ctx context.Context, id uuid.UUID) (*Identity, error)
+	GetIdentityByIdentifier(ctx context.Context, networkID uuid.UUID, identifier string) (*Identity, error)
+	ListIdentities(ctx context.Context, networkID uuid.UUID, limit, offset int, filter *ListFilter) ([]*Identity, int, error)
+	ListIdentitiesBySchema(ctx context.Context, schemaID string, version int, after uuid.UUID, limit int) ([]*Identity, error)
+	FindCredentialsByIdentifier(ctx context.Context, networkID uuid.UUID, credType CredentialsType, identifier string) (*Identity, *Credentials, error)
+	ListCredentials(ctx context.Context, id uuid.UUID) ([]*Credentials, error)
+	ListPasswordHistory(ctx context.Context, id uuid.UUID, limit int) ([][]byte, error)
+
+	ListVerifiableAddresses(ctx context.Context, id uuid.UUID) ([]*VerifiableAddress, error)
+	GetVerifiableAddress(ctx context.Context, id uuid.UUID) (*VerifiableAddress, error)
+	// FindVerifiableAddress finds an address of a live identity of a
+	// network by channel and value, which is normalized with
+	// NormalizeAddress.
+	FindVerifiableAddress(ctx context.Context, networkID uuid.UUID, via, value string) (*VerifiableAddress, error)
+
+	// ListVersions lists the versions of an identity, newest first,
+	// without patches.
+	ListVersions(ctx context.Context, id uuid.UUID) ([]*Version, error)
+	// LatestVersion returns the newest version number of an identity, or
+	// 0 when it has no versions.
+	LatestVersion(ctx context.Context, id uuid.UUID) (int, error)
 }
 
 // PrivilegedPool defines the interface for writing identity data.
@@ -57,19 +118,39 @@ type PrivilegedPool interface {
 
 	CreateIdentity(ctx context.Context, i *Identity) error
 	UpdateIdentity(ctx context.Context, i *Identity) error
-	DeleteIdentity(ctx context.Context, networkID, id uuid.UUID) error
+	// DeleteIdentity marks an identity as deleted; PurgeIdentity deletes
+	// it for good.
+	DeleteIdentity(ctx context.Context, networkID, id uuid.UUID, at time.Time) error
+	RestoreIdentity(ctx context.Context, networkID, id uuid.UUID) error
+	ListIdentitiesDeletedBefore(ctx context.Context, before time.Time, limit, offset int) ([]*Identity, error)
+	PurgeIdentity(ctx context.Context, id uuid.UUID) error
 
 	CreateCredentials(ctx context.Context, c *Credentials) error
 	UpdateCredentials(ctx context.Context, c *Credentials) error
 	DeleteCredentials(ctx context.Context, networkID uuid.UUID, id uuid.UUID, credType CredentialsType) error
+
+	AddPasswordHistory(ctx context.Context, id uuid.UUID, hash []byte, keep int) error
+
+	UpdateVerifiableAddress(ctx context.Context, a *VerifiableAddress) error
+
+	// CreateVersion returns ErrVersionConflict when the version number of
+	// v is taken.
+	CreateVersion(ctx context.Context, v *Version) error
 }
 
 // ListIdentitiesParams holds parameters for listing identities.
 type ListIdentitiesParams struct {
-	SchemaID string
-	Page     int
-	PageSize int
-	Filters  map[string]string
+	SchemaID string `form:"schema_id"`
+	Page     int    `form:"page"`
+	PageSize int    `form:"page_size"`
+	// Filter is a filter expression, see NewListFilter.
+	Filter string `form:"filter"`
+	// Sort is the attribute to order by, prefixed with - for descending order.
+	Sort string `form:"sort"`
+	// Filters holds equality conditions keyed by attribute.
+	Filters map[string]string `form:"-"`
+	// Deleted lists deleted identities instead of live ones.
+	Deleted bool `form:"deleted"`
 }
 
 // Manager defines the interface for identity business logic.
@@ -78,28 +159,135 @@ type Manager interface {
 	GetIdentity(ctx context.Context, id uuid.UUID) (*Identity, error)
 	ListIdentities(ctx context.Context, networkID uuid.UUID, params ListIdentitiesParams) ([]*Identity, int, error)
 	UpdateIdentity(ctx context.Context, id uuid.UUID, req *UpdateIdentityRequest) (*Identity, error)
-	DeleteIdentity(ctx context.Context, id uuid.UUID) error
+	DeleteIdentity(ctx context.Context, id uuid.UUID, req *DeleteIdentityRequest) error
+	RestoreIdentity(ctx context.Context, id uuid.UUID, req *DeleteIdentityRequest) (*Identity, error)
+	PurgeIdentity(ctx context.Context, id uuid.UUID, req *DeleteIdentityRequest) error
+	PurgeDeletedIdentities(ctx context.Context) (int, error)
 
 	AddCredentials(ctx context.Context, id uuid.UUID, req *AddCredentialsRequest) error
 	DeleteCredentials(ctx context.Context, id uuid.UUID, credType CredentialsType) error
+	RequirePasswordChange(ctx context.Context, id uuid.UUID) error
+
+	MigrateSchema(ctx context.Context, req *MigrateSchemaRequest) (*SchemaMigrationReport, error)
+
+	TransitionState(ctx context.Context, id uuid.UUID, req *TransitionStateRequest) (*Identity, error)
+
+	// ListHistory lists the versions of an identity, newest first.
+	ListHistory(ctx context.Context, id uuid.UUID) ([]*Version, error)
 }
 
 // CreateIdentityRequest holds data for creating a new identity.
 type CreateIdentityRequest struct {
+	// Type defaults to TypeUser. Service accounts cannot have a password.
+	Type     Type            `json:"type,omitempty"`
 	SchemaID string          `json:"schema_id"`
 	Traits   json.RawMessage `json:"traits"`
 	Password string          `json:"password,omitempty"`
+	// MetadataPublic and MetadataAdmin are JSON objects only admins can
+	// set.
+	MetadataPublic json.RawMessage `json:"metadata_public,omitempty"`
+	MetadataAdmin  json.RawMessage `json:"metadata_admin,omitempty"`
+	// HashedPassword imports a password hash from another system instead
+	// of Password, see ValidateImportedHash. It is replaced with a hash of
+	// the configured algorithm on the first successful login.
+	HashedPassword string `json:"hashed_password,omitempty"`
+	// State is the initial state; it defaults to StateActive.
+	State State `json:"state,omitempty"`
+	// ID keeps the ID of an identity imported from another system; a new
+	// ID is generated when it is nil.
+	ID uuid.UUID `json:"-"`
+	// NetworkID is the network the identity belongs to.
+	NetworkID uuid.UUID `json:"-"`
+
+	// The origin of the request is recorded in the identity history.
+	ActorID   uuid.UUID `json:"-"`
+	RequestID string    `json:"-"`
 }
 
 // UpdateIdentityRequest holds data for updating an identity.
+// Traits and metadata that are left out are kept; metadata set to null is
+// cleared.
 type UpdateIdentityRequest struct {
-	Traits json.RawMessage `json:"traits"`
+	Traits         json.RawMessage `json:"traits"`
+	MetadataPublic json.RawMessage `json:"metadata_public"`
+	MetadataAdmin  json.RawMessage `json:"metadata_admin"`
+
+	// The origin of the request is recorded in the identity history.
+	ActorID   uuid.UUID `json:"-"`
+	RequestID string    `json:"-"`
 }
 
-// AddCredentialsRequest holds data for adding credentials.
+// AddCredentialsRequest holds data for adding credentials. Credentials of
+// a type the identity already has are replaced. Identifiers are ignored for
+// types whose identifiers the identity schema declares.
 type AddCredentialsRequest struct {
 	Type        CredentialsType `json:"type"`
 	Identifiers []string        `json:"identifiers"`
 	Config      json.RawMessage `json:"config"`
 	Password    string          `json:"password,omitempty"` // used for password type
+	// HashedPassword imports a password hash for the password type, see
+	// CreateIdentityRequest.
+	HashedPassword string `json:"hashed_password,omitempty"`
+}
+
+// TransitionStateRequest holds data for changing the state of an identity.
+type TransitionStateRequest struct {
+	State  State  `json:"state"`
+	Reason string `json:"reason"`
+
+	// The origin of the request is recorded in the audit trail.
+	ActorID   uuid.UUID `json:"-"`
+	ClientIP  string    `json:"-"`
+	UserAgent string    `json:"-"`
+	RequestID string    `json:"-"`
+}
+
+// DeleteIdentityRequest holds the origin of the deletion or restoration
+// of an identity, which is recorded in the audit trail.
+type DeleteIdentityRequest struct {
+	// NetworkID is the network the identity must belong to.
+	NetworkID uuid.UUID
+	ActorID   uuid.UUID
+	ClientIP  string
+	UserAgent string
+	RequestID string
+}
+
+// MigrateSchemaRequest holds data for migrating identities between two
+// consecutive versions of a schema.
+type MigrateSchemaRequest struct {
+	SchemaID string `json:"-"`
+	// ToVersion is the target version; identities are migrated from the
+	// version before it. Defaults to the latest version.
+	ToVersion int `json:"to_version"`
+	// DryRun reports the outcome without changing any identity.
+	DryRun bool `json:"dry_run"`
+}
+
+// SchemaMigrationReport summarizes a schema migration.
+type SchemaMigrationReport struct {
+	SchemaID    string `json:"schema_id"`
+	FromVersion int    `json:"from_version"`
+	ToVersion   int    `json:"to_version"`
+	DryRun      bool   `json:"dry_run"`
+	// Total is the number of identities at FromVersion.
+	Total int `json:"total"`
+	// Migrated is the number of identities moved to ToVersion, or that
+	// would be moved in a dry run.
+	Migrated int `json:"migrated"`
+	// Failed is the number of identities left at FromVersion.
+	Failed int `json:"failed"`
+	// Skipped is the number of identities that left FromVersion while
+	// the migration ran, e.g. because they were migrated concurrently.
+	Skipped int `json:"skipped"`
+	// Failures describes failed identities; the list is truncated after
+	// MaxReportedFailures entries.
+	Failures []*SchemaMigrationFailure `json:"failures"`
+}
+
+// SchemaMigrationFailure describes an identity that cannot be migrated.
+type SchemaMigrationFailure struct {
+	IdentityID uuid.UUID           `json:"identity_id"`
+	Message    string              `json:"message"`
+	Errors     []schema.FieldError `json:"errors,omitempty"`
 }
@@ -0,0 +1,234 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/audit"
+	"github.com/coding-hui/iam/pkg/code"
+
+	"github.com/coding-hui/common/errors"
+)
+
+// State is the lifecycle state of an identity. Only active identities can
+// authenticate.
+type State string
+
+const (
+	StateActive State = "active"
+	// StateInactive disables an identity, e.g. of a departed employee.
+	StateInactive State = "inactive"
+	// StateSuspended blocks an identity temporarily, e.g. during an
+	// investigation.
+	StateSuspended State = "suspended"
+	// StatePendingDeletion marks an identity that is about to be deleted.
+	StatePendingDeletion State = "pending_deletion"
+)
+
+// stateTransitions lists the states each state can move to.
+var stateTransitions = map[State][]State{
+	StateActive:          {StateInactive, StateSuspended, StatePendingDeletion},
+	StateInactive:        {StateActive, StateSuspended, StatePendingDeletion},
+	StateSuspended:       {StateActive, StateInactive, StatePendingDeletion},
+	StatePendingDeletion: {StateActive, StateInactive},
+}
+
+// IsValid reports whether s is a known state.
+func (s State) IsValid() bool {
+	_, ok := stateTransitions[s]
+	return ok
+}
+
+// IsActive reports whether identities in state s may authenticate.
+func (s State) IsActive() bool {
+	return s == StateActive
+}
+
+// CanTransitionTo reports whether an identity can move from s to to.
+func (s State) CanTransitionTo(to State) bool {
+	for _, t := range stateTransitions[s] {
+		if t == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckActive returns an error wrapping ErrIdentityInactive unless the
+// identity may authenticate.
+func (i *Identity) CheckActive() error {
+	if i.State.IsActive() {
+		return nil
+	}
+	return errors.WrapC(ErrIdentityInactive, code.ErrIdentityInactive, "identity is %s", i.State)
+}
+
+// RevokeFunc revokes what has been issued to an identity, such as its
+// sessions or tokens.
+type RevokeFunc func(ctx context.Context, identityID uuid.UUID) error
+
+// PurgeFunc runs after identities of a network have been purged.
+type PurgeFunc func(ctx context.Context, networkID uuid.UUID) error
+
+// EventSender delivers identity events, e.g. to webhooks.
+type EventSender interface {
+	SendEvent(ctx context.Context, eventType string, payload any) error
+}
+
+// LifecycleHooks are the side effects of state transitions and deletions.
+// All fields are optional.
+type LifecycleHooks struct {
+	// Revokers run when an identity leaves the active state or is deleted.
+	Revokers []RevokeFunc
+	// Purgers run after identities of a network have been purged, once
+	// per network and batch, e.g. to drop their role bindings from the
+	// authorization engine.
+	Purgers []PurgeFunc
+	// Events receives an IdentityEvent for every transition and deletion.
+	Events EventSender
+	// Audit records every transition and deletion.
+	Audit audit.Manager
+}
+
+// SetLifecycleHooks sets the side effects of state transitions and
+// deletions.
+func (m *ManagerImpl) SetLifecycleHooks(hooks LifecycleHooks) {
+	m.lifecycle = hooks
+}
+
+// TransitionState moves an identity to req.State. Leaving the active
+// state revokes the sessions and tokens of the identity. Every transition
+// is recorded in the audit trail and sent as an EventIdentityStateChanged
+// event; moving to the current state changes nothing.
+func (m *ManagerImpl) TransitionState(ctx context.Context, id uuid.UUID, req *TransitionStateRequest) (*Identity, error) {
+	if !req.State.IsValid() {
+		return nil, errors.WithCode(code.ErrIdentityStateTransitionInvalid, "unknown identity state %q", req.State)
+	}
+
+	identity, err := m.pool.GetIdentity(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	from := identity.State
+	if from == req.State {
+		return identity, nil
+	}
+	if !from.CanTransitionTo(req.State) {
+		return nil, errors.WrapC(ErrInvalidStateTransition, code.ErrIdentityStateTransitionInvalid,
+			"identity cannot move from %s to %s", from, req.State)
+	}
+
+	prev := snapshot(identity)
+	now := time.Now()
+	identity.State = req.State
+	identity.StateChangedAt = &now
+	identity.UpdatedAt = now
+	if err := m.write(ctx, func(ctx context.Context) error {
+		if err := m.privPool.UpdateIdentity(ctx, identity); err != nil {
+			return err
+		}
+		return m.recordChange(ctx, prev, snapshot(identity), VersionActionStateChanged, &eventOrigin{
+			actorID:   req.ActorID,
+			actorType: "admin",
+			requestID: req.RequestID,
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	if !req.State.IsActive() {
+		for _, revoke := range m.lifecycle.Revokers {
+			if err := revoke(ctx, identity.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := m.recordTransition(ctx, identity, from, req); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// recordTransition writes the audit record and sends the event of a state
+// transition.
+func (m *ManagerImpl) recordTransition(ctx context.Context, identity *Identity, from State, req *TransitionStateRequest) error {
+	return m.recordEvent(ctx, identity, EventIdentityStateChanged, &eventOrigin{
+		actorID:   req.ActorID,
+		actorType: "admin",
+		clientIP:  req.ClientIP,
+		userAgent: req.UserAgent,
+		requestID: req.RequestID,
+	}, map[string]any{
+		"from":   from,
+		"to":     req.State,
+		"reason": req.Reason,
+	})
+}
+
+// eventOrigin is the origin of a change recorded in the audit trail.
+type eventOrigin struct {
+	actorID   uuid.UUID
+	actorType string
+	clientIP  string
+	userAgent string
+	requestID string
+}
+
+// recordEvent writes the audit record and sends the event of a change to
+// an identity.
+func (m *ManagerImpl) recordEvent(ctx context.Context, identity *Identity, eventType string, origin *eventOrigin, metadata map[string]any) error {
+	if err := m.recordAudit(ctx, identity, eventType, origin, metadata); err != nil {
+		return err
+	}
+	return m.sendEvent(ctx, identity, eventType, origin, metadata)
+}
+
+// recordAudit writes the audit record of a change to an identity.
+func (m *ManagerImpl) recordAudit(ctx context.Context, identity *Identity, eventType string, origin *eventOrigin, metadata map[string]any) error {
+	if m.lifecycle.Audit == nil {
+		return nil
+	}
+	var raw json.RawMessage
+	if metadata != nil {
+		var err error
+		if raw, err = json.Marshal(metadata); err != nil {
+			return err
+		}
+	}
+	return m.lifecycle.Audit.RecordEvent(ctx, &audit.RecordEventRequest{
+		NetworkID:  identity.NetworkID,
+		Type:       eventType,
+		ActorID:    origin.actorID,
+		ActorType:  origin.actorType,
+		TargetID:   identity.ID,
+		TargetType: "identity",
+		Outcome:    "success",
+		ClientIP:   origin.clientIP,
+		UserAgent:  origin.userAgent,
+		RequestID:  origin.requestID,
+		Metadata:   raw,
+	})
+}
+
+// sendEvent sends the event of a change to an identity.
+func (m *ManagerImpl) sendEvent(ctx context.Context, identity *Identity, eventType string, origin *eventOrigin, metadata map[string]any) error {
+	if m.lifecycle.Events == nil {
+		return nil
+	}
+	return m.lifecycle.Events.SendEvent(ctx, eventType, &IdentityEvent{
+		Type:       eventType,
+		IdentityID: identity.ID.String(),
+		NetworkID:  identity.NetworkID.String(),
+		ActorID:    origin.actorID.String(),
+		Outcome:    "success",
+		Metadata:   metadata,
+	})
+}
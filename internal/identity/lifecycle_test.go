@@ -0,0 +1,102 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestStateTransitions(t *testing.T) {
+	states := []State{StateActive, StateInactive, StateSuspended, StatePendingDeletion}
+	allowed := map[State]map[State]bool{
+		StateActive:          {StateInactive: true, StateSuspended: true, StatePendingDeletion: true},
+		StateInactive:        {StateActive: true, StateSuspended: true, StatePendingDeletion: true},
+		StateSuspended:       {StateActive: true, StateInactive: true, StatePendingDeletion: true},
+		StatePendingDeletion: {StateActive: true, StateInactive: true},
+	}
+	for _, from := range states {
+		if !from.IsValid() {
+			t.Errorf("%s is not valid", from)
+		}
+		if got := from.IsActive(); got != (from == StateActive) {
+			t.Errorf("%s.IsActive() = %t", from, got)
+		}
+		err := (&Identity{State: from}).CheckActive()
+		if from == StateActive && err != nil || from != StateActive && !errors.Is(err, ErrIdentityInactive) {
+			t.Errorf("CheckActive() in %s error = %v", from, err)
+		}
+		for _, to := range append(states, "deleted") {
+			if got := from.CanTransitionTo(to); got != allowed[from][to] {
+				t.Errorf("%s.CanTransitionTo(%s) = %t, want %t", from, to, got, allowed[from][to])
+			}
+		}
+	}
+	if State("deleted").IsValid() || State("").IsValid() {
+		t.Error("unknown states are valid")
+	}
+}
+
+func TestTransitionStateRevokes(t *testing.T) {
+	ctx := context.Background()
+	m, schemas, _ := newTestManager(t)
+	ann := createStaff(t, m, schemas, "ann@example.com")[0]
+	var revoked []uuid.UUID
+	m.SetLifecycleHooks(LifecycleHooks{Revokers: []RevokeFunc{func(_ context.Context, id uuid.UUID) error {
+		revoked = append(revoked, id)
+		return nil
+	}}})
+
+	transition := func(to State) error {
+		t.Helper()
+		identity, err := m.TransitionState(ctx, ann.ID, &TransitionStateRequest{State: to})
+		if err == nil && identity.State != to {
+			t.Errorf("TransitionState(%s) moved to %s", to, identity.State)
+		}
+		return err
+	}
+
+	if err := transition(StateActive); err != nil || len(revoked) != 0 {
+		t.Errorf("TransitionState() to the current state = %v with %d revocations, want none", err, len(revoked))
+	}
+	if err := transition(StateSuspended); err != nil {
+		t.Fatal(err)
+	}
+	if len(revoked) != 1 || revoked[0] != ann.ID {
+		t.Errorf("leaving the active state revoked %v, want %s", revoked, ann.ID)
+	}
+	if err := transition(StateActive); err != nil {
+		t.Fatal(err)
+	}
+	if len(revoked) != 1 {
+		t.Errorf("entering the active state revoked %d times", len(revoked)-1)
+	}
+	if err := transition(StatePendingDeletion); err != nil {
+		t.Fatal(err)
+	}
+	if len(revoked) != 2 {
+		t.Errorf("leaving the active state for deletion revoked %d times, want once", len(revoked)-1)
+	}
+
+	if err := transition(StateSuspended); !errors.Is(err, ErrInvalidStateTransition) {
+		t.Errorf("TransitionState(%s) from %s error = %v, want ErrInvalidStateTransition", StateSuspended, StatePendingDeletion, err)
+	}
+	if err := transition("deleted"); err == nil {
+		t.Error("TransitionState() to an unknown state succeeded")
+	}
+	identity, err := m.GetIdentity(ctx, ann.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.State != StatePendingDeletion || identity.StateChangedAt == nil {
+		t.Errorf("stored state = %s changed at %v, want %s", identity.State, identity.StateChangedAt, StatePendingDeletion)
+	}
+	if err := identity.CheckActive(); !errors.Is(err, ErrIdentityInactive) {
+		t.Errorf("CheckActive() error = %v, want ErrIdentityInactive", err)
+	}
+}
@@ -10,52 +10,162 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/identity/password"
+	"github.com/coding-hui/iam/internal/identity/schema"
+	"github.com/coding-hui/iam/internal/persistence"
+	"github.com/coding-hui/iam/pkg/code"
+	"github.com/coding-hui/iam/pkg/identifier"
+
+	"github.com/coding-hui/common/errors"
 )
 
 // ManagerImpl implements identity.Manager using identity.Pool.
 type ManagerImpl struct {
-	pool     Pool
-	privPool PrivilegedPool
-	hasher   Hasher
+	persister persistence.Persister
+	pool      Pool
+	privPool  PrivilegedPool
+	hasher    Hasher
+	validator *schema.Validator
+	lifecycle LifecycleHooks
+	policy    *password.Policy
+
+	deletionGracePeriod time.Duration
 }
 
 // NewManagerImpl creates a new identity manager.
-func NewManagerImpl(pool Pool, privPool PrivilegedPool, hasher Hasher) *ManagerImpl {
+// Traits are validated against their identity schema when validator is set.
+func NewManagerImpl(persister persistence.Persister, pool Pool, privPool PrivilegedPool, hasher Hasher, validator *schema.Validator) *ManagerImpl {
 	return &ManagerImpl{
-		pool:     pool,
-		privPool: privPool,
-		hasher:   hasher,
+		persister: persister,
+		pool:      pool,
+		privPool:  privPool,
+		hasher:    hasher,
+		validator: validator,
+		policy:    password.DefaultPolicy(),
+
+		deletionGracePeriod: DefaultDeletionGracePeriod,
 	}
 }
 
-// CreateIdentity creates a new identity.
+// CreateIdentity creates a new identity. A password must satisfy the
+// password policy, see SetPasswordPolicy.
 func (m *ManagerImpl) CreateIdentity(ctx context.Context, req *CreateIdentityRequest) (*Identity, error) {
 	if req.SchemaID == "" {
 		req.SchemaID = "default"
 	}
+	if req.State == "" {
+		req.State = StateActive
+	}
+	if !req.State.IsValid() {
+		return nil, errors.WithCode(code.ErrIdentityStateTransitionInvalid, "unknown identity state %q", req.State)
+	}
+	if req.Type == "" {
+		req.Type = TypeUser
+	}
+	if !req.Type.IsValid() {
+		return nil, errors.WithCode(code.ErrIdentityTypeInvalid, "unknown identity type %q", req.Type)
+	}
+	if req.Type == TypeServiceAccount && (req.Password != "" || req.HashedPassword != "") {
+		return nil, passwordNotAllowedError()
+	}
+	version, exts, err := m.extensions(ctx, req.SchemaID, 0, req.Traits)
+	if err != nil {
+		return nil, err
+	}
+	metadataPublic, err := metadata("metadata_public", req.MetadataPublic, nil)
+	if err != nil {
+		return nil, err
+	}
+	metadataAdmin, err := metadata("metadata_admin", req.MetadataAdmin, nil)
+	if err != nil {
+		return nil, err
+	}
 
+	id := req.ID
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
 	identity := &Identity{
-		ID:        uuid.New(),
-		SchemaID:  req.SchemaID,
-		Traits:    req.Traits,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:             id,
+		NetworkID:      req.NetworkID,
+		Type:           req.Type,
+		SchemaID:       req.SchemaID,
+		SchemaVersion:  version,
+		Traits:         req.Traits,
+		MetadataPublic: metadataPublic,
+		MetadataAdmin:  metadataAdmin,
+		State:          req.State,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
 	}
+	syncAddresses(identity, nil, exts)
 
-	if err := m.privPool.CreateIdentity(ctx, identity); err != nil {
+	if req.Password != "" || req.HashedPassword != "" {
+		identifiers := exts.Identifiers[string(CredentialsTypePassword)]
+		if len(identifiers) == 0 {
+			return nil, noIdentifiersError(CredentialsTypePassword)
+		}
+		hash, err := m.newPasswordHash(ctx, req.Password, req.HashedPassword, identifiers, req.Traits, nil)
+		if err != nil {
+			return nil, err
+		}
+		identity.Credentials = map[CredentialsType]*Credentials{
+			CredentialsTypePassword: {
+				ID:                uuid.New(),
+				IdentityID:        identity.ID,
+				Type:              CredentialsTypePassword,
+				Identifiers:       identifiers,
+				Config:            hash,
+				PasswordChangedAt: &identity.CreatedAt,
+				CreatedAt:         identity.CreatedAt,
+				UpdatedAt:         identity.CreatedAt,
+			},
+		}
+	}
+
+	if err := m.write(ctx, func(ctx context.Context) error {
+		if err := m.privPool.CreateIdentity(ctx, identity); err != nil {
+			return identifierError(err)
+		}
+		if err := m.recordVersion(ctx, snapshot(identity), VersionActionCreated, &eventOrigin{
+			actorID:   req.ActorID,
+			actorType: "admin",
+			requestID: req.RequestID,
+		}); err != nil {
+			return err
+		}
+		if cred, ok := identity.Credentials[CredentialsTypePassword]; ok {
+			return m.recordPassword(ctx, identity, cred.Config)
+		}
+		return nil
+	}); err != nil {
 		return nil, err
 	}
 
 	return identity, nil
 }
 
-// GetIdentity retrieves an identity by ID.
+// GetIdentity retrieves an identity by ID together with its verifiable
+// addresses.
 func (m *ManagerImpl) GetIdentity(ctx context.Context, id uuid.UUID) (*Identity, error) {
-	return m.pool.GetIdentity(ctx, id)
+	identity, err := m.pool.GetIdentity(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if identity.VerifiableAddresses, err = m.pool.ListVerifiableAddresses(ctx, id); err != nil {
+		return nil, err
+	}
+	return identity, nil
 }
 
-// ListIdentities lists identities with pagination.
+// ListIdentities lists identities matching the filters of params with
+// pagination.
 func (m *ManagerImpl) ListIdentities(ctx context.Context, networkID uuid.UUID, params ListIdentitiesParams) ([]*Identity, int, error) {
+	filter, err := NewListFilter(params)
+	if err != nil {
+		return nil, 0, err
+	}
 	if params.Page < 1 {
 		params.Page = 1
 	}
@@ -64,61 +174,147 @@ func (m *ManagerImpl) ListIdentities(ctx context.Context, networkID uuid.UUID, p
 	}
 	offset := (params.Page - 1) * params.PageSize
 
-	return m.pool.ListIdentities(ctx, networkID, params.PageSize, offset)
+	return m.pool.ListIdentities(ctx, networkID, params.PageSize, offset, filter)
 }
 
-// UpdateIdentity updates an identity's traits.
+// UpdateIdentity updates an identity's traits and metadata. The
+// identifiers of its credentials and its verifiable addresses are
+// recomputed from the new traits; traits leaving credentials without
+// identifiers are rejected. Changed traits are recorded in the identity
+// history.
 func (m *ManagerImpl) UpdateIdentity(ctx context.Context, id uuid.UUID, req *UpdateIdentityRequest) (*Identity, error) {
-	identity, err := m.pool.GetIdentity(ctx, id)
+	identity, err := m.pool.GetIdentityWithCredentials(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	traits := req.Traits
+	if traits == nil {
+		traits = identity.Traits
+	}
+	_, exts, err := m.extensions(ctx, identity.SchemaID, identity.SchemaVersion, traits)
+	if err != nil {
+		return nil, err
+	}
+	if identity.MetadataPublic, err = metadata("metadata_public", req.MetadataPublic, identity.MetadataPublic); err != nil {
+		return nil, err
+	}
+	if identity.MetadataAdmin, err = metadata("metadata_admin", req.MetadataAdmin, identity.MetadataAdmin); err != nil {
+		return nil, err
+	}
+	addrs, err := m.pool.ListVerifiableAddresses(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	identity.Traits = req.Traits
+	prev := snapshot(identity)
+	identity.Traits = traits
 	identity.UpdatedAt = time.Now()
+	if err := syncIdentifiers(identity, exts); err != nil {
+		return nil, err
+	}
+	syncAddresses(identity, addrs, exts)
 
-	if err := m.privPool.UpdateIdentity(ctx, identity); err != nil {
+	if err := m.write(ctx, func(ctx context.Context) error {
+		if err := m.privPool.UpdateIdentity(ctx, identity); err != nil {
+			return identifierError(err)
+		}
+		return m.recordChange(ctx, prev, snapshot(identity), VersionActionUpdated, &eventOrigin{
+			actorID:   req.ActorID,
+			actorType: "admin",
+			requestID: req.RequestID,
+		})
+	}); err != nil {
 		return nil, err
 	}
 
 	return identity, nil
 }
 
-// DeleteIdentity deletes an identity.
-func (m *ManagerImpl) DeleteIdentity(ctx context.Context, id uuid.UUID) error {
-	networkID := uuid.Nil
-	return m.privPool.DeleteIdentity(ctx, networkID, id)
-}
-
-// AddCredentials adds credentials to an identity.
+// AddCredentials adds credentials to an identity, replacing existing
+// credentials of the same type. When the identity schema declares
+// identifiers for the credentials type they are taken from the traits. A
+// password must satisfy the password policy; service accounts cannot have
+// one.
 func (m *ManagerImpl) AddCredentials(ctx context.Context, id uuid.UUID, req *AddCredentialsRequest) error {
-	identity, err := m.pool.GetIdentity(ctx, id)
+	identity, err := m.pool.GetIdentityWithCredentials(ctx, id)
 	if err != nil {
 		return err
 	}
+	if identity.Type == TypeServiceAccount && req.Type == CredentialsTypePassword {
+		return passwordNotAllowedError()
+	}
+	_, exts, err := m.extensions(ctx, identity.SchemaID, identity.SchemaVersion, identity.Traits)
+	if err != nil {
+		return err
+	}
+
+	identifiers, declared := exts.Identifiers[string(req.Type)]
+	if !declared {
+		identifiers = req.Identifiers
+	}
+	if len(identifiers) == 0 {
+		return noIdentifiersError(req.Type)
+	}
 
-	var config json.RawMessage
+	config, newPassword := req.Config, false
 	if req.Type == CredentialsTypePassword && req.Config == nil {
-		hash, err := m.hasher.Hash(req.Password)
+		hash, err := m.newPasswordHash(ctx, req.Password, req.HashedPassword, identifiers, identity.Traits, identity)
 		if err != nil {
 			return err
 		}
-		config = hash
-	} else {
-		config = req.Config
+		config, newPassword = hash, true
 	}
 
-	cred := &Credentials{
-		ID:          uuid.New(),
-		IdentityID:  identity.ID,
-		Type:        req.Type,
-		Identifiers: req.Identifiers,
-		Config:      config,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	now := time.Now()
+	cred, exists := identity.Credentials[req.Type]
+	if !exists {
+		cred = &Credentials{
+			ID:         uuid.New(),
+			IdentityID: identity.ID,
+			Type:       req.Type,
+			CreatedAt:  now,
+		}
+	}
+	cred.Identifiers = identifiers
+	cred.Config = config
+	cred.UpdatedAt = now
+	if newPassword {
+		cred.PasswordChangedAt = &now
+		cred.PasswordChangeRequired = false
 	}
 
-	return m.privPool.CreateCredentials(ctx, cred)
+	return m.persister.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		if exists {
+			err = m.privPool.UpdateCredentials(ctx, cred)
+		} else {
+			err = m.privPool.CreateCredentials(ctx, cred)
+		}
+		if err != nil {
+			return identifierError(err)
+		}
+
+		if newPassword {
+			return m.recordPassword(ctx, identity, config)
+		}
+		return nil
+	})
+}
+
+// RequirePasswordChange makes the next login of an identity change its
+// password before a session is issued.
+func (m *ManagerImpl) RequirePasswordChange(ctx context.Context, id uuid.UUID) error {
+	identity, err := m.pool.GetIdentityWithCredentials(ctx, id)
+	if err != nil {
+		return err
+	}
+	cred, ok := identity.Credentials[CredentialsTypePassword]
+	if !ok {
+		return errors.WrapC(ErrCredentialsNotFound, code.ErrIdentityCredentialsInvalid, "identity has no password")
+	}
+	cred.PasswordChangeRequired = true
+	cred.UpdatedAt = time.Now()
+	return m.privPool.UpdateCredentials(ctx, cred)
 }
 
 // DeleteCredentials deletes credentials from an identity.
@@ -127,5 +323,77 @@ func (m *ManagerImpl) DeleteCredentials(ctx context.Context, id uuid.UUID, credT
 	return m.privPool.DeleteCredentials(ctx, networkID, id, credType)
 }
 
+// extensions validates traits against a version of the schema identified
+// by schemaID and returns the version used together with the trait values
+// the schema annotates; version 0 selects the latest version. Failures
+// carry an error code; a *schema.ValidationError stays reachable through
+// errors.As so callers can report the offending fields.
+func (m *ManagerImpl) extensions(ctx context.Context, schemaID string, version int, traits json.RawMessage) (int, *schema.Extensions, error) {
+	if m.validator == nil {
+		return version, &schema.Extensions{Identifiers: map[string][]string{}}, nil
+	}
+
+	s, err := m.validator.Schema(ctx, schemaID, version)
+	if err != nil {
+		return 0, nil, traitsError(err, schemaID)
+	}
+	exts, err := s.Extensions(traits)
+	if err != nil {
+		return 0, nil, traitsError(err, schemaID)
+	}
+	return s.Version, exts, nil
+}
+
+// syncIdentifiers replaces the identifiers of the credentials whose type
+// the schema declares identifiers for. Traits leaving such credentials
+// without identifiers are rejected, as no login could reach them.
+func syncIdentifiers(identity *Identity, exts *schema.Extensions) error {
+	for t := range identity.Credentials {
+		if identifiers, ok := exts.Identifiers[string(t)]; ok && len(identifiers) == 0 {
+			return errors.WrapC(ErrNoIdentifiers, code.ErrIdentityIdentifierInvalid, "traits leave the %s credentials without identifiers", t)
+		}
+	}
+	for t, c := range identity.Credentials {
+		if identifiers, ok := exts.Identifiers[string(t)]; ok {
+			c.Identifiers = identifiers
+			c.UpdatedAt = identity.UpdatedAt
+		}
+	}
+	return nil
+}
+
+// identifierError attaches the API error code to identifier conflicts
+// and identifiers that cannot be normalized.
+func identifierError(err error) error {
+	switch {
+	case errors.Is(err, ErrIdentifierInUse):
+		return errors.WrapC(err, code.ErrIdentityIdentifierInUse, "%s", err.Error())
+	case errors.Is(err, identifier.ErrInvalid):
+		return errors.WrapC(err, code.ErrIdentityIdentifierInvalid, "%s", err.Error())
+	default:
+		return err
+	}
+}
+
+func passwordNotAllowedError() error {
+	return errors.WrapC(ErrPasswordNotAllowed, code.ErrIdentityCredentialsInvalid, "%s", ErrPasswordNotAllowed.Error())
+}
+
+func noIdentifiersError(credType CredentialsType) error {
+	return errors.WrapC(ErrNoIdentifiers, code.ErrIdentityCredentialsInvalid, "%s credentials have no identifiers", credType)
+}
+
+// traitsError attaches the API error code matching a schema error.
+func traitsError(err error, schemaID string) error {
+	switch {
+	case errors.Is(err, schema.ErrSchemaNotFound):
+		return errors.WrapC(err, code.ErrIdentitySchemaNotFound, "identity schema %q not found", schemaID)
+	case errors.Is(err, schema.ErrValidation), errors.Is(err, schema.ErrInvalidJSON):
+		return errors.WrapC(err, code.ErrIdentityTraitsInvalid, "%s", err.Error())
+	default:
+		return err
+	}
+}
+
 // Ensure ManagerImpl implements Manager.
 var _ Manager = (*ManagerImpl)(nil)
@@ -0,0 +1,157 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/identity/schema"
+	"github.com/coding-hui/iam/internal/persistence/sql"
+	"github.com/coding-hui/iam/pkg/code"
+
+	"github.com/coding-hui/common/errors"
+)
+
+// emailSchema is an identity schema whose field is the identifier of
+// passwords.
+func emailSchema(field string) json.RawMessage {
+	return json.RawMessage(`{"type":"object","properties":{"` + field + `":{"type":"string","format":"email",` +
+		`"iam":{"credentials":{"password":{"identifier":true}}}}}}`)
+}
+
+// testPool lets tests interleave with the listing of identities.
+type testPool struct {
+	Pool
+	afterList func(ctx context.Context)
+}
+
+func (p *testPool) ListIdentitiesBySchema(ctx context.Context, schemaID string, version int, after uuid.UUID, limit int) ([]*Identity, error) {
+	identities, err := p.Pool.ListIdentitiesBySchema(ctx, schemaID, version, after, limit)
+	if err == nil && p.afterList != nil {
+		p.afterList(ctx)
+	}
+	return identities, err
+}
+
+// newTestManager returns a manager backed by a SQLite database file of the
+// test, and a manager of its identity schemas.
+func newTestManager(t *testing.T) (*ManagerImpl, schema.Manager, *testPool) {
+	t.Helper()
+	p, err := sql.NewSQLitePersister(filepath.Join(t.TempDir(), "iam.db")+"?_busy_timeout=5000", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = p.Close(context.Background()) })
+	if err := p.MigrateUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	schemaPool := schema.NewPrivilegedPool(sql.NewIdentitySchemaPool(p))
+	registry := schema.NewSchemaRegistry(schemaPool)
+	pool := &testPool{Pool: NewPool(sql.NewIdentityPool(p))}
+	hasher, err := NewArgon2idHasherWithParams(Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManagerImpl(p, pool, NewPrivilegedPool(sql.NewIdentityPool(p)), hasher, schema.NewValidator(registry))
+	return m, schema.NewManagerImpl(registry, schemaPool), pool
+}
+
+func TestMigrateSchemaReadsIdentityInTransaction(t *testing.T) {
+	ctx := context.Background()
+	m, schemas, pool := newTestManager(t)
+	if _, err := schemas.CreateSchema(ctx, &schema.CreateSchemaRequest{ID: "staff", JSONSchema: emailSchema("email")}); err != nil {
+		t.Fatal(err)
+	}
+	ann, err := m.CreateIdentity(ctx, &CreateIdentityRequest{SchemaID: "staff", Traits: json.RawMessage(`{"email":"ann@example.com"}`), Password: "correct-horse-battery-9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := m.CreateIdentity(ctx, &CreateIdentityRequest{SchemaID: "staff", Traits: json.RawMessage(`{"email":"bob@example.com"}`), Password: "correct-horse-battery-9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := schemas.UpdateSchema(ctx, "staff", &schema.UpdateSchemaRequest{
+		JSONSchema: emailSchema("mail"),
+		Transform:  schema.Transform{{Op: "rename", From: "/email", To: "/mail"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After the identities were listed, ann is updated and bob is migrated
+	// by someone else.
+	pool.afterList = func(ctx context.Context) {
+		pool.afterList = nil
+		if _, err := m.UpdateIdentity(ctx, ann.ID, &UpdateIdentityRequest{Traits: json.RawMessage(`{"email":"anna@example.com"}`)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.migrateIdentity(ctx, bob.ID, target); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := m.MigrateSchema(ctx, &MigrateSchemaRequest{SchemaID: "staff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 2 || report.Migrated != 1 || report.Skipped != 1 || report.Failed != 0 {
+		t.Errorf("MigrateSchema() = %+v, want 1 migrated and 1 skipped", report)
+	}
+
+	got, err := m.GetIdentity(ctx, ann.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Traits) != `{"mail":"anna@example.com"}` || got.SchemaVersion != target.Version {
+		t.Errorf("migrated identity has traits %s at version %d", got.Traits, got.SchemaVersion)
+	}
+	if _, err := m.pool.GetIdentityByIdentifier(ctx, ann.NetworkID, "anna@example.com"); err != nil {
+		t.Errorf("GetIdentityByIdentifier() of the updated email error = %v", err)
+	}
+
+	history, err := m.ListHistory(ctx, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var migrations int
+	for _, v := range history {
+		if v.Action == VersionActionMigrated {
+			migrations++
+		}
+	}
+	if migrations != 1 {
+		t.Errorf("bob was migrated %d times, want 1", migrations)
+	}
+}
+
+func TestUpdateIdentityKeepsIdentifiers(t *testing.T) {
+	ctx := context.Background()
+	m, schemas, _ := newTestManager(t)
+	ann := createStaff(t, m, schemas, "ann@example.com")[0]
+
+	_, err := m.UpdateIdentity(ctx, ann.ID, &UpdateIdentityRequest{Traits: json.RawMessage(`{}`)})
+	if !errors.IsCode(err, code.ErrIdentityIdentifierInvalid) || !errors.Is(err, ErrNoIdentifiers) {
+		t.Errorf("UpdateIdentity() dropping the only identifier error = %v, want ErrIdentityIdentifierInvalid", err)
+	}
+	got, err := m.GetIdentity(ctx, ann.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Traits) != `{"email":"ann@example.com"}` {
+		t.Errorf("rejected update stored traits %s", got.Traits)
+	}
+	if _, err := m.pool.GetIdentityByIdentifier(ctx, ann.NetworkID, "ann@example.com"); err != nil {
+		t.Errorf("GetIdentityByIdentifier() after a rejected update error = %v", err)
+	}
+
+	if _, err := m.UpdateIdentity(ctx, ann.ID, &UpdateIdentityRequest{Traits: json.RawMessage(`{"email":"anna@example.com"}`)}); err != nil {
+		t.Errorf("UpdateIdentity() replacing the identifier error = %v", err)
+	}
+}
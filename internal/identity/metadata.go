@@ -0,0 +1,80 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/coding-hui/iam/pkg/code"
+
+	"github.com/coding-hui/common/errors"
+)
+
+// SelfService returns a copy of the identity that can be shown to the
+// identity itself, without admin metadata and credentials.
+func (i *Identity) SelfService() *Identity {
+	out := *i
+	out.MetadataAdmin = nil
+	out.Credentials = nil
+	return &out
+}
+
+// AuthzAttributes returns the attributes of the identity that
+// authorization conditions can refer to as subject.<attribute>.
+func (i *Identity) AuthzAttributes() map[string]any {
+	attrs := map[string]any{}
+	for name, raw := range map[string]json.RawMessage{
+		"metadata_public": i.MetadataPublic,
+		"metadata_admin":  i.MetadataAdmin,
+	} {
+		var v map[string]any
+		if len(raw) > 0 && json.Unmarshal(raw, &v) == nil && v != nil {
+			attrs[name] = v
+		}
+	}
+	return attrs
+}
+
+// SubjectAttributes returns the AuthzAttributes of the identity of a
+// network an authorization subject names, or nil when the subject is not
+// an identity.
+func SubjectAttributes(ctx context.Context, pool Pool, networkID, subject string) (map[string]any, error) {
+	nid, err := uuid.Parse(networkID)
+	if err != nil {
+		return nil, nil
+	}
+	id, err := uuid.Parse(subject)
+	if err != nil {
+		return nil, nil
+	}
+	identity, err := pool.GetIdentityByNetworkID(ctx, nid, id)
+	if errors.Is(err, ErrIdentityNotFound) || errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return identity.AuthzAttributes(), nil
+}
+
+// metadata validates metadata given in a request. A missing value keeps
+// current and null clears it; anything else must be a JSON object.
+func metadata(field string, raw, current json.RawMessage) (json.RawMessage, error) {
+	switch trimmed := bytes.TrimSpace(raw); {
+	case raw == nil:
+		return current, nil
+	case string(trimmed) == "null":
+		return nil, nil
+	case len(trimmed) == 0 || trimmed[0] != '{' || !json.Valid(trimmed):
+		return nil, errors.WithCode(code.ErrIdentityMetadataInvalid, "%s must be a JSON object", field)
+	default:
+		return trimmed, nil
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	current := json.RawMessage(`{"a":1}`)
+	for _, tc := range []struct {
+		raw     json.RawMessage
+		want    json.RawMessage
+		invalid bool
+	}{
+		{nil, current, false},
+		{json.RawMessage(`null`), nil, false},
+		{json.RawMessage(` {"b":2} `), json.RawMessage(`{"b":2}`), false},
+		{json.RawMessage(`[1]`), nil, true},
+		{json.RawMessage(`"x"`), nil, true},
+		{json.RawMessage(`{"b":`), nil, true},
+	} {
+		got, err := metadata("metadata_public", tc.raw, current)
+		if (err != nil) != tc.invalid {
+			t.Errorf("%s: error %v, want invalid %v", tc.raw, err, tc.invalid)
+			continue
+		}
+		if string(got) != string(tc.want) {
+			t.Errorf("%s: got %s, want %s", tc.raw, got, tc.want)
+		}
+	}
+}
+
+func TestIdentityMetadataVisibility(t *testing.T) {
+	i := &Identity{
+		MetadataPublic: json.RawMessage(`{"department":"eng"}`),
+		MetadataAdmin:  json.RawMessage(`{"tier":"gold"}`),
+		Credentials:    map[CredentialsType]*Credentials{CredentialsTypePassword: {}},
+	}
+
+	self := i.SelfService()
+	if self.MetadataAdmin != nil || self.Credentials != nil {
+		t.Errorf("expected admin metadata and credentials to be dropped, got %s, %v", self.MetadataAdmin, self.Credentials)
+	}
+	if i.MetadataAdmin == nil {
+		t.Error("expected the identity itself to be left unchanged")
+	}
+
+	want := map[string]any{
+		"metadata_public": map[string]any{"department": "eng"},
+		"metadata_admin":  map[string]any{"tier": "gold"},
+	}
+	if got := i.AuthzAttributes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AuthzAttributes() = %v, want %v", got, want)
+	}
+}
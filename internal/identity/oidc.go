@@ -0,0 +1,106 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// CredentialsOIDC is the config of oidc credentials. An identity has at
+// most one account of each provider; the identifiers of the credentials
+// are the OIDCIdentifier of each account.
+type CredentialsOIDC struct {
+	Providers []*LinkedProvider `json:"providers"`
+}
+
+// LinkedProvider is an OAuth provider account linked to an identity.
+type LinkedProvider struct {
+	Provider string `json:"provider"`
+	// Subject is the ID of the account at the provider.
+	Subject  string    `json:"subject"`
+	Email    string    `json:"email,omitempty"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+// OIDCIdentifier returns the identifier of a provider account.
+func OIDCIdentifier(provider, subject string) string {
+	return provider + ":" + subject
+}
+
+// ParseCredentialsOIDC returns the linked providers of oidc credentials;
+// nil credentials have none.
+func ParseCredentialsOIDC(c *Credentials) (*CredentialsOIDC, error) {
+	config := &CredentialsOIDC{Providers: []*LinkedProvider{}}
+	if c == nil || len(c.Config) == 0 {
+		return config, nil
+	}
+	if err := json.Unmarshal(c.Config, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Find returns the account of a provider, or nil.
+func (c *CredentialsOIDC) Find(provider string) *LinkedProvider {
+	for _, p := range c.Providers {
+		if p.Provider == provider {
+			return p
+		}
+	}
+	return nil
+}
+
+// Link adds an account, replacing another account of its provider.
+func (c *CredentialsOIDC) Link(p *LinkedProvider) {
+	c.Unlink(p.Provider)
+	c.Providers = append(c.Providers, p)
+	sort.Slice(c.Providers, func(i, j int) bool {
+		return c.Providers[i].Provider < c.Providers[j].Provider
+	})
+}
+
+// Unlink removes the account of a provider and reports whether there was
+// one.
+func (c *CredentialsOIDC) Unlink(provider string) bool {
+	for i, p := range c.Providers {
+		if p.Provider == provider {
+			c.Providers = append(c.Providers[:i], c.Providers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Identifiers returns the identifiers of the linked accounts.
+func (c *CredentialsOIDC) Identifiers() []string {
+	identifiers := make([]string, len(c.Providers))
+	for i, p := range c.Providers {
+		identifiers[i] = OIDCIdentifier(p.Provider, p.Subject)
+	}
+	return identifiers
+}
+
+// LoginMethods returns the number of ways credentials let an identity log
+// in: a password and every linked provider account count; TOTP only
+// completes a login and does not.
+func LoginMethods(creds map[CredentialsType]*Credentials) (int, error) {
+	n := 0
+	for t, c := range creds {
+		switch t {
+		case CredentialsTypeTOTP:
+		case CredentialsTypeOIDC:
+			config, err := ParseCredentialsOIDC(c)
+			if err != nil {
+				return 0, err
+			}
+			n += len(config.Providers)
+		default:
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCredentialsOIDC(t *testing.T) {
+	config, err := ParseCredentialsOIDC(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Link(&LinkedProvider{Provider: "google", Subject: "g-1"})
+	config.Link(&LinkedProvider{Provider: "github", Subject: "1"})
+	config.Link(&LinkedProvider{Provider: "github", Subject: "2"})
+	if got, want := config.Identifiers(), []string{"github:2", "google:g-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Identifiers() = %q, want %q", got, want)
+	}
+
+	raw, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := map[CredentialsType]*Credentials{
+		CredentialsTypeOIDC: {Type: CredentialsTypeOIDC, Config: raw},
+		CredentialsTypeTOTP: {Type: CredentialsTypeTOTP},
+	}
+	if n, err := LoginMethods(creds); err != nil || n != 2 {
+		t.Errorf("LoginMethods() = %d, %v; want 2", n, err)
+	}
+	creds[CredentialsTypePassword] = &Credentials{Type: CredentialsTypePassword}
+	if n, _ := LoginMethods(creds); n != 3 {
+		t.Errorf("LoginMethods() with a password = %d, want 3", n)
+	}
+
+	if !config.Unlink("github") || config.Unlink("github") {
+		t.Error("expected github to be unlinked once")
+	}
+	if config.Find("google") == nil || config.Find("github") != nil {
+		t.Errorf("unexpected providers after unlinking: %v", config.Identifiers())
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// falsePositiveRate is the rate at which the bloom filter of a breached
+// password list rejects a password that is not on the list.
+const falsePositiveRate = 0.001
+
+// BreachedList reports whether passwords are known from data breaches.
+type BreachedList interface {
+	Contains(password string) (bool, error)
+}
+
+// LoadBreachedList loads the breached passwords at path. Passwords seen
+// fewer than minCount times are ignored where counts are known.
+//
+// A directory holds a file per five character prefix of the upper-case
+// hex SHA-1 hash, named after the prefix with an optional .txt extension,
+// whose lines are the remaining 35 characters followed by ":count", as
+// served by the Pwned Passwords range API. Only the file of the prefix is
+// read for each password, so the full corpus can be used.
+//
+// A file holds a line per password, either the hex SHA-1 hash with an
+// optional ":count" or the password itself. It is loaded into a bloom
+// filter, which fits lists of a few million passwords into memory.
+func LoadBreachedList(path string, minCount int) (BreachedList, error) {
+	minCount = max(minCount, 1)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &hashPrefixDir{dir: path, minCount: minCount}, nil
+	}
+	return loadBloomFilter(path, minCount)
+}
+
+// hashPrefixDir is a directory of Pwned Passwords range files.
+type hashPrefixDir struct {
+	dir      string
+	minCount int
+}
+
+func (d *hashPrefixDir) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	h := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := h[:5], h[5:]
+
+	f, err := os.Open(filepath.Join(d.dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		f, err = os.Open(filepath.Join(d.dir, prefix+".txt"))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		entry, count, _ := strings.Cut(line, ":")
+		if !strings.EqualFold(entry, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return false, fmt.Errorf("%s: malformed line %q", f.Name(), line)
+		}
+		return n >= d.minCount, nil
+	}
+	return false, s.Err()
+}
+
+// bloomFilter is a bloom filter of SHA-1 password hashes.
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+func newBloomFilter(n int) *bloomFilter {
+	n = max(n, 1)
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// positions calls fn with the bit positions of a hash. As SHA-1 hashes are
+// uniformly distributed, two halves of the hash are combined into k
+// positions instead of hashing k times.
+func (b *bloomFilter) positions(sum [sha1.Size]byte, fn func(pos uint64) bool) bool {
+	h1 := binary.BigEndian.Uint64(sum[0:8])
+	h2 := binary.BigEndian.Uint64(sum[8:16]) | 1
+	for i := uint64(0); i < b.k; i++ {
+		if !fn((h1 + i*h2) % b.m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bloomFilter) add(sum [sha1.Size]byte) {
+	b.positions(sum, func(pos uint64) bool {
+		b.bits[pos/64] |= 1 << (pos % 64)
+		return true
+	})
+}
+
+func (b *bloomFilter) Contains(password string) (bool, error) {
+	return b.positions(sha1.Sum([]byte(password)), func(pos uint64) bool {
+		return b.bits[pos/64]&(1<<(pos%64)) != 0
+	}), nil
+}
+
+// loadBloomFilter reads a list of breached passwords in two passes, the
+// first to size the filter.
+func loadBloomFilter(path string, minCount int) (*bloomFilter, error) {
+	n := 0
+	if err := readBreachedFile(path, func([sha1.Size]byte, int) { n++ }); err != nil {
+		return nil, err
+	}
+	b := newBloomFilter(n)
+	err := readBreachedFile(path, func(sum [sha1.Size]byte, count int) {
+		if count >= minCount {
+			b.add(sum)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// readBreachedFile calls fn with the hash and count of each password of a
+// list. Counts default to 1; passwords listed in plain text are always
+// admitted.
+func readBreachedFile(path string, fn func(sum [sha1.Size]byte, count int)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		entry, countStr, hasCount := strings.Cut(line, ":")
+		sum, ok := parseSHA1(entry)
+		if !ok {
+			fn(sha1.Sum([]byte(line)), math.MaxInt)
+			continue
+		}
+		count := 1
+		if hasCount {
+			if count, err = strconv.Atoi(strings.TrimSpace(countStr)); err != nil {
+				return fmt.Errorf("%s: malformed line %q", path, line)
+			}
+		}
+		fn(sum, count)
+	}
+	return s.Err()
+}
+
+// parseSHA1 decodes a hex SHA-1 hash.
+func parseSHA1(s string) (sum [sha1.Size]byte, ok bool) {
+	if len(s) != 2*sha1.Size {
+		return sum, false
+	}
+	_, err := hex.Decode(sum[:], []byte(s))
+	return sum, err == nil
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package password
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ExpiryPolicy defines how long passwords stay valid. An identity gets the
+// shortest of the ages that apply to it; zero never expires.
+type ExpiryPolicy struct {
+	// MaxAge applies to every identity.
+	MaxAge time.Duration
+	// NetworkMaxAge holds ages by network ID.
+	NetworkMaxAge map[string]time.Duration
+	// RoleMaxAge holds ages by role name or ID.
+	RoleMaxAge map[string]time.Duration
+}
+
+// Validate checks the configuration of p.
+func (p *ExpiryPolicy) Validate() error {
+	if p.MaxAge < 0 {
+		return fmt.Errorf("max_age must not be negative, got %s", p.MaxAge)
+	}
+	for network, age := range p.NetworkMaxAge {
+		if age < 0 {
+			return fmt.Errorf("max age of network %s must not be negative, got %s", network, age)
+		}
+	}
+	for role, age := range p.RoleMaxAge {
+		if age < 0 {
+			return fmt.Errorf("max age of role %s must not be negative, got %s", role, age)
+		}
+	}
+	return nil
+}
+
+// HasRoles reports whether ages depend on roles.
+func (p *ExpiryPolicy) HasRoles() bool {
+	return len(p.RoleMaxAge) > 0
+}
+
+// MaxAgeFor returns the maximum password age of an identity of a network
+// that has been granted roles, which are given by name and ID. Keys match
+// case-insensitively, as configuration keys are lower-cased.
+func (p *ExpiryPolicy) MaxAgeFor(networkID string, roles []string) time.Duration {
+	age := p.MaxAge
+	shorten := func(ages map[string]time.Duration, key string) {
+		for k, d := range ages {
+			if strings.EqualFold(k, key) && d > 0 && (age == 0 || d < age) {
+				age = d
+			}
+		}
+	}
+	shorten(p.NetworkMaxAge, networkID)
+	for _, r := range roles {
+		shorten(p.RoleMaxAge, r)
+	}
+	return age
+}
+
+// Expired reports whether a password set at changedAt has expired at now.
+// Passwords of unknown age never expire.
+func (p *ExpiryPolicy) Expired(changedAt *time.Time, networkID string, roles []string, now time.Time) bool {
+	if changedAt == nil {
+		return false
+	}
+	age := p.MaxAgeFor(networkID, roles)
+	return age > 0 && now.Sub(*changedAt) >= age
+}
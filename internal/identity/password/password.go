@@ -0,0 +1,219 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package password implements the policy new passwords must satisfy.
+package password
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultMinLength is the minimum password length in characters.
+	DefaultMinLength = 8
+	// DefaultMaxLength is the maximum password length in characters.
+	DefaultMaxLength = 128
+	// MaxMaxLength bounds the configurable maximum length, so that the
+	// hashing and comparison cost of a password stays small.
+	MaxMaxLength = 1024
+	// MaxHistorySize bounds the number of remembered passwords, as every
+	// new password is compared with each of their hashes.
+	MaxHistorySize = 24
+)
+
+// Rules a password can violate.
+const (
+	RuleMinLength        = "min_length"
+	RuleMaxLength        = "max_length"
+	RuleCharacterClasses = "character_classes"
+	RuleSimilarity       = "similarity"
+	RuleHistory          = "history"
+	RuleBreached         = "breached"
+)
+
+// Class is a character class.
+type Class string
+
+const (
+	ClassLower  Class = "lower"
+	ClassUpper  Class = "upper"
+	ClassDigit  Class = "digit"
+	ClassSymbol Class = "symbol"
+)
+
+// classes lists all character classes.
+var classes = []Class{ClassLower, ClassUpper, ClassDigit, ClassSymbol}
+
+// ParseClass returns the character class named s.
+func ParseClass(s string) (Class, error) {
+	for _, c := range classes {
+		if string(c) == s {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("unknown character class %q", s)
+}
+
+// classOf returns the character class of r.
+func classOf(r rune) Class {
+	switch {
+	case unicode.IsLower(r):
+		return ClassLower
+	case unicode.IsUpper(r):
+		return ClassUpper
+	case unicode.IsDigit(r):
+		return ClassDigit
+	default:
+		return ClassSymbol
+	}
+}
+
+// Policy holds the rules passwords must satisfy.
+type Policy struct {
+	// MinLength and MaxLength bound the length in characters.
+	MinLength int
+	MaxLength int
+	// MinClasses is the number of character classes a password must mix.
+	MinClasses int
+	// RequiredClasses are the character classes every password contains.
+	RequiredClasses []Class
+	// CheckSimilarity rejects passwords that resemble an identifier or a
+	// trait of the identity.
+	CheckSimilarity bool
+	// HistorySize is the number of recent passwords that cannot be reused,
+	// at most MaxHistorySize; zero allows any reuse.
+	HistorySize int
+	// Breached, when set, rejects passwords known from data breaches.
+	Breached BreachedList
+}
+
+// DefaultPolicy returns the policy used when none is configured.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MinLength:       DefaultMinLength,
+		MaxLength:       DefaultMaxLength,
+		CheckSimilarity: true,
+	}
+}
+
+// Validate checks the configuration of p.
+func (p *Policy) Validate() error {
+	switch {
+	case p.MinLength < 1:
+		return fmt.Errorf("min_length must be at least 1, got %d", p.MinLength)
+	case p.MaxLength < p.MinLength || p.MaxLength > MaxMaxLength:
+		return fmt.Errorf("max_length must be between min_length and %d, got %d", MaxMaxLength, p.MaxLength)
+	case p.MinClasses < 0 || p.MinClasses > len(classes):
+		return fmt.Errorf("min_character_classes must be between 0 and %d, got %d", len(classes), p.MinClasses)
+	case p.HistorySize < 0 || p.HistorySize > MaxHistorySize:
+		return fmt.Errorf("history_size must be between 0 and %d, got %d", MaxHistorySize, p.HistorySize)
+	}
+	return nil
+}
+
+// Subject describes the identity a password is checked for.
+type Subject struct {
+	// Identifiers are the login identifiers of the password.
+	Identifiers []string
+	// Traits are the traits of the identity; their string values are
+	// compared with the password.
+	Traits json.RawMessage
+	// Reused reports whether the password matches one of the recent
+	// passwords of the identity. It is only called when the policy keeps
+	// a history.
+	Reused func(password string) (bool, error)
+}
+
+// Violation is a rule a password violates.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists the rules a password violates.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password policy violated: " + strings.Join(messages, "; ")
+}
+
+// Check returns a *PolicyError listing the rules password violates, or an
+// error when a rule cannot be checked. A password over the maximum length
+// is rejected without checking the other rules.
+func (p *Policy) Check(password string, s *Subject) error {
+	if s == nil {
+		s = &Subject{}
+	}
+	var violations []Violation
+	add := func(rule, format string, args ...any) {
+		violations = append(violations, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if p.MaxLength > 0 && length > p.MaxLength {
+		add(RuleMaxLength, "password must be at most %d characters long", p.MaxLength)
+		return &PolicyError{Violations: violations}
+	}
+	if length < p.MinLength {
+		add(RuleMinLength, "password must be at least %d characters long", p.MinLength)
+	}
+
+	present := make(map[Class]bool, len(classes))
+	for _, r := range password {
+		present[classOf(r)] = true
+	}
+	var missing []string
+	for _, c := range p.RequiredClasses {
+		if !present[c] {
+			missing = append(missing, string(c))
+		}
+	}
+	switch {
+	case len(missing) > 0:
+		add(RuleCharacterClasses, "password must contain %s characters", strings.Join(missing, ", "))
+	case len(present) < p.MinClasses:
+		add(RuleCharacterClasses, "password must mix at least %d of lower, upper, digit and symbol characters", p.MinClasses)
+	}
+
+	if p.CheckSimilarity && password != "" {
+		if similar(password, candidates(s)) {
+			add(RuleSimilarity, "password is too similar to an identifier or trait")
+		}
+	}
+
+	if p.HistorySize > 0 && s.Reused != nil {
+		reused, err := s.Reused(password)
+		if err != nil {
+			return err
+		}
+		if reused {
+			add(RuleHistory, "password must differ from the last %d passwords", p.HistorySize)
+		}
+	}
+
+	if p.Breached != nil && password != "" {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			add(RuleBreached, "password has appeared in a data breach")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func rules(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var perr *PolicyError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a *PolicyError, got %v", err)
+	}
+	var out []string
+	for _, v := range perr.Violations {
+		out = append(out, v.Rule)
+	}
+	return out
+}
+
+func TestPolicyCheck(t *testing.T) {
+	policy := &Policy{
+		MinLength:       8,
+		MaxLength:       16,
+		MinClasses:      3,
+		RequiredClasses: []Class{ClassDigit},
+		CheckSimilarity: true,
+		HistorySize:     3,
+	}
+	subject := &Subject{
+		Identifiers: []string{"Ann.Smith@example.com"},
+		Traits:      json.RawMessage(`{"name":{"first":"Annabelle","last":"Smith"},"tags":["falcon"]}`),
+		Reused:      func(p string) (bool, error) { return p == "Old-pass-99", nil },
+	}
+
+	for _, tc := range []struct {
+		password string
+		want     []string
+	}{
+		{"Tr0ub4dor&3", nil},
+		{"short1A", []string{RuleMinLength}},
+		{"averylongpassword-X1", []string{RuleMaxLength}},
+		{"NoDigitsHere!", []string{RuleCharacterClasses}},
+		{"lowercase123", []string{RuleCharacterClasses}},
+		{"annsmith-2024X", []string{RuleSimilarity}},
+		{"My-Falcon-77x", []string{RuleSimilarity}},
+		{"Annabelle1!", []string{RuleSimilarity}},
+		{"Old-pass-99", []string{RuleHistory}},
+		{"", []string{RuleMinLength, RuleCharacterClasses}},
+	} {
+		if got := rules(t, policy.Check(tc.password, subject)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: violations %v, want %v", tc.password, got, tc.want)
+		}
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	for _, tc := range []struct {
+		history int
+		valid   bool
+	}{
+		{0, true},
+		{MaxHistorySize, true},
+		{-1, false},
+		{MaxHistorySize + 1, false},
+		{1 << 30, false},
+	} {
+		p := DefaultPolicy()
+		p.HistorySize = tc.history
+		if err := p.Validate(); (err == nil) != tc.valid {
+			t.Errorf("Validate() with history_size %d error = %v, want valid %t", tc.history, err, tc.valid)
+		}
+	}
+}
+
+func TestLoadBreachedList(t *testing.T) {
+	dir := t.TempDir()
+	hash := func(p string) string {
+		sum := sha1.Sum([]byte(p))
+		return strings.ToUpper(hex.EncodeToString(sum[:]))
+	}
+
+	file := filepath.Join(dir, "breached.txt")
+	content := hash("password1") + ":42\n" + strings.ToLower(hash("rarely")) + ":1\n" + "letmein\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ranges := filepath.Join(dir, "ranges")
+	if err := os.Mkdir(ranges, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"password1", "rarely"} {
+		h := hash(p)
+		count := map[string]string{"password1": "42", "rarely": "1"}[p]
+		line := "0000000000000000000000000000000000A:0\r\n" + h[5:] + ":" + count + "\r\n"
+		if err := os.WriteFile(filepath.Join(ranges, h[:5]+".txt"), []byte(line), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, path := range []string{file, ranges} {
+		list, err := LoadBreachedList(path, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for p, want := range map[string]bool{
+			"password1":   true,
+			"rarely":      false,
+			"Tr0ub4dor&3": false,
+		} {
+			if got, err := list.Contains(p); err != nil || got != want {
+				t.Errorf("%s: Contains(%q) = %v, %v; want %v", filepath.Base(path), p, got, err, want)
+			}
+		}
+	}
+
+	list, err := LoadBreachedList(file, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := list.Contains("letmein"); !ok {
+		t.Error("expected a password listed in plain text to be breached")
+	}
+}
+
+func TestExpiryPolicy(t *testing.T) {
+	policy := &ExpiryPolicy{
+		MaxAge:        90 * 24 * time.Hour,
+		NetworkMaxAge: map[string]time.Duration{"net-a": 180 * 24 * time.Hour, "net-b": 30 * 24 * time.Hour},
+		RoleMaxAge:    map[string]time.Duration{"admin": 7 * 24 * time.Hour, "guest": 0},
+	}
+	now := time.Now()
+	changed := now.Add(-10 * 24 * time.Hour)
+
+	for _, tc := range []struct {
+		network string
+		roles   []string
+		want    time.Duration
+		expired bool
+	}{
+		{"", nil, 90 * 24 * time.Hour, false},
+		{"net-a", []string{"guest"}, 90 * 24 * time.Hour, false},
+		{"NET-B", nil, 30 * 24 * time.Hour, false},
+		{"net-a", []string{"Admin"}, 7 * 24 * time.Hour, true},
+	} {
+		if got := policy.MaxAgeFor(tc.network, tc.roles); got != tc.want {
+			t.Errorf("MaxAgeFor(%q, %q) = %s, want %s", tc.network, tc.roles, got, tc.want)
+		}
+		if got := policy.Expired(&changed, tc.network, tc.roles, now); got != tc.expired {
+			t.Errorf("Expired(%q, %q) = %v, want %v", tc.network, tc.roles, got, tc.expired)
+		}
+	}
+	if policy.Expired(nil, "net-b", []string{"admin"}, now) {
+		t.Error("expected a password of unknown age not to expire")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package password
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+)
+
+const (
+	// minSimilarLength is the length from which a common substring counts
+	// as similarity.
+	minSimilarLength = 3
+	// minContainedLength is the length from which a trait contained in the
+	// password counts as similarity.
+	minContainedLength = 4
+	// maxCandidateLength bounds the part of a trait that is compared.
+	maxCandidateLength = 256
+)
+
+// candidates returns the normalized identifiers and string traits of s.
+// The local part of email addresses is added on its own.
+func candidates(s *Subject) [][]rune {
+	var values []string
+	for _, id := range s.Identifiers {
+		values = append(values, id)
+		if at := strings.LastIndexByte(id, '@'); at > 0 {
+			values = append(values, id[:at])
+		}
+	}
+	if len(s.Traits) > 0 {
+		var traits any
+		if json.Unmarshal(s.Traits, &traits) == nil {
+			values = appendStrings(values, traits)
+		}
+	}
+
+	out := make([][]rune, 0, len(values))
+	for _, v := range values {
+		if n := normalize(v); len(n) >= minSimilarLength {
+			out = append(out, n[:min(len(n), maxCandidateLength)])
+		}
+	}
+	return out
+}
+
+// appendStrings appends the strings found in a decoded JSON value.
+func appendStrings(values []string, v any) []string {
+	switch v := v.(type) {
+	case string:
+		return append(values, v)
+	case []any:
+		for _, e := range v {
+			values = appendStrings(values, e)
+		}
+	case map[string]any:
+		for _, e := range v {
+			values = appendStrings(values, e)
+		}
+	}
+	return values
+}
+
+// normalize lower-cases s and drops everything but letters and digits, so
+// that "Ann.Smith" and "annsmith!" compare equal.
+func normalize(s string) []rune {
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			out = append(out, unicode.ToLower(r))
+		}
+	}
+	return out
+}
+
+// similar reports whether password contains one of the candidates, or
+// shares a substring with one that makes up half of the password.
+func similar(password string, candidates [][]rune) bool {
+	pw := normalize(password)
+	if len(pw) == 0 {
+		return false
+	}
+	for _, c := range candidates {
+		common := longestCommonSubstring(pw, c)
+		if common == len(c) && common >= minContainedLength {
+			return true
+		}
+		if common >= minSimilarLength && 2*common >= len(pw) {
+			return true
+		}
+	}
+	return false
+}
+
+// longestCommonSubstring returns the length of the longest substring a
+// and b have in common.
+func longestCommonSubstring(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	longest := 0
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+				longest = max(longest, cur[j+1])
+			} else {
+				cur[j+1] = 0
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return longest
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/coding-hui/iam/internal/identity/password"
+	"github.com/coding-hui/iam/pkg/code"
+
+	"github.com/coding-hui/common/errors"
+)
+
+// SetPasswordPolicy sets the policy new passwords must satisfy. The
+// manager starts with password.DefaultPolicy.
+func (m *ManagerImpl) SetPasswordPolicy(p *password.Policy) {
+	m.policy = p
+}
+
+// newPasswordHash checks plain against the password policy and hashes it,
+// or validates hashed when a hash is imported instead. Imported hashes
+// cannot be checked against the policy. current is the identity the
+// password is set for; it is nil for new identities.
+func (m *ManagerImpl) newPasswordHash(ctx context.Context, plain, hashed string, identifiers []string, traits json.RawMessage, current *Identity) ([]byte, error) {
+	if hashed != "" {
+		if plain != "" {
+			return nil, errors.WithCode(code.ErrIdentityCredentialsInvalid, "password and hashed_password are mutually exclusive")
+		}
+		if err := ValidateImportedHash([]byte(hashed)); err != nil {
+			return nil, errors.WrapC(err, code.ErrIdentityCredentialsInvalid, "%s", err.Error())
+		}
+		return []byte(hashed), nil
+	}
+	if plain == "" {
+		return nil, errors.WithCode(code.ErrIdentityCredentialsInvalid, "password must not be empty")
+	}
+
+	if m.policy != nil {
+		subject := &password.Subject{Identifiers: identifiers, Traits: traits}
+		if current != nil {
+			subject.Reused = func(plain string) (bool, error) {
+				return m.passwordReused(ctx, current, plain)
+			}
+		}
+		if err := m.policy.Check(plain, subject); err != nil {
+			var perr *password.PolicyError
+			if errors.As(err, &perr) {
+				return nil, errors.WrapC(err, code.ErrIdentityPasswordPolicyViolated, "%s", err.Error())
+			}
+			return nil, err
+		}
+	}
+	return m.hasher.Hash(plain)
+}
+
+// passwordReused reports whether plain matches the current password of
+// identity or one in its password history.
+func (m *ManagerImpl) passwordReused(ctx context.Context, identity *Identity, plain string) (bool, error) {
+	hashes, err := m.pool.ListPasswordHistory(ctx, identity.ID, m.policy.HistorySize)
+	if err != nil {
+		return false, err
+	}
+	if cred, ok := identity.Credentials[CredentialsTypePassword]; ok {
+		if len(hashes) == 0 || !bytes.Equal(hashes[0], cred.Config) {
+			hashes = append(hashes, cred.Config)
+		}
+	}
+	for _, hash := range hashes {
+		if m.hasher.Verify(plain, hash) == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordPassword adds the hash of a password set for an identity to its
+// password history when the policy keeps one.
+func (m *ManagerImpl) recordPassword(ctx context.Context, identity *Identity, hash []byte) error {
+	if m.policy == nil || m.policy.HistorySize == 0 {
+		return nil
+	}
+	return m.privPool.AddPasswordHistory(ctx, identity.ID, hash, m.policy.HistorySize)
+}
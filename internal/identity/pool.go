@@ -6,10 +6,14 @@ package identity
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 
 	"github.com/coding-hui/iam/internal/persistence"
+	"github.com/coding-hui/iam/pkg/identifier"
 )
 
 // identityPool implements Pool using persistence.IdentityPersister.
@@ -20,10 +24,29 @@ type identityPool struct {
 // identityPersister is the persistence interface for identity operations.
 type identityPersister interface {
 	GetIdentity(ctx context.Context, id string) (*persistence.Identity, error)
-	ListIdentities(ctx context.Context, networkID string, limit, offset int) ([]*persistence.Identity, int, error)
+	GetDeletedIdentity(ctx context.Context, id string) (*persistence.Identity, error)
+	ListIdentities(ctx context.Context, networkID string, limit, offset int, filter *persistence.IdentityFilter) ([]*persistence.Identity, int, error)
 	CreateIdentity(ctx context.Context, identity *persistence.Identity) error
 	UpdateIdentity(ctx context.Context, identity *persistence.Identity) error
 	DeleteIdentity(ctx context.Context, id string) error
+	SoftDeleteIdentity(ctx context.Context, networkID, id string, at time.Time) error
+	RestoreIdentity(ctx context.Context, networkID, id string) error
+	ListIdentitiesDeletedBefore(ctx context.Context, before time.Time, limit, offset int) ([]*persistence.Identity, error)
+	ListIdentitiesBySchema(ctx context.Context, schemaID string, version int, after string, limit int) ([]*persistence.Identity, error)
+	GetIdentityCredentials(ctx context.Context, identityID string) ([]*persistence.IdentityCredentials, error)
+	FindCredentialsByIdentifier(ctx context.Context, networkID, credType, identifier string) (*persistence.IdentityCredentials, error)
+	CreateCredentials(ctx context.Context, c *persistence.IdentityCredentials) error
+	UpdateCredentials(ctx context.Context, c *persistence.IdentityCredentials) error
+	DeleteCredentials(ctx context.Context, identityID, credType string) error
+	ListPasswordHistory(ctx context.Context, identityID string, limit int) ([][]byte, error)
+	AddPasswordHistory(ctx context.Context, identityID string, hash []byte, keep int) error
+	ListVerifiableAddresses(ctx context.Context, identityID string) ([]*persistence.IdentityVerifiableAddress, error)
+	GetVerifiableAddress(ctx context.Context, id string) (*persistence.IdentityVerifiableAddress, error)
+	FindVerifiableAddress(ctx context.Context, networkID, via, value string) (*persistence.IdentityVerifiableAddress, error)
+	UpdateVerifiableAddress(ctx context.Context, a *persistence.IdentityVerifiableAddress) error
+	CreateIdentityVersion(ctx context.Context, v *persistence.IdentityVersion) error
+	ListIdentityVersions(ctx context.Context, identityID string) ([]*persistence.IdentityVersion, error)
+	LatestIdentityVersion(ctx context.Context, identityID string) (int, error)
 }
 
 // NewPool creates a new identity pool.
@@ -52,14 +75,67 @@ func (p *identityPool) GetIdentityByNetworkID(ctx context.Context, networkID, id
 	return p.modelToDomain(m), nil
 }
 
-// GetIdentityByIdentifier retrieves an identity by identifier (e.g., email).
-func (p *identityPool) GetIdentityByIdentifier(ctx context.Context, identifier string) (*Identity, error) {
-	return nil, ErrIdentityNotFound
+// GetDeletedIdentity retrieves an identity that is deleted but not yet
+// purged.
+func (p *identityPool) GetDeletedIdentity(ctx context.Context, id uuid.UUID) (*Identity, error) {
+	m, err := p.persister.GetDeletedIdentity(ctx, id.String())
+	if err != nil {
+		return nil, notFoundError(err)
+	}
+	return p.modelToDomain(m), nil
+}
+
+// GetIdentityWithCredentials retrieves an identity by ID together with its credentials.
+func (p *identityPool) GetIdentityWithCredentials(ctx context.Context, id uuid.UUID) (*Identity, error) {
+	identity, err := p.GetIdentity(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := p.ListCredentials(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	identity.Credentials = make(map[CredentialsType]*Credentials, len(creds))
+	for _, c := range creds {
+		identity.Credentials[c.Type] = c
+	}
+	return identity, nil
+}
+
+// ListCredentials lists the credentials of an identity, including a
+// deleted one.
+func (p *identityPool) ListCredentials(ctx context.Context, id uuid.UUID) ([]*Credentials, error) {
+	ms, err := p.persister.GetIdentityCredentials(ctx, id.String())
+	if err != nil {
+		return nil, err
+	}
+	creds := make([]*Credentials, len(ms))
+	for i, m := range ms {
+		creds[i] = p.credentialsToDomain(m)
+	}
+	return creds, nil
 }
 
-// ListIdentities lists identities with pagination.
-func (p *identityPool) ListIdentities(ctx context.Context, networkID uuid.UUID, limit, offset int) ([]*Identity, int, error) {
-	ms, total, err := p.persister.ListIdentities(ctx, networkID.String(), limit, offset)
+// GetIdentityByIdentifier retrieves an identity of a network by identifier
+// (e.g., email) of credentials of any type.
+func (p *identityPool) GetIdentityByIdentifier(ctx context.Context, networkID uuid.UUID, identifier string) (*Identity, error) {
+	identity, _, err := p.FindCredentialsByIdentifier(ctx, networkID, "", identifier)
+	return identity, err
+}
+
+// ListIdentities lists identities matching filter with pagination.
+func (p *identityPool) ListIdentities(ctx context.Context, networkID uuid.UUID, limit, offset int, filter *ListFilter) ([]*Identity, int, error) {
+	var pf *persistence.IdentityFilter
+	if filter != nil {
+		pf = &persistence.IdentityFilter{
+			SchemaID: filter.SchemaID,
+			Where:    filter.Where,
+			SortBy:   filter.SortBy,
+			SortDesc: filter.SortDesc,
+			Deleted:  filter.Deleted,
+		}
+	}
+	ms, total, err := p.persister.ListIdentities(ctx, networkID.String(), limit, offset, pf)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -70,22 +146,186 @@ func (p *identityPool) ListIdentities(ctx context.Context, networkID uuid.UUID,
 	return identities, total, nil
 }
 
-// FindCredentialsByIdentifier finds an identity and credentials by identifier.
-func (p *identityPool) FindCredentialsByIdentifier(ctx context.Context, credType CredentialsType, identifier string) (*Identity, *Credentials, error) {
-	return nil, nil, ErrIdentityNotFound
+// ListIdentitiesBySchema lists identities at a schema version ordered by ID,
+// starting after the given ID.
+func (p *identityPool) ListIdentitiesBySchema(ctx context.Context, schemaID string, version int, after uuid.UUID, limit int) ([]*Identity, error) {
+	ms, err := p.persister.ListIdentitiesBySchema(ctx, schemaID, version, after.String(), limit)
+	if err != nil {
+		return nil, err
+	}
+	identities := make([]*Identity, len(ms))
+	for i := range ms {
+		identities[i] = p.modelToDomain(ms[i])
+	}
+	return identities, nil
+}
+
+// FindCredentialsByIdentifier finds an identity of a network and its
+// credentials by identifier; an empty credType matches any type.
+// Identifiers are unique per network only. Identifiers are looked
+// up in the normalized form of password identifiers first, see
+// NormalizeIdentifiers, and then verbatim, which finds identifiers of
+// other types and password identifiers that could not be normalized when
+// existing credentials were migrated.
+func (p *identityPool) FindCredentialsByIdentifier(ctx context.Context, networkID uuid.UUID, credType CredentialsType, value string) (*Identity, *Credentials, error) {
+	type lookup struct {
+		credType CredentialsType
+		value    string
+	}
+	lookups := []lookup{{credType, value}}
+	if credType == "" || credType == CredentialsTypePassword {
+		if normalized, err := identifier.Normalize(value); err == nil && normalized != value {
+			lookups = append([]lookup{{CredentialsTypePassword, normalized}}, lookups...)
+		}
+	}
+
+	var (
+		m   *persistence.IdentityCredentials
+		err error
+	)
+	for _, l := range lookups {
+		if m, err = p.persister.FindCredentialsByIdentifier(ctx, networkID.String(), string(l.credType), l.value); !errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrIdentityNotFound
+		}
+		return nil, nil, err
+	}
+	cred := p.credentialsToDomain(m)
+
+	identity, err := p.GetIdentity(ctx, cred.IdentityID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return identity, cred, nil
+}
+
+// ListPasswordHistory returns up to limit of the most recent password hashes
+// of an identity, newest first.
+func (p *identityPool) ListPasswordHistory(ctx context.Context, id uuid.UUID, limit int) ([][]byte, error) {
+	return p.persister.ListPasswordHistory(ctx, id.String(), limit)
+}
+
+// ListVerifiableAddresses lists the addresses of an identity.
+func (p *identityPool) ListVerifiableAddresses(ctx context.Context, id uuid.UUID) ([]*VerifiableAddress, error) {
+	ms, err := p.persister.ListVerifiableAddresses(ctx, id.String())
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]*VerifiableAddress, len(ms))
+	for i, m := range ms {
+		addrs[i] = addressToDomain(m)
+	}
+	return addrs, nil
+}
+
+// GetVerifiableAddress retrieves an address by ID.
+func (p *identityPool) GetVerifiableAddress(ctx context.Context, id uuid.UUID) (*VerifiableAddress, error) {
+	m, err := p.persister.GetVerifiableAddress(ctx, id.String())
+	if err != nil {
+		return nil, addressNotFoundError(err)
+	}
+	return addressToDomain(m), nil
+}
+
+// FindVerifiableAddress finds an address of a live identity of a network
+// by channel and value, which is normalized with NormalizeAddress.
+func (p *identityPool) FindVerifiableAddress(ctx context.Context, networkID uuid.UUID, via, value string) (*VerifiableAddress, error) {
+	m, err := p.persister.FindVerifiableAddress(ctx, networkID.String(), via, NormalizeAddress(value))
+	if err != nil {
+		return nil, addressNotFoundError(err)
+	}
+	return addressToDomain(m), nil
+}
+
+// ListVersions lists the versions of an identity, newest first.
+func (p *identityPool) ListVersions(ctx context.Context, id uuid.UUID) ([]*Version, error) {
+	ms, err := p.persister.ListIdentityVersions(ctx, id.String())
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]*Version, len(ms))
+	for i, m := range ms {
+		versions[i] = &Version{
+			ID:         parseUUID(m.ID),
+			IdentityID: parseUUID(m.IdentityID),
+			NetworkID:  parseUUID(m.NetworkID),
+			Version:    m.Version,
+			Action:     VersionAction(m.Action),
+			ActorID:    parseUUID(m.ActorID),
+			ActorType:  m.ActorType,
+			RequestID:  m.RequestID,
+			Traits:     m.Traits,
+			State:      State(m.State),
+			CreatedAt:  m.CreatedAt,
+		}
+	}
+	return versions, nil
+}
+
+// LatestVersion returns the newest version number of an identity, or 0
+// when it has no versions.
+func (p *identityPool) LatestVersion(ctx context.Context, id uuid.UUID) (int, error) {
+	return p.persister.LatestIdentityVersion(ctx, id.String())
 }
 
 func (p *identityPool) modelToDomain(m *persistence.Identity) *Identity {
 	if m == nil {
 		return nil
 	}
+	state := State(m.State)
+	if state == "" {
+		state = StateActive
+	}
+	typ := Type(m.Type)
+	if typ == "" {
+		typ = TypeUser
+	}
 	return &Identity{
-		ID:        parseUUID(m.ID),
-		NetworkID: parseUUID(m.NetworkID),
-		SchemaID:  m.SchemaID,
-		Traits:    m.Traits,
-		CreatedAt: m.CreatedAt,
-		UpdatedAt: m.UpdatedAt,
+		ID:             parseUUID(m.ID),
+		NetworkID:      parseUUID(m.NetworkID),
+		Type:           typ,
+		SchemaID:       m.SchemaID,
+		SchemaVersion:  m.SchemaVersion,
+		Traits:         m.Traits,
+		MetadataPublic: m.MetadataPublic,
+		MetadataAdmin:  m.MetadataAdmin,
+		State:          state,
+		StateChangedAt: m.StateChangedAt,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+		DeletedAt:      m.DeletedAt,
+	}
+}
+
+func (p *identityPool) credentialsToDomain(m *persistence.IdentityCredentials) *Credentials {
+	return &Credentials{
+		ID:                     parseUUID(m.ID),
+		IdentityID:             parseUUID(m.IdentityID),
+		Type:                   CredentialsType(m.Type),
+		Identifiers:            m.Identifiers,
+		Config:                 m.Config,
+		PasswordChangedAt:      m.PasswordChangedAt,
+		PasswordChangeRequired: m.PasswordChangeRequired,
+		CreatedAt:              m.CreatedAt,
+		UpdatedAt:              m.UpdatedAt,
+	}
+}
+
+func addressToDomain(m *persistence.IdentityVerifiableAddress) *VerifiableAddress {
+	return &VerifiableAddress{
+		ID:         parseUUID(m.ID),
+		IdentityID: parseUUID(m.IdentityID),
+		Value:      m.Value,
+		Via:        m.Via,
+		Status:     VerifiableAddressStatus(m.Status),
+		Verified:   m.Verified,
+		VerifiedAt: m.VerifiedAt,
+		CreatedAt:  m.CreatedAt,
+		UpdatedAt:  m.UpdatedAt,
 	}
 }
 
@@ -0,0 +1,77 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package privacy
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+)
+
+// ArchiveContentType is the media type of export archives.
+const ArchiveContentType = "application/gzip"
+
+// WriteArchive writes e to w as a gzipped tar archive holding a JSON file
+// per kind of data, listed in the manifest.
+func WriteArchive(w io.Writer, e *Export) error {
+	entries := []struct {
+		name string
+		data any
+	}{
+		{IdentityFile, e.Identity},
+		{CredentialsFile, nonNil(e.Credentials)},
+		{SessionsFile, nonNil(e.Sessions)},
+		{TokensFile, nonNil(e.Tokens)},
+		{RoleBindingsFile, nonNil(e.RoleBindings)},
+		{AuditEventsFile, nonNil(e.AuditEvents)},
+		{HistoryFile, nonNil(e.History)},
+	}
+	manifest := *e.Manifest
+	manifest.Files = make([]string, len(entries))
+	for i, entry := range entries {
+		manifest.Files[i] = entry.name
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	write := func(name string, v any) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o644,
+			Size:    int64(len(data)),
+			ModTime: manifest.GeneratedAt,
+		}); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	}
+
+	if err := write(ManifestFile, &manifest); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := write(entry.name, entry.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// nonNil makes empty lists encode as [] instead of null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package privacy
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/identity"
+)
+
+func TestWriteArchive(t *testing.T) {
+	id := uuid.New()
+	export := &Export{
+		Manifest: &Manifest{FormatVersion: FormatVersion, IdentityID: id, GeneratedAt: time.Now()},
+		Identity: &identity.Identity{ID: id, Traits: json.RawMessage(`{"email":"ann@example.com"}`)},
+		Tokens:   []*Token{{ID: uuid.New(), Type: "recovery"}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, export); err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	files := map[string][]byte{}
+	var names []string
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, h.Name)
+		files[h.Name] = data
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(files[ManifestFile], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if names[0] != ManifestFile || !reflect.DeepEqual(manifest.Files, names[1:]) {
+		t.Errorf("manifest lists %v, archive holds %v", manifest.Files, names)
+	}
+	if manifest.IdentityID != id {
+		t.Errorf("manifest identity %s, want %s", manifest.IdentityID, id)
+	}
+	if got := string(files[SessionsFile]); got != "[]" {
+		t.Errorf("sessions = %s, want []", got)
+	}
+	if bytes.Contains(files[TokensFile], []byte(`"value"`)) {
+		t.Errorf("tokens expose their values: %s", files[TokensFile])
+	}
+}
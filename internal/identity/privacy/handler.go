@@ -0,0 +1,94 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package privacy
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/pkg/api"
+
+	"github.com/coding-hui/common/errors"
+)
+
+// Handler handles HTTP requests for data subject requests.
+type Handler struct {
+	manager Manager
+}
+
+// NewHandler creates a new privacy handler.
+func NewHandler(manager Manager) *Handler {
+	return &Handler{manager: manager}
+}
+
+// Export handles GET /api/v1/identities/:id/data-export.
+// It sends everything known about the identity as an archive, see
+// WriteArchive.
+func (h *Handler) Export(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return
+	}
+
+	export, err := h.manager.Export(c.Request.Context(), id, request(c))
+	if err != nil {
+		failWithError(err, c)
+		return
+	}
+
+	c.Header("Content-Type", ArchiveContentType)
+	c.Header("Content-Disposition", `attachment; filename="identity-`+id.String()+`.tar.gz"`)
+	c.Status(http.StatusOK)
+	if err := WriteArchive(c.Writer, export); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// Erase handles POST /api/v1/identities/:id/erase.
+// The identity is purged right away and pseudonymized in the audit trail;
+// this cannot be undone.
+func (h *Handler) Erase(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return
+	}
+
+	report, err := h.manager.Erase(c.Request.Context(), id, request(c))
+	if err != nil {
+		failWithError(err, c)
+		return
+	}
+
+	api.OkWithData(report, c)
+}
+
+func failWithError(err error, c *gin.Context) {
+	if errors.Is(err, identity.ErrIdentityNotFound) {
+		api.FailWithMessage(err.Error(), c)
+		return
+	}
+	api.FailWithErrCode(err, c)
+}
+
+// request returns the network and origin of a data subject request.
+func request(c *gin.Context) *Request {
+	req := &Request{
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		RequestID: c.GetHeader("X-Request-ID"),
+	}
+	if networkID, err := uuid.Parse(c.GetString("network_id")); err == nil {
+		req.NetworkID = networkID
+	}
+	if actorID, err := uuid.Parse(c.GetString("identity_id")); err == nil {
+		req.ActorID = actorID
+	}
+	return req
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package privacy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/coding-hui/iam/internal/audit"
+	"github.com/coding-hui/iam/internal/authz/role"
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/session"
+	"github.com/coding-hui/iam/internal/identity/token"
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// auditPageSize is the number of audit events loaded at a time by Export.
+const auditPageSize = 500
+
+// ManagerImpl implements privacy.Manager.
+type ManagerImpl struct {
+	persister  persistence.Persister
+	identities identity.Manager
+	pool       identity.Pool
+	sessions   session.Pool
+	tokens     token.Pool
+	roles      role.Pool
+	audit      audit.Manager
+}
+
+// NewManagerImpl creates a new privacy manager. Identities are erased
+// with identities, which purges everything issued to them.
+func NewManagerImpl(persister persistence.Persister, identities identity.Manager, pool identity.Pool, sessions session.Pool, tokens token.Pool, roles role.Pool, audit audit.Manager) *ManagerImpl {
+	return &ManagerImpl{
+		persister:  persister,
+		identities: identities,
+		pool:       pool,
+		sessions:   sessions,
+		tokens:     tokens,
+		roles:      roles,
+		audit:      audit,
+	}
+}
+
+// Export collects everything known about an identity of req.NetworkID,
+// including a deleted one, and records the export in the audit trail.
+func (m *ManagerImpl) Export(ctx context.Context, id uuid.UUID, req *Request) (*Export, error) {
+	ident, err := m.identity(ctx, id, req.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+	export := &Export{
+		Manifest: &Manifest{
+			FormatVersion: FormatVersion,
+			IdentityID:    ident.ID,
+			NetworkID:     ident.NetworkID,
+			GeneratedAt:   time.Now(),
+		},
+		Identity: ident,
+	}
+
+	if ident.VerifiableAddresses, err = m.pool.ListVerifiableAddresses(ctx, id); err != nil {
+		return nil, err
+	}
+	if export.Credentials, err = m.pool.ListCredentials(ctx, id); err != nil {
+		return nil, err
+	}
+	if export.Sessions, err = m.exportSessions(ctx, ident); err != nil {
+		return nil, err
+	}
+	if export.Tokens, err = m.exportTokens(ctx, ident); err != nil {
+		return nil, err
+	}
+	if export.RoleBindings, err = m.exportRoleBindings(ctx, ident); err != nil {
+		return nil, err
+	}
+	if export.AuditEvents, err = m.exportAuditEvents(ctx, ident); err != nil {
+		return nil, err
+	}
+	if export.History, err = m.pool.ListVersions(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := identity.SetPatches(export.History); err != nil {
+		return nil, err
+	}
+
+	if err := m.record(ctx, EventIdentityExported, ident.ID, req, nil); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// Erase purges an identity of req.NetworkID together with everything
+// issued to it and replaces its ID with a random pseudonym in the audit
+// trail, whose events are kept so that it stays complete. The erasure is
+// recorded under the pseudonym. Nothing is changed when any step fails.
+func (m *ManagerImpl) Erase(ctx context.Context, id uuid.UUID, req *Request) (*ErasureReport, error) {
+	report := &ErasureReport{IdentityID: id, Pseudonym: uuid.New()}
+	err := m.persister.Transaction(ctx, func(ctx context.Context) error {
+		if err := m.identities.PurgeIdentity(ctx, id, &identity.DeleteIdentityRequest{
+			NetworkID: req.NetworkID,
+			ActorID:   req.ActorID,
+			ClientIP:  req.ClientIP,
+			UserAgent: req.UserAgent,
+			RequestID: req.RequestID,
+		}); err != nil {
+			return err
+		}
+
+		n, err := m.audit.PseudonymizeSubject(ctx, id, report.Pseudonym)
+		if err != nil {
+			return err
+		}
+		report.AuditEvents = n
+		report.ErasedAt = time.Now()
+
+		return m.record(ctx, EventIdentityErased, report.Pseudonym, req, map[string]any{
+			"audit_events": n,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// identity returns an identity of a network whether it is deleted or not.
+func (m *ManagerImpl) identity(ctx context.Context, id, networkID uuid.UUID) (*identity.Identity, error) {
+	ident, err := m.pool.GetIdentityByNetworkID(ctx, networkID, id)
+	if err == nil {
+		return ident, nil
+	}
+	if !errors.Is(err, identity.ErrIdentityNotFound) && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	ident, err = m.pool.GetDeletedIdentity(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if ident.NetworkID != networkID {
+		return nil, identity.ErrIdentityNotFound
+	}
+	return ident, nil
+}
+
+func (m *ManagerImpl) exportSessions(ctx context.Context, ident *identity.Identity) ([]*Session, error) {
+	sessions, _, err := m.sessions.ListSessions(ctx, ident.NetworkID, ident.ID, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Session, len(sessions))
+	for i, s := range sessions {
+		out[i] = &Session{
+			Active:          s.Active,
+			AuthenticatedAt: s.AuthenticatedAt,
+			ExpiresAt:       s.ExpiresAt,
+			ClientIP:        s.ClientIP,
+			UserAgent:       s.UserAgent,
+			CreatedAt:       s.CreatedAt,
+			UpdatedAt:       s.UpdatedAt,
+		}
+	}
+	return out, nil
+}
+
+func (m *ManagerImpl) exportTokens(ctx context.Context, ident *identity.Identity) ([]*Token, error) {
+	tokens, err := m.tokens.ListTokens(ctx, ident.ID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Token, len(tokens))
+	for i, t := range tokens {
+		out[i] = &Token{
+			ID:        t.ID,
+			Type:      t.Type,
+			ExpiresAt: t.ExpiresAt,
+			CreatedAt: t.CreatedAt,
+		}
+	}
+	return out, nil
+}
+
+func (m *ManagerImpl) exportRoleBindings(ctx context.Context, ident *identity.Identity) ([]*RoleBinding, error) {
+	bindings, err := m.roles.ListRoleBindings(ctx, ident.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+	roles, _, err := m.roles.ListRoles(ctx, ident.NetworkID, -1, 0)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uuid.UUID]string, len(roles))
+	for _, r := range roles {
+		names[r.ID] = r.Name
+	}
+
+	out := []*RoleBinding{}
+	for _, b := range bindings {
+		if b.Subject != ident.ID.String() {
+			continue
+		}
+		out = append(out, &RoleBinding{
+			RoleID:    b.RoleID,
+			RoleName:  names[b.RoleID],
+			NetworkID: b.NetworkID,
+			CreatedAt: b.CreatedAt,
+		})
+	}
+	return out, nil
+}
+
+// exportAuditEvents returns the audit events an identity took part in.
+// The client details of events other actors caused on the identity are
+// theirs and are dropped.
+func (m *ManagerImpl) exportAuditEvents(ctx context.Context, ident *identity.Identity) ([]*audit.AuditEvent, error) {
+	out := []*audit.AuditEvent{}
+	for offset := 0; ; offset += auditPageSize {
+		events, total, err := m.audit.ListEventsBySubject(ctx, ident.ID, auditPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			if e.ActorID != ident.ID {
+				e.ClientIP = ""
+				e.UserAgent = ""
+			}
+			out = append(out, e)
+		}
+		if len(events) == 0 || offset+len(events) >= total {
+			return out, nil
+		}
+	}
+}
+
+// record writes an audit record of a data subject request.
+func (m *ManagerImpl) record(ctx context.Context, eventType string, target uuid.UUID, req *Request, metadata map[string]any) error {
+	var raw json.RawMessage
+	if metadata != nil {
+		var err error
+		if raw, err = json.Marshal(metadata); err != nil {
+			return err
+		}
+	}
+	return m.audit.RecordEvent(ctx, &audit.RecordEventRequest{
+		NetworkID:  req.NetworkID,
+		Type:       eventType,
+		ActorID:    req.ActorID,
+		ActorType:  "admin",
+		TargetID:   target,
+		TargetType: "identity",
+		Outcome:    "success",
+		ClientIP:   req.ClientIP,
+		UserAgent:  req.UserAgent,
+		RequestID:  req.RequestID,
+		Metadata:   raw,
+	})
+}
+
+// Ensure ManagerImpl implements Manager.
+var _ Manager = (*ManagerImpl)(nil)
@@ -0,0 +1,116 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package privacy answers data subject requests: it exports everything
+// known about an identity and erases it.
+package privacy
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/audit"
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/token"
+)
+
+// Privacy events.
+const (
+	EventIdentityExported = "identity.exported"
+	EventIdentityErased   = "identity.erased"
+)
+
+// FormatVersion is the version of the export archive format.
+const FormatVersion = 1
+
+// Archive entries, see WriteArchive.
+const (
+	ManifestFile     = "manifest.json"
+	IdentityFile     = "identity.json"
+	CredentialsFile  = "credentials.json"
+	SessionsFile     = "sessions.json"
+	TokensFile       = "tokens.json"
+	RoleBindingsFile = "role_bindings.json"
+	AuditEventsFile  = "audit_events.json"
+	HistoryFile      = "history.json"
+)
+
+// Manager defines the interface for data subject requests.
+type Manager interface {
+	Export(ctx context.Context, id uuid.UUID, req *Request) (*Export, error)
+	Erase(ctx context.Context, id uuid.UUID, req *Request) (*ErasureReport, error)
+}
+
+// Request holds the network of the identity a data subject request is
+// about and the origin of the request, which is recorded in the audit
+// trail.
+type Request struct {
+	NetworkID uuid.UUID
+	ActorID   uuid.UUID
+	ClientIP  string
+	UserAgent string
+	RequestID string
+}
+
+// Export is everything known about an identity. Secrets such as password
+// hashes, session IDs and token values are left out, as are the client
+// details of others in audit events.
+type Export struct {
+	Manifest     *Manifest
+	Identity     *identity.Identity
+	Credentials  []*identity.Credentials
+	Sessions     []*Session
+	Tokens       []*Token
+	RoleBindings []*RoleBinding
+	AuditEvents  []*audit.AuditEvent
+	History      []*identity.Version
+}
+
+// Manifest describes an export archive.
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	IdentityID    uuid.UUID `json:"identity_id"`
+	NetworkID     uuid.UUID `json:"network_id"`
+	GeneratedAt   time.Time `json:"generated_at"`
+	Files         []string  `json:"files"`
+}
+
+// Session is an exported session.
+type Session struct {
+	Active          bool      `json:"active"`
+	AuthenticatedAt time.Time `json:"authenticated_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	ClientIP        string    `json:"client_ip"`
+	UserAgent       string    `json:"user_agent"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Token is an exported token.
+type Token struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      token.TokenType `json:"type"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// RoleBinding is an exported role binding.
+type RoleBinding struct {
+	RoleID    uuid.UUID `json:"role_id"`
+	RoleName  string    `json:"role_name"`
+	NetworkID uuid.UUID `json:"network_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ErasureReport describes an erased identity.
+type ErasureReport struct {
+	IdentityID uuid.UUID `json:"identity_id"`
+	// Pseudonym replaces the ID of the identity in the audit trail.
+	Pseudonym uuid.UUID `json:"pseudonym"`
+	// AuditEvents is the number of pseudonymized audit events.
+	AuditEvents int       `json:"audit_events"`
+	ErasedAt    time.Time `json:"erased_at"`
+}
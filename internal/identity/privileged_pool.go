@@ -6,10 +6,16 @@ package identity
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 
 	"github.com/coding-hui/iam/internal/persistence"
+	"github.com/coding-hui/iam/pkg/identifier"
 )
 
 // privilegedPool implements PrivilegedPool.
@@ -24,47 +30,242 @@ func NewPrivilegedPool(p identityPersister) PrivilegedPool {
 	}
 }
 
-// CreateIdentity creates a new identity.
+// CreateIdentity creates a new identity together with its credentials.
 func (p *privilegedPool) CreateIdentity(ctx context.Context, i *Identity) error {
-	m := p.domainToModel(i)
-	return p.persister.CreateIdentity(ctx, m)
+	m, err := p.domainToModel(i)
+	if err != nil {
+		return err
+	}
+	return credentialsError(p.persister.CreateIdentity(ctx, m))
 }
 
-// UpdateIdentity updates an identity.
+// UpdateIdentity updates an identity. Credentials set on the identity are
+// written as well.
 func (p *privilegedPool) UpdateIdentity(ctx context.Context, i *Identity) error {
-	m := p.domainToModel(i)
-	return p.persister.UpdateIdentity(ctx, m)
+	m, err := p.domainToModel(i)
+	if err != nil {
+		return err
+	}
+	return credentialsError(p.persister.UpdateIdentity(ctx, m))
+}
+
+// DeleteIdentity marks an identity of a network as deleted.
+func (p *privilegedPool) DeleteIdentity(ctx context.Context, networkID, id uuid.UUID, at time.Time) error {
+	return notFoundError(p.persister.SoftDeleteIdentity(ctx, networkID.String(), id.String(), at))
+}
+
+// RestoreIdentity clears the deletion mark of an identity of a network.
+func (p *privilegedPool) RestoreIdentity(ctx context.Context, networkID, id uuid.UUID) error {
+	return notFoundError(p.persister.RestoreIdentity(ctx, networkID.String(), id.String()))
 }
 
-// DeleteIdentity deletes an identity.
-func (p *privilegedPool) DeleteIdentity(ctx context.Context, networkID, id uuid.UUID) error {
+// ListIdentitiesDeletedBefore lists up to limit identities deleted before
+// the given time, longest deleted first, skipping the first offset.
+func (p *privilegedPool) ListIdentitiesDeletedBefore(ctx context.Context, before time.Time, limit, offset int) ([]*Identity, error) {
+	ms, err := p.persister.ListIdentitiesDeletedBefore(ctx, before, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	identities := make([]*Identity, len(ms))
+	for i := range ms {
+		identities[i] = p.modelToDomain(ms[i])
+	}
+	return identities, nil
+}
+
+// PurgeIdentity deletes an identity for good together with everything
+// issued to it.
+func (p *privilegedPool) PurgeIdentity(ctx context.Context, id uuid.UUID) error {
 	return p.persister.DeleteIdentity(ctx, id.String())
 }
 
 // CreateCredentials creates credentials.
 func (p *privilegedPool) CreateCredentials(ctx context.Context, c *Credentials) error {
-	return nil
+	m, err := p.credentialsWithNetwork(ctx, c)
+	if err != nil {
+		return err
+	}
+	return credentialsError(p.persister.CreateCredentials(ctx, m))
 }
 
 // UpdateCredentials updates credentials.
 func (p *privilegedPool) UpdateCredentials(ctx context.Context, c *Credentials) error {
-	return nil
+	m, err := p.credentialsWithNetwork(ctx, c)
+	if err != nil {
+		return err
+	}
+	return credentialsError(p.persister.UpdateCredentials(ctx, m))
 }
 
-// DeleteCredentials deletes credentials.
+// DeleteCredentials deletes the credentials of a type from the identity id.
 func (p *privilegedPool) DeleteCredentials(ctx context.Context, networkID uuid.UUID, id uuid.UUID, credType CredentialsType) error {
-	return nil
+	return p.persister.DeleteCredentials(ctx, id.String(), string(credType))
+}
+
+// AddPasswordHistory records a password hash of an identity and drops all
+// but the keep most recent hashes.
+func (p *privilegedPool) AddPasswordHistory(ctx context.Context, id uuid.UUID, hash []byte, keep int) error {
+	return p.persister.AddPasswordHistory(ctx, id.String(), hash, keep)
+}
+
+// UpdateVerifiableAddress updates the verification state of an address.
+func (p *privilegedPool) UpdateVerifiableAddress(ctx context.Context, a *VerifiableAddress) error {
+	return p.persister.UpdateVerifiableAddress(ctx, addressToModel(a))
+}
+
+// CreateVersion stores a version of an identity.
+func (p *privilegedPool) CreateVersion(ctx context.Context, v *Version) error {
+	err := p.persister.CreateIdentityVersion(ctx, &persistence.IdentityVersion{
+		ID:         v.ID.String(),
+		IdentityID: v.IdentityID.String(),
+		NetworkID:  v.NetworkID.String(),
+		Version:    v.Version,
+		Action:     string(v.Action),
+		ActorID:    v.ActorID.String(),
+		ActorType:  v.ActorType,
+		RequestID:  v.RequestID,
+		Traits:     v.Traits,
+		State:      string(v.State),
+		CreatedAt:  v.CreatedAt,
+	})
+	if errors.Is(err, persistence.ErrIdentityVersionExists) {
+		return ErrVersionConflict
+	}
+	return err
+}
+
+// credentialsWithNetwork maps credentials to the persistence model; the network
+// is taken from the owning identity.
+func (p *privilegedPool) credentialsWithNetwork(ctx context.Context, c *Credentials) (*persistence.IdentityCredentials, error) {
+	identity, err := p.persister.GetIdentity(ctx, c.IdentityID.String())
+	if err != nil {
+		return nil, err
+	}
+	m, err := credentialsToModel(c)
+	if err != nil {
+		return nil, err
+	}
+	m.NetworkID = identity.NetworkID
+	return m, nil
+}
+
+// credentialsToModel maps credentials to the persistence model with
+// their identifiers normalized, see NormalizeIdentifiers.
+func credentialsToModel(c *Credentials) (*persistence.IdentityCredentials, error) {
+	identifiers, err := NormalizeIdentifiers(c.Type, c.Identifiers)
+	if err != nil {
+		return nil, err
+	}
+	return &persistence.IdentityCredentials{
+		ID:                     c.ID.String(),
+		IdentityID:             c.IdentityID.String(),
+		Type:                   string(c.Type),
+		Identifiers:            identifiers,
+		Config:                 c.Config,
+		PasswordChangedAt:      c.PasswordChangedAt,
+		PasswordChangeRequired: c.PasswordChangeRequired,
+		CreatedAt:              c.CreatedAt,
+		UpdatedAt:              c.UpdatedAt,
+	}, nil
+}
+
+// NormalizeIdentifiers returns the identifiers of credentials of a type
+// in the form they are stored and looked up in. Identifiers of password
+// credentials, such as email addresses, usernames and phone numbers, are
+// normalized with identifier.Normalize, and spellings normalizing to the
+// same identifier are merged. Identifiers of other types, such as OAuth
+// subjects, are kept verbatim.
+func NormalizeIdentifiers(credType CredentialsType, identifiers []string) ([]string, error) {
+	if credType != CredentialsTypePassword {
+		return identifiers, nil
+	}
+	out := make([]string, 0, len(identifiers))
+	seen := make(map[string]bool, len(identifiers))
+	for _, i := range identifiers {
+		n, err := identifier.Normalize(i)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q", err, i)
+		}
+		if !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+func addressToModel(a *VerifiableAddress) *persistence.IdentityVerifiableAddress {
+	return &persistence.IdentityVerifiableAddress{
+		ID:         a.ID.String(),
+		IdentityID: a.IdentityID.String(),
+		Via:        a.Via,
+		Value:      a.Value,
+		Status:     string(a.Status),
+		Verified:   a.Verified,
+		VerifiedAt: a.VerifiedAt,
+		CreatedAt:  a.CreatedAt,
+		UpdatedAt:  a.UpdatedAt,
+	}
 }
 
-func (p *privilegedPool) domainToModel(i *Identity) *persistence.Identity {
-	return &persistence.Identity{
-		ID:        i.ID.String(),
-		NetworkID: i.NetworkID.String(),
-		SchemaID:  i.SchemaID,
-		Traits:    i.Traits,
-		CreatedAt: i.CreatedAt,
-		UpdatedAt: i.UpdatedAt,
+// notFoundError maps a missing record to ErrIdentityNotFound.
+func notFoundError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrIdentityNotFound
+	}
+	return err
+}
+
+// addressNotFoundError maps a missing record to ErrAddressNotFound.
+func addressNotFoundError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrAddressNotFound
+	}
+	return err
+}
+
+// credentialsError maps persistence errors on credentials to identity errors.
+func credentialsError(err error) error {
+	if errors.Is(err, persistence.ErrIdentifierInUse) {
+		return ErrIdentifierInUse
+	}
+	return err
+}
+
+func (p *privilegedPool) domainToModel(i *Identity) (*persistence.Identity, error) {
+	m := &persistence.Identity{
+		ID:             i.ID.String(),
+		NetworkID:      i.NetworkID.String(),
+		Type:           string(i.Type),
+		SchemaID:       i.SchemaID,
+		SchemaVersion:  i.SchemaVersion,
+		Traits:         i.Traits,
+		MetadataPublic: i.MetadataPublic,
+		MetadataAdmin:  i.MetadataAdmin,
+		State:          string(i.State),
+		StateChangedAt: i.StateChangedAt,
+		CreatedAt:      i.CreatedAt,
+		UpdatedAt:      i.UpdatedAt,
+		DeletedAt:      i.DeletedAt,
+	}
+	if i.Credentials != nil {
+		m.Credentials = make([]*persistence.IdentityCredentials, 0, len(i.Credentials))
+		for _, c := range i.Credentials {
+			cm, err := credentialsToModel(c)
+			if err != nil {
+				return nil, err
+			}
+			m.Credentials = append(m.Credentials, cm)
+		}
+		sort.Slice(m.Credentials, func(a, b int) bool { return m.Credentials[a].Type < m.Credentials[b].Type })
+	}
+	if i.VerifiableAddresses != nil {
+		m.VerifiableAddresses = make([]*persistence.IdentityVerifiableAddress, len(i.VerifiableAddresses))
+		for k, a := range i.VerifiableAddresses {
+			m.VerifiableAddresses[k] = addressToModel(a)
+		}
 	}
+	return m, nil
 }
 
 // Ensure privilegedPool implements PrivilegedPool.
@@ -0,0 +1,161 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// ExtensionKeyword is the schema keyword holding IAM annotations of a
+// trait, for example:
+//
+//	"email": {
+//	  "type": "string",
+//	  "format": "email",
+//	  "iam": {
+//	    "credentials": {"password": {"identifier": true}},
+//	    "verification": {"via": "email"},
+//	    "recovery": {"via": "email"}
+//	  }
+//	}
+const ExtensionKeyword = "iam"
+
+// Address channels.
+const (
+	ViaEmail = "email"
+	ViaSMS   = "sms"
+)
+
+// Extension is the IAM annotation of a trait in an identity schema.
+type Extension struct {
+	// Credentials maps a credentials type to how the trait is used by it.
+	Credentials map[string]CredentialsExtension `json:"credentials,omitempty"`
+	// Verification marks the trait as an address that can be verified.
+	Verification *AddressExtension `json:"verification,omitempty"`
+	// Recovery marks the trait as an address that can recover the account.
+	Recovery *AddressExtension `json:"recovery,omitempty"`
+}
+
+// CredentialsExtension describes how a trait is used by a credentials type.
+type CredentialsExtension struct {
+	// Identifier makes the trait value a login identifier.
+	Identifier bool `json:"identifier"`
+}
+
+// AddressExtension describes an address trait.
+type AddressExtension struct {
+	// Via is the channel used to reach the address: email or sms.
+	Via string `json:"via"`
+}
+
+func parseExtension(v any) (*Extension, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var ext Extension
+	if err := json.Unmarshal(raw, &ext); err != nil {
+		return nil, err
+	}
+	for name, addr := range map[string]*AddressExtension{"verification": ext.Verification, "recovery": ext.Recovery} {
+		if addr != nil && addr.Via != ViaEmail && addr.Via != ViaSMS {
+			return nil, fmt.Errorf("%s.via must be %q or %q", name, ViaEmail, ViaSMS)
+		}
+	}
+	return &ext, nil
+}
+
+func (e *Extension) identifierTypes() []string {
+	var types []string
+	for t, c := range e.Credentials {
+		if c.Identifier {
+			types = append(types, t)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Address is a trait value annotated as a verifiable or recovery address.
+type Address struct {
+	Via   string `json:"via"`
+	Value string `json:"value"`
+	// Pointer is the JSON pointer of the trait holding the address.
+	Pointer string `json:"pointer"`
+}
+
+// Extensions holds the trait values of an identity that its schema
+// annotates with the extension keyword.
+type Extensions struct {
+	// Identifiers maps every credentials type the schema declares
+	// identifiers for to the login identifiers found in the traits.
+	// A declared type without values maps to an empty list.
+	Identifiers map[string][]string
+	// VerifiableAddresses lists the addresses that can be verified.
+	VerifiableAddresses []Address
+	// RecoveryAddresses lists the addresses that can recover the account.
+	RecoveryAddresses []Address
+}
+
+// Extensions validates traits and collects the values annotated with the
+// extension keyword. Only string values are collected; duplicates are
+// dropped.
+func (s *Schema) Extensions(traits json.RawMessage) (*Extensions, error) {
+	exts := &Extensions{Identifiers: map[string][]string{}}
+	if s.JSONSchema == nil {
+		return exts, nil
+	}
+
+	compiled, err := s.Compile()
+	if err != nil {
+		return nil, err
+	}
+	if len(traits) == 0 {
+		traits = json.RawMessage("null")
+	}
+	v, err := decode(traits)
+	if err != nil {
+		return nil, ErrInvalidJSON
+	}
+
+	errs, ann := compiled.eval(compiled.root, compiled.base, v, "", 0)
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+
+	for _, t := range compiled.credentialTypes {
+		exts.Identifiers[t] = []string{}
+	}
+	for _, a := range ann.ext {
+		value, ok := a.value.(string)
+		if !ok || value == "" {
+			continue
+		}
+		for _, t := range a.ext.identifierTypes() {
+			if !slices.Contains(exts.Identifiers[t], value) {
+				exts.Identifiers[t] = append(exts.Identifiers[t], value)
+			}
+		}
+		if a.ext.Verification != nil {
+			exts.VerifiableAddresses = appendAddress(exts.VerifiableAddresses, Address{Via: a.ext.Verification.Via, Value: value, Pointer: a.ptr})
+		}
+		if a.ext.Recovery != nil {
+			exts.RecoveryAddresses = appendAddress(exts.RecoveryAddresses, Address{Via: a.ext.Recovery.Via, Value: value, Pointer: a.ptr})
+		}
+	}
+	return exts, nil
+}
+
+func appendAddress(list []Address, addr Address) []Address {
+	for _, a := range list {
+		if a.Via == addr.Via && a.Value == addr.Value {
+			return list
+		}
+	}
+	return append(list, addr)
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExtensions(t *testing.T) {
+	s := &Schema{JSONSchema: json.RawMessage(`{
+		"$defs": {"login": {"type": "string", "iam": {"credentials": {"password": {"identifier": true}}}}},
+		"type": "object",
+		"properties": {
+			"email": {"$ref": "#/$defs/login", "iam": {"verification": {"via": "email"}, "recovery": {"via": "email"}}},
+			"aliases": {"type": "array", "items": {"$ref": "#/$defs/login"}},
+			"phone": {"type": "string", "iam": {"verification": {"via": "sms"}}},
+			"contact": {"anyOf": [{"type": "integer"}, {"type": "string", "iam": {"credentials": {"password": {"identifier": true}}}}]}
+		}
+	}`)}
+
+	exts, err := s.Extensions([]byte(`{"email":"a@example.com","aliases":["al","a@example.com"],"contact":7}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"al", "a@example.com"}; !reflect.DeepEqual(exts.Identifiers["password"], want) {
+		t.Fatalf("identifiers = %v, want %v", exts.Identifiers["password"], want)
+	}
+	if want := []Address{{Via: ViaEmail, Value: "a@example.com", Pointer: "/email"}}; !reflect.DeepEqual(exts.VerifiableAddresses, want) ||
+		!reflect.DeepEqual(exts.RecoveryAddresses, want) {
+		t.Fatalf("addresses = %v / %v", exts.VerifiableAddresses, exts.RecoveryAddresses)
+	}
+
+	exts, err = s.Extensions([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, ok := exts.Identifiers["password"]; !ok || len(ids) != 0 {
+		t.Fatalf("declared type without values must map to an empty list, got %v", exts.Identifiers)
+	}
+
+	if _, err := Compile([]byte(`{"iam": {"recovery": {"via": "fax"}}}`)); err == nil {
+		t.Fatal("expected an error for an unknown address channel")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package schema
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/coding-hui/iam/pkg/api"
+	"github.com/coding-hui/iam/pkg/code"
+
+	"github.com/coding-hui/common/errors"
+)
+
+// Handler handles HTTP requests for identity schema operations.
+type Handler struct {
+	manager Manager
+}
+
+// NewHandler creates a new schema handler.
+func NewHandler(manager Manager) *Handler {
+	return &Handler{manager: manager}
+}
+
+// Create handles POST /api/v1/schemas.
+func (h *Handler) Create(c *gin.Context) {
+	var req CreateSchemaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+	req.Author = author(c)
+
+	s, err := h.manager.CreateSchema(c.Request.Context(), &req)
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithData(s, c)
+}
+
+// Get handles GET /api/v1/schemas/:id.
+// The optional version query parameter selects a version; the latest
+// version is returned by default.
+func (h *Handler) Get(c *gin.Context) {
+	version := 0
+	if v := c.Query("version"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			api.FailWithMessage("invalid version", c)
+			return
+		}
+		version = n
+	}
+
+	s, err := h.manager.GetSchema(c.Request.Context(), c.Param("id"), version)
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithData(s, c)
+}
+
+// List handles GET /api/v1/schemas.
+func (h *Handler) List(c *gin.Context) {
+	schemas, err := h.manager.ListSchemas(c.Request.Context())
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithPage(schemas, int64(len(schemas)), c)
+}
+
+// Update handles PUT /api/v1/schemas/:id.
+// Every update stores a new version.
+func (h *Handler) Update(c *gin.Context) {
+	var req UpdateSchemaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+	req.Author = author(c)
+
+	s, err := h.manager.UpdateSchema(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithData(s, c)
+}
+
+// Delete handles DELETE /api/v1/schemas/:id.
+func (h *Handler) Delete(c *gin.Context) {
+	if err := h.manager.DeleteSchema(c.Request.Context(), c.Param("id")); err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.Ok(c)
+}
+
+// Versions handles GET /api/v1/schemas/:id/versions.
+func (h *Handler) Versions(c *gin.Context) {
+	versions, err := h.manager.ListVersions(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithPage(versions, int64(len(versions)), c)
+}
+
+// author returns who makes a change: the ID of the authenticated identity
+// or, for requests without one, the request ID prefixed with "request:".
+func author(c *gin.Context) string {
+	if id := c.GetString("identity_id"); id != "" {
+		return id
+	}
+	if rid := c.GetHeader("X-Request-ID"); rid != "" {
+		return "request:" + rid
+	}
+	return ""
+}
+
+// fail writes err with the API error code matching it. Invalid schemas
+// include the compiler message so the definition can be fixed.
+func fail(err error, c *gin.Context) {
+	switch {
+	case errors.Is(err, ErrSchemaNotFound):
+		api.FailWithErrCode(errors.WrapC(err, code.ErrIdentitySchemaNotFound, "%s", err.Error()), c)
+	case errors.Is(err, ErrSchemaAlreadyExists):
+		api.FailWithErrCode(errors.WrapC(err, code.ErrIdentitySchemaAlreadyExist, "%s", err.Error()), c)
+	case errors.Is(err, ErrInvalidSchema), errors.Is(err, ErrInvalidTransform):
+		api.FailWithDetailed(err.Error(), errors.WrapC(err, code.ErrIdentitySchemaInvalid, "%s", err.Error()), c)
+	case errors.Is(err, ErrSchemaInUse):
+		api.FailWithDetailed(err.Error(), errors.WrapC(err, code.ErrIdentitySchemaInUse, "%s", err.Error()), c)
+	default:
+		api.FailWithErrCode(err, c)
+	}
+}
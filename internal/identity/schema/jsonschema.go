@@ -0,0 +1,971 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Draft identifies the JSON Schema dialect a document is written in.
+type Draft int
+
+const (
+	// Draft7 is JSON Schema draft-07. Drafts 04 and 06 are evaluated as draft-07.
+	Draft7 Draft = 7
+	// Draft2020 is JSON Schema 2020-12. Draft 2019-09 is evaluated as 2020-12.
+	Draft2020 Draft = 2020
+)
+
+// defaultBaseURI is the base URI of documents without an absolute $id.
+const defaultBaseURI = "https://schemas.iam.local/identity.json"
+
+// maxDepth bounds the nesting of subschema evaluation so that recursive
+// references cannot loop forever.
+const maxDepth = 256
+
+// JSONSchema is a compiled JSON Schema document.
+type JSONSchema struct {
+	root      any
+	base      *url.URL
+	draft     Draft
+	resources map[string]resource
+	patterns  map[string]*regexp.Regexp
+	// credentialTypes lists the credentials types that extension
+	// annotations declare identifiers for.
+	credentialTypes []string
+}
+
+// resource is a schema addressable by URI, together with the base URI in
+// effect where it is embedded.
+type resource struct {
+	schema any
+	base   *url.URL
+}
+
+// ErrInvalidSchema is returned when a JSON Schema document cannot be compiled.
+var ErrInvalidSchema = errors.New("invalid schema")
+
+// Compile parses a JSON Schema document. It resolves every $ref and
+// compiles every pattern up front, so a schema that compiles never fails
+// for structural reasons during validation. Only references within the
+// document are supported. Patterns are RE2 regular expressions rather than
+// ECMA-262 ones: lookaround, backreferences and other constructs RE2 lacks
+// are rejected.
+func Compile(raw []byte) (*JSONSchema, error) {
+	root, err := decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	switch root.(type) {
+	case map[string]any, bool:
+	default:
+		return nil, fmt.Errorf("%w: must be an object or a boolean", ErrInvalidSchema)
+	}
+
+	base, _ := url.Parse(defaultBaseURI)
+	s := &JSONSchema{
+		root:      root,
+		base:      base,
+		draft:     detectDraft(root),
+		resources: make(map[string]resource),
+		patterns:  make(map[string]*regexp.Regexp),
+	}
+	s.resources[base.String()] = resource{schema: root, base: base}
+
+	var refs []resource
+	if err := s.index(root, base, "", &refs); err != nil {
+		return nil, err
+	}
+	for _, r := range refs {
+		if _, _, err := s.resolve(r.schema.(string), r.base); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+		}
+	}
+	return s, nil
+}
+
+// Draft returns the dialect the schema is evaluated as.
+func (s *JSONSchema) Draft() Draft {
+	return s.draft
+}
+
+// Validate validates a JSON document against the schema. Violations are
+// reported as a *ValidationError.
+func (s *JSONSchema) Validate(data []byte) error {
+	v, err := decode(data)
+	if err != nil {
+		return ErrInvalidJSON
+	}
+	return s.ValidateValue(v)
+}
+
+// ValidateValue validates a decoded JSON value against the schema.
+func (s *JSONSchema) ValidateValue(v any) error {
+	errs, _ := s.eval(s.root, s.base, v, "", 0)
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+	return v, nil
+}
+
+func detectDraft(root any) Draft {
+	m, ok := root.(map[string]any)
+	if !ok {
+		return Draft2020
+	}
+	uri, _ := m["$schema"].(string)
+	for _, d := range []string{"draft-04", "draft-06", "draft-07"} {
+		if strings.Contains(uri, d) {
+			return Draft7
+		}
+	}
+	return Draft2020
+}
+
+// Keywords whose values are subschemas.
+var (
+	schemaKeywords = []string{
+		"additionalProperties", "additionalItems", "contains", "propertyNames",
+		"not", "if", "then", "else", "unevaluatedProperties", "unevaluatedItems",
+		"contentSchema",
+	}
+	schemaMapKeywords   = []string{"properties", "patternProperties", "$defs", "definitions", "dependentSchemas", "dependencies"}
+	schemaArrayKeywords = []string{"allOf", "anyOf", "oneOf", "prefixItems"}
+)
+
+// index records the resources of a schema and checks its keywords.
+func (s *JSONSchema) index(sch any, base *url.URL, ptr string, refs *[]resource) error {
+	m, ok := sch.(map[string]any)
+	if !ok {
+		if _, ok := sch.(bool); !ok {
+			return fmt.Errorf("%w at %q: must be an object or a boolean", ErrInvalidSchema, ptr)
+		}
+		return nil
+	}
+
+	parent := base
+	if id, ok := m["$id"].(string); ok {
+		u, err := url.Parse(id)
+		if err != nil {
+			return fmt.Errorf("%w at %q: $id: %w", ErrInvalidSchema, ptr, err)
+		}
+		if s.draft == Draft7 && strings.HasPrefix(id, "#") {
+			s.resources[withoutFragment(base)+id] = resource{schema: sch, base: parent}
+		} else {
+			base = base.ResolveReference(u)
+			s.resources[withoutFragment(base)] = resource{schema: sch, base: parent}
+		}
+	}
+	for _, kw := range []string{"$anchor", "$dynamicAnchor"} {
+		if anchor, ok := m[kw].(string); ok {
+			s.resources[withoutFragment(base)+"#"+anchor] = resource{schema: sch, base: parent}
+		}
+	}
+	for _, kw := range []string{"$ref", "$dynamicRef", "$recursiveRef"} {
+		if v, ok := m[kw]; ok {
+			ref, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("%w at %q: %s must be a string", ErrInvalidSchema, ptr, kw)
+			}
+			*refs = append(*refs, resource{schema: ref, base: base})
+		}
+	}
+
+	if v, ok := m["pattern"]; ok {
+		p, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%w at %q: pattern must be a string", ErrInvalidSchema, ptr)
+		}
+		if err := s.compilePattern(p); err != nil {
+			return fmt.Errorf("%w at %q: %w", ErrInvalidSchema, ptr, err)
+		}
+	}
+	if pp, ok := m["patternProperties"].(map[string]any); ok {
+		for p := range pp {
+			if err := s.compilePattern(p); err != nil {
+				return fmt.Errorf("%w at %q: %w", ErrInvalidSchema, ptr, err)
+			}
+		}
+	}
+	if v, ok := m["type"]; ok {
+		if err := checkType(v); err != nil {
+			return fmt.Errorf("%w at %q: %w", ErrInvalidSchema, ptr, err)
+		}
+	}
+	if v, ok := m[ExtensionKeyword]; ok {
+		ext, err := parseExtension(v)
+		if err != nil {
+			return fmt.Errorf("%w at %q: %s: %w", ErrInvalidSchema, ptr, ExtensionKeyword, err)
+		}
+		// Keep the parsed annotation in place so eval need not decode it again.
+		m[ExtensionKeyword] = ext
+		for _, t := range ext.identifierTypes() {
+			if !slices.Contains(s.credentialTypes, t) {
+				s.credentialTypes = append(s.credentialTypes, t)
+			}
+		}
+	}
+
+	for _, kw := range schemaKeywords {
+		if sub, ok := m[kw]; ok {
+			if err := s.index(sub, base, ptr+"/"+kw, refs); err != nil {
+				return err
+			}
+		}
+	}
+	for _, kw := range schemaMapKeywords {
+		subs, ok := m[kw].(map[string]any)
+		if !ok {
+			continue
+		}
+		for name, sub := range subs {
+			if _, isList := sub.([]any); isList && kw == "dependencies" {
+				continue
+			}
+			if err := s.index(sub, base, ptr+"/"+kw+"/"+escapePointer(name), refs); err != nil {
+				return err
+			}
+		}
+	}
+	for _, kw := range schemaArrayKeywords {
+		subs, ok := m[kw].([]any)
+		if !ok {
+			continue
+		}
+		for i, sub := range subs {
+			if err := s.index(sub, base, ptr+"/"+kw+"/"+strconv.Itoa(i), refs); err != nil {
+				return err
+			}
+		}
+	}
+	switch items := m["items"].(type) {
+	case []any:
+		for i, sub := range items {
+			if err := s.index(sub, base, ptr+"/items/"+strconv.Itoa(i), refs); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := s.index(items, base, ptr+"/items", refs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *JSONSchema) compilePattern(p string) error {
+	if _, ok := s.patterns[p]; ok {
+		return nil
+	}
+	re, err := regexp.Compile(p)
+	var serr *syntax.Error
+	if errors.As(err, &serr) && (serr.Code == syntax.ErrInvalidPerlOp || serr.Code == syntax.ErrInvalidEscape) {
+		return fmt.Errorf("pattern %q uses syntax unsupported by RE2: %w", p, err)
+	}
+	if err != nil {
+		return fmt.Errorf("pattern %q: %w", p, err)
+	}
+	s.patterns[p] = re
+	return nil
+}
+
+func checkType(v any) error {
+	names := []any{v}
+	if list, ok := v.([]any); ok {
+		names = list
+	}
+	for _, n := range names {
+		switch n {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return fmt.Errorf("unknown type %v", n)
+		}
+	}
+	return nil
+}
+
+// resolve returns the schema a reference points to and the base URI in
+// effect where it is embedded.
+func (s *JSONSchema) resolve(ref string, base *url.URL) (any, *url.URL, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid $ref %q: %w", ref, err)
+	}
+	abs := base.ResolveReference(u)
+	doc := withoutFragment(abs)
+
+	if abs.Fragment != "" && !strings.HasPrefix(abs.Fragment, "/") {
+		r, ok := s.resources[doc+"#"+abs.Fragment]
+		if !ok {
+			return nil, nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		return r.schema, r.base, nil
+	}
+
+	r, ok := s.resources[doc]
+	if !ok {
+		return nil, nil, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+	if abs.Fragment == "" {
+		return r.schema, r.base, nil
+	}
+
+	cur, curBase := r.schema, r.base
+	for _, tok := range strings.Split(abs.Fragment[1:], "/") {
+		tok = unescapePointer(tok)
+		switch node := cur.(type) {
+		case map[string]any:
+			if id, ok := node["$id"].(string); ok && !(s.draft == Draft7 && strings.HasPrefix(id, "#")) {
+				if u, err := url.Parse(id); err == nil {
+					curBase = curBase.ResolveReference(u)
+				}
+			}
+			next, ok := node[tok]
+			if !ok {
+				return nil, nil, fmt.Errorf("unresolvable $ref %q", ref)
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(tok)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, nil, fmt.Errorf("unresolvable $ref %q", ref)
+			}
+			cur = node[i]
+		default:
+			return nil, nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	switch cur.(type) {
+	case map[string]any, bool:
+		return cur, curBase, nil
+	}
+	return nil, nil, fmt.Errorf("$ref %q does not point to a schema", ref)
+}
+
+func withoutFragment(u *url.URL) string {
+	c := *u
+	c.Fragment = ""
+	c.RawFragment = ""
+	return c.String()
+}
+
+// annotations records which parts of an instance a schema evaluated. They
+// drive unevaluatedProperties and unevaluatedItems. ext collects the
+// extension annotations of the instance and its descendants.
+type annotations struct {
+	props    map[string]bool
+	items    map[int]bool
+	allItems bool
+	ext      []annotated
+}
+
+// annotated is an instance value together with the extension annotation
+// of a schema it was successfully evaluated against.
+type annotated struct {
+	ptr   string
+	value any
+	ext   *Extension
+}
+
+func (a *annotations) merge(b annotations) {
+	a.ext = append(a.ext, b.ext...)
+	for k := range b.props {
+		a.prop(k)
+	}
+	for i := range b.items {
+		a.item(i)
+	}
+	a.allItems = a.allItems || b.allItems
+}
+
+func (a *annotations) prop(name string) {
+	if a.props == nil {
+		a.props = make(map[string]bool)
+	}
+	a.props[name] = true
+}
+
+func (a *annotations) item(i int) {
+	if a.items == nil {
+		a.items = make(map[int]bool)
+	}
+	a.items[i] = true
+}
+
+// eval validates v against sch and returns the violations together with the
+// annotations collected on success.
+func (s *JSONSchema) eval(sch any, base *url.URL, v any, ptr string, depth int) ([]FieldError, annotations) {
+	var ann annotations
+	if depth > maxDepth {
+		return []FieldError{{Pointer: ptr, Keyword: "$ref", Message: "maximum schema depth exceeded"}}, ann
+	}
+
+	m, ok := sch.(map[string]any)
+	if !ok {
+		if sch == false {
+			return []FieldError{{Pointer: ptr, Keyword: "false", Message: "no value is allowed"}}, ann
+		}
+		return nil, ann
+	}
+	if ext, ok := m[ExtensionKeyword].(*Extension); ok {
+		ann.ext = append(ann.ext, annotated{ptr: ptr, value: v, ext: ext})
+	}
+
+	if id, ok := m["$id"].(string); ok && !(s.draft == Draft7 && strings.HasPrefix(id, "#")) {
+		if u, err := url.Parse(id); err == nil {
+			base = base.ResolveReference(u)
+		}
+	}
+
+	var errs []FieldError
+	fail := func(keyword, format string, args ...any) {
+		errs = append(errs, FieldError{Pointer: ptr, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+	// apply evaluates an in-place subschema against v.
+	apply := func(sub any, b *url.URL) bool {
+		subErrs, subAnn := s.eval(sub, b, v, ptr, depth+1)
+		if len(subErrs) > 0 {
+			errs = append(errs, subErrs...)
+			return false
+		}
+		ann.merge(subAnn)
+		return true
+	}
+
+	for _, kw := range []string{"$ref", "$dynamicRef", "$recursiveRef"} {
+		ref, ok := m[kw].(string)
+		if !ok {
+			continue
+		}
+		target, targetBase, err := s.resolve(ref, base)
+		if err != nil {
+			fail(kw, "%s", err)
+			continue
+		}
+		apply(target, targetBase)
+		if s.draft == Draft7 {
+			// Draft-07 ignores the siblings of $ref.
+			return errs, ann
+		}
+	}
+
+	if t, ok := m["type"]; ok && !matchesType(v, t) {
+		fail("type", "must be %s", describeType(t))
+	}
+	if enum, ok := m["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if equal(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("enum", "must be one of %s", compact(enum))
+		}
+	}
+	if c, ok := m["const"]; ok && !equal(v, c) {
+		fail("const", "must be equal to %s", compact(c))
+	}
+
+	switch val := v.(type) {
+	case string:
+		s.evalString(m, val, fail)
+	case json.Number:
+		evalNumber(m, val, fail)
+	case map[string]any:
+		s.evalObject(m, base, val, ptr, depth, &errs, &ann)
+	case []any:
+		s.evalArray(m, base, val, ptr, depth, &errs, &ann)
+	}
+
+	if subs, ok := m["allOf"].([]any); ok {
+		for _, sub := range subs {
+			apply(sub, base)
+		}
+	}
+	if subs, ok := m["anyOf"].([]any); ok {
+		matched := false
+		for _, sub := range subs {
+			subErrs, subAnn := s.eval(sub, base, v, ptr, depth+1)
+			if len(subErrs) == 0 {
+				matched = true
+				ann.merge(subAnn)
+			}
+		}
+		if !matched {
+			fail("anyOf", "must match at least one schema")
+		}
+	}
+	if subs, ok := m["oneOf"].([]any); ok {
+		var matched []int
+		var matchedAnn annotations
+		for i, sub := range subs {
+			subErrs, subAnn := s.eval(sub, base, v, ptr, depth+1)
+			if len(subErrs) == 0 {
+				matched = append(matched, i)
+				matchedAnn = subAnn
+			}
+		}
+		switch len(matched) {
+		case 0:
+			fail("oneOf", "must match exactly one schema")
+		case 1:
+			ann.merge(matchedAnn)
+		default:
+			fail("oneOf", "must match exactly one schema, but matches schemas %d and %d", matched[0], matched[1])
+		}
+	}
+	if sub, ok := m["not"]; ok {
+		if subErrs, _ := s.eval(sub, base, v, ptr, depth+1); len(subErrs) == 0 {
+			fail("not", "must not match the schema")
+		}
+	}
+	if cond, ok := m["if"]; ok {
+		condErrs, condAnn := s.eval(cond, base, v, ptr, depth+1)
+		if len(condErrs) == 0 {
+			ann.merge(condAnn)
+			if then, ok := m["then"]; ok {
+				apply(then, base)
+			}
+		} else if els, ok := m["else"]; ok {
+			apply(els, base)
+		}
+	}
+
+	if obj, ok := v.(map[string]any); ok {
+		if sub, ok := m["dependentSchemas"].(map[string]any); ok {
+			for _, name := range sortedKeys(sub) {
+				if _, present := obj[name]; present {
+					apply(sub[name], base)
+				}
+			}
+		}
+		if deps, ok := m["dependencies"].(map[string]any); ok {
+			for _, name := range sortedKeys(deps) {
+				if _, present := obj[name]; !present {
+					continue
+				}
+				if _, isList := deps[name].([]any); !isList {
+					apply(deps[name], base)
+				}
+			}
+		}
+		if sub, ok := m["unevaluatedProperties"]; ok {
+			for _, name := range sortedKeys(obj) {
+				if ann.props[name] {
+					continue
+				}
+				subErrs, _ := s.eval(sub, base, obj[name], ptr+"/"+escapePointer(name), depth+1)
+				errs = append(errs, subErrs...)
+				ann.prop(name)
+			}
+		}
+	}
+	if arr, ok := v.([]any); ok {
+		if sub, ok := m["unevaluatedItems"]; ok && !ann.allItems {
+			for i, item := range arr {
+				if ann.items[i] {
+					continue
+				}
+				subErrs, _ := s.eval(sub, base, item, ptr+"/"+strconv.Itoa(i), depth+1)
+				errs = append(errs, subErrs...)
+			}
+			ann.allItems = true
+		}
+	}
+
+	return errs, ann
+}
+
+func (s *JSONSchema) evalString(m map[string]any, v string, fail func(string, string, ...any)) {
+	length := utf8.RuneCountInString(v)
+	if n, ok := intKeyword(m, "minLength"); ok && length < n {
+		fail("minLength", "must be at least %d characters long", n)
+	}
+	if n, ok := intKeyword(m, "maxLength"); ok && length > n {
+		fail("maxLength", "must be at most %d characters long", n)
+	}
+	if p, ok := m["pattern"].(string); ok {
+		if re := s.patterns[p]; re != nil && !re.MatchString(v) {
+			fail("pattern", "must match pattern %q", p)
+		}
+	}
+	if f, ok := m["format"].(string); ok {
+		if check, known := formats[f]; known && !check(v) {
+			fail("format", "must be a valid %s", f)
+		}
+	}
+}
+
+func evalNumber(m map[string]any, v json.Number, fail func(string, string, ...any)) {
+	x, ok := toRat(v)
+	if !ok {
+		return
+	}
+	if lim, ok := ratKeyword(m, "minimum"); ok && x.Cmp(lim) < 0 {
+		fail("minimum", "must be >= %s", lim.RatString())
+	}
+	if lim, ok := ratKeyword(m, "maximum"); ok && x.Cmp(lim) > 0 {
+		fail("maximum", "must be <= %s", lim.RatString())
+	}
+	if lim, ok := ratKeyword(m, "exclusiveMinimum"); ok && x.Cmp(lim) <= 0 {
+		fail("exclusiveMinimum", "must be > %s", lim.RatString())
+	}
+	if lim, ok := ratKeyword(m, "exclusiveMaximum"); ok && x.Cmp(lim) >= 0 {
+		fail("exclusiveMaximum", "must be < %s", lim.RatString())
+	}
+	if d, ok := ratKeyword(m, "multipleOf"); ok && d.Sign() > 0 {
+		if !new(big.Rat).Quo(x, d).IsInt() {
+			fail("multipleOf", "must be a multiple of %s", d.RatString())
+		}
+	}
+}
+
+func (s *JSONSchema) evalObject(m map[string]any, base *url.URL, obj map[string]any, ptr string, depth int, errs *[]FieldError, ann *annotations) {
+	fail := func(keyword, format string, args ...any) {
+		*errs = append(*errs, FieldError{Pointer: ptr, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+	child := func(sub any, name string) {
+		subErrs, subAnn := s.eval(sub, base, obj[name], ptr+"/"+escapePointer(name), depth+1)
+		*errs = append(*errs, subErrs...)
+		ann.prop(name)
+		ann.ext = append(ann.ext, subAnn.ext...)
+	}
+
+	if n, ok := intKeyword(m, "minProperties"); ok && len(obj) < n {
+		fail("minProperties", "must have at least %d properties", n)
+	}
+	if n, ok := intKeyword(m, "maxProperties"); ok && len(obj) > n {
+		fail("maxProperties", "must have at most %d properties", n)
+	}
+	if required, ok := m["required"].([]any); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, present := obj[name]; !present {
+				*errs = append(*errs, FieldError{
+					Pointer: ptr + "/" + escapePointer(name),
+					Keyword: "required",
+					Message: fmt.Sprintf("property %q is missing", name),
+				})
+			}
+		}
+	}
+	if deps, ok := m["dependentRequired"].(map[string]any); ok {
+		checkDependentRequired(deps, obj, fail, "dependentRequired")
+	}
+	if deps, ok := m["dependencies"].(map[string]any); ok {
+		checkDependentRequired(deps, obj, fail, "dependencies")
+	}
+
+	names := sortedKeys(obj)
+	if sub, ok := m["propertyNames"]; ok {
+		for _, name := range names {
+			subErrs, _ := s.eval(sub, base, name, ptr+"/"+escapePointer(name), depth+1)
+			for _, e := range subErrs {
+				e.Keyword = "propertyNames"
+				e.Message = "property name " + e.Message
+				*errs = append(*errs, e)
+			}
+		}
+	}
+
+	props, _ := m["properties"].(map[string]any)
+	patterns, _ := m["patternProperties"].(map[string]any)
+	additional, hasAdditional := m["additionalProperties"]
+	for _, name := range names {
+		matched := false
+		if sub, ok := props[name]; ok {
+			child(sub, name)
+			matched = true
+		}
+		for _, p := range sortedKeys(patterns) {
+			if re := s.patterns[p]; re != nil && re.MatchString(name) {
+				child(patterns[p], name)
+				matched = true
+			}
+		}
+		if !matched && hasAdditional {
+			if additional == false {
+				*errs = append(*errs, FieldError{
+					Pointer: ptr + "/" + escapePointer(name),
+					Keyword: "additionalProperties",
+					Message: fmt.Sprintf("property %q is not allowed", name),
+				})
+				continue
+			}
+			child(additional, name)
+		}
+	}
+}
+
+func checkDependentRequired(deps, obj map[string]any, fail func(string, string, ...any), keyword string) {
+	for _, name := range sortedKeys(deps) {
+		list, ok := deps[name].([]any)
+		if !ok {
+			continue
+		}
+		if _, present := obj[name]; !present {
+			continue
+		}
+		for _, r := range list {
+			dep, _ := r.(string)
+			if _, present := obj[dep]; !present {
+				fail(keyword, "property %q is required when %q is present", dep, name)
+			}
+		}
+	}
+}
+
+func (s *JSONSchema) evalArray(m map[string]any, base *url.URL, arr []any, ptr string, depth int, errs *[]FieldError, ann *annotations) {
+	fail := func(keyword, format string, args ...any) {
+		*errs = append(*errs, FieldError{Pointer: ptr, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+	child := func(sub any, i int) {
+		subErrs, subAnn := s.eval(sub, base, arr[i], ptr+"/"+strconv.Itoa(i), depth+1)
+		*errs = append(*errs, subErrs...)
+		ann.ext = append(ann.ext, subAnn.ext...)
+	}
+
+	if n, ok := intKeyword(m, "minItems"); ok && len(arr) < n {
+		fail("minItems", "must have at least %d items", n)
+	}
+	if n, ok := intKeyword(m, "maxItems"); ok && len(arr) > n {
+		fail("maxItems", "must have at most %d items", n)
+	}
+	if unique, _ := m["uniqueItems"].(bool); unique {
+	outer:
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if equal(arr[i], arr[j]) {
+					fail("uniqueItems", "items %d and %d must be unique", i, j)
+					break outer
+				}
+			}
+		}
+	}
+
+	// Tuple validation is spelled prefixItems/items in 2020-12 and
+	// items/additionalItems in draft-07.
+	var prefix []any
+	var rest any
+	var restKeyword string
+	if list, ok := m["prefixItems"].([]any); ok {
+		prefix = list
+	}
+	switch items := m["items"].(type) {
+	case []any:
+		prefix = items
+		if extra, ok := m["additionalItems"]; ok {
+			rest, restKeyword = extra, "additionalItems"
+		}
+	case nil:
+	default:
+		rest, restKeyword = items, "items"
+	}
+	for i := 0; i < len(prefix) && i < len(arr); i++ {
+		child(prefix[i], i)
+		ann.item(i)
+	}
+	if rest != nil && len(arr) > len(prefix) {
+		if rest == false {
+			fail(restKeyword, "must have at most %d items", len(prefix))
+		} else {
+			for i := len(prefix); i < len(arr); i++ {
+				child(rest, i)
+			}
+		}
+		ann.allItems = true
+	}
+
+	if sub, ok := m["contains"]; ok {
+		count := 0
+		for i, item := range arr {
+			if subErrs, _ := s.eval(sub, base, item, ptr+"/"+strconv.Itoa(i), depth+1); len(subErrs) == 0 {
+				count++
+				ann.item(i)
+			}
+		}
+		minContains, ok := intKeyword(m, "minContains")
+		if !ok || s.draft == Draft7 {
+			minContains = 1
+		}
+		if count < minContains {
+			if minContains == 1 {
+				fail("contains", "must contain at least one matching item")
+			} else {
+				fail("minContains", "must contain at least %d matching items", minContains)
+			}
+		}
+		if n, ok := intKeyword(m, "maxContains"); ok && s.draft == Draft2020 && count > n {
+			fail("maxContains", "must contain at most %d matching items", n)
+		}
+	}
+}
+
+func matchesType(v any, t any) bool {
+	if list, ok := t.([]any); ok {
+		for _, name := range list {
+			if matchesType(v, name) {
+				return true
+			}
+		}
+		return false
+	}
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := toRat(v)
+		return ok
+	case "integer":
+		r, ok := toRat(v)
+		return ok && r.IsInt()
+	}
+	return false
+}
+
+func describeType(t any) string {
+	if list, ok := t.([]any); ok {
+		names := make([]string, len(list))
+		for i, name := range list {
+			names[i] = fmt.Sprint(name)
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+// equal reports whether two JSON values are equal. Numbers compare by value,
+// so 1 and 1.0 are equal.
+func equal(a, b any) bool {
+	if x, ok := toRat(a); ok {
+		y, ok := toRat(b)
+		return ok && x.Cmp(y) == 0
+	}
+	switch x := a.(type) {
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, xv := range x {
+			yv, ok := y[k]
+			if !ok || !equal(xv, yv) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func toRat(v any) (*big.Rat, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(n.String())
+	case float64:
+		r := new(big.Rat)
+		if r.SetFloat64(n) == nil {
+			return nil, false
+		}
+		return r, true
+	case int:
+		return new(big.Rat).SetInt64(int64(n)), true
+	case int64:
+		return new(big.Rat).SetInt64(n), true
+	}
+	return nil, false
+}
+
+func ratKeyword(m map[string]any, kw string) (*big.Rat, bool) {
+	v, ok := m[kw]
+	if !ok {
+		return nil, false
+	}
+	return toRat(v)
+}
+
+func intKeyword(m map[string]any, kw string) (int, bool) {
+	r, ok := ratKeyword(m, kw)
+	if !ok || !r.IsInt() || !r.Num().IsInt64() {
+		return 0, false
+	}
+	return int(r.Num().Int64()), true
+}
+
+func compact(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func unescapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+}
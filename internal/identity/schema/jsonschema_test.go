@@ -0,0 +1,143 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package schema
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		schema  string
+		data    string
+		pointer string
+		keyword string
+	}{
+		{"type ok", `{"type":"integer"}`, `1.0`, "", ""},
+		{"type", `{"type":["string","null"]}`, `1`, "", "type"},
+		{"enum", `{"enum":[1,"a"]}`, `"b"`, "", "enum"},
+		{"const numeric", `{"const":1}`, `1.00`, "", ""},
+		{"minLength runes", `{"minLength":2}`, `"é"`, "", "minLength"},
+		{"pattern", `{"pattern":"^a+$"}`, `"ab"`, "", "pattern"},
+		{"format email", `{"format":"email"}`, `"Bob <bob@example.com>"`, "", "format"},
+		{"format date-time", `{"format":"date-time"}`, `"2023-10-01T12:00:00Z"`, "", ""},
+		{"multipleOf decimal", `{"multipleOf":0.1}`, `0.3`, "", ""},
+		{"exclusiveMaximum", `{"exclusiveMaximum":3}`, `3`, "", "exclusiveMaximum"},
+		{"required", `{"required":["email"]}`, `{}`, "/email", "required"},
+		{"nested property", `{"properties":{"name":{"properties":{"first":{"type":"string"}}}}}`, `{"name":{"first":1}}`, "/name/first", "type"},
+		{"additionalProperties", `{"properties":{"a":{}},"additionalProperties":false}`, `{"a":1,"b":2}`, "/b", "additionalProperties"},
+		{"patternProperties", `{"patternProperties":{"^x-":{"type":"string"}},"additionalProperties":false}`, `{"x-a":"1"}`, "", ""},
+		{"escaped pointer", `{"properties":{"a/b":{"type":"string"}}}`, `{"a/b":1}`, "/a~1b", "type"},
+		{"dependentRequired", `{"dependentRequired":{"phone":["country"]}}`, `{"phone":"1"}`, "", "dependentRequired"},
+		{"prefixItems", `{"prefixItems":[{"type":"string"}],"items":false}`, `["a",1]`, "", "items"},
+		{"uniqueItems", `{"uniqueItems":true}`, `[1,1.0]`, "", "uniqueItems"},
+		{"contains", `{"contains":{"type":"string"},"minContains":2}`, `["a",1]`, "", "minContains"},
+		{"oneOf", `{"oneOf":[{"type":"integer"},{"minimum":0}]}`, `1`, "", "oneOf"},
+		{"if then", `{"if":{"properties":{"kind":{"const":"phone"}}},"then":{"required":["phone"]}}`, `{"kind":"phone"}`, "/phone", "required"},
+		{"ref defs", `{"$defs":{"email":{"format":"email"}},"properties":{"e":{"$ref":"#/$defs/email"}}}`, `{"e":"x"}`, "/e", "format"},
+		{"ref anchor", `{"$defs":{"e":{"$anchor":"mail","format":"email"}},"$ref":"#mail"}`, `"x"`, "", "format"},
+		{"unevaluatedProperties", `{"allOf":[{"properties":{"a":{}}}],"unevaluatedProperties":false}`, `{"a":1,"b":2}`, "/b", "false"},
+		{"draft-07 items tuple", `{"$schema":"http://json-schema.org/draft-07/schema#","items":[{"type":"string"}],"additionalItems":false}`, `["a","b"]`, "", "additionalItems"},
+		{"draft-07 ref siblings ignored", `{"$schema":"http://json-schema.org/draft-07/schema#","definitions":{"s":{"type":"string"}},"$ref":"#/definitions/s","minLength":5}`, `"a"`, "", ""},
+		{"draft-07 dependencies", `{"$schema":"http://json-schema.org/draft-07/schema#","dependencies":{"a":["b"]}}`, `{"a":1}`, "", "dependencies"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := Compile([]byte(tc.schema))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.Validate([]byte(tc.data))
+			if tc.keyword == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) || !errors.Is(err, ErrValidation) {
+				t.Fatalf("expected *ValidationError, got %v", err)
+			}
+			fe := verr.Errors[0]
+			if fe.Pointer != tc.pointer || fe.Keyword != tc.keyword {
+				t.Fatalf("got %s at %q, want %s at %q (%v)", fe.Keyword, fe.Pointer, tc.keyword, tc.pointer, err)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, raw := range []string{
+		`[]`,
+		`{"type":"text"}`,
+		`{"pattern":"("}`,
+		`{"$ref":"#/$defs/missing"}`,
+		`{"properties":{"a":1}}`,
+	} {
+		if _, err := Compile([]byte(raw)); err == nil {
+			t.Errorf("Compile(%s): expected error", raw)
+		}
+	}
+}
+
+func TestCompileUnsupportedPattern(t *testing.T) {
+	for _, raw := range []string{
+		`{"pattern":"^(?=.*[0-9]).{8,}$"}`,
+		`{"patternProperties":{"^(a)\\1$":{}}}`,
+	} {
+		_, err := Compile([]byte(raw))
+		if !errors.Is(err, ErrInvalidSchema) || !strings.Contains(err.Error(), "unsupported by RE2") {
+			t.Errorf("Compile(%s) error = %v, want syntax unsupported by RE2", raw, err)
+		}
+	}
+	if _, err := Compile([]byte(`{"pattern":"("}`)); err == nil || strings.Contains(err.Error(), "RE2") {
+		t.Errorf("Compile() error = %v, want a syntax error", err)
+	}
+}
+
+func TestRecursiveRef(t *testing.T) {
+	s, err := Compile([]byte(`{
+		"$id": "https://example.com/tree.json",
+		"type": "object",
+		"properties": {"children": {"type": "array", "items": {"$ref": "tree.json"}}},
+		"required": ["name"]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Validate([]byte(`{"name":"a","children":[{"name":"b","children":[{}]}]}`))
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Errors[0].Pointer != "/children/0/children/0/name" {
+		t.Fatalf("unexpected result: %v", err)
+	}
+}
+
+func TestDefaultSchema(t *testing.T) {
+	ctx := context.Background()
+	v := NewValidator(NewSchemaRegistry(nil))
+	if _, err := v.Validate(ctx, "default", 0, []byte(`{"email":"alice@example.com","name":"Alice"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Validate(ctx, "default", 0, nil); !errors.Is(err, ErrValidation) {
+		t.Fatalf("expected validation error for empty traits, got %v", err)
+	}
+	if _, err := v.Validate(ctx, "default", 0, []byte(`{`)); !errors.Is(err, ErrInvalidJSON) {
+		t.Fatalf("expected ErrInvalidJSON, got %v", err)
+	}
+	if _, err := v.Validate(ctx, "default", 2, []byte(`{}`)); !errors.Is(err, ErrSchemaNotFound) {
+		t.Fatalf("expected ErrSchemaNotFound for unknown version, got %v", err)
+	}
+	if _, err := v.Validate(ctx, "missing", 0, []byte(`{}`)); !errors.Is(err, ErrSchemaNotFound) {
+		t.Fatalf("expected ErrSchemaNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// idPattern restricts schema IDs to URL-safe names.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ManagerImpl implements schema.Manager.
+type ManagerImpl struct {
+	registry *SchemaRegistry
+	privPool PrivilegedPool
+}
+
+// NewManagerImpl creates a new schema manager.
+// Reads go through registry so built-in schemas are included.
+func NewManagerImpl(registry *SchemaRegistry, privPool PrivilegedPool) *ManagerImpl {
+	return &ManagerImpl{
+		registry: registry,
+		privPool: privPool,
+	}
+}
+
+// CreateSchema stores version 1 of a new schema.
+func (m *ManagerImpl) CreateSchema(ctx context.Context, req *CreateSchemaRequest) (*Schema, error) {
+	if !idPattern.MatchString(req.ID) {
+		return nil, fmt.Errorf("%w: id must match %s", ErrInvalidSchema, idPattern)
+	}
+	if _, err := m.registry.Get(ctx, req.ID); err == nil {
+		return nil, ErrSchemaAlreadyExists
+	} else if !errors.Is(err, ErrSchemaNotFound) {
+		return nil, err
+	}
+
+	s := &Schema{
+		ID:         req.ID,
+		Version:    1,
+		Type:       req.Type,
+		JSONSchema: req.JSONSchema,
+		Author:     req.Author,
+		CreatedAt:  time.Now(),
+	}
+	if err := m.store(ctx, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetSchema retrieves a schema version; version 0 selects the latest.
+func (m *ManagerImpl) GetSchema(ctx context.Context, id string, version int) (*Schema, error) {
+	return m.registry.GetVersion(ctx, id, version)
+}
+
+// ListSchemas lists the latest version of every schema.
+func (m *ManagerImpl) ListSchemas(ctx context.Context) ([]*Schema, error) {
+	return m.registry.List(ctx)
+}
+
+// ListVersions lists all versions of a schema, newest first.
+func (m *ManagerImpl) ListVersions(ctx context.Context, id string) ([]*Schema, error) {
+	return m.registry.ListVersions(ctx, id)
+}
+
+// UpdateSchema stores a new version of a schema. Identities keep their
+// current version until they are migrated with the version's transform.
+func (m *ManagerImpl) UpdateSchema(ctx context.Context, id string, req *UpdateSchemaRequest) (*Schema, error) {
+	latest, err := m.registry.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Transform.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &Schema{
+		ID:         id,
+		Version:    latest.Version + 1,
+		Type:       req.Type,
+		JSONSchema: req.JSONSchema,
+		Transform:  req.Transform,
+		Author:     req.Author,
+		CreatedAt:  time.Now(),
+	}
+	if s.Type == "" {
+		s.Type = latest.Type
+	}
+	if err := m.store(ctx, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// DeleteSchema deletes all stored versions of a schema. Schemas that
+// identities still use cannot be deleted, and built-in schemas remain
+// available after their stored versions are deleted.
+func (m *ManagerImpl) DeleteSchema(ctx context.Context, id string) error {
+	versions, err := m.privPool.ListVersions(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		if m.registry.IsBuiltin(id) {
+			return fmt.Errorf("%w: built-in schemas cannot be deleted", ErrSchemaInUse)
+		}
+		return ErrSchemaNotFound
+	}
+
+	n, err := m.privPool.CountIdentities(ctx, id)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("%w: %d identities use schema %q", ErrSchemaInUse, n, id)
+	}
+
+	return m.privPool.DeleteSchema(ctx, id)
+}
+
+// store compiles and stores a schema version.
+func (m *ManagerImpl) store(ctx context.Context, s *Schema) error {
+	if len(s.JSONSchema) == 0 {
+		return fmt.Errorf("%w: json_schema is required", ErrInvalidSchema)
+	}
+	if _, err := s.Compile(); err != nil {
+		return err
+	}
+	return m.privPool.CreateSchema(ctx, s)
+}
+
+// Ensure ManagerImpl implements Manager.
+var _ Manager = (*ManagerImpl)(nil)
@@ -0,0 +1,143 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// schemaPool implements Pool using persistence.IdentitySchemaPersister.
+type schemaPool struct {
+	persister schemaPersister
+}
+
+// schemaPersister is the persistence interface for identity schema operations.
+type schemaPersister interface {
+	GetIdentitySchema(ctx context.Context, schemaID string, version int) (*persistence.IdentitySchema, error)
+	ListIdentitySchemas(ctx context.Context) ([]*persistence.IdentitySchema, error)
+	ListIdentitySchemaVersions(ctx context.Context, schemaID string) ([]*persistence.IdentitySchema, error)
+	CreateIdentitySchema(ctx context.Context, schema *persistence.IdentitySchema) error
+	DeleteIdentitySchema(ctx context.Context, schemaID string) error
+	CountIdentitiesBySchema(ctx context.Context, schemaID string) (int, error)
+}
+
+// NewPool creates a new schema pool.
+func NewPool(p schemaPersister) Pool {
+	return &schemaPool{persister: p}
+}
+
+// GetSchema retrieves a schema version; version 0 selects the latest.
+func (p *schemaPool) GetSchema(ctx context.Context, id string, version int) (*Schema, error) {
+	m, err := p.persister.GetIdentitySchema(ctx, id, version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSchemaNotFound
+		}
+		return nil, err
+	}
+	return p.modelToDomain(m)
+}
+
+// ListSchemas lists the latest version of every stored schema.
+func (p *schemaPool) ListSchemas(ctx context.Context) ([]*Schema, error) {
+	ms, err := p.persister.ListIdentitySchemas(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.modelsToDomain(ms)
+}
+
+// ListVersions lists all stored versions of a schema, newest first.
+func (p *schemaPool) ListVersions(ctx context.Context, id string) ([]*Schema, error) {
+	ms, err := p.persister.ListIdentitySchemaVersions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return p.modelsToDomain(ms)
+}
+
+// CountIdentities counts the identities using a schema.
+func (p *schemaPool) CountIdentities(ctx context.Context, id string) (int, error) {
+	return p.persister.CountIdentitiesBySchema(ctx, id)
+}
+
+func (p *schemaPool) modelsToDomain(ms []*persistence.IdentitySchema) ([]*Schema, error) {
+	schemas := make([]*Schema, len(ms))
+	for i := range ms {
+		s, err := p.modelToDomain(ms[i])
+		if err != nil {
+			return nil, err
+		}
+		schemas[i] = s
+	}
+	return schemas, nil
+}
+
+func (p *schemaPool) modelToDomain(m *persistence.IdentitySchema) (*Schema, error) {
+	s := &Schema{
+		ID:         m.SchemaID,
+		Version:    m.Version,
+		Type:       m.Type,
+		JSONSchema: m.JSONSchema,
+		Author:     m.Author,
+		CreatedAt:  m.CreatedAt,
+	}
+	if len(m.Transform) > 0 {
+		if err := json.Unmarshal(m.Transform, &s.Transform); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Ensure schemaPool implements Pool.
+var _ Pool = (*schemaPool)(nil)
+
+// privilegedPool implements PrivilegedPool.
+type privilegedPool struct {
+	*schemaPool
+}
+
+// NewPrivilegedPool creates a new schema privileged pool.
+func NewPrivilegedPool(p schemaPersister) PrivilegedPool {
+	return &privilegedPool{
+		schemaPool: &schemaPool{persister: p},
+	}
+}
+
+// CreateSchema stores a new schema version.
+func (p *privilegedPool) CreateSchema(ctx context.Context, s *Schema) error {
+	var transform []byte
+	if len(s.Transform) > 0 {
+		b, err := json.Marshal(s.Transform)
+		if err != nil {
+			return err
+		}
+		transform = b
+	}
+	return p.persister.CreateIdentitySchema(ctx, &persistence.IdentitySchema{
+		SchemaID:   s.ID,
+		Version:    s.Version,
+		Type:       s.Type,
+		JSONSchema: s.JSONSchema,
+		Transform:  transform,
+		Author:     s.Author,
+		CreatedAt:  s.CreatedAt,
+	})
+}
+
+// DeleteSchema deletes all stored versions of a schema.
+func (p *privilegedPool) DeleteSchema(ctx context.Context, id string) error {
+	return p.persister.DeleteIdentitySchema(ctx, id)
+}
+
+// Ensure privilegedPool implements PrivilegedPool.
+var _ PrivilegedPool = (*privilegedPool)(nil)
@@ -5,25 +5,63 @@
 package schema
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"sort"
+	"sync"
+	"time"
 )
 
-// ErrSchemaNotFound is returned when a schema is not found.
-var ErrSchemaNotFound = errors.New("schema not found")
+var (
+	// ErrSchemaNotFound is returned when a schema is not found.
+	ErrSchemaNotFound = errors.New("schema not found")
 
-// Schema represents an identity schema (Ory Kratos style).
+	// ErrSchemaAlreadyExists is returned when creating a schema whose ID is taken.
+	ErrSchemaAlreadyExists = errors.New("schema already exists")
+
+	// ErrSchemaInUse is returned when deleting a schema that identities still use.
+	ErrSchemaInUse = errors.New("schema is in use")
+)
+
+// Schema represents a version of an identity schema (Ory Kratos style).
+// Versions are immutable; changing a schema stores a new version.
 type Schema struct {
-	ID   string `json:"id"`
-	Type string `json:"type"`
-	// JSONSchema is the JSON Schema definition for identity traits.
+	ID      string `json:"id"`
+	Version int    `json:"version"`
+	Type    string `json:"type"`
+	// JSONSchema is the JSON Schema definition for identity traits. Its
+	// patterns are RE2 regular expressions, see Compile.
 	JSONSchema json.RawMessage `json:"json_schema"`
+	// Transform migrates traits from the previous version to this one.
+	Transform Transform `json:"transform,omitempty"`
+	Builtin   bool      `json:"builtin,omitempty"`
+	// Author is the ID of the identity that stored the version, or
+	// request:<request ID> for requests without one.
+	Author    string    `json:"author,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	once     sync.Once
+	compiled *JSONSchema
+	err      error
 }
 
-// DefaultSchema is the default identity schema.
+// Compile compiles the JSON Schema definition. The result is cached.
+func (s *Schema) Compile() (*JSONSchema, error) {
+	s.once.Do(func() {
+		s.compiled, s.err = Compile(s.JSONSchema)
+	})
+	return s.compiled, s.err
+}
+
+// DefaultSchema is the default identity schema. The email and username
+// traits are password login identifiers.
 var DefaultSchema = &Schema{
-	ID:   "default",
-	Type: "person",
+	ID:      "default",
+	Version: 1,
+	Type:    "person",
+	Builtin: true,
 	JSONSchema: json.RawMessage(`{
 		"$id": "https://schemas.iam.com/schemas/identity.json",
 		"$schema": "http://json-schema.org/draft-07/schema#",
@@ -31,10 +69,25 @@ var DefaultSchema = &Schema{
 		"properties": {
 			"email": {
 				"type": "string",
-				"format": "email"
+				"format": "email",
+				"iam": {
+					"credentials": {"password": {"identifier": true}},
+					"verification": {"via": "email"},
+					"recovery": {"via": "email"}
+				}
+			},
+			"username": {
+				"type": "string",
+				"minLength": 1,
+				"iam": {
+					"credentials": {"password": {"identifier": true}}
+				}
 			},
 			"phone": {
-				"type": "string"
+				"type": "string",
+				"iam": {
+					"verification": {"via": "sms"}
+				}
 			},
 			"name": {
 				"type": "string"
@@ -47,8 +100,10 @@ var DefaultSchema = &Schema{
 
 // OAuthSchema is the OAuth/SSO identity schema.
 var OAuthSchema = &Schema{
-	ID:   "oauth",
-	Type: "oauth",
+	ID:      "oauth",
+	Version: 1,
+	Type:    "oauth",
+	Builtin: true,
 	JSONSchema: json.RawMessage(`{
 		"$id": "https://schemas.iam.com/schemas/oauth-identity.json",
 		"$schema": "http://json-schema.org/draft-07/schema#",
@@ -56,7 +111,11 @@ var OAuthSchema = &Schema{
 		"properties": {
 			"email": {
 				"type": "string",
-				"format": "email"
+				"format": "email",
+				"iam": {
+					"verification": {"via": "email"},
+					"recovery": {"via": "email"}
+				}
 			},
 			"name": {
 				"type": "string"
@@ -71,35 +130,203 @@ var OAuthSchema = &Schema{
 	}`),
 }
 
-// SchemaRegistry manages identity schemas.
+// Pool defines the interface for reading stored identity schemas.
+type Pool interface {
+	// GetSchema retrieves a schema version; version 0 selects the latest.
+	GetSchema(ctx context.Context, id string, version int) (*Schema, error)
+	// ListSchemas lists the latest version of every stored schema.
+	ListSchemas(ctx context.Context) ([]*Schema, error)
+	// ListVersions lists all stored versions of a schema, newest first.
+	ListVersions(ctx context.Context, id string) ([]*Schema, error)
+	// CountIdentities counts the identities using a schema.
+	CountIdentities(ctx context.Context, id string) (int, error)
+}
+
+// PrivilegedPool defines the interface for writing identity schemas.
+type PrivilegedPool interface {
+	Pool
+
+	CreateSchema(ctx context.Context, s *Schema) error
+	DeleteSchema(ctx context.Context, id string) error
+}
+
+// Manager defines the interface for identity schema business logic.
+type Manager interface {
+	CreateSchema(ctx context.Context, req *CreateSchemaRequest) (*Schema, error)
+	GetSchema(ctx context.Context, id string, version int) (*Schema, error)
+	ListSchemas(ctx context.Context) ([]*Schema, error)
+	ListVersions(ctx context.Context, id string) ([]*Schema, error)
+	UpdateSchema(ctx context.Context, id string, req *UpdateSchemaRequest) (*Schema, error)
+	DeleteSchema(ctx context.Context, id string) error
+}
+
+// CreateSchemaRequest holds data for creating a new schema. JSONSchema
+// must compile, see Compile; in particular its patterns must be valid RE2.
+type CreateSchemaRequest struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	JSONSchema json.RawMessage `json:"json_schema"`
+	Author     string          `json:"-"`
+}
+
+// UpdateSchemaRequest holds data for storing a new version of a schema.
+type UpdateSchemaRequest struct {
+	Type       string          `json:"type,omitempty"`
+	JSONSchema json.RawMessage `json:"json_schema"`
+	Transform  Transform       `json:"transform,omitempty"`
+	Author     string          `json:"-"`
+}
+
+// SchemaRegistry resolves identity schemas. Stored versions are read from
+// the pool; registered schemas are built in and serve as version 1 of
+// their ID. Compiled versions are cached.
 type SchemaRegistry struct {
+	pool    Pool
+	mu      sync.RWMutex
 	schemas map[string]*Schema
+	cache   map[versionKey]*Schema
+}
+
+type versionKey struct {
+	id      string
+	version int
 }
 
-// NewSchemaRegistry creates a new schema registry.
-func NewSchemaRegistry() *SchemaRegistry {
+// NewSchemaRegistry creates a new schema registry holding the built-in
+// schemas. pool may be nil, in which case only built-in schemas exist.
+func NewSchemaRegistry(pool Pool) *SchemaRegistry {
 	return &SchemaRegistry{
+		pool: pool,
 		schemas: map[string]*Schema{
 			"default": DefaultSchema,
 			"oauth":   OAuthSchema,
 		},
+		cache: make(map[versionKey]*Schema),
 	}
 }
 
-// Register registers a new schema.
+// Register registers a new built-in schema.
+// The JSON Schema definition must compile.
 func (r *SchemaRegistry) Register(schema *Schema) error {
 	if schema.ID == "" {
 		return errors.New("schema ID is required")
 	}
+	if schema.JSONSchema != nil {
+		if _, err := schema.Compile(); err != nil {
+			return err
+		}
+	}
+	if schema.Version == 0 {
+		schema.Version = 1
+	}
+	schema.Builtin = true
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.schemas[schema.ID] = schema
 	return nil
 }
 
-// Get returns a schema by ID.
-func (r *SchemaRegistry) Get(id string) (*Schema, error) {
-	schema, ok := r.schemas[id]
-	if !ok {
+// Get returns the latest version of a schema.
+func (r *SchemaRegistry) Get(ctx context.Context, id string) (*Schema, error) {
+	return r.GetVersion(ctx, id, 0)
+}
+
+// GetVersion returns a version of a schema; version 0 selects the latest.
+func (r *SchemaRegistry) GetVersion(ctx context.Context, id string, version int) (*Schema, error) {
+	if r.pool != nil {
+		s, err := r.pool.GetSchema(ctx, id, version)
+		switch {
+		case err == nil:
+			return r.cached(s), nil
+		case !errors.Is(err, ErrSchemaNotFound):
+			return nil, err
+		}
+	}
+
+	r.mu.RLock()
+	s, ok := r.schemas[id]
+	r.mu.RUnlock()
+	if !ok || (version != 0 && version != s.Version) {
 		return nil, ErrSchemaNotFound
 	}
-	return schema, nil
+	return s, nil
+}
+
+// List returns the latest version of every schema, ordered by ID.
+func (r *SchemaRegistry) List(ctx context.Context) ([]*Schema, error) {
+	latest := make(map[string]*Schema)
+	r.mu.RLock()
+	for id, s := range r.schemas {
+		latest[id] = s
+	}
+	r.mu.RUnlock()
+
+	if r.pool != nil {
+		stored, err := r.pool.ListSchemas(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range stored {
+			latest[s.ID] = s
+		}
+	}
+
+	schemas := make([]*Schema, 0, len(latest))
+	for _, s := range latest {
+		schemas = append(schemas, s)
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].ID < schemas[j].ID })
+	return schemas, nil
+}
+
+// ListVersions returns all versions of a schema, newest first.
+func (r *SchemaRegistry) ListVersions(ctx context.Context, id string) ([]*Schema, error) {
+	var versions []*Schema
+	if r.pool != nil {
+		stored, err := r.pool.ListVersions(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		versions = stored
+	}
+
+	r.mu.RLock()
+	builtin, ok := r.schemas[id]
+	r.mu.RUnlock()
+	if ok && (len(versions) == 0 || versions[len(versions)-1].Version > builtin.Version) {
+		versions = append(versions, builtin)
+	}
+
+	if len(versions) == 0 {
+		return nil, ErrSchemaNotFound
+	}
+	return versions, nil
+}
+
+// IsBuiltin reports whether id names a built-in schema.
+func (r *SchemaRegistry) IsBuiltin(id string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.schemas[id]
+	return ok
+}
+
+// cached returns the cached copy of a stored version so that it is only
+// compiled once. The definition is compared because a deleted schema can
+// be recreated with the same ID and version.
+func (r *SchemaRegistry) cached(s *Schema) *Schema {
+	key := versionKey{id: s.ID, version: s.Version}
+
+	r.mu.RLock()
+	c, ok := r.cache[key]
+	r.mu.RUnlock()
+	if ok && bytes.Equal(c.JSONSchema, s.JSONSchema) {
+		return c
+	}
+
+	r.mu.Lock()
+	r.cache[key] = s
+	r.mu.Unlock()
+	return s
 }
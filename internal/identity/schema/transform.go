@@ -0,0 +1,335 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidTransform is returned when a trait transformation is malformed.
+var ErrInvalidTransform = errors.New("invalid transform")
+
+// Transform operations.
+const (
+	// OpSet sets the value at Path, replacing any existing value.
+	OpSet = "set"
+	// OpDefault sets the value at Path only if it is missing.
+	OpDefault = "default"
+	// OpRemove removes the value at Path.
+	OpRemove = "remove"
+	// OpRename moves the value at From to To.
+	OpRename = "rename"
+	// OpCopy copies the value at From to To.
+	OpCopy = "copy"
+	// OpMap replaces the value at Path using the Values lookup table.
+	// Values without an entry are kept.
+	OpMap = "map"
+	// OpConvert converts the scalar at Path to Type: string, number,
+	// integer or boolean.
+	OpConvert = "convert"
+)
+
+// Operation is a single step of a trait transformation. Paths are JSON
+// pointers into the traits object.
+type Operation struct {
+	Op     string                     `json:"op"`
+	Path   string                     `json:"path,omitempty"`
+	From   string                     `json:"from,omitempty"`
+	To     string                     `json:"to,omitempty"`
+	Value  json.RawMessage            `json:"value,omitempty"`
+	Values map[string]json.RawMessage `json:"values,omitempty"`
+	Type   string                     `json:"type,omitempty"`
+}
+
+// Transform is a declarative rewrite of identity traits from the previous
+// version of a schema to the version it is attached to. Operations apply
+// in order; operations whose source does not exist are skipped.
+type Transform []Operation
+
+// Validate checks that every operation is well formed.
+func (t Transform) Validate() error {
+	for i, op := range t {
+		if err := op.validate(); err != nil {
+			return fmt.Errorf("%w: operation %d: %v", ErrInvalidTransform, i, err)
+		}
+	}
+	return nil
+}
+
+func (op *Operation) validate() error {
+	pointers := map[string]string{}
+	switch op.Op {
+	case OpSet, OpDefault:
+		pointers["path"] = op.Path
+		if len(op.Value) == 0 {
+			return errors.New("value is required")
+		}
+		if !json.Valid(op.Value) {
+			return errors.New("value must be valid JSON")
+		}
+	case OpRemove:
+		pointers["path"] = op.Path
+	case OpRename, OpCopy:
+		pointers["from"] = op.From
+		pointers["to"] = op.To
+	case OpMap:
+		pointers["path"] = op.Path
+		if len(op.Values) == 0 {
+			return errors.New("values is required")
+		}
+		for k, v := range op.Values {
+			if !json.Valid(v) {
+				return fmt.Errorf("values[%q] must be valid JSON", k)
+			}
+		}
+	case OpConvert:
+		pointers["path"] = op.Path
+		switch op.Type {
+		case "string", "number", "integer", "boolean":
+		default:
+			return fmt.Errorf("unsupported type %q", op.Type)
+		}
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+	for name, p := range pointers {
+		if !strings.HasPrefix(p, "/") || !isJSONPointer(p) {
+			return fmt.Errorf("%s must be a JSON pointer to a trait", name)
+		}
+	}
+	return nil
+}
+
+// Apply rewrites traits and returns the result.
+func (t Transform) Apply(traits json.RawMessage) (json.RawMessage, error) {
+	if len(t) == 0 {
+		return traits, nil
+	}
+
+	doc, err := decode(traits)
+	if err != nil {
+		return nil, ErrInvalidJSON
+	}
+	if _, ok := doc.(map[string]any); !ok {
+		return nil, errors.New("traits must be an object")
+	}
+
+	for i, op := range t {
+		if doc, err = op.apply(doc); err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i, op.Op, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+func (op *Operation) apply(doc any) (any, error) {
+	switch op.Op {
+	case OpSet, OpDefault:
+		if _, ok := lookup(doc, op.Path); ok && op.Op == OpDefault {
+			return doc, nil
+		}
+		v, err := decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return doc, set(doc, op.Path, v)
+	case OpRemove:
+		remove(doc, op.Path)
+		return doc, nil
+	case OpRename, OpCopy:
+		v, ok := lookup(doc, op.From)
+		if !ok {
+			return doc, nil
+		}
+		if op.Op == OpRename {
+			remove(doc, op.From)
+		}
+		return doc, set(doc, op.To, v)
+	case OpMap:
+		v, ok := lookup(doc, op.Path)
+		if !ok {
+			return doc, nil
+		}
+		key, ok := mapKey(v)
+		if !ok {
+			return doc, nil
+		}
+		raw, ok := op.Values[key]
+		if !ok {
+			return doc, nil
+		}
+		mapped, err := decode(raw)
+		if err != nil {
+			return nil, err
+		}
+		return doc, set(doc, op.Path, mapped)
+	case OpConvert:
+		v, ok := lookup(doc, op.Path)
+		if !ok || v == nil {
+			return doc, nil
+		}
+		converted, err := convert(v, op.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op.Path, err)
+		}
+		return doc, set(doc, op.Path, converted)
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+func mapKey(v any) (string, bool) {
+	switch x := v.(type) {
+	case string:
+		return x, true
+	case json.Number:
+		return x.String(), true
+	case bool:
+		return strconv.FormatBool(x), true
+	}
+	return "", false
+}
+
+func convert(v any, typ string) (any, error) {
+	switch typ {
+	case "string":
+		switch x := v.(type) {
+		case string:
+			return x, nil
+		case json.Number:
+			return x.String(), nil
+		case bool:
+			return strconv.FormatBool(x), nil
+		}
+	case "number", "integer":
+		var s string
+		switch x := v.(type) {
+		case json.Number:
+			s = x.String()
+		case string:
+			s = strings.TrimSpace(x)
+		case bool:
+			if x {
+				return json.Number("1"), nil
+			}
+			return json.Number("0"), nil
+		}
+		r, ok := toRat(json.Number(s))
+		if s == "" || !ok {
+			break
+		}
+		if typ == "integer" {
+			if !r.IsInt() {
+				return nil, fmt.Errorf("%v is not an integer", v)
+			}
+			return json.Number(r.Num().String()), nil
+		}
+		return json.Number(s), nil
+	case "boolean":
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(x)); err == nil {
+				return b, nil
+			}
+		case json.Number:
+			if r, ok := toRat(x); ok {
+				return r.Sign() != 0, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("cannot convert %s to %s", compact(v), typ)
+}
+
+func splitPointer(p string) []string {
+	tokens := strings.Split(p[1:], "/")
+	for i := range tokens {
+		tokens[i] = unescapePointer(tokens[i])
+	}
+	return tokens
+}
+
+func lookup(doc any, p string) (any, bool) {
+	cur := doc
+	for _, tok := range splitPointer(p) {
+		switch node := cur.(type) {
+		case map[string]any:
+			v, ok := node[tok]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []any:
+			i, err := strconv.Atoi(tok)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			cur = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// set stores v at p, creating intermediate objects as needed. Array
+// elements can be replaced but not created.
+func set(doc any, p string, v any) error {
+	tokens := splitPointer(p)
+	cur := doc
+	for i, tok := range tokens {
+		last := i == len(tokens)-1
+		switch node := cur.(type) {
+		case map[string]any:
+			if last {
+				node[tok] = v
+				return nil
+			}
+			next, ok := node[tok]
+			if !ok || next == nil {
+				next = map[string]any{}
+				node[tok] = next
+			}
+			cur = next
+		case []any:
+			idx, err := strconv.Atoi(tok)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return fmt.Errorf("%s: array index %q out of range", p, tok)
+			}
+			if last {
+				node[idx] = v
+				return nil
+			}
+			cur = node[idx]
+		default:
+			return fmt.Errorf("%s: parent is not an object", p)
+		}
+	}
+	return nil
+}
+
+// remove deletes the object member at p. Array elements are not removed.
+func remove(doc any, p string) {
+	tokens := splitPointer(p)
+	parent, ok := doc, true
+	if len(tokens) > 1 {
+		parent, ok = lookup(doc, p[:strings.LastIndex(p, "/")])
+	}
+	if obj, isObj := parent.(map[string]any); ok && isObj {
+		delete(obj, tokens[len(tokens)-1])
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestTransformApply(t *testing.T) {
+	var tr Transform
+	if err := json.Unmarshal([]byte(`[
+		{"op": "rename", "from": "/name", "to": "/profile/full_name"},
+		{"op": "copy", "from": "/email", "to": "/contact/email"},
+		{"op": "remove", "path": "/legacy"},
+		{"op": "default", "path": "/locale", "value": "en"},
+		{"op": "default", "path": "/tier", "value": "free"},
+		{"op": "map", "path": "/tier", "values": {"gold": "premium"}},
+		{"op": "convert", "path": "/age", "type": "integer"},
+		{"op": "set", "path": "/active", "value": true}
+	]`), &tr); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := tr.Apply([]byte(`{"name":"Ann","email":"ann@example.com","legacy":1,"tier":"gold","age":"42"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"active":true,"age":42,"contact":{"email":"ann@example.com"},"email":"ann@example.com","locale":"en","profile":{"full_name":"Ann"},"tier":"premium"}`
+	if string(got) != want {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestTransformErrors(t *testing.T) {
+	if err := (Transform{{Op: OpRename, From: "name", To: "/n"}}).Validate(); !errors.Is(err, ErrInvalidTransform) {
+		t.Fatalf("expected ErrInvalidTransform for relative pointer, got %v", err)
+	}
+	if err := (Transform{{Op: OpSet, Path: "/a"}}).Validate(); !errors.Is(err, ErrInvalidTransform) {
+		t.Fatalf("expected ErrInvalidTransform for missing value, got %v", err)
+	}
+	if _, err := (Transform{{Op: OpConvert, Path: "/age", Type: "integer"}}).Apply([]byte(`{"age":"4.5"}`)); err == nil {
+		t.Fatal("expected conversion error")
+	}
+}
@@ -5,8 +5,10 @@
 package schema
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"strings"
 )
 
 // ErrInvalidJSON is returned when traits is not valid JSON.
@@ -15,6 +17,40 @@ var ErrInvalidJSON = errors.New("traits must be valid JSON")
 // ErrValidation is returned when traits validation fails.
 var ErrValidation = errors.New("validation failed")
 
+// FieldError describes a single schema violation.
+type FieldError struct {
+	// Pointer is the JSON pointer of the offending value within the traits.
+	Pointer string `json:"pointer"`
+	// Keyword is the schema keyword that failed, e.g. required or format.
+	Keyword string `json:"keyword"`
+	// Message is a human readable description of the violation.
+	Message string `json:"message"`
+}
+
+// ValidationError lists the violations found when validating traits.
+// It matches ErrValidation with errors.Is.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// Error implements error.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		ptr := fe.Pointer
+		if ptr == "" {
+			ptr = "/"
+		}
+		msgs[i] = ptr + ": " + fe.Message
+	}
+	return ErrValidation.Error() + ": " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns ErrValidation.
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
 // Validator validates identity traits against a schema.
 type Validator struct {
 	registry *SchemaRegistry
@@ -25,92 +61,37 @@ func NewValidator(registry *SchemaRegistry) *Validator {
 	return &Validator{registry: registry}
 }
 
-// Validate validates the given traits against the schema identified by schemaID.
-func (v *Validator) Validate(schemaID string, traits json.RawMessage) error {
-	schema, err := v.registry.Get(schemaID)
+// Schema returns a version of a schema; version 0 selects the latest version.
+func (v *Validator) Schema(ctx context.Context, schemaID string, version int) (*Schema, error) {
+	return v.registry.GetVersion(ctx, schemaID, version)
+}
+
+// Validate validates the given traits against a version of the schema
+// identified by schemaID; version 0 selects the latest version. It returns
+// the schema version that was used.
+func (v *Validator) Validate(ctx context.Context, schemaID string, version int, traits json.RawMessage) (*Schema, error) {
+	schema, err := v.registry.GetVersion(ctx, schemaID, version)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return schema.Validate(traits)
+	return schema, schema.Validate(traits)
 }
 
 // Validate validates the given traits against this schema.
+// Empty traits are validated as JSON null.
 func (s *Schema) Validate(traits json.RawMessage) error {
 	if s.JSONSchema == nil {
 		return nil // No schema defined, skip validation
 	}
 
-	// Parse the JSON Schema
-	var js schemaDefinition
-	if err := json.Unmarshal(s.JSONSchema, &js); err != nil {
+	compiled, err := s.Compile()
+	if err != nil {
 		return err
 	}
 
-	// Parse the traits
-	var traitsData map[string]any
-	if err := json.Unmarshal(traits, &traitsData); err != nil {
-		return ErrInvalidJSON
-	}
-
-	// Check required fields
-	for _, required := range js.Required {
-		if _, ok := traitsData[required]; !ok {
-			return errors.New("required field missing: " + required)
-		}
-	}
-
-	// Basic type validation
-	for field, fieldSchema := range js.Properties {
-		if value, ok := traitsData[field]; ok {
-			expectedType := fieldSchema.Type
-			if err := validateType(value, expectedType); err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
-}
-
-// schemaDefinition represents a subset of JSON Schema for validation.
-type schemaDefinition struct {
-	Type       string                     `json:"type"`
-	Required   []string                   `json:"required"`
-	Properties map[string]fieldDefinition `json:"properties"`
-}
-
-// fieldDefinition defines a field in the schema.
-type fieldDefinition struct {
-	Type   string `json:"type"`
-	Format string `json:"format"`
-}
-
-func validateType(value any, expectedType string) error {
-	switch expectedType {
-	case "string":
-		if _, ok := value.(string); !ok {
-			return errors.New("expected string")
-		}
-	case "number", "integer":
-		switch value.(type) {
-		case float64, int, int64:
-			// JSON numbers are float64 by default
-		default:
-			return errors.New("expected number")
-		}
-	case "boolean":
-		if _, ok := value.(bool); !ok {
-			return errors.New("expected boolean")
-		}
-	case "array":
-		if _, ok := value.([]any); !ok {
-			return errors.New("expected array")
-		}
-	case "object":
-		if _, ok := value.(map[string]any); !ok {
-			return errors.New("expected object")
-		}
+	if len(traits) == 0 {
+		traits = json.RawMessage("null")
 	}
-	return nil
+	return compiled.Validate(traits)
 }
@@ -0,0 +1,174 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/identity/schema"
+	"github.com/coding-hui/iam/pkg/code"
+	"github.com/coding-hui/iam/pkg/identifier"
+
+	"github.com/coding-hui/common/errors"
+)
+
+// MaxReportedFailures bounds the failures listed in a SchemaMigrationReport.
+const MaxReportedFailures = 1000
+
+// migrationBatchSize is the number of identities loaded at a time.
+const migrationBatchSize = 100
+
+// MigrateSchema moves identities from the version before req.ToVersion to
+// req.ToVersion. The traits of each identity are rewritten with the target
+// version's transform and validated against it, and the identifiers of
+// its credentials are recomputed. Identities that fail, including those
+// whose new identifiers belong to another identity or are invalid, stay
+// at their current version and are listed in the report. Identities that
+// moved to another version while the migration ran are skipped. A dry run
+// validates without changing any identity and does not detect identifier
+// conflicts.
+func (m *ManagerImpl) MigrateSchema(ctx context.Context, req *MigrateSchemaRequest) (*SchemaMigrationReport, error) {
+	if m.validator == nil {
+		return nil, errors.New("identity schema validation is disabled")
+	}
+
+	target, err := m.validator.Schema(ctx, req.SchemaID, req.ToVersion)
+	if err != nil {
+		return nil, traitsError(err, req.SchemaID)
+	}
+	if target.Version < 2 {
+		return nil, errors.WithCode(code.ErrIdentitySchemaNotFound, "schema %q has no version before %d", req.SchemaID, target.Version)
+	}
+
+	report := &SchemaMigrationReport{
+		SchemaID:    req.SchemaID,
+		FromVersion: target.Version - 1,
+		ToVersion:   target.Version,
+		DryRun:      req.DryRun,
+		Failures:    []*SchemaMigrationFailure{},
+	}
+
+	after := uuid.Nil
+	for {
+		batch, err := m.pool.ListIdentitiesBySchema(ctx, req.SchemaID, report.FromVersion, after, migrationBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, identity := range batch {
+			report.Total++
+
+			if req.DryRun {
+				if _, _, err := migrateTraits(target, identity.Traits); err != nil {
+					report.fail(identity.ID, err)
+					continue
+				}
+				report.Migrated++
+				continue
+			}
+
+			var failure *migrationFailure
+			switch err := m.migrateIdentity(ctx, identity.ID, target); {
+			case err == nil:
+				report.Migrated++
+			case errors.Is(err, errSchemaVersionChanged):
+				report.Skipped++
+			case errors.As(err, &failure) || errors.Is(err, ErrIdentifierInUse) || errors.Is(err, identifier.ErrInvalid):
+				report.fail(identity.ID, err)
+			default:
+				return nil, err
+			}
+		}
+
+		if len(batch) < migrationBatchSize {
+			return report, nil
+		}
+		after = batch[len(batch)-1].ID
+	}
+}
+
+// errSchemaVersionChanged is returned by migrateIdentity when the identity
+// left the version before the target since it was listed.
+var errSchemaVersionChanged = errors.New("identity schema version changed")
+
+// migrationFailure is a reason why the traits of an identity cannot be
+// migrated. It is reported instead of ending the migration.
+type migrationFailure struct {
+	err error
+}
+
+func (f *migrationFailure) Error() string { return f.err.Error() }
+
+func (f *migrationFailure) Unwrap() error { return f.err }
+
+// migrateTraits rewrites traits with the transform of target and returns
+// them with the extensions they yield.
+func migrateTraits(target *schema.Schema, traits json.RawMessage) (json.RawMessage, *schema.Extensions, error) {
+	traits, err := target.Transform.Apply(traits)
+	if err != nil {
+		return nil, nil, err
+	}
+	exts, err := target.Extensions(traits)
+	if err != nil {
+		return nil, nil, err
+	}
+	return traits, exts, nil
+}
+
+// migrateIdentity moves an identity to target, storing the migrated traits
+// and the credential identifiers and addresses derived from them, and
+// records the change in the identity history, in one transaction. The
+// traits are read in the transaction, so that concurrent updates are
+// migrated rather than overwritten.
+func (m *ManagerImpl) migrateIdentity(ctx context.Context, id uuid.UUID, target *schema.Schema) error {
+	return m.write(ctx, func(ctx context.Context) error {
+		identity, err := m.pool.GetIdentityWithCredentials(ctx, id)
+		if err != nil {
+			return err
+		}
+		if identity.SchemaID != target.ID || identity.SchemaVersion != target.Version-1 {
+			return errSchemaVersionChanged
+		}
+		traits, exts, err := migrateTraits(target, identity.Traits)
+		if err != nil {
+			return &migrationFailure{err: err}
+		}
+		addrs, err := m.pool.ListVerifiableAddresses(ctx, id)
+		if err != nil {
+			return err
+		}
+		prev := snapshot(identity)
+		identity.Traits = traits
+		identity.SchemaVersion = target.Version
+		identity.UpdatedAt = time.Now()
+		if err := syncIdentifiers(identity, exts); err != nil {
+			return &migrationFailure{err: err}
+		}
+		syncAddresses(identity, addrs, exts)
+		if err := m.privPool.UpdateIdentity(ctx, identity); err != nil {
+			return err
+		}
+		return m.recordChange(ctx, prev, snapshot(identity), VersionActionMigrated, &eventOrigin{actorType: "system"})
+	})
+}
+
+func (r *SchemaMigrationReport) fail(id uuid.UUID, err error) {
+	r.Failed++
+	if len(r.Failures) >= MaxReportedFailures {
+		return
+	}
+
+	f := &SchemaMigrationFailure{IdentityID: id, Message: err.Error()}
+	var verr *schema.ValidationError
+	if errors.As(err, &verr) {
+		f.Message = schema.ErrValidation.Error()
+		f.Errors = verr.Errors
+	}
+	r.Failures = append(r.Failures, f)
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package serviceaccount
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// errInvalidAssertion is wrapped by the errors of malformed or invalid
+// client assertions.
+var errInvalidAssertion = errors.New("invalid client assertion")
+
+// assertion is a client assertion, a JWT in compact serialization.
+type assertion struct {
+	header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	claims    claims
+	signed    []byte
+	signature []byte
+}
+
+// claims holds the claims of a client assertion.
+type claims struct {
+	Issuer    string      `json:"iss"`
+	Subject   string      `json:"sub"`
+	Audience  audience    `json:"aud"`
+	ExpiresAt numericDate `json:"exp"`
+	NotBefore numericDate `json:"nbf"`
+	IssuedAt  numericDate `json:"iat"`
+	ID        string      `json:"jti"`
+}
+
+// audience is a single audience or a list of audiences.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = audience{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*a = list
+	return nil
+}
+
+// numericDate is a time in seconds since the epoch; the zero value means
+// the claim is absent.
+type numericDate struct {
+	time.Time
+}
+
+func (d *numericDate) UnmarshalJSON(b []byte) error {
+	var secs float64
+	if err := json.Unmarshal(b, &secs); err != nil {
+		return errors.New("times must be numbers")
+	}
+	whole, frac := math.Modf(secs)
+	d.Time = time.Unix(int64(whole), int64(frac*1e9))
+	return nil
+}
+
+// parseAssertion decodes a client assertion without verifying it.
+func parseAssertion(s string) (*assertion, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a compact JWS", errInvalidAssertion)
+	}
+	a := &assertion{signed: []byte(parts[0] + "." + parts[1])}
+	if err := decodeSegment(parts[0], &a.header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", errInvalidAssertion, err)
+	}
+	if err := decodeSegment(parts[1], &a.claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", errInvalidAssertion, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", errInvalidAssertion, err)
+	}
+	a.signature = sig
+	return a, nil
+}
+
+func decodeSegment(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// verify checks the signature of the assertion with a key of the
+// algorithm alg.
+func (a *assertion) verify(key crypto.PublicKey, alg string) error {
+	if a.header.Alg != alg {
+		return fmt.Errorf("%w: alg %q does not match the key", errInvalidAssertion, a.header.Alg)
+	}
+	digest := sha256.Sum256(a.signed)
+	ok := false
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], a.signature) == nil
+	case *ecdsa.PublicKey:
+		// ES256 signatures are r and s as 32 byte big-endian integers.
+		if len(a.signature) == 64 {
+			r := new(big.Int).SetBytes(a.signature[:32])
+			s := new(big.Int).SetBytes(a.signature[32:])
+			ok = ecdsa.Verify(k, digest[:], r, s)
+		}
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, a.signed, a.signature)
+	}
+	if !ok {
+		return fmt.Errorf("%w: signature does not verify", errInvalidAssertion)
+	}
+	return nil
+}
+
+// validate checks the claims of an assertion at the given time. Issuer and
+// subject must both name the service account, the audience must include
+// one of audiences and the assertion must expire within
+// MaxAssertionLifetime. A jti is required so that replays can be detected.
+func (c *claims) validate(now time.Time, audiences []string) error {
+	switch {
+	case c.Subject == "" || c.Issuer != c.Subject:
+		return fmt.Errorf("%w: iss and sub must name the service account", errInvalidAssertion)
+	case c.ID == "":
+		return fmt.Errorf("%w: jti is required", errInvalidAssertion)
+	case c.ExpiresAt.IsZero():
+		return fmt.Errorf("%w: exp is required", errInvalidAssertion)
+	case !now.Before(c.ExpiresAt.Add(ClockSkew)):
+		return fmt.Errorf("%w: expired", errInvalidAssertion)
+	case c.ExpiresAt.After(now.Add(MaxAssertionLifetime + ClockSkew)):
+		return fmt.Errorf("%w: exp is more than %s ahead", errInvalidAssertion, MaxAssertionLifetime)
+	case !c.NotBefore.IsZero() && now.Add(ClockSkew).Before(c.NotBefore.Time):
+		return fmt.Errorf("%w: not valid yet", errInvalidAssertion)
+	case !c.IssuedAt.IsZero() && now.Add(ClockSkew).Before(c.IssuedAt.Time):
+		return fmt.Errorf("%w: issued in the future", errInvalidAssertion)
+	}
+	for _, aud := range c.Audience {
+		if slices.Contains(audiences, aud) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: aud must include %s", errInvalidAssertion, strings.Join(audiences, " or "))
+}
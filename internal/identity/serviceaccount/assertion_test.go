@@ -0,0 +1,182 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package serviceaccount
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// sign returns a client assertion with the given claims signed by key.
+func sign(t *testing.T, key crypto.Signer, kid string, claims map[string]any) string {
+	t.Helper()
+	var alg string
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		alg = AlgRS256
+	case *ecdsa.PrivateKey:
+		alg = AlgES256
+	case ed25519.PrivateKey:
+		alg = AlgEdDSA
+	}
+	header := map[string]any{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	segment := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := segment(header) + "." + segment(claims)
+
+	var sig []byte
+	var err error
+	digest := sha256.Sum256([]byte(signed))
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		if err == nil {
+			sig = make([]byte, 64)
+			r.FillBytes(sig[:32])
+			s.FillBytes(sig[32:])
+		}
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// newSigners returns a key of each supported algorithm.
+func newSigners(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]crypto.Signer{AlgRS256: rsaKey, AlgES256: ecKey, AlgEdDSA: edKey}
+}
+
+// publicPEM returns the public key of key in PEM.
+func publicPEM(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestAssertionVerify(t *testing.T) {
+	signers := newSigners(t)
+	for alg, key := range signers {
+		pub, gotAlg, err := parsePublicKey(publicPEM(t, key))
+		if err != nil || gotAlg != alg {
+			t.Fatalf("parsePublicKey(%s) = %s, %v", alg, gotAlg, err)
+		}
+		a, err := parseAssertion(sign(t, key, "", map[string]any{"sub": "sa"}))
+		if err != nil {
+			t.Fatalf("parseAssertion(%s) error = %v", alg, err)
+		}
+		if err := a.verify(pub, alg); err != nil {
+			t.Errorf("verify(%s) error = %v", alg, err)
+		}
+
+		// The signature of another key of the same algorithm.
+		other := newSigners(t)[alg]
+		a, _ = parseAssertion(sign(t, other, "", map[string]any{"sub": "sa"}))
+		if err := a.verify(pub, alg); !errors.Is(err, errInvalidAssertion) {
+			t.Errorf("verify(%s) with another key error = %v, want errInvalidAssertion", alg, err)
+		}
+	}
+
+	// An RSA key must not verify assertions claiming another algorithm.
+	a, _ := parseAssertion(sign(t, signers[AlgES256], "", map[string]any{"sub": "sa"}))
+	pub, _, _ := parsePublicKey(publicPEM(t, signers[AlgRS256]))
+	if err := a.verify(pub, AlgRS256); !errors.Is(err, errInvalidAssertion) {
+		t.Errorf("verify with mismatched alg error = %v, want errInvalidAssertion", err)
+	}
+
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := parsePublicKey(publicPEM(t, small)); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("parsePublicKey(1024 bit RSA) error = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestClaimsValidate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	aud := "https://iam.example.com/api/v1/service-accounts/token"
+	valid := func() map[string]any {
+		return map[string]any{
+			"iss": "sa", "sub": "sa", "aud": aud, "jti": "1",
+			"iat": now.Unix(), "exp": now.Add(5 * time.Minute).Unix(),
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(c map[string]any)
+		ok     bool
+	}{
+		{"valid", func(map[string]any) {}, true},
+		{"audience list", func(c map[string]any) { c["aud"] = []string{"other", aud} }, true},
+		{"expired within skew", func(c map[string]any) { c["exp"] = now.Add(-30 * time.Second).Unix() }, true},
+		{"wrong audience", func(c map[string]any) { c["aud"] = "other" }, false},
+		{"issuer differs", func(c map[string]any) { c["iss"] = "other" }, false},
+		{"no jti", func(c map[string]any) { delete(c, "jti") }, false},
+		{"no exp", func(c map[string]any) { delete(c, "exp") }, false},
+		{"expired", func(c map[string]any) { c["exp"] = now.Add(-2 * time.Minute).Unix() }, false},
+		{"lives too long", func(c map[string]any) { c["exp"] = now.Add(2 * time.Hour).Unix() }, false},
+		{"not valid yet", func(c map[string]any) { c["nbf"] = now.Add(5 * time.Minute).Unix() }, false},
+		{"issued in the future", func(c map[string]any) { c["iat"] = now.Add(5 * time.Minute).Unix() }, false},
+	}
+	key := newSigners(t)[AlgEdDSA]
+	for _, tt := range tests {
+		c := valid()
+		tt.modify(c)
+		a, err := parseAssertion(sign(t, key, "", c))
+		if err != nil {
+			t.Fatalf("%s: parseAssertion error = %v", tt.name, err)
+		}
+		err = a.claims.validate(now, []string{aud})
+		if tt.ok && err != nil {
+			t.Errorf("%s: validate error = %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, errInvalidAssertion) {
+			t.Errorf("%s: validate error = %v, want errInvalidAssertion", tt.name, err)
+		}
+	}
+}
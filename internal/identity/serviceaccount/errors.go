@@ -0,0 +1,27 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package serviceaccount
+
+import "errors"
+
+var (
+	// ErrAccountNotFound is returned when an identity is not found or is
+	// not a service account.
+	ErrAccountNotFound = errors.New("service account not found")
+
+	// ErrKeyNotFound is returned when a key is not found.
+	ErrKeyNotFound = errors.New("service account key not found")
+
+	// ErrInvalidKey is returned for malformed or unsupported keys.
+	ErrInvalidKey = errors.New("invalid service account key")
+
+	// ErrUnsupportedGrant is returned for grants other than client
+	// credentials.
+	ErrUnsupportedGrant = errors.New("unsupported grant type")
+
+	// ErrAuthenticationFailed is returned when client credentials are
+	// missing, unknown, expired or do not verify.
+	ErrAuthenticationFailed = errors.New("service account authentication failed")
+)
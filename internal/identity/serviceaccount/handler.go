@@ -0,0 +1,173 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package serviceaccount
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/pkg/api"
+	"github.com/coding-hui/iam/pkg/code"
+
+	"github.com/coding-hui/common/errors"
+)
+
+// Handler handles HTTP requests for service account operations.
+type Handler struct {
+	manager Manager
+}
+
+// NewHandler creates a new service account handler.
+func NewHandler(manager Manager) *Handler {
+	return &Handler{manager: manager}
+}
+
+// Token handles POST /api/v1/service-accounts/token.
+// The grant is read from a form or JSON body; secrets may also be sent
+// with HTTP Basic authentication, the service account ID as user name.
+func (h *Handler) Token(c *gin.Context) {
+	var req TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+	if user, secret, ok := c.Request.BasicAuth(); ok && req.ClientSecret == "" {
+		req.ClientID, req.ClientSecret = user, secret
+	}
+
+	t, err := h.manager.IssueToken(c.Request.Context(), &req)
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithData(t, c)
+}
+
+// ListKeys handles GET /api/v1/identities/:id/keys.
+func (h *Handler) ListKeys(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return
+	}
+
+	keys, err := h.manager.ListKeys(c.Request.Context(), id)
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithPage(keys, int64(len(keys)), c)
+}
+
+// CreateKey handles POST /api/v1/identities/:id/keys.
+func (h *Handler) CreateKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return
+	}
+	var req CreateKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+
+	k, err := h.manager.CreateKey(c.Request.Context(), id, &req)
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithData(k, c)
+}
+
+// GetKey handles GET /api/v1/identities/:id/keys/:key_id.
+func (h *Handler) GetKey(c *gin.Context) {
+	id, keyID, ok := keyParams(c)
+	if !ok {
+		return
+	}
+
+	k, err := h.manager.GetKey(c.Request.Context(), id, keyID)
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithData(k, c)
+}
+
+// RotateKey handles POST /api/v1/identities/:id/keys/:key_id/rotate.
+// The overlap is given in nanoseconds.
+func (h *Handler) RotateKey(c *gin.Context) {
+	id, keyID, ok := keyParams(c)
+	if !ok {
+		return
+	}
+	var req RotateKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+
+	r, err := h.manager.RotateKey(c.Request.Context(), id, keyID, &req)
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithData(r, c)
+}
+
+// DeleteKey handles DELETE /api/v1/identities/:id/keys/:key_id.
+func (h *Handler) DeleteKey(c *gin.Context) {
+	id, keyID, ok := keyParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.manager.DeleteKey(c.Request.Context(), id, keyID); err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.Ok(c)
+}
+
+// keyParams parses the identity and key IDs of the path, failing the
+// request when they are malformed.
+func keyParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return uuid.Nil, uuid.Nil, false
+	}
+	keyID, err := uuid.Parse(c.Param("key_id"))
+	if err != nil {
+		api.FailWithMessage("invalid key_id", c)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return id, keyID, true
+}
+
+// fail writes err with the API error code matching it.
+func fail(err error, c *gin.Context) {
+	switch {
+	case errors.Is(err, ErrAccountNotFound):
+		api.FailWithErrCode(errors.WrapC(err, code.ErrServiceAccountNotFound, "%s", err.Error()), c)
+	case errors.Is(err, ErrKeyNotFound):
+		api.FailWithErrCode(errors.WrapC(err, code.ErrServiceAccountKeyNotFound, "%s", err.Error()), c)
+	case errors.Is(err, ErrInvalidKey):
+		api.FailWithDetailed(err.Error(), errors.WrapC(err, code.ErrServiceAccountKeyInvalid, "%s", err.Error()), c)
+	case errors.Is(err, ErrUnsupportedGrant):
+		api.FailWithErrCode(errors.WrapC(err, code.ErrServiceAccountGrantUnsupported, "%s", err.Error()), c)
+	case errors.Is(err, ErrAuthenticationFailed):
+		api.FailWithErrCode(errors.WrapC(err, code.ErrServiceAccountAuthFailed, "%s", err.Error()), c)
+	default:
+		api.FailWithErrCode(err, c)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package serviceaccount
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// minRSABits is the minimum size of RSA keys.
+const minRSABits = 2048
+
+// secretPrefix starts the key IDs of secrets, so that leaked secrets can
+// be recognized.
+const secretPrefix = "sa_"
+
+// parsePublicKey parses a PEM encoded public key and returns it together
+// with the algorithm of the assertions it verifies.
+func parsePublicKey(s string) (crypto.PublicKey, string, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(s)))
+	if block == nil {
+		return nil, "", fmt.Errorf("%w: public_key must be PEM encoded", ErrInvalidKey)
+	}
+	var key crypto.PublicKey
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, "", fmt.Errorf("%w: unexpected PEM block %q", ErrInvalidKey, block.Type)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, "", fmt.Errorf("%w: RSA keys need %d bits or more", ErrInvalidKey, minRSABits)
+		}
+		return k, AlgRS256, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, "", fmt.Errorf("%w: EC keys must use P-256", ErrInvalidKey)
+		}
+		return k, AlgES256, nil
+	case ed25519.PublicKey:
+		return k, AlgEdDSA, nil
+	default:
+		return nil, "", fmt.Errorf("%w: unsupported key type %T", ErrInvalidKey, key)
+	}
+}
+
+// encodePublicKey returns the PEM encoding of a public key.
+func encodePublicKey(key crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// thumbprint returns the JWK thumbprint of a public key (RFC 7638).
+func thumbprint(key crypto.PublicKey) (string, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	var jwk string
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		e := big.NewInt(int64(k.E)).Bytes()
+		jwk = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, b64(e), b64(k.N.Bytes()))
+	case *ecdsa.PublicKey:
+		pub, err := k.ECDH()
+		if err != nil {
+			return "", err
+		}
+		// An uncompressed point: 0x04, then x and y.
+		point := pub.Bytes()
+		size := (len(point) - 1) / 2
+		jwk = fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`, b64(point[1:1+size]), b64(point[1+size:]))
+	case ed25519.PublicKey:
+		jwk = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, b64(k))
+	default:
+		return "", fmt.Errorf("%w: unsupported key type %T", ErrInvalidKey, key)
+	}
+	sum := sha256.Sum256([]byte(jwk))
+	return b64(sum[:]), nil
+}
+
+// newSecret generates a secret, which starts with its key ID.
+func newSecret() (secret, keyID string, err error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	keyID = secretPrefix + hex.EncodeToString(id)
+	return keyID + "." + base64.RawURLEncoding.EncodeToString(b), keyID, nil
+}
+
+// secretKeyID returns the key ID a secret starts with.
+func secretKeyID(secret string) (string, bool) {
+	keyID, rest, ok := strings.Cut(secret, ".")
+	if !ok || !strings.HasPrefix(keyID, secretPrefix) || rest == "" {
+		return "", false
+	}
+	return keyID, true
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
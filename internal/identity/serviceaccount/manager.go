@@ -0,0 +1,416 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package serviceaccount
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/cache"
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/token"
+)
+
+// maxKeyIDLength bounds the length of the key IDs of public keys.
+const maxKeyIDLength = 128
+
+// Config holds the configuration of service accounts. Zero values select
+// the defaults.
+type Config struct {
+	TokenTTL        time.Duration
+	RotationOverlap time.Duration
+	// Audience lists the audiences client assertions are accepted for.
+	// When empty, client assertions are rejected.
+	Audience []string
+}
+
+// ManagerImpl implements serviceaccount.Manager.
+type ManagerImpl struct {
+	pool       PrivilegedPool
+	identities identity.Pool
+	tokens     token.Manager
+	replays    cache.Cache
+	config     Config
+	now        func() time.Time
+}
+
+// NewManagerImpl creates a new service account manager issuing access
+// tokens with tokens.
+func NewManagerImpl(pool PrivilegedPool, identities identity.Pool, tokens token.Manager) *ManagerImpl {
+	m := &ManagerImpl{
+		pool:       pool,
+		identities: identities,
+		tokens:     tokens,
+		now:        time.Now,
+	}
+	m.SetConfig(Config{})
+	return m
+}
+
+// SetConfig sets the token lifetime, the rotation overlap and the
+// accepted audiences.
+func (m *ManagerImpl) SetConfig(c Config) {
+	if c.TokenTTL <= 0 {
+		c.TokenTTL = DefaultTokenTTL
+	}
+	if c.RotationOverlap <= 0 {
+		c.RotationOverlap = DefaultRotationOverlap
+	}
+	m.config = c
+}
+
+// SetReplayCache sets the cache remembering the client assertions used
+// until they expire, so that they cannot be replayed. Without it
+// assertions can be used more than once.
+func (m *ManagerImpl) SetReplayCache(c cache.Cache) {
+	m.replays = c
+}
+
+// CreateKey adds a key to a service account. Secrets are only returned
+// here.
+func (m *ManagerImpl) CreateKey(ctx context.Context, identityID uuid.UUID, req *CreateKeyRequest) (*Key, error) {
+	if _, err := m.account(ctx, identityID); err != nil {
+		return nil, err
+	}
+	return m.createKey(ctx, identityID, req)
+}
+
+// GetKey retrieves a key of a service account.
+func (m *ManagerImpl) GetKey(ctx context.Context, identityID, id uuid.UUID) (*Key, error) {
+	if _, err := m.account(ctx, identityID); err != nil {
+		return nil, err
+	}
+	k, err := m.pool.GetKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if k.IdentityID != identityID {
+		return nil, ErrKeyNotFound
+	}
+	return k, nil
+}
+
+// ListKeys lists the keys of a service account, expired ones included.
+func (m *ManagerImpl) ListKeys(ctx context.Context, identityID uuid.UUID) ([]*Key, error) {
+	if _, err := m.account(ctx, identityID); err != nil {
+		return nil, err
+	}
+	return m.pool.ListKeys(ctx, identityID)
+}
+
+// RotateKey adds a key of the same type as an active key and makes the
+// latter expire after the overlap, unless it expires earlier.
+func (m *ManagerImpl) RotateKey(ctx context.Context, identityID, id uuid.UUID, req *RotateKeyRequest) (*Rotation, error) {
+	prev, err := m.GetKey(ctx, identityID, id)
+	if err != nil {
+		return nil, err
+	}
+	now := m.now().UTC()
+	if !prev.Active(now) {
+		return nil, fmt.Errorf("%w: the key has expired", ErrInvalidKey)
+	}
+	overlap := m.config.RotationOverlap
+	if req.Overlap != nil {
+		if *req.Overlap < 0 {
+			return nil, fmt.Errorf("%w: overlap must not be negative", ErrInvalidKey)
+		}
+		overlap = *req.Overlap
+	}
+	name := req.Name
+	if name == "" {
+		name = prev.Name
+	}
+
+	next, err := m.createKey(ctx, identityID, &CreateKeyRequest{
+		Type:      prev.Type,
+		Name:      name,
+		PublicKey: req.PublicKey,
+		KeyID:     req.KeyID,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt := now.Add(overlap); prev.ExpiresAt == nil || expiresAt.Before(*prev.ExpiresAt) {
+		prev.ExpiresAt = &expiresAt
+		if err := m.pool.UpdateKey(ctx, prev); err != nil {
+			return nil, err
+		}
+	}
+	return &Rotation{Key: next, Previous: prev}, nil
+}
+
+// DeleteKey deletes a key of a service account.
+func (m *ManagerImpl) DeleteKey(ctx context.Context, identityID, id uuid.UUID) error {
+	k, err := m.GetKey(ctx, identityID, id)
+	if err != nil {
+		return err
+	}
+	return m.pool.DeleteKey(ctx, k)
+}
+
+// IssueToken authenticates a service account with a client assertion or a
+// secret and issues it an access token.
+func (m *ManagerImpl) IssueToken(ctx context.Context, req *TokenRequest) (*TokenResponse, error) {
+	if req.GrantType != GrantTypeClientCredentials {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedGrant, req.GrantType)
+	}
+
+	var k *Key
+	var err error
+	switch {
+	case req.ClientAssertion != "":
+		k, err = m.authenticateAssertion(ctx, req)
+	case req.ClientSecret != "":
+		k, err = m.authenticateSecret(ctx, req)
+	default:
+		err = authError("client_assertion or client_secret is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ident, err := m.account(ctx, k.IdentityID)
+	if err != nil {
+		if errors.Is(err, ErrAccountNotFound) {
+			return nil, authError(err.Error())
+		}
+		return nil, err
+	}
+	if err := ident.CheckActive(); err != nil {
+		return nil, err
+	}
+	if err := m.touch(ctx, k); err != nil {
+		return nil, err
+	}
+
+	t, err := m.tokens.CreateToken(ctx, &token.CreateTokenRequest{
+		IdentityID: ident.ID,
+		Type:       token.TokenTypeAccess,
+		TTL:        m.config.TokenTTL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		AccessToken: t.Value,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(m.config.TokenTTL / time.Second),
+	}, nil
+}
+
+// authenticateAssertion returns the public key verifying a client
+// assertion. The key is chosen by the kid of the assertion when it has
+// one; otherwise every active key of the algorithm is tried, so that
+// clients keep working while keys are rotated.
+func (m *ManagerImpl) authenticateAssertion(ctx context.Context, req *TokenRequest) (*Key, error) {
+	if req.ClientAssertionType != AssertionTypeJWTBearer {
+		return nil, authError(fmt.Sprintf("client_assertion_type must be %s", AssertionTypeJWTBearer))
+	}
+	a, err := parseAssertion(req.ClientAssertion)
+	if err != nil {
+		return nil, authError(err.Error())
+	}
+	identityID, err := uuid.Parse(a.claims.Subject)
+	if err != nil || (req.ClientID != "" && req.ClientID != a.claims.Subject) {
+		return nil, authError("sub must be the ID of the service account")
+	}
+
+	now := m.now()
+	keys, err := m.pool.ListKeys(ctx, identityID)
+	if err != nil {
+		return nil, err
+	}
+	var verified *Key
+	for _, k := range keys {
+		if k.Type != KeyTypePublic || !k.Active(now) || (a.header.Kid != "" && a.header.Kid != k.KeyID) {
+			continue
+		}
+		pub, alg, err := parsePublicKey(k.PublicKey)
+		if err != nil {
+			continue
+		}
+		if a.verify(pub, alg) == nil {
+			verified = k
+			break
+		}
+	}
+	if verified == nil {
+		return nil, authError("no active key verifies the client assertion")
+	}
+
+	if len(m.config.Audience) == 0 {
+		return nil, authError("no audience is configured for client assertions")
+	}
+	if err := a.claims.validate(now, m.config.Audience); err != nil {
+		return nil, authError(err.Error())
+	}
+	if err := m.checkReplay(ctx, &a.claims, now); err != nil {
+		return nil, err
+	}
+	return verified, nil
+}
+
+// checkReplay rejects assertions used before and remembers the assertion
+// until it expires.
+func (m *ManagerImpl) checkReplay(ctx context.Context, c *claims, now time.Time) error {
+	if m.replays == nil {
+		return nil
+	}
+	key := "serviceaccount:jti:" + c.Subject + ":" + c.ID
+	ttl := c.ExpiresAt.Add(ClockSkew).Sub(now)
+	stored, err := m.replays.SetNX(ctx, key, []byte{1}, int64(ttl))
+	if err != nil {
+		return err
+	}
+	if !stored {
+		return authError("the client assertion was used before")
+	}
+	return nil
+}
+
+// authenticateSecret returns the active secret key matching a secret.
+func (m *ManagerImpl) authenticateSecret(ctx context.Context, req *TokenRequest) (*Key, error) {
+	keyID, ok := secretKeyID(req.ClientSecret)
+	if !ok {
+		return nil, authError("malformed client_secret")
+	}
+	k, err := m.pool.GetSecretKeyByKeyID(ctx, keyID)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, authError("unknown client_secret")
+		}
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(k.SecretHash), []byte(hashSecret(req.ClientSecret))) != 1 {
+		return nil, authError("unknown client_secret")
+	}
+	if req.ClientID != "" && req.ClientID != k.IdentityID.String() {
+		return nil, authError("client_secret belongs to another service account")
+	}
+	if !k.Active(m.now()) {
+		return nil, authError("client_secret has expired")
+	}
+	return k, nil
+}
+
+// touch records the use of a key unless it was recorded within
+// LastUsedResolution.
+func (m *ManagerImpl) touch(ctx context.Context, k *Key) error {
+	now := m.now().UTC()
+	if k.LastUsedAt != nil && now.Sub(*k.LastUsedAt) < LastUsedResolution {
+		return nil
+	}
+	if err := m.pool.UpdateKeyLastUsed(ctx, k, now); err != nil {
+		return err
+	}
+	k.LastUsedAt = &now
+	return nil
+}
+
+// createKey validates and stores a new key of a service account.
+func (m *ManagerImpl) createKey(ctx context.Context, identityID uuid.UUID, req *CreateKeyRequest) (*Key, error) {
+	now := m.now().UTC()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidKey)
+	}
+	k := &Key{
+		ID:         uuid.New(),
+		IdentityID: identityID,
+		Type:       req.Type,
+		Name:       req.Name,
+		ExpiresAt:  req.ExpiresAt,
+		CreatedAt:  now,
+	}
+	if k.Type == "" {
+		k.Type = KeyTypeSecret
+		if req.PublicKey != "" {
+			k.Type = KeyTypePublic
+		}
+	}
+
+	switch k.Type {
+	case KeyTypePublic:
+		if err := m.setPublicKey(ctx, k, req); err != nil {
+			return nil, err
+		}
+	case KeyTypeSecret:
+		if req.PublicKey != "" || req.KeyID != "" {
+			return nil, fmt.Errorf("%w: secrets take no public_key or key_id", ErrInvalidKey)
+		}
+		secret, keyID, err := newSecret()
+		if err != nil {
+			return nil, err
+		}
+		k.KeyID, k.Secret, k.SecretHash = keyID, secret, hashSecret(secret)
+	default:
+		return nil, fmt.Errorf("%w: unknown key type %q", ErrInvalidKey, k.Type)
+	}
+
+	if err := m.pool.CreateKey(ctx, k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// setPublicKey sets the public key of req on k, with a key ID that is
+// unique among the keys of the service account.
+func (m *ManagerImpl) setPublicKey(ctx context.Context, k *Key, req *CreateKeyRequest) error {
+	pub, alg, err := parsePublicKey(req.PublicKey)
+	if err != nil {
+		return err
+	}
+	if k.PublicKey, err = encodePublicKey(pub); err != nil {
+		return err
+	}
+	k.Algorithm, k.KeyID = alg, strings.TrimSpace(req.KeyID)
+	if k.KeyID == "" {
+		if k.KeyID, err = thumbprint(pub); err != nil {
+			return err
+		}
+	}
+	if len(k.KeyID) > maxKeyIDLength {
+		return fmt.Errorf("%w: key_id is longer than %d characters", ErrInvalidKey, maxKeyIDLength)
+	}
+
+	keys, err := m.pool.ListKeys(ctx, k.IdentityID)
+	if err != nil {
+		return err
+	}
+	for _, other := range keys {
+		if other.Type == KeyTypePublic && other.KeyID == k.KeyID {
+			return fmt.Errorf("%w: key_id %q is registered already", ErrInvalidKey, k.KeyID)
+		}
+	}
+	return nil
+}
+
+// account retrieves a service account.
+func (m *ManagerImpl) account(ctx context.Context, id uuid.UUID) (*identity.Identity, error) {
+	ident, err := m.identities.GetIdentity(ctx, id)
+	if err != nil {
+		if errors.Is(err, identity.ErrIdentityNotFound) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, err
+	}
+	if ident.Type != identity.TypeServiceAccount {
+		return nil, ErrAccountNotFound
+	}
+	return ident, nil
+}
+
+func authError(reason string) error {
+	return fmt.Errorf("%w: %s", ErrAuthenticationFailed, reason)
+}
+
+// Ensure ManagerImpl implements Manager.
+var _ Manager = (*ManagerImpl)(nil)
@@ -0,0 +1,391 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package serviceaccount
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/cache"
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/token"
+)
+
+// memoryPool keeps keys in memory, returning copies like a database.
+type memoryPool struct {
+	mu   sync.Mutex
+	keys []*Key
+}
+
+func (p *memoryPool) GetKey(_ context.Context, id uuid.UUID) (*Key, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, k := range p.keys {
+		if k.ID == id {
+			c := *k
+			return &c, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+func (p *memoryPool) ListKeys(_ context.Context, identityID uuid.UUID) ([]*Key, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var keys []*Key
+	for _, k := range p.keys {
+		if k.IdentityID == identityID {
+			c := *k
+			keys = append(keys, &c)
+		}
+	}
+	return keys, nil
+}
+
+func (p *memoryPool) GetSecretKeyByKeyID(_ context.Context, keyID string) (*Key, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, k := range p.keys {
+		if k.Type == KeyTypeSecret && k.KeyID == keyID {
+			c := *k
+			return &c, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+func (p *memoryPool) CreateKey(_ context.Context, k *Key) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := *k
+	c.Secret = ""
+	p.keys = append(p.keys, &c)
+	return nil
+}
+
+func (p *memoryPool) UpdateKey(_ context.Context, k *Key) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, stored := range p.keys {
+		if stored.ID == k.ID {
+			stored.Name, stored.ExpiresAt = k.Name, k.ExpiresAt
+			return nil
+		}
+	}
+	return ErrKeyNotFound
+}
+
+func (p *memoryPool) UpdateKeyLastUsed(_ context.Context, k *Key, at time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, stored := range p.keys {
+		if stored.ID == k.ID {
+			stored.LastUsedAt = &at
+			return nil
+		}
+	}
+	return ErrKeyNotFound
+}
+
+func (p *memoryPool) DeleteKey(_ context.Context, k *Key) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = slices.DeleteFunc(p.keys, func(stored *Key) bool { return stored.ID == k.ID })
+	return nil
+}
+
+type identities struct {
+	identity.Pool
+	byID map[uuid.UUID]*identity.Identity
+}
+
+func (p *identities) GetIdentity(_ context.Context, id uuid.UUID) (*identity.Identity, error) {
+	if i, ok := p.byID[id]; ok {
+		return i, nil
+	}
+	return nil, identity.ErrIdentityNotFound
+}
+
+type tokens struct {
+	token.Manager
+}
+
+func (tokens) CreateToken(_ context.Context, req *token.CreateTokenRequest) (*token.Token, error) {
+	return &token.Token{ID: uuid.New(), IdentityID: req.IdentityID, Type: req.Type, Value: "token-" + req.IdentityID.String()}, nil
+}
+
+const testAudience = "https://iam.example.com/api/v1/service-accounts/token"
+
+type fixture struct {
+	m       *ManagerImpl
+	pool    *memoryPool
+	account *identity.Identity
+	user    *identity.Identity
+	now     time.Time
+}
+
+func newFixture() *fixture {
+	f := &fixture{
+		pool:    &memoryPool{},
+		account: &identity.Identity{ID: uuid.New(), Type: identity.TypeServiceAccount, State: identity.StateActive},
+		user:    &identity.Identity{ID: uuid.New(), Type: identity.TypeUser, State: identity.StateActive},
+		now:     time.Unix(1700000000, 0).UTC(),
+	}
+	ids := &identities{byID: map[uuid.UUID]*identity.Identity{f.account.ID: f.account, f.user.ID: f.user}}
+	f.m = NewManagerImpl(f.pool, ids, tokens{})
+	f.m.SetConfig(Config{Audience: []string{testAudience}})
+	f.m.SetReplayCache(cache.NewMemoryCache())
+	f.m.now = func() time.Time { return f.now }
+	return f
+}
+
+func (f *fixture) claims(jti string) map[string]any {
+	sub := f.account.ID.String()
+	return map[string]any{
+		"iss": sub, "sub": sub, "aud": testAudience, "jti": jti,
+		"iat": f.now.Unix(), "exp": f.now.Add(5 * time.Minute).Unix(),
+	}
+}
+
+func (f *fixture) assertion(assertion string) *TokenRequest {
+	return &TokenRequest{
+		GrantType:           GrantTypeClientCredentials,
+		ClientAssertionType: AssertionTypeJWTBearer,
+		ClientAssertion:     assertion,
+	}
+}
+
+func (f *fixture) secret(secret string) *TokenRequest {
+	return &TokenRequest{GrantType: GrantTypeClientCredentials, ClientSecret: secret}
+}
+
+func TestIssueTokenWithAssertion(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture()
+	for alg, key := range newSigners(t) {
+		k, err := f.m.CreateKey(ctx, f.account.ID, &CreateKeyRequest{PublicKey: publicPEM(t, key)})
+		if err != nil {
+			t.Fatalf("CreateKey(%s) error = %v", alg, err)
+		}
+		if k.Type != KeyTypePublic || k.Algorithm != alg || k.KeyID == "" {
+			t.Fatalf("CreateKey(%s) = %+v", alg, k)
+		}
+
+		// With and without the kid of the key.
+		for _, kid := range []string{k.KeyID, ""} {
+			resp, err := f.m.IssueToken(ctx, f.assertion(sign(t, key, kid, f.claims(alg+kid))))
+			if err != nil {
+				t.Fatalf("IssueToken(%s, kid %q) error = %v", alg, kid, err)
+			}
+			if resp.TokenType != "Bearer" || resp.ExpiresIn != int64(DefaultTokenTTL/time.Second) {
+				t.Errorf("IssueToken(%s) = %+v", alg, resp)
+			}
+		}
+		if k, _ := f.m.GetKey(ctx, f.account.ID, k.ID); k.LastUsedAt == nil || !k.LastUsedAt.Equal(f.now) {
+			t.Errorf("%s key last used at %v, want %v", alg, k.LastUsedAt, f.now)
+		}
+
+		if _, err := f.m.CreateKey(ctx, f.account.ID, &CreateKeyRequest{PublicKey: publicPEM(t, key)}); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("CreateKey(%s) again error = %v, want ErrInvalidKey", alg, err)
+		}
+	}
+
+	key := newSigners(t)[AlgEdDSA]
+	if _, err := f.m.CreateKey(ctx, f.account.ID, &CreateKeyRequest{PublicKey: publicPEM(t, key), KeyID: "ed"}); err != nil {
+		t.Fatal(err)
+	}
+	replayed := sign(t, key, "ed", f.claims("replayed"))
+	if _, err := f.m.IssueToken(ctx, f.assertion(replayed)); err != nil {
+		t.Fatal(err)
+	}
+
+	wrongAudience := f.claims("aud")
+	wrongAudience["aud"] = "https://other.example.com"
+	unknown := newSigners(t)[AlgEdDSA]
+	for name, req := range map[string]*TokenRequest{
+		"replayed":       f.assertion(replayed),
+		"wrong kid":      f.assertion(sign(t, key, "other", f.claims("kid"))),
+		"unknown key":    f.assertion(sign(t, unknown, "", f.claims("unknown"))),
+		"wrong audience": f.assertion(sign(t, key, "ed", wrongAudience)),
+		"malformed":      f.assertion("not.a.jwt"),
+	} {
+		if _, err := f.m.IssueToken(ctx, req); !errors.Is(err, ErrAuthenticationFailed) {
+			t.Errorf("IssueToken(%s) error = %v, want ErrAuthenticationFailed", name, err)
+		}
+	}
+
+	f.m.SetConfig(Config{})
+	unconfigured := f.assertion(sign(t, key, "ed", f.claims("unconfigured")))
+	if _, err := f.m.IssueToken(ctx, unconfigured); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("IssueToken() without audience error = %v, want ErrAuthenticationFailed", err)
+	}
+}
+
+// remoteCache delays the responses of a cache like the round trips to a
+// shared cache.
+type remoteCache struct {
+	cache.Cache
+}
+
+func (c remoteCache) Get(ctx context.Context, key string) ([]byte, error) {
+	defer time.Sleep(10 * time.Millisecond)
+	return c.Cache.Get(ctx, key)
+}
+
+func (c remoteCache) SetNX(ctx context.Context, key string, value []byte, ttl int64) (bool, error) {
+	defer time.Sleep(10 * time.Millisecond)
+	return c.Cache.SetNX(ctx, key, value, ttl)
+}
+
+func TestIssueTokenReplayedConcurrently(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture()
+	f.m.SetReplayCache(remoteCache{cache.NewMemoryCache()})
+	key := newSigners(t)[AlgEdDSA]
+	if _, err := f.m.CreateKey(ctx, f.account.ID, &CreateKeyRequest{PublicKey: publicPEM(t, key), KeyID: "ed"}); err != nil {
+		t.Fatal(err)
+	}
+	assertion := sign(t, key, "ed", f.claims("concurrent"))
+
+	var wg sync.WaitGroup
+	var issued, rejected atomic.Int32
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := f.m.IssueToken(ctx, f.assertion(assertion))
+			switch {
+			case err == nil:
+				issued.Add(1)
+			case errors.Is(err, ErrAuthenticationFailed):
+				rejected.Add(1)
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if issued.Load() != 1 || rejected.Load() != 15 {
+		t.Errorf("issued %d tokens and rejected %d requests, want 1 and 15", issued.Load(), rejected.Load())
+	}
+}
+
+func TestIssueTokenWithSecret(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture()
+	k, err := f.m.CreateKey(ctx, f.account.ID, &CreateKeyRequest{Name: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Type != KeyTypeSecret || !strings.HasPrefix(k.Secret, k.KeyID+".") {
+		t.Fatalf("CreateKey() = %+v", k)
+	}
+	if stored, _ := f.m.GetKey(ctx, f.account.ID, k.ID); stored.Secret != "" {
+		t.Error("GetKey() returned the secret")
+	}
+
+	if _, err := f.m.IssueToken(ctx, f.secret(k.Secret)); err != nil {
+		t.Fatal(err)
+	}
+	used := f.now
+	f.now = f.now.Add(LastUsedResolution / 2)
+	req := f.secret(k.Secret)
+	req.ClientID = f.account.ID.String()
+	if _, err := f.m.IssueToken(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if k, _ := f.m.GetKey(ctx, f.account.ID, k.ID); k.LastUsedAt == nil || !k.LastUsedAt.Equal(used) {
+		t.Errorf("last used at %v, want %v", k.LastUsedAt, used)
+	}
+
+	otherClient := f.secret(k.Secret)
+	otherClient.ClientID = uuid.NewString()
+	for name, req := range map[string]*TokenRequest{
+		"wrong secret": f.secret(k.KeyID + ".wrong"),
+		"malformed":    f.secret("secret"),
+		"other client": otherClient,
+	} {
+		if _, err := f.m.IssueToken(ctx, req); !errors.Is(err, ErrAuthenticationFailed) {
+			t.Errorf("IssueToken(%s) error = %v, want ErrAuthenticationFailed", name, err)
+		}
+	}
+	if _, err := f.m.IssueToken(ctx, &TokenRequest{GrantType: "password"}); !errors.Is(err, ErrUnsupportedGrant) {
+		t.Errorf("IssueToken(password) error = %v, want ErrUnsupportedGrant", err)
+	}
+
+	f.account.State = identity.StateSuspended
+	if _, err := f.m.IssueToken(ctx, f.secret(k.Secret)); !errors.Is(err, identity.ErrIdentityInactive) {
+		t.Errorf("IssueToken(suspended) error = %v, want ErrIdentityInactive", err)
+	}
+
+	if _, err := f.m.CreateKey(ctx, f.user.ID, &CreateKeyRequest{}); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("CreateKey(user) error = %v, want ErrAccountNotFound", err)
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture()
+	old, err := f.m.CreateKey(ctx, f.account.ID, &CreateKeyRequest{Name: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overlap := time.Hour
+	r, err := f.m.RotateKey(ctx, f.account.ID, old.ID, &RotateKeyRequest{Overlap: &overlap})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Key.Name != "ci" || r.Key.Secret == "" || r.Key.Secret == old.Secret {
+		t.Errorf("RotateKey() key = %+v", r.Key)
+	}
+	if want := f.now.Add(overlap); r.Previous.ExpiresAt == nil || !r.Previous.ExpiresAt.Equal(want) {
+		t.Errorf("RotateKey() previous expires at %v, want %v", r.Previous.ExpiresAt, want)
+	}
+
+	// Both keys work during the overlap, only the new one afterwards.
+	for _, secret := range []string{old.Secret, r.Key.Secret} {
+		if _, err := f.m.IssueToken(ctx, f.secret(secret)); err != nil {
+			t.Errorf("IssueToken() during overlap error = %v", err)
+		}
+	}
+	f.now = f.now.Add(overlap)
+	if _, err := f.m.IssueToken(ctx, f.secret(old.Secret)); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Errorf("IssueToken(rotated) error = %v, want ErrAuthenticationFailed", err)
+	}
+	if _, err := f.m.IssueToken(ctx, f.secret(r.Key.Secret)); err != nil {
+		t.Errorf("IssueToken(new) error = %v", err)
+	}
+	if _, err := f.m.RotateKey(ctx, f.account.ID, old.ID, &RotateKeyRequest{}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("RotateKey(expired) error = %v, want ErrInvalidKey", err)
+	}
+
+	// Rotating a public key requires the new public key, and a zero
+	// overlap expires the rotated key at once.
+	signers := newSigners(t)
+	pub, err := f.m.CreateKey(ctx, f.account.ID, &CreateKeyRequest{PublicKey: publicPEM(t, signers[AlgRS256])})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.m.RotateKey(ctx, f.account.ID, pub.ID, &RotateKeyRequest{}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("RotateKey() without public key error = %v, want ErrInvalidKey", err)
+	}
+	var zero time.Duration
+	r, err = f.m.RotateKey(ctx, f.account.ID, pub.ID, &RotateKeyRequest{PublicKey: publicPEM(t, signers[AlgES256]), Overlap: &zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Key.Algorithm != AlgES256 || r.Previous.Active(f.now) {
+		t.Errorf("RotateKey() = %+v, previous %+v", r.Key, r.Previous)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package serviceaccount
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// pool implements PrivilegedPool, keeping secrets in
+// persistence.SecretKeyPersister and public keys in
+// persistence.PublicKeyPersister.
+type pool struct {
+	secretKeys persistence.SecretKeyPersister
+	publicKeys persistence.PublicKeyPersister
+}
+
+// NewPool creates a new key pool.
+func NewPool(secretKeys persistence.SecretKeyPersister, publicKeys persistence.PublicKeyPersister) Pool {
+	return &pool{secretKeys: secretKeys, publicKeys: publicKeys}
+}
+
+// NewPrivilegedPool creates a new key privileged pool.
+func NewPrivilegedPool(secretKeys persistence.SecretKeyPersister, publicKeys persistence.PublicKeyPersister) PrivilegedPool {
+	return &pool{secretKeys: secretKeys, publicKeys: publicKeys}
+}
+
+// GetKey retrieves a public or secret key by ID.
+func (p *pool) GetKey(ctx context.Context, id uuid.UUID) (*Key, error) {
+	pk, err := p.publicKeys.GetPublicKey(ctx, id.String())
+	if err == nil {
+		return publicKeyToDomain(pk), nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	sk, err := p.secretKeys.GetSecretKey(ctx, id.String())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, err
+	}
+	return secretKeyToDomain(sk), nil
+}
+
+// ListKeys lists the public and secret keys of a service account, oldest
+// first.
+func (p *pool) ListKeys(ctx context.Context, identityID uuid.UUID) ([]*Key, error) {
+	pks, err := p.publicKeys.ListPublicKeysByIdentityID(ctx, identityID.String())
+	if err != nil {
+		return nil, err
+	}
+	sks, err := p.secretKeys.ListSecretKeysByIdentityID(ctx, identityID.String())
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*Key, 0, len(pks)+len(sks))
+	for _, pk := range pks {
+		keys = append(keys, publicKeyToDomain(pk))
+	}
+	for _, sk := range sks {
+		keys = append(keys, secretKeyToDomain(sk))
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+// GetSecretKeyByKeyID retrieves a secret key by its key ID.
+func (p *pool) GetSecretKeyByKeyID(ctx context.Context, keyID string) (*Key, error) {
+	sk, err := p.secretKeys.GetSecretKeyByKeyID(ctx, keyID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, err
+	}
+	return secretKeyToDomain(sk), nil
+}
+
+// CreateKey stores a new key.
+func (p *pool) CreateKey(ctx context.Context, k *Key) error {
+	if k.Type == KeyTypePublic {
+		return p.publicKeys.CreatePublicKey(ctx, &persistence.PublicKey{
+			ID:         k.ID.String(),
+			IdentityID: k.IdentityID.String(),
+			KeyID:      k.KeyID,
+			Algorithm:  k.Algorithm,
+			Key:        []byte(k.PublicKey),
+			Name:       k.Name,
+			ExpiresAt:  k.ExpiresAt,
+			LastUsedAt: k.LastUsedAt,
+			CreatedAt:  k.CreatedAt,
+		})
+	}
+	return p.secretKeys.CreateSecretKey(ctx, &persistence.SecretKey{
+		ID:         k.ID.String(),
+		IdentityID: k.IdentityID.String(),
+		KeyID:      k.KeyID,
+		SecretHash: k.SecretHash,
+		Name:       k.Name,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		CreatedAt:  k.CreatedAt,
+	})
+}
+
+// UpdateKey writes the name and expiry of a key.
+func (p *pool) UpdateKey(ctx context.Context, k *Key) error {
+	if k.Type == KeyTypePublic {
+		return p.publicKeys.UpdatePublicKey(ctx, &persistence.PublicKey{
+			ID:        k.ID.String(),
+			Name:      k.Name,
+			ExpiresAt: k.ExpiresAt,
+		})
+	}
+	return p.secretKeys.UpdateSecretKey(ctx, &persistence.SecretKey{
+		ID:        k.ID.String(),
+		Name:      k.Name,
+		ExpiresAt: k.ExpiresAt,
+	})
+}
+
+// UpdateKeyLastUsed records when a key was last used.
+func (p *pool) UpdateKeyLastUsed(ctx context.Context, k *Key, at time.Time) error {
+	if k.Type == KeyTypePublic {
+		return p.publicKeys.UpdatePublicKeyLastUsed(ctx, k.ID.String(), at)
+	}
+	return p.secretKeys.UpdateSecretKeyLastUsed(ctx, k.ID.String(), at)
+}
+
+// DeleteKey deletes a key.
+func (p *pool) DeleteKey(ctx context.Context, k *Key) error {
+	if k.Type == KeyTypePublic {
+		return p.publicKeys.DeletePublicKey(ctx, k.ID.String())
+	}
+	return p.secretKeys.DeleteSecretKey(ctx, k.ID.String())
+}
+
+func publicKeyToDomain(m *persistence.PublicKey) *Key {
+	return &Key{
+		ID:         parseUUID(m.ID),
+		IdentityID: parseUUID(m.IdentityID),
+		Type:       KeyTypePublic,
+		KeyID:      m.KeyID,
+		Name:       m.Name,
+		Algorithm:  m.Algorithm,
+		PublicKey:  string(m.Key),
+		ExpiresAt:  m.ExpiresAt,
+		LastUsedAt: m.LastUsedAt,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+func secretKeyToDomain(m *persistence.SecretKey) *Key {
+	return &Key{
+		ID:         parseUUID(m.ID),
+		IdentityID: parseUUID(m.IdentityID),
+		Type:       KeyTypeSecret,
+		KeyID:      m.KeyID,
+		Name:       m.Name,
+		SecretHash: m.SecretHash,
+		ExpiresAt:  m.ExpiresAt,
+		LastUsedAt: m.LastUsedAt,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+func parseUUID(s string) uuid.UUID {
+	if s == "" {
+		return uuid.Nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+// Ensure pool implements PrivilegedPool.
+var _ PrivilegedPool = (*pool)(nil)
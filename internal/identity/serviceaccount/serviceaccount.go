@@ -0,0 +1,172 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package serviceaccount authenticates service accounts, identities of
+// type identity.TypeServiceAccount, with keys instead of passwords.
+//
+// A service account exchanges a client assertion (RFC 7523), a JWT signed
+// with one of its public keys, or one of its secrets for an access token
+// in a client credentials grant. Keys are rotated by adding a new key and
+// letting the previous one expire after an overlap window, during which
+// both are accepted.
+package serviceaccount
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KeyType represents the type of a key.
+type KeyType string
+
+const (
+	// KeyTypePublic keys verify client assertions.
+	KeyTypePublic KeyType = "public_key"
+	// KeyTypeSecret keys are shared secrets, stored as hashes.
+	KeyTypeSecret KeyType = "secret"
+)
+
+// Signing algorithms of client assertions.
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Values of token requests.
+const (
+	GrantTypeClientCredentials = "client_credentials"
+	AssertionTypeJWTBearer     = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+const (
+	// DefaultTokenTTL is how long issued access tokens stay valid.
+	DefaultTokenTTL = time.Hour
+	// DefaultRotationOverlap is how long a rotated key stays valid.
+	DefaultRotationOverlap = 24 * time.Hour
+	// MaxAssertionLifetime bounds how far ahead client assertions expire.
+	MaxAssertionLifetime = time.Hour
+	// ClockSkew is tolerated when checking the times of client assertions.
+	ClockSkew = time.Minute
+	// LastUsedResolution is how often the last use of a key is recorded
+	// at most.
+	LastUsedResolution = time.Minute
+)
+
+// Key is a key a service account authenticates with.
+type Key struct {
+	ID         uuid.UUID `json:"id"`
+	IdentityID uuid.UUID `json:"identity_id"`
+	Type       KeyType   `json:"type"`
+	// KeyID is the kid of the assertions signed with a public key, or the
+	// public prefix of a secret.
+	KeyID string `json:"key_id"`
+	Name  string `json:"name,omitempty"`
+	// Algorithm and PublicKey, in PEM, are set on public keys.
+	Algorithm string `json:"algorithm,omitempty"`
+	PublicKey string `json:"public_key,omitempty"`
+	// Secret is only returned when a secret key is created.
+	Secret     string     `json:"secret,omitempty"`
+	SecretHash string     `json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	// LastUsedAt is when the key last authenticated the service account,
+	// recorded every LastUsedResolution at most.
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Active reports whether the key is accepted at the given time.
+func (k *Key) Active(at time.Time) bool {
+	return k.ExpiresAt == nil || at.Before(*k.ExpiresAt)
+}
+
+// Pool defines the interface for reading keys. Missing keys are reported
+// as ErrKeyNotFound.
+type Pool interface {
+	GetKey(ctx context.Context, id uuid.UUID) (*Key, error)
+	// ListKeys lists the keys of a service account, oldest first.
+	ListKeys(ctx context.Context, identityID uuid.UUID) ([]*Key, error)
+	GetSecretKeyByKeyID(ctx context.Context, keyID string) (*Key, error)
+}
+
+// PrivilegedPool defines the interface for writing keys.
+type PrivilegedPool interface {
+	Pool
+
+	CreateKey(ctx context.Context, k *Key) error
+	// UpdateKey writes the name and expiry of a key.
+	UpdateKey(ctx context.Context, k *Key) error
+	UpdateKeyLastUsed(ctx context.Context, k *Key, at time.Time) error
+	DeleteKey(ctx context.Context, k *Key) error
+}
+
+// Manager defines the interface for service account business logic.
+type Manager interface {
+	CreateKey(ctx context.Context, identityID uuid.UUID, req *CreateKeyRequest) (*Key, error)
+	GetKey(ctx context.Context, identityID, id uuid.UUID) (*Key, error)
+	ListKeys(ctx context.Context, identityID uuid.UUID) ([]*Key, error)
+	// RotateKey adds a key of the same type and makes the rotated key
+	// expire after an overlap window.
+	RotateKey(ctx context.Context, identityID, id uuid.UUID, req *RotateKeyRequest) (*Rotation, error)
+	DeleteKey(ctx context.Context, identityID, id uuid.UUID) error
+
+	// IssueToken authenticates a service account and issues it an access
+	// token.
+	IssueToken(ctx context.Context, req *TokenRequest) (*TokenResponse, error)
+}
+
+// CreateKeyRequest holds data for adding a key to a service account.
+type CreateKeyRequest struct {
+	// Type defaults to KeyTypePublic when PublicKey is set and to
+	// KeyTypeSecret otherwise.
+	Type KeyType `json:"type"`
+	Name string  `json:"name"`
+	// PublicKey is a PEM encoded RSA (2048 bits or more), P-256 or Ed25519
+	// public key.
+	PublicKey string `json:"public_key"`
+	// KeyID is the kid of public keys; it defaults to the JWK thumbprint
+	// of the key (RFC 7638).
+	KeyID     string     `json:"key_id"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// RotateKeyRequest holds data for rotating a key. Public keys take the new
+// public key; secrets are generated.
+type RotateKeyRequest struct {
+	// Name defaults to the name of the rotated key.
+	Name      string     `json:"name"`
+	PublicKey string     `json:"public_key"`
+	KeyID     string     `json:"key_id"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	// Overlap is how long the rotated key stays valid; it defaults to the
+	// configured overlap and zero expires it at once.
+	Overlap *time.Duration `json:"overlap"`
+}
+
+// Rotation is the result of a key rotation.
+type Rotation struct {
+	Key      *Key `json:"key"`
+	Previous *Key `json:"previous"`
+}
+
+// TokenRequest is a client credentials grant. Clients authenticate with
+// ClientAssertion or ClientSecret; ClientID is optional and must name the
+// service account when set.
+type TokenRequest struct {
+	GrantType           string `json:"grant_type"            form:"grant_type"`
+	ClientID            string `json:"client_id"             form:"client_id"`
+	ClientSecret        string `json:"client_secret"         form:"client_secret"`
+	ClientAssertionType string `json:"client_assertion_type" form:"client_assertion_type"`
+	ClientAssertion     string `json:"client_assertion"      form:"client_assertion"`
+}
+
+// TokenResponse holds an issued access token.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	// ExpiresIn is the lifetime of the token in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+}
@@ -11,19 +11,24 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/identity"
 )
 
 // ManagerImpl implements token.Manager.
 type ManagerImpl struct {
-	pool     Pool
-	privPool PrivilegedPool
+	pool       Pool
+	privPool   PrivilegedPool
+	identities identity.Pool
 }
 
-// NewManagerImpl creates a new token manager.
-func NewManagerImpl(pool Pool, privPool PrivilegedPool) *ManagerImpl {
+// NewManagerImpl creates a new token manager. Tokens are only issued to
+// and accepted for active identities.
+func NewManagerImpl(pool Pool, privPool PrivilegedPool, identities identity.Pool) *ManagerImpl {
 	return &ManagerImpl{
-		pool:     pool,
-		privPool: privPool,
+		pool:       pool,
+		privPool:   privPool,
+		identities: identities,
 	}
 }
 
@@ -32,6 +37,9 @@ func (m *ManagerImpl) CreateToken(ctx context.Context, req *CreateTokenRequest)
 	if req.TTL == 0 {
 		req.TTL = 1 * time.Hour
 	}
+	if err := m.checkIdentity(ctx, req.IdentityID); err != nil {
+		return nil, err
+	}
 
 	value, err := generateToken()
 	if err != nil {
@@ -69,9 +77,21 @@ func (m *ManagerImpl) IntrospectToken(ctx context.Context, value string) (*Token
 	if time.Now().After(t.ExpiresAt) {
 		return nil, ErrTokenExpired
 	}
+	if err := m.checkIdentity(ctx, t.IdentityID); err != nil {
+		return nil, err
+	}
 	return t, nil
 }
 
+// checkIdentity returns an error unless the identity exists and is active.
+func (m *ManagerImpl) checkIdentity(ctx context.Context, identityID uuid.UUID) error {
+	ident, err := m.identities.GetIdentity(ctx, identityID)
+	if err != nil {
+		return err
+	}
+	return ident.CheckActive()
+}
+
 // RevokeToken revokes a token by ID.
 func (m *ManagerImpl) RevokeToken(ctx context.Context, id uuid.UUID) error {
 	return m.privPool.DeleteToken(ctx, id)
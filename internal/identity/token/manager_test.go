@@ -0,0 +1,76 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package token
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/identity"
+)
+
+// memoryPool keeps tokens in memory.
+type memoryPool struct {
+	PrivilegedPool
+	tokens map[string]*Token
+}
+
+func (p *memoryPool) CreateToken(_ context.Context, t *Token) error {
+	p.tokens[t.Value] = t
+	return nil
+}
+
+func (p *memoryPool) GetTokenByValue(_ context.Context, value string) (*Token, error) {
+	t, ok := p.tokens[value]
+	if !ok {
+		return nil, errors.New("token not found")
+	}
+	return t, nil
+}
+
+// identities holds a single identity.
+type identities struct {
+	identity.Pool
+	ident *identity.Identity
+}
+
+func (p *identities) GetIdentity(_ context.Context, id uuid.UUID) (*identity.Identity, error) {
+	if id != p.ident.ID {
+		return nil, identity.ErrIdentityNotFound
+	}
+	i := *p.ident
+	return &i, nil
+}
+
+func TestTokensRequireActiveIdentity(t *testing.T) {
+	ctx := context.Background()
+	ident := &identity.Identity{ID: uuid.New(), State: identity.StateActive}
+	pool := &memoryPool{tokens: map[string]*Token{}}
+	m := NewManagerImpl(pool, pool, &identities{ident: ident})
+
+	issued, err := m.CreateToken(ctx, &CreateTokenRequest{IdentityID: ident.ID, Type: TokenTypeAccess})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.IntrospectToken(ctx, issued.Value); err != nil {
+		t.Fatalf("IntrospectToken() of an active identity error = %v", err)
+	}
+
+	for _, state := range []identity.State{identity.StateInactive, identity.StateSuspended, identity.StatePendingDeletion} {
+		ident.State = state
+		if _, err := m.IntrospectToken(ctx, issued.Value); !errors.Is(err, identity.ErrIdentityInactive) {
+			t.Errorf("IntrospectToken() in %s error = %v, want ErrIdentityInactive", state, err)
+		}
+		if _, err := m.CreateToken(ctx, &CreateTokenRequest{IdentityID: ident.ID, Type: TokenTypeAccess}); !errors.Is(err, identity.ErrIdentityInactive) {
+			t.Errorf("CreateToken() in %s error = %v, want ErrIdentityInactive", state, err)
+		}
+	}
+	if len(pool.tokens) != 1 {
+		t.Errorf("issued %d tokens, want 1", len(pool.tokens))
+	}
+}
@@ -21,6 +21,7 @@ type tokenPool struct {
 type tokenPersister interface {
 	GetToken(ctx context.Context, id string) (*persistence.Token, error)
 	GetTokenByValue(ctx context.Context, value string) (*persistence.Token, error)
+	ListTokensByIdentityID(ctx context.Context, identityID string) ([]*persistence.Token, error)
 	CreateToken(ctx context.Context, token *persistence.Token) error
 	DeleteToken(ctx context.Context, id string) error
 	DeleteExpiredTokens(ctx context.Context) error
@@ -51,8 +52,15 @@ func (p *tokenPool) GetTokenByValue(ctx context.Context, value string) (*Token,
 
 // ListTokens lists all tokens for an identity.
 func (p *tokenPool) ListTokens(ctx context.Context, identityID uuid.UUID) ([]*Token, error) {
-	// Not in persister interface - return empty for now
-	return []*Token{}, nil
+	ms, err := p.persister.ListTokensByIdentityID(ctx, identityID.String())
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]*Token, len(ms))
+	for i := range ms {
+		tokens[i] = p.modelToDomain(ms[i])
+	}
+	return tokens, nil
 }
 
 func (p *tokenPool) modelToDomain(m *persistence.Token) *Token {
@@ -18,6 +18,8 @@ const (
 	TokenTypeAccess  TokenType = "access"
 	TokenTypeRefresh TokenType = "refresh"
 	TokenTypeAPIKey  TokenType = "api_key"
+	// TokenTypePasswordChange allows replacing an expired password once.
+	TokenTypePasswordChange TokenType = "password_change"
 )
 
 // Token represents a token in the system.
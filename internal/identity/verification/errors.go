@@ -0,0 +1,17 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package verification
+
+import "errors"
+
+var (
+	// ErrCodeInvalid is returned for wrong, expired and exhausted codes and
+	// for unknown link tokens.
+	ErrCodeInvalid = errors.New("verification code is invalid or expired")
+
+	// ErrAddressNotVerified is returned when an identity lacks the verified
+	// addresses an action requires.
+	ErrAddressNotVerified = errors.New("address is not verified")
+)
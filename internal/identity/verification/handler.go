@@ -0,0 +1,114 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package verification
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/pkg/api"
+)
+
+// Handler handles HTTP requests for address verification.
+type Handler struct {
+	manager Manager
+}
+
+// NewHandler creates a new verification handler.
+func NewHandler(manager Manager) *Handler {
+	return &Handler{manager: manager}
+}
+
+// Send handles POST /api/v1/verification.
+// It sends a code and link to an address given by address_id or by via
+// and value.
+func (h *Handler) Send(c *gin.Context) {
+	var req SendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+	if req.AddressID == uuid.Nil && (req.Via == "" || req.Value == "") {
+		api.FailWithMessage("address_id or via and value are required", c)
+		return
+	}
+	req.NetworkID = networkID(c)
+
+	challenge, err := h.manager.Send(c.Request.Context(), &req)
+	if err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(challenge, c)
+}
+
+// Verify handles POST /api/v1/verification/verify.
+// It verifies an address with the code sent to it or the token of a link.
+func (h *Handler) Verify(c *gin.Context) {
+	var req VerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+	if req.Token == "" && (req.Via == "" || req.Value == "" || req.Code == "") {
+		api.FailWithMessage("token or via, value and code are required", c)
+		return
+	}
+	h.verify(c, &req)
+}
+
+// VerifyLink handles GET /api/v1/verification/verify, which verification
+// links point to.
+func (h *Handler) VerifyLink(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		api.FailWithMessage("token is required", c)
+		return
+	}
+	h.verify(c, &VerifyRequest{Token: token})
+}
+
+func (h *Handler) verify(c *gin.Context, req *VerifyRequest) {
+	req.NetworkID = networkID(c)
+	req.ClientIP = c.ClientIP()
+	req.UserAgent = c.GetHeader("User-Agent")
+	req.RequestID = c.GetHeader("X-Request-ID")
+
+	addr, err := h.manager.Verify(c.Request.Context(), req)
+	if err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(addr, c)
+}
+
+// RequireVerified returns middleware rejecting requests of identities
+// that lack the verified addresses the policy requires for action.
+// Requests without an identity pass.
+func RequireVerified(manager Manager, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identityID, err := uuid.Parse(c.GetString("identity_id"))
+		if err != nil {
+			c.Next()
+			return
+		}
+		if err := manager.RequireVerified(c.Request.Context(), identityID, action); err != nil {
+			api.FailWithErrCode(err, c)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func networkID(c *gin.Context) uuid.UUID {
+	networkID, err := uuid.Parse(c.GetString("network_id"))
+	if err != nil {
+		return uuid.Nil
+	}
+	return networkID
+}
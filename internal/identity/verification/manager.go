@@ -0,0 +1,349 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package verification
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/coding-hui/iam/internal/audit"
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/persistence"
+	"github.com/coding-hui/iam/pkg/code"
+
+	"github.com/coding-hui/common/errors"
+)
+
+// ManagerImpl implements verification.Manager.
+type ManagerImpl struct {
+	persister  persistence.Persister
+	pool       PrivilegedPool
+	identities identity.PrivilegedPool
+	courier    EventSender
+	audit      audit.Manager
+	config     Config
+	policy     *Policy
+}
+
+// NewManagerImpl creates a new verification manager that delivers codes
+// through courier. Nothing requires verified addresses until a policy is
+// set, see SetPolicy.
+func NewManagerImpl(persister persistence.Persister, pool PrivilegedPool, identities identity.PrivilegedPool, courier EventSender, audit audit.Manager) *ManagerImpl {
+	return &ManagerImpl{
+		persister:  persister,
+		pool:       pool,
+		identities: identities,
+		courier:    courier,
+		audit:      audit,
+		config: Config{
+			CodeTTL:        DefaultCodeTTL,
+			MaxAttempts:    DefaultMaxAttempts,
+			MaxSends:       DefaultMaxSends,
+			ResendInterval: DefaultResendInterval,
+			Window:         DefaultWindow,
+		},
+	}
+}
+
+// SetConfig sets the settings of the verification flow; zero values keep
+// the defaults.
+func (m *ManagerImpl) SetConfig(c Config) {
+	if c.CodeTTL > 0 {
+		m.config.CodeTTL = c.CodeTTL
+	}
+	if c.MaxAttempts > 0 {
+		m.config.MaxAttempts = c.MaxAttempts
+	}
+	if c.MaxSends > 0 {
+		m.config.MaxSends = c.MaxSends
+	}
+	if c.ResendInterval > 0 {
+		m.config.ResendInterval = c.ResendInterval
+	}
+	if c.Window > 0 {
+		m.config.Window = c.Window
+	}
+	m.config.LinkURL = c.LinkURL
+}
+
+// SetPolicy sets the actions that require verified addresses.
+func (m *ManagerImpl) SetPolicy(p *Policy) {
+	m.policy = p
+}
+
+// Send replaces the code of an address with a new one and asks the
+// courier to deliver it together with a link. Within the window of the
+// first code, resends keep the attempts made and are limited by
+// MaxSends and ResendInterval.
+func (m *ManagerImpl) Send(ctx context.Context, req *SendRequest) (*Challenge, error) {
+	addr, err := m.address(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	challenge := &Challenge{Via: req.Via, Value: req.Value, ExpiresAt: time.Now().Add(m.config.CodeTTL)}
+	if addr == nil || addr.Verified {
+		return challenge, nil
+	}
+	challenge.Via, challenge.Value = addr.Via, addr.Value
+
+	prev, err := m.pool.GetCode(ctx, addr.ID)
+	if err != nil && !errors.Is(err, ErrCodeInvalid) {
+		return nil, err
+	}
+	now := time.Now()
+	resend := prev != nil && now.Before(prev.WindowStartedAt.Add(m.config.Window))
+	if resend && (prev.Sends >= m.config.MaxSends || now.Before(prev.CreatedAt.Add(m.config.ResendInterval))) {
+		return challenge, nil
+	}
+
+	otp, err := newCode()
+	if err != nil {
+		return nil, err
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	c := &Code{
+		AddressID:       addr.ID,
+		IdentityID:      addr.IdentityID,
+		CodeHash:        hashCode(addr.ID, otp),
+		LinkHash:        hashToken(token),
+		Sends:           1,
+		WindowStartedAt: now,
+		ExpiresAt:       challenge.ExpiresAt,
+		CreatedAt:       now,
+	}
+
+	sent := true
+	err = m.persister.Transaction(ctx, func(ctx context.Context) error {
+		if resend {
+			c.WindowStartedAt = prev.WindowStartedAt
+			if sent, err = m.pool.ResendCode(ctx, c, prev.LinkHash); err != nil || !sent {
+				return err
+			}
+		} else if err := m.pool.SaveCode(ctx, c); err != nil {
+			return err
+		}
+		addr.Status = identity.VerifiableAddressStatusSent
+		addr.UpdatedAt = now
+		return m.identities.UpdateVerifiableAddress(ctx, addr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !sent {
+		return challenge, nil
+	}
+
+	msg := &Message{
+		Type:       messageType(addr.Via),
+		IdentityID: addr.IdentityID,
+		AddressID:  addr.ID,
+		Via:        addr.Via,
+		To:         addr.Value,
+		Code:       otp,
+		Link:       m.link(token),
+		ExpiresAt:  challenge.ExpiresAt,
+	}
+	if err := m.courier.SendEvent(ctx, msg.Type, msg); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// Verify checks a code or link token and marks its address as verified.
+// Every code entered spends an attempt before it is compared; once the
+// attempts of the window are spent, codes are rejected until it ends.
+func (m *ManagerImpl) Verify(ctx context.Context, req *VerifyRequest) (*identity.VerifiableAddress, error) {
+	var (
+		c    *Code
+		addr *identity.VerifiableAddress
+		err  error
+	)
+	if req.Token != "" {
+		if c, err = m.pool.GetCodeByLink(ctx, hashToken(req.Token)); err != nil {
+			return nil, codeError(err)
+		}
+		if addr, err = m.identities.GetVerifiableAddress(ctx, c.AddressID); err != nil {
+			return nil, codeError(err)
+		}
+	} else {
+		if addr, err = m.identities.FindVerifiableAddress(ctx, req.NetworkID, req.Via, req.Value); err != nil {
+			return nil, codeError(err)
+		}
+		if c, err = m.pool.GetCode(ctx, addr.ID); err != nil {
+			return nil, codeError(err)
+		}
+	}
+
+	now := time.Now()
+	if now.After(c.ExpiresAt) {
+		return nil, codeError(ErrCodeInvalid)
+	}
+	if req.Token == "" {
+		spent, err := m.pool.SpendAttempt(ctx, addr.ID, m.config.MaxAttempts)
+		if err != nil {
+			return nil, err
+		}
+		if !spent || subtle.ConstantTimeCompare(hashCode(addr.ID, req.Code), c.CodeHash) != 1 {
+			return nil, codeError(ErrCodeInvalid)
+		}
+	}
+
+	ident, err := m.identities.GetIdentityByNetworkID(ctx, req.NetworkID, addr.IdentityID)
+	if err != nil {
+		return nil, codeError(err)
+	}
+
+	err = m.persister.Transaction(ctx, func(ctx context.Context) error {
+		addr.Verified = true
+		addr.VerifiedAt = &now
+		addr.Status = identity.VerifiableAddressStatusCompleted
+		addr.UpdatedAt = now
+		if err := m.identities.UpdateVerifiableAddress(ctx, addr); err != nil {
+			return err
+		}
+		if err := m.pool.DeleteCode(ctx, addr.ID); err != nil {
+			return err
+		}
+		return m.record(ctx, ident, addr, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return addr, nil
+}
+
+// RequireVerified checks the addresses of an identity against the policy.
+func (m *ManagerImpl) RequireVerified(ctx context.Context, identityID uuid.UUID, action string) error {
+	if m.policy == nil || !m.policy.Requires(action) {
+		return nil
+	}
+	addrs, err := m.identities.ListVerifiableAddresses(ctx, identityID)
+	if err != nil {
+		return err
+	}
+	return m.policy.Check(action, addrs)
+}
+
+// address returns the address a code is requested for, or nil when there
+// is no such address in the network.
+func (m *ManagerImpl) address(ctx context.Context, req *SendRequest) (*identity.VerifiableAddress, error) {
+	var (
+		addr *identity.VerifiableAddress
+		err  error
+	)
+	if req.AddressID != uuid.Nil {
+		addr, err = m.identities.GetVerifiableAddress(ctx, req.AddressID)
+		if err == nil {
+			_, err = m.identities.GetIdentityByNetworkID(ctx, req.NetworkID, addr.IdentityID)
+		}
+	} else {
+		addr, err = m.identities.FindVerifiableAddress(ctx, req.NetworkID, req.Via, req.Value)
+	}
+	if errors.Is(err, identity.ErrAddressNotFound) || errors.Is(err, identity.ErrIdentityNotFound) || errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return addr, err
+}
+
+// link returns the verification link of a token.
+func (m *ManagerImpl) link(token string) string {
+	if m.config.LinkURL == "" {
+		return ""
+	}
+	u, err := url.Parse(m.config.LinkURL)
+	if err != nil {
+		return ""
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// record writes an audit record of a verified address. Verification is
+// done by the identity itself.
+func (m *ManagerImpl) record(ctx context.Context, ident *identity.Identity, addr *identity.VerifiableAddress, req *VerifyRequest) error {
+	metadata, err := json.Marshal(map[string]any{
+		"address_id": addr.ID,
+		"via":        addr.Via,
+	})
+	if err != nil {
+		return err
+	}
+	return m.audit.RecordEvent(ctx, &audit.RecordEventRequest{
+		NetworkID:  ident.NetworkID,
+		Type:       EventAddressVerified,
+		ActorID:    ident.ID,
+		ActorType:  "identity",
+		TargetID:   ident.ID,
+		TargetType: "identity",
+		Outcome:    "success",
+		ClientIP:   req.ClientIP,
+		UserAgent:  req.UserAgent,
+		RequestID:  req.RequestID,
+		Metadata:   metadata,
+	})
+}
+
+// codeError hides why a code was rejected behind ErrCodeInvalid.
+func codeError(err error) error {
+	switch {
+	case errors.Is(err, ErrCodeInvalid),
+		errors.Is(err, identity.ErrAddressNotFound),
+		errors.Is(err, identity.ErrIdentityNotFound),
+		errors.Is(err, gorm.ErrRecordNotFound):
+		return errors.WrapC(ErrCodeInvalid, code.ErrIdentityVerificationCodeInvalid, "%s", ErrCodeInvalid.Error())
+	default:
+		return err
+	}
+}
+
+// newCode returns a random six digit code.
+func newCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// newToken returns a random link token.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashCode hashes a code together with its address, so that equal codes
+// of different addresses differ.
+func hashCode(addressID uuid.UUID, otp string) []byte {
+	sum := sha256.Sum256([]byte(addressID.String() + ":" + otp))
+	return sum[:]
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Ensure ManagerImpl implements Manager.
+var _ Manager = (*ManagerImpl)(nil)
@@ -0,0 +1,209 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package verification
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/audit"
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+type persister struct {
+	persistence.Persister
+}
+
+func (persister) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// memoryPool keeps codes in memory, returning copies like a database.
+type memoryPool struct {
+	codes map[uuid.UUID]*Code
+}
+
+func (p *memoryPool) GetCode(_ context.Context, addressID uuid.UUID) (*Code, error) {
+	c, ok := p.codes[addressID]
+	if !ok {
+		return nil, ErrCodeInvalid
+	}
+	cp := *c
+	return &cp, nil
+}
+
+func (p *memoryPool) GetCodeByLink(_ context.Context, linkHash string) (*Code, error) {
+	for _, c := range p.codes {
+		if c.LinkHash == linkHash {
+			cp := *c
+			return &cp, nil
+		}
+	}
+	return nil, ErrCodeInvalid
+}
+
+func (p *memoryPool) SaveCode(_ context.Context, c *Code) error {
+	cp := *c
+	p.codes[c.AddressID] = &cp
+	return nil
+}
+
+func (p *memoryPool) ResendCode(_ context.Context, c *Code, prevLinkHash string) (bool, error) {
+	stored, ok := p.codes[c.AddressID]
+	if !ok || stored.LinkHash != prevLinkHash {
+		return false, nil
+	}
+	stored.CodeHash, stored.LinkHash, stored.ExpiresAt, stored.CreatedAt = c.CodeHash, c.LinkHash, c.ExpiresAt, c.CreatedAt
+	stored.Sends++
+	return true, nil
+}
+
+func (p *memoryPool) SpendAttempt(_ context.Context, addressID uuid.UUID, maxAttempts int) (bool, error) {
+	stored, ok := p.codes[addressID]
+	if !ok || stored.Attempts >= maxAttempts {
+		return false, nil
+	}
+	stored.Attempts++
+	return true, nil
+}
+
+func (p *memoryPool) DeleteCode(_ context.Context, addressID uuid.UUID) error {
+	delete(p.codes, addressID)
+	return nil
+}
+
+type identities struct {
+	identity.PrivilegedPool
+	identity *identity.Identity
+	addr     *identity.VerifiableAddress
+}
+
+func (p *identities) FindVerifiableAddress(_ context.Context, _ uuid.UUID, via, value string) (*identity.VerifiableAddress, error) {
+	if via != p.addr.Via || value != p.addr.Value {
+		return nil, identity.ErrAddressNotFound
+	}
+	a := *p.addr
+	return &a, nil
+}
+
+func (p *identities) GetVerifiableAddress(_ context.Context, id uuid.UUID) (*identity.VerifiableAddress, error) {
+	if id != p.addr.ID {
+		return nil, identity.ErrAddressNotFound
+	}
+	a := *p.addr
+	return &a, nil
+}
+
+func (p *identities) UpdateVerifiableAddress(_ context.Context, addr *identity.VerifiableAddress) error {
+	a := *addr
+	p.addr = &a
+	return nil
+}
+
+func (p *identities) GetIdentityByNetworkID(_ context.Context, _, id uuid.UUID) (*identity.Identity, error) {
+	if id != p.identity.ID {
+		return nil, identity.ErrIdentityNotFound
+	}
+	return p.identity, nil
+}
+
+type courier struct {
+	messages []*Message
+}
+
+func (c *courier) SendEvent(_ context.Context, _ string, payload any) error {
+	c.messages = append(c.messages, payload.(*Message))
+	return nil
+}
+
+type auditTrail struct {
+	audit.Manager
+}
+
+func (auditTrail) RecordEvent(context.Context, *audit.RecordEventRequest) error {
+	return nil
+}
+
+func newTestManager(c Config) (*ManagerImpl, *courier, *identities) {
+	ident := &identity.Identity{ID: uuid.New()}
+	ids := &identities{
+		identity: ident,
+		addr:     &identity.VerifiableAddress{ID: uuid.New(), IdentityID: ident.ID, Via: "email", Value: "ann@example.com"},
+	}
+	out := &courier{}
+	m := NewManagerImpl(persister{}, &memoryPool{codes: map[uuid.UUID]*Code{}}, ids, out, auditTrail{})
+	m.SetConfig(c)
+	return m, out, ids
+}
+
+func TestVerifyKeepsAttemptsAcrossResends(t *testing.T) {
+	ctx := context.Background()
+	m, out, ids := newTestManager(Config{MaxAttempts: 3, ResendInterval: time.Nanosecond})
+	send := &SendRequest{Via: "email", Value: "ann@example.com"}
+	verify := func(code string) error {
+		_, err := m.Verify(ctx, &VerifyRequest{Via: "email", Value: "ann@example.com", Code: code})
+		return err
+	}
+
+	if _, err := m.Send(ctx, send); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		if err := verify("wrong"); !errors.Is(err, ErrCodeInvalid) {
+			t.Fatalf("Verify(wrong) %d error = %v, want ErrCodeInvalid", i, err)
+		}
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := m.Send(ctx, send); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.messages) != 2 {
+		t.Fatalf("sent %d messages, want 2", len(out.messages))
+	}
+	if err := verify(out.messages[1].Code); !errors.Is(err, ErrCodeInvalid) {
+		t.Errorf("Verify(resent code) after spent attempts error = %v, want ErrCodeInvalid", err)
+	}
+	if ids.addr.Verified {
+		t.Error("address verified after spent attempts")
+	}
+}
+
+func TestSendLimits(t *testing.T) {
+	ctx := context.Background()
+	m, out, ids := newTestManager(Config{MaxSends: 2})
+	send := &SendRequest{Via: "email", Value: "ann@example.com"}
+
+	for range 2 {
+		if _, err := m.Send(ctx, send); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(out.messages) != 1 {
+		t.Fatalf("sent %d messages within the resend interval, want 1", len(out.messages))
+	}
+
+	m.SetConfig(Config{ResendInterval: time.Nanosecond})
+	for range 3 {
+		time.Sleep(time.Millisecond)
+		if _, err := m.Send(ctx, send); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(out.messages) != 2 {
+		t.Fatalf("sent %d messages, want 2", len(out.messages))
+	}
+
+	if _, err := m.Verify(ctx, &VerifyRequest{Via: "email", Value: "ann@example.com", Code: out.messages[1].Code}); err != nil {
+		t.Fatal(err)
+	}
+	if !ids.addr.Verified {
+		t.Error("address not verified")
+	}
+}
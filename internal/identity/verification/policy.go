@@ -0,0 +1,84 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package verification
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/schema"
+	"github.com/coding-hui/iam/pkg/code"
+
+	"github.com/coding-hui/common/errors"
+)
+
+// Policy lists the actions that require verified addresses.
+type Policy struct {
+	// Actions maps an action, such as ActionLogin, to the channels an
+	// identity needs a verified address of. An empty list accepts a
+	// verified address of any channel. Actions match case-insensitively,
+	// as configuration keys are lower-cased.
+	Actions map[string][]string
+}
+
+// Validate checks the configuration of p.
+func (p *Policy) Validate() error {
+	for action, channels := range p.Actions {
+		for _, via := range channels {
+			if via != schema.ViaEmail && via != schema.ViaSMS {
+				return fmt.Errorf("action %s: channel must be %q or %q, got %q", action, schema.ViaEmail, schema.ViaSMS, via)
+			}
+		}
+	}
+	return nil
+}
+
+// Requires reports whether action requires verified addresses.
+func (p *Policy) Requires(action string) bool {
+	_, ok := p.channels(action)
+	return ok
+}
+
+// Check returns an error wrapping ErrAddressNotVerified unless addrs
+// satisfy the requirement of action.
+func (p *Policy) Check(action string, addrs []*identity.VerifiableAddress) error {
+	channels, ok := p.channels(action)
+	if !ok {
+		return nil
+	}
+	if len(channels) == 0 {
+		if hasVerified(addrs, "") {
+			return nil
+		}
+		return errors.WrapC(ErrAddressNotVerified, code.ErrIdentityAddressNotVerified, "%s requires a verified address", action)
+	}
+	for _, via := range channels {
+		if !hasVerified(addrs, via) {
+			return errors.WrapC(ErrAddressNotVerified, code.ErrIdentityAddressNotVerified, "%s requires a verified %s address", action, via)
+		}
+	}
+	return nil
+}
+
+func (p *Policy) channels(action string) ([]string, bool) {
+	for a, channels := range p.Actions {
+		if strings.EqualFold(a, action) {
+			return channels, true
+		}
+	}
+	return nil, false
+}
+
+// hasVerified reports whether addrs hold a verified address of a channel;
+// an empty channel matches any.
+func hasVerified(addrs []*identity.VerifiableAddress, via string) bool {
+	for _, a := range addrs {
+		if a.Verified && (via == "" || a.Via == via) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package verification
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/coding-hui/iam/internal/identity"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy := &Policy{Actions: map[string][]string{
+		"login":          {},
+		"change_payment": {"email", "sms"},
+	}}
+	email := &identity.VerifiableAddress{Via: "email", Value: "ann@example.com", Verified: true}
+	phone := &identity.VerifiableAddress{Via: "sms", Value: "+4912345"}
+
+	for _, tc := range []struct {
+		action string
+		addrs  []*identity.VerifiableAddress
+		ok     bool
+	}{
+		{"login", nil, false},
+		{"LOGIN", []*identity.VerifiableAddress{phone}, false},
+		{"login", []*identity.VerifiableAddress{phone, email}, true},
+		{"change_payment", []*identity.VerifiableAddress{email, phone}, false},
+		{"change_payment", []*identity.VerifiableAddress{email, {Via: "sms", Verified: true}}, true},
+		{"delete_account", nil, true},
+	} {
+		err := policy.Check(tc.action, tc.addrs)
+		if tc.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.action, err)
+		}
+		if !tc.ok && !errors.Is(err, ErrAddressNotVerified) {
+			t.Errorf("%s: expected ErrAddressNotVerified, got %v", tc.action, err)
+		}
+	}
+
+	if err := (&Policy{Actions: map[string][]string{"login": {"fax"}}}).Validate(); err == nil {
+		t.Error("expected an unknown channel to be rejected")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package verification
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// Code is the pending verification of an address. Only hashes of the code
+// and link token are kept. Attempts and Sends count the codes entered and
+// sent since WindowStartedAt, across resends; CreatedAt is when the code
+// was last sent.
+type Code struct {
+	AddressID       uuid.UUID
+	IdentityID      uuid.UUID
+	CodeHash        []byte
+	LinkHash        string
+	Attempts        int
+	Sends           int
+	WindowStartedAt time.Time
+	ExpiresAt       time.Time
+	CreatedAt       time.Time
+}
+
+// Pool defines the interface for reading verification codes. Missing
+// codes are reported as ErrCodeInvalid.
+type Pool interface {
+	GetCode(ctx context.Context, addressID uuid.UUID) (*Code, error)
+	GetCodeByLink(ctx context.Context, linkHash string) (*Code, error)
+}
+
+// PrivilegedPool defines the interface for writing verification codes.
+type PrivilegedPool interface {
+	Pool
+
+	// SaveCode replaces the code of an address.
+	SaveCode(ctx context.Context, c *Code) error
+	// ResendCode replaces the code of an address like SaveCode, keeping
+	// its attempts and counting the send. It reports false unless the
+	// stored code still has the link hash prevLinkHash.
+	ResendCode(ctx context.Context, c *Code, prevLinkHash string) (bool, error)
+	// SpendAttempt counts an attempt to enter the code of an address. It
+	// reports false when maxAttempts were made.
+	SpendAttempt(ctx context.Context, addressID uuid.UUID, maxAttempts int) (bool, error)
+	DeleteCode(ctx context.Context, addressID uuid.UUID) error
+}
+
+// pool implements PrivilegedPool using persistence.VerificationCodePersister.
+type pool struct {
+	persister persistence.VerificationCodePersister
+}
+
+// NewPool creates a new verification code pool.
+func NewPool(p persistence.VerificationCodePersister) Pool {
+	return &pool{persister: p}
+}
+
+// NewPrivilegedPool creates a new verification code privileged pool.
+func NewPrivilegedPool(p persistence.VerificationCodePersister) PrivilegedPool {
+	return &pool{persister: p}
+}
+
+// GetCode retrieves the code of an address.
+func (p *pool) GetCode(ctx context.Context, addressID uuid.UUID) (*Code, error) {
+	m, err := p.persister.GetVerificationCode(ctx, addressID.String())
+	if err != nil {
+		return nil, notFoundError(err)
+	}
+	return modelToDomain(m), nil
+}
+
+// GetCodeByLink retrieves a code by the hash of its link token.
+func (p *pool) GetCodeByLink(ctx context.Context, linkHash string) (*Code, error) {
+	m, err := p.persister.GetVerificationCodeByLink(ctx, linkHash)
+	if err != nil {
+		return nil, notFoundError(err)
+	}
+	return modelToDomain(m), nil
+}
+
+// SaveCode replaces the code of an address.
+func (p *pool) SaveCode(ctx context.Context, c *Code) error {
+	return p.persister.SaveVerificationCode(ctx, domainToModel(c))
+}
+
+// ResendCode replaces the code of an address unless it was sent again
+// since it was read.
+func (p *pool) ResendCode(ctx context.Context, c *Code, prevLinkHash string) (bool, error) {
+	return p.persister.ResendVerificationCode(ctx, domainToModel(c), prevLinkHash)
+}
+
+// SpendAttempt counts an attempt to enter the code of an address.
+func (p *pool) SpendAttempt(ctx context.Context, addressID uuid.UUID, maxAttempts int) (bool, error) {
+	return p.persister.SpendVerificationAttempt(ctx, addressID.String(), maxAttempts)
+}
+
+// DeleteCode deletes the code of an address.
+func (p *pool) DeleteCode(ctx context.Context, addressID uuid.UUID) error {
+	return p.persister.DeleteVerificationCode(ctx, addressID.String())
+}
+
+func modelToDomain(m *persistence.VerificationCode) *Code {
+	return &Code{
+		AddressID:       parseUUID(m.AddressID),
+		IdentityID:      parseUUID(m.IdentityID),
+		CodeHash:        m.CodeHash,
+		LinkHash:        m.LinkHash,
+		Attempts:        m.Attempts,
+		Sends:           m.Sends,
+		WindowStartedAt: m.WindowStartedAt,
+		ExpiresAt:       m.ExpiresAt,
+		CreatedAt:       m.CreatedAt,
+	}
+}
+
+func domainToModel(c *Code) *persistence.VerificationCode {
+	return &persistence.VerificationCode{
+		AddressID:       c.AddressID.String(),
+		IdentityID:      c.IdentityID.String(),
+		CodeHash:        c.CodeHash,
+		LinkHash:        c.LinkHash,
+		Attempts:        c.Attempts,
+		Sends:           c.Sends,
+		WindowStartedAt: c.WindowStartedAt,
+		ExpiresAt:       c.ExpiresAt,
+		CreatedAt:       c.CreatedAt,
+	}
+}
+
+func parseUUID(s string) uuid.UUID {
+	if s == "" {
+		return uuid.Nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+// notFoundError maps a missing record to ErrCodeInvalid.
+func notFoundError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrCodeInvalid
+	}
+	return err
+}
+
+// Ensure pool implements PrivilegedPool.
+var _ PrivilegedPool = (*pool)(nil)
@@ -0,0 +1,134 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package verification verifies that identities own their email addresses
+// and phone numbers by sending them a code and link through the courier.
+package verification
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/schema"
+)
+
+// Courier message types, one per channel. Webhooks registered for them
+// receive a Message to deliver.
+const (
+	MessageTypeEmail = "verification.email"
+	MessageTypeSMS   = "verification.sms"
+)
+
+// EventAddressVerified is recorded in the audit trail when an address is
+// verified.
+const EventAddressVerified = "identity.address_verified"
+
+// ActionLogin is the action of password logins, see Policy.
+const ActionLogin = "login"
+
+// Defaults of Config.
+const (
+	DefaultCodeTTL        = 15 * time.Minute
+	DefaultMaxAttempts    = 5
+	DefaultMaxSends       = 5
+	DefaultResendInterval = time.Minute
+	DefaultWindow         = 24 * time.Hour
+)
+
+// Manager defines the interface for address verification.
+type Manager interface {
+	// Send sends a code and link to an address. Unknown and verified
+	// addresses, and addresses that were sent too many codes, see Config,
+	// get the same answer without a message, so that addresses cannot be
+	// probed.
+	Send(ctx context.Context, req *SendRequest) (*Challenge, error)
+	// Verify verifies an address with a code or link token.
+	Verify(ctx context.Context, req *VerifyRequest) (*identity.VerifiableAddress, error)
+	// RequireVerified returns an error wrapping ErrAddressNotVerified
+	// unless the identity has the verified addresses the policy requires
+	// for an action.
+	RequireVerified(ctx context.Context, identityID uuid.UUID, action string) error
+}
+
+// Config holds the settings of the verification flow.
+type Config struct {
+	// CodeTTL is how long codes and links stay valid.
+	CodeTTL time.Duration
+	// MaxAttempts is the number of codes that may be entered for an
+	// address per window, across resends.
+	MaxAttempts int
+	// MaxSends is the number of codes sent to an address per window.
+	MaxSends int
+	// ResendInterval is the time that must pass between two codes sent to
+	// an address.
+	ResendInterval time.Duration
+	// Window is the period MaxAttempts and MaxSends apply to. It starts
+	// with the first code sent to an address.
+	Window time.Duration
+	// LinkURL is the URL verification links point to, with the token
+	// added as the token query parameter. Links are left out when empty.
+	LinkURL string
+}
+
+// EventSender delivers messages, e.g. to webhooks.
+type EventSender interface {
+	SendEvent(ctx context.Context, eventType string, payload any) error
+}
+
+// SendRequest holds data for sending a verification code. The address is
+// given by ID or by channel and value.
+type SendRequest struct {
+	AddressID uuid.UUID `json:"address_id"`
+	Via       string    `json:"via"`
+	Value     string    `json:"value"`
+
+	// NetworkID is the network the address must belong to.
+	NetworkID uuid.UUID `json:"-"`
+}
+
+// Challenge describes a sent code.
+type Challenge struct {
+	Via       string    `json:"via"`
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// VerifyRequest holds a code for an address given by channel and value,
+// or the token of a link.
+type VerifyRequest struct {
+	Via   string `json:"via"`
+	Value string `json:"value"`
+	Code  string `json:"code"`
+	Token string `json:"token"`
+
+	// NetworkID is the network the address must belong to. The origin of
+	// the request is recorded in the audit trail.
+	NetworkID uuid.UUID `json:"-"`
+	ClientIP  string    `json:"-"`
+	UserAgent string    `json:"-"`
+	RequestID string    `json:"-"`
+}
+
+// Message is the payload of a courier message asking to deliver a code.
+type Message struct {
+	Type       string    `json:"type"`
+	IdentityID uuid.UUID `json:"identity_id"`
+	AddressID  uuid.UUID `json:"address_id"`
+	Via        string    `json:"via"`
+	To         string    `json:"to"`
+	Code       string    `json:"code"`
+	Link       string    `json:"link,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// messageType returns the courier message type of a channel.
+func messageType(via string) string {
+	if via == schema.ViaSMS {
+		return MessageTypeSMS
+	}
+	return MessageTypeEmail
+}
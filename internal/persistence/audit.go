@@ -35,10 +35,17 @@ type AuditFilter struct {
 	Outcome   string
 	StartTime *time.Time
 	EndTime   *time.Time
+	// Subject matches events whose actor or target it is.
+	Subject string
 }
 
 // AuditEventPersister defines the interface for audit event persistence operations.
 type AuditEventPersister interface {
 	CreateAuditEvent(ctx context.Context, event *AuditEvent) error
 	ListAuditEvents(ctx context.Context, networkID string, limit, offset int, filter *AuditFilter) ([]*AuditEvent, int, error)
+	// PseudonymizeAuditEvents replaces the ID of a subject with pseudonym
+	// in the events whose actor or target it is, and clears the client IP
+	// and user agent of the events it is the actor of. It returns the
+	// number of events changed.
+	PseudonymizeAuditEvents(ctx context.Context, subject, pseudonym string) (int, error)
 }
@@ -6,25 +6,193 @@ package persistence
 
 import (
 	"context"
+	"errors"
 	"time"
+
+	"github.com/coding-hui/iam/pkg/filter"
 )
 
+// ErrIdentifierInUse is returned when a credentials identifier already
+// belongs to another identity of the network.
+var ErrIdentifierInUse = errors.New("identifier is already in use")
+
+// ErrIdentityVersionExists is returned when a version number of an
+// identity is already taken, e.g. by a concurrent update.
+var ErrIdentityVersionExists = errors.New("identity version already exists")
+
 // Identity represents an identity in the system.
 // Domain model with no persistence-specific tags (Ory style).
 type Identity struct {
-	ID        string
-	NetworkID string
-	SchemaID  string
-	Traits    []byte
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID             string
+	NetworkID      string
+	Type           string
+	SchemaID       string
+	SchemaVersion  int
+	Traits         []byte
+	MetadataPublic []byte
+	MetadataAdmin  []byte
+	State          string
+	StateChangedAt *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	// DeletedAt is set on identities that are deleted but not yet purged.
+	DeletedAt *time.Time
+	// Credentials, when not nil, are written together with the identity.
+	Credentials []*IdentityCredentials
+	// VerifiableAddresses, when not nil, replace the stored addresses of
+	// the identity. Addresses are matched by ID.
+	VerifiableAddresses []*IdentityVerifiableAddress
+}
+
+// IdentityCredentials represents the credentials of an identity.
+// Domain model with no persistence-specific tags (Ory style).
+type IdentityCredentials struct {
+	ID          string
+	IdentityID  string
+	NetworkID   string
+	Type        string
+	Identifiers []string
+	Config      []byte
+	// PasswordChangedAt and PasswordChangeRequired only apply to password
+	// credentials.
+	PasswordChangedAt      *time.Time
+	PasswordChangeRequired bool
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
+}
+
+// IdentityVerifiableAddress represents an address of an identity that can
+// be verified. Domain model with no persistence-specific tags (Ory style).
+type IdentityVerifiableAddress struct {
+	ID         string
+	IdentityID string
+	NetworkID  string
+	Via        string
+	Value      string
+	Status     string
+	Verified   bool
+	VerifiedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// IdentityVersion represents an immutable snapshot of the traits and
+// state of an identity. Domain model with no persistence-specific tags
+// (Ory style).
+type IdentityVersion struct {
+	ID         string
+	IdentityID string
+	NetworkID  string
+	Version    int
+	Action     string
+	ActorID    string
+	ActorType  string
+	RequestID  string
+	Traits     []byte
+	State      string
+	CreatedAt  time.Time
+}
+
+// IdentityFilter holds filter criteria for identity queries.
+type IdentityFilter struct {
+	SchemaID string
+	// Where is an expression over the attributes id, type, schema_id,
+	// schema_version, state, created_at, updated_at, traits.<path>,
+	// credentials.type and credentials.identifier. Values of timestamp
+	// attributes are time.Time.
+	Where *filter.Expr
+	// SortBy is id, type, schema_id, schema_version, state, created_at, updated_at or
+	// traits.<path>. Identities are ordered by descending creation time by
+	// default.
+	SortBy   string
+	SortDesc bool
+	// Deleted selects deleted identities instead of live ones.
+	Deleted bool
 }
 
 // IdentityPersister defines the interface for identity persistence operations.
 type IdentityPersister interface {
 	GetIdentity(ctx context.Context, id string) (*Identity, error)
-	ListIdentities(ctx context.Context, networkID string, limit, offset int) ([]*Identity, int, error)
+	// GetDeletedIdentity retrieves an identity that is deleted but not yet
+	// purged.
+	GetDeletedIdentity(ctx context.Context, id string) (*Identity, error)
+	ListIdentities(ctx context.Context, networkID string, limit, offset int, filter *IdentityFilter) ([]*Identity, int, error)
 	CreateIdentity(ctx context.Context, identity *Identity) error
 	UpdateIdentity(ctx context.Context, identity *Identity) error
+	// DeleteIdentity deletes an identity together with everything issued
+	// to it: credentials, password history, addresses, versions, sessions,
+	// tokens, role bindings, secret keys and public keys.
 	DeleteIdentity(ctx context.Context, id string) error
+	// SoftDeleteIdentity marks an identity of a network as deleted at the
+	// given time. Deleted identities are hidden from all reads but
+	// ListIdentities with IdentityFilter.Deleted and keep their
+	// identifiers. RestoreIdentity clears the mark. Both return
+	// gorm.ErrRecordNotFound when no identity matches.
+	SoftDeleteIdentity(ctx context.Context, networkID, id string, at time.Time) error
+	RestoreIdentity(ctx context.Context, networkID, id string) error
+	// ListIdentitiesDeletedBefore lists up to limit identities deleted
+	// before the given time, skipping the first offset.
+	ListIdentitiesDeletedBefore(ctx context.Context, before time.Time, limit, offset int) ([]*Identity, error)
+	// ListIdentitiesBySchema lists identities at a schema version ordered by
+	// ID, starting after the given ID.
+	ListIdentitiesBySchema(ctx context.Context, schemaID string, version int, after string, limit int) ([]*Identity, error)
+
+	// GetIdentityCredentials lists the credentials of an identity.
+	GetIdentityCredentials(ctx context.Context, identityID string) ([]*IdentityCredentials, error)
+	// FindCredentialsByIdentifier finds the credentials holding an
+	// identifier in a network; an empty credType matches any type.
+	FindCredentialsByIdentifier(ctx context.Context, networkID, credType, identifier string) (*IdentityCredentials, error)
+	// CreateCredentials and UpdateCredentials return ErrIdentifierInUse when
+	// an identifier belongs to another identity.
+	CreateCredentials(ctx context.Context, c *IdentityCredentials) error
+	UpdateCredentials(ctx context.Context, c *IdentityCredentials) error
+	DeleteCredentials(ctx context.Context, identityID, credType string) error
+
+	// ListPasswordHistory returns up to limit of the most recent password
+	// hashes of an identity, newest first.
+	ListPasswordHistory(ctx context.Context, identityID string, limit int) ([][]byte, error)
+	// AddPasswordHistory records a password hash of an identity and drops
+	// all but the keep most recent hashes.
+	AddPasswordHistory(ctx context.Context, identityID string, hash []byte, keep int) error
+
+	// ListVerifiableAddresses lists the addresses of an identity.
+	ListVerifiableAddresses(ctx context.Context, identityID string) ([]*IdentityVerifiableAddress, error)
+	GetVerifiableAddress(ctx context.Context, id string) (*IdentityVerifiableAddress, error)
+	// FindVerifiableAddress finds an address of a live identity of a
+	// network by channel and value.
+	FindVerifiableAddress(ctx context.Context, networkID, via, value string) (*IdentityVerifiableAddress, error)
+	// UpdateVerifiableAddress updates the verification state of an address.
+	UpdateVerifiableAddress(ctx context.Context, a *IdentityVerifiableAddress) error
+
+	// CreateIdentityVersion stores a new version of an identity. It
+	// returns ErrIdentityVersionExists when the version number is taken.
+	CreateIdentityVersion(ctx context.Context, v *IdentityVersion) error
+	// ListIdentityVersions lists the versions of an identity, newest first.
+	ListIdentityVersions(ctx context.Context, identityID string) ([]*IdentityVersion, error)
+	// LatestIdentityVersion returns the newest version number of an
+	// identity, or 0 when it has no versions.
+	LatestIdentityVersion(ctx context.Context, identityID string) (int, error)
+}
+
+// IdentitySchema represents an immutable version of an identity schema.
+// Domain model with no persistence-specific tags (Ory style).
+type IdentitySchema struct {
+	SchemaID   string
+	Version    int
+	Type       string
+	JSONSchema []byte
+	Transform  []byte
+	Author     string
+	CreatedAt  time.Time
+}
+
+// IdentitySchemaPersister defines the interface for identity schema persistence operations.
+type IdentitySchemaPersister interface {
+	// GetIdentitySchema retrieves a schema version; version 0 selects the latest.
+	GetIdentitySchema(ctx context.Context, schemaID string, version int) (*IdentitySchema, error)
+	ListIdentitySchemas(ctx context.Context) ([]*IdentitySchema, error)
+	ListIdentitySchemaVersions(ctx context.Context, schemaID string) ([]*IdentitySchema, error)
+	CreateIdentitySchema(ctx context.Context, schema *IdentitySchema) error
+	DeleteIdentitySchema(ctx context.Context, schemaID string) error
+	CountIdentitiesBySchema(ctx context.Context, schemaID string) (int, error)
 }
@@ -6,9 +6,14 @@ package persistence
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// ErrPolicyVersionExists is returned when a version number of a policy is
+// already taken, e.g. by a concurrent update.
+var ErrPolicyVersionExists = errors.New("policy version already exists")
+
 // Policy represents a policy in the system.
 // Domain model with no persistence-specific tags (Ory style).
 type Policy struct {
@@ -16,20 +21,42 @@ type Policy struct {
 	NetworkID  string
 	Name       string
 	Type       string
-	Subjects   string
+	Subjects   []string
 	Effect     string
-	Actions    string
-	Resources  string
+	Actions    []string
+	Resources  []string
 	Conditions []byte
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
 }
 
+// PolicyVersion represents an immutable snapshot of a policy.
+// Domain model with no persistence-specific tags (Ory style).
+type PolicyVersion struct {
+	ID           string
+	PolicyID     string
+	NetworkID    string
+	Version      int
+	Action       string
+	Author       string
+	RestoredFrom int
+	Snapshot     []byte
+	Diff         []byte
+	CreatedAt    time.Time
+}
+
 // PolicyPersister defines the interface for policy persistence operations.
 type PolicyPersister interface {
 	GetPolicy(ctx context.Context, id string) (*Policy, error)
 	ListPolicies(ctx context.Context, networkID string, limit, offset int) ([]*Policy, int, error)
+	ListPoliciesBySubject(ctx context.Context, networkID, subject string) ([]*Policy, error)
 	CreatePolicy(ctx context.Context, policy *Policy) error
 	UpdatePolicy(ctx context.Context, policy *Policy) error
 	DeletePolicy(ctx context.Context, id string) error
+
+	// CreatePolicyVersion returns ErrPolicyVersionExists when the version
+	// number is taken.
+	CreatePolicyVersion(ctx context.Context, version *PolicyVersion) error
+	GetPolicyVersion(ctx context.Context, policyID string, version int) (*PolicyVersion, error)
+	ListPolicyVersions(ctx context.Context, policyID string) ([]*PolicyVersion, error)
 }
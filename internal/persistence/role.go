@@ -16,10 +16,22 @@ type Role struct {
 	NetworkID   string
 	Name        string
 	Description string
+	InheritFrom []string
+	Extra       []byte
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
 
+// RoleBinding grants a role to a subject.
+// Domain model with no persistence-specific tags (Ory style).
+type RoleBinding struct {
+	ID        string
+	NetworkID string
+	RoleID    string
+	Subject   string
+	CreatedAt time.Time
+}
+
 // RolePersister defines the interface for role persistence operations.
 type RolePersister interface {
 	GetRole(ctx context.Context, id string) (*Role, error)
@@ -27,4 +39,10 @@ type RolePersister interface {
 	CreateRole(ctx context.Context, role *Role) error
 	UpdateRole(ctx context.Context, role *Role) error
 	DeleteRole(ctx context.Context, id string) error
+
+	CreateRoleBinding(ctx context.Context, binding *RoleBinding) error
+	DeleteRoleBinding(ctx context.Context, roleID, subject string) error
+	ListRoleBindings(ctx context.Context, networkID string) ([]*RoleBinding, error)
+	ListRoleBindingsByRole(ctx context.Context, roleID string) ([]*RoleBinding, error)
+	ListRoleBindingsBySubject(ctx context.Context, networkID, subject string) ([]*RoleBinding, error)
 }
@@ -0,0 +1,104 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package persistence
+
+import (
+	"context"
+	"time"
+)
+
+// SCIMToken represents a bearer token of a SCIM client.
+// Domain model with no persistence-specific tags (Ory style).
+type SCIMToken struct {
+	ID        string
+	NetworkID string
+	Name      string
+	// TokenHash is the SHA-256 hash of the token.
+	TokenHash string
+	ExpiresAt *time.Time
+	CreatedAt time.Time
+}
+
+// SCIMTokenPersister defines the interface for SCIM token persistence
+// operations.
+type SCIMTokenPersister interface {
+	GetSCIMToken(ctx context.Context, id string) (*SCIMToken, error)
+	GetSCIMTokenByHash(ctx context.Context, tokenHash string) (*SCIMToken, error)
+	ListSCIMTokens(ctx context.Context, networkID string) ([]*SCIMToken, error)
+	CreateSCIMToken(ctx context.Context, t *SCIMToken) error
+	DeleteSCIMToken(ctx context.Context, id string) error
+}
+
+// SCIMConnector represents a downstream application provisioned over SCIM.
+// Domain model with no persistence-specific tags (Ory style).
+type SCIMConnector struct {
+	ID           string
+	NetworkID    string
+	Name         string
+	BaseURL      string
+	AuthType     string
+	AuthToken    string
+	AuthUsername string
+	AuthPassword string
+	// Attributes is the JSON object mapping SCIM attributes to traits.
+	Attributes    []byte
+	Filter        string
+	SyncGroups    bool
+	Enabled       bool
+	LastSyncAt    *time.Time
+	LastSyncError string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// SCIMConnectorResource records the sync state of an identity or role
+// provisioned by a connector.
+// Domain model with no persistence-specific tags (Ory style).
+type SCIMConnectorResource struct {
+	ID           string
+	ConnectorID  string
+	ResourceType string
+	LocalID      string
+	RemoteID     string
+	// Hash is the hash of the last resource pushed.
+	Hash          string
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt *time.Time
+	SyncedAt      *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// SCIMConnectorResourceCount is the number of resources of a connector of
+// a type in a status.
+type SCIMConnectorResourceCount struct {
+	ResourceType string
+	Status       string
+	Count        int
+}
+
+// SCIMConnectorPersister defines the interface for SCIM connector
+// persistence operations.
+type SCIMConnectorPersister interface {
+	GetSCIMConnector(ctx context.Context, id string) (*SCIMConnector, error)
+	// ListSCIMConnectors lists the connectors of a network, or of all
+	// networks when networkID is empty.
+	ListSCIMConnectors(ctx context.Context, networkID string) ([]*SCIMConnector, error)
+	CreateSCIMConnector(ctx context.Context, c *SCIMConnector) error
+	UpdateSCIMConnector(ctx context.Context, c *SCIMConnector) error
+	UpdateSCIMConnectorSync(ctx context.Context, id string, at time.Time, syncErr string) error
+	// DeleteSCIMConnector deletes a connector together with its resources.
+	DeleteSCIMConnector(ctx context.Context, id string) error
+
+	// ListSCIMConnectorResources lists the resources of a connector, of
+	// any status when status is empty.
+	ListSCIMConnectorResources(ctx context.Context, connectorID, status string) ([]*SCIMConnectorResource, error)
+	CountSCIMConnectorResources(ctx context.Context, connectorID string) ([]*SCIMConnectorResourceCount, error)
+	SaveSCIMConnectorResource(ctx context.Context, r *SCIMConnectorResource) error
+	DeleteSCIMConnectorResource(ctx context.Context, id string) error
+	DeleteSCIMConnectorResources(ctx context.Context, connectorID string) error
+}
@@ -18,6 +18,7 @@ type SecretKey struct {
 	SecretHash string
 	Name       string
 	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
 	CreatedAt  time.Time
 }
 
@@ -27,5 +28,37 @@ type SecretKeyPersister interface {
 	GetSecretKeyByKeyID(ctx context.Context, keyID string) (*SecretKey, error)
 	ListSecretKeysByIdentityID(ctx context.Context, identityID string) ([]*SecretKey, error)
 	CreateSecretKey(ctx context.Context, secretKey *SecretKey) error
+	// UpdateSecretKey writes the name and expiry of a key.
+	UpdateSecretKey(ctx context.Context, secretKey *SecretKey) error
+	// UpdateSecretKeyLastUsed records when a key was last used.
+	UpdateSecretKeyLastUsed(ctx context.Context, id string, at time.Time) error
 	DeleteSecretKey(ctx context.Context, id string) error
 }
+
+// PublicKey represents a public key an identity signs assertions with.
+// Domain model with no persistence-specific tags (Ory style).
+type PublicKey struct {
+	ID         string
+	IdentityID string
+	// KeyID is unique per identity.
+	KeyID     string
+	Algorithm string
+	// Key is the PEM encoded key.
+	Key        []byte
+	Name       string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// PublicKeyPersister defines the interface for public key persistence operations.
+type PublicKeyPersister interface {
+	GetPublicKey(ctx context.Context, id string) (*PublicKey, error)
+	ListPublicKeysByIdentityID(ctx context.Context, identityID string) ([]*PublicKey, error)
+	CreatePublicKey(ctx context.Context, publicKey *PublicKey) error
+	// UpdatePublicKey writes the name and expiry of a key.
+	UpdatePublicKey(ctx context.Context, publicKey *PublicKey) error
+	// UpdatePublicKeyLastUsed records when a key was last used.
+	UpdatePublicKeyLastUsed(ctx context.Context, id string, at time.Time) error
+	DeletePublicKey(ctx context.Context, id string) error
+}
@@ -65,6 +65,12 @@ func (p *AuditPool) ListAuditEvents(ctx context.Context, networkID string, limit
 		if filter.ActorID != "" {
 			query = query.Where("actor_id = ?", filter.ActorID)
 		}
+		if filter.TargetID != "" {
+			query = query.Where("target_id = ?", filter.TargetID)
+		}
+		if filter.Subject != "" {
+			query = query.Where("(actor_id = ? OR target_id = ?)", filter.Subject, filter.Subject)
+		}
 		if filter.Outcome != "" {
 			query = query.Where("outcome = ?", filter.Outcome)
 		}
@@ -85,6 +91,29 @@ func (p *AuditPool) ListAuditEvents(ctx context.Context, networkID string, limit
 	return events, int(total), nil
 }
 
+// PseudonymizeAuditEvents replaces a subject with pseudonym in the events
+// it took part in.
+func (p *AuditPool) PseudonymizeAuditEvents(ctx context.Context, subject, pseudonym string) (int, error) {
+	var n int64
+	err := p.db.Transaction(ctx, func(ctx context.Context) error {
+		conn := p.db.Connection(ctx)
+		if err := conn.Model(&AuditEventModel{}).
+			Where("actor_id = ? OR target_id = ?", subject, subject).
+			Count(&n).Error; err != nil {
+			return err
+		}
+		if err := conn.Model(&AuditEventModel{}).Where("actor_id = ?", subject).Updates(map[string]any{
+			"actor_id":   pseudonym,
+			"client_ip":  "",
+			"user_agent": "",
+		}).Error; err != nil {
+			return err
+		}
+		return conn.Model(&AuditEventModel{}).Where("target_id = ?", subject).Update("target_id", pseudonym).Error
+	})
+	return int(n), err
+}
+
 func (p *AuditPool) modelToDomain(m *AuditEventModel) *persistence.AuditEvent {
 	return &persistence.AuditEvent{
 		ID:         m.ID,
@@ -0,0 +1,233 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// IdentityCredentialsModel represents the credentials of an identity in the database.
+type IdentityCredentialsModel struct {
+	ID                     string     `gorm:"primaryKey;column:id"                                                       json:"id"`
+	IdentityID             string     `gorm:"column:identity_id;size:36;uniqueIndex:idx_identity_credentials,priority:1" json:"identity_id"`
+	NetworkID              string     `gorm:"column:nid;size:36;index"                                                   json:"network_id"`
+	Type                   string     `gorm:"column:type;size:32;uniqueIndex:idx_identity_credentials,priority:2"        json:"type"`
+	Config                 []byte     `gorm:"column:config"                                                              json:"config"`
+	PasswordChangedAt      *time.Time `gorm:"column:password_changed_at"                                                 json:"password_changed_at"`
+	PasswordChangeRequired bool       `gorm:"column:password_change_required;not null;default:false"                     json:"password_change_required"`
+	CreatedAt              time.Time  `gorm:"column:created_at"                                                          json:"created_at"`
+	UpdatedAt              time.Time  `gorm:"column:updated_at"                                                          json:"updated_at"`
+}
+
+// TableName returns the table name for IdentityCredentialsModel.
+func (IdentityCredentialsModel) TableName() string {
+	return "iam_identity_credentials"
+}
+
+// IdentityCredentialIdentifierModel represents a login identifier of
+// credentials. Identifiers are unique per network and credentials type.
+type IdentityCredentialIdentifierModel struct {
+	ID            string `gorm:"primaryKey;column:id"                                                        json:"id"`
+	CredentialsID string `gorm:"column:credentials_id;size:36;index"                                         json:"credentials_id"`
+	IdentityID    string `gorm:"column:identity_id;size:36;index"                                            json:"identity_id"`
+	NetworkID     string `gorm:"column:nid;size:36;uniqueIndex:idx_credential_identifier,priority:1"         json:"network_id"`
+	Type          string `gorm:"column:type;size:32;uniqueIndex:idx_credential_identifier,priority:2"        json:"type"`
+	Identifier    string `gorm:"column:identifier;size:255;uniqueIndex:idx_credential_identifier,priority:3" json:"identifier"`
+}
+
+// TableName returns the table name for IdentityCredentialIdentifierModel.
+func (IdentityCredentialIdentifierModel) TableName() string {
+	return "iam_identity_credential_identifiers"
+}
+
+// GetIdentityCredentials lists the credentials of an identity.
+func (p *IdentityPool) GetIdentityCredentials(ctx context.Context, identityID string) ([]*persistence.IdentityCredentials, error) {
+	var ms []IdentityCredentialsModel
+	if err := p.db.Connection(ctx).Where("identity_id = ?", identityID).Order("type").Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	return p.credentialsToDomain(ctx, ms)
+}
+
+// FindCredentialsByIdentifier finds the credentials holding an identifier
+// in a network; an empty credType matches any type.
+func (p *IdentityPool) FindCredentialsByIdentifier(ctx context.Context, networkID, credType, identifier string) (*persistence.IdentityCredentials, error) {
+	query := p.db.Connection(ctx).Where("nid = ? AND identifier = ?", networkID, identifier)
+	if credType != "" {
+		query = query.Where("type = ?", credType)
+	}
+	var ident IdentityCredentialIdentifierModel
+	if err := query.Order("id").First(&ident).Error; err != nil {
+		return nil, err
+	}
+
+	var m IdentityCredentialsModel
+	if err := p.db.Connection(ctx).Where("id = ?", ident.CredentialsID).First(&m).Error; err != nil {
+		return nil, err
+	}
+	creds, err := p.credentialsToDomain(ctx, []IdentityCredentialsModel{m})
+	if err != nil {
+		return nil, err
+	}
+	return creds[0], nil
+}
+
+// CreateCredentials creates credentials together with their identifiers.
+func (p *IdentityPool) CreateCredentials(ctx context.Context, c *persistence.IdentityCredentials) error {
+	return p.db.Transaction(ctx, func(ctx context.Context) error {
+		if err := p.db.Connection(ctx).Create(p.credentialsToModel(c)).Error; err != nil {
+			return err
+		}
+		return p.replaceIdentifiers(ctx, c)
+	})
+}
+
+// UpdateCredentials updates the config and password state of credentials
+// and replaces their identifiers.
+func (p *IdentityPool) UpdateCredentials(ctx context.Context, c *persistence.IdentityCredentials) error {
+	return p.db.Transaction(ctx, func(ctx context.Context) error {
+		if err := p.db.Connection(ctx).Model(&IdentityCredentialsModel{}).Where("id = ?", c.ID).Updates(map[string]any{
+			"config":                   c.Config,
+			"password_changed_at":      c.PasswordChangedAt,
+			"password_change_required": c.PasswordChangeRequired,
+			"updated_at":               c.UpdatedAt,
+		}).Error; err != nil {
+			return err
+		}
+		return p.replaceIdentifiers(ctx, c)
+	})
+}
+
+// DeleteCredentials deletes the credentials of a type from an identity.
+func (p *IdentityPool) DeleteCredentials(ctx context.Context, identityID, credType string) error {
+	return p.db.Transaction(ctx, func(ctx context.Context) error {
+		if err := p.db.Connection(ctx).
+			Where("identity_id = ? AND type = ?", identityID, credType).
+			Delete(&IdentityCredentialIdentifierModel{}).Error; err != nil {
+			return err
+		}
+		return p.db.Connection(ctx).
+			Where("identity_id = ? AND type = ?", identityID, credType).
+			Delete(&IdentityCredentialsModel{}).Error
+	})
+}
+
+// writeCredentials creates or updates the credentials of an identity.
+func (p *IdentityPool) writeCredentials(ctx context.Context, identity *persistence.Identity) error {
+	for _, c := range identity.Credentials {
+		c.IdentityID = identity.ID
+		c.NetworkID = identity.NetworkID
+
+		var count int64
+		if err := p.db.Connection(ctx).Model(&IdentityCredentialsModel{}).Where("id = ?", c.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		var err error
+		if count == 0 {
+			err = p.CreateCredentials(ctx, c)
+		} else {
+			err = p.UpdateCredentials(ctx, c)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceIdentifiers replaces the identifiers of credentials. The unique
+// index backs the explicit check, which exists to report a conflict
+// independently of the database driver.
+func (p *IdentityPool) replaceIdentifiers(ctx context.Context, c *persistence.IdentityCredentials) error {
+	conn := p.db.Connection(ctx)
+	if err := conn.Where("credentials_id = ?", c.ID).Delete(&IdentityCredentialIdentifierModel{}).Error; err != nil {
+		return err
+	}
+	if len(c.Identifiers) == 0 {
+		return nil
+	}
+
+	var taken int64
+	if err := conn.Model(&IdentityCredentialIdentifierModel{}).
+		Where("nid = ? AND type = ? AND identifier IN ? AND identity_id <> ?", c.NetworkID, c.Type, c.Identifiers, c.IdentityID).
+		Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return persistence.ErrIdentifierInUse
+	}
+
+	ms := make([]IdentityCredentialIdentifierModel, len(c.Identifiers))
+	for i, identifier := range c.Identifiers {
+		ms[i] = IdentityCredentialIdentifierModel{
+			ID:            uuid.NewString(),
+			CredentialsID: c.ID,
+			IdentityID:    c.IdentityID,
+			NetworkID:     c.NetworkID,
+			Type:          c.Type,
+			Identifier:    identifier,
+		}
+	}
+	return conn.Create(&ms).Error
+}
+
+func (p *IdentityPool) credentialsToDomain(ctx context.Context, ms []IdentityCredentialsModel) ([]*persistence.IdentityCredentials, error) {
+	if len(ms) == 0 {
+		return []*persistence.IdentityCredentials{}, nil
+	}
+
+	ids := make([]string, len(ms))
+	for i := range ms {
+		ids[i] = ms[i].ID
+	}
+	var idents []IdentityCredentialIdentifierModel
+	if err := p.db.Connection(ctx).Where("credentials_id IN ?", ids).Order("identifier").Find(&idents).Error; err != nil {
+		return nil, err
+	}
+	byCredentials := make(map[string][]string, len(ms))
+	for _, ident := range idents {
+		byCredentials[ident.CredentialsID] = append(byCredentials[ident.CredentialsID], ident.Identifier)
+	}
+
+	creds := make([]*persistence.IdentityCredentials, len(ms))
+	for i, m := range ms {
+		identifiers := byCredentials[m.ID]
+		if identifiers == nil {
+			identifiers = []string{}
+		}
+		creds[i] = &persistence.IdentityCredentials{
+			ID:                     m.ID,
+			IdentityID:             m.IdentityID,
+			NetworkID:              m.NetworkID,
+			Type:                   m.Type,
+			Identifiers:            identifiers,
+			Config:                 m.Config,
+			PasswordChangedAt:      m.PasswordChangedAt,
+			PasswordChangeRequired: m.PasswordChangeRequired,
+			CreatedAt:              m.CreatedAt,
+			UpdatedAt:              m.UpdatedAt,
+		}
+	}
+	return creds, nil
+}
+
+func (p *IdentityPool) credentialsToModel(c *persistence.IdentityCredentials) *IdentityCredentialsModel {
+	return &IdentityCredentialsModel{
+		ID:                     c.ID,
+		IdentityID:             c.IdentityID,
+		NetworkID:              c.NetworkID,
+		Type:                   c.Type,
+		Config:                 c.Config,
+		PasswordChangedAt:      c.PasswordChangedAt,
+		PasswordChangeRequired: c.PasswordChangeRequired,
+		CreatedAt:              c.CreatedAt,
+		UpdatedAt:              c.UpdatedAt,
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/coding-hui/iam/internal/persistence"
+	"github.com/coding-hui/iam/pkg/filter"
+)
+
+// identityColumns maps filterable identity attributes to their columns.
+var identityColumns = map[string]string{
+	"id":             "iam_identities.id",
+	"type":           "iam_identities.type",
+	"schema_id":      "iam_identities.schema_id",
+	"schema_version": "iam_identities.schema_version",
+	"state":          "iam_identities.state",
+	"created_at":     "iam_identities.created_at",
+	"updated_at":     "iam_identities.updated_at",
+}
+
+// comparisonSQL maps the comparison operators that translate to a single
+// SQL operator.
+var comparisonSQL = map[filter.Op]string{
+	filter.Eq: "=",
+	filter.Gt: ">", filter.Ge: ">=", filter.Lt: "<", filter.Le: "<=",
+}
+
+// identityQuery translates identity filters to SQL for the dialect of a
+// connection. Traits are stored as JSON text in a binary column, so they
+// are cast before JSON functions are applied; string comparisons on traits
+// and identifiers are case-insensitive.
+type identityQuery struct {
+	mysql bool
+	sql   strings.Builder
+	vars  []any
+}
+
+func newIdentityQuery(db *gorm.DB) *identityQuery {
+	return &identityQuery{mysql: db.Dialector.Name() == "mysql"}
+}
+
+// applyIdentityFilter adds the conditions of f to query.
+func applyIdentityFilter(query *gorm.DB, f *persistence.IdentityFilter) (*gorm.DB, error) {
+	if f == nil {
+		return query, nil
+	}
+	if f.SchemaID != "" {
+		query = query.Where("iam_identities.schema_id = ?", f.SchemaID)
+	}
+	if f.Where != nil {
+		q := newIdentityQuery(query)
+		if err := q.expr(f.Where); err != nil {
+			return nil, err
+		}
+		query = query.Where(q.sql.String(), q.vars...)
+	}
+	return query, nil
+}
+
+// identityOrder returns the ORDER BY clause for f. Ties are broken by ID.
+func identityOrder(db *gorm.DB, f *persistence.IdentityFilter) (clause.OrderBy, error) {
+	by, desc := "created_at", true
+	if f != nil && f.SortBy != "" {
+		by, desc = f.SortBy, f.SortDesc
+	}
+	dir := " ASC"
+	if desc {
+		dir = " DESC"
+	}
+
+	q := newIdentityQuery(db)
+	if column, ok := identityColumns[by]; ok {
+		q.sql.WriteString(column)
+	} else if path, ok := strings.CutPrefix(by, "traits."); ok {
+		jsonPath, err := traitPath(path)
+		if err != nil {
+			return clause.OrderBy{}, err
+		}
+		if q.mysql {
+			q.sql.WriteString("JSON_EXTRACT(CAST(iam_identities.traits AS CHAR), ?)")
+		} else {
+			q.sql.WriteString("json_extract(CAST(iam_identities.traits AS TEXT), ?)")
+		}
+		q.vars = append(q.vars, jsonPath)
+	} else {
+		return clause.OrderBy{}, fmt.Errorf("cannot sort by %q", by)
+	}
+	q.sql.WriteString(dir + ", iam_identities.id" + dir)
+
+	return clause.OrderBy{Expression: clause.Expr{SQL: q.sql.String(), Vars: q.vars, WithoutParentheses: true}}, nil
+}
+
+func (q *identityQuery) expr(e *filter.Expr) error {
+	switch e.Op {
+	case filter.And, filter.Or:
+		q.sql.WriteString("(")
+		for i, arg := range e.Args {
+			if i > 0 {
+				q.sql.WriteString(" " + strings.ToUpper(string(e.Op)) + " ")
+			}
+			if err := q.expr(arg); err != nil {
+				return err
+			}
+		}
+		q.sql.WriteString(")")
+		return nil
+	case filter.Not:
+		// A comparison on a missing value is NULL; not must still match it.
+		q.sql.WriteString("NOT COALESCE(")
+		if err := q.expr(e.Args[0]); err != nil {
+			return err
+		}
+		q.sql.WriteString(", FALSE)")
+		return nil
+	}
+
+	if column, ok := identityColumns[e.Attr]; ok {
+		return q.compare(column, nil, e, false)
+	}
+	switch e.Attr {
+	case "credentials.type":
+		return q.exists("iam_identity_credentials", "type", e, false)
+	case "credentials.identifier":
+		return q.exists("iam_identity_credential_identifiers", "identifier", e, true)
+	}
+	if path, ok := strings.CutPrefix(e.Attr, "traits."); ok {
+		return q.trait(path, e)
+	}
+	return fmt.Errorf("unknown attribute %q", e.Attr)
+}
+
+// compare writes a comparison of a scalar SQL expression; exprVars are
+// the values of the placeholders in sqlExpr.
+func (q *identityQuery) compare(sqlExpr string, exprVars []any, e *filter.Expr, fold bool) error {
+	if e.Op == filter.Pr {
+		q.write(sqlExpr+" IS NOT NULL", exprVars)
+		return nil
+	}
+	if e.Value == nil {
+		switch e.Op {
+		case filter.Eq:
+			q.write(sqlExpr+" IS NULL", exprVars)
+		case filter.Ne:
+			q.write(sqlExpr+" IS NOT NULL", exprVars)
+		default:
+			return fmt.Errorf("%s: %s cannot compare with null", e.Attr, e.Op)
+		}
+		return nil
+	}
+
+	value, err := sqlValue(e)
+	if err != nil {
+		return err
+	}
+	if s, ok := value.(string); ok && fold {
+		sqlExpr = "LOWER(" + sqlExpr + ")"
+		value = strings.ToLower(s)
+	}
+
+	switch e.Op {
+	case filter.Co, filter.Sw, filter.Ew:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: %s requires a string", e.Attr, e.Op)
+		}
+		s = likeEscaper.Replace(s)
+		switch e.Op {
+		case filter.Co:
+			s = "%" + s + "%"
+		case filter.Sw:
+			s += "%"
+		case filter.Ew:
+			s = "%" + s
+		}
+		q.write(sqlExpr+" LIKE ? ESCAPE '!'", exprVars)
+		q.vars = append(q.vars, s)
+	case filter.Ne:
+		// Missing values differ from every value.
+		q.write("("+sqlExpr+" IS NULL OR ", exprVars)
+		q.write(sqlExpr+" <> ?)", exprVars)
+		q.vars = append(q.vars, value)
+	default:
+		q.write(sqlExpr+" "+comparisonSQL[e.Op]+" ?", exprVars)
+		q.vars = append(q.vars, value)
+	}
+	return nil
+}
+
+// write appends SQL text together with the values of its placeholders.
+func (q *identityQuery) write(sql string, vars []any) {
+	q.sql.WriteString(sql)
+	q.vars = append(q.vars, vars...)
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// exists writes a correlated subquery on a table holding rows per identity.
+func (q *identityQuery) exists(table, column string, e *filter.Expr, fold bool) error {
+	if _, ok := e.Value.(string); !ok && e.Op != filter.Pr {
+		return fmt.Errorf("%s: value must be a string", e.Attr)
+	}
+
+	// ne matches identities without a matching row.
+	cmp := *e
+	if e.Op == filter.Ne {
+		cmp.Op = filter.Eq
+		q.sql.WriteString("NOT ")
+	}
+	q.sql.WriteString("EXISTS (SELECT 1 FROM " + table + " t WHERE t.identity_id = iam_identities.id")
+	if e.Op != filter.Pr {
+		q.sql.WriteString(" AND ")
+		if err := q.compare("t."+column, nil, &cmp, fold); err != nil {
+			return err
+		}
+	}
+	q.sql.WriteString(")")
+	return nil
+}
+
+// trait writes a comparison of the trait at a dot separated path.
+func (q *identityQuery) trait(path string, e *filter.Expr) error {
+	jsonPath, err := traitPath(path)
+	if err != nil {
+		return err
+	}
+
+	doc := "CAST(iam_identities.traits AS TEXT)"
+	if q.mysql {
+		doc = "CAST(iam_identities.traits AS CHAR)"
+	}
+	// jsonType yields the lower-case JSON type of the value, or NULL when
+	// the path does not exist.
+	jsonType := "json_type(" + doc + ", ?)"
+	if q.mysql {
+		jsonType = "LOWER(JSON_TYPE(JSON_EXTRACT(" + doc + ", ?)))"
+	}
+
+	pathVars := []any{jsonPath}
+
+	switch v := e.Value.(type) {
+	case nil:
+		switch e.Op {
+		case filter.Pr, filter.Ne:
+			q.write("("+jsonType+" IS NOT NULL AND ", pathVars)
+			q.write(jsonType+" <> 'null')", pathVars)
+		case filter.Eq:
+			q.write(jsonType+" = 'null'", pathVars)
+		default:
+			return fmt.Errorf("%s: %s cannot compare with null", e.Attr, e.Op)
+		}
+		return nil
+	case bool:
+		if e.Op != filter.Eq && e.Op != filter.Ne {
+			return fmt.Errorf("%s: %s cannot compare with a boolean", e.Attr, e.Op)
+		}
+		if e.Op == filter.Ne {
+			q.sql.WriteString("NOT COALESCE(")
+		}
+		if q.mysql {
+			q.write("("+jsonType+" = 'boolean' AND ", pathVars)
+			q.write("JSON_EXTRACT("+doc+", ?) = CAST('"+strconv.FormatBool(v)+"' AS JSON))", pathVars)
+		} else {
+			q.write(jsonType+" = '"+strconv.FormatBool(v)+"'", pathVars)
+		}
+		if e.Op == filter.Ne {
+			q.sql.WriteString(", FALSE)")
+		}
+		return nil
+	}
+
+	// Strings and numbers compare as SQL scalars.
+	value := "json_extract(" + doc + ", ?)"
+	if q.mysql {
+		value = "JSON_UNQUOTE(JSON_EXTRACT(" + doc + ", ?))"
+	}
+	return q.compare(value, pathVars, e, true)
+}
+
+// traitPath converts a dot separated trait path to a JSON path. Numeric
+// segments index arrays.
+func traitPath(path string) (string, error) {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, seg := range strings.Split(path, ".") {
+		if seg == "" || strings.ContainsAny(seg, `"\`) {
+			return "", fmt.Errorf("invalid trait path %q", path)
+		}
+		if _, err := strconv.Atoi(seg); err == nil {
+			b.WriteString("[" + seg + "]")
+			continue
+		}
+		b.WriteString(`."` + seg + `"`)
+	}
+	return b.String(), nil
+}
+
+// sqlValue converts the operand of a comparison to a driver value.
+func sqlValue(e *filter.Expr) (any, error) {
+	switch v := e.Value.(type) {
+	case string, time.Time:
+		return v, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case bool:
+		return v, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported value %v", e.Attr, e.Value)
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/persistence"
+	"github.com/coding-hui/iam/pkg/filter"
+)
+
+// where parses a filter expression, converting the values of timestamp
+// attributes like the identity package does.
+func where(t *testing.T, s string) *filter.Expr {
+	t.Helper()
+	e, err := filter.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Walk(func(e *filter.Expr) error {
+		if v, ok := e.Value.(string); ok && (e.Attr == "created_at" || e.Attr == "updated_at") {
+			ts, err := time.Parse(time.RFC3339, v)
+			e.Value = ts.Local()
+			return err
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// seedIdentities creates ann, bob and carl in the test network, created
+// a month apart, and dave in another network. It returns the names of
+// the identities by ID.
+func seedIdentities(t *testing.T, p *IdentityPool) map[string]string {
+	t.Helper()
+	names := map[string]string{}
+	for i, seed := range []struct {
+		name, networkID, traits string
+		credentials             map[string][]string
+	}{
+		{"ann", testNetworkID, `{"email":"Ann@Example.com","name":{"first":"Ann"},"age":30,"vip":true,"tags":["a","b"]}`,
+			map[string][]string{"password": {"ann@example.com"}}},
+		{"bob", testNetworkID, `{"email":"bob@example.com","age":20,"vip":false}`,
+			map[string][]string{"password": {"bob@example.com"}, "totp": nil}},
+		{"carl", testNetworkID, `{"email":"carl@example.com","vip":null}`, nil},
+		{"dave", otherNetworkID, `{"email":"dave@example.com","age":30}`,
+			map[string][]string{"totp": nil}},
+	} {
+		created := time.Date(2024, time.Month(i+1), 1, 12, 0, 0, 0, time.UTC)
+		identity := &persistence.Identity{
+			ID:        uuid.NewString(),
+			NetworkID: seed.networkID,
+			Type:      "user",
+			SchemaID:  "default",
+			Traits:    []byte(seed.traits),
+			State:     "active",
+			CreatedAt: created,
+			UpdatedAt: created,
+		}
+		for typ, identifiers := range seed.credentials {
+			identity.Credentials = append(identity.Credentials, &persistence.IdentityCredentials{
+				ID:          uuid.NewString(),
+				Type:        typ,
+				Identifiers: identifiers,
+				Config:      []byte(`{}`),
+				CreatedAt:   created,
+				UpdatedAt:   created,
+			})
+		}
+		if err := p.CreateIdentity(context.Background(), identity); err != nil {
+			t.Fatal(err)
+		}
+		names[identity.ID] = seed.name
+	}
+	return names
+}
+
+func TestListIdentitiesFilter(t *testing.T) {
+	ctx := context.Background()
+	p := NewIdentityPool(newTestPersister(t))
+	names := seedIdentities(t, p)
+
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{`traits.name.first eq "ann"`, []string{"ann"}},
+		{`traits.tags.1 eq "b"`, []string{"ann"}},
+		{`traits.email co "EXAMPLE"`, []string{"carl", "bob", "ann"}},
+		{`traits.email sw "a_"`, []string{}},
+		{`traits.age ge 25`, []string{"ann"}},
+		{`traits.age pr`, []string{"bob", "ann"}},
+		{`traits.vip eq null`, []string{"carl"}},
+
+		// Missing values differ from every value.
+		{`traits.age ne 30`, []string{"carl", "bob"}},
+		{`not (traits.age eq 30)`, []string{"carl", "bob"}},
+		{`traits.vip ne true`, []string{"carl", "bob"}},
+		{`not (traits.name.first sw "A")`, []string{"carl", "bob"}},
+		{`not (traits.age gt 10 and traits.vip eq false)`, []string{"carl", "ann"}},
+
+		{`credentials.type eq "totp"`, []string{"bob"}},
+		{`credentials.type ne "totp"`, []string{"carl", "ann"}},
+		{`credentials.type pr`, []string{"bob", "ann"}},
+		{`not (credentials.type pr)`, []string{"carl"}},
+		{`credentials.identifier eq "ANN@example.com"`, []string{"ann"}},
+		{`credentials.identifier ew "@example.com" and traits.age lt 25`, []string{"bob"}},
+
+		{`created_at lt "2024-02-01T12:00:00Z"`, []string{"ann"}},
+		{`created_at ge "2024-02-01T12:00:00Z"`, []string{"carl", "bob"}},
+		{`created_at gt "2024-01-15T00:00:00+02:00" and created_at le "2024-02-01T13:00:00+01:00"`, []string{"bob"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			identities, total, err := p.ListIdentities(ctx, testNetworkID, 10, 0, &persistence.IdentityFilter{Where: where(t, tt.filter)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(identities))
+			for i, identity := range identities {
+				got[i] = names[identity.ID]
+			}
+			if !reflect.DeepEqual(got, tt.want) || total != len(tt.want) {
+				t.Errorf("ListIdentities() = %q (total %d), want %q", got, total, tt.want)
+			}
+		})
+	}
+}
+
+func TestListIdentitiesSort(t *testing.T) {
+	ctx := context.Background()
+	p := NewIdentityPool(newTestPersister(t))
+	names := seedIdentities(t, p)
+
+	tests := []struct {
+		by   string
+		desc bool
+		want []string
+	}{
+		{"", false, []string{"carl", "bob", "ann"}},
+		{"created_at", false, []string{"ann", "bob", "carl"}},
+		{"traits.age", false, []string{"carl", "bob", "ann"}},
+		{"traits.age", true, []string{"ann", "bob", "carl"}},
+		{"traits.email", true, []string{"carl", "bob", "ann"}},
+	}
+	for _, tt := range tests {
+		identities, _, err := p.ListIdentities(ctx, testNetworkID, 10, 0, &persistence.IdentityFilter{SortBy: tt.by, SortDesc: tt.desc})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, len(identities))
+		for i, identity := range identities {
+			got[i] = names[identity.ID]
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListIdentities(sort %q, desc %t) = %q, want %q", tt.by, tt.desc, got, tt.want)
+		}
+	}
+
+	if _, _, err := p.ListIdentities(ctx, testNetworkID, 10, 0, &persistence.IdentityFilter{SortBy: "traits.a\"b"}); err == nil {
+		t.Error("ListIdentities() sorted by an invalid trait path succeeded")
+	}
+	if _, _, err := p.ListIdentities(ctx, testNetworkID, 10, 0, &persistence.IdentityFilter{SortBy: "credentials.type"}); err == nil {
+		t.Error("ListIdentities() sorted by credentials succeeded")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdentityPasswordHistoryModel represents a previous password hash of an identity in the database.
+type IdentityPasswordHistoryModel struct {
+	ID         string    `gorm:"primaryKey;column:id"                                             json:"id"`
+	IdentityID string    `gorm:"column:identity_id;size:36;index:idx_password_history,priority:1" json:"identity_id"`
+	Hash       []byte    `gorm:"column:hash"                                                      json:"-"`
+	CreatedAt  time.Time `gorm:"column:created_at;index:idx_password_history,priority:2"          json:"created_at"`
+}
+
+// TableName returns the table name for IdentityPasswordHistoryModel.
+func (IdentityPasswordHistoryModel) TableName() string {
+	return "iam_identity_password_history"
+}
+
+// ListPasswordHistory returns up to limit of the most recent password
+// hashes of an identity, newest first.
+func (p *IdentityPool) ListPasswordHistory(ctx context.Context, identityID string, limit int) ([][]byte, error) {
+	var ms []IdentityPasswordHistoryModel
+	if err := p.db.Connection(ctx).
+		Where("identity_id = ?", identityID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	hashes := make([][]byte, len(ms))
+	for i := range ms {
+		hashes[i] = ms[i].Hash
+	}
+	return hashes, nil
+}
+
+// AddPasswordHistory records a password hash of an identity and drops all
+// but the keep most recent hashes.
+func (p *IdentityPool) AddPasswordHistory(ctx context.Context, identityID string, hash []byte, keep int) error {
+	return p.db.Transaction(ctx, func(ctx context.Context) error {
+		conn := p.db.Connection(ctx)
+		if err := conn.Create(&IdentityPasswordHistoryModel{
+			ID:         uuid.New().String(),
+			IdentityID: identityID,
+			Hash:       hash,
+			CreatedAt:  time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		var stale []string
+		if err := conn.Model(&IdentityPasswordHistoryModel{}).
+			Where("identity_id = ?", identityID).
+			Order("created_at DESC").
+			Offset(keep).
+			Limit(-1).
+			Pluck("id", &stale).Error; err != nil {
+			return err
+		}
+		if len(stale) == 0 {
+			return nil
+		}
+		return conn.Where("id IN ?", stale).Delete(&IdentityPasswordHistoryModel{}).Error
+	})
+}
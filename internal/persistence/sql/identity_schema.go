@@ -0,0 +1,133 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// IdentitySchemaModel represents an immutable identity schema version in the database.
+type IdentitySchemaModel struct {
+	SchemaID   string    `gorm:"primaryKey;column:schema_id"                   json:"schema_id"`
+	Version    int       `gorm:"primaryKey;column:version;autoIncrement:false" json:"version"`
+	Type       string    `gorm:"column:type"                                   json:"type"`
+	JSONSchema []byte    `gorm:"column:json_schema"                            json:"json_schema"`
+	Transform  []byte    `gorm:"column:transform"                              json:"transform"`
+	Author     string    `gorm:"column:author"                                 json:"author"`
+	CreatedAt  time.Time `gorm:"column:created_at"                             json:"created_at"`
+}
+
+// TableName returns the table name for IdentitySchemaModel.
+func (IdentitySchemaModel) TableName() string {
+	return "iam_identity_schemas"
+}
+
+// IdentitySchemaPool implements persistence.IdentitySchemaPersister using GORM.
+type IdentitySchemaPool struct {
+	db *Persister
+}
+
+// NewIdentitySchemaPool creates a new identity schema pool.
+func NewIdentitySchemaPool(db *Persister) *IdentitySchemaPool {
+	return &IdentitySchemaPool{db: db}
+}
+
+// GetIdentitySchema retrieves a schema version; version 0 selects the latest.
+func (p *IdentitySchemaPool) GetIdentitySchema(ctx context.Context, schemaID string, version int) (*persistence.IdentitySchema, error) {
+	var m IdentitySchemaModel
+	query := p.db.Connection(ctx).Where("schema_id = ?", schemaID)
+	if version > 0 {
+		query = query.Where("version = ?", version)
+	}
+	if err := query.Order("version DESC").First(&m).Error; err != nil {
+		return nil, err
+	}
+	return p.modelToDomain(&m), nil
+}
+
+// ListIdentitySchemas lists the latest version of every schema.
+func (p *IdentitySchemaPool) ListIdentitySchemas(ctx context.Context) ([]*persistence.IdentitySchema, error) {
+	db := p.db.Connection(ctx)
+	latest := db.Model(&IdentitySchemaModel{}).
+		Select("schema_id, MAX(version) AS version").
+		Group("schema_id")
+
+	var ms []IdentitySchemaModel
+	if err := db.
+		Joins("JOIN (?) latest ON latest.schema_id = iam_identity_schemas.schema_id AND latest.version = iam_identity_schemas.version", latest).
+		Order("iam_identity_schemas.schema_id").
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+
+	schemas := make([]*persistence.IdentitySchema, len(ms))
+	for i := range ms {
+		schemas[i] = p.modelToDomain(&ms[i])
+	}
+	return schemas, nil
+}
+
+// ListIdentitySchemaVersions lists all versions of a schema, newest first.
+func (p *IdentitySchemaPool) ListIdentitySchemaVersions(ctx context.Context, schemaID string) ([]*persistence.IdentitySchema, error) {
+	var ms []IdentitySchemaModel
+	if err := p.db.Connection(ctx).
+		Where("schema_id = ?", schemaID).
+		Order("version DESC").
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+
+	schemas := make([]*persistence.IdentitySchema, len(ms))
+	for i := range ms {
+		schemas[i] = p.modelToDomain(&ms[i])
+	}
+	return schemas, nil
+}
+
+// CreateIdentitySchema stores a new schema version.
+func (p *IdentitySchemaPool) CreateIdentitySchema(ctx context.Context, schema *persistence.IdentitySchema) error {
+	m := &IdentitySchemaModel{
+		SchemaID:   schema.SchemaID,
+		Version:    schema.Version,
+		Type:       schema.Type,
+		JSONSchema: schema.JSONSchema,
+		Transform:  schema.Transform,
+		Author:     schema.Author,
+		CreatedAt:  schema.CreatedAt,
+	}
+	return p.db.Connection(ctx).Create(m).Error
+}
+
+// DeleteIdentitySchema deletes all versions of a schema.
+func (p *IdentitySchemaPool) DeleteIdentitySchema(ctx context.Context, schemaID string) error {
+	return p.db.Connection(ctx).Where("schema_id = ?", schemaID).Delete(&IdentitySchemaModel{}).Error
+}
+
+// CountIdentitiesBySchema counts the identities using a schema.
+func (p *IdentitySchemaPool) CountIdentitiesBySchema(ctx context.Context, schemaID string) (int, error) {
+	var n int64
+	if err := p.db.Connection(ctx).Model(&IdentityModel{}).Where("schema_id = ?", schemaID).Count(&n).Error; err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func (p *IdentitySchemaPool) modelToDomain(m *IdentitySchemaModel) *persistence.IdentitySchema {
+	return &persistence.IdentitySchema{
+		SchemaID:   m.SchemaID,
+		Version:    m.Version,
+		Type:       m.Type,
+		JSONSchema: m.JSONSchema,
+		Transform:  m.Transform,
+		Author:     m.Author,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+// Ensure IdentitySchemaPool implements persistence.IdentitySchemaPersister.
+var _ persistence.IdentitySchemaPersister = (*IdentitySchemaPool)(nil)
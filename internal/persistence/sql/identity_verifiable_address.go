@@ -0,0 +1,150 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// IdentityVerifiableAddressModel represents a verifiable address of an identity in the database.
+type IdentityVerifiableAddressModel struct {
+	ID         string     `gorm:"primaryKey;column:id"                                          json:"id"`
+	IdentityID string     `gorm:"column:identity_id;size:36;index"                              json:"identity_id"`
+	NetworkID  string     `gorm:"column:nid;size:36;index:idx_verifiable_address,priority:1"    json:"network_id"`
+	Via        string     `gorm:"column:via;size:16;index:idx_verifiable_address,priority:2"    json:"via"`
+	Value      string     `gorm:"column:value;size:255;index:idx_verifiable_address,priority:3" json:"value"`
+	Status     string     `gorm:"column:status;size:16"                                         json:"status"`
+	Verified   bool       `gorm:"column:verified;not null;default:false"                        json:"verified"`
+	VerifiedAt *time.Time `gorm:"column:verified_at"                                            json:"verified_at"`
+	CreatedAt  time.Time  `gorm:"column:created_at"                                             json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"column:updated_at"                                             json:"updated_at"`
+}
+
+// TableName returns the table name for IdentityVerifiableAddressModel.
+func (IdentityVerifiableAddressModel) TableName() string {
+	return "iam_identity_verifiable_addresses"
+}
+
+// ListVerifiableAddresses lists the addresses of an identity.
+func (p *IdentityPool) ListVerifiableAddresses(ctx context.Context, identityID string) ([]*persistence.IdentityVerifiableAddress, error) {
+	var ms []IdentityVerifiableAddressModel
+	if err := p.db.Connection(ctx).Where("identity_id = ?", identityID).Order("created_at, value").Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	addrs := make([]*persistence.IdentityVerifiableAddress, len(ms))
+	for i := range ms {
+		addrs[i] = addressToDomain(&ms[i])
+	}
+	return addrs, nil
+}
+
+// GetVerifiableAddress retrieves an address by ID.
+func (p *IdentityPool) GetVerifiableAddress(ctx context.Context, id string) (*persistence.IdentityVerifiableAddress, error) {
+	var m IdentityVerifiableAddressModel
+	if err := p.db.Connection(ctx).Where("id = ?", id).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return addressToDomain(&m), nil
+}
+
+// FindVerifiableAddress finds an address of a live identity of a network
+// by channel and value. When identities share an address the oldest one
+// is returned.
+func (p *IdentityPool) FindVerifiableAddress(ctx context.Context, networkID, via, value string) (*persistence.IdentityVerifiableAddress, error) {
+	conn := p.db.Connection(ctx)
+	live := conn.Model(&IdentityModel{}).Select("id").Where("deleted_at IS NULL")
+	var m IdentityVerifiableAddressModel
+	if err := conn.
+		Where("nid = ? AND via = ? AND value = ? AND identity_id IN (?)", networkID, via, value, live).
+		Order("created_at").
+		First(&m).Error; err != nil {
+		return nil, err
+	}
+	return addressToDomain(&m), nil
+}
+
+// UpdateVerifiableAddress updates the verification state of an address.
+func (p *IdentityPool) UpdateVerifiableAddress(ctx context.Context, a *persistence.IdentityVerifiableAddress) error {
+	return p.db.Connection(ctx).Model(&IdentityVerifiableAddressModel{}).Where("id = ?", a.ID).Updates(map[string]any{
+		"status":      a.Status,
+		"verified":    a.Verified,
+		"verified_at": a.VerifiedAt,
+		"updated_at":  a.UpdatedAt,
+	}).Error
+}
+
+// writeVerifiableAddresses replaces the addresses of an identity when they
+// are set. Codes of removed addresses are deleted with them.
+func (p *IdentityPool) writeVerifiableAddresses(ctx context.Context, identity *persistence.Identity) error {
+	if identity.VerifiableAddresses == nil {
+		return nil
+	}
+	conn := p.db.Connection(ctx)
+
+	var existing []string
+	if err := conn.Model(&IdentityVerifiableAddressModel{}).Where("identity_id = ?", identity.ID).Pluck("id", &existing).Error; err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(identity.VerifiableAddresses))
+	for _, a := range identity.VerifiableAddresses {
+		keep[a.ID] = true
+	}
+	var removed []string
+	for _, id := range existing {
+		if !keep[id] {
+			removed = append(removed, id)
+		}
+	}
+	if len(removed) > 0 {
+		if err := conn.Where("address_id IN ?", removed).Delete(&VerificationCodeModel{}).Error; err != nil {
+			return err
+		}
+		if err := conn.Where("id IN ?", removed).Delete(&IdentityVerifiableAddressModel{}).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, a := range identity.VerifiableAddresses {
+		a.IdentityID = identity.ID
+		a.NetworkID = identity.NetworkID
+		if err := conn.Save(addressToModel(a)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addressToDomain(m *IdentityVerifiableAddressModel) *persistence.IdentityVerifiableAddress {
+	return &persistence.IdentityVerifiableAddress{
+		ID:         m.ID,
+		IdentityID: m.IdentityID,
+		NetworkID:  m.NetworkID,
+		Via:        m.Via,
+		Value:      m.Value,
+		Status:     m.Status,
+		Verified:   m.Verified,
+		VerifiedAt: m.VerifiedAt,
+		CreatedAt:  m.CreatedAt,
+		UpdatedAt:  m.UpdatedAt,
+	}
+}
+
+func addressToModel(a *persistence.IdentityVerifiableAddress) *IdentityVerifiableAddressModel {
+	return &IdentityVerifiableAddressModel{
+		ID:         a.ID,
+		IdentityID: a.IdentityID,
+		NetworkID:  a.NetworkID,
+		Via:        a.Via,
+		Value:      a.Value,
+		Status:     a.Status,
+		Verified:   a.Verified,
+		VerifiedAt: a.VerifiedAt,
+		CreatedAt:  a.CreatedAt,
+		UpdatedAt:  a.UpdatedAt,
+	}
+}
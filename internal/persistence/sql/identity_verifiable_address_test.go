@@ -0,0 +1,56 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNormalizeAddresses(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPersister(t)
+	db := p.db.WithContext(ctx)
+
+	now := time.Now()
+	want := map[string]string{
+		"a1": "ann@example.com",
+		"a2": "+4930123456",
+		"a3": "carl@example.com",
+		"a4": "bad\u200bvalue",
+	}
+	for id, value := range map[string]string{
+		"a1": "Ann@Example.com",
+		"a2": "+49 (30) 1234-56",
+		"a3": "carl@example.com",
+		"a4": "bad\u200bvalue",
+	} {
+		if err := db.Create(&IdentityVerifiableAddressModel{
+			ID: id, IdentityID: id, NetworkID: testNetworkID, Via: "email", Value: value, Status: "pending", CreatedAt: now, UpdatedAt: now,
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Where("id = ?", "20231215000000_normalize_addresses").Delete(&MigrationModel{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := p.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var ms []IdentityVerifiableAddressModel
+	if err := db.Find(&ms).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range ms {
+		if m.Value != want[m.ID] {
+			t.Errorf("address %s = %q after migration, want %q", m.ID, m.Value, want[m.ID])
+		}
+	}
+	if len(ms) != len(want) {
+		t.Errorf("found %d addresses, want %d", len(ms), len(want))
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// IdentityVersionModel represents an immutable identity version in the database.
+type IdentityVersionModel struct {
+	ID         string    `gorm:"primaryKey;column:id"                                                   json:"id"`
+	IdentityID string    `gorm:"column:identity_id;size:36;uniqueIndex:idx_identity_version,priority:1" json:"identity_id"`
+	NetworkID  string    `gorm:"column:nid;size:36;index"                                               json:"network_id"`
+	Version    int       `gorm:"column:version;uniqueIndex:idx_identity_version,priority:2"             json:"version"`
+	Action     string    `gorm:"column:action;size:32"                                                  json:"action"`
+	ActorID    string    `gorm:"column:actor_id;size:36"                                                json:"actor_id"`
+	ActorType  string    `gorm:"column:actor_type;size:32"                                              json:"actor_type"`
+	RequestID  string    `gorm:"column:request_id;size:128"                                             json:"request_id"`
+	Traits     []byte    `gorm:"column:traits"                                                          json:"traits"`
+	State      string    `gorm:"column:state;size:32"                                                   json:"state"`
+	CreatedAt  time.Time `gorm:"column:created_at"                                                      json:"created_at"`
+}
+
+// TableName returns the table name for IdentityVersionModel.
+func (IdentityVersionModel) TableName() string {
+	return "iam_identity_versions"
+}
+
+// CreateIdentityVersion stores a new version of an identity. Version
+// numbers are unique per identity; a taken number is reported as
+// persistence.ErrIdentityVersionExists.
+func (p *IdentityPool) CreateIdentityVersion(ctx context.Context, v *persistence.IdentityVersion) error {
+	m := &IdentityVersionModel{
+		ID:         v.ID,
+		IdentityID: v.IdentityID,
+		NetworkID:  v.NetworkID,
+		Version:    v.Version,
+		Action:     v.Action,
+		ActorID:    v.ActorID,
+		ActorType:  v.ActorType,
+		RequestID:  v.RequestID,
+		Traits:     v.Traits,
+		State:      v.State,
+		CreatedAt:  v.CreatedAt,
+	}
+	db := p.db.Connection(ctx)
+	if err := db.Create(m).Error; err != nil {
+		if isDuplicatedKey(db, err) {
+			return persistence.ErrIdentityVersionExists
+		}
+		return err
+	}
+	return nil
+}
+
+// LatestIdentityVersion returns the newest version number of an identity,
+// or 0 when it has no versions.
+func (p *IdentityPool) LatestIdentityVersion(ctx context.Context, identityID string) (int, error) {
+	var version int
+	if err := p.db.Connection(ctx).
+		Model(&IdentityVersionModel{}).
+		Select("COALESCE(MAX(version), 0)").
+		Where("identity_id = ?", identityID).
+		Scan(&version).Error; err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// ListIdentityVersions lists the versions of an identity, newest first.
+func (p *IdentityPool) ListIdentityVersions(ctx context.Context, identityID string) ([]*persistence.IdentityVersion, error) {
+	var ms []IdentityVersionModel
+	if err := p.db.Connection(ctx).
+		Where("identity_id = ?", identityID).
+		Order("version DESC").
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+
+	versions := make([]*persistence.IdentityVersion, len(ms))
+	for i := range ms {
+		m := &ms[i]
+		versions[i] = &persistence.IdentityVersion{
+			ID:         m.ID,
+			IdentityID: m.IdentityID,
+			NetworkID:  m.NetworkID,
+			Version:    m.Version,
+			Action:     m.Action,
+			ActorID:    m.ActorID,
+			ActorType:  m.ActorType,
+			RequestID:  m.RequestID,
+			Traits:     m.Traits,
+			State:      m.State,
+			CreatedAt:  m.CreatedAt,
+		}
+	}
+	return versions, nil
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/coding-hui/iam/pkg/identifier"
+)
+
+// MigrationModel records a data migration that has been applied.
+type MigrationModel struct {
+	ID        string    `gorm:"primaryKey;column:id" json:"id"`
+	AppliedAt time.Time `gorm:"column:applied_at"    json:"applied_at"`
+}
+
+// TableName returns the table name for MigrationModel.
+func (MigrationModel) TableName() string {
+	return "iam_migrations"
+}
+
+// dataMigration transforms existing rows after the schema has been migrated.
+type dataMigration struct {
+	ID string
+	Up func(tx *gorm.DB) error
+}
+
+// dataMigrations are applied in order, each at most once.
+var dataMigrations = []dataMigration{
+	{ID: "20231001000000_split_policy_values", Up: splitPolicyValues},
+	{ID: "20231101000000_password_changed_at", Up: backfillPasswordChangedAt},
+	{ID: "20231201000000_normalize_identifiers", Up: normalizeIdentifiers},
+	{ID: "20231215000000_normalize_addresses", Up: normalizeAddresses},
+}
+
+// migrateData applies pending data migrations, each in its own transaction.
+func (p *Persister) migrateData(ctx context.Context) error {
+	db := p.db.WithContext(ctx)
+	if err := db.AutoMigrate(&MigrationModel{}); err != nil {
+		return err
+	}
+
+	for _, m := range dataMigrations {
+		var count int64
+		if err := db.Model(&MigrationModel{}).Where("id = ?", m.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&MigrationModel{ID: m.ID, AppliedAt: time.Now()}).Error
+		}); err != nil {
+			return fmt.Errorf("data migration %s: %w", m.ID, err)
+		}
+	}
+	return nil
+}
+
+// splitPolicyValues moves the legacy comma-joined subjects, actions and
+// resources columns of iam_policies into iam_policy_values and drops them.
+func splitPolicyValues(tx *gorm.DB) error {
+	legacy := map[string]string{
+		"subjects":  policyFieldSubject,
+		"actions":   policyFieldAction,
+		"resources": policyFieldResource,
+	}
+
+	migrator := tx.Migrator()
+	for column, field := range legacy {
+		if !migrator.HasColumn(&PolicyModel{}, column) {
+			continue
+		}
+
+		var rows []struct {
+			ID        string
+			NetworkID string
+			Value     string
+		}
+		if err := tx.Table(PolicyModel{}.TableName()).
+			Select(fmt.Sprintf("id, nid AS network_id, %s AS value", column)).
+			Scan(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			var values []PolicyValueModel
+			for _, v := range strings.Split(row.Value, ",") {
+				if v = strings.TrimSpace(v); v == "" {
+					continue
+				}
+				values = append(values, PolicyValueModel{
+					PolicyID:  row.ID,
+					Field:     field,
+					Position:  len(values),
+					NetworkID: row.NetworkID,
+					Value:     v,
+				})
+			}
+			if len(values) == 0 {
+				continue
+			}
+			if err := tx.Where("policy_id = ? AND field = ?", row.ID, field).Delete(&PolicyValueModel{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&values).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := migrator.DropColumn(&PolicyModel{}, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillPasswordChangedAt starts the age of existing passwords at the
+// last update of their credentials.
+func backfillPasswordChangedAt(tx *gorm.DB) error {
+	return tx.Model(&IdentityCredentialsModel{}).
+		Where("type = ? AND password_changed_at IS NULL", "password").
+		Update("password_changed_at", gorm.Expr("updated_at")).Error
+}
+
+// normalizeIdentifiers rewrites the identifiers of password credentials
+// in their normalized form, see identifier.Normalize. Identifiers already
+// in that form keep it; otherwise the credentials created first get the
+// normalized form when several identities of a network share it. The
+// others keep their identifiers verbatim, which logins no longer reach,
+// so that the conflict is left to an administrator. Identifiers that
+// cannot be normalized are kept as well. Spellings of one identity
+// normalizing to the same identifier are merged.
+func normalizeIdentifiers(tx *gorm.DB) error {
+	var rows []struct {
+		ID         string
+		IdentityID string
+		NetworkID  string
+		Identifier string
+	}
+	if err := tx.Table(IdentityCredentialIdentifierModel{}.TableName()+" AS i").
+		Select("i.id, i.identity_id, i.nid AS network_id, i.identifier").
+		Joins("JOIN "+IdentityCredentialsModel{}.TableName()+" AS c ON c.id = i.credentials_id").
+		Where("i.type = ?", "password").
+		Order("c.created_at, i.id").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	normalized := make([]string, len(rows))
+	owners := make(map[string]string, len(rows))
+	key := func(networkID, value string) string { return networkID + "/" + value }
+	for i, row := range rows {
+		n, err := identifier.Normalize(row.Identifier)
+		if err != nil {
+			n = row.Identifier
+		}
+		normalized[i] = n
+		if n == row.Identifier {
+			owners[key(row.NetworkID, n)] = row.IdentityID
+		}
+	}
+
+	for i, row := range rows {
+		n := normalized[i]
+		if n == row.Identifier {
+			continue
+		}
+		switch owner, taken := owners[key(row.NetworkID, n)]; {
+		case !taken:
+			owners[key(row.NetworkID, n)] = row.IdentityID
+			if err := tx.Model(&IdentityCredentialIdentifierModel{}).
+				Where("id = ?", row.ID).
+				Update("identifier", n).Error; err != nil {
+				return err
+			}
+		case owner == row.IdentityID:
+			if err := tx.Where("id = ?", row.ID).Delete(&IdentityCredentialIdentifierModel{}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeAddresses rewrites the values of verifiable addresses in their
+// normalized form, see identifier.Normalize. Values that cannot be
+// normalized are kept.
+func normalizeAddresses(tx *gorm.DB) error {
+	var rows []struct {
+		ID    string
+		Value string
+	}
+	if err := tx.Model(&IdentityVerifiableAddressModel{}).Select("id, value").Scan(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		n, err := identifier.Normalize(row.Value)
+		if err != nil || n == row.Value {
+			continue
+		}
+		if err := tx.Model(&IdentityVerifiableAddressModel{}).
+			Where("id = ?", row.ID).
+			Update("value", n).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -70,8 +70,9 @@ func NewSQLitePersister(dsn string, opts *persistence.Options) (*Persister, erro
 }
 
 // Transaction executes fn within a database transaction.
+// Calls nested inside another transaction use a savepoint.
 func (p *Persister) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
-	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	return p.Connection(ctx).Transaction(func(tx *gorm.DB) error {
 		return fn(context.WithValue(ctx, txContextKey{}, tx))
 	})
 }
@@ -99,15 +100,33 @@ type txContextKey struct{}
 func (p *Persister) MigrateUp(ctx context.Context) error {
 	models := []any{
 		&IdentityModel{},
+		&IdentitySchemaModel{},
+		&IdentityCredentialsModel{},
+		&IdentityCredentialIdentifierModel{},
+		&IdentityPasswordHistoryModel{},
+		&IdentityVerifiableAddressModel{},
+		&IdentityVersionModel{},
+		&VerificationCodeModel{},
 		&SessionModel{},
 		&RoleModel{},
+		&RoleBindingModel{},
 		&PolicyModel{},
+		&PolicyValueModel{},
+		&PolicyVersionModel{},
 		&TokenModel{},
 		&AuditEventModel{},
+		&SCIMTokenModel{},
+		&SCIMConnectorModel{},
+		&SCIMConnectorResourceModel{},
 		&SecretKey{},
+		&PublicKeyModel{},
 	}
 
-	return p.db.AutoMigrate(models...)
+	if err := p.db.AutoMigrate(models...); err != nil {
+		return err
+	}
+
+	return p.migrateData(ctx)
 }
 
 // Ensure Persister implements persistence.Persister.
@@ -0,0 +1,26 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// newTestPersister returns a migrated persister backed by a SQLite
+// database file of the test.
+func newTestPersister(t *testing.T) *Persister {
+	t.Helper()
+	p, err := NewSQLitePersister(filepath.Join(t.TempDir(), "iam.db")+"?_busy_timeout=5000", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = p.Close(context.Background()) })
+	if err := p.MigrateUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -11,16 +11,21 @@ import (
 	"github.com/coding-hui/iam/internal/persistence"
 )
 
+// Policy value fields stored in iam_policy_values.
+const (
+	policyFieldSubject  = "subject"
+	policyFieldAction   = "action"
+	policyFieldResource = "resource"
+)
+
 // PolicyModel represents a policy in the database.
+// Subjects, actions and resources are stored as PolicyValueModel rows.
 type PolicyModel struct {
 	ID         string    `gorm:"primaryKey;column:id" json:"id"`
 	NetworkID  string    `gorm:"column:nid;index"     json:"network_id"`
 	Name       string    `gorm:"column:name"          json:"name"`
 	Type       string    `gorm:"column:type"          json:"type"`
-	Subjects   string    `gorm:"column:subjects"      json:"subjects"`
 	Effect     string    `gorm:"column:effect"        json:"effect"`
-	Actions    string    `gorm:"column:actions"       json:"actions"`
-	Resources  string    `gorm:"column:resources"     json:"resources"`
 	Conditions []byte    `gorm:"column:conditions"    json:"conditions"`
 	CreatedAt  time.Time `gorm:"column:created_at"    json:"created_at"`
 	UpdatedAt  time.Time `gorm:"column:updated_at"    json:"updated_at"`
@@ -31,6 +36,21 @@ func (PolicyModel) TableName() string {
 	return "iam_policies"
 }
 
+// PolicyValueModel represents a single subject, action or resource of a policy.
+// The (nid, field, value) index answers "policies mentioning subject X".
+type PolicyValueModel struct {
+	PolicyID  string `gorm:"primaryKey;column:policy_id;index"                                         json:"policy_id"`
+	Field     string `gorm:"primaryKey;column:field;size:16;index:idx_policy_values_lookup,priority:2" json:"field"`
+	Position  int    `gorm:"primaryKey;column:position;autoIncrement:false"                            json:"position"`
+	NetworkID string `gorm:"column:nid;size:36;index:idx_policy_values_lookup,priority:1"              json:"network_id"`
+	Value     string `gorm:"column:value;size:255;index:idx_policy_values_lookup,priority:3"           json:"value"`
+}
+
+// TableName returns the table name for PolicyValueModel.
+func (PolicyValueModel) TableName() string {
+	return "iam_policy_values"
+}
+
 // PolicyPool implements persistence.PolicyPersister using GORM.
 type PolicyPool struct {
 	db *Persister
@@ -47,7 +67,11 @@ func (p *PolicyPool) GetPolicy(ctx context.Context, id string) (*persistence.Pol
 	if err := p.db.Connection(ctx).Where("id = ?", id).First(&m).Error; err != nil {
 		return nil, err
 	}
-	return p.modelToDomain(&m), nil
+	policies, err := p.withValues(ctx, []PolicyModel{m})
+	if err != nil {
+		return nil, err
+	}
+	return policies[0], nil
 }
 
 // ListPolicies lists policies with pagination.
@@ -68,28 +92,125 @@ func (p *PolicyPool) ListPolicies(ctx context.Context, networkID string, limit,
 		return nil, 0, err
 	}
 
-	policies := make([]*persistence.Policy, len(ms))
-	for i := range ms {
-		policies[i] = p.modelToDomain(&ms[i])
+	policies, err := p.withValues(ctx, ms)
+	if err != nil {
+		return nil, 0, err
 	}
 	return policies, int(total), nil
 }
 
+// ListPoliciesBySubject lists policies that mention subject.
+func (p *PolicyPool) ListPoliciesBySubject(ctx context.Context, networkID, subject string) ([]*persistence.Policy, error) {
+	ids := p.db.Connection(ctx).
+		Model(&PolicyValueModel{}).
+		Select("policy_id").
+		Where("nid = ? AND field = ? AND value = ?", networkID, policyFieldSubject, subject)
+
+	var ms []PolicyModel
+	if err := p.db.Connection(ctx).
+		Where("id IN (?)", ids).
+		Order("created_at DESC").
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+
+	return p.withValues(ctx, ms)
+}
+
 // CreatePolicy creates a new policy.
 func (p *PolicyPool) CreatePolicy(ctx context.Context, policy *persistence.Policy) error {
-	m := p.domainToModel(policy)
-	return p.db.Connection(ctx).Create(m).Error
+	return p.db.Transaction(ctx, func(ctx context.Context) error {
+		m := p.domainToModel(policy)
+		if err := p.db.Connection(ctx).Create(m).Error; err != nil {
+			return err
+		}
+		return p.createValues(ctx, policy)
+	})
 }
 
 // UpdatePolicy updates a policy.
 func (p *PolicyPool) UpdatePolicy(ctx context.Context, policy *persistence.Policy) error {
-	m := p.domainToModel(policy)
-	return p.db.Connection(ctx).Model(m).Where("id = ?", policy.ID).Updates(m).Error
+	return p.db.Transaction(ctx, func(ctx context.Context) error {
+		m := p.domainToModel(policy)
+		if err := p.db.Connection(ctx).Model(m).Where("id = ?", policy.ID).Updates(m).Error; err != nil {
+			return err
+		}
+		if err := p.db.Connection(ctx).Where("policy_id = ?", policy.ID).Delete(&PolicyValueModel{}).Error; err != nil {
+			return err
+		}
+		return p.createValues(ctx, policy)
+	})
 }
 
 // DeletePolicy deletes a policy.
 func (p *PolicyPool) DeletePolicy(ctx context.Context, id string) error {
-	return p.db.Connection(ctx).Where("id = ?", id).Delete(&PolicyModel{}).Error
+	return p.db.Transaction(ctx, func(ctx context.Context) error {
+		if err := p.db.Connection(ctx).Where("policy_id = ?", id).Delete(&PolicyValueModel{}).Error; err != nil {
+			return err
+		}
+		return p.db.Connection(ctx).Where("id = ?", id).Delete(&PolicyModel{}).Error
+	})
+}
+
+func (p *PolicyPool) createValues(ctx context.Context, policy *persistence.Policy) error {
+	values := make([]PolicyValueModel, 0, len(policy.Subjects)+len(policy.Actions)+len(policy.Resources))
+	values = appendPolicyValues(values, policy, policyFieldSubject, policy.Subjects)
+	values = appendPolicyValues(values, policy, policyFieldAction, policy.Actions)
+	values = appendPolicyValues(values, policy, policyFieldResource, policy.Resources)
+	if len(values) == 0 {
+		return nil
+	}
+	return p.db.Connection(ctx).Create(&values).Error
+}
+
+func appendPolicyValues(values []PolicyValueModel, policy *persistence.Policy, field string, ss []string) []PolicyValueModel {
+	for i, s := range ss {
+		values = append(values, PolicyValueModel{
+			PolicyID:  policy.ID,
+			Field:     field,
+			Position:  i,
+			NetworkID: policy.NetworkID,
+			Value:     s,
+		})
+	}
+	return values
+}
+
+// withValues converts ms to domain policies and attaches their values.
+func (p *PolicyPool) withValues(ctx context.Context, ms []PolicyModel) ([]*persistence.Policy, error) {
+	policies := make([]*persistence.Policy, len(ms))
+	if len(ms) == 0 {
+		return policies, nil
+	}
+
+	byID := make(map[string]*persistence.Policy, len(ms))
+	ids := make([]string, len(ms))
+	for i := range ms {
+		policies[i] = p.modelToDomain(&ms[i])
+		byID[ms[i].ID] = policies[i]
+		ids[i] = ms[i].ID
+	}
+
+	var values []PolicyValueModel
+	if err := p.db.Connection(ctx).
+		Where("policy_id IN ?", ids).
+		Order("policy_id, field, position").
+		Find(&values).Error; err != nil {
+		return nil, err
+	}
+
+	for _, v := range values {
+		policy := byID[v.PolicyID]
+		switch v.Field {
+		case policyFieldSubject:
+			policy.Subjects = append(policy.Subjects, v.Value)
+		case policyFieldAction:
+			policy.Actions = append(policy.Actions, v.Value)
+		case policyFieldResource:
+			policy.Resources = append(policy.Resources, v.Value)
+		}
+	}
+	return policies, nil
 }
 
 func (p *PolicyPool) modelToDomain(m *PolicyModel) *persistence.Policy {
@@ -98,10 +219,7 @@ func (p *PolicyPool) modelToDomain(m *PolicyModel) *persistence.Policy {
 		NetworkID:  m.NetworkID,
 		Name:       m.Name,
 		Type:       m.Type,
-		Subjects:   m.Subjects,
 		Effect:     m.Effect,
-		Actions:    m.Actions,
-		Resources:  m.Resources,
 		Conditions: m.Conditions,
 		CreatedAt:  m.CreatedAt,
 		UpdatedAt:  m.UpdatedAt,
@@ -114,10 +232,7 @@ func (p *PolicyPool) domainToModel(r *persistence.Policy) *PolicyModel {
 		NetworkID:  r.NetworkID,
 		Name:       r.Name,
 		Type:       r.Type,
-		Subjects:   r.Subjects,
 		Effect:     r.Effect,
-		Actions:    r.Actions,
-		Resources:  r.Resources,
 		Conditions: r.Conditions,
 		CreatedAt:  r.CreatedAt,
 		UpdatedAt:  r.UpdatedAt,
@@ -0,0 +1,159 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+const (
+	testNetworkID  = "00000000-0000-0000-0000-000000000001"
+	otherNetworkID = "11111111-1111-1111-1111-111111111111"
+)
+
+// policyIDs returns the IDs of policies.
+func policyIDs(policies []*persistence.Policy) []string {
+	ids := make([]string, len(policies))
+	for i, p := range policies {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+func TestSplitPolicyValues(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPersister(t)
+	db := p.db.WithContext(ctx)
+
+	// Restore the comma-joined columns the policies had before the
+	// migration, quoted as AutoMigrate created them, and seed them.
+	for _, column := range []string{"subjects", "actions", "resources"} {
+		if err := db.Exec("ALTER TABLE iam_policies ADD COLUMN `" + column + "` text").Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	created := time.Now().Add(-time.Hour)
+	for _, row := range []struct {
+		id, nid, subjects, actions, resources string
+		created                               time.Time
+	}{
+		{"p1", testNetworkID, "alice, editor", "read,write", "doc,", created},
+		{"p2", testNetworkID, "editor", "read", "report", created.Add(time.Minute)},
+		{"p3", otherNetworkID, "alice", "read", "doc", created},
+		{"p4", testNetworkID, "", "read", "doc", created},
+	} {
+		if err := db.Exec(
+			"INSERT INTO iam_policies (id, nid, name, type, effect, subjects, actions, resources, created_at, updated_at) VALUES (?, ?, ?, '', 'allow', ?, ?, ?, ?, ?)",
+			row.id, row.nid, row.id, row.subjects, row.actions, row.resources, row.created, row.created,
+		).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Where("id = ?", "20231001000000_split_policy_values").Delete(&MigrationModel{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := p.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, column := range []string{"subjects", "actions", "resources"} {
+		if db.Migrator().HasColumn(&PolicyModel{}, column) {
+			t.Errorf("legacy column %s was not dropped", column)
+		}
+	}
+
+	pool := NewPolicyPool(p)
+	got, err := pool.GetPolicy(ctx, "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"alice", "editor"}; !reflect.DeepEqual(got.Subjects, want) {
+		t.Errorf("migrated subjects = %q, want %q", got.Subjects, want)
+	}
+	if want := []string{"read", "write"}; !reflect.DeepEqual(got.Actions, want) {
+		t.Errorf("migrated actions = %q, want %q", got.Actions, want)
+	}
+	if want := []string{"doc"}; !reflect.DeepEqual(got.Resources, want) {
+		t.Errorf("migrated resources = %q, want %q", got.Resources, want)
+	}
+	if got, err := pool.GetPolicy(ctx, "p4"); err != nil || len(got.Subjects) != 0 {
+		t.Errorf("GetPolicy(p4) = %+v, %v, want no subjects", got, err)
+	}
+
+	for _, tc := range []struct {
+		networkID, subject string
+		want               []string
+	}{
+		{testNetworkID, "alice", []string{"p1"}},
+		{testNetworkID, "editor", []string{"p2", "p1"}},
+		{testNetworkID, "alice, editor", []string{}},
+		{otherNetworkID, "alice", []string{"p3"}},
+		{otherNetworkID, "editor", []string{}},
+	} {
+		policies, err := pool.ListPoliciesBySubject(ctx, tc.networkID, tc.subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := policyIDs(policies); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ListPoliciesBySubject(%s, %q) = %q, want %q", tc.networkID, tc.subject, got, tc.want)
+		}
+	}
+}
+
+func TestPolicyValuesRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	pool := NewPolicyPool(newTestPersister(t))
+	policy := &persistence.Policy{
+		ID:        "p1",
+		NetworkID: testNetworkID,
+		Name:      "editors",
+		Effect:    "allow",
+		Subjects:  []string{"editor", "alice", "editor,admin"},
+		Actions:   []string{"write", "read"},
+		Resources: []string{"doc:*"},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := pool.CreatePolicy(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+	got, err := pool.GetPolicy(ctx, "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Subjects, policy.Subjects) || !reflect.DeepEqual(got.Actions, policy.Actions) ||
+		!reflect.DeepEqual(got.Resources, policy.Resources) {
+		t.Errorf("GetPolicy() = %+v, want the values of %+v in order", got, policy)
+	}
+	if policies, err := pool.ListPoliciesBySubject(ctx, testNetworkID, "editor,admin"); err != nil || len(policies) != 1 {
+		t.Errorf("ListPoliciesBySubject(editor,admin) = %v, %v, want p1", policies, err)
+	}
+
+	policy.Subjects = []string{"bob"}
+	if err := pool.UpdatePolicy(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+	for subject, want := range map[string]int{"alice": 0, "editor": 0, "bob": 1} {
+		policies, err := pool.ListPoliciesBySubject(ctx, testNetworkID, subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(policies) != want {
+			t.Errorf("ListPoliciesBySubject(%s) after update = %q, want %d policies", subject, policyIDs(policies), want)
+		}
+	}
+
+	if err := pool.DeletePolicy(ctx, "p1"); err != nil {
+		t.Fatal(err)
+	}
+	if policies, err := pool.ListPoliciesBySubject(ctx, testNetworkID, "bob"); err != nil || len(policies) != 0 {
+		t.Errorf("ListPoliciesBySubject(bob) after delete = %v, %v, want none", policies, err)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// PolicyVersionModel represents an immutable policy version in the database.
+type PolicyVersionModel struct {
+	ID           string    `gorm:"primaryKey;column:id"                                       json:"id"`
+	PolicyID     string    `gorm:"column:policy_id;uniqueIndex:idx_policy_version,priority:1" json:"policy_id"`
+	NetworkID    string    `gorm:"column:nid;index"                                           json:"network_id"`
+	Version      int       `gorm:"column:version;uniqueIndex:idx_policy_version,priority:2"   json:"version"`
+	Action       string    `gorm:"column:action"                                              json:"action"`
+	Author       string    `gorm:"column:author"                                              json:"author"`
+	RestoredFrom int       `gorm:"column:restored_from"                                       json:"restored_from"`
+	Snapshot     []byte    `gorm:"column:snapshot"                                            json:"snapshot"`
+	Diff         []byte    `gorm:"column:diff"                                                json:"diff"`
+	CreatedAt    time.Time `gorm:"column:created_at"                                          json:"created_at"`
+}
+
+// TableName returns the table name for PolicyVersionModel.
+func (PolicyVersionModel) TableName() string {
+	return "iam_policy_versions"
+}
+
+// CreatePolicyVersion stores a new policy version. Version numbers are
+// unique per policy; a taken number is reported as
+// persistence.ErrPolicyVersionExists.
+func (p *PolicyPool) CreatePolicyVersion(ctx context.Context, version *persistence.PolicyVersion) error {
+	m := &PolicyVersionModel{
+		ID:           version.ID,
+		PolicyID:     version.PolicyID,
+		NetworkID:    version.NetworkID,
+		Version:      version.Version,
+		Action:       version.Action,
+		Author:       version.Author,
+		RestoredFrom: version.RestoredFrom,
+		Snapshot:     version.Snapshot,
+		Diff:         version.Diff,
+		CreatedAt:    version.CreatedAt,
+	}
+	db := p.db.Connection(ctx)
+	if err := db.Create(m).Error; err != nil {
+		if isDuplicatedKey(db, err) {
+			return persistence.ErrPolicyVersionExists
+		}
+		return err
+	}
+	return nil
+}
+
+// isDuplicatedKey reports whether err is the violation of a unique index,
+// as translated by the dialect of db.
+func isDuplicatedKey(db *gorm.DB, err error) bool {
+	if t, ok := db.Dialector.(gorm.ErrorTranslator); ok {
+		err = t.Translate(err)
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
+
+// GetPolicyVersion retrieves a single version of a policy.
+func (p *PolicyPool) GetPolicyVersion(ctx context.Context, policyID string, version int) (*persistence.PolicyVersion, error) {
+	var m PolicyVersionModel
+	if err := p.db.Connection(ctx).
+		Where("policy_id = ? AND version = ?", policyID, version).
+		First(&m).Error; err != nil {
+		return nil, err
+	}
+	return p.versionModelToDomain(&m), nil
+}
+
+// ListPolicyVersions lists all versions of a policy, newest first.
+func (p *PolicyPool) ListPolicyVersions(ctx context.Context, policyID string) ([]*persistence.PolicyVersion, error) {
+	var ms []PolicyVersionModel
+	if err := p.db.Connection(ctx).
+		Where("policy_id = ?", policyID).
+		Order("version DESC").
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+
+	versions := make([]*persistence.PolicyVersion, len(ms))
+	for i := range ms {
+		versions[i] = p.versionModelToDomain(&ms[i])
+	}
+	return versions, nil
+}
+
+func (p *PolicyPool) versionModelToDomain(m *PolicyVersionModel) *persistence.PolicyVersion {
+	return &persistence.PolicyVersion{
+		ID:           m.ID,
+		PolicyID:     m.PolicyID,
+		NetworkID:    m.NetworkID,
+		Version:      m.Version,
+		Action:       m.Action,
+		Author:       m.Author,
+		RestoredFrom: m.RestoredFrom,
+		Snapshot:     m.Snapshot,
+		Diff:         m.Diff,
+		CreatedAt:    m.CreatedAt,
+	}
+}
@@ -8,17 +8,26 @@ import (
 	"context"
 	"time"
 
+	"gorm.io/gorm"
+
 	"github.com/coding-hui/iam/internal/persistence"
 )
 
 // IdentityModel represents an identity in the database.
 type IdentityModel struct {
-	ID        string    `gorm:"primaryKey;column:id" json:"id"`
-	NetworkID string    `gorm:"column:nid;index"     json:"network_id"`
-	SchemaID  string    `gorm:"column:schema_id"     json:"schema_id"`
-	Traits    []byte    `gorm:"column:traits"        json:"traits"`
-	CreatedAt time.Time `gorm:"column:created_at"    json:"created_at"`
-	UpdatedAt time.Time `gorm:"column:updated_at"    json:"updated_at"`
+	ID             string     `gorm:"primaryKey;column:id"                                                   json:"id"`
+	NetworkID      string     `gorm:"column:nid;index"                                                       json:"network_id"`
+	Type           string     `gorm:"column:type;size:32;default:user;index"                                 json:"type"`
+	SchemaID       string     `gorm:"column:schema_id;index:idx_identities_schema,priority:1"                json:"schema_id"`
+	SchemaVersion  int        `gorm:"column:schema_version;default:1;index:idx_identities_schema,priority:2" json:"schema_version"`
+	Traits         []byte     `gorm:"column:traits"                                                          json:"traits"`
+	MetadataPublic []byte     `gorm:"column:metadata_public"                                                 json:"metadata_public"`
+	MetadataAdmin  []byte     `gorm:"column:metadata_admin"                                                  json:"metadata_admin"`
+	State          string     `gorm:"column:state;size:32;default:active;index"                              json:"state"`
+	StateChangedAt *time.Time `gorm:"column:state_changed_at"                                                json:"state_changed_at"`
+	CreatedAt      time.Time  `gorm:"column:created_at"                                                      json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at"                                                      json:"updated_at"`
+	DeletedAt      *time.Time `gorm:"column:deleted_at;index"                                                json:"deleted_at"`
 }
 
 // TableName returns the table name for IdentityModel.
@@ -39,27 +48,49 @@ func NewIdentityPool(db *Persister) *IdentityPool {
 // GetIdentity retrieves an identity by ID.
 func (p *IdentityPool) GetIdentity(ctx context.Context, id string) (*persistence.Identity, error) {
 	var m IdentityModel
-	if err := p.db.Connection(ctx).Where("id = ?", id).First(&m).Error; err != nil {
+	if err := p.db.Connection(ctx).Where("id = ? AND deleted_at IS NULL", id).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return p.modelToDomain(&m), nil
+}
+
+// GetDeletedIdentity retrieves a deleted identity by ID.
+func (p *IdentityPool) GetDeletedIdentity(ctx context.Context, id string) (*persistence.Identity, error) {
+	var m IdentityModel
+	if err := p.db.Connection(ctx).Where("id = ? AND deleted_at IS NOT NULL", id).First(&m).Error; err != nil {
 		return nil, err
 	}
 	return p.modelToDomain(&m), nil
 }
 
-// ListIdentities lists identities with pagination.
-func (p *IdentityPool) ListIdentities(ctx context.Context, networkID string, limit, offset int) ([]*persistence.Identity, int, error) {
+// ListIdentities lists identities matching filter with pagination.
+func (p *IdentityPool) ListIdentities(ctx context.Context, networkID string, limit, offset int, filter *persistence.IdentityFilter) ([]*persistence.Identity, int, error) {
 	var ms []IdentityModel
 	var total int64
 
-	query := p.db.Connection(ctx)
+	query := p.db.Connection(ctx).Model(&IdentityModel{})
 	if networkID != "" {
-		query = query.Where("nid = ?", networkID)
+		query = query.Where("iam_identities.nid = ?", networkID)
+	}
+	if filter != nil && filter.Deleted {
+		query = query.Where("iam_identities.deleted_at IS NOT NULL")
+	} else {
+		query = query.Where("iam_identities.deleted_at IS NULL")
+	}
+	query, err := applyIdentityFilter(query, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	order, err := identityOrder(query, filter)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	if err := query.Model(&IdentityModel{}).Count(&total).Error; err != nil {
+	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
-	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&ms).Error; err != nil {
+	if err := query.Order(order).Limit(limit).Offset(offset).Find(&ms).Error; err != nil {
 		return nil, 0, err
 	}
 
@@ -70,42 +101,174 @@ func (p *IdentityPool) ListIdentities(ctx context.Context, networkID string, lim
 	return identities, int(total), nil
 }
 
-// CreateIdentity creates a new identity.
+// CreateIdentity creates a new identity together with its credentials and
+// addresses.
 func (p *IdentityPool) CreateIdentity(ctx context.Context, identity *persistence.Identity) error {
 	m := p.domainToModel(identity)
-	return p.db.Connection(ctx).Create(m).Error
+	return p.db.Transaction(ctx, func(ctx context.Context) error {
+		if err := p.db.Connection(ctx).Create(m).Error; err != nil {
+			return err
+		}
+		if err := p.writeCredentials(ctx, identity); err != nil {
+			return err
+		}
+		return p.writeVerifiableAddresses(ctx, identity)
+	})
 }
 
-// UpdateIdentity updates an identity.
+// UpdateIdentity updates an identity. Credentials listed on the identity
+// are created or updated; other credentials are left untouched. Addresses
+// are replaced when set.
 func (p *IdentityPool) UpdateIdentity(ctx context.Context, identity *persistence.Identity) error {
 	m := p.domainToModel(identity)
-	return p.db.Connection(ctx).Model(m).Where("id = ?", identity.ID).Updates(m).Error
+	return p.db.Transaction(ctx, func(ctx context.Context) error {
+		if err := p.db.Connection(ctx).Model(m).Where("id = ?", identity.ID).Updates(m).Error; err != nil {
+			return err
+		}
+		// Updates skips empty fields; cleared metadata is written
+		// explicitly.
+		if err := p.db.Connection(ctx).Model(m).Where("id = ?", identity.ID).UpdateColumns(map[string]any{
+			"metadata_public": m.MetadataPublic,
+			"metadata_admin":  m.MetadataAdmin,
+		}).Error; err != nil {
+			return err
+		}
+		if err := p.writeCredentials(ctx, identity); err != nil {
+			return err
+		}
+		return p.writeVerifiableAddresses(ctx, identity)
+	})
+}
+
+// ListIdentitiesBySchema lists identities at a schema version ordered by ID,
+// starting after the given ID. It is used to walk identities in batches.
+func (p *IdentityPool) ListIdentitiesBySchema(ctx context.Context, schemaID string, version int, after string, limit int) ([]*persistence.Identity, error) {
+	var ms []IdentityModel
+	if err := p.db.Connection(ctx).
+		Where("schema_id = ? AND schema_version = ? AND id > ? AND deleted_at IS NULL", schemaID, version, after).
+		Order("id").
+		Limit(limit).
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+
+	identities := make([]*persistence.Identity, len(ms))
+	for i := range ms {
+		identities[i] = p.modelToDomain(&ms[i])
+	}
+	return identities, nil
 }
 
-// DeleteIdentity deletes an identity.
+// DeleteIdentity deletes an identity together with its credentials,
+// password history, addresses, versions, sessions, tokens, role bindings,
+// secret keys and public keys.
 func (p *IdentityPool) DeleteIdentity(ctx context.Context, id string) error {
-	return p.db.Connection(ctx).Where("id = ?", id).Delete(&IdentityModel{}).Error
+	return p.db.Transaction(ctx, func(ctx context.Context) error {
+		conn := p.db.Connection(ctx)
+		for _, m := range []any{
+			&IdentityCredentialIdentifierModel{},
+			&IdentityCredentialsModel{},
+			&IdentityPasswordHistoryModel{},
+			&IdentityVerifiableAddressModel{},
+			&IdentityVersionModel{},
+			&VerificationCodeModel{},
+			&SessionModel{},
+			&TokenModel{},
+			&SecretKey{},
+			&PublicKeyModel{},
+		} {
+			if err := conn.Where("identity_id = ?", id).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		if err := conn.Where("subject = ?", id).Delete(&RoleBindingModel{}).Error; err != nil {
+			return err
+		}
+		return conn.Where("id = ?", id).Delete(&IdentityModel{}).Error
+	})
+}
+
+// SoftDeleteIdentity marks an identity of a network as deleted.
+func (p *IdentityPool) SoftDeleteIdentity(ctx context.Context, networkID, id string, at time.Time) error {
+	result := p.db.Connection(ctx).Model(&IdentityModel{}).
+		Where("id = ? AND nid = ? AND deleted_at IS NULL", id, networkID).
+		Update("deleted_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RestoreIdentity clears the deletion mark of an identity of a network.
+func (p *IdentityPool) RestoreIdentity(ctx context.Context, networkID, id string) error {
+	result := p.db.Connection(ctx).Model(&IdentityModel{}).
+		Where("id = ? AND nid = ? AND deleted_at IS NOT NULL", id, networkID).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListIdentitiesDeletedBefore lists up to limit identities deleted before
+// the given time, longest deleted first, skipping the first offset.
+func (p *IdentityPool) ListIdentitiesDeletedBefore(ctx context.Context, before time.Time, limit, offset int) ([]*persistence.Identity, error) {
+	var ms []IdentityModel
+	if err := p.db.Connection(ctx).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Order("deleted_at, id").
+		Limit(limit).
+		Offset(offset).
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+
+	identities := make([]*persistence.Identity, len(ms))
+	for i := range ms {
+		identities[i] = p.modelToDomain(&ms[i])
+	}
+	return identities, nil
 }
 
 func (p *IdentityPool) modelToDomain(m *IdentityModel) *persistence.Identity {
 	return &persistence.Identity{
-		ID:        m.ID,
-		NetworkID: m.NetworkID,
-		SchemaID:  m.SchemaID,
-		Traits:    m.Traits,
-		CreatedAt: m.CreatedAt,
-		UpdatedAt: m.UpdatedAt,
+		ID:             m.ID,
+		NetworkID:      m.NetworkID,
+		Type:           m.Type,
+		SchemaID:       m.SchemaID,
+		SchemaVersion:  m.SchemaVersion,
+		Traits:         m.Traits,
+		MetadataPublic: m.MetadataPublic,
+		MetadataAdmin:  m.MetadataAdmin,
+		State:          m.State,
+		StateChangedAt: m.StateChangedAt,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+		DeletedAt:      m.DeletedAt,
 	}
 }
 
 func (p *IdentityPool) domainToModel(i *persistence.Identity) *IdentityModel {
 	return &IdentityModel{
-		ID:        i.ID,
-		NetworkID: i.NetworkID,
-		SchemaID:  i.SchemaID,
-		Traits:    i.Traits,
-		CreatedAt: i.CreatedAt,
-		UpdatedAt: i.UpdatedAt,
+		ID:             i.ID,
+		NetworkID:      i.NetworkID,
+		Type:           i.Type,
+		SchemaID:       i.SchemaID,
+		SchemaVersion:  i.SchemaVersion,
+		Traits:         i.Traits,
+		MetadataPublic: i.MetadataPublic,
+		MetadataAdmin:  i.MetadataAdmin,
+		State:          i.State,
+		StateChangedAt: i.StateChangedAt,
+		CreatedAt:      i.CreatedAt,
+		UpdatedAt:      i.UpdatedAt,
+		DeletedAt:      i.DeletedAt,
 	}
 }
 
@@ -0,0 +1,117 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// PublicKeyModel represents a public key of an identity in the database.
+type PublicKeyModel struct {
+	ID         string     `gorm:"primaryKey;column:id"                                             json:"id"`
+	IdentityID string     `gorm:"column:identity_id;size:36;uniqueIndex:idx_public_key,priority:1" json:"identity_id"`
+	KeyID      string     `gorm:"column:key_id;size:128;uniqueIndex:idx_public_key,priority:2"     json:"key_id"`
+	Algorithm  string     `gorm:"column:algorithm;size:16"                                         json:"algorithm"`
+	Key        []byte     `gorm:"column:public_key"                                                json:"public_key"`
+	Name       string     `gorm:"column:name"                                                      json:"name"`
+	ExpiresAt  *time.Time `gorm:"column:expires_at"                                                json:"expires_at"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at"                                              json:"last_used_at"`
+	CreatedAt  time.Time  `gorm:"column:created_at"                                                json:"created_at"`
+}
+
+// TableName returns the table name for PublicKeyModel.
+func (PublicKeyModel) TableName() string {
+	return "iam_public_keys"
+}
+
+// PublicKeyPool implements persistence.PublicKeyPersister using GORM.
+type PublicKeyPool struct {
+	db *Persister
+}
+
+// NewPublicKeyPool creates a new public key pool.
+func NewPublicKeyPool(db *Persister) *PublicKeyPool {
+	return &PublicKeyPool{db: db}
+}
+
+// GetPublicKey retrieves a key by ID.
+func (p *PublicKeyPool) GetPublicKey(ctx context.Context, id string) (*persistence.PublicKey, error) {
+	var m PublicKeyModel
+	if err := p.db.Connection(ctx).Where("id = ?", id).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return p.modelToDomain(&m), nil
+}
+
+// ListPublicKeysByIdentityID lists the keys of an identity, oldest first.
+func (p *PublicKeyPool) ListPublicKeysByIdentityID(ctx context.Context, identityID string) ([]*persistence.PublicKey, error) {
+	var ms []PublicKeyModel
+	if err := p.db.Connection(ctx).
+		Where("identity_id = ?", identityID).
+		Order("created_at ASC").
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	keys := make([]*persistence.PublicKey, len(ms))
+	for i := range ms {
+		keys[i] = p.modelToDomain(&ms[i])
+	}
+	return keys, nil
+}
+
+// CreatePublicKey stores a new key.
+func (p *PublicKeyPool) CreatePublicKey(ctx context.Context, k *persistence.PublicKey) error {
+	return p.db.Connection(ctx).Create(&PublicKeyModel{
+		ID:         k.ID,
+		IdentityID: k.IdentityID,
+		KeyID:      k.KeyID,
+		Algorithm:  k.Algorithm,
+		Key:        k.Key,
+		Name:       k.Name,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		CreatedAt:  k.CreatedAt,
+	}).Error
+}
+
+// UpdatePublicKey writes the name and expiry of a key.
+func (p *PublicKeyPool) UpdatePublicKey(ctx context.Context, k *persistence.PublicKey) error {
+	return p.db.Connection(ctx).Model(&PublicKeyModel{}).
+		Where("id = ?", k.ID).
+		Select("name", "expires_at").
+		Updates(&PublicKeyModel{Name: k.Name, ExpiresAt: k.ExpiresAt}).Error
+}
+
+// UpdatePublicKeyLastUsed records when a key was last used.
+func (p *PublicKeyPool) UpdatePublicKeyLastUsed(ctx context.Context, id string, at time.Time) error {
+	return p.db.Connection(ctx).Model(&PublicKeyModel{}).
+		Where("id = ?", id).
+		Update("last_used_at", at).Error
+}
+
+// DeletePublicKey deletes a key.
+func (p *PublicKeyPool) DeletePublicKey(ctx context.Context, id string) error {
+	return p.db.Connection(ctx).Where("id = ?", id).Delete(&PublicKeyModel{}).Error
+}
+
+func (p *PublicKeyPool) modelToDomain(m *PublicKeyModel) *persistence.PublicKey {
+	return &persistence.PublicKey{
+		ID:         m.ID,
+		IdentityID: m.IdentityID,
+		KeyID:      m.KeyID,
+		Algorithm:  m.Algorithm,
+		Key:        m.Key,
+		Name:       m.Name,
+		ExpiresAt:  m.ExpiresAt,
+		LastUsedAt: m.LastUsedAt,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+// Ensure PublicKeyPool implements persistence.PublicKeyPersister.
+var _ persistence.PublicKeyPersister = (*PublicKeyPool)(nil)
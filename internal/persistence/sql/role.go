@@ -6,6 +6,7 @@ package sql
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/coding-hui/iam/internal/persistence"
@@ -17,6 +18,8 @@ type RoleModel struct {
 	NetworkID   string    `gorm:"column:nid;index"     json:"network_id"`
 	Name        string    `gorm:"column:name"          json:"name"`
 	Description string    `gorm:"column:description"   json:"description"`
+	InheritFrom []byte    `gorm:"column:inherit_from"  json:"inherit_from"`
+	Extra       []byte    `gorm:"column:extra"         json:"extra"`
 	CreatedAt   time.Time `gorm:"column:created_at"    json:"created_at"`
 	UpdatedAt   time.Time `gorm:"column:updated_at"    json:"updated_at"`
 }
@@ -26,6 +29,20 @@ func (RoleModel) TableName() string {
 	return "iam_roles"
 }
 
+// RoleBindingModel represents a role binding in the database.
+type RoleBindingModel struct {
+	ID        string    `gorm:"primaryKey;column:id"                                                  json:"id"`
+	NetworkID string    `gorm:"column:nid;index"                                                      json:"network_id"`
+	RoleID    string    `gorm:"column:role_id;size:36;uniqueIndex:idx_role_binding,priority:1"        json:"role_id"`
+	Subject   string    `gorm:"column:subject;size:255;uniqueIndex:idx_role_binding,priority:2;index" json:"subject"`
+	CreatedAt time.Time `gorm:"column:created_at"                                                     json:"created_at"`
+}
+
+// TableName returns the table name for RoleBindingModel.
+func (RoleBindingModel) TableName() string {
+	return "iam_role_bindings"
+}
+
 // RolePool implements persistence.RolePersister using GORM.
 type RolePool struct {
 	db *Persister
@@ -82,28 +99,98 @@ func (p *RolePool) UpdateRole(ctx context.Context, role *persistence.Role) error
 	return p.db.Connection(ctx).Model(m).Where("id = ?", role.ID).Updates(m).Error
 }
 
-// DeleteRole deletes a role.
+// DeleteRole deletes a role together with its bindings.
 func (p *RolePool) DeleteRole(ctx context.Context, id string) error {
-	return p.db.Connection(ctx).Where("id = ?", id).Delete(&RoleModel{}).Error
+	return p.db.Transaction(ctx, func(ctx context.Context) error {
+		if err := p.db.Connection(ctx).Where("role_id = ?", id).Delete(&RoleBindingModel{}).Error; err != nil {
+			return err
+		}
+		return p.db.Connection(ctx).Where("id = ?", id).Delete(&RoleModel{}).Error
+	})
+}
+
+// CreateRoleBinding grants a role to a subject.
+func (p *RolePool) CreateRoleBinding(ctx context.Context, binding *persistence.RoleBinding) error {
+	m := &RoleBindingModel{
+		ID:        binding.ID,
+		NetworkID: binding.NetworkID,
+		RoleID:    binding.RoleID,
+		Subject:   binding.Subject,
+		CreatedAt: binding.CreatedAt,
+	}
+	return p.db.Connection(ctx).Create(m).Error
+}
+
+// DeleteRoleBinding revokes a role from a subject.
+func (p *RolePool) DeleteRoleBinding(ctx context.Context, roleID, subject string) error {
+	return p.db.Connection(ctx).
+		Where("role_id = ? AND subject = ?", roleID, subject).
+		Delete(&RoleBindingModel{}).Error
+}
+
+// ListRoleBindings lists all role bindings of a network.
+func (p *RolePool) ListRoleBindings(ctx context.Context, networkID string) ([]*persistence.RoleBinding, error) {
+	return p.findRoleBindings(ctx, "nid = ?", networkID)
+}
+
+// ListRoleBindingsByRole lists the bindings of a role.
+func (p *RolePool) ListRoleBindingsByRole(ctx context.Context, roleID string) ([]*persistence.RoleBinding, error) {
+	return p.findRoleBindings(ctx, "role_id = ?", roleID)
+}
+
+// ListRoleBindingsBySubject lists the bindings of a subject in a network.
+func (p *RolePool) ListRoleBindingsBySubject(ctx context.Context, networkID, subject string) ([]*persistence.RoleBinding, error) {
+	return p.findRoleBindings(ctx, "nid = ? AND subject = ?", networkID, subject)
+}
+
+func (p *RolePool) findRoleBindings(ctx context.Context, query string, args ...any) ([]*persistence.RoleBinding, error) {
+	var ms []RoleBindingModel
+	if err := p.db.Connection(ctx).Where(query, args...).Order("created_at, id").Find(&ms).Error; err != nil {
+		return nil, err
+	}
+
+	bindings := make([]*persistence.RoleBinding, len(ms))
+	for i, m := range ms {
+		bindings[i] = &persistence.RoleBinding{
+			ID:        m.ID,
+			NetworkID: m.NetworkID,
+			RoleID:    m.RoleID,
+			Subject:   m.Subject,
+			CreatedAt: m.CreatedAt,
+		}
+	}
+	return bindings, nil
 }
 
 func (p *RolePool) modelToDomain(m *RoleModel) *persistence.Role {
+	var inheritFrom []string
+	if len(m.InheritFrom) > 0 {
+		_ = json.Unmarshal(m.InheritFrom, &inheritFrom)
+	}
 	return &persistence.Role{
 		ID:          m.ID,
 		NetworkID:   m.NetworkID,
 		Name:        m.Name,
 		Description: m.Description,
+		InheritFrom: inheritFrom,
+		Extra:       m.Extra,
 		CreatedAt:   m.CreatedAt,
 		UpdatedAt:   m.UpdatedAt,
 	}
 }
 
 func (p *RolePool) domainToModel(r *persistence.Role) *RoleModel {
+	var inheritFrom []byte
+	if r.InheritFrom != nil {
+		inheritFrom, _ = json.Marshal(r.InheritFrom)
+	}
 	return &RoleModel{
 		ID:          r.ID,
 		NetworkID:   r.NetworkID,
 		Name:        r.Name,
 		Description: r.Description,
+		InheritFrom: inheritFrom,
+		Extra:       r.Extra,
 		CreatedAt:   r.CreatedAt,
 		UpdatedAt:   r.UpdatedAt,
 	}
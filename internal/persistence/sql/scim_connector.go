@@ -0,0 +1,258 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// SCIMConnectorModel represents a downstream SCIM application in the
+// database.
+type SCIMConnectorModel struct {
+	ID            string     `gorm:"primaryKey;column:id"             json:"id"`
+	NetworkID     string     `gorm:"column:nid;size:36;index"         json:"network_id"`
+	Name          string     `gorm:"column:name"                      json:"name"`
+	BaseURL       string     `gorm:"column:base_url"                  json:"base_url"`
+	AuthType      string     `gorm:"column:auth_type;size:16"         json:"auth_type"`
+	AuthToken     string     `gorm:"column:auth_token"                json:"-"`
+	AuthUsername  string     `gorm:"column:auth_username"             json:"auth_username"`
+	AuthPassword  string     `gorm:"column:auth_password"             json:"-"`
+	Attributes    string     `gorm:"column:attributes;type:text"      json:"attributes"`
+	Filter        string     `gorm:"column:filter;type:text"          json:"filter"`
+	SyncGroups    bool       `gorm:"column:sync_groups"               json:"sync_groups"`
+	Enabled       bool       `gorm:"column:enabled"                   json:"enabled"`
+	LastSyncAt    *time.Time `gorm:"column:last_sync_at"              json:"last_sync_at"`
+	LastSyncError string     `gorm:"column:last_sync_error;type:text" json:"last_sync_error"`
+	CreatedAt     time.Time  `gorm:"column:created_at"                json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at"                json:"updated_at"`
+}
+
+// TableName returns the table name for SCIMConnectorModel.
+func (SCIMConnectorModel) TableName() string {
+	return "iam_scim_connectors"
+}
+
+// SCIMConnectorResourceModel represents the sync state of a resource of a
+// connector in the database.
+type SCIMConnectorResourceModel struct {
+	ID            string     `gorm:"primaryKey;column:id"                                                 json:"id"`
+	ConnectorID   string     `gorm:"column:connector_id;size:36;uniqueIndex:idx_scim_connector_resource"  json:"connector_id"`
+	ResourceType  string     `gorm:"column:resource_type;size:16;uniqueIndex:idx_scim_connector_resource" json:"resource_type"`
+	LocalID       string     `gorm:"column:local_id;size:36;uniqueIndex:idx_scim_connector_resource"      json:"local_id"`
+	RemoteID      string     `gorm:"column:remote_id"                                                     json:"remote_id"`
+	Hash          string     `gorm:"column:hash;size:64"                                                  json:"-"`
+	Status        string     `gorm:"column:status;size:16;index"                                          json:"status"`
+	Attempts      int        `gorm:"column:attempts"                                                      json:"attempts"`
+	LastError     string     `gorm:"column:last_error;type:text"                                          json:"last_error"`
+	NextAttemptAt *time.Time `gorm:"column:next_attempt_at"                                               json:"next_attempt_at"`
+	SyncedAt      *time.Time `gorm:"column:synced_at"                                                     json:"synced_at"`
+	CreatedAt     time.Time  `gorm:"column:created_at"                                                    json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at"                                                    json:"updated_at"`
+}
+
+// TableName returns the table name for SCIMConnectorResourceModel.
+func (SCIMConnectorResourceModel) TableName() string {
+	return "iam_scim_connector_resources"
+}
+
+// SCIMConnectorPool implements persistence.SCIMConnectorPersister using
+// GORM.
+type SCIMConnectorPool struct {
+	db *Persister
+}
+
+// NewSCIMConnectorPool creates a new SCIM connector pool.
+func NewSCIMConnectorPool(db *Persister) *SCIMConnectorPool {
+	return &SCIMConnectorPool{db: db}
+}
+
+// GetSCIMConnector retrieves a connector by ID.
+func (p *SCIMConnectorPool) GetSCIMConnector(ctx context.Context, id string) (*persistence.SCIMConnector, error) {
+	var m SCIMConnectorModel
+	if err := p.db.Connection(ctx).Where("id = ?", id).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return p.modelToDomain(&m), nil
+}
+
+// ListSCIMConnectors lists the connectors of a network, or of all networks
+// when networkID is empty, oldest first.
+func (p *SCIMConnectorPool) ListSCIMConnectors(ctx context.Context, networkID string) ([]*persistence.SCIMConnector, error) {
+	var ms []SCIMConnectorModel
+	query := p.db.Connection(ctx)
+	if networkID != "" {
+		query = query.Where("nid = ?", networkID)
+	}
+	if err := query.Order("created_at ASC").Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	connectors := make([]*persistence.SCIMConnector, len(ms))
+	for i := range ms {
+		connectors[i] = p.modelToDomain(&ms[i])
+	}
+	return connectors, nil
+}
+
+// CreateSCIMConnector stores a new connector.
+func (p *SCIMConnectorPool) CreateSCIMConnector(ctx context.Context, c *persistence.SCIMConnector) error {
+	return p.db.Connection(ctx).Create(p.domainToModel(c)).Error
+}
+
+// UpdateSCIMConnector updates the definition of a connector, leaving its
+// sync result alone.
+func (p *SCIMConnectorPool) UpdateSCIMConnector(ctx context.Context, c *persistence.SCIMConnector) error {
+	m := p.domainToModel(c)
+	return p.db.Connection(ctx).Model(m).Where("id = ?", c.ID).
+		Select("name", "base_url", "auth_type", "auth_token", "auth_username", "auth_password",
+			"attributes", "filter", "sync_groups", "enabled", "updated_at").
+		Updates(m).Error
+}
+
+// UpdateSCIMConnectorSync records the result of a sync of a connector.
+func (p *SCIMConnectorPool) UpdateSCIMConnectorSync(ctx context.Context, id string, at time.Time, syncErr string) error {
+	return p.db.Connection(ctx).Model(&SCIMConnectorModel{}).Where("id = ?", id).Updates(map[string]any{
+		"last_sync_at":    at,
+		"last_sync_error": syncErr,
+	}).Error
+}
+
+// DeleteSCIMConnector deletes a connector together with its resources.
+func (p *SCIMConnectorPool) DeleteSCIMConnector(ctx context.Context, id string) error {
+	return p.db.Transaction(ctx, func(ctx context.Context) error {
+		if err := p.db.Connection(ctx).Where("connector_id = ?", id).Delete(&SCIMConnectorResourceModel{}).Error; err != nil {
+			return err
+		}
+		return p.db.Connection(ctx).Where("id = ?", id).Delete(&SCIMConnectorModel{}).Error
+	})
+}
+
+// ListSCIMConnectorResources lists the resources of a connector, of any
+// status when status is empty, oldest first.
+func (p *SCIMConnectorPool) ListSCIMConnectorResources(ctx context.Context, connectorID, status string) ([]*persistence.SCIMConnectorResource, error) {
+	var ms []SCIMConnectorResourceModel
+	query := p.db.Connection(ctx).Where("connector_id = ?", connectorID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("created_at ASC").Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	resources := make([]*persistence.SCIMConnectorResource, len(ms))
+	for i := range ms {
+		resources[i] = connectorResourceToDomain(&ms[i])
+	}
+	return resources, nil
+}
+
+// CountSCIMConnectorResources counts the resources of a connector by type
+// and status.
+func (p *SCIMConnectorPool) CountSCIMConnectorResources(ctx context.Context, connectorID string) ([]*persistence.SCIMConnectorResourceCount, error) {
+	var counts []*persistence.SCIMConnectorResourceCount
+	if err := p.db.Connection(ctx).Model(&SCIMConnectorResourceModel{}).
+		Select("resource_type, status, COUNT(*) AS count").
+		Where("connector_id = ?", connectorID).
+		Group("resource_type, status").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// SaveSCIMConnectorResource creates or updates the sync state of a
+// resource.
+func (p *SCIMConnectorPool) SaveSCIMConnectorResource(ctx context.Context, r *persistence.SCIMConnectorResource) error {
+	return p.db.Connection(ctx).Save(&SCIMConnectorResourceModel{
+		ID:            r.ID,
+		ConnectorID:   r.ConnectorID,
+		ResourceType:  r.ResourceType,
+		LocalID:       r.LocalID,
+		RemoteID:      r.RemoteID,
+		Hash:          r.Hash,
+		Status:        r.Status,
+		Attempts:      r.Attempts,
+		LastError:     r.LastError,
+		NextAttemptAt: r.NextAttemptAt,
+		SyncedAt:      r.SyncedAt,
+		CreatedAt:     r.CreatedAt,
+		UpdatedAt:     r.UpdatedAt,
+	}).Error
+}
+
+// DeleteSCIMConnectorResource deletes the sync state of a resource.
+func (p *SCIMConnectorPool) DeleteSCIMConnectorResource(ctx context.Context, id string) error {
+	return p.db.Connection(ctx).Where("id = ?", id).Delete(&SCIMConnectorResourceModel{}).Error
+}
+
+// DeleteSCIMConnectorResources deletes the sync state of all resources of
+// a connector.
+func (p *SCIMConnectorPool) DeleteSCIMConnectorResources(ctx context.Context, connectorID string) error {
+	return p.db.Connection(ctx).Where("connector_id = ?", connectorID).Delete(&SCIMConnectorResourceModel{}).Error
+}
+
+func (p *SCIMConnectorPool) domainToModel(c *persistence.SCIMConnector) *SCIMConnectorModel {
+	return &SCIMConnectorModel{
+		ID:            c.ID,
+		NetworkID:     c.NetworkID,
+		Name:          c.Name,
+		BaseURL:       c.BaseURL,
+		AuthType:      c.AuthType,
+		AuthToken:     c.AuthToken,
+		AuthUsername:  c.AuthUsername,
+		AuthPassword:  c.AuthPassword,
+		Attributes:    string(c.Attributes),
+		Filter:        c.Filter,
+		SyncGroups:    c.SyncGroups,
+		Enabled:       c.Enabled,
+		LastSyncAt:    c.LastSyncAt,
+		LastSyncError: c.LastSyncError,
+		CreatedAt:     c.CreatedAt,
+		UpdatedAt:     c.UpdatedAt,
+	}
+}
+
+func (p *SCIMConnectorPool) modelToDomain(m *SCIMConnectorModel) *persistence.SCIMConnector {
+	return &persistence.SCIMConnector{
+		ID:            m.ID,
+		NetworkID:     m.NetworkID,
+		Name:          m.Name,
+		BaseURL:       m.BaseURL,
+		AuthType:      m.AuthType,
+		AuthToken:     m.AuthToken,
+		AuthUsername:  m.AuthUsername,
+		AuthPassword:  m.AuthPassword,
+		Attributes:    []byte(m.Attributes),
+		Filter:        m.Filter,
+		SyncGroups:    m.SyncGroups,
+		Enabled:       m.Enabled,
+		LastSyncAt:    m.LastSyncAt,
+		LastSyncError: m.LastSyncError,
+		CreatedAt:     m.CreatedAt,
+		UpdatedAt:     m.UpdatedAt,
+	}
+}
+
+func connectorResourceToDomain(m *SCIMConnectorResourceModel) *persistence.SCIMConnectorResource {
+	return &persistence.SCIMConnectorResource{
+		ID:            m.ID,
+		ConnectorID:   m.ConnectorID,
+		ResourceType:  m.ResourceType,
+		LocalID:       m.LocalID,
+		RemoteID:      m.RemoteID,
+		Hash:          m.Hash,
+		Status:        m.Status,
+		Attempts:      m.Attempts,
+		LastError:     m.LastError,
+		NextAttemptAt: m.NextAttemptAt,
+		SyncedAt:      m.SyncedAt,
+		CreatedAt:     m.CreatedAt,
+		UpdatedAt:     m.UpdatedAt,
+	}
+}
+
+// Ensure SCIMConnectorPool implements persistence.SCIMConnectorPersister.
+var _ persistence.SCIMConnectorPersister = (*SCIMConnectorPool)(nil)
@@ -0,0 +1,102 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// SCIMTokenModel represents a bearer token of a SCIM client in the database.
+type SCIMTokenModel struct {
+	ID        string     `gorm:"primaryKey;column:id"                  json:"id"`
+	NetworkID string     `gorm:"column:nid;size:36;index"              json:"network_id"`
+	Name      string     `gorm:"column:name"                           json:"name"`
+	TokenHash string     `gorm:"column:token_hash;size:64;uniqueIndex" json:"-"`
+	ExpiresAt *time.Time `gorm:"column:expires_at"                     json:"expires_at"`
+	CreatedAt time.Time  `gorm:"column:created_at"                     json:"created_at"`
+}
+
+// TableName returns the table name for SCIMTokenModel.
+func (SCIMTokenModel) TableName() string {
+	return "iam_scim_tokens"
+}
+
+// SCIMTokenPool implements persistence.SCIMTokenPersister using GORM.
+type SCIMTokenPool struct {
+	db *Persister
+}
+
+// NewSCIMTokenPool creates a new SCIM token pool.
+func NewSCIMTokenPool(db *Persister) *SCIMTokenPool {
+	return &SCIMTokenPool{db: db}
+}
+
+// GetSCIMToken retrieves a token by ID.
+func (p *SCIMTokenPool) GetSCIMToken(ctx context.Context, id string) (*persistence.SCIMToken, error) {
+	var m SCIMTokenModel
+	if err := p.db.Connection(ctx).Where("id = ?", id).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return p.modelToDomain(&m), nil
+}
+
+// GetSCIMTokenByHash retrieves a token by its hash.
+func (p *SCIMTokenPool) GetSCIMTokenByHash(ctx context.Context, tokenHash string) (*persistence.SCIMToken, error) {
+	var m SCIMTokenModel
+	if err := p.db.Connection(ctx).Where("token_hash = ?", tokenHash).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return p.modelToDomain(&m), nil
+}
+
+// ListSCIMTokens lists the tokens of a network, oldest first.
+func (p *SCIMTokenPool) ListSCIMTokens(ctx context.Context, networkID string) ([]*persistence.SCIMToken, error) {
+	var ms []SCIMTokenModel
+	if err := p.db.Connection(ctx).
+		Where("nid = ?", networkID).
+		Order("created_at ASC").
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	tokens := make([]*persistence.SCIMToken, len(ms))
+	for i := range ms {
+		tokens[i] = p.modelToDomain(&ms[i])
+	}
+	return tokens, nil
+}
+
+// CreateSCIMToken stores a new token.
+func (p *SCIMTokenPool) CreateSCIMToken(ctx context.Context, t *persistence.SCIMToken) error {
+	return p.db.Connection(ctx).Create(&SCIMTokenModel{
+		ID:        t.ID,
+		NetworkID: t.NetworkID,
+		Name:      t.Name,
+		TokenHash: t.TokenHash,
+		ExpiresAt: t.ExpiresAt,
+		CreatedAt: t.CreatedAt,
+	}).Error
+}
+
+// DeleteSCIMToken deletes a token.
+func (p *SCIMTokenPool) DeleteSCIMToken(ctx context.Context, id string) error {
+	return p.db.Connection(ctx).Where("id = ?", id).Delete(&SCIMTokenModel{}).Error
+}
+
+func (p *SCIMTokenPool) modelToDomain(m *SCIMTokenModel) *persistence.SCIMToken {
+	return &persistence.SCIMToken{
+		ID:        m.ID,
+		NetworkID: m.NetworkID,
+		Name:      m.Name,
+		TokenHash: m.TokenHash,
+		ExpiresAt: m.ExpiresAt,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+// Ensure SCIMTokenPool implements persistence.SCIMTokenPersister.
+var _ persistence.SCIMTokenPersister = (*SCIMTokenPool)(nil)
@@ -5,7 +5,10 @@
 package sql
 
 import (
+	"context"
 	"time"
+
+	"github.com/coding-hui/iam/internal/persistence"
 )
 
 // SecretKey represents a secret key in the database.
@@ -16,6 +19,7 @@ type SecretKey struct {
 	SecretHash string     `gorm:"column:secret_hash"        json:"secret_hash"`
 	Name       string     `gorm:"column:name"               json:"name"`
 	ExpiresAt  *time.Time `gorm:"column:expires_at"         json:"expires_at"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at"       json:"last_used_at"`
 	CreatedAt  time.Time  `gorm:"column:created_at"         json:"created_at"`
 }
 
@@ -23,3 +27,97 @@ type SecretKey struct {
 func (SecretKey) TableName() string {
 	return "iam_secret_keys"
 }
+
+// SecretKeyPool implements persistence.SecretKeyPersister using GORM.
+type SecretKeyPool struct {
+	db *Persister
+}
+
+// NewSecretKeyPool creates a new secret key pool.
+func NewSecretKeyPool(db *Persister) *SecretKeyPool {
+	return &SecretKeyPool{db: db}
+}
+
+// GetSecretKey retrieves a key by ID.
+func (p *SecretKeyPool) GetSecretKey(ctx context.Context, id string) (*persistence.SecretKey, error) {
+	var m SecretKey
+	if err := p.db.Connection(ctx).Where("id = ?", id).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return p.modelToDomain(&m), nil
+}
+
+// GetSecretKeyByKeyID retrieves a key by its key ID.
+func (p *SecretKeyPool) GetSecretKeyByKeyID(ctx context.Context, keyID string) (*persistence.SecretKey, error) {
+	var m SecretKey
+	if err := p.db.Connection(ctx).Where("key_id = ?", keyID).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return p.modelToDomain(&m), nil
+}
+
+// ListSecretKeysByIdentityID lists the keys of an identity, oldest first.
+func (p *SecretKeyPool) ListSecretKeysByIdentityID(ctx context.Context, identityID string) ([]*persistence.SecretKey, error) {
+	var ms []SecretKey
+	if err := p.db.Connection(ctx).
+		Where("identity_id = ?", identityID).
+		Order("created_at ASC").
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	keys := make([]*persistence.SecretKey, len(ms))
+	for i := range ms {
+		keys[i] = p.modelToDomain(&ms[i])
+	}
+	return keys, nil
+}
+
+// CreateSecretKey stores a new key.
+func (p *SecretKeyPool) CreateSecretKey(ctx context.Context, k *persistence.SecretKey) error {
+	return p.db.Connection(ctx).Create(&SecretKey{
+		ID:         k.ID,
+		IdentityID: k.IdentityID,
+		KeyID:      k.KeyID,
+		SecretHash: k.SecretHash,
+		Name:       k.Name,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		CreatedAt:  k.CreatedAt,
+	}).Error
+}
+
+// UpdateSecretKey writes the name and expiry of a key.
+func (p *SecretKeyPool) UpdateSecretKey(ctx context.Context, k *persistence.SecretKey) error {
+	return p.db.Connection(ctx).Model(&SecretKey{}).
+		Where("id = ?", k.ID).
+		Select("name", "expires_at").
+		Updates(&SecretKey{Name: k.Name, ExpiresAt: k.ExpiresAt}).Error
+}
+
+// UpdateSecretKeyLastUsed records when a key was last used.
+func (p *SecretKeyPool) UpdateSecretKeyLastUsed(ctx context.Context, id string, at time.Time) error {
+	return p.db.Connection(ctx).Model(&SecretKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", at).Error
+}
+
+// DeleteSecretKey deletes a key.
+func (p *SecretKeyPool) DeleteSecretKey(ctx context.Context, id string) error {
+	return p.db.Connection(ctx).Where("id = ?", id).Delete(&SecretKey{}).Error
+}
+
+func (p *SecretKeyPool) modelToDomain(m *SecretKey) *persistence.SecretKey {
+	return &persistence.SecretKey{
+		ID:         m.ID,
+		IdentityID: m.IdentityID,
+		KeyID:      m.KeyID,
+		SecretHash: m.SecretHash,
+		Name:       m.Name,
+		ExpiresAt:  m.ExpiresAt,
+		LastUsedAt: m.LastUsedAt,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+// Ensure SecretKeyPool implements persistence.SecretKeyPersister.
+var _ persistence.SecretKeyPersister = (*SecretKeyPool)(nil)
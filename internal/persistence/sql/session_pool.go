@@ -72,10 +72,11 @@ func (p *SessionPool) CreateSession(ctx context.Context, session *persistence.Se
 	return p.db.Connection(ctx).Create(m).Error
 }
 
-// UpdateSession updates a session.
+// UpdateSession updates a session. All columns are written so that a
+// session can be marked inactive.
 func (p *SessionPool) UpdateSession(ctx context.Context, session *persistence.Session) error {
 	m := p.domainToModel(session)
-	return p.db.Connection(ctx).Model(m).Where("id = ?", session.ID).Updates(m).Error
+	return p.db.Connection(ctx).Model(m).Where("id = ?", session.ID).Select("*").Updates(m).Error
 }
 
 // DeleteSession deletes a session.
@@ -54,6 +54,23 @@ func (p *TokenPool) GetTokenByValue(ctx context.Context, value string) (*persist
 	return p.modelToDomain(&m), nil
 }
 
+// ListTokensByIdentityID lists the tokens of an identity.
+func (p *TokenPool) ListTokensByIdentityID(ctx context.Context, identityID string) ([]*persistence.Token, error) {
+	var ms []TokenModel
+	if err := p.db.Connection(ctx).
+		Where("identity_id = ?", identityID).
+		Order("created_at DESC").
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+
+	tokens := make([]*persistence.Token, len(ms))
+	for i := range ms {
+		tokens[i] = p.modelToDomain(&ms[i])
+	}
+	return tokens, nil
+}
+
 // CreateToken creates a new token.
 func (p *TokenPool) CreateToken(ctx context.Context, token *persistence.Token) error {
 	m := p.domainToModel(token)
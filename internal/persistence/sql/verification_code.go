@@ -0,0 +1,131 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// VerificationCodeModel represents the pending verification of an address in the database.
+type VerificationCodeModel struct {
+	AddressID       string    `gorm:"primaryKey;column:address_id;size:36" json:"address_id"`
+	IdentityID      string    `gorm:"column:identity_id;size:36;index"     json:"identity_id"`
+	CodeHash        []byte    `gorm:"column:code_hash"                     json:"-"`
+	LinkHash        string    `gorm:"column:link_hash;size:64;uniqueIndex" json:"-"`
+	Attempts        int       `gorm:"column:attempts;not null;default:0"   json:"attempts"`
+	Sends           int       `gorm:"column:sends;not null;default:0"      json:"sends"`
+	WindowStartedAt time.Time `gorm:"column:window_started_at"             json:"window_started_at"`
+	ExpiresAt       time.Time `gorm:"column:expires_at"                    json:"expires_at"`
+	CreatedAt       time.Time `gorm:"column:created_at"                    json:"created_at"`
+}
+
+// TableName returns the table name for VerificationCodeModel.
+func (VerificationCodeModel) TableName() string {
+	return "iam_identity_verification_codes"
+}
+
+// VerificationCodePool implements persistence.VerificationCodePersister using GORM.
+type VerificationCodePool struct {
+	db *Persister
+}
+
+// NewVerificationCodePool creates a new verification code pool.
+func NewVerificationCodePool(db *Persister) *VerificationCodePool {
+	return &VerificationCodePool{db: db}
+}
+
+// GetVerificationCode retrieves the code of an address.
+func (p *VerificationCodePool) GetVerificationCode(ctx context.Context, addressID string) (*persistence.VerificationCode, error) {
+	var m VerificationCodeModel
+	if err := p.db.Connection(ctx).Where("address_id = ?", addressID).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return p.modelToDomain(&m), nil
+}
+
+// GetVerificationCodeByLink retrieves a code by the hash of its link token.
+func (p *VerificationCodePool) GetVerificationCodeByLink(ctx context.Context, linkHash string) (*persistence.VerificationCode, error) {
+	var m VerificationCodeModel
+	if err := p.db.Connection(ctx).Where("link_hash = ?", linkHash).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return p.modelToDomain(&m), nil
+}
+
+// SaveVerificationCode replaces the code of an address.
+func (p *VerificationCodePool) SaveVerificationCode(ctx context.Context, c *persistence.VerificationCode) error {
+	return p.db.Connection(ctx).Save(p.domainToModel(c)).Error
+}
+
+// ResendVerificationCode replaces the code of an address unless it was
+// sent again since it was read, keeping its attempts.
+func (p *VerificationCodePool) ResendVerificationCode(ctx context.Context, c *persistence.VerificationCode, prevLinkHash string) (bool, error) {
+	res := p.db.Connection(ctx).Model(&VerificationCodeModel{}).
+		Where("address_id = ? AND link_hash = ?", c.AddressID, prevLinkHash).
+		Updates(map[string]any{
+			"code_hash":  c.CodeHash,
+			"link_hash":  c.LinkHash,
+			"sends":      gorm.Expr("sends + 1"),
+			"expires_at": c.ExpiresAt,
+			"created_at": c.CreatedAt,
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// SpendVerificationAttempt counts an attempt to enter the code of an
+// address unless maxAttempts were made.
+func (p *VerificationCodePool) SpendVerificationAttempt(ctx context.Context, addressID string, maxAttempts int) (bool, error) {
+	res := p.db.Connection(ctx).Model(&VerificationCodeModel{}).
+		Where("address_id = ? AND attempts < ?", addressID, maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// DeleteVerificationCode deletes the code of an address.
+func (p *VerificationCodePool) DeleteVerificationCode(ctx context.Context, addressID string) error {
+	return p.db.Connection(ctx).Where("address_id = ?", addressID).Delete(&VerificationCodeModel{}).Error
+}
+
+func (p *VerificationCodePool) modelToDomain(m *VerificationCodeModel) *persistence.VerificationCode {
+	return &persistence.VerificationCode{
+		AddressID:       m.AddressID,
+		IdentityID:      m.IdentityID,
+		CodeHash:        m.CodeHash,
+		LinkHash:        m.LinkHash,
+		Attempts:        m.Attempts,
+		Sends:           m.Sends,
+		WindowStartedAt: m.WindowStartedAt,
+		ExpiresAt:       m.ExpiresAt,
+		CreatedAt:       m.CreatedAt,
+	}
+}
+
+func (p *VerificationCodePool) domainToModel(c *persistence.VerificationCode) *VerificationCodeModel {
+	return &VerificationCodeModel{
+		AddressID:       c.AddressID,
+		IdentityID:      c.IdentityID,
+		CodeHash:        c.CodeHash,
+		LinkHash:        c.LinkHash,
+		Attempts:        c.Attempts,
+		Sends:           c.Sends,
+		WindowStartedAt: c.WindowStartedAt,
+		ExpiresAt:       c.ExpiresAt,
+		CreatedAt:       c.CreatedAt,
+	}
+}
+
+// Ensure VerificationCodePool implements persistence.VerificationCodePersister.
+var _ persistence.VerificationCodePersister = (*VerificationCodePool)(nil)
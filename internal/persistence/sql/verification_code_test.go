@@ -0,0 +1,78 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+func TestSpendVerificationAttempt(t *testing.T) {
+	ctx := context.Background()
+	p := NewVerificationCodePool(newTestPersister(t))
+	c := &persistence.VerificationCode{AddressID: uuid.NewString(), LinkHash: "link", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := p.SaveVerificationCode(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var spent atomic.Int32
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := p.SpendVerificationAttempt(ctx, c.AddressID, 5)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				spent.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if spent.Load() != 5 {
+		t.Errorf("spent %d attempts, want 5", spent.Load())
+	}
+	if stored, _ := p.GetVerificationCode(ctx, c.AddressID); stored.Attempts != 5 {
+		t.Errorf("stored attempts = %d, want 5", stored.Attempts)
+	}
+}
+
+func TestResendVerificationCode(t *testing.T) {
+	ctx := context.Background()
+	p := NewVerificationCodePool(newTestPersister(t))
+	window := time.Now().Add(-time.Minute).UTC()
+	c := &persistence.VerificationCode{AddressID: uuid.NewString(), LinkHash: "first", Attempts: 3, Sends: 1, WindowStartedAt: window}
+	if err := p.SaveVerificationCode(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+
+	next := *c
+	next.LinkHash, next.CodeHash = "second", []byte("code")
+	if ok, err := p.ResendVerificationCode(ctx, &next, "first"); err != nil || !ok {
+		t.Fatalf("ResendVerificationCode() = %v, %v", ok, err)
+	}
+	stale := *c
+	stale.LinkHash = "third"
+	if ok, err := p.ResendVerificationCode(ctx, &stale, "first"); err != nil || ok {
+		t.Fatalf("ResendVerificationCode(stale) = %v, %v", ok, err)
+	}
+
+	stored, err := p.GetVerificationCode(ctx, c.AddressID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LinkHash != "second" || stored.Attempts != 3 || stored.Sends != 2 || !stored.WindowStartedAt.Equal(window) {
+		t.Errorf("stored code = %+v", stored)
+	}
+}
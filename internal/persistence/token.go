@@ -24,6 +24,7 @@ type Token struct {
 type TokenPersister interface {
 	GetToken(ctx context.Context, id string) (*Token, error)
 	GetTokenByValue(ctx context.Context, value string) (*Token, error)
+	ListTokensByIdentityID(ctx context.Context, identityID string) ([]*Token, error)
 	CreateToken(ctx context.Context, token *Token) error
 	DeleteToken(ctx context.Context, id string) error
 	DeleteExpiredTokens(ctx context.Context) error
@@ -0,0 +1,47 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package persistence
+
+import (
+	"context"
+	"time"
+)
+
+// VerificationCode represents the pending verification of an address.
+// Domain model with no persistence-specific tags (Ory style).
+type VerificationCode struct {
+	AddressID  string
+	IdentityID string
+	// CodeHash and LinkHash are SHA-256 hashes of the code and link token.
+	CodeHash []byte
+	LinkHash string
+	// Attempts and Sends count the codes entered and sent since
+	// WindowStartedAt; CreatedAt is when the code was last sent.
+	Attempts        int
+	Sends           int
+	WindowStartedAt time.Time
+	ExpiresAt       time.Time
+	CreatedAt       time.Time
+}
+
+// VerificationCodePersister defines the interface for verification code
+// persistence operations. An address has at most one code.
+type VerificationCodePersister interface {
+	GetVerificationCode(ctx context.Context, addressID string) (*VerificationCode, error)
+	GetVerificationCodeByLink(ctx context.Context, linkHash string) (*VerificationCode, error)
+	// SaveVerificationCode replaces the code of an address.
+	SaveVerificationCode(ctx context.Context, c *VerificationCode) error
+	// ResendVerificationCode replaces the code hashes and times of the
+	// code of an address and counts the send, keeping its attempts and
+	// window. It reports false without changes unless the stored code
+	// still has the link hash prevLinkHash, i.e. was not sent again since
+	// it was read.
+	ResendVerificationCode(ctx context.Context, c *VerificationCode, prevLinkHash string) (bool, error)
+	// SpendVerificationAttempt counts an attempt to enter the code of an
+	// address. It reports false without counting when maxAttempts were
+	// made.
+	SpendVerificationAttempt(ctx context.Context, addressID string, maxAttempts int) (bool, error)
+	DeleteVerificationCode(ctx context.Context, addressID string) error
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package connector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/coding-hui/iam/internal/scim"
+)
+
+// maxErrorBody bounds the part of error responses kept in errors.
+const maxErrorBody = 1 << 10
+
+// Client is a SCIM client of a downstream application.
+type Client struct {
+	baseURL string
+	auth    Auth
+	http    *http.Client
+}
+
+// NewClient creates a client of the SCIM application at baseURL.
+func NewClient(baseURL string, auth Auth, hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), auth: auth, http: hc}
+}
+
+// StatusError is returned for error responses of the application.
+type StatusError struct {
+	StatusCode int
+	ScimType   string
+	Detail     string
+}
+
+// Error implements error.
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("SCIM request failed with status %d", e.StatusCode)
+	if e.ScimType != "" {
+		msg += " (" + e.ScimType + ")"
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// IsStatus reports whether err is a StatusError with the status code.
+func IsStatus(err error, statusCode int) bool {
+	var e *StatusError
+	return errors.As(err, &e) && e.StatusCode == statusCode
+}
+
+// Create creates a resource at an endpoint, Users or Groups, and returns
+// its ID.
+func (c *Client) Create(ctx context.Context, endpoint string, resource any) (string, error) {
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/"+endpoint, resource, &created); err != nil {
+		return "", err
+	}
+	if created.ID == "" {
+		return "", errors.New("SCIM response lacks the id of the created resource")
+	}
+	return created.ID, nil
+}
+
+// Replace replaces a resource.
+func (c *Client) Replace(ctx context.Context, endpoint, id string, resource any) error {
+	return c.do(ctx, http.MethodPut, "/"+endpoint+"/"+url.PathEscape(id), resource, nil)
+}
+
+// Delete deletes a resource.
+func (c *Client) Delete(ctx context.Context, endpoint, id string) error {
+	return c.do(ctx, http.MethodDelete, "/"+endpoint+"/"+url.PathEscape(id), nil, nil)
+}
+
+// Find returns the ID of the first resource of an endpoint matching a
+// filter, or an empty ID.
+func (c *Client) Find(ctx context.Context, endpoint, filter string) (string, error) {
+	var list struct {
+		Resources []struct {
+			ID string `json:"id"`
+		} `json:"Resources"`
+	}
+	query := url.Values{"filter": {filter}, "count": {"1"}}
+	if err := c.do(ctx, http.MethodGet, "/"+endpoint+"?"+query.Encode(), nil, &list); err != nil {
+		return "", err
+	}
+	if len(list.Resources) == 0 {
+		return "", nil
+	}
+	return list.Resources[0].ID, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", scim.ContentType)
+	if body != nil {
+		req.Header.Set("Content-Type", scim.ContentType)
+	}
+	switch c.auth.Type {
+	case AuthBearer:
+		req.Header.Set("Authorization", "Bearer "+c.auth.Token)
+	case AuthBasic:
+		req.SetBasicAuth(c.auth.Username, c.auth.Password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		e := &StatusError{StatusCode: resp.StatusCode}
+		var msg scim.Error
+		if json.Unmarshal(data, &msg) == nil && (msg.Detail != "" || msg.ScimType != "") {
+			e.ScimType, e.Detail = msg.ScimType, msg.Detail
+		} else {
+			e.Detail = strings.TrimSpace(string(data))
+		}
+		return e
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode SCIM response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package connector provisions identities and roles to downstream
+// applications over SCIM 2.0. A connector pushes the identities of its
+// network as users and, optionally, its roles as groups, and reconciles
+// them periodically: changed resources are pushed again, resources gone
+// locally are deleted downstream, and failures are retried with backoff.
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Auth types of connectors.
+const (
+	AuthBearer = "bearer"
+	AuthBasic  = "basic"
+)
+
+// Types of provisioned resources.
+const (
+	ResourceUser  = "User"
+	ResourceGroup = "Group"
+)
+
+// Status is the sync status of a provisioned resource.
+type Status string
+
+// Sync statuses.
+const (
+	StatusSynced Status = "synced"
+	StatusFailed Status = "failed"
+)
+
+const (
+	// DefaultSyncInterval is how often connectors are reconciled.
+	DefaultSyncInterval = 5 * time.Minute
+	// DefaultTimeout bounds requests to downstream applications.
+	DefaultTimeout = 30 * time.Second
+	// MinRetryDelay is how long a resource that failed to sync waits
+	// before it is retried; the delay doubles with every failure up to
+	// MaxRetryDelay.
+	MinRetryDelay = 30 * time.Second
+	// MaxRetryDelay is the longest delay between retries.
+	MaxRetryDelay = time.Hour
+)
+
+// Manager defines the interface for managing connectors and syncing them.
+type Manager interface {
+	CreateConnector(ctx context.Context, req *CreateConnectorRequest) (*Connector, error)
+	GetConnector(ctx context.Context, id uuid.UUID) (*Connector, error)
+	ListConnectors(ctx context.Context, networkID uuid.UUID) ([]*Connector, error)
+	UpdateConnector(ctx context.Context, id uuid.UUID, req *UpdateConnectorRequest) (*Connector, error)
+	DeleteConnector(ctx context.Context, id uuid.UUID) error
+
+	// Sync reconciles a connector right away. Resources failing to sync
+	// are reported by the returned status rather than as an error.
+	Sync(ctx context.Context, id uuid.UUID) (*SyncStatus, error)
+	// SyncAll reconciles every enabled connector.
+	SyncAll(ctx context.Context) error
+	GetStatus(ctx context.Context, id uuid.UUID) (*SyncStatus, error)
+	// ListResources lists the provisioned resources of a connector, of
+	// any status when status is empty.
+	ListResources(ctx context.Context, id uuid.UUID, status Status) ([]*Resource, error)
+}
+
+// Connector is a downstream application provisioned over SCIM.
+type Connector struct {
+	ID        uuid.UUID `json:"id"`
+	NetworkID uuid.UUID `json:"network_id"`
+	Name      string    `json:"name"`
+	// BaseURL is the SCIM base URL of the application, the one the Users
+	// and Groups endpoints are relative to.
+	BaseURL string `json:"base_url"`
+	Auth    Auth   `json:"auth"`
+	// Attributes overrides entries of scim.DefaultAttributes, the mapping
+	// of user attributes to traits. externalId is always the identity ID.
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Filter selects the identities to provision, in the syntax of
+	// identity list filters; all identities of the network when empty.
+	Filter string `json:"filter,omitempty"`
+	// SyncGroups provisions the roles of the network as groups.
+	SyncGroups    bool       `json:"sync_groups"`
+	Enabled       bool       `json:"enabled"`
+	LastSyncAt    *time.Time `json:"last_sync_at,omitempty"`
+	LastSyncError string     `json:"last_sync_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Auth holds the credentials of a connector: a bearer token, or a username
+// and password for basic authentication.
+type Auth struct {
+	Type     string `json:"type"`
+	Token    string `json:"token,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// MarshalJSON leaves the token and password out.
+func (a Auth) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type     string `json:"type"`
+		Username string `json:"username,omitempty"`
+	}{a.Type, a.Username})
+}
+
+// Resource is the sync state of an identity or role provisioned by a
+// connector.
+type Resource struct {
+	ID          uuid.UUID `json:"id"`
+	ConnectorID uuid.UUID `json:"connector_id"`
+	Type        string    `json:"type"`
+	// LocalID is the ID of the identity or role.
+	LocalID string `json:"local_id"`
+	// RemoteID is the ID of the resource in the application.
+	RemoteID string `json:"remote_id,omitempty"`
+	// Hash is the hash of the resource last pushed.
+	Hash          string     `json:"-"`
+	Status        Status     `json:"status"`
+	Attempts      int        `json:"attempts,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	SyncedAt      *time.Time `json:"synced_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// SyncStatus is the sync status of a connector.
+type SyncStatus struct {
+	ConnectorID uuid.UUID `json:"connector_id"`
+	Enabled     bool      `json:"enabled"`
+	// Running tells whether the connector is being synced.
+	Running       bool       `json:"running"`
+	LastSyncAt    *time.Time `json:"last_sync_at,omitempty"`
+	LastSyncError string     `json:"last_sync_error,omitempty"`
+	Users         Counts     `json:"users"`
+	Groups        Counts     `json:"groups"`
+}
+
+// Counts holds the number of resources by sync status.
+type Counts struct {
+	Synced int `json:"synced"`
+	Failed int `json:"failed"`
+}
+
+// CreateConnectorRequest holds data for creating a connector.
+type CreateConnectorRequest struct {
+	NetworkID  uuid.UUID         `json:"network_id"`
+	Name       string            `json:"name"`
+	BaseURL    string            `json:"base_url"`
+	Auth       Auth              `json:"auth"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Filter     string            `json:"filter,omitempty"`
+	SyncGroups bool              `json:"sync_groups"`
+	// Enabled defaults to true.
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// UpdateConnectorRequest holds data for updating a connector; fields left
+// out are kept. Changing the base URL forgets the provisioned resources,
+// so that they are created again in the new application.
+type UpdateConnectorRequest struct {
+	Name       string            `json:"name,omitempty"`
+	BaseURL    string            `json:"base_url,omitempty"`
+	Auth       *Auth             `json:"auth,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Filter     *string           `json:"filter,omitempty"`
+	SyncGroups *bool             `json:"sync_groups,omitempty"`
+	Enabled    *bool             `json:"enabled,omitempty"`
+}
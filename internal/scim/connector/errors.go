@@ -0,0 +1,19 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package connector
+
+import "errors"
+
+var (
+	// ErrConnectorNotFound is returned when a connector is not found.
+	ErrConnectorNotFound = errors.New("SCIM connector not found")
+
+	// ErrInvalidConnector is returned for malformed connector definitions.
+	ErrInvalidConnector = errors.New("invalid SCIM connector")
+
+	// ErrSyncInProgress is returned when a connector is synced while it
+	// is being synced already.
+	ErrSyncInProgress = errors.New("SCIM connector sync in progress")
+)
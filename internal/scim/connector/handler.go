@@ -0,0 +1,185 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package connector
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/pkg/api"
+)
+
+// Handler handles HTTP requests for SCIM connector operations.
+type Handler struct {
+	manager Manager
+}
+
+// NewHandler creates a new connector handler.
+func NewHandler(manager Manager) *Handler {
+	return &Handler{manager: manager}
+}
+
+// Create handles POST /api/v1/scim/connectors.
+func (h *Handler) Create(c *gin.Context) {
+	var req CreateConnectorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+
+	conn, err := h.manager.CreateConnector(c.Request.Context(), &req)
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithData(conn, c)
+}
+
+// Get handles GET /api/v1/scim/connectors/:id.
+func (h *Handler) Get(c *gin.Context) {
+	id, ok := connectorID(c)
+	if !ok {
+		return
+	}
+
+	conn, err := h.manager.GetConnector(c.Request.Context(), id)
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithData(conn, c)
+}
+
+// List handles GET /api/v1/scim/connectors.
+func (h *Handler) List(c *gin.Context) {
+	networkID, err := uuid.Parse(c.GetString("network_id"))
+	if err != nil {
+		networkID = uuid.Nil
+	}
+
+	connectors, err := h.manager.ListConnectors(c.Request.Context(), networkID)
+	if err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(connectors, c)
+}
+
+// Update handles PATCH /api/v1/scim/connectors/:id.
+func (h *Handler) Update(c *gin.Context) {
+	id, ok := connectorID(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateConnectorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+
+	conn, err := h.manager.UpdateConnector(c.Request.Context(), id, &req)
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithData(conn, c)
+}
+
+// Delete handles DELETE /api/v1/scim/connectors/:id.
+func (h *Handler) Delete(c *gin.Context) {
+	id, ok := connectorID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.manager.DeleteConnector(c.Request.Context(), id); err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.Ok(c)
+}
+
+// Sync handles POST /api/v1/scim/connectors/:id/sync.
+func (h *Handler) Sync(c *gin.Context) {
+	id, ok := connectorID(c)
+	if !ok {
+		return
+	}
+
+	status, err := h.manager.Sync(c.Request.Context(), id)
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithData(status, c)
+}
+
+// Status handles GET /api/v1/scim/connectors/:id/status.
+func (h *Handler) Status(c *gin.Context) {
+	id, ok := connectorID(c)
+	if !ok {
+		return
+	}
+
+	status, err := h.manager.GetStatus(c.Request.Context(), id)
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithData(status, c)
+}
+
+// Resources handles GET /api/v1/scim/connectors/:id/resources, optionally
+// filtered by ?status=synced|failed.
+func (h *Handler) Resources(c *gin.Context) {
+	id, ok := connectorID(c)
+	if !ok {
+		return
+	}
+	status := Status(c.Query("status"))
+	if status != "" && status != StatusSynced && status != StatusFailed {
+		api.FailWithMessage("status must be synced or failed", c)
+		return
+	}
+
+	resources, err := h.manager.ListResources(c.Request.Context(), id, status)
+	if err != nil {
+		fail(err, c)
+		return
+	}
+
+	api.OkWithData(resources, c)
+}
+
+// connectorID parses the connector ID of the path, answering the request
+// when it is invalid.
+func connectorID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// fail reports a missing connector, an invalid definition or a sync in
+// progress by message and other errors by code.
+func fail(err error, c *gin.Context) {
+	if errors.Is(err, ErrConnectorNotFound) || errors.Is(err, ErrInvalidConnector) || errors.Is(err, ErrSyncInProgress) {
+		api.FailWithMessage(err.Error(), c)
+		return
+	}
+	api.FailWithErrCode(err, c)
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/authz/role"
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/scim"
+)
+
+// ManagerImpl implements connector.Manager.
+type ManagerImpl struct {
+	pool         PrivilegedPool
+	identityPool identity.Pool
+	rolePool     role.Pool
+	client       *http.Client
+	now          func() time.Time
+
+	mu      sync.Mutex
+	running map[uuid.UUID]bool
+}
+
+// NewManagerImpl creates a new connector manager provisioning the
+// identities and roles of the pools. Requests to applications time out
+// after DefaultTimeout until another timeout is set, see SetTimeout.
+func NewManagerImpl(pool PrivilegedPool, identityPool identity.Pool, rolePool role.Pool) *ManagerImpl {
+	return &ManagerImpl{
+		pool:         pool,
+		identityPool: identityPool,
+		rolePool:     rolePool,
+		client:       &http.Client{Timeout: DefaultTimeout},
+		now:          time.Now,
+		running:      make(map[uuid.UUID]bool),
+	}
+}
+
+// SetTimeout sets the timeout of requests to applications.
+func (m *ManagerImpl) SetTimeout(d time.Duration) {
+	m.client = &http.Client{Timeout: d}
+}
+
+// CreateConnector creates a connector.
+func (m *ManagerImpl) CreateConnector(ctx context.Context, req *CreateConnectorRequest) (*Connector, error) {
+	now := m.now().UTC()
+	c := &Connector{
+		ID:         uuid.New(),
+		NetworkID:  req.NetworkID,
+		Name:       req.Name,
+		BaseURL:    req.BaseURL,
+		Auth:       req.Auth,
+		Attributes: req.Attributes,
+		Filter:     req.Filter,
+		SyncGroups: req.SyncGroups,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := validate(c); err != nil {
+		return nil, err
+	}
+	if err := m.pool.CreateConnector(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetConnector retrieves a connector by ID.
+func (m *ManagerImpl) GetConnector(ctx context.Context, id uuid.UUID) (*Connector, error) {
+	return m.pool.GetConnector(ctx, id)
+}
+
+// ListConnectors lists the connectors of a network.
+func (m *ManagerImpl) ListConnectors(ctx context.Context, networkID uuid.UUID) ([]*Connector, error) {
+	return m.pool.ListConnectors(ctx, &networkID)
+}
+
+// UpdateConnector updates a connector.
+func (m *ManagerImpl) UpdateConnector(ctx context.Context, id uuid.UUID, req *UpdateConnectorRequest) (*Connector, error) {
+	c, err := m.pool.GetConnector(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	baseURL := c.BaseURL
+	if req.Name != "" {
+		c.Name = req.Name
+	}
+	if req.BaseURL != "" {
+		c.BaseURL = req.BaseURL
+	}
+	if req.Auth != nil {
+		c.Auth = *req.Auth
+	}
+	if req.Attributes != nil {
+		c.Attributes = req.Attributes
+	}
+	if req.Filter != nil {
+		c.Filter = *req.Filter
+	}
+	if req.SyncGroups != nil {
+		c.SyncGroups = *req.SyncGroups
+	}
+	if req.Enabled != nil {
+		c.Enabled = *req.Enabled
+	}
+	if err := validate(c); err != nil {
+		return nil, err
+	}
+	c.UpdatedAt = m.now().UTC()
+
+	if err := m.pool.UpdateConnector(ctx, c); err != nil {
+		return nil, err
+	}
+	if c.BaseURL != baseURL {
+		// The resources provisioned belong to the former application.
+		if err := m.pool.DeleteResources(ctx, c.ID); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// DeleteConnector deletes a connector. Resources it provisioned are left
+// in the application.
+func (m *ManagerImpl) DeleteConnector(ctx context.Context, id uuid.UUID) error {
+	if _, err := m.pool.GetConnector(ctx, id); err != nil {
+		return err
+	}
+	return m.pool.DeleteConnector(ctx, id)
+}
+
+// GetStatus returns the sync status of a connector.
+func (m *ManagerImpl) GetStatus(ctx context.Context, id uuid.UUID) (*SyncStatus, error) {
+	c, err := m.pool.GetConnector(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	users, groups, err := m.pool.CountResources(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	running := m.running[id]
+	m.mu.Unlock()
+
+	return &SyncStatus{
+		ConnectorID:   c.ID,
+		Enabled:       c.Enabled,
+		Running:       running,
+		LastSyncAt:    c.LastSyncAt,
+		LastSyncError: c.LastSyncError,
+		Users:         users,
+		Groups:        groups,
+	}, nil
+}
+
+// ListResources lists the provisioned resources of a connector.
+func (m *ManagerImpl) ListResources(ctx context.Context, id uuid.UUID, status Status) ([]*Resource, error) {
+	if _, err := m.pool.GetConnector(ctx, id); err != nil {
+		return nil, err
+	}
+	return m.pool.ListResources(ctx, id, status)
+}
+
+// Sync reconciles a connector, whether enabled or not, and records the
+// result.
+func (m *ManagerImpl) Sync(ctx context.Context, id uuid.UUID) (*SyncStatus, error) {
+	c, err := m.pool.GetConnector(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.run(ctx, c); err != nil {
+		return nil, err
+	}
+	return m.GetStatus(ctx, id)
+}
+
+// run syncs a connector unless it is being synced already.
+func (m *ManagerImpl) run(ctx context.Context, c *Connector) error {
+	m.mu.Lock()
+	if m.running[c.ID] {
+		m.mu.Unlock()
+		return ErrSyncInProgress
+	}
+	m.running[c.ID] = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, c.ID)
+		m.mu.Unlock()
+	}()
+
+	syncErr := m.sync(ctx, c)
+	msg := ""
+	if syncErr != nil {
+		msg = syncErr.Error()
+	}
+	if err := m.pool.UpdateSyncResult(ctx, c.ID, m.now().UTC(), msg); err != nil {
+		return err
+	}
+	var failed *failedError
+	if errors.As(syncErr, &failed) {
+		return nil
+	}
+	return syncErr
+}
+
+// SyncAll reconciles every enabled connector, skipping those being synced
+// already.
+func (m *ManagerImpl) SyncAll(ctx context.Context) error {
+	connectors, err := m.pool.ListConnectors(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, c := range connectors {
+		if !c.Enabled {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := m.run(ctx, c); err != nil && !errors.Is(err, ErrSyncInProgress) {
+			errs = append(errs, fmt.Errorf("connector %s: %w", c.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validate checks the definition of a connector.
+func validate(c *Connector) error {
+	if c.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidConnector)
+	}
+	u, err := url.Parse(c.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: base_url must be an absolute http(s) URL", ErrInvalidConnector)
+	}
+	switch c.Auth.Type {
+	case AuthBearer:
+		if c.Auth.Token == "" {
+			return fmt.Errorf("%w: auth.token is required", ErrInvalidConnector)
+		}
+	case AuthBasic:
+		if c.Auth.Username == "" {
+			return fmt.Errorf("%w: auth.username is required", ErrInvalidConnector)
+		}
+	default:
+		return fmt.Errorf("%w: auth.type must be %s or %s", ErrInvalidConnector, AuthBearer, AuthBasic)
+	}
+	if err := scim.ValidateAttributes(c.Attributes); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConnector, err)
+	}
+	if _, err := identity.NewListFilter(identity.ListIdentitiesParams{Filter: c.Filter}); err != nil {
+		return fmt.Errorf("%w: filter: %v", ErrInvalidConnector, err)
+	}
+	return nil
+}
+
+// Ensure ManagerImpl implements Manager.
+var _ Manager = (*ManagerImpl)(nil)
@@ -0,0 +1,265 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// Pool defines the interface for reading connectors and the sync state of
+// their resources. Missing connectors are reported as ErrConnectorNotFound.
+type Pool interface {
+	GetConnector(ctx context.Context, id uuid.UUID) (*Connector, error)
+	// ListConnectors lists the connectors of a network, or of all networks
+	// when networkID is nil.
+	ListConnectors(ctx context.Context, networkID *uuid.UUID) ([]*Connector, error)
+	ListResources(ctx context.Context, connectorID uuid.UUID, status Status) ([]*Resource, error)
+	CountResources(ctx context.Context, connectorID uuid.UUID) (users, groups Counts, err error)
+}
+
+// PrivilegedPool defines the interface for writing connectors and the sync
+// state of their resources.
+type PrivilegedPool interface {
+	Pool
+
+	CreateConnector(ctx context.Context, c *Connector) error
+	UpdateConnector(ctx context.Context, c *Connector) error
+	UpdateSyncResult(ctx context.Context, id uuid.UUID, at time.Time, syncErr string) error
+	DeleteConnector(ctx context.Context, id uuid.UUID) error
+
+	SaveResource(ctx context.Context, r *Resource) error
+	DeleteResource(ctx context.Context, id uuid.UUID) error
+	DeleteResources(ctx context.Context, connectorID uuid.UUID) error
+}
+
+// pool implements PrivilegedPool using persistence.SCIMConnectorPersister.
+type pool struct {
+	persister persistence.SCIMConnectorPersister
+}
+
+// NewPool creates a new connector pool.
+func NewPool(p persistence.SCIMConnectorPersister) Pool {
+	return &pool{persister: p}
+}
+
+// NewPrivilegedPool creates a new connector privileged pool.
+func NewPrivilegedPool(p persistence.SCIMConnectorPersister) PrivilegedPool {
+	return &pool{persister: p}
+}
+
+// GetConnector retrieves a connector by ID.
+func (p *pool) GetConnector(ctx context.Context, id uuid.UUID) (*Connector, error) {
+	m, err := p.persister.GetSCIMConnector(ctx, id.String())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConnectorNotFound
+		}
+		return nil, err
+	}
+	return modelToDomain(m), nil
+}
+
+// ListConnectors lists the connectors of a network, or of all networks,
+// oldest first.
+func (p *pool) ListConnectors(ctx context.Context, networkID *uuid.UUID) ([]*Connector, error) {
+	nid := ""
+	if networkID != nil {
+		nid = networkID.String()
+	}
+	ms, err := p.persister.ListSCIMConnectors(ctx, nid)
+	if err != nil {
+		return nil, err
+	}
+	connectors := make([]*Connector, len(ms))
+	for i, m := range ms {
+		connectors[i] = modelToDomain(m)
+	}
+	return connectors, nil
+}
+
+// ListResources lists the resources of a connector, oldest first.
+func (p *pool) ListResources(ctx context.Context, connectorID uuid.UUID, status Status) ([]*Resource, error) {
+	ms, err := p.persister.ListSCIMConnectorResources(ctx, connectorID.String(), string(status))
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]*Resource, len(ms))
+	for i, m := range ms {
+		resources[i] = resourceToDomain(m)
+	}
+	return resources, nil
+}
+
+// CountResources counts the users and groups of a connector by status.
+func (p *pool) CountResources(ctx context.Context, connectorID uuid.UUID) (users, groups Counts, err error) {
+	counts, err := p.persister.CountSCIMConnectorResources(ctx, connectorID.String())
+	if err != nil {
+		return Counts{}, Counts{}, err
+	}
+	for _, c := range counts {
+		counts := &users
+		if c.ResourceType == ResourceGroup {
+			counts = &groups
+		}
+		switch Status(c.Status) {
+		case StatusSynced:
+			counts.Synced += c.Count
+		case StatusFailed:
+			counts.Failed += c.Count
+		}
+	}
+	return users, groups, nil
+}
+
+// CreateConnector stores a new connector.
+func (p *pool) CreateConnector(ctx context.Context, c *Connector) error {
+	m, err := domainToModel(c)
+	if err != nil {
+		return err
+	}
+	return p.persister.CreateSCIMConnector(ctx, m)
+}
+
+// UpdateConnector updates the definition of a connector.
+func (p *pool) UpdateConnector(ctx context.Context, c *Connector) error {
+	m, err := domainToModel(c)
+	if err != nil {
+		return err
+	}
+	return p.persister.UpdateSCIMConnector(ctx, m)
+}
+
+// UpdateSyncResult records the result of a sync of a connector.
+func (p *pool) UpdateSyncResult(ctx context.Context, id uuid.UUID, at time.Time, syncErr string) error {
+	return p.persister.UpdateSCIMConnectorSync(ctx, id.String(), at, syncErr)
+}
+
+// DeleteConnector deletes a connector together with its resources.
+func (p *pool) DeleteConnector(ctx context.Context, id uuid.UUID) error {
+	return p.persister.DeleteSCIMConnector(ctx, id.String())
+}
+
+// SaveResource creates or updates the sync state of a resource.
+func (p *pool) SaveResource(ctx context.Context, r *Resource) error {
+	return p.persister.SaveSCIMConnectorResource(ctx, &persistence.SCIMConnectorResource{
+		ID:            r.ID.String(),
+		ConnectorID:   r.ConnectorID.String(),
+		ResourceType:  r.Type,
+		LocalID:       r.LocalID,
+		RemoteID:      r.RemoteID,
+		Hash:          r.Hash,
+		Status:        string(r.Status),
+		Attempts:      r.Attempts,
+		LastError:     r.LastError,
+		NextAttemptAt: r.NextAttemptAt,
+		SyncedAt:      r.SyncedAt,
+		CreatedAt:     r.CreatedAt,
+		UpdatedAt:     r.UpdatedAt,
+	})
+}
+
+// DeleteResource deletes the sync state of a resource.
+func (p *pool) DeleteResource(ctx context.Context, id uuid.UUID) error {
+	return p.persister.DeleteSCIMConnectorResource(ctx, id.String())
+}
+
+// DeleteResources deletes the sync state of all resources of a connector.
+func (p *pool) DeleteResources(ctx context.Context, connectorID uuid.UUID) error {
+	return p.persister.DeleteSCIMConnectorResources(ctx, connectorID.String())
+}
+
+func domainToModel(c *Connector) (*persistence.SCIMConnector, error) {
+	var attrs []byte
+	if len(c.Attributes) > 0 {
+		var err error
+		if attrs, err = json.Marshal(c.Attributes); err != nil {
+			return nil, err
+		}
+	}
+	return &persistence.SCIMConnector{
+		ID:            c.ID.String(),
+		NetworkID:     c.NetworkID.String(),
+		Name:          c.Name,
+		BaseURL:       c.BaseURL,
+		AuthType:      c.Auth.Type,
+		AuthToken:     c.Auth.Token,
+		AuthUsername:  c.Auth.Username,
+		AuthPassword:  c.Auth.Password,
+		Attributes:    attrs,
+		Filter:        c.Filter,
+		SyncGroups:    c.SyncGroups,
+		Enabled:       c.Enabled,
+		LastSyncAt:    c.LastSyncAt,
+		LastSyncError: c.LastSyncError,
+		CreatedAt:     c.CreatedAt,
+		UpdatedAt:     c.UpdatedAt,
+	}, nil
+}
+
+func modelToDomain(m *persistence.SCIMConnector) *Connector {
+	c := &Connector{
+		ID:        parseUUID(m.ID),
+		NetworkID: parseUUID(m.NetworkID),
+		Name:      m.Name,
+		BaseURL:   m.BaseURL,
+		Auth: Auth{
+			Type:     m.AuthType,
+			Token:    m.AuthToken,
+			Username: m.AuthUsername,
+			Password: m.AuthPassword,
+		},
+		Filter:        m.Filter,
+		SyncGroups:    m.SyncGroups,
+		Enabled:       m.Enabled,
+		LastSyncAt:    m.LastSyncAt,
+		LastSyncError: m.LastSyncError,
+		CreatedAt:     m.CreatedAt,
+		UpdatedAt:     m.UpdatedAt,
+	}
+	if len(m.Attributes) > 0 {
+		_ = json.Unmarshal(m.Attributes, &c.Attributes)
+	}
+	return c
+}
+
+func resourceToDomain(m *persistence.SCIMConnectorResource) *Resource {
+	return &Resource{
+		ID:            parseUUID(m.ID),
+		ConnectorID:   parseUUID(m.ConnectorID),
+		Type:          m.ResourceType,
+		LocalID:       m.LocalID,
+		RemoteID:      m.RemoteID,
+		Hash:          m.Hash,
+		Status:        Status(m.Status),
+		Attempts:      m.Attempts,
+		LastError:     m.LastError,
+		NextAttemptAt: m.NextAttemptAt,
+		SyncedAt:      m.SyncedAt,
+		CreatedAt:     m.CreatedAt,
+		UpdatedAt:     m.UpdatedAt,
+	}
+}
+
+func parseUUID(s string) uuid.UUID {
+	if s == "" {
+		return uuid.Nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+// Ensure pool implements PrivilegedPool.
+var _ PrivilegedPool = (*pool)(nil)
@@ -0,0 +1,379 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package connector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/coding-hui/iam/internal/authz/role"
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/scim"
+)
+
+// pageSize is the number of identities or roles loaded at a time.
+const pageSize = 100
+
+// sync pushes the identities and roles of a connector to its application
+// and deletes there those gone. Resources failing to sync are reported by
+// a *failedError once the others are synced.
+func (m *ManagerImpl) sync(ctx context.Context, c *Connector) error {
+	records, err := m.pool.ListResources(ctx, c.ID, "")
+	if err != nil {
+		return err
+	}
+	s := newSyncer(m.pool, NewClient(c.BaseURL, c.Auth, m.client), c.ID, records, m.now().UTC())
+
+	users, err := m.users(ctx, c)
+	if err != nil {
+		return err
+	}
+	for _, d := range users {
+		if err := s.push(ctx, d); err != nil {
+			return err
+		}
+	}
+	if c.SyncGroups {
+		groups, err := m.groups(ctx, c, s)
+		if err != nil {
+			return err
+		}
+		for _, d := range groups {
+			if err := s.push(ctx, d); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.prune(ctx, func(r *Resource) (bool, error) {
+		return m.gone(ctx, c, r)
+	}); err != nil {
+		return err
+	}
+	return s.err()
+}
+
+// users returns the users the identities of a connector should be.
+func (m *ManagerImpl) users(ctx context.Context, c *Connector) ([]*desired, error) {
+	f, err := identity.NewListFilter(identity.ListIdentitiesParams{Filter: c.Filter, Sort: "created_at"})
+	if err != nil {
+		return nil, err
+	}
+	attrs := scim.MergeAttributes(c.Attributes)
+
+	var users []*desired
+	for offset := 0; ; offset += pageSize {
+		idents, _, err := m.identityPool.ListIdentities(ctx, c.NetworkID, pageSize, offset, f)
+		if err != nil {
+			return nil, err
+		}
+		for _, ident := range idents {
+			u := scim.UserFromTraits(ident.Traits, attrs)
+			u.ExternalID = ident.ID.String()
+			active := ident.State.IsActive()
+			u.Active = &active
+
+			d := &desired{typ: ResourceUser, localID: ident.ID.String(), resource: u}
+			if u.UserName != "" {
+				d.filter = "userName eq " + strconv.Quote(u.UserName)
+			}
+			users = append(users, d)
+		}
+		if len(idents) < pageSize {
+			return users, nil
+		}
+	}
+}
+
+// groups returns the groups the roles of a connector should be. Members
+// are limited to the identities provisioned.
+func (m *ManagerImpl) groups(ctx context.Context, c *Connector, s *syncer) ([]*desired, error) {
+	var roles []*role.Role
+	for {
+		page, total, err := m.rolePool.ListRoles(ctx, c.NetworkID, pageSize, len(roles))
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, page...)
+		if len(page) < pageSize || len(roles) >= total {
+			break
+		}
+	}
+	bindings, err := m.rolePool.ListRoleBindings(ctx, c.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[uuid.UUID][]scim.Member)
+	for _, b := range bindings {
+		if id := s.remoteID(ResourceUser, b.Subject); id != "" {
+			members[b.RoleID] = append(members[b.RoleID], scim.Member{Value: id})
+		}
+	}
+
+	groups := make([]*desired, 0, len(roles))
+	for _, r := range roles {
+		g := &scim.Group{
+			Schemas:     []string{scim.SchemaGroup},
+			ExternalID:  r.ID.String(),
+			DisplayName: r.Name,
+			Members:     members[r.ID],
+		}
+		sort.Slice(g.Members, func(i, j int) bool { return g.Members[i].Value < g.Members[j].Value })
+		groups = append(groups, &desired{
+			typ:      ResourceGroup,
+			localID:  r.ID.String(),
+			resource: g,
+			filter:   "displayName eq " + strconv.Quote(r.Name),
+		})
+	}
+	return groups, nil
+}
+
+// gone reports whether the identity or role of a resource is no longer to
+// be provisioned. It guards against identities and roles missed while
+// paging through them.
+func (m *ManagerImpl) gone(ctx context.Context, c *Connector, r *Resource) (bool, error) {
+	switch r.Type {
+	case ResourceUser:
+		f, err := identity.NewListFilter(identity.ListIdentitiesParams{
+			Filter:  c.Filter,
+			Filters: map[string]string{"id": r.LocalID},
+		})
+		if err != nil {
+			return false, err
+		}
+		_, total, err := m.identityPool.ListIdentities(ctx, c.NetworkID, 1, 0, f)
+		if err != nil {
+			return false, err
+		}
+		return total == 0, nil
+	case ResourceGroup:
+		id, err := uuid.Parse(r.LocalID)
+		if !c.SyncGroups || err != nil {
+			return true, nil
+		}
+		_, err = m.rolePool.GetRoleByNetworkID(ctx, c.NetworkID, id)
+		if errors.Is(err, role.ErrRoleNotFound) || errors.Is(err, gorm.ErrRecordNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// desired is a resource as it should be in the application.
+type desired struct {
+	typ      string
+	localID  string
+	resource any
+	// filter finds the resource in the application when creating it
+	// conflicts with an existing one.
+	filter string
+}
+
+// syncer pushes resources to an application and records their sync state.
+type syncer struct {
+	pool        PrivilegedPool
+	client      *Client
+	connectorID uuid.UUID
+	now         time.Time
+	records     map[string]*Resource
+	seen        map[string]bool
+	failed      []error
+}
+
+func newSyncer(pool PrivilegedPool, client *Client, connectorID uuid.UUID, records []*Resource, now time.Time) *syncer {
+	s := &syncer{
+		pool:        pool,
+		client:      client,
+		connectorID: connectorID,
+		now:         now,
+		records:     make(map[string]*Resource, len(records)),
+		seen:        make(map[string]bool),
+	}
+	for _, r := range records {
+		s.records[resourceKey(r.Type, r.LocalID)] = r
+	}
+	return s
+}
+
+// push creates or replaces a resource in the application unless it did
+// not change since it was last pushed, or failed and awaits its retry.
+func (s *syncer) push(ctx context.Context, d *desired) error {
+	key := resourceKey(d.typ, d.localID)
+	s.seen[key] = true
+
+	data, err := json.Marshal(d.resource)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	r := s.records[key]
+	if r != nil && ((r.Status == StatusSynced && r.Hash == hash) || !s.due(r)) {
+		return nil
+	}
+	if r == nil {
+		r = &Resource{
+			ID:          uuid.New(),
+			ConnectorID: s.connectorID,
+			Type:        d.typ,
+			LocalID:     d.localID,
+			CreatedAt:   s.now,
+		}
+		s.records[key] = r
+	}
+
+	remoteID, err := s.upsert(ctx, d, r.RemoteID)
+	if err == nil {
+		r.RemoteID, r.Hash = remoteID, hash
+	}
+	return s.record(ctx, r, err)
+}
+
+// upsert replaces the resource remoteID or, when it is unknown or gone,
+// creates the resource. A resource that exists already is adopted.
+func (s *syncer) upsert(ctx context.Context, d *desired, remoteID string) (string, error) {
+	endpoint := endpointOf(d.typ)
+	if remoteID != "" {
+		err := s.client.Replace(ctx, endpoint, remoteID, d.resource)
+		if !IsStatus(err, http.StatusNotFound) {
+			return remoteID, err
+		}
+	}
+
+	id, err := s.client.Create(ctx, endpoint, d.resource)
+	if !IsStatus(err, http.StatusConflict) || d.filter == "" {
+		return id, err
+	}
+	found, ferr := s.client.Find(ctx, endpoint, d.filter)
+	if ferr != nil {
+		return "", ferr
+	}
+	if found == "" {
+		return "", err
+	}
+	return found, s.client.Replace(ctx, endpoint, found, d.resource)
+}
+
+// prune deletes from the application the resources that were not pushed
+// and are gone, and forgets them.
+func (s *syncer) prune(ctx context.Context, gone func(r *Resource) (bool, error)) error {
+	keys := make([]string, 0, len(s.records))
+	for key := range s.records {
+		if !s.seen[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		r := s.records[key]
+		if !s.due(r) {
+			continue
+		}
+		if ok, err := gone(r); err != nil || !ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if r.RemoteID != "" {
+			err := s.client.Delete(ctx, endpointOf(r.Type), r.RemoteID)
+			if err != nil && !IsStatus(err, http.StatusNotFound) {
+				if err := s.record(ctx, r, err); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if err := s.pool.DeleteResource(ctx, r.ID); err != nil {
+			return err
+		}
+		delete(s.records, key)
+	}
+	return nil
+}
+
+// record stores the outcome of syncing a resource. Failures schedule a
+// retry.
+func (s *syncer) record(ctx context.Context, r *Resource, err error) error {
+	r.UpdatedAt = s.now
+	if err != nil {
+		s.failed = append(s.failed, fmt.Errorf("%s %s: %w", r.Type, r.LocalID, err))
+		next := s.now.Add(retryDelay(r.Attempts + 1))
+		r.Status, r.Attempts, r.LastError, r.NextAttemptAt = StatusFailed, r.Attempts+1, err.Error(), &next
+	} else {
+		now := s.now
+		r.Status, r.Attempts, r.LastError, r.NextAttemptAt, r.SyncedAt = StatusSynced, 0, "", nil, &now
+	}
+	return s.pool.SaveResource(ctx, r)
+}
+
+// due reports whether a resource may be synced, i.e. does not await a
+// retry.
+func (s *syncer) due(r *Resource) bool {
+	return r.NextAttemptAt == nil || !r.NextAttemptAt.After(s.now)
+}
+
+// remoteID returns the ID in the application of a resource pushed, or an
+// empty ID when it was not provisioned or is about to be deleted.
+func (s *syncer) remoteID(typ, localID string) string {
+	key := resourceKey(typ, localID)
+	if r := s.records[key]; r != nil && s.seen[key] {
+		return r.RemoteID
+	}
+	return ""
+}
+
+// err returns a *failedError when resources failed to sync.
+func (s *syncer) err() error {
+	if len(s.failed) == 0 {
+		return nil
+	}
+	return &failedError{errs: s.failed}
+}
+
+// failedError reports the resources that failed to sync.
+type failedError struct {
+	errs []error
+}
+
+// Error implements error.
+func (e *failedError) Error() string {
+	if len(e.errs) == 1 {
+		return "1 resource failed to sync: " + e.errs[0].Error()
+	}
+	return fmt.Sprintf("%d resources failed to sync, first: %v", len(e.errs), e.errs[0])
+}
+
+// retryDelay returns the delay before retrying a resource after failures.
+func retryDelay(failures int) time.Duration {
+	d := MinRetryDelay
+	for i := 1; i < failures && d < MaxRetryDelay; i++ {
+		d *= 2
+	}
+	return min(d, MaxRetryDelay)
+}
+
+func resourceKey(typ, localID string) string {
+	return typ + "/" + localID
+}
+
+// endpointOf returns the endpoint of a resource type.
+func endpointOf(typ string) string {
+	return typ + "s"
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/scim"
+)
+
+// standIn is an in-memory SCIM application keeping users by userName and
+// groups by displayName.
+type standIn struct {
+	mu        sync.Mutex
+	resources map[string]map[string]map[string]any // endpoint -> id -> resource
+	requests  int
+	down      bool
+}
+
+func newStandIn() *standIn {
+	return &standIn{resources: map[string]map[string]map[string]any{"Users": {}, "Groups": {}}}
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if s.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	endpoint, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/scim/v2/"), "/")
+	resources := s.resources[endpoint]
+	key := map[string]string{"Users": "userName", "Groups": "displayName"}[endpoint]
+	var body map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		// Only supports the filters the syncer sends, e.g. userName eq "ann".
+		_, value, _ := strings.Cut(r.URL.Query().Get("filter"), " eq ")
+		list := []any{}
+		for _, res := range resources {
+			if fmt.Sprintf("%q", res[key]) == value {
+				list = append(list, res)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"Resources": list})
+	case r.Method == http.MethodPost:
+		for _, res := range resources {
+			if res[key] == body[key] {
+				w.WriteHeader(http.StatusConflict)
+				_ = json.NewEncoder(w).Encode(scim.Error{Status: "409", ScimType: "uniqueness", Detail: "taken"})
+				return
+			}
+		}
+		body["id"] = uuid.NewString()
+		resources[body["id"].(string)] = body
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(body)
+	case resources[id] == nil:
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodPut:
+		body["id"] = id
+		resources[id] = body
+		_ = json.NewEncoder(w).Encode(body)
+	case r.Method == http.MethodDelete:
+		delete(resources, id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// find returns the resource of an endpoint with a userName or displayName.
+func (s *standIn) find(endpoint, name string) map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, res := range s.resources[endpoint] {
+		if res["userName"] == name || res["displayName"] == name {
+			return res
+		}
+	}
+	return nil
+}
+
+// memoryPool keeps the sync state of resources in memory.
+type memoryPool struct {
+	PrivilegedPool
+	resources map[uuid.UUID]*Resource
+}
+
+func (p *memoryPool) SaveResource(_ context.Context, r *Resource) error {
+	copied := *r
+	p.resources[r.ID] = &copied
+	return nil
+}
+
+func (p *memoryPool) DeleteResource(_ context.Context, id uuid.UUID) error {
+	delete(p.resources, id)
+	return nil
+}
+
+func TestSync(t *testing.T) {
+	app := newStandIn()
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := NewClient(srv.URL+"/scim/v2/", Auth{Type: AuthBearer, Token: "secret"}, srv.Client())
+	pool := &memoryPool{resources: map[uuid.UUID]*Resource{}}
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	user := func(id, userName string) *desired {
+		return &desired{
+			typ:      ResourceUser,
+			localID:  id,
+			resource: &scim.User{Schemas: []string{scim.SchemaUser}, UserName: userName, ExternalID: id},
+			filter:   fmt.Sprintf("userName eq %q", userName),
+		}
+	}
+	// run syncs the users and a group of all of them, deleting the rest.
+	run := func(users ...*desired) *syncer {
+		t.Helper()
+		records := make([]*Resource, 0, len(pool.resources))
+		for _, r := range pool.resources {
+			copied := *r
+			records = append(records, &copied)
+		}
+		s := newSyncer(pool, client, uuid.Nil, records, now)
+		for _, d := range users {
+			if err := s.push(ctx, d); err != nil {
+				t.Fatal(err)
+			}
+		}
+		g := &scim.Group{Schemas: []string{scim.SchemaGroup}, DisplayName: "eng"}
+		for _, d := range users {
+			if id := s.remoteID(ResourceUser, d.localID); id != "" {
+				g.Members = append(g.Members, scim.Member{Value: id})
+			}
+		}
+		if err := s.push(ctx, &desired{typ: ResourceGroup, localID: "g1", resource: g}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.prune(ctx, func(*Resource) (bool, error) { return true, nil }); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	status := func(localID string) *Resource {
+		for _, r := range pool.resources {
+			if r.LocalID == localID {
+				return r
+			}
+		}
+		return nil
+	}
+
+	// Carol was provisioned before the connector existed and is adopted.
+	app.resources["Users"]["c0"] = map[string]any{"id": "c0", "userName": "carol"}
+
+	if err := run(user("u1", "ann"), user("u2", "bob"), user("u3", "carol")).err(); err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+	if len(app.resources["Users"]) != 3 || app.find("Users", "carol")["externalId"] != "u3" {
+		t.Fatalf("users = %v, want ann, bob and adopted carol", app.resources["Users"])
+	}
+	if r := status("u3"); r.RemoteID != "c0" || r.Status != StatusSynced {
+		t.Errorf("carol = %+v, want synced as c0", r)
+	}
+	if members := app.find("Groups", "eng")["members"].([]any); len(members) != 3 {
+		t.Errorf("group members = %v, want 3", members)
+	}
+
+	// Unchanged resources are not pushed again.
+	app.requests = 0
+	run(user("u1", "ann"), user("u2", "bob"), user("u3", "carol"))
+	if app.requests != 0 {
+		t.Errorf("unchanged sync made %d requests, want 0", app.requests)
+	}
+
+	// Failures are retried once their delay has passed.
+	app.down = true
+	if err := run(user("u1", "anna"), user("u2", "bob"), user("u3", "carol")).err(); err == nil {
+		t.Fatal("sync with the application down succeeded")
+	}
+	r := status("u1")
+	if r.Status != StatusFailed || r.Attempts != 1 || !r.NextAttemptAt.Equal(now.Add(MinRetryDelay)) {
+		t.Fatalf("failed user = %+v, want a retry after %s", r, MinRetryDelay)
+	}
+	app.down = false
+	app.requests = 0
+	run(user("u1", "anna"), user("u2", "bob"), user("u3", "carol"))
+	if app.requests != 0 || app.find("Users", "anna") != nil {
+		t.Errorf("sync before the retry delay made %d requests", app.requests)
+	}
+	now = now.Add(MinRetryDelay)
+	if err := run(user("u1", "anna"), user("u2", "bob"), user("u3", "carol")).err(); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if r := status("u1"); app.find("Users", "anna") == nil || r.Status != StatusSynced || r.Attempts != 0 {
+		t.Errorf("retried user = %+v, want synced", r)
+	}
+
+	// Resources deleted in the application are created again, and those
+	// gone locally are deleted there.
+	delete(app.resources["Users"], status("u2").RemoteID)
+	run(user("u1", "anna"), user("u2", "bobby"))
+	if app.find("Users", "bobby") == nil || app.find("Users", "carol") != nil || status("u3") != nil {
+		t.Errorf("users = %v, want anna and bobby", app.resources["Users"])
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for failures, want := range map[int]time.Duration{
+		1:  MinRetryDelay,
+		2:  2 * MinRetryDelay,
+		4:  8 * MinRetryDelay,
+		20: MaxRetryDelay,
+	} {
+		if got := retryDelay(failures); got != want {
+			t.Errorf("retryDelay(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func TestAuthMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(Auth{Type: AuthBasic, Username: "svc", Password: "secret", Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("Auth marshals to %s, want secrets left out", data)
+	}
+}
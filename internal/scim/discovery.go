@@ -0,0 +1,177 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package scim
+
+// ServiceProviderConfig describes the features of the service provider.
+type ServiceProviderConfig struct {
+	Schemas               []string               `json:"schemas"`
+	DocumentationURI      string                 `json:"documentationUri,omitempty"`
+	Patch                 Supported              `json:"patch"`
+	Bulk                  BulkSupport            `json:"bulk"`
+	Filter                FilterSupport          `json:"filter"`
+	ChangePassword        Supported              `json:"changePassword"`
+	Sort                  Supported              `json:"sort"`
+	ETag                  Supported              `json:"etag"`
+	AuthenticationSchemes []AuthenticationScheme `json:"authenticationSchemes"`
+	Meta                  *Meta                  `json:"meta,omitempty"`
+}
+
+// Supported tells whether a feature is supported.
+type Supported struct {
+	Supported bool `json:"supported"`
+}
+
+// BulkSupport describes the support of bulk requests.
+type BulkSupport struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+// FilterSupport describes the support of filters.
+type FilterSupport struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+// AuthenticationScheme describes a way for clients to authenticate.
+type AuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary,omitempty"`
+}
+
+// ResourceType describes the endpoint of a resource type.
+type ResourceType struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Endpoint    string   `json:"endpoint"`
+	Description string   `json:"description"`
+	Schema      string   `json:"schema"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Schema describes the attributes of a resource type.
+type Schema struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Attributes  []Attribute `json:"attributes"`
+	Meta        *Meta       `json:"meta,omitempty"`
+}
+
+// Attribute describes an attribute of a schema.
+type Attribute struct {
+	Name           string      `json:"name"`
+	Type           string      `json:"type"`
+	MultiValued    bool        `json:"multiValued"`
+	Description    string      `json:"description,omitempty"`
+	Required       bool        `json:"required"`
+	CaseExact      bool        `json:"caseExact"`
+	Mutability     string      `json:"mutability"`
+	Returned       string      `json:"returned"`
+	Uniqueness     string      `json:"uniqueness"`
+	SubAttributes  []Attribute `json:"subAttributes,omitempty"`
+	ReferenceTypes []string    `json:"referenceTypes,omitempty"`
+}
+
+// NewServiceProviderConfig returns the features of the service provider.
+func NewServiceProviderConfig() *ServiceProviderConfig {
+	return &ServiceProviderConfig{
+		Schemas:        []string{SchemaServiceProviderConfig},
+		Patch:          Supported{Supported: true},
+		Filter:         FilterSupport{Supported: true, MaxResults: MaxCount},
+		ChangePassword: Supported{Supported: true},
+		AuthenticationSchemes: []AuthenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "OAuth Bearer Token",
+			Description: "Authentication with a SCIM token of the network",
+			Primary:     true,
+		}},
+	}
+}
+
+// NewResourceTypes returns the resource types, users and groups.
+func NewResourceTypes() []*ResourceType {
+	return []*ResourceType{
+		{
+			Schemas:     []string{SchemaResourceType},
+			ID:          "User",
+			Name:        "User",
+			Endpoint:    "/Users",
+			Description: "Identities",
+			Schema:      SchemaUser,
+		},
+		{
+			Schemas:     []string{SchemaResourceType},
+			ID:          "Group",
+			Name:        "Group",
+			Endpoint:    "/Groups",
+			Description: "Roles and their bindings",
+			Schema:      SchemaGroup,
+		},
+	}
+}
+
+// NewSchemas returns the schemas of users and groups, limited to the
+// supported attributes.
+func NewSchemas() []*Schema {
+	str := func(name string) Attribute {
+		return Attribute{Name: name, Type: "string", Mutability: "readWrite", Returned: "default", Uniqueness: "none"}
+	}
+	multi := func(name string, sub ...Attribute) Attribute {
+		a := Attribute{Name: name, Type: "complex", MultiValued: true, Mutability: "readWrite", Returned: "default", Uniqueness: "none"}
+		a.SubAttributes = sub
+		return a
+	}
+	primary := Attribute{Name: "primary", Type: "boolean", Mutability: "readWrite", Returned: "default", Uniqueness: "none"}
+
+	userName := str("userName")
+	userName.Required, userName.Uniqueness = true, "server"
+	password := str("password")
+	password.Mutability, password.Returned = "writeOnly", "never"
+	groups := multi("groups", str("value"), str("$ref"), str("display"), str("type"))
+	groups.Mutability = "readOnly"
+	for i := range groups.SubAttributes {
+		groups.SubAttributes[i].Mutability = "readOnly"
+	}
+	displayName := str("displayName")
+	displayName.Required = true
+
+	return []*Schema{
+		{
+			Schemas:     []string{SchemaSchema},
+			ID:          SchemaUser,
+			Name:        "User",
+			Description: "User Account",
+			Attributes: []Attribute{
+				userName,
+				{
+					Name: "name", Type: "complex", Mutability: "readWrite", Returned: "default", Uniqueness: "none",
+					SubAttributes: []Attribute{str("formatted"), str("familyName"), str("givenName")},
+				},
+				str("displayName"),
+				{Name: "active", Type: "boolean", Mutability: "readWrite", Returned: "default", Uniqueness: "none"},
+				password,
+				multi("emails", str("value"), str("type"), primary),
+				multi("phoneNumbers", str("value"), str("type"), primary),
+				groups,
+			},
+		},
+		{
+			Schemas:     []string{SchemaSchema},
+			ID:          SchemaGroup,
+			Name:        "Group",
+			Description: "Group",
+			Attributes: []Attribute{
+				displayName,
+				multi("members", str("value"), str("$ref"), str("type")),
+			},
+		},
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package scim
+
+import "errors"
+
+var (
+	// ErrTokenInvalid is returned for unknown and expired tokens.
+	ErrTokenInvalid = errors.New("SCIM token is invalid or expired")
+
+	// ErrTokenNotFound is returned when a token is not found.
+	ErrTokenNotFound = errors.New("SCIM token not found")
+
+	// ErrNotFound is returned when a user or group is not found.
+	ErrNotFound = errors.New("resource not found")
+
+	// ErrUniqueness is returned when a userName or group displayName is
+	// taken.
+	ErrUniqueness = errors.New("resource already exists")
+
+	// ErrInvalidValue is returned for missing or malformed attribute
+	// values.
+	ErrInvalidValue = errors.New("invalid attribute value")
+
+	// ErrInvalidSyntax is returned for malformed requests.
+	ErrInvalidSyntax = errors.New("invalid request syntax")
+
+	// ErrInvalidPath is returned for malformed or unsupported PATCH paths.
+	ErrInvalidPath = errors.New("invalid path")
+
+	// ErrNoTarget is returned when a PATCH path matches no value.
+	ErrNoTarget = errors.New("path matches no value")
+
+	// ErrMutability is returned when a PATCH changes a read-only
+	// attribute.
+	ErrMutability = errors.New("attribute is read-only")
+)
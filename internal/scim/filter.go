@@ -0,0 +1,305 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coding-hui/iam/pkg/filter"
+)
+
+// coreSchemaPrefixes are the prefixes of fully qualified attribute names
+// of the core schemas, in lower case.
+var coreSchemaPrefixes = []string{
+	strings.ToLower(SchemaUser) + ":",
+	strings.ToLower(SchemaGroup) + ":",
+}
+
+// parseFilter parses a SCIM filter. Attributes qualified with a core
+// schema URN lose the URN, and value filters such as
+// emails[type eq "work" and value co "@example.com"] are flattened into
+// conditions on sub-attributes, so that they may match different values
+// of a multi-valued attribute. Errors wrap filter.ErrInvalidFilter.
+func parseFilter(s string) (*filter.Expr, error) {
+	var b strings.Builder
+	start, inString := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == ']':
+			return nil, fmt.Errorf("%w: unexpected ] at offset %d", filter.ErrInvalidFilter, i)
+		case c == '[':
+			j := i
+			for j > start && isPathByte(s[j-1]) {
+				j--
+			}
+			end := closingBracket(s, i)
+			if j == i || end < 0 {
+				return nil, fmt.Errorf("%w: malformed value filter at offset %d", filter.ErrInvalidFilter, i)
+			}
+			e, err := filter.Parse(s[i+1 : end])
+			if err != nil {
+				return nil, err
+			}
+			attr := s[j:i]
+			_ = e.Walk(func(c *filter.Expr) error {
+				c.Attr = attr + "." + c.Attr
+				return nil
+			})
+			b.WriteString(s[start:j])
+			b.WriteString("(" + e.String() + ")")
+			start, i = end+1, end
+		default:
+			if n := coreSchemaPrefix(s[i:]); n > 0 && (i == 0 || !isPathByte(s[i-1])) {
+				b.WriteString(s[start:i])
+				start, i = i+n, i+n-1
+			}
+		}
+	}
+	b.WriteString(s[start:])
+	return filter.Parse(b.String())
+}
+
+// coreSchemaPrefix returns the length of the core schema prefix s starts
+// with, or 0.
+func coreSchemaPrefix(s string) int {
+	for _, prefix := range coreSchemaPrefixes {
+		if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+			return len(prefix)
+		}
+	}
+	return 0
+}
+
+// closingBracket returns the index of the ] closing the value filter
+// opened at i, or -1.
+func closingBracket(s string, i int) int {
+	inString := false
+	for i++; i < len(s); i++ {
+		switch c := s[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case !inString && c == '[':
+			return -1
+		case !inString && c == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func isPathByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-' || c == '$' || c == '.'
+}
+
+// userFilter rewrites a user filter in place into an identity filter, see
+// identity.NewListFilter, using the attribute mapping attrs.
+func userFilter(e *filter.Expr, attrs map[string]string) error {
+	return e.Walk(func(c *filter.Expr) error {
+		attr := strings.ToLower(c.Attr)
+		switch attr {
+		case "id":
+			c.Attr = "id"
+			return nil
+		case "meta.created":
+			c.Attr = "created_at"
+			return nil
+		case "meta.lastmodified":
+			c.Attr = "updated_at"
+			return nil
+		case "active":
+			return activeFilter(c)
+		}
+		attr = strings.TrimSuffix(attr, ".value")
+		for name, path := range attrs {
+			if strings.EqualFold(name, attr) && path != "" {
+				c.Attr = "traits." + path
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: unsupported attribute %q", filter.ErrInvalidFilter, c.Attr)
+	})
+}
+
+// activeFilter rewrites a condition on active into one on the state of
+// identities.
+func activeFilter(c *filter.Expr) error {
+	c.Attr = "state"
+	if c.Op == filter.Pr {
+		return nil
+	}
+	active, ok := c.Value.(bool)
+	if !ok || (c.Op != filter.Eq && c.Op != filter.Ne) {
+		return fmt.Errorf("%w: active only supports eq and ne with a boolean", filter.ErrInvalidFilter)
+	}
+	if !active {
+		if c.Op == filter.Eq {
+			c.Op = filter.Ne
+		} else {
+			c.Op = filter.Eq
+		}
+	}
+	c.Value = "active"
+	return nil
+}
+
+// match reports whether the JSON document doc satisfies e. Attribute names
+// are case-insensitive; conditions on multi-valued attributes match when
+// any value does, and complex values are compared by their value
+// sub-attribute. Strings compare case-insensitively.
+func match(e *filter.Expr, doc map[string]any) bool {
+	switch e.Op {
+	case filter.And:
+		for _, arg := range e.Args {
+			if !match(arg, doc) {
+				return false
+			}
+		}
+		return true
+	case filter.Or:
+		for _, arg := range e.Args {
+			if match(arg, doc) {
+				return true
+			}
+		}
+		return false
+	case filter.Not:
+		return !match(e.Args[0], doc)
+	}
+
+	values := lookup(doc, strings.Split(e.Attr, "."))
+	switch e.Op {
+	case filter.Pr:
+		for _, v := range values {
+			if v != nil && v != "" {
+				return true
+			}
+		}
+		return false
+	case filter.Ne:
+		return !match(&filter.Expr{Op: filter.Eq, Attr: e.Attr, Value: e.Value}, doc)
+	}
+	if e.Value == nil {
+		return e.Op == filter.Eq && len(values) == 0
+	}
+	for _, v := range values {
+		if compare(e.Op, v, e.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the values at path in v, flattening arrays.
+func lookup(v any, path []string) []any {
+	switch v := v.(type) {
+	case []any:
+		var values []any
+		for _, elem := range v {
+			values = append(values, lookup(elem, path)...)
+		}
+		return values
+	case map[string]any:
+		if len(path) == 0 {
+			if value, ok := v["value"]; ok {
+				return lookup(value, nil)
+			}
+			return nil
+		}
+		if key, ok := findKey(v, path[0]); ok {
+			return lookup(v[key], path[1:])
+		}
+		return nil
+	case nil:
+		return nil
+	}
+	if len(path) > 0 {
+		return nil
+	}
+	return []any{v}
+}
+
+// findKey returns the key of obj equal to name ignoring case.
+func findKey(obj map[string]any, name string) (string, bool) {
+	if _, ok := obj[name]; ok {
+		return name, true
+	}
+	for key := range obj {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return name, false
+}
+
+// compare applies a comparison operator to a value of a document and the
+// operand of a filter.
+func compare(op filter.Op, v, operand any) bool {
+	switch operand := operand.(type) {
+	case bool:
+		b, ok := v.(bool)
+		return ok && op == filter.Eq && b == operand
+	case json.Number:
+		x, err := strconv.ParseFloat(operand.String(), 64)
+		if err != nil {
+			return false
+		}
+		var y float64
+		switch v := v.(type) {
+		case float64:
+			y = v
+		case json.Number:
+			if y, err = strconv.ParseFloat(v.String(), 64); err != nil {
+				return false
+			}
+		default:
+			return false
+		}
+		return ordered(op, y-x)
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		s, operand = strings.ToLower(s), strings.ToLower(operand)
+		switch op {
+		case filter.Co:
+			return strings.Contains(s, operand)
+		case filter.Sw:
+			return strings.HasPrefix(s, operand)
+		case filter.Ew:
+			return strings.HasSuffix(s, operand)
+		}
+		return ordered(op, float64(strings.Compare(s, operand)))
+	}
+	return false
+}
+
+// ordered applies eq, gt, ge, lt or le to the sign of a difference.
+func ordered(op filter.Op, d float64) bool {
+	switch op {
+	case filter.Eq:
+		return d == 0
+	case filter.Gt:
+		return d > 0
+	case filter.Ge:
+		return d >= 0
+	case filter.Lt:
+		return d < 0
+	case filter.Le:
+		return d <= 0
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/coding-hui/iam/pkg/filter"
+)
+
+func TestUserFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		// Sent by Okta and Azure AD to look up users before creating them.
+		{`userName eq "ann@example.com"`, `traits.username eq "ann@example.com"`},
+		{`externalId eq "00u1"`, `traits.external_id eq "00u1"`},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "ann"`, `traits.username eq "ann"`},
+		{`emails[value co "@example.com"]`, `traits.email co "@example.com"`},
+		{`emails.value ew "@example.com" or phoneNumbers pr`, `traits.email ew "@example.com" or traits.phone pr`},
+		{`active eq false and meta.lastModified gt "2023-01-01T00:00:00Z"`, `state ne "active" and updated_at gt "2023-01-01T00:00:00Z"`},
+		{`not (active ne true) and id eq "x"`, `not (state ne "active") and id eq "x"`},
+	}
+	for _, tt := range tests {
+		e, err := parseFilter(tt.filter)
+		if err != nil {
+			t.Errorf("parseFilter(%q) error = %v", tt.filter, err)
+			continue
+		}
+		if err := userFilter(e, DefaultAttributes); err != nil {
+			t.Errorf("userFilter(%q) error = %v", tt.filter, err)
+			continue
+		}
+		if got := e.String(); got != tt.want {
+			t.Errorf("userFilter(%q) = %s, want %s", tt.filter, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{`title eq "x"`, `emails[type eq "work"]`, `active gt true`, `emails[type eq "work"`, `userName eq "a"]`} {
+		e, err := parseFilter(s)
+		if err == nil {
+			err = userFilter(e, DefaultAttributes)
+		}
+		if !errors.Is(err, filter.ErrInvalidFilter) {
+			t.Errorf("filter %q error = %v, want ErrInvalidFilter", s, err)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(`{
+		"displayName": "Engineering",
+		"externalId": "eng",
+		"members": [{"value": "a", "type": "User"}, {"value": "b", "type": "User"}],
+		"meta": {"created": "2023-05-01T00:00:00Z"}
+	}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`displayName eq "engineering"`, true},
+		{`DisplayName sw "Eng" and externalId eq "eng"`, true},
+		{`displayName co "sales" or externalId pr`, true},
+		{`members eq "b"`, true},
+		{`members[value eq "c" or type eq "User"]`, true},
+		{`members.value eq "c"`, false},
+		{`not (members.value eq "a")`, false},
+		{`meta.created lt "2024"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:Group:displayName ne "Engineering"`, false},
+		{`description pr`, false},
+	}
+	for _, tt := range tests {
+		e, err := parseFilter(tt.filter)
+		if err != nil {
+			t.Errorf("parseFilter(%q) error = %v", tt.filter, err)
+			continue
+		}
+		if got := match(e, doc); got != tt.want {
+			t.Errorf("match(%q) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/coding-hui/iam/internal/authz/role"
+)
+
+// groupReadOnly holds the read-only attributes of groups, in lower case.
+var groupReadOnly = map[string]bool{"id": true, "meta": true}
+
+// externalIDKey is the member of the extra data of roles holding the
+// externalId of their group.
+const externalIDKey = "scim_external_id"
+
+// CreateGroup creates a role for a group and binds it to the members.
+func (m *ManagerImpl) CreateGroup(ctx context.Context, o *Origin, g *Group) (*Group, error) {
+	if err := m.checkDisplayName(ctx, o, g.DisplayName, uuid.Nil); err != nil {
+		return nil, err
+	}
+	if err := m.checkMembers(ctx, o, g.Members); err != nil {
+		return nil, err
+	}
+	extra, err := setExternalID(nil, g.ExternalID)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := m.roles.CreateRole(ctx, &role.CreateRoleRequest{
+		NetworkID: o.NetworkID,
+		Name:      g.DisplayName,
+		Extra:     extra,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := m.syncMembers(ctx, r, nil, g.Members); err != nil {
+		return nil, err
+	}
+	return m.GetGroup(ctx, o, r.ID.String())
+}
+
+// GetGroup retrieves the group of a role.
+func (m *ManagerImpl) GetGroup(ctx context.Context, o *Origin, id string) (*Group, error) {
+	r, err := m.role(ctx, o, id)
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := m.rolePool.ListRoleBindingsByRole(ctx, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	return toGroup(r, bindings, o), nil
+}
+
+// ListGroups lists the groups of the network matching a filter. Groups
+// are filtered in memory over all their attributes.
+func (m *ManagerImpl) ListGroups(ctx context.Context, o *Origin, params *ListParams) (*ListResponse, error) {
+	var where func(doc map[string]any) bool
+	if strings.TrimSpace(params.Filter) != "" {
+		e, err := parseFilter(params.Filter)
+		if err != nil {
+			return nil, err
+		}
+		where = func(doc map[string]any) bool { return match(e, doc) }
+	}
+
+	roles, err := m.listRoles(ctx, o.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := m.rolePool.ListRoleBindings(ctx, o.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+	byRole := make(map[uuid.UUID][]*role.RoleBinding)
+	for _, b := range bindings {
+		byRole[b.RoleID] = append(byRole[b.RoleID], b)
+	}
+
+	var groups []any
+	for _, r := range roles {
+		g := toGroup(r, byRole[r.ID], o)
+		if where != nil {
+			doc, err := document(g)
+			if err != nil {
+				return nil, err
+			}
+			if !where(doc) {
+				continue
+			}
+		}
+		groups = append(groups, g)
+	}
+
+	offset, count := page(params)
+	resp := &ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(groups),
+		StartIndex:   offset + 1,
+		Resources:    []any{},
+	}
+	if offset < len(groups) {
+		resp.Resources = append(resp.Resources, groups[offset:min(offset+count, len(groups))]...)
+	}
+	resp.ItemsPerPage = len(resp.Resources)
+	return resp, nil
+}
+
+// ReplaceGroup replaces the name, externalId and members of a group.
+func (m *ManagerImpl) ReplaceGroup(ctx context.Context, o *Origin, id string, g *Group) (*Group, error) {
+	r, err := m.role(ctx, o, id)
+	if err != nil {
+		return nil, err
+	}
+	return m.replaceGroup(ctx, o, r, g)
+}
+
+// PatchGroup applies a PATCH request to a group.
+func (m *ManagerImpl) PatchGroup(ctx context.Context, o *Origin, id string, req *PatchRequest) (*Group, error) {
+	r, err := m.role(ctx, o, id)
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := m.rolePool.ListRoleBindingsByRole(ctx, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := document(toGroup(r, bindings, o))
+	if err != nil {
+		return nil, err
+	}
+	if err := applyPatch(doc, req.Operations, groupReadOnly); err != nil {
+		return nil, err
+	}
+	var g Group
+	if err := decodeDocument(doc, &g); err != nil {
+		return nil, err
+	}
+	return m.replaceGroup(ctx, o, r, &g)
+}
+
+// DeleteGroup deletes the role of a group together with its bindings.
+func (m *ManagerImpl) DeleteGroup(ctx context.Context, o *Origin, id string) error {
+	r, err := m.role(ctx, o, id)
+	if err != nil {
+		return err
+	}
+	return m.roles.DeleteRole(ctx, r.ID)
+}
+
+func (m *ManagerImpl) replaceGroup(ctx context.Context, o *Origin, r *role.Role, g *Group) (*Group, error) {
+	if err := m.checkDisplayName(ctx, o, g.DisplayName, r.ID); err != nil {
+		return nil, err
+	}
+	if err := m.checkMembers(ctx, o, g.Members); err != nil {
+		return nil, err
+	}
+	extra, err := setExternalID(r.Extra, g.ExternalID)
+	if err != nil {
+		return nil, err
+	}
+	if g.DisplayName != r.Name || string(extra) != string(r.Extra) {
+		if r, err = m.roles.UpdateRole(ctx, r.ID, &role.UpdateRoleRequest{
+			Name:  g.DisplayName,
+			Extra: extra,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	bindings, err := m.rolePool.ListRoleBindingsByRole(ctx, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.syncMembers(ctx, r, bindings, g.Members); err != nil {
+		return nil, err
+	}
+	return m.GetGroup(ctx, o, r.ID.String())
+}
+
+// syncMembers binds the role to the members and unbinds it from the
+// subjects of bindings that are not members.
+func (m *ManagerImpl) syncMembers(ctx context.Context, r *role.Role, bindings []*role.RoleBinding, members []Member) error {
+	want := make(map[string]bool, len(members))
+	for _, member := range members {
+		want[member.Value] = true
+	}
+	for _, b := range bindings {
+		if want[b.Subject] {
+			delete(want, b.Subject)
+			continue
+		}
+		if err := m.roles.UnbindRole(ctx, r.ID, b.Subject); err != nil {
+			return err
+		}
+	}
+	for _, member := range members {
+		if !want[member.Value] {
+			continue
+		}
+		delete(want, member.Value)
+		if _, err := m.roles.BindRole(ctx, r.ID, &role.BindRoleRequest{Subject: member.Value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMembers returns ErrInvalidValue unless the members are users of
+// the network.
+func (m *ManagerImpl) checkMembers(ctx context.Context, o *Origin, members []Member) error {
+	for _, member := range members {
+		if member.Type != "" && !strings.EqualFold(member.Type, "User") {
+			return fmt.Errorf("%w: members must be users", ErrInvalidValue)
+		}
+		if _, err := m.identity(ctx, o, member.Value); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("%w: unknown member %q", ErrInvalidValue, member.Value)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDisplayName returns ErrUniqueness when another role of the network
+// than self is named displayName, ignoring case.
+func (m *ManagerImpl) checkDisplayName(ctx context.Context, o *Origin, displayName string, self uuid.UUID) error {
+	if displayName == "" {
+		return fmt.Errorf("%w: displayName is required", ErrInvalidValue)
+	}
+	roles, err := m.listRoles(ctx, o.NetworkID)
+	if err != nil {
+		return err
+	}
+	for _, r := range roles {
+		if r.ID != self && strings.EqualFold(r.Name, displayName) {
+			return fmt.Errorf("%w: displayName %q is taken", ErrUniqueness, displayName)
+		}
+	}
+	return nil
+}
+
+// role retrieves the role of a group of the network.
+func (m *ManagerImpl) role(ctx context.Context, o *Origin, id string) (*role.Role, error) {
+	roleID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	r, err := m.rolePool.GetRoleByNetworkID(ctx, o.NetworkID, roleID)
+	if err != nil {
+		if errors.Is(err, role.ErrRoleNotFound) || errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// listRoles lists all roles of a network.
+func (m *ManagerImpl) listRoles(ctx context.Context, networkID uuid.UUID) ([]*role.Role, error) {
+	const batch = 100
+	var roles []*role.Role
+	for {
+		page, total, err := m.rolePool.ListRoles(ctx, networkID, batch, len(roles))
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, page...)
+		if len(page) < batch || len(roles) >= total {
+			return roles, nil
+		}
+	}
+}
+
+// memberships returns the groups of the users of the network by identity
+// ID.
+func (m *ManagerImpl) memberships(ctx context.Context, o *Origin) (map[string][]Member, error) {
+	roles, err := m.listRoles(ctx, o.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uuid.UUID]string, len(roles))
+	for _, r := range roles {
+		names[r.ID] = r.Name
+	}
+	bindings, err := m.rolePool.ListRoleBindings(ctx, o.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string][]Member)
+	for _, b := range bindings {
+		id := b.RoleID.String()
+		groups[b.Subject] = append(groups[b.Subject], Member{
+			Value:   id,
+			Ref:     location(o, "Groups", id),
+			Display: names[b.RoleID],
+			Type:    "direct",
+		})
+	}
+	return groups, nil
+}
+
+// toGroup returns the group of a role.
+func toGroup(r *role.Role, bindings []*role.RoleBinding, o *Origin) *Group {
+	id := r.ID.String()
+	g := &Group{
+		Schemas:     []string{SchemaGroup},
+		ID:          id,
+		ExternalID:  externalID(r.Extra),
+		DisplayName: r.Name,
+		Meta: &Meta{
+			ResourceType: "Group",
+			Created:      r.CreatedAt,
+			LastModified: r.UpdatedAt,
+			Location:     location(o, "Groups", id),
+		},
+	}
+	for _, b := range bindings {
+		g.Members = append(g.Members, Member{
+			Value: b.Subject,
+			Ref:   location(o, "Users", b.Subject),
+			Type:  "User",
+		})
+	}
+	return g
+}
+
+// externalID returns the externalId kept in the extra data of a role.
+func externalID(extra json.RawMessage) string {
+	var obj map[string]any
+	if json.Unmarshal(extra, &obj) != nil {
+		return ""
+	}
+	s, _ := obj[externalIDKey].(string)
+	return s
+}
+
+// setExternalID returns the extra data of a role with its externalId set
+// or, when empty, removed. Extra data that is not an object is replaced.
+func setExternalID(extra json.RawMessage, id string) (json.RawMessage, error) {
+	obj := map[string]any{}
+	if len(extra) > 0 && json.Unmarshal(extra, &obj) != nil {
+		obj = map[string]any{}
+	}
+	if obj == nil {
+		obj = map[string]any{}
+	}
+	if id == "" {
+		if _, ok := obj[externalIDKey]; !ok {
+			return extra, nil
+		}
+		delete(obj, externalIDKey)
+	} else {
+		obj[externalIDKey] = id
+	}
+	return json.Marshal(obj)
+}
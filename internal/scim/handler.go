@@ -0,0 +1,466 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package scim
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/coding-hui/iam/pkg/api"
+	"github.com/coding-hui/iam/pkg/code"
+	"github.com/coding-hui/iam/pkg/filter"
+
+	"github.com/coding-hui/common/errors"
+)
+
+// Handler handles SCIM requests and the management of SCIM tokens.
+// SCIM endpoints answer with SCIM messages rather than the API envelope.
+type Handler struct {
+	manager Manager
+}
+
+// NewHandler creates a new SCIM handler.
+func NewHandler(manager Manager) *Handler {
+	return &Handler{manager: manager}
+}
+
+// Authenticate returns middleware that authenticates SCIM clients by
+// their bearer token and scopes the request to the token's network.
+func Authenticate(manager Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			fail(c, ErrTokenInvalid)
+			c.Abort()
+			return
+		}
+		t, err := manager.Authenticate(c.Request.Context(), strings.TrimSpace(value))
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="scim", error="invalid_token"`)
+			fail(c, err)
+			c.Abort()
+			return
+		}
+		c.Set("network_id", t.NetworkID.String())
+		c.Next()
+	}
+}
+
+// CreateToken handles POST /api/v1/scim/tokens.
+func (h *Handler) CreateToken(c *gin.Context) {
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+	if req.Name == "" {
+		api.FailWithMessage("name is required", c)
+		return
+	}
+
+	t, err := h.manager.CreateToken(c.Request.Context(), &req)
+	if err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(t, c)
+}
+
+// ListTokens handles GET /api/v1/scim/tokens.
+func (h *Handler) ListTokens(c *gin.Context) {
+	tokens, err := h.manager.ListTokens(c.Request.Context(), networkID(c))
+	if err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(tokens, c)
+}
+
+// RevokeToken handles DELETE /api/v1/scim/tokens/:id.
+func (h *Handler) RevokeToken(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		api.FailWithMessage("invalid id", c)
+		return
+	}
+
+	if err := h.manager.RevokeToken(c.Request.Context(), id); err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			api.FailWithMessage(err.Error(), c)
+			return
+		}
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.Ok(c)
+}
+
+// CreateUser handles POST /scim/v2/Users.
+func (h *Handler) CreateUser(c *gin.Context) {
+	var u User
+	if !bind(c, &u) {
+		return
+	}
+	created, err := h.manager.CreateUser(c.Request.Context(), origin(c), &u)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.Header("Location", created.Meta.Location)
+	write(c, http.StatusCreated, project(c, created))
+}
+
+// GetUser handles GET /scim/v2/Users/:id.
+func (h *Handler) GetUser(c *gin.Context) {
+	u, err := h.manager.GetUser(c.Request.Context(), origin(c), c.Param("id"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	write(c, http.StatusOK, project(c, u))
+}
+
+// ListUsers handles GET /scim/v2/Users.
+func (h *Handler) ListUsers(c *gin.Context) {
+	var params ListParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		fail(c, fmt.Errorf("%w: %v", ErrInvalidSyntax, err))
+		return
+	}
+	resp, err := h.manager.ListUsers(c.Request.Context(), origin(c), &params)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	writeList(c, resp)
+}
+
+// ReplaceUser handles PUT /scim/v2/Users/:id.
+func (h *Handler) ReplaceUser(c *gin.Context) {
+	var u User
+	if !bind(c, &u) {
+		return
+	}
+	replaced, err := h.manager.ReplaceUser(c.Request.Context(), origin(c), c.Param("id"), &u)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	write(c, http.StatusOK, project(c, replaced))
+}
+
+// PatchUser handles PATCH /scim/v2/Users/:id.
+func (h *Handler) PatchUser(c *gin.Context) {
+	var req PatchRequest
+	if !bind(c, &req) {
+		return
+	}
+	patched, err := h.manager.PatchUser(c.Request.Context(), origin(c), c.Param("id"), &req)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	write(c, http.StatusOK, project(c, patched))
+}
+
+// DeleteUser handles DELETE /scim/v2/Users/:id.
+func (h *Handler) DeleteUser(c *gin.Context) {
+	if err := h.manager.DeleteUser(c.Request.Context(), origin(c), c.Param("id")); err != nil {
+		fail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CreateGroup handles POST /scim/v2/Groups.
+func (h *Handler) CreateGroup(c *gin.Context) {
+	var g Group
+	if !bind(c, &g) {
+		return
+	}
+	created, err := h.manager.CreateGroup(c.Request.Context(), origin(c), &g)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.Header("Location", created.Meta.Location)
+	write(c, http.StatusCreated, project(c, created))
+}
+
+// GetGroup handles GET /scim/v2/Groups/:id.
+func (h *Handler) GetGroup(c *gin.Context) {
+	g, err := h.manager.GetGroup(c.Request.Context(), origin(c), c.Param("id"))
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	write(c, http.StatusOK, project(c, g))
+}
+
+// ListGroups handles GET /scim/v2/Groups.
+func (h *Handler) ListGroups(c *gin.Context) {
+	var params ListParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		fail(c, fmt.Errorf("%w: %v", ErrInvalidSyntax, err))
+		return
+	}
+	resp, err := h.manager.ListGroups(c.Request.Context(), origin(c), &params)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	writeList(c, resp)
+}
+
+// ReplaceGroup handles PUT /scim/v2/Groups/:id.
+func (h *Handler) ReplaceGroup(c *gin.Context) {
+	var g Group
+	if !bind(c, &g) {
+		return
+	}
+	replaced, err := h.manager.ReplaceGroup(c.Request.Context(), origin(c), c.Param("id"), &g)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	write(c, http.StatusOK, project(c, replaced))
+}
+
+// PatchGroup handles PATCH /scim/v2/Groups/:id.
+func (h *Handler) PatchGroup(c *gin.Context) {
+	var req PatchRequest
+	if !bind(c, &req) {
+		return
+	}
+	patched, err := h.manager.PatchGroup(c.Request.Context(), origin(c), c.Param("id"), &req)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	write(c, http.StatusOK, project(c, patched))
+}
+
+// DeleteGroup handles DELETE /scim/v2/Groups/:id.
+func (h *Handler) DeleteGroup(c *gin.Context) {
+	if err := h.manager.DeleteGroup(c.Request.Context(), origin(c), c.Param("id")); err != nil {
+		fail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ServiceProviderConfig handles GET /scim/v2/ServiceProviderConfig.
+func (h *Handler) ServiceProviderConfig(c *gin.Context) {
+	config := NewServiceProviderConfig()
+	config.Meta = discoveryMeta(c, "ServiceProviderConfig", "/ServiceProviderConfig")
+	write(c, http.StatusOK, config)
+}
+
+// ResourceTypes handles GET /scim/v2/ResourceTypes and
+// GET /scim/v2/ResourceTypes/:id.
+func (h *Handler) ResourceTypes(c *gin.Context) {
+	var resources []any
+	for _, t := range NewResourceTypes() {
+		t.Meta = discoveryMeta(c, "ResourceType", "/ResourceTypes/"+t.ID)
+		if c.Param("id") == t.ID {
+			write(c, http.StatusOK, t)
+			return
+		}
+		resources = append(resources, t)
+	}
+	if c.Param("id") != "" {
+		fail(c, ErrNotFound)
+		return
+	}
+	writeList(c, &ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// Schemas handles GET /scim/v2/Schemas and GET /scim/v2/Schemas/:id.
+func (h *Handler) Schemas(c *gin.Context) {
+	var resources []any
+	for _, s := range NewSchemas() {
+		s.Meta = discoveryMeta(c, "Schema", "/Schemas/"+s.ID)
+		if c.Param("id") == s.ID {
+			write(c, http.StatusOK, s)
+			return
+		}
+		resources = append(resources, s)
+	}
+	if c.Param("id") != "" {
+		fail(c, ErrNotFound)
+		return
+	}
+	writeList(c, &ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// discoveryMeta returns the metadata of a discovery resource.
+func discoveryMeta(c *gin.Context, resourceType, path string) *Meta {
+	return &Meta{ResourceType: resourceType, Location: baseURL(c) + path}
+}
+
+// bind decodes the body of a request into v, writing an invalidSyntax
+// error on failure.
+func bind(c *gin.Context, v any) bool {
+	if err := c.ShouldBindJSON(v); err != nil {
+		fail(c, fmt.Errorf("%w: %v", ErrInvalidSyntax, err))
+		return false
+	}
+	return true
+}
+
+// origin returns the network and origin of a SCIM request.
+func origin(c *gin.Context) *Origin {
+	return &Origin{
+		NetworkID: networkID(c),
+		BaseURL:   baseURL(c),
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		RequestID: c.GetHeader("X-Request-ID"),
+	}
+}
+
+// baseURL returns the URL of the SCIM endpoints a request was sent to.
+func baseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host + "/scim/v2"
+}
+
+func networkID(c *gin.Context) uuid.UUID {
+	networkID, err := uuid.Parse(c.GetString("network_id"))
+	if err != nil {
+		return uuid.Nil
+	}
+	return networkID
+}
+
+// write writes a SCIM message.
+func write(c *gin.Context, status int, v any) {
+	c.Header("Content-Type", ContentType)
+	c.JSON(status, v)
+}
+
+// writeList writes a list response, applying the attributes and
+// excludedAttributes parameters to its resources.
+func writeList(c *gin.Context, resp *ListResponse) {
+	for i, r := range resp.Resources {
+		resp.Resources[i] = project(c, r)
+	}
+	write(c, http.StatusOK, resp)
+}
+
+// project applies the attributes and excludedAttributes parameters of a
+// request to a resource. The id, schemas and meta attributes are always
+// returned; sub-attributes select their whole attribute.
+func project(c *gin.Context, resource any) any {
+	attributes := splitAttributes(c.Query("attributes"))
+	excluded := splitAttributes(c.Query("excludedAttributes"))
+	if len(attributes) == 0 && len(excluded) == 0 {
+		return resource
+	}
+	doc, err := document(resource)
+	if err != nil {
+		return resource
+	}
+	for key := range doc {
+		name := strings.ToLower(key)
+		if name == "id" || name == "schemas" || name == "meta" {
+			continue
+		}
+		if (len(attributes) > 0 && !attributes[name]) || excluded[name] {
+			delete(doc, key)
+		}
+	}
+	return doc
+}
+
+// splitAttributes returns the top-level attributes of a comma separated
+// list of attribute paths, in lower case.
+func splitAttributes(s string) map[string]bool {
+	attrs := make(map[string]bool)
+	for _, attr := range strings.Split(s, ",") {
+		attr = strings.TrimSpace(attr)
+		if n := coreSchemaPrefix(attr); n > 0 {
+			attr = attr[n:]
+		}
+		if attr, _, _ = strings.Cut(attr, "."); attr != "" {
+			attrs[strings.ToLower(attr)] = true
+		}
+	}
+	return attrs
+}
+
+// scimErrors maps errors to the HTTP status and scimType of their
+// responses.
+var scimErrors = []struct {
+	err      error
+	status   int
+	scimType string
+}{
+	{ErrTokenInvalid, http.StatusUnauthorized, ""},
+	{ErrNotFound, http.StatusNotFound, ""},
+	{ErrUniqueness, http.StatusConflict, "uniqueness"},
+	{filter.ErrInvalidFilter, http.StatusBadRequest, "invalidFilter"},
+	{ErrInvalidValue, http.StatusBadRequest, "invalidValue"},
+	{ErrInvalidSyntax, http.StatusBadRequest, "invalidSyntax"},
+	{ErrInvalidPath, http.StatusBadRequest, "invalidPath"},
+	{ErrNoTarget, http.StatusBadRequest, "noTarget"},
+	{ErrMutability, http.StatusBadRequest, "mutability"},
+}
+
+// fail writes the SCIM error response of err. Rejected identity changes
+// are reported as invalid values, taken identifiers as uniqueness
+// conflicts.
+func fail(c *gin.Context, err error) {
+	resp := &Error{Schemas: []string{SchemaError}, Detail: err.Error()}
+	status := 0
+	for _, e := range scimErrors {
+		if errors.Is(err, e.err) {
+			status, resp.ScimType = e.status, e.scimType
+			break
+		}
+	}
+	if status == 0 {
+		coder := errors.ParseCoder(err)
+		switch status = coder.HTTPStatus(); {
+		case errors.IsCode(err, code.ErrIdentityIdentifierInUse):
+			status, resp.ScimType = http.StatusConflict, "uniqueness"
+		case status == http.StatusBadRequest:
+			resp.ScimType = "invalidValue"
+		case status >= http.StatusInternalServerError:
+			zap.S().Errorf("%#+v", err)
+			resp.Detail = http.StatusText(status)
+		}
+	}
+	resp.Status = strconv.Itoa(status)
+	write(c, status, resp)
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package scim
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/authz/role"
+	"github.com/coding-hui/iam/internal/identity"
+)
+
+// tokenPrefix starts the values of SCIM tokens, so that leaked tokens can
+// be recognized.
+const tokenPrefix = "scim_"
+
+// ManagerImpl implements scim.Manager.
+type ManagerImpl struct {
+	pool         PrivilegedPool
+	identities   identity.Manager
+	identityPool identity.Pool
+	roles        role.Manager
+	rolePool     role.Pool
+	config       Config
+}
+
+// NewManagerImpl creates a new SCIM service provider that maps users onto
+// identities and groups onto roles. Users get the default identity schema
+// and attribute mapping until a config is set, see SetConfig.
+func NewManagerImpl(pool PrivilegedPool, identities identity.Manager, identityPool identity.Pool, roles role.Manager, rolePool role.Pool) *ManagerImpl {
+	m := &ManagerImpl{
+		pool:         pool,
+		identities:   identities,
+		identityPool: identityPool,
+		roles:        roles,
+		rolePool:     rolePool,
+	}
+	m.SetConfig(Config{})
+	return m
+}
+
+// SetConfig sets the identity schema of users and overrides entries of
+// DefaultAttributes; zero values keep the defaults. The config must be
+// valid, see Config.Validate.
+func (m *ManagerImpl) SetConfig(c Config) {
+	m.config.SchemaID = c.SchemaID
+	if m.config.SchemaID == "" {
+		m.config.SchemaID = "default"
+	}
+	m.config.Attributes = MergeAttributes(c.Attributes)
+}
+
+// Validate checks that the config only maps supported attributes to
+// well-formed trait paths.
+func (c *Config) Validate() error {
+	return ValidateAttributes(c.Attributes)
+}
+
+// MergeAttributes returns DefaultAttributes with the entries of attrs
+// overriding them. Attribute names are case-insensitive and unsupported
+// ones are skipped.
+func MergeAttributes(attrs map[string]string) map[string]string {
+	merged := make(map[string]string, len(DefaultAttributes))
+	for name, path := range DefaultAttributes {
+		merged[name] = path
+	}
+	for name, path := range attrs {
+		if canonical, ok := attributeName(name); ok {
+			merged[canonical] = path
+		}
+	}
+	return merged
+}
+
+// ValidateAttributes checks that attrs only maps supported attributes to
+// well-formed trait paths.
+func ValidateAttributes(attrs map[string]string) error {
+	for name, path := range attrs {
+		if _, ok := attributeName(name); !ok {
+			return fmt.Errorf("unsupported attribute %q", name)
+		}
+		if path == "" {
+			continue
+		}
+		for _, seg := range strings.Split(path, ".") {
+			if seg == "" {
+				return fmt.Errorf("attribute %q: invalid trait path %q", name, path)
+			}
+		}
+	}
+	return nil
+}
+
+// attributeName returns the name of a supported attribute as spelled in
+// DefaultAttributes; names are case-insensitive.
+func attributeName(name string) (string, bool) {
+	for canonical := range DefaultAttributes {
+		if strings.EqualFold(canonical, name) {
+			return canonical, true
+		}
+	}
+	return "", false
+}
+
+// CreateToken creates a token for a network.
+func (m *ManagerImpl) CreateToken(ctx context.Context, req *CreateTokenRequest) (*Token, error) {
+	value, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	t := &Token{
+		ID:        uuid.New(),
+		NetworkID: req.NetworkID,
+		Name:      req.Name,
+		TokenHash: hashToken(value),
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := m.pool.CreateToken(ctx, t); err != nil {
+		return nil, err
+	}
+	t.Value = value
+	return t, nil
+}
+
+// ListTokens lists the tokens of a network without their values.
+func (m *ManagerImpl) ListTokens(ctx context.Context, networkID uuid.UUID) ([]*Token, error) {
+	return m.pool.ListTokens(ctx, networkID)
+}
+
+// RevokeToken deletes a token.
+func (m *ManagerImpl) RevokeToken(ctx context.Context, id uuid.UUID) error {
+	if _, err := m.pool.GetToken(ctx, id); err != nil {
+		return err
+	}
+	return m.pool.DeleteToken(ctx, id)
+}
+
+// Authenticate returns the token with a value unless it is unknown or
+// expired.
+func (m *ManagerImpl) Authenticate(ctx context.Context, value string) (*Token, error) {
+	if !strings.HasPrefix(value, tokenPrefix) {
+		return nil, ErrTokenInvalid
+	}
+	t, err := m.pool.GetTokenByHash(ctx, hashToken(value))
+	if err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			return nil, ErrTokenInvalid
+		}
+		return nil, err
+	}
+	if t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt) {
+		return nil, ErrTokenInvalid
+	}
+	return t, nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// document returns the JSON document of a resource.
+func document(v any) (map[string]any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// decodeDocument decodes the JSON document of a patched resource into v.
+func decodeDocument(doc map[string]any, v any) error {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidValue, err)
+	}
+	return nil
+}
+
+// location returns the URL of a resource.
+func location(o *Origin, resourceType, id string) string {
+	if o.BaseURL == "" {
+		return ""
+	}
+	return o.BaseURL + "/" + resourceType + "/" + id
+}
+
+// page returns the 0-based offset and the number of results of a list
+// request.
+func page(params *ListParams) (offset, count int) {
+	offset = params.StartIndex - 1
+	if offset < 0 {
+		offset = 0
+	}
+	count = DefaultCount
+	if params.Count != nil {
+		count = min(max(*params.Count, 0), MaxCount)
+	}
+	return offset, count
+}
+
+// Ensure ManagerImpl implements Manager.
+var _ Manager = (*ManagerImpl)(nil)
@@ -0,0 +1,343 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/coding-hui/iam/pkg/filter"
+)
+
+// multiValued holds the multi-valued attributes of users and groups, in
+// lower case.
+var multiValued = map[string]bool{
+	"emails":       true,
+	"phonenumbers": true,
+	"groups":       true,
+	"members":      true,
+}
+
+// path is a parsed PATCH path: attr, attr.sub, attr[filter] or
+// attr[filter].sub.
+type path struct {
+	attr   string
+	filter *filter.Expr
+	sub    string
+	// extension is set for attributes of schema extensions, which are not
+	// supported and left alone.
+	extension bool
+}
+
+// parsePath parses a PATCH path. Attributes may be qualified with the URN
+// of their schema.
+func parsePath(s string) (*path, error) {
+	if n := coreSchemaPrefix(s); n > 0 {
+		s = s[n:]
+	} else if strings.HasPrefix(strings.ToLower(s), "urn:") {
+		return &path{extension: true}, nil
+	}
+
+	p := &path{attr: s}
+	if i := strings.IndexByte(s, '['); i >= 0 {
+		end := closingBracket(s, i)
+		if end < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPath, s)
+		}
+		e, err := filter.Parse(s[i+1 : end])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidPath, s, err)
+		}
+		p.attr, p.filter = s[:i], e
+		rest := s[end+1:]
+		if rest != "" {
+			sub, ok := strings.CutPrefix(rest, ".")
+			if !ok {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidPath, s)
+			}
+			p.sub = sub
+		}
+	} else if attr, sub, ok := strings.Cut(s, "."); ok {
+		p.attr, p.sub = attr, sub
+	}
+	if !isName(p.attr) || (p.sub != "" && !isName(p.sub)) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPath, s)
+	}
+	return p, nil
+}
+
+// isName reports whether s is an attribute name.
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '.' || !isPathByte(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyPatch applies the operations of a PATCH request to the JSON
+// document of a resource. Changes to the attributes in readOnly, given in
+// lower case, are rejected with ErrMutability.
+func applyPatch(doc map[string]any, ops []PatchOperation, readOnly map[string]bool) error {
+	for i, op := range ops {
+		if err := applyOperation(doc, &op, readOnly); err != nil {
+			return fmt.Errorf("operation %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func applyOperation(doc map[string]any, op *PatchOperation, readOnly map[string]bool) error {
+	kind := strings.ToLower(op.Op)
+	if kind != "add" && kind != "remove" && kind != "replace" {
+		return fmt.Errorf("%w: unknown op %q", ErrInvalidSyntax, op.Op)
+	}
+	var value any
+	if len(op.Value) > 0 {
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSyntax, err)
+		}
+	}
+
+	if op.Path == "" {
+		if kind == "remove" {
+			return fmt.Errorf("%w: remove requires a path", ErrNoTarget)
+		}
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%w: value must be an object when path is omitted", ErrInvalidSyntax)
+		}
+		for name, v := range obj {
+			p, err := parsePath(name)
+			if err != nil {
+				return err
+			}
+			if err := apply(doc, kind, p, v, readOnly); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	p, err := parsePath(op.Path)
+	if err != nil {
+		return err
+	}
+	if kind != "remove" && len(op.Value) == 0 {
+		return fmt.Errorf("%w: %s requires a value", ErrInvalidSyntax, kind)
+	}
+	return apply(doc, kind, p, value, readOnly)
+}
+
+// apply applies an add, remove or replace of value at p.
+func apply(doc map[string]any, kind string, p *path, value any, readOnly map[string]bool) error {
+	if p.extension {
+		return nil
+	}
+	attr := strings.ToLower(p.attr)
+	if readOnly[attr] {
+		return fmt.Errorf("%w: %s", ErrMutability, p.attr)
+	}
+	key, _ := findKey(doc, p.attr)
+	current := doc[key]
+
+	if p.filter != nil {
+		elems, _ := current.([]any)
+		elems, err := applyToValues(elems, kind, p, value)
+		if err != nil {
+			return err
+		}
+		doc[key] = elems
+		return nil
+	}
+
+	if p.sub != "" {
+		switch current := current.(type) {
+		case map[string]any:
+			setMember(current, kind, p.sub, value)
+		case []any:
+			for _, elem := range current {
+				if obj, ok := elem.(map[string]any); ok {
+					setMember(obj, kind, p.sub, value)
+				}
+			}
+		default:
+			if kind != "remove" {
+				obj := map[string]any{p.sub: value}
+				if multiValued[attr] {
+					doc[key] = []any{obj}
+				} else {
+					doc[key] = obj
+				}
+			}
+		}
+		return nil
+	}
+
+	switch kind {
+	case "remove":
+		elems, ok := current.([]any)
+		if !ok || value == nil {
+			delete(doc, key)
+			return nil
+		}
+		// A value selects the values to remove from a multi-valued
+		// attribute, e.g. members by value.
+		removed, _ := value.([]any)
+		if removed == nil {
+			removed = []any{value}
+		}
+		kept := elems[:0]
+		for _, elem := range elems {
+			if !containsValue(removed, elem) {
+				kept = append(kept, elem)
+			}
+		}
+		doc[key] = kept
+	case "add":
+		if elems, ok := current.([]any); ok {
+			// Values already present are left as they are.
+			for _, v := range values(value) {
+				if !containsValue(elems, v) {
+					elems = append(elems, v)
+				}
+			}
+			doc[key] = elems
+			return nil
+		}
+		fallthrough
+	default:
+		if obj, ok := current.(map[string]any); ok {
+			if patch, ok := value.(map[string]any); ok {
+				for name, v := range patch {
+					setMember(obj, "replace", name, v)
+				}
+				return nil
+			}
+		}
+		if multiValued[attr] {
+			value = values(value)
+		}
+		doc[key] = value
+	}
+	return nil
+}
+
+// applyToValues applies an operation to the values of a multi-valued
+// attribute matching the filter of p. Adding or replacing with a filter
+// that matches nothing adds a value when the filter only holds equality
+// conditions, e.g. emails[type eq "work"].value.
+func applyToValues(elems []any, kind string, p *path, value any) ([]any, error) {
+	matched := false
+	kept := make([]any, 0, len(elems))
+	for _, elem := range elems {
+		obj, ok := elem.(map[string]any)
+		if !ok || !match(p.filter, obj) {
+			kept = append(kept, elem)
+			continue
+		}
+		matched = true
+		switch {
+		case kind == "remove" && p.sub == "":
+			continue
+		case p.sub != "":
+			setMember(obj, kind, p.sub, value)
+		case kind == "replace":
+			if v, ok := value.(map[string]any); ok {
+				obj = v
+			}
+		default:
+			if v, ok := value.(map[string]any); ok {
+				for name, member := range v {
+					setMember(obj, "replace", name, member)
+				}
+			}
+		}
+		kept = append(kept, obj)
+	}
+	if matched || kind == "remove" {
+		return kept, nil
+	}
+
+	obj, ok := equalities(p.filter)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoTarget, p.filter)
+	}
+	if p.sub != "" {
+		obj[p.sub] = value
+	} else if v, ok := value.(map[string]any); ok {
+		for name, member := range v {
+			obj[name] = member
+		}
+	}
+	return append(kept, obj), nil
+}
+
+// setMember sets or, for remove, deletes a member of obj, ignoring case.
+func setMember(obj map[string]any, kind, name string, value any) {
+	key, _ := findKey(obj, name)
+	if kind == "remove" {
+		delete(obj, key)
+		return
+	}
+	obj[key] = value
+}
+
+// equalities returns the object holding the values a filter made of eq
+// conditions joined by and requires.
+func equalities(e *filter.Expr) (map[string]any, bool) {
+	obj := map[string]any{}
+	if e.Op == filter.And {
+		for _, arg := range e.Args {
+			sub, ok := equalities(arg)
+			if !ok {
+				return nil, false
+			}
+			for name, v := range sub {
+				obj[name] = v
+			}
+		}
+		return obj, true
+	}
+	if e.Op != filter.Eq || strings.Contains(e.Attr, ".") {
+		return nil, false
+	}
+	obj[e.Attr] = e.Value
+	return obj, true
+}
+
+// values returns v as a list of values.
+func values(v any) []any {
+	if list, ok := v.([]any); ok {
+		return list
+	}
+	return []any{v}
+}
+
+// containsValue reports whether list holds elem, comparing complex values
+// by their value sub-attribute.
+func containsValue(list []any, elem any) bool {
+	for _, v := range list {
+		if fmt.Sprint(valueOf(v)) == fmt.Sprint(valueOf(elem)) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueOf returns the value sub-attribute of a complex value, or v.
+func valueOf(v any) any {
+	if obj, ok := v.(map[string]any); ok {
+		if key, ok := findKey(obj, "value"); ok {
+			return obj[key]
+		}
+	}
+	return v
+}
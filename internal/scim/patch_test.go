@@ -0,0 +1,66 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestApplyPatch replays PATCH requests recorded from identity providers,
+// from testdata/patch.json, against documents of resources.
+func TestApplyPatch(t *testing.T) {
+	data, err := os.ReadFile("testdata/patch.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []struct {
+		Name     string          `json:"name"`
+		Resource map[string]any  `json:"resource"`
+		Request  PatchRequest    `json:"request"`
+		Want     json.RawMessage `json:"want"`
+		Error    string          `json:"error"`
+	}
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+
+	readOnly := map[string]bool{"id": true, "meta": true}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := applyPatch(tc.Resource, tc.Request.Operations, readOnly)
+			if tc.Error != "" {
+				if got := scimType(err); got != tc.Error {
+					t.Fatalf("applyPatch() error = %v (%q), want %q", err, got, tc.Error)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyPatch() error = %v", err)
+			}
+			var want map[string]any
+			if err := json.Unmarshal(tc.Want, &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.Resource, want) {
+				got, _ := json.Marshal(tc.Resource)
+				t.Errorf("applyPatch() = %s, want %s", got, tc.Want)
+			}
+		})
+	}
+}
+
+// scimType returns the SCIM error type of err.
+func scimType(err error) string {
+	for _, e := range scimErrors {
+		if errors.Is(err, e.err) {
+			return e.scimType
+		}
+	}
+	return ""
+}
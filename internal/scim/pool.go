@@ -0,0 +1,127 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package scim
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/coding-hui/iam/internal/persistence"
+)
+
+// Pool defines the interface for reading SCIM tokens. Missing tokens are
+// reported as ErrTokenNotFound.
+type Pool interface {
+	GetToken(ctx context.Context, id uuid.UUID) (*Token, error)
+	GetTokenByHash(ctx context.Context, tokenHash string) (*Token, error)
+	ListTokens(ctx context.Context, networkID uuid.UUID) ([]*Token, error)
+}
+
+// PrivilegedPool defines the interface for writing SCIM tokens.
+type PrivilegedPool interface {
+	Pool
+
+	CreateToken(ctx context.Context, t *Token) error
+	DeleteToken(ctx context.Context, id uuid.UUID) error
+}
+
+// pool implements PrivilegedPool using persistence.SCIMTokenPersister.
+type pool struct {
+	persister persistence.SCIMTokenPersister
+}
+
+// NewPool creates a new SCIM token pool.
+func NewPool(p persistence.SCIMTokenPersister) Pool {
+	return &pool{persister: p}
+}
+
+// NewPrivilegedPool creates a new SCIM token privileged pool.
+func NewPrivilegedPool(p persistence.SCIMTokenPersister) PrivilegedPool {
+	return &pool{persister: p}
+}
+
+// GetToken retrieves a token by ID.
+func (p *pool) GetToken(ctx context.Context, id uuid.UUID) (*Token, error) {
+	m, err := p.persister.GetSCIMToken(ctx, id.String())
+	if err != nil {
+		return nil, notFoundError(err)
+	}
+	return modelToDomain(m), nil
+}
+
+// GetTokenByHash retrieves a token by the hash of its value.
+func (p *pool) GetTokenByHash(ctx context.Context, tokenHash string) (*Token, error) {
+	m, err := p.persister.GetSCIMTokenByHash(ctx, tokenHash)
+	if err != nil {
+		return nil, notFoundError(err)
+	}
+	return modelToDomain(m), nil
+}
+
+// ListTokens lists the tokens of a network, oldest first.
+func (p *pool) ListTokens(ctx context.Context, networkID uuid.UUID) ([]*Token, error) {
+	ms, err := p.persister.ListSCIMTokens(ctx, networkID.String())
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]*Token, len(ms))
+	for i, m := range ms {
+		tokens[i] = modelToDomain(m)
+	}
+	return tokens, nil
+}
+
+// CreateToken stores a new token.
+func (p *pool) CreateToken(ctx context.Context, t *Token) error {
+	return p.persister.CreateSCIMToken(ctx, &persistence.SCIMToken{
+		ID:        t.ID.String(),
+		NetworkID: t.NetworkID.String(),
+		Name:      t.Name,
+		TokenHash: t.TokenHash,
+		ExpiresAt: t.ExpiresAt,
+		CreatedAt: t.CreatedAt,
+	})
+}
+
+// DeleteToken deletes a token.
+func (p *pool) DeleteToken(ctx context.Context, id uuid.UUID) error {
+	return p.persister.DeleteSCIMToken(ctx, id.String())
+}
+
+func modelToDomain(m *persistence.SCIMToken) *Token {
+	return &Token{
+		ID:        parseUUID(m.ID),
+		NetworkID: parseUUID(m.NetworkID),
+		Name:      m.Name,
+		TokenHash: m.TokenHash,
+		ExpiresAt: m.ExpiresAt,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+func parseUUID(s string) uuid.UUID {
+	if s == "" {
+		return uuid.Nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+// notFoundError maps a missing record to ErrTokenNotFound.
+func notFoundError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTokenNotFound
+	}
+	return err
+}
+
+// Ensure pool implements PrivilegedPool.
+var _ PrivilegedPool = (*pool)(nil)
@@ -0,0 +1,130 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package scim implements a SCIM 2.0 (RFC 7643, RFC 7644) provisioning
+// server. Users are identities whose traits hold the mapped SCIM
+// attributes, see Config, and groups are roles whose members are the
+// identities bound to them. Clients authenticate with bearer tokens that
+// each grant access to the users and groups of one network.
+package scim
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Schema URNs of the resources and messages.
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+)
+
+// ContentType is the media type of SCIM messages.
+const ContentType = "application/scim+json"
+
+// Paging limits of list requests.
+const (
+	DefaultCount = 100
+	MaxCount     = 1000
+)
+
+// Manager defines the interface for the SCIM service provider.
+type Manager interface {
+	// CreateToken creates a token for a network. Its value is only
+	// returned here.
+	CreateToken(ctx context.Context, req *CreateTokenRequest) (*Token, error)
+	ListTokens(ctx context.Context, networkID uuid.UUID) ([]*Token, error)
+	RevokeToken(ctx context.Context, id uuid.UUID) error
+	// Authenticate returns the token with a value, or ErrTokenInvalid.
+	Authenticate(ctx context.Context, value string) (*Token, error)
+
+	CreateUser(ctx context.Context, o *Origin, u *User) (*User, error)
+	GetUser(ctx context.Context, o *Origin, id string) (*User, error)
+	ListUsers(ctx context.Context, o *Origin, params *ListParams) (*ListResponse, error)
+	ReplaceUser(ctx context.Context, o *Origin, id string, u *User) (*User, error)
+	PatchUser(ctx context.Context, o *Origin, id string, req *PatchRequest) (*User, error)
+	DeleteUser(ctx context.Context, o *Origin, id string) error
+
+	CreateGroup(ctx context.Context, o *Origin, g *Group) (*Group, error)
+	GetGroup(ctx context.Context, o *Origin, id string) (*Group, error)
+	ListGroups(ctx context.Context, o *Origin, params *ListParams) (*ListResponse, error)
+	ReplaceGroup(ctx context.Context, o *Origin, id string, g *Group) (*Group, error)
+	PatchGroup(ctx context.Context, o *Origin, id string, req *PatchRequest) (*Group, error)
+	DeleteGroup(ctx context.Context, o *Origin, id string) error
+}
+
+// Config holds the settings of the SCIM service provider.
+type Config struct {
+	// SchemaID is the identity schema of created users.
+	SchemaID string
+	// Attributes maps SCIM user attributes to the dot separated paths of
+	// the traits holding them; attributes mapped to an empty path are
+	// dropped. Multi-valued attributes, emails and phoneNumbers, map their
+	// primary value. See DefaultAttributes for the supported attributes.
+	Attributes map[string]string
+}
+
+// DefaultAttributes is the mapping of SCIM user attributes to the traits
+// of the default identity schema.
+var DefaultAttributes = map[string]string{
+	"userName":        "username",
+	"externalId":      "external_id",
+	"displayName":     "name",
+	"name.givenName":  "given_name",
+	"name.familyName": "family_name",
+	"name.formatted":  "",
+	"emails":          "email",
+	"phoneNumbers":    "phone",
+}
+
+// Token is a bearer token of a SCIM client. Only a hash of its value is
+// stored.
+type Token struct {
+	ID        uuid.UUID  `json:"id"`
+	NetworkID uuid.UUID  `json:"network_id"`
+	Name      string     `json:"name"`
+	Value     string     `json:"value,omitempty"`
+	TokenHash string     `json:"-"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CreateTokenRequest holds data for creating a token.
+type CreateTokenRequest struct {
+	NetworkID uuid.UUID  `json:"network_id"`
+	Name      string     `json:"name"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Origin describes the SCIM request an operation serves. Its network is
+// the one of the token; the rest is recorded in the identity history and
+// audit trail.
+type Origin struct {
+	NetworkID uuid.UUID
+	// BaseURL is the URL of the SCIM endpoints, such as
+	// https://iam.example.com/scim/v2, used for resource locations.
+	BaseURL   string
+	ClientIP  string
+	UserAgent string
+	RequestID string
+}
+
+// ListParams holds the query parameters of list requests.
+type ListParams struct {
+	// Filter is a SCIM filter expression.
+	Filter string `form:"filter"`
+	// StartIndex is the 1-based index of the first result.
+	StartIndex int `form:"startIndex"`
+	// Count is the maximum number of results; it defaults to DefaultCount
+	// and is capped at MaxCount. Zero only returns the total.
+	Count *int `form:"count"`
+}
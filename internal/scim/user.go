@@ -0,0 +1,416 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/coding-hui/iam/internal/identity"
+)
+
+// userReadOnly holds the read-only attributes of users, in lower case.
+var userReadOnly = map[string]bool{"id": true, "meta": true, "groups": true}
+
+// CreateUser creates an identity for a user. A user that is not active
+// creates an inactive identity.
+func (m *ManagerImpl) CreateUser(ctx context.Context, o *Origin, u *User) (*User, error) {
+	if err := m.checkUserName(ctx, o, u.UserName, uuid.Nil); err != nil {
+		return nil, err
+	}
+	traits, err := m.userTraits(u, nil)
+	if err != nil {
+		return nil, err
+	}
+	state := identity.StateActive
+	if u.Active != nil && !*u.Active {
+		state = identity.StateInactive
+	}
+
+	ident, err := m.identities.CreateIdentity(ctx, &identity.CreateIdentityRequest{
+		SchemaID:  m.config.SchemaID,
+		Traits:    traits,
+		Password:  u.Password,
+		State:     state,
+		NetworkID: o.NetworkID,
+		RequestID: o.RequestID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.toUser(ident, nil, o), nil
+}
+
+// GetUser retrieves the user of an identity.
+func (m *ManagerImpl) GetUser(ctx context.Context, o *Origin, id string) (*User, error) {
+	ident, err := m.identity(ctx, o, id)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := m.memberships(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	return m.toUser(ident, groups[ident.ID.String()], o), nil
+}
+
+// ListUsers lists the users of the network matching a filter over id,
+// active, meta.created, meta.lastModified and the mapped attributes.
+func (m *ManagerImpl) ListUsers(ctx context.Context, o *Origin, params *ListParams) (*ListResponse, error) {
+	var where string
+	if strings.TrimSpace(params.Filter) != "" {
+		e, err := parseFilter(params.Filter)
+		if err != nil {
+			return nil, err
+		}
+		if err := userFilter(e, m.config.Attributes); err != nil {
+			return nil, err
+		}
+		where = e.String()
+	}
+	f, err := identity.NewListFilter(identity.ListIdentitiesParams{Filter: where})
+	if err != nil {
+		return nil, err
+	}
+
+	offset, count := page(params)
+	idents, total, err := m.identityPool.ListIdentities(ctx, o.NetworkID, count, offset, f)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := m.memberships(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   offset + 1,
+		Resources:    []any{},
+	}
+	for _, ident := range idents {
+		resp.Resources = append(resp.Resources, m.toUser(ident, groups[ident.ID.String()], o))
+	}
+	resp.ItemsPerPage = len(resp.Resources)
+	return resp, nil
+}
+
+// ReplaceUser replaces the mapped attributes of a user. Traits that are
+// not mapped are kept, and the state is kept when active is left out.
+func (m *ManagerImpl) ReplaceUser(ctx context.Context, o *Origin, id string, u *User) (*User, error) {
+	ident, err := m.identity(ctx, o, id)
+	if err != nil {
+		return nil, err
+	}
+	return m.replaceUser(ctx, o, ident, u)
+}
+
+// PatchUser applies a PATCH request to a user.
+func (m *ManagerImpl) PatchUser(ctx context.Context, o *Origin, id string, req *PatchRequest) (*User, error) {
+	ident, err := m.identity(ctx, o, id)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := document(m.toUser(ident, nil, o))
+	if err != nil {
+		return nil, err
+	}
+	if err := applyPatch(doc, req.Operations, userReadOnly); err != nil {
+		return nil, err
+	}
+	// Some clients send active as a string.
+	if key, ok := findKey(doc, "active"); ok {
+		if s, ok := doc[key].(string); ok {
+			active, err := strconv.ParseBool(s)
+			if err != nil {
+				return nil, fmt.Errorf("%w: active must be a boolean", ErrInvalidValue)
+			}
+			doc[key] = active
+		}
+	}
+	var u User
+	if err := decodeDocument(doc, &u); err != nil {
+		return nil, err
+	}
+	return m.replaceUser(ctx, o, ident, &u)
+}
+
+// DeleteUser deletes the identity of a user.
+func (m *ManagerImpl) DeleteUser(ctx context.Context, o *Origin, id string) error {
+	ident, err := m.identity(ctx, o, id)
+	if err != nil {
+		return err
+	}
+	return m.identities.DeleteIdentity(ctx, ident.ID, &identity.DeleteIdentityRequest{
+		NetworkID: o.NetworkID,
+		ClientIP:  o.ClientIP,
+		UserAgent: o.UserAgent,
+		RequestID: o.RequestID,
+	})
+}
+
+func (m *ManagerImpl) replaceUser(ctx context.Context, o *Origin, ident *identity.Identity, u *User) (*User, error) {
+	if err := m.checkUserName(ctx, o, u.UserName, ident.ID); err != nil {
+		return nil, err
+	}
+	traits, err := m.userTraits(u, ident.Traits)
+	if err != nil {
+		return nil, err
+	}
+	if ident, err = m.identities.UpdateIdentity(ctx, ident.ID, &identity.UpdateIdentityRequest{
+		Traits:    traits,
+		RequestID: o.RequestID,
+	}); err != nil {
+		return nil, err
+	}
+	if u.Password != "" {
+		if err := m.identities.AddCredentials(ctx, ident.ID, &identity.AddCredentialsRequest{
+			Type:     identity.CredentialsTypePassword,
+			Password: u.Password,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if u.Active != nil {
+		if ident, err = m.setActive(ctx, o, ident, *u.Active); err != nil {
+			return nil, err
+		}
+	}
+	return m.GetUser(ctx, o, ident.ID.String())
+}
+
+// setActive deactivates an active identity or activates an inactive one.
+// Suspended identities and those pending deletion are left alone, SCIM
+// clients must not lift these states.
+func (m *ManagerImpl) setActive(ctx context.Context, o *Origin, ident *identity.Identity, active bool) (*identity.Identity, error) {
+	var state identity.State
+	switch {
+	case active && ident.State == identity.StateInactive:
+		state = identity.StateActive
+	case !active && ident.State.IsActive():
+		state = identity.StateInactive
+	default:
+		return ident, nil
+	}
+	return m.identities.TransitionState(ctx, ident.ID, &identity.TransitionStateRequest{
+		State:     state,
+		Reason:    "scim",
+		ClientIP:  o.ClientIP,
+		UserAgent: o.UserAgent,
+		RequestID: o.RequestID,
+	})
+}
+
+// identity retrieves the identity of a user of the network.
+func (m *ManagerImpl) identity(ctx context.Context, o *Origin, id string) (*identity.Identity, error) {
+	identityID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	ident, err := m.identities.GetIdentity(ctx, identityID)
+	if err != nil {
+		if errors.Is(err, identity.ErrIdentityNotFound) || errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if ident.NetworkID != o.NetworkID {
+		return nil, ErrNotFound
+	}
+	return ident, nil
+}
+
+// checkUserName returns ErrUniqueness when another identity of the network
+// than self has userName.
+func (m *ManagerImpl) checkUserName(ctx context.Context, o *Origin, userName string, self uuid.UUID) error {
+	if userName == "" {
+		return fmt.Errorf("%w: userName is required", ErrInvalidValue)
+	}
+	path := m.config.Attributes["userName"]
+	if path == "" {
+		return nil
+	}
+	f, err := identity.NewListFilter(identity.ListIdentitiesParams{
+		Filters: map[string]string{"traits." + path: userName},
+	})
+	if err != nil {
+		return err
+	}
+	idents, _, err := m.identityPool.ListIdentities(ctx, o.NetworkID, 2, 0, f)
+	if err != nil {
+		return err
+	}
+	for _, ident := range idents {
+		if ident.ID != self {
+			return fmt.Errorf("%w: userName %q is taken", ErrUniqueness, userName)
+		}
+	}
+	return nil
+}
+
+// userTraits sets the mapped attributes of u in traits, removing those u
+// lacks.
+func (m *ManagerImpl) userTraits(u *User, traits json.RawMessage) (json.RawMessage, error) {
+	obj := map[string]any{}
+	if len(traits) > 0 {
+		if err := json.Unmarshal(traits, &obj); err != nil {
+			return nil, err
+		}
+	}
+	for name, path := range m.config.Attributes {
+		if path != "" {
+			setTrait(obj, strings.Split(path, "."), userAttribute(u, name))
+		}
+	}
+	return json.Marshal(obj)
+}
+
+// toUser returns the user of an identity.
+func (m *ManagerImpl) toUser(ident *identity.Identity, groups []Member, o *Origin) *User {
+	id := ident.ID.String()
+	active := ident.State.IsActive()
+	u := UserFromTraits(ident.Traits, m.config.Attributes)
+	u.ID = id
+	u.Active = &active
+	u.Groups = groups
+	u.Meta = &Meta{
+		ResourceType: "User",
+		Created:      ident.CreatedAt,
+		LastModified: ident.UpdatedAt,
+		Location:     location(o, "Users", id),
+	}
+	return u
+}
+
+// UserFromTraits returns a user holding the attributes attrs maps from
+// traits, see Config.Attributes.
+func UserFromTraits(traits json.RawMessage, attrs map[string]string) *User {
+	obj := map[string]any{}
+	_ = json.Unmarshal(traits, &obj)
+
+	u := &User{Schemas: []string{SchemaUser}}
+	for name, path := range attrs {
+		if path == "" {
+			continue
+		}
+		if s, ok := trait(obj, strings.Split(path, ".")).(string); ok {
+			setUserAttribute(u, name, s)
+		}
+	}
+	return u
+}
+
+// userAttribute returns the value of a mapped attribute of u.
+func userAttribute(u *User, name string) string {
+	switch name {
+	case "userName":
+		return u.UserName
+	case "externalId":
+		return u.ExternalID
+	case "displayName":
+		return u.DisplayName
+	case "emails":
+		return primary(u.Emails)
+	case "phoneNumbers":
+		return primary(u.PhoneNumbers)
+	}
+	if u.Name == nil {
+		return ""
+	}
+	switch name {
+	case "name.givenName":
+		return u.Name.GivenName
+	case "name.familyName":
+		return u.Name.FamilyName
+	case "name.formatted":
+		return u.Name.Formatted
+	}
+	return ""
+}
+
+// setUserAttribute sets a mapped attribute of u.
+func setUserAttribute(u *User, name, value string) {
+	switch name {
+	case "userName":
+		u.UserName = value
+	case "externalId":
+		u.ExternalID = value
+	case "displayName":
+		u.DisplayName = value
+	case "emails":
+		u.Emails = []MultiValued{{Value: value, Type: "work", Primary: true}}
+	case "phoneNumbers":
+		u.PhoneNumbers = []MultiValued{{Value: value, Type: "work", Primary: true}}
+	default:
+		if u.Name == nil {
+			u.Name = &Name{}
+		}
+		switch name {
+		case "name.givenName":
+			u.Name.GivenName = value
+		case "name.familyName":
+			u.Name.FamilyName = value
+		case "name.formatted":
+			u.Name.Formatted = value
+		}
+	}
+}
+
+// primary returns the primary value of a multi-valued attribute, or its
+// first value.
+func primary(values []MultiValued) string {
+	for _, v := range values {
+		if v.Primary {
+			return v.Value
+		}
+	}
+	if len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
+
+// trait returns the trait at path.
+func trait(traits map[string]any, path []string) any {
+	v, ok := traits[path[0]]
+	if !ok || len(path) == 1 {
+		return v
+	}
+	obj, _ := v.(map[string]any)
+	if obj == nil {
+		return nil
+	}
+	return trait(obj, path[1:])
+}
+
+// setTrait sets the trait at path, creating objects on the way, or
+// removes it when value is empty.
+func setTrait(traits map[string]any, path []string, value string) {
+	if len(path) == 1 {
+		if value == "" {
+			delete(traits, path[0])
+		} else {
+			traits[path[0]] = value
+		}
+		return
+	}
+	obj, _ := traits[path[0]].(map[string]any)
+	if obj == nil {
+		if value == "" {
+			return
+		}
+		obj = map[string]any{}
+		traits[path[0]] = obj
+	}
+	setTrait(obj, path[1:], value)
+}
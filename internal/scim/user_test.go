@@ -0,0 +1,125 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/authz/role"
+	"github.com/coding-hui/iam/internal/identity"
+)
+
+// identities keeps a single identity in memory.
+type identities struct {
+	identity.Manager
+	ident *identity.Identity
+}
+
+func (p *identities) GetIdentity(_ context.Context, id uuid.UUID) (*identity.Identity, error) {
+	if id != p.ident.ID {
+		return nil, identity.ErrIdentityNotFound
+	}
+	i := *p.ident
+	return &i, nil
+}
+
+func (p *identities) UpdateIdentity(ctx context.Context, id uuid.UUID, req *identity.UpdateIdentityRequest) (*identity.Identity, error) {
+	p.ident.Traits = req.Traits
+	return p.GetIdentity(ctx, id)
+}
+
+func (p *identities) TransitionState(ctx context.Context, id uuid.UUID, req *identity.TransitionStateRequest) (*identity.Identity, error) {
+	p.ident.State = req.State
+	return p.GetIdentity(ctx, id)
+}
+
+// identityPool holds no other identities.
+type identityPool struct {
+	identity.Pool
+}
+
+func (identityPool) ListIdentities(context.Context, uuid.UUID, int, int, *identity.ListFilter) ([]*identity.Identity, int, error) {
+	return nil, 0, nil
+}
+
+type roles struct {
+	role.Pool
+}
+
+func (roles) ListRoles(context.Context, uuid.UUID, int, int) ([]*role.Role, int, error) {
+	return nil, 0, nil
+}
+
+func (roles) ListRoleBindings(context.Context, uuid.UUID) ([]*role.RoleBinding, error) {
+	return nil, nil
+}
+
+// TestPatchUserActive replays the recorded PATCH requests that change
+// active against identities in every state.
+func TestPatchUserActive(t *testing.T) {
+	data, err := os.ReadFile("testdata/patch.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []struct {
+		Name    string       `json:"name"`
+		Request PatchRequest `json:"request"`
+	}
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+	requests := map[string]*PatchRequest{}
+	for _, tc := range cases {
+		requests[tc.Name] = &tc.Request
+	}
+
+	tests := []struct {
+		request    string
+		from, want identity.State
+	}{
+		{"azure ad disables a user", identity.StateActive, identity.StateInactive},
+		{"azure ad disables a user", identity.StateSuspended, identity.StateSuspended},
+		{"okta deactivates a user", identity.StateActive, identity.StateInactive},
+		{"okta deactivates a user", identity.StatePendingDeletion, identity.StatePendingDeletion},
+		{"azure ad enables a user", identity.StateInactive, identity.StateActive},
+		{"azure ad enables a user", identity.StateSuspended, identity.StateSuspended},
+		{"azure ad enables a user", identity.StatePendingDeletion, identity.StatePendingDeletion},
+		{"okta reactivates a user", identity.StateInactive, identity.StateActive},
+		{"okta reactivates a user", identity.StateSuspended, identity.StateSuspended},
+		{"okta reactivates a user", identity.StatePendingDeletion, identity.StatePendingDeletion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.request+" from "+string(tt.from), func(t *testing.T) {
+			req, ok := requests[tt.request]
+			if !ok {
+				t.Fatalf("no recorded request %q", tt.request)
+			}
+			o := &Origin{NetworkID: uuid.New()}
+			ids := &identities{ident: &identity.Identity{
+				ID:        uuid.New(),
+				NetworkID: o.NetworkID,
+				Traits:    json.RawMessage(`{"username":"ann"}`),
+				State:     tt.from,
+			}}
+			m := NewManagerImpl(nil, ids, identityPool{}, nil, roles{})
+
+			u, err := m.PatchUser(context.Background(), o, ids.ident.ID.String(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids.ident.State != tt.want {
+				t.Errorf("state = %s, want %s", ids.ident.State, tt.want)
+			}
+			if *u.Active != tt.want.IsActive() {
+				t.Errorf("active = %t, want %t", *u.Active, tt.want.IsActive())
+			}
+		})
+	}
+}
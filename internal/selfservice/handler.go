@@ -6,25 +6,63 @@ package selfservice
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/password"
 	"github.com/coding-hui/iam/internal/selfservice/strategies"
 	"github.com/coding-hui/iam/pkg/api"
+
+	"github.com/coding-hui/common/errors"
 )
 
 // Handler handles HTTP requests for selfservice operations.
 type Handler struct {
+	identities            identity.Manager
 	passwordAuthenticator *strategies.PasswordAuthenticator
+	oauthAuthenticator    *strategies.OAuthAuthenticator
 	mfaManager            *strategies.ManagerImpl
 }
 
+// OAuthFlow is a started OAuth flow; the client continues it at URL.
+type OAuthFlow struct {
+	URL   string `json:"url"`
+	State string `json:"state"`
+}
+
 // NewHandler creates a new selfservice handler.
-func NewHandler(passwordAuthenticator *strategies.PasswordAuthenticator, mfaManager *strategies.ManagerImpl) *Handler {
+func NewHandler(identities identity.Manager, passwordAuthenticator *strategies.PasswordAuthenticator, oauthAuthenticator *strategies.OAuthAuthenticator, mfaManager *strategies.ManagerImpl) *Handler {
 	return &Handler{
+		identities:            identities,
 		passwordAuthenticator: passwordAuthenticator,
+		oauthAuthenticator:    oauthAuthenticator,
 		mfaManager:            mfaManager,
 	}
 }
 
+// Whoami handles GET /api/v1/whoami.
+// It returns the authenticated identity as the identity may see it,
+// without admin metadata.
+func (h *Handler) Whoami(c *gin.Context) {
+	identityID, err := uuid.Parse(c.GetString("identity_id"))
+	if err != nil {
+		api.FailWithMessage("invalid identity_id", c)
+		return
+	}
+
+	ident, err := h.identities.GetIdentity(c.Request.Context(), identityID)
+	if err != nil {
+		if errors.Is(err, identity.ErrIdentityNotFound) {
+			api.FailWithMessage(err.Error(), c)
+			return
+		}
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(ident.SelfService(), c)
+}
+
 // Login handles POST /api/v1/login.
 func (h *Handler) Login(c *gin.Context) {
 	var req strategies.AuthenticateRequest
@@ -35,6 +73,9 @@ func (h *Handler) Login(c *gin.Context) {
 
 	req.UserAgent = c.GetHeader("User-Agent")
 	req.ClientIP = c.ClientIP()
+	if networkID, err := uuid.Parse(c.GetString("network_id")); err == nil {
+		req.NetworkID = networkID
+	}
 
 	resp, err := h.passwordAuthenticator.Authenticate(c.Request.Context(), &req)
 	if err != nil {
@@ -45,6 +86,118 @@ func (h *Handler) Login(c *gin.Context) {
 	api.OkWithData(resp, c)
 }
 
+// ChangePassword handles POST /api/v1/login/password.
+// It replaces a password that has to be changed before login, using the
+// token returned by Login, and issues a session.
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req strategies.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.FailWithMessage("invalid request: "+err.Error(), c)
+		return
+	}
+
+	req.UserAgent = c.GetHeader("User-Agent")
+	req.ClientIP = c.ClientIP()
+
+	resp, err := h.passwordAuthenticator.ChangePassword(c.Request.Context(), &req)
+	if err != nil {
+		var perr *password.PolicyError
+		if errors.As(err, &perr) {
+			api.FailWithDetailed(perr.Violations, err, c)
+			return
+		}
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(resp, c)
+}
+
+// OAuthLogin handles GET /api/v1/oauth/:provider/login.
+// It starts a login with a provider.
+func (h *Handler) OAuthLogin(c *gin.Context) {
+	url, state, err := h.oauthAuthenticator.InitiateOAuthFlow(c.Request.Context(), strategies.OAuthProvider(c.Param("provider")), c.Query("redirect_url"))
+	if err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(&OAuthFlow{URL: url, State: state.State}, c)
+}
+
+// OAuthCallback handles GET /api/v1/oauth/:provider/callback.
+// It completes a login or a link flow.
+func (h *Handler) OAuthCallback(c *gin.Context) {
+	state, authCode := c.Query("state"), c.Query("code")
+	if state == "" || authCode == "" {
+		api.FailWithMessage("state and code are required", c)
+		return
+	}
+
+	resp, err := h.oauthAuthenticator.HandleOAuthCallback(c.Request.Context(), strategies.OAuthProvider(c.Param("provider")), state, authCode)
+	if err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(resp, c)
+}
+
+// ListLinks handles GET /api/v1/oauth/links.
+// It lists the provider accounts linked to the authenticated identity.
+func (h *Handler) ListLinks(c *gin.Context) {
+	identityID, err := uuid.Parse(c.GetString("identity_id"))
+	if err != nil {
+		api.FailWithMessage("invalid identity_id", c)
+		return
+	}
+
+	providers, err := h.oauthAuthenticator.ListLinkedProviders(c.Request.Context(), identityID)
+	if err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(providers, c)
+}
+
+// Link handles POST /api/v1/oauth/links/:provider.
+// It starts a flow linking a provider account to the authenticated
+// identity, which completes at the callback.
+func (h *Handler) Link(c *gin.Context) {
+	identityID, err := uuid.Parse(c.GetString("identity_id"))
+	if err != nil {
+		api.FailWithMessage("invalid identity_id", c)
+		return
+	}
+
+	url, state, err := h.oauthAuthenticator.InitiateLinkFlow(c.Request.Context(), strategies.OAuthProvider(c.Param("provider")), identityID, c.Query("redirect_url"))
+	if err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.OkWithData(&OAuthFlow{URL: url, State: state.State}, c)
+}
+
+// Unlink handles DELETE /api/v1/oauth/links/:provider.
+// It removes a provider account from the authenticated identity unless it
+// is the last way to log in.
+func (h *Handler) Unlink(c *gin.Context) {
+	identityID, err := uuid.Parse(c.GetString("identity_id"))
+	if err != nil {
+		api.FailWithMessage("invalid identity_id", c)
+		return
+	}
+
+	if err := h.oauthAuthenticator.UnlinkProvider(c.Request.Context(), identityID, strategies.OAuthProvider(c.Param("provider"))); err != nil {
+		api.FailWithErrCode(err, c)
+		return
+	}
+
+	api.Ok(c)
+}
+
 // SetupTOTP handles POST /api/v1/mfa/totp/setup.
 func (h *Handler) SetupTOTP(c *gin.Context) {
 	// TODO: implement
@@ -11,15 +11,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/oauth2"
 
 	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/schema"
 	"github.com/coding-hui/iam/internal/identity/session"
+	"github.com/coding-hui/iam/pkg/code"
+
+	"github.com/coding-hui/common/errors"
 )
 
+// oauthStateTTL is how long an OAuth flow may take.
+const oauthStateTTL = 10 * time.Minute
+
+// StateProviderLinked means the provider account was linked to the
+// identity that started the flow with InitiateLinkFlow; no session is
+// issued.
+const StateProviderLinked = "provider_linked"
+
 // OAuthProvider represents an OAuth2 provider.
 type OAuthProvider string
 
@@ -30,26 +44,33 @@ const (
 
 // OAuthState stores OAuth flow state.
 type OAuthState struct {
-	State       string    `json:"state"`
-	Provider    string    `json:"provider"`
+	State    string `json:"state"`
+	Provider string `json:"provider"`
+	// IdentityID is set on flows linking a provider account to an
+	// identity.
 	IdentityID  uuid.UUID `json:"identity_id,omitempty"`
 	RedirectURL string    `json:"redirect_url,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
-// OAuthAuthenticator implements OAuth2-based authentication.
+// OAuthAuthenticator implements OAuth2-based authentication. Provider
+// accounts are kept as oidc credentials, so an identity can log in with a
+// password and any number of linked providers.
 type OAuthAuthenticator struct {
 	identityPool identity.PrivilegedPool
-	sessionPool  sessionPool
+	sessionPool  session.PrivilegedPool
 	hasher       identity.Hasher
 	providers    map[OAuthProvider]*oauth2.Config
-	stateStore   map[string]*OAuthState
+	autoLink     bool
+
+	mu         sync.Mutex
+	stateStore map[string]*OAuthState
 }
 
 // NewOAuthAuthenticator creates a new OAuth authenticator.
 func NewOAuthAuthenticator(
 	identityPool identity.PrivilegedPool,
-	sessionPool sessionPool,
+	sessionPool session.PrivilegedPool,
 	hasher identity.Hasher,
 ) *OAuthAuthenticator {
 	return &OAuthAuthenticator{
@@ -66,11 +87,37 @@ func (a *OAuthAuthenticator) RegisterProvider(provider OAuthProvider, config *oa
 	a.providers[provider] = config
 }
 
+// SetAutoLink makes logins with a provider account that is not linked yet
+// link it to the identity owning its email address, instead of creating a
+// new identity. Both the provider and the identity must have verified the
+// address, so that nobody can take over an account by registering its
+// address first.
+func (a *OAuthAuthenticator) SetAutoLink(enabled bool) {
+	a.autoLink = enabled
+}
+
 // InitiateOAuthFlow initiates an OAuth2 flow and returns the authorization URL.
 func (a *OAuthAuthenticator) InitiateOAuthFlow(ctx context.Context, provider OAuthProvider, redirectURL string) (string, *OAuthState, error) {
+	return a.initiate(provider, uuid.Nil, redirectURL)
+}
+
+// InitiateLinkFlow initiates an OAuth2 flow linking a provider account to
+// an authenticated identity and returns the authorization URL.
+func (a *OAuthAuthenticator) InitiateLinkFlow(ctx context.Context, provider OAuthProvider, identityID uuid.UUID, redirectURL string) (string, *OAuthState, error) {
+	ident, err := a.identityPool.GetIdentity(ctx, identityID)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := ident.CheckActive(); err != nil {
+		return "", nil, err
+	}
+	return a.initiate(provider, identityID, redirectURL)
+}
+
+func (a *OAuthAuthenticator) initiate(provider OAuthProvider, identityID uuid.UUID, redirectURL string) (string, *OAuthState, error) {
 	cfg, ok := a.providers[provider]
 	if !ok {
-		return "", nil, fmt.Errorf("unsupported OAuth provider: %s", provider)
+		return "", nil, providerError(provider)
 	}
 
 	stateStr, err := generateState()
@@ -81,12 +128,15 @@ func (a *OAuthAuthenticator) InitiateOAuthFlow(ctx context.Context, provider OAu
 	state := &OAuthState{
 		State:       stateStr,
 		Provider:    string(provider),
+		IdentityID:  identityID,
 		RedirectURL: redirectURL,
 		CreatedAt:   time.Now(),
 	}
 
 	// Store state in memory
+	a.mu.Lock()
 	a.stateStore[stateStr] = state
+	a.mu.Unlock()
 
 	authURL := cfg.AuthCodeURL(stateStr,
 		oauth2.AccessTypeOnline,
@@ -96,28 +146,44 @@ func (a *OAuthAuthenticator) InitiateOAuthFlow(ctx context.Context, provider OAu
 	return authURL, state, nil
 }
 
-// HandleOAuthCallback handles the OAuth2 callback.
-func (a *OAuthAuthenticator) HandleOAuthCallback(ctx context.Context, provider OAuthProvider, code string) (*AuthenticateResponse, error) {
+// HandleOAuthCallback handles the OAuth2 callback. A flow started with
+// InitiateLinkFlow links the provider account and ends in state
+// StateProviderLinked; other flows log in.
+func (a *OAuthAuthenticator) HandleOAuthCallback(ctx context.Context, provider OAuthProvider, state, authCode string) (*AuthenticateResponse, error) {
 	cfg, ok := a.providers[provider]
 	if !ok {
-		return nil, fmt.Errorf("unsupported OAuth provider: %s", provider)
+		return nil, providerError(provider)
+	}
+	st, err := a.takeState(provider, state)
+	if err != nil {
+		return nil, err
 	}
 
-	token, err := cfg.Exchange(ctx, code)
+	token, err := cfg.Exchange(ctx, authCode)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange code: %w", err)
 	}
 
 	// Get user info from provider
-	userInfo, err := a.fetchUserInfo(ctx, provider, token)
+	userInfo, err := a.fetchUserInfo(ctx, provider, cfg.Client(ctx, token))
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch user info: %w", err)
 	}
 
+	if st.IdentityID != uuid.Nil {
+		if err := a.link(ctx, st.IdentityID, userInfo); err != nil {
+			return nil, err
+		}
+		return &AuthenticateResponse{State: StateProviderLinked, IdentityID: st.IdentityID}, nil
+	}
+
 	// Find or create identity
 	ident, err := a.findOrCreateIdentity(ctx, provider, userInfo)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find or create identity: %w", err)
+		return nil, err
+	}
+	if err := ident.CheckActive(); err != nil {
+		return nil, err
 	}
 
 	// Create session
@@ -127,82 +193,166 @@ func (a *OAuthAuthenticator) HandleOAuthCallback(ctx context.Context, provider O
 	}
 
 	return &AuthenticateResponse{
+		State:      StateAuthenticated,
 		SessionID:  sess.ID,
 		IdentityID: ident.ID,
 		ExpiresAt:  sess.ExpiresAt.Unix(),
 	}, nil
 }
 
+// ListLinkedProviders lists the provider accounts linked to an identity.
+func (a *OAuthAuthenticator) ListLinkedProviders(ctx context.Context, identityID uuid.UUID) ([]*identity.LinkedProvider, error) {
+	ident, err := a.identityPool.GetIdentityWithCredentials(ctx, identityID)
+	if err != nil {
+		return nil, err
+	}
+	config, err := identity.ParseCredentialsOIDC(ident.Credentials[identity.CredentialsTypeOIDC])
+	if err != nil {
+		return nil, err
+	}
+	return config.Providers, nil
+}
+
+// UnlinkProvider removes the account of a provider from an identity. The
+// last way an identity can log in cannot be removed.
+func (a *OAuthAuthenticator) UnlinkProvider(ctx context.Context, identityID uuid.UUID, provider OAuthProvider) error {
+	ident, err := a.identityPool.GetIdentityWithCredentials(ctx, identityID)
+	if err != nil {
+		return err
+	}
+	cred := ident.Credentials[identity.CredentialsTypeOIDC]
+	config, err := identity.ParseCredentialsOIDC(cred)
+	if err != nil {
+		return err
+	}
+	if config.Find(string(provider)) == nil {
+		return errors.WrapC(identity.ErrCredentialsNotFound, code.ErrIdentityCredentialsInvalid, "provider %s is not linked", provider)
+	}
+	methods, err := identity.LoginMethods(ident.Credentials)
+	if err != nil {
+		return err
+	}
+	if methods <= 1 {
+		return errors.WrapC(identity.ErrLastCredentials, code.ErrIdentityLastCredentials, "%s", identity.ErrLastCredentials.Error())
+	}
+
+	config.Unlink(string(provider))
+	if len(config.Providers) == 0 {
+		return a.identityPool.DeleteCredentials(ctx, ident.NetworkID, ident.ID, identity.CredentialsTypeOIDC)
+	}
+	return a.writeCredentials(ctx, ident, cred, config)
+}
+
 type oauthUserInfo struct {
 	ID       string `json:"id"`
 	Email    string `json:"email"`
 	Name     string `json:"name"`
 	Picture  string `json:"picture"`
 	Provider string `json:"provider"`
+	// EmailVerified reports whether the provider verified Email.
+	EmailVerified bool `json:"verified_email"`
 }
 
-func (a *OAuthAuthenticator) fetchUserInfo(ctx context.Context, provider OAuthProvider, token *oauth2.Token) (*oauthUserInfo, error) {
+func (a *OAuthAuthenticator) fetchUserInfo(ctx context.Context, provider OAuthProvider, client *http.Client) (*oauthUserInfo, error) {
 	switch provider {
 	case OAuthProviderGitHub:
-		return a.fetchGitHubUserInfo(ctx, token)
+		return a.fetchGitHubUserInfo(ctx, client)
 	case OAuthProviderGoogle:
-		return a.fetchGoogleUserInfo(ctx, token)
+		return a.fetchGoogleUserInfo(ctx, client)
 	default:
-		return nil, fmt.Errorf("unsupported provider: %s", provider)
+		return nil, providerError(provider)
 	}
 }
 
-func (a *OAuthAuthenticator) fetchGitHubUserInfo(ctx context.Context, token *oauth2.Token) (*oauthUserInfo, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.github.com/user", nil)
-	if err != nil {
+func (a *OAuthAuthenticator) fetchGitHubUserInfo(ctx context.Context, client *http.Client) (*oauthUserInfo, error) {
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user", &user); err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
+	// The profile email need not be verified; the verified primary email
+	// is listed separately.
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user/emails", &emails); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
+	userInfo := &oauthUserInfo{
+		ID:       strconv.FormatInt(user.ID, 10),
+		Name:     user.Name,
+		Picture:  user.AvatarURL,
+		Provider: string(OAuthProviderGitHub),
+	}
+	if userInfo.Name == "" {
+		userInfo.Name = user.Login
+	}
+	for _, e := range emails {
+		if e.Primary {
+			userInfo.Email, userInfo.EmailVerified = e.Email, e.Verified
+		}
+	}
+	return userInfo, nil
+}
+
+func (a *OAuthAuthenticator) fetchGoogleUserInfo(ctx context.Context, client *http.Client) (*oauthUserInfo, error) {
 	var userInfo oauthUserInfo
-	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
+	if err := getJSON(ctx, client, "https://www.googleapis.com/oauth2/v2/userinfo", &userInfo); err != nil {
 		return nil, err
 	}
-	userInfo.Provider = string(OAuthProviderGitHub)
+	userInfo.Provider = string(OAuthProviderGoogle)
 	return &userInfo, nil
 }
 
-func (a *OAuthAuthenticator) fetchGoogleUserInfo(ctx context.Context, token *oauth2.Token) (*oauthUserInfo, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://www.googleapis.com/oauth2/v2/userinfo", nil)
+// getJSON decodes the response of a provider API call into v. The client
+// authorizes the call with the access token.
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
 
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 
-	var userInfo oauthUserInfo
-	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-		return nil, err
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
 	}
-	userInfo.Provider = string(OAuthProviderGoogle)
-	return &userInfo, nil
+	return json.NewDecoder(resp.Body).Decode(v)
 }
 
+// findOrCreateIdentity returns the identity a provider account is linked
+// to. Unlinked accounts are linked to the identity owning their email
+// address when auto-linking is enabled, or get a new identity.
 func (a *OAuthAuthenticator) findOrCreateIdentity(ctx context.Context, provider OAuthProvider, userInfo *oauthUserInfo) (*identity.Identity, error) {
-	identifier := fmt.Sprintf("%s:%s", provider, userInfo.ID)
+	identifier := identity.OIDCIdentifier(string(provider), userInfo.ID)
+
+	// Find existing identity of the default network by OAuth provider
+	// ID. Accounts used to be kept as api_key credentials, which still
+	// log in.
+	for _, t := range []identity.CredentialsType{identity.CredentialsTypeOIDC, identity.CredentialsTypeAPIKey} {
+		existing, _, err := a.identityPool.FindCredentialsByIdentifier(ctx, uuid.Nil, t, identifier)
+		if err == nil {
+			return existing, nil
+		}
+		if !errors.Is(err, identity.ErrIdentityNotFound) {
+			return nil, err
+		}
+	}
 
-	// Find existing identity by OAuth provider ID
-	existing, _, err := a.sessionPool.FindCredentialsByIdentifier(ctx, identity.CredentialsTypeAPIKey, identifier)
-	if err == nil && existing != nil {
-		return existing, nil
+	if ident, err := a.autoLinkIdentity(ctx, userInfo); err != nil || ident != nil {
+		return ident, err
 	}
 
 	// Create new identity
@@ -217,6 +367,7 @@ func (a *OAuthAuthenticator) findOrCreateIdentity(ctx context.Context, provider
 		ID:        uuid.New(),
 		SchemaID:  "oauth",
 		Traits:    traitsJSON,
+		State:     identity.StateActive,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -224,27 +375,87 @@ func (a *OAuthAuthenticator) findOrCreateIdentity(ctx context.Context, provider
 	if err := a.identityPool.CreateIdentity(ctx, newIdentity); err != nil {
 		return nil, err
 	}
-
-	// Create OAuth credentials
-	credConfig, _ := json.Marshal(map[string]any{
-		"provider":    provider,
-		"provider_id": userInfo.ID,
-	})
-	newCred := &identity.Credentials{
-		ID:          uuid.New(),
-		IdentityID:  newIdentity.ID,
-		Type:        identity.CredentialsTypeAPIKey,
-		Identifiers: []string{identifier},
-		Config:      credConfig,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	if err := a.link(ctx, newIdentity.ID, userInfo); err != nil {
+		return nil, err
 	}
 
-	if err := a.identityPool.CreateCredentials(ctx, newCred); err != nil {
+	return newIdentity, nil
+}
+
+// autoLinkIdentity links a provider account to the identity of the
+// default network owning its verified email address and returns the
+// identity, or nil when there is none or auto-linking is disabled.
+func (a *OAuthAuthenticator) autoLinkIdentity(ctx context.Context, userInfo *oauthUserInfo) (*identity.Identity, error) {
+	if !a.autoLink || !userInfo.EmailVerified || userInfo.Email == "" {
+		return nil, nil
+	}
+	addr, err := a.identityPool.FindVerifiableAddress(ctx, uuid.Nil, schema.ViaEmail, userInfo.Email)
+	if errors.Is(err, identity.ErrAddressNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !addr.Verified {
+		return nil, nil
+	}
+	if err := a.link(ctx, addr.IdentityID, userInfo); err != nil {
 		return nil, err
 	}
+	return a.identityPool.GetIdentity(ctx, addr.IdentityID)
+}
 
-	return newIdentity, nil
+// link links a provider account to an identity, replacing another account
+// of the provider. An account linked to another identity is rejected.
+func (a *OAuthAuthenticator) link(ctx context.Context, identityID uuid.UUID, userInfo *oauthUserInfo) error {
+	ident, err := a.identityPool.GetIdentityWithCredentials(ctx, identityID)
+	if err != nil {
+		return err
+	}
+	cred := ident.Credentials[identity.CredentialsTypeOIDC]
+	config, err := identity.ParseCredentialsOIDC(cred)
+	if err != nil {
+		return err
+	}
+	config.Link(&identity.LinkedProvider{
+		Provider: userInfo.Provider,
+		Subject:  userInfo.ID,
+		Email:    userInfo.Email,
+		LinkedAt: time.Now(),
+	})
+	return a.writeCredentials(ctx, ident, cred, config)
+}
+
+// writeCredentials stores the oidc credentials of an identity; cred is nil
+// when the identity has none yet.
+func (a *OAuthAuthenticator) writeCredentials(ctx context.Context, ident *identity.Identity, cred *identity.Credentials, config *identity.CredentialsOIDC) error {
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	exists := cred != nil
+	if !exists {
+		cred = &identity.Credentials{
+			ID:         uuid.New(),
+			IdentityID: ident.ID,
+			Type:       identity.CredentialsTypeOIDC,
+			CreatedAt:  now,
+		}
+	}
+	cred.Identifiers = config.Identifiers()
+	cred.Config = raw
+	cred.UpdatedAt = now
+
+	if exists {
+		err = a.identityPool.UpdateCredentials(ctx, cred)
+	} else {
+		err = a.identityPool.CreateCredentials(ctx, cred)
+	}
+	if errors.Is(err, identity.ErrIdentifierInUse) {
+		return errors.WrapC(err, code.ErrIdentityIdentifierInUse, "provider account is linked to another identity")
+	}
+	return err
 }
 
 func (a *OAuthAuthenticator) createSession(ctx context.Context, ident *identity.Identity, userInfo *oauthUserInfo) (*session.Session, error) {
@@ -267,6 +478,30 @@ func (a *OAuthAuthenticator) createSession(ctx context.Context, ident *identity.
 	return sess, nil
 }
 
+// takeState removes the state of a flow of a provider and returns it
+// unless it has expired.
+func (a *OAuthAuthenticator) takeState(provider OAuthProvider, state string) (*OAuthState, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	for k, st := range a.stateStore {
+		if now.Sub(st.CreatedAt) > oauthStateTTL {
+			delete(a.stateStore, k)
+		}
+	}
+	st, ok := a.stateStore[state]
+	if !ok || st.Provider != string(provider) {
+		return nil, errors.WithCode(code.ErrIdentityOAuthStateInvalid, "OAuth state is invalid or expired")
+	}
+	delete(a.stateStore, state)
+	return st, nil
+}
+
+func providerError(provider OAuthProvider) error {
+	return errors.WithCode(code.ErrIdentityProviderNotFound, "unsupported OAuth provider: %s", provider)
+}
+
 func generateState() (string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
@@ -274,9 +509,3 @@ func generateState() (string, error) {
 	}
 	return base64.URLEncoding.EncodeToString(b), nil
 }
-
-// sessionPool interface for session operations used by OAuth authenticator.
-type sessionPool interface {
-	FindCredentialsByIdentifier(ctx context.Context, credType identity.CredentialsType, identifier string) (*identity.Identity, *identity.Credentials, error)
-	CreateSession(ctx context.Context, s *session.Session) error
-}
@@ -0,0 +1,82 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package strategies
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+
+	"github.com/coding-hui/iam/internal/identity"
+)
+
+// google answers the token and userinfo requests of Google logins of the
+// account with ID 123.
+type google struct{}
+
+func (google) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := `{"id":"123","email":"ann@example.com","verified_email":true}`
+	if req.URL.Host == "oauth2.example.com" {
+		body = `{"access_token":"token","token_type":"bearer","expires_in":3600}`
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestOAuthLoginRequiresActiveIdentity(t *testing.T) {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: google{}})
+
+	for _, state := range []identity.State{identity.StateActive, identity.StateInactive, identity.StateSuspended, identity.StatePendingDeletion} {
+		t.Run(string(state), func(t *testing.T) {
+			ident := &identity.Identity{ID: uuid.New(), State: state}
+			ids := &identities{ident: ident, cred: &identity.Credentials{
+				IdentityID:  ident.ID,
+				Type:        identity.CredentialsTypeOIDC,
+				Identifiers: []string{identity.OIDCIdentifier(string(OAuthProviderGoogle), "123")},
+			}}
+			sess := &sessions{}
+			a := NewOAuthAuthenticator(ids, sess, newTestHasher(t))
+			a.RegisterProvider(OAuthProviderGoogle, &oauth2.Config{
+				ClientID: "iam",
+				Endpoint: oauth2.Endpoint{AuthURL: "https://oauth2.example.com/auth", TokenURL: "https://oauth2.example.com/token"},
+			})
+
+			_, st, err := a.InitiateOAuthFlow(ctx, OAuthProviderGoogle, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := a.HandleOAuthCallback(ctx, OAuthProviderGoogle, st.State, "code")
+			_, _, linkErr := a.InitiateLinkFlow(ctx, OAuthProviderGoogle, ident.ID, "")
+			if state.IsActive() {
+				if err != nil || resp.IdentityID != ident.ID || len(sess.created) != 1 {
+					t.Errorf("HandleOAuthCallback() = %+v, %v with %d sessions, want a session", resp, err, len(sess.created))
+				}
+				if linkErr != nil {
+					t.Errorf("InitiateLinkFlow() error = %v", linkErr)
+				}
+				return
+			}
+			if !errors.Is(err, identity.ErrIdentityInactive) {
+				t.Errorf("HandleOAuthCallback() error = %v, want ErrIdentityInactive", err)
+			}
+			if len(sess.created) != 0 {
+				t.Errorf("HandleOAuthCallback() created %d sessions, want none", len(sess.created))
+			}
+			if !errors.Is(linkErr, identity.ErrIdentityInactive) {
+				t.Errorf("InitiateLinkFlow() error = %v, want ErrIdentityInactive", linkErr)
+			}
+		})
+	}
+}
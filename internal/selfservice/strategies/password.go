@@ -9,9 +9,34 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 
+	"github.com/coding-hui/iam/internal/authz/role"
 	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/password"
 	"github.com/coding-hui/iam/internal/identity/session"
+	"github.com/coding-hui/iam/internal/identity/token"
+	"github.com/coding-hui/iam/internal/identity/verification"
+	"github.com/coding-hui/iam/pkg/code"
+
+	"github.com/coding-hui/common/errors"
+)
+
+// passwordChangeTTL is how long a password change token stays valid.
+const passwordChangeTTL = 15 * time.Minute
+
+// Authentication states.
+const (
+	StateAuthenticated = "authenticated"
+	// StatePasswordChangeRequired means the password has to be changed
+	// with ChangePassword before a session is issued.
+	StatePasswordChangeRequired = "password_change_required"
+)
+
+// Reasons for a required password change.
+const (
+	PasswordChangeExpired  = "expired"
+	PasswordChangeRequired = "required"
 )
 
 // Authenticator defines the interface for authentication.
@@ -25,13 +50,57 @@ type AuthenticateRequest struct {
 	Password   string `json:"password"`
 	UserAgent  string `json:"user_agent"`
 	ClientIP   string `json:"client_ip"`
+	// NetworkID is the network the identifier is looked up in.
+	NetworkID uuid.UUID `json:"-"`
 }
 
-// AuthenticateResponse holds the result of authentication.
+// AuthenticateResponse holds the result of authentication. In state
+// StatePasswordChangeRequired no session is issued and PasswordChange is
+// set instead.
 type AuthenticateResponse struct {
-	SessionID  uuid.UUID `json:"session_id"`
-	IdentityID uuid.UUID `json:"identity_id"`
-	ExpiresAt  int64     `json:"expires_at"`
+	State          string          `json:"state"`
+	SessionID      uuid.UUID       `json:"session_id"`
+	IdentityID     uuid.UUID       `json:"identity_id"`
+	ExpiresAt      int64           `json:"expires_at"`
+	PasswordChange *PasswordChange `json:"password_change,omitempty"`
+}
+
+// PasswordChange describes a password that has to be changed before login.
+type PasswordChange struct {
+	// Reason is PasswordChangeExpired or PasswordChangeRequired.
+	Reason string `json:"reason"`
+	// Token authorizes a single ChangePassword until ExpiresAt.
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// ChangePasswordRequest holds data for replacing a password that has to
+// be changed before login.
+type ChangePasswordRequest struct {
+	Token     string `json:"token"`
+	Password  string `json:"password"`
+	UserAgent string `json:"user_agent"`
+	ClientIP  string `json:"client_ip"`
+}
+
+// PasswordRotation enforces password changes at login. Without it
+// passwords never expire and change requirements are ignored.
+type PasswordRotation struct {
+	// Expiry defines the maximum password ages; it is optional.
+	Expiry *password.ExpiryPolicy
+	// Roles resolves the roles of identities for Expiry.
+	Roles role.Pool
+	// Tokens issues the tokens of password changes.
+	Tokens token.Manager
+	// Identities sets new passwords, which must satisfy the password
+	// policy.
+	Identities identity.Manager
+}
+
+// AddressVerifier requires identities to have verified addresses before
+// they log in.
+type AddressVerifier interface {
+	RequireVerified(ctx context.Context, identityID uuid.UUID, action string) error
 }
 
 // PasswordAuthenticator implements password-based authentication.
@@ -39,6 +108,8 @@ type PasswordAuthenticator struct {
 	identityPool identity.PrivilegedPool
 	sessionPool  session.PrivilegedPool
 	hasher       identity.Hasher
+	rotation     *PasswordRotation
+	verifier     AddressVerifier
 }
 
 // NewPasswordAuthenticator creates a new password authenticator.
@@ -54,10 +125,24 @@ func NewPasswordAuthenticator(
 	}
 }
 
-// Authenticate authenticates a user using identifier and password.
+// SetPasswordRotation enables password changes at login.
+func (a *PasswordAuthenticator) SetPasswordRotation(r *PasswordRotation) {
+	a.rotation = r
+}
+
+// SetAddressVerifier makes logins require the verified addresses v
+// demands for verification.ActionLogin.
+func (a *PasswordAuthenticator) SetAddressVerifier(v AddressVerifier) {
+	a.verifier = v
+}
+
+// Authenticate authenticates a user using identifier and password. When
+// the password has expired or an administrator requires a change, a
+// password change token is returned instead of a session. Identities
+// without the verified addresses required for login are rejected.
 func (a *PasswordAuthenticator) Authenticate(ctx context.Context, req *AuthenticateRequest) (*AuthenticateResponse, error) {
 	// 1. Find identity and credentials by identifier
-	_, cred, err := a.identityPool.FindCredentialsByIdentifier(ctx, identity.CredentialsTypePassword, req.Identifier)
+	ident, cred, err := a.identityPool.FindCredentialsByIdentifier(ctx, req.NetworkID, identity.CredentialsTypePassword, req.Identifier)
 	if err != nil {
 		return nil, identity.ErrInvalidCredentials
 	}
@@ -67,15 +152,166 @@ func (a *PasswordAuthenticator) Authenticate(ctx context.Context, req *Authentic
 		return nil, identity.ErrInvalidCredentials
 	}
 
-	// 3. Create session
+	// 3. Check the identity state; it is only revealed with a valid password
+	if err := ident.CheckActive(); err != nil {
+		return nil, err
+	}
+
+	// 4. Require verified addresses
+	if a.verifier != nil {
+		if err := a.verifier.RequireVerified(ctx, ident.ID, verification.ActionLogin); err != nil {
+			return nil, err
+		}
+	}
+
+	// 5. Upgrade imported hashes; on failure the old hash keeps working
+	if a.hasher.NeedsRehash(cred.Config) {
+		if hash, err := a.hasher.Hash(req.Password); err == nil {
+			cred.Config = hash
+			cred.UpdatedAt = time.Now()
+			_ = a.identityPool.UpdateCredentials(ctx, cred)
+		}
+	}
+
+	// 6. Require a password change before issuing a session
+	reason, err := a.passwordChangeReason(ctx, ident, cred)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		t, err := a.rotation.Tokens.CreateToken(ctx, &token.CreateTokenRequest{
+			IdentityID: ident.ID,
+			Type:       token.TokenTypePasswordChange,
+			TTL:        passwordChangeTTL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &AuthenticateResponse{
+			State:      StatePasswordChangeRequired,
+			IdentityID: ident.ID,
+			PasswordChange: &PasswordChange{
+				Reason:    reason,
+				Token:     t.Value,
+				ExpiresAt: t.ExpiresAt.Unix(),
+			},
+		}, nil
+	}
+
+	// 7. Create session
+	return a.createSession(ctx, cred.IdentityID, req.UserAgent, req.ClientIP)
+}
+
+// ChangePassword replaces a password with a password change token from
+// Authenticate and issues a session. The new password must satisfy the
+// password policy and differ from the old one.
+func (a *PasswordAuthenticator) ChangePassword(ctx context.Context, req *ChangePasswordRequest) (*AuthenticateResponse, error) {
+	if a.rotation == nil {
+		return nil, identity.ErrInvalidCredentials
+	}
+	t, err := a.rotation.Tokens.IntrospectToken(ctx, req.Token)
+	if err != nil || t.Type != token.TokenTypePasswordChange {
+		return nil, identity.ErrInvalidCredentials
+	}
+
+	ident, err := a.identityPool.GetIdentityWithCredentials(ctx, t.IdentityID)
+	if err != nil {
+		return nil, err
+	}
+	if cred, ok := ident.Credentials[identity.CredentialsTypePassword]; ok {
+		if a.hasher.Verify(req.Password, cred.Config) == nil {
+			err := &password.PolicyError{Violations: []password.Violation{{
+				Rule:    password.RuleHistory,
+				Message: "password must differ from the current password",
+			}}}
+			return nil, errors.WrapC(err, code.ErrIdentityPasswordPolicyViolated, "%s", err.Error())
+		}
+	}
+
+	if err := a.rotation.Identities.AddCredentials(ctx, ident.ID, &identity.AddCredentialsRequest{
+		Type:     identity.CredentialsTypePassword,
+		Password: req.Password,
+	}); err != nil {
+		return nil, err
+	}
+	if err := a.rotation.Tokens.RevokeToken(ctx, t.ID); err != nil {
+		return nil, err
+	}
+
+	return a.createSession(ctx, ident.ID, req.UserAgent, req.ClientIP)
+}
+
+// passwordChangeReason returns why the password of an identity has to be
+// changed before login, or "" when it does not.
+func (a *PasswordAuthenticator) passwordChangeReason(ctx context.Context, ident *identity.Identity, cred *identity.Credentials) (string, error) {
+	if a.rotation == nil {
+		return "", nil
+	}
+	if cred.PasswordChangeRequired {
+		return PasswordChangeRequired, nil
+	}
+	expiry := a.rotation.Expiry
+	if expiry == nil {
+		return "", nil
+	}
+
+	var roles []string
+	if expiry.HasRoles() && a.rotation.Roles != nil {
+		var err error
+		if roles, err = a.grantedRoles(ctx, ident); err != nil {
+			return "", err
+		}
+	}
+	if expiry.Expired(cred.PasswordChangedAt, ident.NetworkID.String(), roles, time.Now()) {
+		return PasswordChangeExpired, nil
+	}
+	return "", nil
+}
+
+// grantedRoles returns the names and IDs of the roles an identity holds,
+// directly or through inheritance.
+func (a *PasswordAuthenticator) grantedRoles(ctx context.Context, ident *identity.Identity) ([]string, error) {
+	bindings, err := a.rotation.Roles.ListRoleBindingsBySubject(ctx, ident.NetworkID, ident.ID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []string
+	seen := make(map[uuid.UUID]bool, len(bindings))
+	queue := make([]uuid.UUID, len(bindings))
+	for i, b := range bindings {
+		queue[i] = b.RoleID
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		r, err := a.rotation.Roles.GetRoleByNetworkID(ctx, ident.NetworkID, id)
+		if errors.Is(err, role.ErrRoleNotFound) || errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, r.ID.String(), r.Name)
+		queue = append(queue, r.InheritFrom...)
+	}
+	return roles, nil
+}
+
+// createSession issues a session to an identity.
+func (a *PasswordAuthenticator) createSession(ctx context.Context, identityID uuid.UUID, userAgent, clientIP string) (*AuthenticateResponse, error) {
 	sess := &session.Session{
 		ID:              uuid.New(),
-		IdentityID:      cred.IdentityID,
+		IdentityID:      identityID,
 		Active:          true,
 		ExpiresAt:       time.Now().Add(24 * time.Hour),
 		AuthenticatedAt: time.Now(),
-		UserAgent:       req.UserAgent,
-		ClientIP:        req.ClientIP,
+		UserAgent:       userAgent,
+		ClientIP:        clientIP,
 	}
 
 	if err := a.sessionPool.CreateSession(ctx, sess); err != nil {
@@ -83,6 +319,7 @@ func (a *PasswordAuthenticator) Authenticate(ctx context.Context, req *Authentic
 	}
 
 	return &AuthenticateResponse{
+		State:      StateAuthenticated,
 		SessionID:  sess.ID,
 		IdentityID: sess.IdentityID,
 		ExpiresAt:  sess.ExpiresAt.Unix(),
@@ -0,0 +1,176 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package strategies
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/coding-hui/iam/internal/authz/role"
+	"github.com/coding-hui/iam/internal/identity"
+	"github.com/coding-hui/iam/internal/identity/password"
+	"github.com/coding-hui/iam/internal/identity/session"
+)
+
+// identities holds a single identity with credentials of one type.
+type identities struct {
+	identity.PrivilegedPool
+	ident *identity.Identity
+	cred  *identity.Credentials
+}
+
+func (p *identities) FindCredentialsByIdentifier(_ context.Context, _ uuid.UUID, credType identity.CredentialsType, identifier string) (*identity.Identity, *identity.Credentials, error) {
+	if credType != p.cred.Type {
+		return nil, nil, identity.ErrIdentityNotFound
+	}
+	for _, id := range p.cred.Identifiers {
+		if id == identifier {
+			i, c := *p.ident, *p.cred
+			return &i, &c, nil
+		}
+	}
+	return nil, nil, identity.ErrIdentityNotFound
+}
+
+func (p *identities) GetIdentity(_ context.Context, id uuid.UUID) (*identity.Identity, error) {
+	if id != p.ident.ID {
+		return nil, identity.ErrIdentityNotFound
+	}
+	i := *p.ident
+	return &i, nil
+}
+
+// sessions records created sessions.
+type sessions struct {
+	session.PrivilegedPool
+	created []*session.Session
+}
+
+func (p *sessions) CreateSession(_ context.Context, s *session.Session) error {
+	p.created = append(p.created, s)
+	return nil
+}
+
+// roles holds roles and bindings of a single network.
+type roles struct {
+	role.Pool
+	roles    map[uuid.UUID]*role.Role
+	bindings []*role.RoleBinding
+}
+
+func (p *roles) GetRoleByNetworkID(_ context.Context, _, id uuid.UUID) (*role.Role, error) {
+	r, ok := p.roles[id]
+	if !ok {
+		return nil, role.ErrRoleNotFound
+	}
+	return r, nil
+}
+
+func (p *roles) ListRoleBindingsBySubject(_ context.Context, _ uuid.UUID, subject string) ([]*role.RoleBinding, error) {
+	var bindings []*role.RoleBinding
+	for _, b := range p.bindings {
+		if b.Subject == subject {
+			bindings = append(bindings, b)
+		}
+	}
+	return bindings, nil
+}
+
+func newTestHasher(t *testing.T) identity.Hasher {
+	t.Helper()
+	hasher, err := identity.NewArgon2idHasherWithParams(identity.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hasher
+}
+
+func TestAuthenticateRequiresActiveIdentity(t *testing.T) {
+	ctx := context.Background()
+	hasher := newTestHasher(t)
+	hash, err := hasher.Hash("correct-horse-battery-9")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, state := range []identity.State{identity.StateActive, identity.StateInactive, identity.StateSuspended, identity.StatePendingDeletion} {
+		t.Run(string(state), func(t *testing.T) {
+			ident := &identity.Identity{ID: uuid.New(), State: state}
+			ids := &identities{ident: ident, cred: &identity.Credentials{
+				IdentityID:  ident.ID,
+				Type:        identity.CredentialsTypePassword,
+				Identifiers: []string{"ann@example.com"},
+				Config:      hash,
+			}}
+			sess := &sessions{}
+			a := NewPasswordAuthenticator(ids, sess, hasher)
+
+			// The state is only revealed with a valid password.
+			_, err := a.Authenticate(ctx, &AuthenticateRequest{Identifier: "ann@example.com", Password: "wrong"})
+			if !errors.Is(err, identity.ErrInvalidCredentials) {
+				t.Errorf("Authenticate() with a wrong password error = %v, want ErrInvalidCredentials", err)
+			}
+
+			resp, err := a.Authenticate(ctx, &AuthenticateRequest{Identifier: "ann@example.com", Password: "correct-horse-battery-9"})
+			if state.IsActive() {
+				if err != nil || resp.State != StateAuthenticated || len(sess.created) != 1 {
+					t.Errorf("Authenticate() = %+v, %v with %d sessions, want a session", resp, err, len(sess.created))
+				}
+				return
+			}
+			if !errors.Is(err, identity.ErrIdentityInactive) {
+				t.Errorf("Authenticate() error = %v, want ErrIdentityInactive", err)
+			}
+			if len(sess.created) != 0 {
+				t.Errorf("Authenticate() created %d sessions, want none", len(sess.created))
+			}
+		})
+	}
+}
+
+func TestPasswordExpiryOfInheritedRoles(t *testing.T) {
+	ctx := context.Background()
+	ann := &identity.Identity{ID: uuid.New(), NetworkID: uuid.New(), State: identity.StateActive}
+	admin := &role.Role{ID: uuid.New(), Name: "admin"}
+	editor := &role.Role{ID: uuid.New(), Name: "editor", InheritFrom: []uuid.UUID{admin.ID, uuid.New()}}
+	viewer := &role.Role{ID: uuid.New(), Name: "viewer", InheritFrom: []uuid.UUID{editor.ID}}
+	admin.InheritFrom = []uuid.UUID{viewer.ID}
+	pool := &roles{
+		roles: map[uuid.UUID]*role.Role{admin.ID: admin, editor.ID: editor, viewer.ID: viewer},
+		bindings: []*role.RoleBinding{
+			{RoleID: viewer.ID, Subject: ann.ID.String()},
+			{RoleID: admin.ID, Subject: uuid.NewString()},
+		},
+	}
+	a := NewPasswordAuthenticator(&identities{ident: ann}, &sessions{}, newTestHasher(t))
+
+	changed := time.Now().Add(-48 * time.Hour)
+	cred := &identity.Credentials{PasswordChangedAt: &changed}
+	for _, tt := range []struct {
+		key  string
+		want string
+	}{
+		{"viewer", PasswordChangeExpired},
+		{"admin", PasswordChangeExpired},
+		{admin.ID.String(), PasswordChangeExpired},
+		{"owner", ""},
+	} {
+		a.SetPasswordRotation(&PasswordRotation{
+			Expiry: &password.ExpiryPolicy{RoleMaxAge: map[string]time.Duration{tt.key: 24 * time.Hour}},
+			Roles:  pool,
+		})
+		got, err := a.passwordChangeReason(ctx, ann, cred)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("passwordChangeReason() with a max age for %s = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
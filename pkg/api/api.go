@@ -154,3 +154,17 @@ func FailWithErrCode(err error, c *gin.Context) {
 
 	Fail(c)
 }
+
+// FailWithDetailed write an error together with a data object describing it,
+// such as the fields that failed validation.
+func FailWithDetailed(data interface{}, err error, c *gin.Context) {
+	zap.S().Errorf("%#+v", err)
+	coder := errors.ParseCoder(err)
+	c.JSON(coder.HTTPStatus(), Response{
+		Success:   false,
+		Code:      coder.Code(),
+		Msg:       coder.String(),
+		Data:      data,
+		Reference: coder.Reference(),
+	})
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package authzbundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Archive entries.
+const (
+	bundleFile    = "bundle.json"
+	signatureFile = "signature.json"
+)
+
+// maxEntrySize bounds the size of a single decompressed archive entry.
+const maxEntrySize = 64 << 20
+
+var (
+	// ErrInvalidSignature is returned when a bundle is not signed by a trusted key.
+	ErrInvalidSignature = errors.New("authzbundle: invalid signature")
+	// ErrUnsupportedVersion is returned for bundles in an unknown format.
+	ErrUnsupportedVersion = errors.New("authzbundle: unsupported format version")
+	// ErrMalformed is returned when an archive cannot be read.
+	ErrMalformed = errors.New("authzbundle: malformed archive")
+)
+
+// signature is the content of signature.json.
+type signature struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"`
+}
+
+// KeyID returns a short identifier of a public key.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Encode seals b and writes it to w as a signed archive.
+func Encode(w io.Writer, b *Bundle, key ed25519.PrivateKey) error {
+	b.Seal()
+	content, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	sig, err := json.Marshal(&signature{
+		Algorithm: "EdDSA",
+		KeyID:     KeyID(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, content)),
+	})
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{bundleFile, content}, {signatureFile, sig}} {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    f.name,
+			Mode:    0o644,
+			Size:    int64(len(f.data)),
+			ModTime: b.CreatedAt,
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Decode reads a signed archive, verifies it against the trusted keys and
+// returns the bundle.
+func Decode(r io.Reader, keys ...ed25519.PublicKey) (*Bundle, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte, 2)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		if hdr.Name != bundleFile && hdr.Name != signatureFile {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, maxEntrySize+1))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		if len(data) > maxEntrySize {
+			return nil, fmt.Errorf("%w: %s too large", ErrMalformed, hdr.Name)
+		}
+		files[hdr.Name] = data
+	}
+
+	content, ok := files[bundleFile]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrMalformed, bundleFile)
+	}
+	if err := verify(content, files[signatureFile], keys); err != nil {
+		return nil, err
+	}
+
+	var b Bundle
+	if err := json.Unmarshal(content, &b); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if b.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, b.FormatVersion)
+	}
+	if b.Revision != b.digest() {
+		return nil, fmt.Errorf("%w: revision does not match content", ErrMalformed)
+	}
+	return &b, nil
+}
+
+func verify(content, raw []byte, keys []ed25519.PublicKey) error {
+	if raw == nil {
+		return ErrInvalidSignature
+	}
+	var sig signature
+	if err := json.Unmarshal(raw, &sig); err != nil {
+		return ErrInvalidSignature
+	}
+	if sig.Algorithm != "EdDSA" {
+		return ErrInvalidSignature
+	}
+	s, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, content, s) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// ParsePrivateKey decodes a base64 Ed25519 seed or private key.
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	switch len(b) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(b), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(b), nil
+	default:
+		return nil, fmt.Errorf("authzbundle: invalid private key length %d", len(b))
+	}
+}
+
+// ParsePublicKey decodes a base64 Ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("authzbundle: invalid public key length %d", len(b))
+	}
+	return ed25519.PublicKey(b), nil
+}
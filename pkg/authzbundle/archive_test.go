@@ -0,0 +1,80 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package authzbundle
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func testBundle() *Bundle {
+	return &Bundle{
+		NetworkID: "00000000-0000-0000-0000-000000000000",
+		Policies: []*Policy{
+			{ID: "p1", Subjects: []string{"viewer"}, Effect: "allow", Actions: []string{"read"}, Resources: []string{"doc"}},
+		},
+		Roles:        []*Role{{ID: "viewer"}, {ID: "editor", InheritFrom: []string{"viewer"}}},
+		RoleBindings: []*RoleBinding{{Subject: "bob", Role: "editor"}},
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, testBundle(), key); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Decode(bytes.NewReader(buf.Bytes()), pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Revision == "" || b.FormatVersion != FormatVersion {
+		t.Fatalf("bundle not sealed: %+v", b)
+	}
+
+	e := NewEvaluator("")
+	if err := e.Load(b); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := e.Authorize(context.Background(), &Request{Subject: "bob", Action: "read", Resource: "doc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Decision != "allow" {
+		t.Errorf("Decision = %q, want allow", resp.Decision)
+	}
+}
+
+func TestDecodeRejectsUntrustedKey(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(nil)
+	other, _, _ := ed25519.GenerateKey(nil)
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, testBundle(), key); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Decode(&buf, other); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Decode() error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestRevisionIgnoresOrder(t *testing.T) {
+	a, b := testBundle(), testBundle()
+	b.Roles[0], b.Roles[1] = b.Roles[1], b.Roles[0]
+	a.Seal()
+	b.Seal()
+	if a.Revision != b.Revision {
+		t.Errorf("revisions differ: %s != %s", a.Revision, b.Revision)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package authzbundle distributes signed authorization bundles.
+//
+// A bundle is a snapshot of the policies, role hierarchy and role bindings
+// of a network. The IAM server publishes it at GET /api/v1/authz/bundle,
+// when authz.serve_bundles is set, as a gzipped tar archive signed with
+// Ed25519. Services embed a Client to pull bundles, verify their signature
+// and evaluate requests locally, so they keep authorizing while the IAM
+// server is unreachable. Clients only accept bundles of their network that
+// are newer than the loaded one. Evaluation uses the same engine as the
+// server. Bundles do not carry the attributes of subjects: allow policies
+// conditioned on them never match locally and deny policies conditioned on
+// them always do, so local decisions are at most as permissive as the
+// server's.
+package authzbundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// FormatVersion is the bundle format produced by this package.
+const FormatVersion = 1
+
+// ContentType is the media type of a bundle archive.
+const ContentType = "application/vnd.iam.authz-bundle+tar+gzip"
+
+// Bundle is a snapshot of the authorization data of a network.
+type Bundle struct {
+	FormatVersion int            `json:"format_version"`
+	Revision      string         `json:"revision"`
+	NetworkID     string         `json:"network_id"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Policies      []*Policy      `json:"policies"`
+	Roles         []*Role        `json:"roles"`
+	RoleBindings  []*RoleBinding `json:"role_bindings"`
+}
+
+// Policy is a policy contained in a bundle.
+type Policy struct {
+	ID         string          `json:"id"`
+	Subjects   []string        `json:"subjects"`
+	Effect     string          `json:"effect"`
+	Actions    []string        `json:"actions"`
+	Resources  []string        `json:"resources"`
+	Conditions json.RawMessage `json:"conditions,omitempty"`
+}
+
+// Role is a role contained in a bundle.
+type Role struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	InheritFrom []string `json:"inherit_from,omitempty"`
+}
+
+// RoleBinding grants a role to a subject.
+type RoleBinding struct {
+	Subject string `json:"subject"`
+	Role    string `json:"role"`
+}
+
+// Seal sorts the bundle contents and sets FormatVersion and Revision.
+func (b *Bundle) Seal() {
+	sort.Slice(b.Policies, func(i, j int) bool { return b.Policies[i].ID < b.Policies[j].ID })
+	sort.Slice(b.Roles, func(i, j int) bool { return b.Roles[i].ID < b.Roles[j].ID })
+	sort.Slice(b.RoleBindings, func(i, j int) bool {
+		if b.RoleBindings[i].Subject != b.RoleBindings[j].Subject {
+			return b.RoleBindings[i].Subject < b.RoleBindings[j].Subject
+		}
+		return b.RoleBindings[i].Role < b.RoleBindings[j].Role
+	})
+	b.FormatVersion = FormatVersion
+	b.Revision = b.digest()
+}
+
+// ETag returns the HTTP entity tag of the bundle.
+func (b *Bundle) ETag() string {
+	return `W/"` + b.Revision + `"`
+}
+
+// digest hashes the contents that determine authorization decisions.
+func (b *Bundle) digest() string {
+	content, _ := json.Marshal(struct {
+		FormatVersion int            `json:"format_version"`
+		NetworkID     string         `json:"network_id"`
+		Policies      []*Policy      `json:"policies"`
+		Roles         []*Role        `json:"roles"`
+		RoleBindings  []*RoleBinding `json:"role_bindings"`
+	}{b.FormatVersion, b.NetworkID, b.Policies, b.Roles, b.RoleBindings})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
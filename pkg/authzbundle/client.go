@@ -0,0 +1,210 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package authzbundle
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxArchiveSize bounds the size of a downloaded archive.
+const maxArchiveSize = 64 << 20
+
+// Client pulls bundles from an IAM server and evaluates requests locally.
+//
+// The zero values of the exported fields are usable defaults; set them
+// before the first call to Sync or Run.
+type Client struct {
+	// HTTPClient performs requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Header is added to every request, e.g. for authentication.
+	Header http.Header
+	// CacheFile, if set, keeps the last verified archive on disk so a
+	// restarted client can evaluate before the server is reachable.
+	CacheFile string
+	// OnError is called by Run when a sync fails.
+	OnError func(error)
+
+	url       string
+	keys      []ed25519.PublicKey
+	evaluator *Evaluator
+
+	mu   sync.Mutex
+	etag string
+}
+
+// NewClient creates a client for the bundle of a network at url that
+// trusts keys; an empty networkID selects the default network. Bundles of
+// other networks, and bundles older than the loaded one, are rejected.
+func NewClient(url, networkID string, keys ...ed25519.PublicKey) *Client {
+	return &Client{
+		url:       url,
+		keys:      keys,
+		evaluator: NewEvaluator(networkID),
+	}
+}
+
+// Sync fetches the bundle if it changed since the last sync. It reports
+// whether a new bundle was loaded.
+func (c *Client) Sync(ctx context.Context) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return false, err
+	}
+	for k, vs := range c.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Accept", ContentType)
+
+	c.mu.Lock()
+	etag := c.etag
+	c.mu.Unlock()
+	if etag != "" && c.evaluator.Bundle() != nil {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("authzbundle: unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxArchiveSize+1))
+	if err != nil {
+		return false, err
+	}
+	if len(data) > maxArchiveSize {
+		return false, fmt.Errorf("%w: archive too large", ErrMalformed)
+	}
+
+	b, err := Decode(bytes.NewReader(data), c.keys...)
+	if err != nil {
+		return false, err
+	}
+	if err := c.evaluator.Load(b); err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	c.etag = resp.Header.Get("ETag")
+	if c.etag == "" {
+		c.etag = b.ETag()
+	}
+	c.mu.Unlock()
+
+	if c.CacheFile != "" {
+		if err := writeFile(c.CacheFile, data); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// LoadCache loads the bundle kept in CacheFile.
+func (c *Client) LoadCache() error {
+	f, err := os.Open(c.CacheFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := Decode(f, c.keys...)
+	if err != nil {
+		return err
+	}
+	if err := c.evaluator.Load(b); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.etag = b.ETag()
+	c.mu.Unlock()
+	return nil
+}
+
+// Run loads the cached bundle, if any, and then syncs every interval until
+// ctx is done.
+func (c *Client) Run(ctx context.Context, interval time.Duration) error {
+	if c.CacheFile != "" && c.evaluator.Bundle() == nil {
+		if err := c.LoadCache(); err != nil && !os.IsNotExist(err) {
+			c.reportError(err)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := c.Sync(ctx); err != nil && ctx.Err() == nil {
+			c.reportError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) reportError(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+	}
+}
+
+// Bundle returns the loaded bundle, or nil.
+func (c *Client) Bundle() *Bundle {
+	return c.evaluator.Bundle()
+}
+
+// Authorize makes an authorization decision using the loaded bundle.
+func (c *Client) Authorize(ctx context.Context, req *Request) (*Response, error) {
+	return c.evaluator.Authorize(ctx, req)
+}
+
+// Explain evaluates req using the loaded bundle and returns the evaluation
+// of every policy.
+func (c *Client) Explain(ctx context.Context, req *Request) (*Explanation, error) {
+	return c.evaluator.Explain(ctx, req)
+}
+
+// writeFile atomically replaces name with data.
+func writeFile(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package authzbundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/coding-hui/iam/internal/authz"
+)
+
+var (
+	// ErrNoBundle is returned when evaluating before a bundle has been loaded.
+	ErrNoBundle = errors.New("authzbundle: no bundle loaded")
+	// ErrNetworkMismatch is returned when loading a bundle of another
+	// network than the evaluator's.
+	ErrNetworkMismatch = errors.New("authzbundle: bundle of another network")
+	// ErrStaleBundle is returned when loading a bundle older than the
+	// loaded one, e.g. a replayed archive.
+	ErrStaleBundle = errors.New("authzbundle: bundle older than the loaded one")
+)
+
+type (
+	// Request is an authorization request.
+	Request = authz.AuthzRequest
+	// Response is an authorization decision.
+	Response = authz.AuthzResponse
+	// Explanation describes how a decision was reached.
+	Explanation = authz.Explanation
+)
+
+// Evaluator evaluates requests against the most recently loaded bundle.
+// It is safe for concurrent use.
+type Evaluator struct {
+	networkID string
+	state     atomic.Pointer[evaluatorState]
+}
+
+type evaluatorState struct {
+	bundle *Bundle
+	engine *authz.Engine
+}
+
+// NewEvaluator creates an evaluator without a bundle that accepts bundles
+// of a network; an empty networkID selects the default network.
+func NewEvaluator(networkID string) *Evaluator {
+	if networkID == "" {
+		networkID = authz.DefaultNetworkID
+	}
+	return &Evaluator{networkID: networkID}
+}
+
+// Load replaces the bundle used for evaluation. It fails with
+// ErrNetworkMismatch for bundles of another network, and with
+// ErrStaleBundle for bundles created before the loaded one, so that a
+// signed but outdated archive cannot roll back authorization data.
+// Bundles do not carry subject attributes, so conditions on them fail
+// closed, see authz.Engine.DisableSubjectAttributes.
+func (e *Evaluator) Load(b *Bundle) error {
+	if b.NetworkID != e.networkID {
+		return fmt.Errorf("%w: %s", ErrNetworkMismatch, b.NetworkID)
+	}
+
+	engine := authz.NewEngine()
+	engine.DisableSubjectAttributes()
+	engine.Reload(b.NetworkID, b.Snapshot())
+	next := &evaluatorState{bundle: b, engine: engine}
+	for {
+		cur := e.state.Load()
+		if cur != nil && cur.bundle.Revision != b.Revision && !b.CreatedAt.After(cur.bundle.CreatedAt) {
+			return fmt.Errorf("%w: created at %s, loaded %s", ErrStaleBundle,
+				b.CreatedAt.Format(time.RFC3339Nano), cur.bundle.CreatedAt.Format(time.RFC3339Nano))
+		}
+		if e.state.CompareAndSwap(cur, next) {
+			return nil
+		}
+	}
+}
+
+// Snapshot converts the bundle to the data loaded into an authz.Engine.
+func (b *Bundle) Snapshot() *authz.Snapshot {
+	s := &authz.Snapshot{
+		Policies:     make([]*authz.Policy, len(b.Policies)),
+		Roles:        make([]*authz.Role, len(b.Roles)),
+		RoleBindings: make([]*authz.RoleBinding, len(b.RoleBindings)),
+	}
+	for i, p := range b.Policies {
+		s.Policies[i] = &authz.Policy{
+			ID:         p.ID,
+			NetworkID:  b.NetworkID,
+			Subjects:   p.Subjects,
+			Effect:     p.Effect,
+			Actions:    p.Actions,
+			Resources:  p.Resources,
+			Conditions: p.Conditions,
+		}
+	}
+	for i, r := range b.Roles {
+		s.Roles[i] = &authz.Role{ID: r.ID, NetworkID: b.NetworkID, InheritFrom: r.InheritFrom}
+	}
+	for i, rb := range b.RoleBindings {
+		s.RoleBindings[i] = &authz.RoleBinding{NetworkID: b.NetworkID, Subject: rb.Subject, Role: rb.Role}
+	}
+	return s
+}
+
+// Bundle returns the loaded bundle, or nil.
+func (e *Evaluator) Bundle() *Bundle {
+	if s := e.state.Load(); s != nil {
+		return s.bundle
+	}
+	return nil
+}
+
+// Authorize makes an authorization decision. Requests without a network
+// are evaluated against the network of the bundle.
+func (e *Evaluator) Authorize(ctx context.Context, req *Request) (*Response, error) {
+	s := e.state.Load()
+	if s == nil {
+		return nil, ErrNoBundle
+	}
+	return s.engine.Authorize(ctx, s.scope(req))
+}
+
+// Explain evaluates req and returns the evaluation of every policy.
+func (e *Evaluator) Explain(ctx context.Context, req *Request) (*Explanation, error) {
+	s := e.state.Load()
+	if s == nil {
+		return nil, ErrNoBundle
+	}
+	return s.engine.Explain(ctx, s.scope(req))
+}
+
+func (s *evaluatorState) scope(req *Request) *Request {
+	if req.NetworkID != "" {
+		return req
+	}
+	scoped := *req
+	scoped.NetworkID = s.bundle.NetworkID
+	return &scoped
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package authzbundle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/coding-hui/iam/internal/authz"
+)
+
+func TestEvaluatorMatchesServer(t *testing.T) {
+	ctx := context.Background()
+	b := testBundle()
+	b.Policies = append(b.Policies,
+		&Policy{
+			ID: "p2", Subjects: []string{"editor"}, Effect: "allow", Actions: []string{"write"}, Resources: []string{"doc"},
+			Conditions: json.RawMessage(`{"subject.metadata_public.department":"eng"}`),
+		},
+		&Policy{
+			ID: "p3", Subjects: []string{"*"}, Effect: "deny", Actions: []string{"read"}, Resources: []string{"secret"},
+			Conditions: json.RawMessage(`{"subject.metadata_admin.clearance":"none","ip":"10.0.0.1"}`),
+		},
+		&Policy{ID: "p4", Subjects: []string{"*"}, Effect: "allow", Actions: []string{"read"}, Resources: []string{"secret"}},
+	)
+	b.RoleBindings = append(b.RoleBindings, &RoleBinding{Subject: "carol", Role: "editor"})
+
+	server := authz.NewEngine()
+	server.Reload(b.NetworkID, b.Snapshot())
+	server.SetSubjectAttributes(authz.SubjectAttributesFunc(func(_ context.Context, _, subject string) (map[string]any, error) {
+		switch subject {
+		case "bob":
+			return map[string]any{"metadata_public": map[string]any{"department": "eng"}}, nil
+		case "carol":
+			return map[string]any{"metadata_admin": map[string]any{"clearance": "top"}}, nil
+		}
+		return nil, nil
+	}))
+	local := NewEvaluator(b.NetworkID)
+	if err := local.Load(b); err != nil {
+		t.Fatal(err)
+	}
+
+	spoofed := map[string]any{authz.SubjectContextKey: map[string]any{"metadata_public": map[string]any{"department": "eng"}}}
+	tests := []struct {
+		name          string
+		req           *Request
+		server, local string
+	}{
+		{"without conditions", &Request{Subject: "bob", Action: "read", Resource: "doc"}, authz.DecisionAllow, authz.DecisionAllow},
+		{"unknown subject", &Request{Subject: "dave", Action: "read", Resource: "doc"}, authz.DecisionDeny, authz.DecisionDeny},
+		{"allow on attributes", &Request{Subject: "bob", Action: "write", Resource: "doc"}, authz.DecisionAllow, authz.DecisionDeny},
+		{"allow on other attributes", &Request{Subject: "carol", Action: "write", Resource: "doc"}, authz.DecisionDeny, authz.DecisionDeny},
+		{"allow on spoofed attributes", &Request{Subject: "carol", Action: "write", Resource: "doc", Context: spoofed}, authz.DecisionDeny, authz.DecisionDeny},
+		{"deny on attributes", &Request{Subject: "carol", Action: "read", Resource: "secret", Context: map[string]any{"ip": "10.0.0.1"}}, authz.DecisionAllow, authz.DecisionDeny},
+		{"deny on other conditions", &Request{Subject: "carol", Action: "read", Resource: "secret", Context: map[string]any{"ip": "10.0.0.2"}}, authz.DecisionAllow, authz.DecisionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := server.Authorize(ctx, tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := local.Authorize(ctx, tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want.Decision != tt.server || got.Decision != tt.local {
+				t.Errorf("server decided %s (%s), bundle %s (%s); want %s and %s",
+					want.Decision, want.Reason, got.Decision, got.Reason, tt.server, tt.local)
+			}
+			if want.Decision == authz.DecisionDeny && got.Decision != authz.DecisionDeny {
+				t.Error("the bundle allows what the server denies")
+			}
+		})
+	}
+}
+
+func TestEvaluatorRejectsOtherAndStaleBundles(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	bundle := func(age time.Duration, subject string) *Bundle {
+		b := testBundle()
+		b.CreatedAt = created.Add(-age)
+		b.RoleBindings[0].Subject = subject
+		b.Seal()
+		return b
+	}
+	e := NewEvaluator("")
+	if err := e.Load(bundle(0, "bob")); err != nil {
+		t.Fatal(err)
+	}
+
+	other := bundle(-time.Hour, "bob")
+	other.NetworkID = "11111111-1111-1111-1111-111111111111"
+	if err := e.Load(other); !errors.Is(err, ErrNetworkMismatch) {
+		t.Errorf("Load() of another network error = %v, want ErrNetworkMismatch", err)
+	}
+	if err := e.Load(bundle(time.Hour, "carol")); !errors.Is(err, ErrStaleBundle) {
+		t.Errorf("Load() of an older bundle error = %v, want ErrStaleBundle", err)
+	}
+	if err := e.Load(bundle(0, "carol")); !errors.Is(err, ErrStaleBundle) {
+		t.Errorf("Load() of another bundle created at the same time error = %v, want ErrStaleBundle", err)
+	}
+	if err := e.Load(bundle(0, "bob")); err != nil {
+		t.Errorf("Load() of the loaded bundle error = %v", err)
+	}
+
+	resp, err := e.Authorize(context.Background(), &Request{Subject: "bob", Action: "read", Resource: "doc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Decision != authz.DecisionAllow {
+		t.Errorf("Authorize() after rejected bundles = %s, want allow", resp.Decision)
+	}
+
+	if err := e.Load(bundle(-time.Hour, "carol")); err != nil {
+		t.Errorf("Load() of a newer bundle error = %v", err)
+	}
+	if got := e.Bundle().RoleBindings[0].Subject; got != "carol" {
+		t.Errorf("loaded bundle binds %s, want carol", got)
+	}
+}
@@ -206,3 +206,81 @@ const (
 	// ErrCannotDeleteSystemEmailTemplateCategory - 403: Cannot delete system email template category.
 	ErrCannotDeleteSystemEmailTemplateCategory
 )
+
+// iam-apiserver: identity errors.
+const (
+	// ErrIdentityTraitsInvalid - 400: Identity traits do not match the identity schema.
+	ErrIdentityTraitsInvalid int = iota + 111101
+
+	// ErrIdentitySchemaNotFound - 400: Identity schema not found.
+	ErrIdentitySchemaNotFound
+
+	// ErrIdentitySchemaAlreadyExist - 400: Identity schema already exists.
+	ErrIdentitySchemaAlreadyExist
+
+	// ErrIdentitySchemaInvalid - 400: Identity schema is invalid.
+	ErrIdentitySchemaInvalid
+
+	// ErrIdentitySchemaInUse - 400: Identity schema is in use and cannot be deleted.
+	ErrIdentitySchemaInUse
+
+	// ErrIdentityIdentifierInUse - 400: Identifier is already in use by another identity.
+	ErrIdentityIdentifierInUse
+
+	// ErrIdentityCredentialsInvalid - 400: Identity credentials are invalid.
+	ErrIdentityCredentialsInvalid
+
+	// ErrIdentityFilterInvalid - 400: Identity filter is invalid.
+	ErrIdentityFilterInvalid
+
+	// ErrIdentityStateTransitionInvalid - 400: Identity state transition is not allowed.
+	ErrIdentityStateTransitionInvalid
+
+	// ErrIdentityInactive - 403: Identity is not active.
+	ErrIdentityInactive
+
+	// ErrIdentityBulkFormatInvalid - 400: Identity import or export format is invalid.
+	ErrIdentityBulkFormatInvalid
+
+	// ErrIdentityPasswordPolicyViolated - 400: Password does not satisfy the password policy.
+	ErrIdentityPasswordPolicyViolated
+
+	// ErrIdentityAddressNotVerified - 403: Identity has no verified address.
+	ErrIdentityAddressNotVerified
+
+	// ErrIdentityVerificationCodeInvalid - 400: Verification code is invalid or expired.
+	ErrIdentityVerificationCodeInvalid
+
+	// ErrIdentityLastCredentials - 400: Cannot remove the last credentials of an identity.
+	ErrIdentityLastCredentials
+
+	// ErrIdentityOAuthStateInvalid - 400: OAuth state is invalid or expired.
+	ErrIdentityOAuthStateInvalid
+
+	// ErrIdentityMetadataInvalid - 400: Identity metadata must be a JSON object.
+	ErrIdentityMetadataInvalid
+
+	// ErrIdentityIdentifierInvalid - 400: Identifier is invalid.
+	ErrIdentityIdentifierInvalid
+
+	// ErrIdentityTypeInvalid - 400: Identity type is invalid.
+	ErrIdentityTypeInvalid
+)
+
+// iam-apiserver: service account errors.
+const (
+	// ErrServiceAccountNotFound - 404: Service account not found.
+	ErrServiceAccountNotFound int = iota + 111201
+
+	// ErrServiceAccountKeyNotFound - 404: Service account key not found.
+	ErrServiceAccountKeyNotFound
+
+	// ErrServiceAccountKeyInvalid - 400: Service account key is invalid.
+	ErrServiceAccountKeyInvalid
+
+	// ErrServiceAccountGrantUnsupported - 400: Grant type is not supported.
+	ErrServiceAccountGrantUnsupported
+
+	// ErrServiceAccountAuthFailed - 401: Service account authentication failed.
+	ErrServiceAccountAuthFailed
+)
@@ -64,6 +64,30 @@ func init() {
 	register(ErrCannotDeleteSystemEmailTemplate, 403, "Cannot delete system email template")
 	register(ErrCannotDeleteDefaultEmailTemplate, 403, "Cannot delete default email template")
 	register(ErrCannotDeleteSystemEmailTemplateCategory, 403, "Cannot delete system email template category")
+	register(ErrIdentityTraitsInvalid, 400, "Identity traits do not match the identity schema")
+	register(ErrIdentitySchemaNotFound, 400, "Identity schema not found")
+	register(ErrIdentitySchemaAlreadyExist, 400, "Identity schema already exists")
+	register(ErrIdentitySchemaInvalid, 400, "Identity schema is invalid")
+	register(ErrIdentitySchemaInUse, 400, "Identity schema is in use and cannot be deleted")
+	register(ErrIdentityIdentifierInUse, 400, "Identifier is already in use by another identity")
+	register(ErrIdentityCredentialsInvalid, 400, "Identity credentials are invalid")
+	register(ErrIdentityFilterInvalid, 400, "Identity filter is invalid")
+	register(ErrIdentityStateTransitionInvalid, 400, "Identity state transition is not allowed")
+	register(ErrIdentityInactive, 403, "Identity is not active")
+	register(ErrIdentityBulkFormatInvalid, 400, "Identity import or export format is invalid")
+	register(ErrIdentityPasswordPolicyViolated, 400, "Password does not satisfy the password policy")
+	register(ErrIdentityAddressNotVerified, 403, "Identity has no verified address")
+	register(ErrIdentityVerificationCodeInvalid, 400, "Verification code is invalid or expired")
+	register(ErrIdentityLastCredentials, 400, "Cannot remove the last credentials of an identity")
+	register(ErrIdentityOAuthStateInvalid, 400, "OAuth state is invalid or expired")
+	register(ErrIdentityMetadataInvalid, 400, "Identity metadata must be a JSON object")
+	register(ErrIdentityIdentifierInvalid, 400, "Identifier is invalid")
+	register(ErrIdentityTypeInvalid, 400, "Identity type is invalid")
+	register(ErrServiceAccountNotFound, 404, "Service account not found")
+	register(ErrServiceAccountKeyNotFound, 404, "Service account key not found")
+	register(ErrServiceAccountKeyInvalid, 400, "Service account key is invalid")
+	register(ErrServiceAccountGrantUnsupported, 400, "Grant type is not supported")
+	register(ErrServiceAccountAuthFailed, 401, "Service account authentication failed")
 	register(ErrSuccess, 200, "OK")
 	register(ErrUnknown, 500, "Internal server error")
 	register(ErrBind, 400, "Error occurred while binding the request body to the struct")
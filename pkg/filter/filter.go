@@ -0,0 +1,287 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package filter parses filter expressions in the syntax of SCIM (RFC 7644,
+// section 3.4.2.2):
+//
+//	traits.department eq "eng" and (name sw "An" or not (email ew "@example.com"))
+//	created_at ge "2024-01-01T00:00:00Z" and credentials.type pr
+//
+// Attribute paths are dot separated. Operators and the keywords and, or,
+// not, true, false and null are case-insensitive; and binds tighter than or.
+package filter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Op is a logical or comparison operator.
+type Op string
+
+// Logical operators.
+const (
+	And Op = "and"
+	Or  Op = "or"
+	Not Op = "not"
+)
+
+// Comparison operators.
+const (
+	// Eq matches equal values.
+	Eq Op = "eq"
+	// Ne matches values that differ, including missing ones.
+	Ne Op = "ne"
+	// Co matches strings containing the value.
+	Co Op = "co"
+	// Sw matches strings starting with the value.
+	Sw Op = "sw"
+	// Ew matches strings ending with the value.
+	Ew Op = "ew"
+	Gt Op = "gt"
+	Ge Op = "ge"
+	Lt Op = "lt"
+	Le Op = "le"
+	// Pr matches attributes that are present and not null. It takes no value.
+	Pr Op = "pr"
+)
+
+var comparisons = map[string]Op{
+	"eq": Eq, "ne": Ne, "co": Co, "sw": Sw, "ew": Ew,
+	"gt": Gt, "ge": Ge, "lt": Lt, "le": Le, "pr": Pr,
+}
+
+// ErrInvalidFilter is returned when a filter expression cannot be parsed.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Expr is a node of a parsed filter expression.
+type Expr struct {
+	Op Op
+	// Args are the operands of And, Or and Not.
+	Args []*Expr
+	// Attr is the attribute path of a comparison.
+	Attr string
+	// Value is the operand of a comparison: a string, json.Number, bool or
+	// nil. It is unused for Pr.
+	Value any
+}
+
+// IsLogical reports whether e is an And, Or or Not node.
+func (e *Expr) IsLogical() bool {
+	return e.Op == And || e.Op == Or || e.Op == Not
+}
+
+// Walk calls fn for every comparison in e, depth first.
+func (e *Expr) Walk(fn func(*Expr) error) error {
+	if !e.IsLogical() {
+		return fn(e)
+	}
+	for _, arg := range e.Args {
+		if err := arg.Walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String formats e in filter syntax.
+func (e *Expr) String() string {
+	switch e.Op {
+	case And, Or:
+		parts := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			parts[i] = arg.String()
+			if arg.Op == Or || (arg.Op == And && e.Op == Or) {
+				parts[i] = "(" + parts[i] + ")"
+			}
+		}
+		return strings.Join(parts, " "+string(e.Op)+" ")
+	case Not:
+		return "not (" + e.Args[0].String() + ")"
+	case Pr:
+		return e.Attr + " pr"
+	}
+	var value string
+	switch v := e.Value.(type) {
+	case string:
+		value = strconv.Quote(v)
+	case json.Number:
+		value = v.String()
+	case bool:
+		value = strconv.FormatBool(v)
+	default:
+		value = "null"
+	}
+	return e.Attr + " " + string(e.Op) + " " + value
+}
+
+// AllOf joins expressions with And, skipping nil ones. It returns nil when
+// no expression is left.
+func AllOf(exprs ...*Expr) *Expr {
+	var args []*Expr
+	for _, e := range exprs {
+		if e == nil {
+			continue
+		}
+		if e.Op == And {
+			args = append(args, e.Args...)
+		} else {
+			args = append(args, e)
+		}
+	}
+	switch len(args) {
+	case 0:
+		return nil
+	case 1:
+		return args[0]
+	}
+	return &Expr{Op: And, Args: args}
+}
+
+// Parse parses a filter expression.
+func Parse(s string) (*Expr, error) {
+	p := &parser{lex: lexer{src: s}}
+	p.next()
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return e, nil
+}
+
+type parser struct {
+	lex lexer
+	tok token
+}
+
+func (p *parser) next() {
+	p.tok = p.lex.next()
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w at offset %d: %s", ErrInvalidFilter, p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) keyword(kw string) bool {
+	return p.tok.kind == tokWord && strings.EqualFold(p.tok.text, kw)
+}
+
+func (p *parser) parseOr() (*Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	args := []*Expr{left}
+	for p.keyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, right)
+	}
+	if len(args) == 1 {
+		return left, nil
+	}
+	return &Expr{Op: Or, Args: args}, nil
+}
+
+func (p *parser) parseAnd() (*Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	args := []*Expr{left}
+	for p.keyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, right)
+	}
+	if len(args) == 1 {
+		return left, nil
+	}
+	return &Expr{Op: And, Args: args}, nil
+}
+
+func (p *parser) parseUnary() (*Expr, error) {
+	switch {
+	case p.keyword("not"):
+		p.next()
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{Op: Not, Args: []*Expr{arg}}, nil
+	case p.tok.kind == tokLParen:
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected ) but found %s", p.tok)
+		}
+		p.next()
+		return e, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (*Expr, error) {
+	if p.tok.kind != tokWord || !isAttrPath(p.tok.text) {
+		return nil, p.errorf("expected attribute path but found %s", p.tok)
+	}
+	e := &Expr{Attr: p.tok.text}
+	p.next()
+
+	op, ok := comparisons[strings.ToLower(p.tok.text)]
+	if p.tok.kind != tokWord || !ok {
+		return nil, p.errorf("expected operator after %q but found %s", e.Attr, p.tok)
+	}
+	e.Op = op
+	p.next()
+	if op == Pr {
+		return e, nil
+	}
+
+	switch {
+	case p.tok.kind == tokString:
+		e.Value = p.tok.text
+	case p.tok.kind == tokNumber:
+		e.Value = json.Number(p.tok.text)
+	case p.keyword("true"), p.keyword("false"):
+		e.Value = strings.EqualFold(p.tok.text, "true")
+	case p.keyword("null"):
+		e.Value = nil
+	default:
+		return nil, p.errorf("expected value after %q but found %s", string(op), p.tok)
+	}
+	p.next()
+	return e, nil
+}
+
+// isAttrPath reports whether s is a dot separated list of names made of
+// letters, digits, _, - and $, none starting with -.
+func isAttrPath(s string) bool {
+	for _, seg := range strings.Split(s, ".") {
+		if seg == "" || seg[0] == '-' {
+			return false
+		}
+		for _, r := range seg {
+			if !isWordRune(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{`email eq "a@example.com"`, `email eq "a@example.com"`},
+		{`traits.age GE 18 AND traits.vip eq true`, `traits.age ge 18 and traits.vip eq true`},
+		{`a eq 1 or b eq 2 and c pr`, `a eq 1 or (b eq 2 and c pr)`},
+		{`(a eq 1 or b eq 2) and not c eq null`, `(a eq 1 or b eq 2) and not (c eq null)`},
+		{`name sw "A\"n" and created_at lt "2024-01-01T00:00:00Z"`, `name sw "A\"n" and created_at lt "2024-01-01T00:00:00Z"`},
+		{`x.y-z eq -1.5e3`, `x.y-z eq -1.5e3`},
+	}
+	for _, tc := range cases {
+		e, err := Parse(tc.in)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", tc.in, err)
+		}
+		if got := e.String(); got != tc.want {
+			t.Errorf("Parse(%s) = %s, want %s", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{
+		``,
+		`email`,
+		`email is "a"`,
+		`email eq`,
+		`email eq "a`,
+		`(email eq "a"`,
+		`email eq "a" and`,
+		`email eq "a" "b"`,
+		`.email eq "a"`,
+		`email eq 1.2.3`,
+		`email eq 'a'`,
+	} {
+		if _, err := Parse(in); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("Parse(%s): expected ErrInvalidFilter, got %v", in, err)
+		}
+	}
+}
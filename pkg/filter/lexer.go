@@ -0,0 +1,130 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokNumber
+	tokLParen
+	tokRParen
+	tokInvalid
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokString:
+		return strconv.Quote(t.text)
+	case tokInvalid:
+		return t.text
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '$' || r == '.'
+}
+
+func (l *lexer) next() token {
+	for l.pos < len(l.src) && (l.src[l.pos] == ' ' || l.src[l.pos] == '\t' || l.src[l.pos] == '\n' || l.src[l.pos] == '\r') {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}
+	}
+
+	switch c := l.src[l.pos]; {
+	case c == '(':
+		l.pos++
+		return token{kind: tokLParen, text: "(", pos: start}
+	case c == ')':
+		l.pos++
+		return token{kind: tokRParen, text: ")", pos: start}
+	case c == '"':
+		return l.string()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return l.number()
+	}
+
+	r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+	if !isWordRune(r) {
+		l.pos += size
+		return token{kind: tokInvalid, text: fmt.Sprintf("character %q", r), pos: start}
+	}
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		if !isWordRune(r) {
+			break
+		}
+		l.pos += size
+	}
+	return token{kind: tokWord, text: l.src[start:l.pos], pos: start}
+}
+
+// string scans a JSON string literal.
+func (l *lexer) string() token {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos += 2
+			continue
+		case '"':
+			l.pos++
+			var s string
+			if err := json.Unmarshal([]byte(l.src[start:l.pos]), &s); err != nil {
+				return token{kind: tokInvalid, text: "invalid string literal", pos: start}
+			}
+			return token{kind: tokString, text: s, pos: start}
+		}
+		l.pos++
+	}
+	l.pos = len(l.src)
+	return token{kind: tokInvalid, text: "unterminated string literal", pos: start}
+}
+
+// number scans a JSON number literal.
+func (l *lexer) number() token {
+	start := l.pos
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if !(c >= '0' && c <= '9') && c != '-' && c != '+' && c != '.' && c != 'e' && c != 'E' {
+			break
+		}
+		l.pos++
+	}
+	text := l.src[start:l.pos]
+	var n json.Number
+	if err := json.Unmarshal([]byte(text), &n); err != nil {
+		return token{kind: tokInvalid, text: fmt.Sprintf("invalid number %q", text), pos: start}
+	}
+	return token{kind: tokNumber, text: text, pos: start}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package identifier normalizes login identifiers so that spellings users
+// perceive as equal, such as Alice@Example.com and alice@example.com, are
+// stored and looked up as one identifier.
+package identifier
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrInvalid is returned for identifiers that cannot be normalized, e.g.
+// because they mix scripts in a way used to imitate other identifiers.
+var ErrInvalid = errors.New("invalid identifier")
+
+// maxPhoneDigits is the maximum number of digits of an E.164 number.
+const maxPhoneDigits = 15
+
+// Normalize returns the canonical form of an identifier:
+//
+//   - phone numbers starting with + become E.164 numbers, e.g.
+//     +49 (30) 1234-56 becomes +4930123456; numbers with an international
+//     call prefix such as 0049 are left alone, as they cannot be told
+//     apart from numeric usernames such as 007;
+//   - the local part of email addresses is case folded and the domain
+//     is converted to lower case ASCII with IDNA;
+//   - anything else, such as a username, is case folded.
+//
+// Identifiers are NFKC normalized first, so that e.g. fullwidth letters
+// equal their ASCII counterparts. Identifiers holding invisible
+// characters or mixing scripts, such as Latin and Cyrillic letters, are
+// rejected with ErrInvalid.
+func Normalize(s string) (string, error) {
+	s = strings.TrimSpace(norm.NFKC.String(s))
+	if s == "" {
+		return "", ErrInvalid
+	}
+	for _, r := range s {
+		if unicode.IsControl(r) || unicode.In(r, unicode.Cf) {
+			return "", ErrInvalid
+		}
+	}
+
+	if isPhone(s) {
+		return normalizePhone(s)
+	}
+	if at := strings.LastIndex(s, "@"); at > 0 && at < len(s)-1 {
+		return normalizeEmail(s[:at], s[at+1:])
+	}
+	return fold(s)
+}
+
+// isPhone reports whether s looks like an international phone number in
+// + notation.
+func isPhone(s string) bool {
+	if !strings.HasPrefix(s, "+") {
+		return false
+	}
+	for _, r := range s[1:] {
+		if !isPhoneRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isPhoneRune(r rune) bool {
+	return r >= '0' && r <= '9' || strings.ContainsRune(" -.()/", r)
+}
+
+func normalizePhone(s string) (string, error) {
+	s = strings.TrimPrefix(s, "+")
+	var b strings.Builder
+	b.WriteByte('+')
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	digits := b.Len() - 1
+	if digits == 0 || digits > maxPhoneDigits || b.String()[1] == '0' {
+		return "", ErrInvalid
+	}
+	return b.String(), nil
+}
+
+func normalizeEmail(local, domain string) (string, error) {
+	local, err := fold(local)
+	if err != nil {
+		return "", err
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if !singleScript(label) {
+			return "", ErrInvalid
+		}
+	}
+	domain, err = idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", ErrInvalid
+	}
+	return local + "@" + strings.ToLower(domain), nil
+}
+
+// fold case folds s; folding can denormalize, so the result is
+// normalized again.
+func fold(s string) (string, error) {
+	if !singleScript(s) {
+		return "", ErrInvalid
+	}
+	return norm.NFKC.String(cases.Fold().String(s)), nil
+}
+
+// scriptSets are the combinations of scripts that are commonly written
+// together. Any other combination of more than one script is rejected,
+// following the highly restrictive level of Unicode TS #39.
+var scriptSets = [][]string{
+	{"Latin", "Han", "Hiragana", "Katakana"},
+	{"Latin", "Han", "Bopomofo"},
+	{"Latin", "Han", "Hangul"},
+}
+
+// singleScript reports whether the letters and digits of s belong to a
+// single script or to one of the scriptSets. Characters shared by all
+// scripts, such as digits and punctuation, are ignored.
+func singleScript(s string) bool {
+	used := map[string]bool{}
+	for _, r := range s {
+		if name := script(r); name != "" {
+			used[name] = true
+		}
+	}
+	if len(used) <= 1 {
+		return true
+	}
+	for _, set := range scriptSets {
+		n := 0
+		for _, name := range set {
+			if used[name] {
+				n++
+			}
+		}
+		if n == len(used) {
+			return true
+		}
+	}
+	return false
+}
+
+// script returns the name of the script of r, or "" for characters of
+// the Common and Inherited scripts.
+func script(r rune) string {
+	if unicode.In(r, unicode.Common, unicode.Inherited) {
+		return ""
+	}
+	for name, table := range unicode.Scripts {
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
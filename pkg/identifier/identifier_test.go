@@ -0,0 +1,43 @@
+// Copyright (c) 2023 coding-hui. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package identifier
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+		err      error
+	}{
+		{in: "Alice@Example.com", want: "alice@example.com"},
+		{in: " alice@EXAMPLE.com ", want: "alice@example.com"},
+		{in: "Ａｌｉｃｅ", want: "alice"},
+		{in: "Straße", want: "strasse"},
+		{in: "jörg@Bücher.example", want: "jörg@xn--bcher-kva.example"},
+		{in: "ivan@пример.рф", want: "ivan@xn--e1afmkfd.xn--p1ai"},
+		{in: "+49 (30) 1234-56", want: "+4930123456"},
+		// Numeric usernames are not phone numbers.
+		{in: "007", want: "007"},
+		{in: "0049301234", want: "0049301234"},
+		{in: "00 49", want: "00 49"},
+		{in: "山田Taro", want: "山田taro"},
+		// Cyrillic а in an otherwise Latin name.
+		{in: "p\u0430ypal", err: ErrInvalid},
+		{in: "p\u0430ypal@example.com", err: ErrInvalid},
+		{in: "ali\u200bce", err: ErrInvalid},
+		{in: "+0123", err: ErrInvalid},
+		{in: "+1234567890123456", err: ErrInvalid},
+		{in: " ", err: ErrInvalid},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.in)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("Normalize(%q) = %q, %v; want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}